@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- ALERTMANAGER ---
+// The "alertmanager" channel posts alerts to Prometheus Alertmanager's /api/v2/alerts, so its
+// routing, grouping, inhibition and silences apply to Pulse's thresholds. Each alert carries
+// alertname (the monitor), instance (the host), severity (warning/critical), job="pulse" and
+// alertmanager_labels. Alertmanager expires alerts that stop being sent, so firing alerts are
+// re-sent every minute with endsAt 5 minutes ahead; a recovery or level change sends endsAt=now.
+
+const (
+	amResend = time.Minute
+	amExpiry = 5 * time.Minute
+)
+
+type amAlert struct {
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+	StartsAt     time.Time         `json:"startsAt"`
+	EndsAt       time.Time         `json:"endsAt"`
+	GeneratorURL string            `json:"generatorURL,omitempty"`
+}
+
+var (
+	amFiring  = make(map[string]amAlert) // by monitor, as last sent
+	amMutex   sync.Mutex
+	promLabel = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+func amLabels(cfg AppConfig, ev AlertEvent) map[string]string {
+	l := map[string]string{}
+	m := cfg.HostMeta
+	for k, v := range map[string]string{"environment": m.Environment, "owner": m.Owner, "location": m.Location} { if v != "" { l[k] = v } }
+	for k, v := range m.Labels { l[k] = v }
+	for k, v := range cfg.AlertmanagerLabels { l[k] = v }
+	l["alertname"], l["instance"], l["severity"], l["job"] = ev.Monitor, ev.Host, strings.ToLower(ev.Level), "pulse"
+	return l
+}
+
+// postAlertmanager sends alerts to every URL in alertmanager_url; like Prometheus it needs only one to accept them.
+func postAlertmanager(cfg AppConfig, alerts []amAlert) error {
+	if len(alerts) == 0 { return nil }
+	body, _ := json.Marshal(alerts)
+	var errs []string
+	for _, u := range strings.Split(cfg.AlertmanagerURL, ",") {
+		u = strings.TrimSpace(u)
+		if u == "" { continue }
+		req, err := http.NewRequest("POST", strings.TrimSuffix(u, "/")+"/api/v2/alerts", bytes.NewReader(body))
+		if err != nil { return err }
+		req.Header.Set("Content-Type", "application/json")
+		if cfg.AlertmanagerUser != "" { req.SetBasicAuth(cfg.AlertmanagerUser, cfg.AlertmanagerPass) }
+		if err := doNotify(req); err != nil { errs = append(errs, u+": "+err.Error()) } else { return nil }
+	}
+	return fmt.Errorf("%s", strings.Join(errs, "; "))
+}
+
+func notifyAlertmanager(cfg AppConfig, ev AlertEvent) error {
+	if cfg.AlertmanagerURL == "" { return errNotConfigured }
+	now := time.Now()
+	amMutex.Lock()
+	var out []amAlert
+	// Severity is a label, so a level change ends the old alert and starts a new one.
+	if prev, ok := amFiring[ev.Monitor]; ok && (ev.Level == "OK" || prev.Labels["severity"] != strings.ToLower(ev.Level)) {
+		prev.EndsAt = now
+		out = append(out, prev)
+		delete(amFiring, ev.Monitor)
+	}
+	if ev.Level != "OK" {
+		start := time.Unix(ev.Time, 0)
+		if ev.Time == 0 { start = now }
+		a := amAlert{Labels: amLabels(cfg, ev), Annotations: map[string]string{"summary": alertTitle(ev), "value": fmt.Sprintf("%.2f", ev.Value)}, StartsAt: start, EndsAt: now.Add(amExpiry)}
+		if ev.Message != "" { a.Annotations["description"] = ev.Message }
+		amFiring[ev.Monitor] = a
+		out = append(out, a)
+	}
+	amMutex.Unlock()
+	return withRetry(3, func() error { return postAlertmanager(cfg, out) })
+}
+
+// refreshAlertmanager re-sends what is still firing and ends what no longer is, including
+// recoveries the channel never saw because severity routing kept them from it.
+func refreshAlertmanager(cfg AppConfig) error {
+	alertMutex.Lock(); active := make(map[string]string, len(activeAlerts)); for k, v := range activeAlerts { active[k] = v }; alertMutex.Unlock()
+	now := time.Now()
+	amMutex.Lock()
+	var out []amAlert
+	for mon, a := range amFiring {
+		if strings.ToLower(active[mon]) == a.Labels["severity"] { a.EndsAt = now.Add(amExpiry); amFiring[mon] = a } else { a.EndsAt = now; delete(amFiring, mon) }
+		out = append(out, a)
+	}
+	amMutex.Unlock()
+	return postAlertmanager(cfg, out)
+}
+
+func runAlertmanager() {
+	t := time.NewTicker(amResend); defer t.Stop()
+	for {
+		select {
+		case <-stopCtx.Done(): return
+		case <-t.C:
+		}
+		cfgMutex.RLock(); cfg := config; cfgMutex.RUnlock()
+		if cfg.AlertmanagerURL == "" { continue }
+		if err := refreshAlertmanager(cfg); err != nil { alertLog.Warn("alertmanager refresh failed", "err", noteNotifyError("alertmanager", err)) }
+	}
+}
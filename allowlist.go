@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// --- IP ALLOW-LISTS ---
+// allow_from limits who may reach each class of endpoint by client IP (after trusted_proxies have
+// been applied), with IPs and CIDRs: "ingest" for what other systems push (/api/v1/ingest,
+// /api/v1/events, POST /api/v1/checks/... and /heartbeat/), "api" for the rest of /api/v1 plus
+// /ws, /grafana, /federate and /healthz, and "dashboard" for everything else. An empty list allows
+// everyone. The dashboard calls /api/v1 itself; those calls (same-origin in the browser, with a
+// valid login cookie) are let through by a non-empty dashboard list as well as by the api list.
+// Headers alone can be forged, so without the cookie a client needs the api list. Without users
+// there is no login, and the dashboard list lets calls from the browser through on the header,
+// since the dashboard's own routes can do whatever the API can anyway. The public status page, the
+// admin listener and unix socket requests without X-Forwarded-For are never filtered.
+
+type AllowFrom struct {
+	Dashboard []string `json:"dashboard,omitempty"`
+	API       []string `json:"api,omitempty"`
+	Ingest    []string `json:"ingest,omitempty"`
+}
+
+// ipListed reports whether ip is one of list's addresses or in one of its CIDRs.
+func ipListed(list []string, ip net.IP) bool {
+	for _, p := range list {
+		if _, n, err := net.ParseCIDR(p); err == nil { if n.Contains(ip) { return true }; continue }
+		if pip := net.ParseIP(p); pip != nil && pip.Equal(ip) { return true }
+	}
+	return false
+}
+
+// endpointClass is "dashboard", "api" or "ingest", or "" for pages open to everyone.
+func endpointClass(r *http.Request) string {
+	p := r.URL.Path
+	switch {
+	case p == "/public" || strings.HasPrefix(p, "/public/"): return ""
+	case strings.HasPrefix(p, "/heartbeat/"),
+		r.Method == "POST" && (p == "/api/v1/ingest" || p == "/api/v1/events" || strings.HasPrefix(p, "/api/v1/checks/")): return "ingest"
+	case strings.HasPrefix(p, "/api/"), strings.HasPrefix(p, "/grafana/"), p == "/ws", p == "/federate", p == "/healthz": return "api"
+	}
+	return "dashboard"
+}
+
+// clientAllowed applies allow_from to r's client address; open is Pulse running without users.
+func clientAllowed(af AllowFrom, open bool, r *http.Request) bool {
+	ip := net.ParseIP(clientIP(r))
+	if ip == nil || fromAdminListener(r) { return true }
+	switch endpointClass(r) {
+	case "ingest": return len(af.Ingest) == 0 || ipListed(af.Ingest, ip)
+	case "api":
+		if len(af.Dashboard) > 0 && r.Header.Get("Sec-Fetch-Site") == "same-origin" && (open || sessionUser(r) != "") && ipListed(af.Dashboard, ip) { return true }
+		return len(af.API) == 0 || ipListed(af.API, ip)
+	case "dashboard": return len(af.Dashboard) == 0 || ipListed(af.Dashboard, ip)
+	}
+	return true
+}
+
+func allowClients(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfgMutex.RLock(); af, open := config.AllowFrom, len(config.Users) == 0; cfgMutex.RUnlock()
+		if clientAllowed(af, open, r) { next.ServeHTTP(w, r); return }
+		httpLog.Debug("address not allowed", "remote", r.RemoteAddr, "path", r.URL.Path, "class", endpointClass(r))
+		if strings.HasPrefix(r.URL.Path, "/api/") { apiFail(w, http.StatusForbidden, apiError{"forbidden", "your address is not allowed", nil}); return }
+		http.Error(w, "forbidden: your address is not allowed", http.StatusForbidden)
+	})
+}
+
+func validateAllowFrom(c AppConfig, bad func(field, format string, a ...interface{})) {
+	for _, l := range []struct{ class string; list []string }{{"dashboard", c.AllowFrom.Dashboard}, {"api", c.AllowFrom.API}, {"ingest", c.AllowFrom.Ingest}} {
+		for i, p := range l.list {
+			if _, _, err := net.ParseCIDR(p); err != nil && net.ParseIP(p) == nil { bad(fmt.Sprintf("allow_from.%s[%d]", l.class, i), "%q is not an IP address or CIDR", p) }
+		}
+	}
+}
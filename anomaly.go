@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// --- ANOMALY DETECTION ---
+// Each metric gets a baseline per hour of day (mean and standard deviation over history).
+// The last minute's average is compared to the baseline for the current hour; more than
+// anomaly_sigma deviations either way raises an "Anomaly <metric>" alert.
+
+type baselineStat struct {
+	N    int     `json:"n"`
+	Mean float64 `json:"mean"`
+	SD   float64 `json:"sd"`
+}
+
+var (
+	anomalyBase     map[string]*[24]baselineStat
+	anomalyBuilt    time.Time
+	anomalyBuilding bool
+	anomalyMutex    sync.Mutex
+)
+
+const anomalyWindow = 60 // seconds averaged before comparing against the baseline
+
+// metricValues lists the series that get a baseline: core metrics plus every plugin perf value.
+func metricValues(m RichMetrics) map[string]float64 {
+	v := map[string]float64{"CPU": m.CPUTotal, "Memory": m.MemUsed, "Net Down": float64(m.NetDown), "Net Up": float64(m.NetUp)}
+	for _, p := range m.Plugins {
+		pn := p.Path
+		if p.Name != "" { pn = p.Name }
+		for _, pm := range p.Perf { v[pn+" ["+pm.Label+"]"] = pm.Value }
+	}
+	return v
+}
+
+func rebuildBaselines() {
+	type acc struct{ n int; sum, sq float64 }
+	accs := map[string]*[24]acc{}
+	historyMutex.RLock()
+	for i := 0; i < history.Len(); i++ {
+		m := history.At(i)
+		h := time.Unix(m.Timestamp, 0).Hour()
+		for k, v := range metricValues(*m) {
+			a := accs[k]
+			if a == nil { a = &[24]acc{}; accs[k] = a }
+			a[h].n++; a[h].sum += v; a[h].sq += v * v
+		}
+	}
+	historyMutex.RUnlock()
+	base := make(map[string]*[24]baselineStat, len(accs))
+	for k, a := range accs {
+		b := &[24]baselineStat{}
+		for h, x := range a {
+			if x.n == 0 { continue }
+			mean := x.sum / float64(x.n)
+			b[h] = baselineStat{x.n, mean, math.Sqrt(math.Max(0, x.sq/float64(x.n)-mean*mean))}
+		}
+		base[k] = b
+	}
+	anomalyMutex.Lock(); anomalyBase, anomalyBuilt, anomalyBuilding = base, time.Now(), false; anomalyMutex.Unlock()
+}
+
+// anomalyBaselines returns a copy of the learned baselines, for /anomaly.
+func anomalyBaselines() map[string][24]baselineStat {
+	anomalyMutex.Lock(); defer anomalyMutex.Unlock()
+	out := make(map[string][24]baselineStat, len(anomalyBase))
+	for k, b := range anomalyBase { out[k] = *b }
+	return out
+}
+
+func checkAnomalies(cfg AppConfig, m RichMetrics, alert func(n, lvl string, v float64, msg string)) {
+	if cfg.AnomalySigma <= 0 { return }
+	anomalyMutex.Lock()
+	if !anomalyBuilding && time.Since(anomalyBuilt) > 10*time.Minute { anomalyBuilding = true; go rebuildBaselines() }
+	base := anomalyBase
+	anomalyMutex.Unlock()
+	if base == nil { return }
+	minN := cfg.AnomalyMinSamples
+	if minN <= 0 { minN = 300 }
+	lvl := cfg.AnomalyLevel
+	if lvl == "" { lvl = "WARNING" }
+
+	sum, n := metricValues(m), map[string]int{}
+	for k := range sum { n[k] = 1 }
+	historyMutex.RLock()
+	for i := history.Len() - 1; i >= 0 && history.At(i).Timestamp > m.Timestamp-anomalyWindow; i-- {
+		for k, v := range metricValues(*history.At(i)) { if _, ok := sum[k]; ok { sum[k] += v; n[k]++ } }
+	}
+	historyMutex.RUnlock()
+
+	h := time.Unix(m.Timestamp, 0).Hour()
+	keys := make([]string, 0, len(sum))
+	for k := range sum { keys = append(keys, k) }
+	sort.Strings(keys)
+	for _, k := range keys {
+		b, ok := base[k]
+		if !ok || b[h].N < minN { continue }
+		st, avg := b[h], sum[k]/float64(n[k])
+		// A flat baseline would make any change infinitely anomalous; floor the deviation at 1% of the mean.
+		sd := math.Max(st.SD, math.Max(math.Abs(st.Mean)*0.01, 1e-9))
+		z := (avg - st.Mean) / sd
+		if math.Abs(z) < cfg.AnomalySigma { continue }
+		dir := "above"
+		if z < 0 { dir = "below" }
+		alert("Anomaly "+k, lvl, avg, fmt.Sprintf("%s averaged %.2f over the last minute, %.1fσ %s the %02d:00 baseline (mean %.2f, sd %.2f, %d samples)", k, avg, math.Abs(z), dir, h, st.Mean, st.SD, st.N))
+	}
+}
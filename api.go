@@ -0,0 +1,313 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// --- REST API v1 ---
+// /api/v1/ is the stable surface for other tools; the unversioned endpoints stay for the dashboard
+// and may change with it. Every response is {"data": ..., "meta": {...}} or
+// {"error": {"code": "...", "message": "..."}} with a matching HTTP status. Lists take limit
+// (default 100, max 1000) and offset and report the total in meta. Login and roles work as in the
+// dashboard (session cookie or Basic auth). The OpenAPI document is at /api/v1/openapi.json.
+
+type apiMeta struct {
+	Total  int `json:"total"`
+	Limit  int `json:"limit"`
+	Offset int `json:"offset"`
+}
+
+type apiError struct {
+	Code    string       `json:"code"`
+	Message string       `json:"message"`
+	Fields  []fieldError `json:"fields,omitempty"`
+}
+
+func apiOK(w http.ResponseWriter, status int, data interface{}, meta *apiMeta) {
+	w.Header().Set("Content-Type", "application/json"); w.WriteHeader(status)
+	res := map[string]interface{}{"data": data}
+	if meta != nil { res["meta"] = meta }
+	json.NewEncoder(w).Encode(res)
+}
+
+func apiFail(w http.ResponseWriter, status int, e apiError) {
+	w.Header().Set("Content-Type", "application/json"); w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{"error": e})
+}
+
+// apiRole is needRole with an API error body.
+func apiRole(min string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !hasRole(r, min) { apiFail(w, http.StatusForbidden, apiError{"forbidden", "requires " + min, nil}); return }
+		h(w, r)
+	}
+}
+
+// decodeBatch reads a POST body holding one T, a list of them, or {"<key>": [...]}; ok is false once
+// an error has been sent.
+func decodeBatch[T any](w http.ResponseWriter, r *http.Request, key string) (items []T, ok bool) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBody))
+	if err != nil { apiFail(w, http.StatusRequestEntityTooLarge, apiError{"too_large", "the body is limited to 1 MB", nil}); return nil, false }
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		err = json.Unmarshal(body, &items)
+	} else {
+		var wrap map[string]json.RawMessage
+		if err = json.Unmarshal(body, &wrap); err == nil {
+			if list, found := wrap[key]; found { err = json.Unmarshal(list, &items) } else { var one T; err = json.Unmarshal(body, &one); items = []T{one} }
+		}
+	}
+	if err != nil { apiFail(w, http.StatusBadRequest, apiError{"bad_request", "invalid JSON: " + err.Error(), nil}); return nil, false }
+	return items, true
+}
+
+// answerBatch reports how many of a batch were accepted and why the rest were not: 202, or 422 when none was.
+func answerBatch(w http.ResponseWriter, what string, accepted int, errs []fieldError) {
+	if accepted == 0 && len(errs) > 0 { apiFail(w, http.StatusUnprocessableEntity, apiError{"invalid_" + what + "s", "no " + what + " was accepted", errs}); return }
+	res := map[string]interface{}{"accepted": accepted}
+	if len(errs) > 0 { res["rejected"] = errs }
+	apiOK(w, http.StatusAccepted, res, nil)
+}
+
+// pageParams reads limit and offset; ok is false once an error has been sent.
+func pageParams(w http.ResponseWriter, r *http.Request) (limit, offset int, ok bool) {
+	limit, offset = 100, 0
+	q := r.URL.Query()
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 1000 { apiFail(w, http.StatusBadRequest, apiError{"bad_request", "limit must be 1-1000", nil}); return 0, 0, false }
+		limit = n
+	}
+	if v := q.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 { apiFail(w, http.StatusBadRequest, apiError{"bad_request", "offset must be a non-negative integer", nil}); return 0, 0, false }
+		offset = n
+	}
+	return limit, offset, true
+}
+
+// pageBounds returns the slice bounds of one page of n items, and the meta describing it.
+func pageBounds(n, limit, offset int) (lo, hi int, meta *apiMeta) {
+	lo, hi = offset, offset+limit
+	if lo > n { lo = n }
+	if hi > n { hi = n }
+	return lo, hi, &apiMeta{n, limit, offset}
+}
+
+// parseTimeParam accepts unix seconds or RFC 3339; "" gives def.
+func parseTimeParam(v string, def int64) (int64, bool) {
+	if v == "" { return def, true }
+	if n, err := strconv.ParseInt(v, 10, 64); err == nil { return n, true }
+	t, err := time.Parse(time.RFC3339, v)
+	return t.Unix(), err == nil
+}
+
+// project keeps only "ts" and the named JSON fields of each sample.
+func project(list []RichMetrics, fields []string) []map[string]json.RawMessage {
+	out := make([]map[string]json.RawMessage, 0, len(list))
+	for _, m := range list {
+		var all map[string]json.RawMessage
+		b, _ := json.Marshal(m); json.Unmarshal(b, &all)
+		p := map[string]json.RawMessage{"ts": all["ts"]}
+		for _, f := range fields { if v, ok := all[f]; ok { p[f] = v } }
+		out = append(out, p)
+	}
+	return out
+}
+
+func latestSample() RichMetrics { latestMutex.RLock(); defer latestMutex.RUnlock(); return latestMetric }
+
+func registerAPI(mux *http.ServeMux) {
+	mux.HandleFunc("/api/v1/", func(w http.ResponseWriter, r *http.Request) {
+		apiFail(w, http.StatusNotFound, apiError{"not_found", "no such endpoint: " + r.Method + " " + r.URL.Path, nil})
+	})
+	mux.HandleFunc("GET /api/v1/openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(strings.Replace(openAPISpec, "{{base}}", urlPrefix(r), 1)))
+	})
+	mux.HandleFunc("GET /api/v1/status", func(w http.ResponseWriter, r *http.Request) { apiOK(w, 200, healthStatus(), nil) })
+	mux.HandleFunc("GET /api/v1/ebpf", handleEBPF)
+	mux.HandleFunc("GET /api/v1/metrics", func(w http.ResponseWriter, r *http.Request) {
+		m := latestSample()
+		if m.Timestamp == 0 { apiFail(w, http.StatusServiceUnavailable, apiError{"no_data", "no sample collected yet", nil}); return }
+		m.ProcessList, m.OpenPorts, m.Plugins = nil, nil, nil
+		apiOK(w, 200, m, nil)
+	})
+	mux.HandleFunc("GET /api/v1/snapshot", func(w http.ResponseWriter, r *http.Request) {
+		m := latestSample()
+		if m.Timestamp == 0 { apiFail(w, http.StatusServiceUnavailable, apiError{"no_data", "no sample collected yet", nil}); return }
+		apiOK(w, 200, m, nil)
+	})
+	mux.HandleFunc("GET /api/v1/history", func(w http.ResponseWriter, r *http.Request) {
+		if hq, agg, err := parseHistQuery(r.URL.Query()); agg {
+			if err != nil { apiFail(w, http.StatusBadRequest, apiError{"bad_request", err.Error(), nil}); return }
+			res, err := queryHistory(hq)
+			if err != nil { apiFail(w, http.StatusBadRequest, apiError{"bad_request", err.Error(), nil}); return }
+			apiOK(w, 200, res, nil)
+			return
+		}
+		limit, offset, ok := pageParams(w, r)
+		if !ok { return }
+		q := r.URL.Query()
+		start, ok1 := parseTimeParam(q.Get("start"), 0)
+		end, ok2 := parseTimeParam(q.Get("end"), 1<<62)
+		if !ok1 || !ok2 { apiFail(w, http.StatusBadRequest, apiError{"bad_request", "start and end must be unix seconds or RFC 3339", nil}); return }
+		historyMutex.RLock()
+		lo, hi := history.Search(start), history.Search(end+1)
+		if hi < lo { hi = lo }
+		a, b, meta := pageBounds(hi-lo, limit, offset)
+		sel := history.Copy(lo+a, lo+b)
+		historyMutex.RUnlock()
+		if f := q.Get("fields"); f != "" { apiOK(w, 200, project(sel, strings.Split(f, ",")), meta); return }
+		apiOK(w, 200, sel, meta)
+	})
+	mux.HandleFunc("GET /api/v1/backup", apiRole("admin", handleBackup))
+	mux.HandleFunc("POST /api/v1/history/purge", apiRole("admin", func(w http.ResponseWriter, r *http.Request) {
+		v := r.URL.Query().Get("before")
+		before, ok := parseTimeParam(v, 0)
+		if v == "" || !ok { apiFail(w, http.StatusBadRequest, apiError{"bad_request", "before must be unix seconds or RFC 3339", nil}); return }
+		removed, kept, err := purgeHistory(before)
+		auditLog("history_purge", map[string]interface{}{"user": actor(r), "before": before, "removed": removed})
+		if err != nil { storageLog.Error("cannot save history after purge", "err", err); apiFail(w, http.StatusInternalServerError, apiError{"internal", err.Error(), nil}); return }
+		apiOK(w, 200, map[string]int{"removed": removed, "remaining": kept}, nil)
+	}))
+	mux.HandleFunc("GET /api/v1/processes", func(w http.ResponseWriter, r *http.Request) {
+		limit, offset, ok := pageParams(w, r)
+		if !ok { return }
+		q := r.URL.Query()
+		dataMutex.RLock(); all := latestProcs; dataMutex.RUnlock()
+		list := []ProcessInfo{}
+		name, group := strings.ToLower(q.Get("name")), q.Get("group")
+		for _, p := range all {
+			if (name == "" || strings.Contains(strings.ToLower(p.Name), name)) && (group == "" || p.Group == group) { list = append(list, p) }
+		}
+		less := map[string]func(a, b ProcessInfo) bool{
+			"cpu":  func(a, b ProcessInfo) bool { return a.CPU > b.CPU },
+			"mem":  func(a, b ProcessInfo) bool { return a.Mem > b.Mem },
+			"io":   func(a, b ProcessInfo) bool { return a.DiskRead+a.DiskWrite > b.DiskRead+b.DiskWrite },
+			"pid":  func(a, b ProcessInfo) bool { return a.PID < b.PID },
+			"name": func(a, b ProcessInfo) bool { return strings.ToLower(a.Name) < strings.ToLower(b.Name) },
+		}
+		if s := q.Get("sort"); s != "" {
+			f, ok := less[s]
+			if !ok { apiFail(w, http.StatusBadRequest, apiError{"bad_request", "sort must be cpu, mem, io, pid or name", nil}); return }
+			sort.SliceStable(list, func(i, j int) bool { return f(list[i], list[j]) })
+		}
+		lo, hi, meta := pageBounds(len(list), limit, offset)
+		apiOK(w, 200, list[lo:hi], meta)
+	})
+	mux.HandleFunc("GET /api/v1/processes/history", handleProcessHistory)
+	mux.HandleFunc("GET /api/v1/processes/{pid}", func(w http.ResponseWriter, r *http.Request) {
+		pid, err := strconv.Atoi(r.PathValue("pid"))
+		if err != nil { apiFail(w, http.StatusBadRequest, apiError{"bad_request", "pid must be a number", nil}); return }
+		dataMutex.RLock(); all := latestProcs; dataMutex.RUnlock()
+		for _, p := range all { if p.PID == int32(pid) { apiOK(w, 200, p, nil); return } }
+		apiFail(w, http.StatusNotFound, apiError{"not_found", "no process " + r.PathValue("pid"), nil})
+	})
+	mux.HandleFunc("GET /api/v1/ports", func(w http.ResponseWriter, r *http.Request) {
+		dataMutex.RLock(); pts := latestPorts; dataMutex.RUnlock()
+		if pts == nil { pts = []PortInfo{} }
+		apiOK(w, 200, pts, &apiMeta{len(pts), len(pts), 0})
+	})
+	mux.HandleFunc("GET /api/v1/ports/{port}/clients", handlePortClients)
+	mux.HandleFunc("GET /api/v1/ports/events", handlePortEvents)
+	mux.HandleFunc("GET /api/v1/connections/geo", handleGeo)
+	mux.HandleFunc("GET /api/v1/oom", handleOOM)
+	mux.HandleFunc("GET /api/v1/mounts", func(w http.ResponseWriter, r *http.Request) {
+		list := mountDetails()
+		apiOK(w, 200, list, &apiMeta{len(list), len(list), 0})
+	})
+	mux.HandleFunc("GET /api/v1/disks", func(w http.ResponseWriter, r *http.Request) {
+		list := latestSample().Disks
+		if list == nil { list = []DiskIO{} }
+		apiOK(w, 200, list, &apiMeta{len(list), len(list), 0})
+	})
+	mux.HandleFunc("GET /api/v1/plugins", func(w http.ResponseWriter, r *http.Request) {
+		pl := latestSample().Plugins
+		if pl == nil { pl = []PluginData{} }
+		apiOK(w, 200, pl, &apiMeta{len(pl), len(pl), 0})
+	})
+	mux.HandleFunc("GET /api/v1/plugins/{id...}", func(w http.ResponseWriter, r *http.Request) {
+		dataMutex.RLock(); p, ok := pluginDetails[r.PathValue("id")]; dataMutex.RUnlock()
+		if !ok { apiFail(w, http.StatusNotFound, apiError{"not_found", "unknown plugin", nil}); return }
+		apiOK(w, 200, p, nil)
+	})
+	mux.HandleFunc("GET /api/v1/alerts", func(w http.ResponseWriter, r *http.Request) {
+		limit, offset, ok := pageParams(w, r)
+		if !ok { return }
+		level, monitor := r.URL.Query().Get("level"), r.URL.Query().Get("monitor")
+		list := []AlertEvent{}
+		alertLogMutex.RLock()
+		for i := len(alertHistory) - 1; i >= 0; i-- {
+			ev := alertHistory[i]
+			if (level == "" || ev.Level == level) && (monitor == "" || ev.Monitor == monitor) { list = append(list, ev) }
+		}
+		alertLogMutex.RUnlock()
+		lo, hi, meta := pageBounds(len(list), limit, offset)
+		apiOK(w, 200, list[lo:hi], meta)
+	})
+	mux.HandleFunc("GET /api/v1/alerts/active", func(w http.ResponseWriter, r *http.Request) {
+		cfgMutex.RLock(); cfg := config; cfgMutex.RUnlock()
+		list := currentAlerts(cfg)
+		if list == nil { list = []activeAlert{} }
+		apiOK(w, 200, list, &apiMeta{len(list), len(list), 0})
+	})
+	mux.HandleFunc("POST /api/v1/alerts/{monitor}/ack", apiRole("operator", func(w http.ResponseWriter, r *http.Request) {
+		if err := ackAlert(r.PathValue("monitor"), actor(r)); err != nil { apiFail(w, http.StatusNotFound, apiError{"not_found", err.Error(), nil}); return }
+		apiOK(w, 200, map[string]string{"monitor": r.PathValue("monitor"), "acked_by": actor(r)}, nil)
+	}))
+	mux.HandleFunc("POST /api/v1/alerts/{monitor}/remediate", apiRole("operator", func(w http.ResponseWriter, r *http.Request) {
+		if err := runRemediationNow(r.PathValue("monitor"), actor(r)); err != nil { apiFail(w, http.StatusNotFound, apiError{"not_found", err.Error(), nil}); return }
+		apiOK(w, http.StatusAccepted, map[string]string{"monitor": r.PathValue("monitor"), "status": "started"}, nil)
+	}))
+	mux.HandleFunc("GET /api/v1/config", func(w http.ResponseWriter, r *http.Request) {
+		cfgMutex.RLock(); c := redactConfig(config); cfgMutex.RUnlock()
+		apiOK(w, 200, c, nil)
+	})
+	mux.HandleFunc("PATCH /api/v1/config", apiRole("admin", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+		errs, err := updateConfig(body, actor(r), "api")
+		if err != nil { apiFail(w, http.StatusInternalServerError, apiError{"internal", err.Error(), nil}); return }
+		if len(errs) > 0 { apiFail(w, http.StatusUnprocessableEntity, apiError{"invalid_config", "the config was not changed", errs}); return }
+		cfgMutex.RLock(); c := redactConfig(config); cfgMutex.RUnlock()
+		apiOK(w, 200, c, nil)
+	}))
+	mux.HandleFunc("GET /api/v1/config/revisions", func(w http.ResponseWriter, r *http.Request) {
+		limit, offset, ok := pageParams(w, r)
+		if !ok { return }
+		list := listRevisions()
+		lo, hi, meta := pageBounds(len(list), limit, offset)
+		apiOK(w, 200, list[lo:hi], meta)
+	})
+	mux.HandleFunc("POST /api/v1/config/revisions/{id}/rollback", apiRole("admin", func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil { apiFail(w, http.StatusBadRequest, apiError{"bad_request", "id must be a number", nil}); return }
+		if err := rollbackConfig(id, actor(r)); err != nil { apiFail(w, http.StatusNotFound, apiError{"not_found", err.Error(), nil}); return }
+		cfgMutex.RLock(); c := redactConfig(config); cfgMutex.RUnlock()
+		apiOK(w, 200, c, nil)
+	}))
+}
+
+// statusLine is /status.txt: one line for a MOTD, tmux or a shell prompt, e.g.
+// "web1 load 0.42 cpu 12% mem 48% disk 71% CRITICAL Disk +1" (the worst active alert and how many others).
+func statusLine() string {
+	m := latestSample()
+	if m.Timestamp == 0 { return "pulse: no data yet" }
+	cfgMutex.RLock(); cfg := config; cfgMutex.RUnlock()
+	state := "OK"
+	if list := currentAlerts(cfg); len(list) > 0 {
+		sort.SliceStable(list, func(i, j int) bool { return list[i].Level == "CRITICAL" && list[j].Level != "CRITICAL" })
+		state = list[0].Level + " " + list[0].Monitor
+		if list[0].AckedBy != "" { state += " (acked)" }
+		if len(list) > 1 { state += fmt.Sprintf(" +%d", len(list)-1) }
+	}
+	return fmt.Sprintf("%s load %.2f cpu %.0f%% mem %.0f%% disk %.0f%% %s", m.Hostname, m.Load1, m.CPUTotal, m.MemUsed, m.DiskUsed, state)
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- ARP WATCH ---
+// With arp_subnets set, Pulse reads the host's ARP table every ten seconds and remembers which MAC
+// answered for each IP in those subnets. Three things are recorded: a MAC never seen before
+// ("new"), an IP that moved to another MAC ("changed", a replaced NIC or a spoofed gateway), and an
+// IP that moved back to the MAC it just left ("conflict"): two hosts are answering for the same IP.
+// The first scan only learns. New MACs raise "New MAC" and conflicts "Duplicate IP <ip>" for ten
+// minutes; everything is kept in pulse.arp.json.
+
+type ARPEntry struct {
+	IP      string `json:"ip"`
+	MAC     string `json:"mac"`
+	Device  string `json:"device,omitempty"`
+	First   int64  `json:"first"` // first seen with this MAC
+	Last    int64  `json:"last"`
+	PrevMAC string `json:"prev_mac,omitempty"` // the MAC before the last change
+	Changed int64  `json:"changed,omitempty"`
+}
+
+type ARPEvent struct {
+	Time   int64  `json:"time"`
+	Kind   string `json:"kind"` // new, changed or conflict
+	IP     string `json:"ip"`
+	MAC    string `json:"mac"`
+	OldMAC string `json:"old_mac,omitempty"`
+	Device string `json:"device,omitempty"`
+}
+
+// arpNeighbor is one complete entry of the ARP table.
+type arpNeighbor struct {
+	IP     netip.Addr
+	MAC    string
+	Device string
+}
+
+const (
+	arpEvery       = 10 * time.Second
+	arpConflictFor = 10 * time.Minute // how soon a move back counts as a conflict, and how long alerts last
+	maxARPEvents   = 500
+)
+
+var arpFile = "pulse.arp.json"
+
+var (
+	arpMutex  sync.Mutex
+	arpData   struct {
+		Entries map[string]*ARPEntry `json:"entries"` // by IP
+		MACs    map[string]int64     `json:"macs"`    // every MAC seen, with when it was first
+		Events  []ARPEvent           `json:"events"`  // oldest first
+	}
+	arpLoaded bool
+	arpSaved  time.Time
+)
+
+func loadARP() {
+	if arpLoaded { return }
+	arpLoaded = true
+	if b, err := os.ReadFile(arpFile); err == nil {
+		if err := json.Unmarshal(b, &arpData); err != nil { storageLog.Error("cannot read ARP table", "file", arpFile, "err", err) }
+	}
+	if arpData.Entries == nil { arpData.Entries = map[string]*ARPEntry{} }
+	if arpData.MACs == nil { arpData.MACs = map[string]int64{} }
+}
+
+func saveARP() {
+	arpSaved = time.Now()
+	if observeOnly { return }
+	b, _ := json.MarshalIndent(arpData, "", "  ")
+	tmp := arpFile + ".tmp"
+	err := os.WriteFile(tmp, b, 0600)
+	if err == nil { err = os.Rename(tmp, arpFile) }
+	if err != nil { storageLog.Error("cannot save ARP table", "file", arpFile, "err", err) }
+}
+
+// normalMAC writes a MAC as six lower-case, colon-separated pairs ("0:1b:2c-.." from arp -a included).
+func normalMAC(s string) string {
+	parts := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool { return r == ':' || r == '-' })
+	if len(parts) != 6 { return "" }
+	for i, p := range parts { if len(p) == 1 { parts[i] = "0" + p } }
+	mac := strings.Join(parts, ":")
+	if mac == "00:00:00:00:00:00" || mac == "ff:ff:ff:ff:ff:ff" { return "" }
+	return mac
+}
+
+func runARPWatch() {
+	t := time.NewTicker(arpEvery); defer t.Stop()
+	for {
+		cfgMutex.RLock(); subnets := config.ARPSubnets; cfgMutex.RUnlock()
+		if len(subnets) > 0 { scanARP(subnets) }
+		select { case <-stopCtx.Done(): return; case <-t.C: }
+	}
+}
+
+func scanARP(subnets []string) {
+	var nets []netip.Prefix
+	for _, s := range subnets { if p, err := netip.ParsePrefix(s); err == nil { nets = append(nets, p.Masked()) } }
+	list, err := arpNeighbors()
+	if err != nil { noteCap("arp", collectorCap{Note: "the ARP table can't be read: " + err.Error()}); return }
+	noteCap("arp", collectorCap{OK: true})
+	now := time.Now().Unix()
+	arpMutex.Lock(); defer arpMutex.Unlock()
+	loadARP()
+	learning, dirty := len(arpData.MACs) == 0, false
+	event := func(e ARPEvent) {
+		dirty = true
+		if learning { return }
+		arpData.Events = append(arpData.Events, e)
+		if len(arpData.Events) > maxARPEvents { arpData.Events = arpData.Events[len(arpData.Events)-maxARPEvents:] }
+		collectorLog.Warn("ARP "+e.Kind, "ip", e.IP, "mac", e.MAC, "old_mac", e.OldMAC, "device", e.Device)
+	}
+	for _, n := range list {
+		in := false
+		for _, p := range nets { in = in || p.Contains(n.IP) }
+		if !in { continue }
+		ip := n.IP.String()
+		if _, ok := arpData.MACs[n.MAC]; !ok {
+			arpData.MACs[n.MAC] = now
+			event(ARPEvent{Time: now, Kind: "new", IP: ip, MAC: n.MAC, Device: n.Device})
+		}
+		e := arpData.Entries[ip]
+		switch {
+		case e == nil:
+			arpData.Entries[ip] = &ARPEntry{IP: ip, MAC: n.MAC, Device: n.Device, First: now, Last: now}; dirty = true
+		case e.MAC != n.MAC:
+			kind := "changed"
+			if e.PrevMAC == n.MAC && now-e.Changed <= int64(arpConflictFor/time.Second) { kind = "conflict" }
+			event(ARPEvent{Time: now, Kind: kind, IP: ip, MAC: n.MAC, OldMAC: e.MAC, Device: n.Device})
+			e.PrevMAC, e.MAC, e.Device, e.First, e.Last, e.Changed = e.MAC, n.MAC, n.Device, now, now, now
+		default:
+			e.Last = now
+		}
+	}
+	// Last-seen times alone are saved every few minutes.
+	if dirty || time.Since(arpSaved) > 5*time.Minute { saveARP() }
+}
+
+// checkARP raises "New MAC" and "Duplicate IP <ip>" while such events are recent.
+func checkARP(cfg AppConfig, m RichMetrics, alert func(n, lvl string, v float64, msg string)) {
+	if len(cfg.ARPSubnets) == 0 { return }
+	arpMutex.Lock(); defer arpMutex.Unlock()
+	loadARP()
+	since := m.Timestamp - int64(arpConflictFor/time.Second)
+	var news []string
+	conflicts := map[string]ARPEvent{}
+	for _, e := range arpData.Events {
+		if e.Time <= since { continue }
+		switch e.Kind {
+		case "new": news = append(news, e.MAC+" ("+e.IP+")")
+		case "conflict": conflicts[e.IP] = e
+		}
+	}
+	for ip, e := range conflicts { alert("Duplicate IP "+ip, "CRITICAL", 2, fmt.Sprintf("%s is claimed by both %s and %s", ip, e.MAC, e.OldMAC)) }
+	if len(news) > 0 { alert("New MAC", "WARNING", float64(len(news)), "new on the network: "+strings.Join(news, ", ")) }
+}
+
+func validateARP(c AppConfig, bad func(field, format string, a ...interface{})) {
+	for _, s := range c.ARPSubnets {
+		p, err := netip.ParsePrefix(s)
+		if err != nil { bad("arp_subnets", "%q is not a subnet like 192.168.1.0/24", s); continue }
+		if !p.Addr().Is4() { bad("arp_subnets", "%q: only IPv4 subnets have ARP", s) }
+	}
+}
+
+func registerARPAPI(mux *http.ServeMux) {
+	// The table as last seen, by IP.
+	mux.HandleFunc("GET /api/v1/arp", func(w http.ResponseWriter, r *http.Request) {
+		limit, offset, ok := pageParams(w, r)
+		if !ok { return }
+		list := []ARPEntry{}
+		arpMutex.Lock()
+		loadARP()
+		for _, e := range arpData.Entries { list = append(list, *e) }
+		arpMutex.Unlock()
+		sort.Slice(list, func(i, j int) bool { a, _ := netip.ParseAddr(list[i].IP); b, _ := netip.ParseAddr(list[j].IP); return a.Less(b) })
+		lo, hi, meta := pageBounds(len(list), limit, offset)
+		apiOK(w, 200, list[lo:hi], meta)
+	})
+	// Events newest first, optionally of one kind and between start and end.
+	mux.HandleFunc("GET /api/v1/arp/events", func(w http.ResponseWriter, r *http.Request) {
+		limit, offset, ok := pageParams(w, r)
+		if !ok { return }
+		q := r.URL.Query()
+		start, ok1 := parseTimeParam(q.Get("start"), 0)
+		end, ok2 := parseTimeParam(q.Get("end"), 1<<62)
+		if !ok1 || !ok2 { apiFail(w, http.StatusBadRequest, apiError{"bad_request", "start and end must be unix seconds or RFC 3339", nil}); return }
+		kind := q.Get("kind")
+		if kind != "" && kind != "new" && kind != "changed" && kind != "conflict" { apiFail(w, http.StatusBadRequest, apiError{"bad_request", "kind must be new, changed or conflict", nil}); return }
+		list := []ARPEvent{}
+		arpMutex.Lock()
+		loadARP()
+		for i := len(arpData.Events) - 1; i >= 0; i-- {
+			if e := arpData.Events[i]; e.Time >= start && e.Time <= end && (kind == "" || e.Kind == kind) { list = append(list, e) }
+		}
+		arpMutex.Unlock()
+		lo, hi, meta := pageBounds(len(list), limit, offset)
+		apiOK(w, 200, list[lo:hi], meta)
+	})
+}
@@ -0,0 +1,28 @@
+//go:build linux
+
+package main
+
+import (
+	"net/netip"
+	"os"
+	"strings"
+)
+
+// arpNeighbors reads /proc/net/arp:
+//   IP address       HW type     Flags       HW address            Mask     Device
+//   192.168.1.1      0x1         0x2         aa:bb:cc:dd:ee:ff     *        eth0
+// Flags 0x0 is an entry still waiting for an answer.
+func arpNeighbors() ([]arpNeighbor, error) {
+	b, err := os.ReadFile("/proc/net/arp")
+	if err != nil { return nil, err }
+	var res []arpNeighbor
+	for _, line := range strings.Split(string(b), "\n")[1:] {
+		f := strings.Fields(line)
+		if len(f) < 6 || f[2] == "0x0" { continue }
+		ip, err := netip.ParseAddr(f[0])
+		mac := normalMAC(f[3])
+		if err != nil || mac == "" { continue }
+		res = append(res, arpNeighbor{ip, mac, f[5]})
+	}
+	return res, nil
+}
@@ -0,0 +1,30 @@
+//go:build !linux
+
+package main
+
+import (
+	"net/netip"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+// arp -a prints "? (192.168.1.1) at 0:1b:2c:3d:4e:5f on en0 ifscope [ethernet]" on macOS and the
+// BSDs, and "  192.168.1.1   00-1b-2c-3d-4e-5f   dynamic" under an "Interface:" line on Windows.
+var arpLine = regexp.MustCompile(`(\d+\.\d+\.\d+\.\d+)\)?\s+(?:at\s+)?([0-9A-Fa-f]{1,2}(?:[:-][0-9A-Fa-f]{1,2}){5})(?:\s+on\s+(\S+))?`)
+
+func arpNeighbors() ([]arpNeighbor, error) {
+	out, err := exec.Command("arp", "-an").Output()
+	if err != nil { out, err = exec.Command("arp", "-a").Output() }
+	if err != nil { return nil, err }
+	var res []arpNeighbor
+	for _, line := range strings.Split(string(out), "\n") {
+		m := arpLine.FindStringSubmatch(line)
+		if m == nil { continue }
+		ip, err := netip.ParseAddr(m[1])
+		mac := normalMAC(m[2])
+		if err != nil || mac == "" { continue }
+		res = append(res, arpNeighbor{ip, mac, m[3]})
+	}
+	return res, nil
+}
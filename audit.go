@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- AUDIT LOG ---
+// Administrative actions and the actions Pulse takes on the host are appended to auditFile as JSON
+// lines: the time, the action, who did it and what it was about. Config changes carry every setting
+// they changed with its old and new value (secrets masked), so "who set cpu_crit to 99" has an
+// answer. Pulse never rewrites the file; GET /api/v1/audit reads it back newest first.
+
+var auditMutex sync.Mutex
+
+func auditLog(action string, fields map[string]interface{}) {
+	entry := map[string]interface{}{"time": time.Now().Format(time.RFC3339), "action": action}
+	for k, v := range fields { entry[k] = v }
+	auditMutex.Lock(); defer auditMutex.Unlock()
+	f, err := os.OpenFile(auditFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil { storageLog.Error("cannot write audit log", "file", auditFile, "err", err); return }
+	defer f.Close()
+	json.NewEncoder(f).Encode(entry)
+}
+
+// auditQuery picks entries from the audit log; empty fields match everything.
+type auditQuery struct {
+	actions    map[string]bool
+	user, text string
+	start, end int64
+}
+
+// readAudit returns the matching entries, newest first.
+func readAudit(q auditQuery) ([]map[string]interface{}, error) {
+	auditMutex.Lock(); defer auditMutex.Unlock()
+	list := []map[string]interface{}{}
+	f, err := os.Open(auditFile)
+	if os.IsNotExist(err) { return list, nil }
+	if err != nil { return nil, err }
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 1<<20), 16<<20)
+	for sc.Scan() {
+		if q.text != "" && !strings.Contains(strings.ToLower(sc.Text()), q.text) { continue }
+		var e map[string]interface{}
+		if json.Unmarshal(sc.Bytes(), &e) != nil { continue }
+		a, _ := e["action"].(string)
+		u, _ := e["user"].(string)
+		ts, _ := e["time"].(string)
+		t, err := time.Parse(time.RFC3339, ts)
+		if err != nil || t.Unix() < q.start || t.Unix() > q.end { continue }
+		if (len(q.actions) == 0 || q.actions[a]) && (q.user == "" || u == q.user) { list = append(list, e) }
+	}
+	for i, j := 0, len(list)-1; i < j; i, j = i+1, j-1 { list[i], list[j] = list[j], list[i] }
+	return list, sc.Err()
+}
+
+func registerAuditAPI(mux *http.ServeMux) {
+	// Entries newest first, optionally of some actions (action=ack,config_change), one user, a time range, or containing q.
+	mux.HandleFunc("GET /api/v1/audit", apiRole("admin", func(w http.ResponseWriter, r *http.Request) {
+		limit, offset, ok := pageParams(w, r)
+		if !ok { return }
+		v := r.URL.Query()
+		start, ok1 := parseTimeParam(v.Get("start"), 0)
+		end, ok2 := parseTimeParam(v.Get("end"), 1<<62)
+		if !ok1 || !ok2 { apiFail(w, http.StatusBadRequest, apiError{"bad_request", "start and end must be unix seconds or RFC 3339", nil}); return }
+		q := auditQuery{user: v.Get("user"), text: strings.ToLower(v.Get("q")), start: start, end: end}
+		if a := v.Get("action"); a != "" {
+			q.actions = map[string]bool{}
+			for _, s := range strings.Split(a, ",") { q.actions[strings.TrimSpace(s)] = true }
+		}
+		list, err := readAudit(q)
+		if err != nil { apiFail(w, http.StatusInternalServerError, apiError{"internal", "cannot read the audit log: " + err.Error(), nil}); return }
+		lo, hi, meta := pageBounds(len(list), limit, offset)
+		apiOK(w, 200, list[lo:hi], meta)
+	}))
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// --- AUTH ---
+// With users in the config every request needs a session cookie (from /login) or HTTP Basic
+// credentials. Without users the dashboard stays open, as before. /heartbeat/ pings stay
+// unauthenticated so cron jobs don't need credentials.
+
+type UserConfig struct {
+	Username     string `json:"username"`
+	PasswordHash string `json:"password_hash"`
+	Role         string `json:"role,omitempty"`
+}
+
+type session struct {
+	user    string
+	expires time.Time
+}
+
+const (
+	sessionCookie = "pulse_session"
+	sessionTTL    = 12 * time.Hour
+)
+
+const userCtx ctxKey = 2
+
+// authedUser is the user requireAuth resolved for a request. Basic auth costs a bcrypt compare,
+// so requestRole, actor and the request log read this instead of checking the password again.
+type authedUser struct {
+	name  string
+	known bool
+}
+
+var (
+	sessions     = make(map[string]session)
+	sessionMutex sync.Mutex
+)
+
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("pulse"), bcrypt.DefaultCost)
+
+var publicPaths = []string{"/login", "/logout", "/heartbeat/", "/healthz", "/manifest.webmanifest", "/sw.js", "/icon.svg", "/public"}
+
+func checkPassword(cfg AppConfig, user, pass string) bool {
+	for _, u := range cfg.Users {
+		if u.Username == user { return bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(pass)) == nil }
+	}
+	// Compare against a dummy hash so unknown users take as long as wrong passwords.
+	bcrypt.CompareHashAndPassword(dummyHash, []byte(pass))
+	return false
+}
+
+func newSession(user string) string {
+	b := make([]byte, 32); rand.Read(b)
+	id := hex.EncodeToString(b)
+	sessionMutex.Lock(); defer sessionMutex.Unlock()
+	now := time.Now()
+	for k, s := range sessions { if now.After(s.expires) { delete(sessions, k) } }
+	sessions[id] = session{user, now.Add(sessionTTL)}
+	return id
+}
+
+// currentUser returns the authenticated user name, or "" if the request has no valid credentials.
+func currentUser(r *http.Request) string {
+	if a, _ := r.Context().Value(userCtx).(*authedUser); a != nil && a.known { return a.name }
+	return lookupUser(r)
+}
+
+// withUser gives r a slot for the resolved user, unless an outer handler already did.
+func withUser(r *http.Request) (*http.Request, *authedUser) {
+	if a, _ := r.Context().Value(userCtx).(*authedUser); a != nil { return r, a }
+	a := &authedUser{}
+	return r.WithContext(context.WithValue(r.Context(), userCtx, a)), a
+}
+
+// sessionUser is the user r's login cookie belongs to, or "" without a valid one.
+func sessionUser(r *http.Request) string {
+	c, err := r.Cookie(sessionCookie)
+	if err != nil { return "" }
+	sessionMutex.Lock(); s, ok := sessions[c.Value]; sessionMutex.Unlock()
+	if ok && time.Now().Before(s.expires) { return s.user }
+	return ""
+}
+
+func lookupUser(r *http.Request) string {
+	if u := sessionUser(r); u != "" { return u }
+	if u, p, ok := r.BasicAuth(); ok {
+		cfgMutex.RLock(); cfg := config; cfgMutex.RUnlock()
+		if checkPassword(cfg, u, p) { return u }
+	}
+	return ""
+}
+
+func requireAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfgMutex.RLock(); open := len(config.Users) == 0; cfgMutex.RUnlock()
+		r, a := withUser(r)
+		if open { a.known = true; next.ServeHTTP(w, r); return }
+		if fromAdminListener(r) { a.name, a.known = lookupUser(r), true; next.ServeHTTP(w, r); return }
+		for _, p := range publicPaths { if strings.HasPrefix(r.URL.Path, p) { next.ServeHTTP(w, r); return } }
+		if a.name, a.known = lookupUser(r), true; a.name != "" { next.ServeHTTP(w, r); return }
+		if r.URL.Path == "/" { http.Redirect(w, r, urlPrefix(r)+"/login", http.StatusSeeOther); return }
+		if strings.HasPrefix(r.URL.Path, "/api/") { apiFail(w, http.StatusUnauthorized, apiError{"unauthorized", "log in or use Basic auth", nil}); return }
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	})
+}
+
+const loginPage = `<!DOCTYPE html><html><head><meta charset="UTF-8"><title>Pulse Login</title>
+<style>body{background:#121212;color:#e0e0e0;font-family:'Segoe UI',sans-serif;display:flex;align-items:center;justify-content:center;height:100vh;margin:0}
+form{background:#1e1e1e;border:1px solid #333;border-radius:8px;padding:30px;width:260px}input{width:100%%;box-sizing:border-box;margin:6px 0 14px;padding:8px;background:#111;color:#ccc;border:1px solid #444}
+button{width:100%%;padding:8px;background:#00d1b2;border:0;color:#111;font-weight:bold;cursor:pointer}.err{color:#ff3860;font-size:12px;min-height:16px}</style></head>
+<body><form method="POST" action="login"><h2 style="margin-top:0">PULSE</h2><div class="err">%s</div>
+<label>Username</label><input name="username" autofocus><label>Password</label><input name="password" type="password"><button>Log in</button></form></body></html>`
+
+func handleLogin(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html")
+	if r.Method != "POST" { fmt.Fprintf(w, loginPage, ""); return }
+	cfgMutex.RLock(); cfg := config; cfgMutex.RUnlock()
+	user := r.FormValue("username")
+	if !checkPassword(cfg, user, r.FormValue("password")) {
+		httpLog.Warn("login failed", "user", user, "remote", r.RemoteAddr)
+		time.Sleep(500 * time.Millisecond)
+		w.WriteHeader(http.StatusUnauthorized); fmt.Fprintf(w, loginPage, "Invalid username or password"); return
+	}
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Value: newSession(user), Path: urlPrefix(r) + "/", HttpOnly: true, Secure: requestScheme(r) == "https",
+		SameSite: http.SameSiteLaxMode, MaxAge: int(sessionTTL.Seconds())})
+	http.Redirect(w, r, urlPrefix(r)+"/", http.StatusSeeOther)
+}
+
+func handleLogout(w http.ResponseWriter, r *http.Request) {
+	if c, err := r.Cookie(sessionCookie); err == nil { sessionMutex.Lock(); delete(sessions, c.Value); sessionMutex.Unlock() }
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Value: "", Path: urlPrefix(r) + "/", MaxAge: -1})
+	http.Redirect(w, r, urlPrefix(r)+"/login", http.StatusSeeOther)
+}
+
+// setPassword implements "pulse passwd <user> [role]": reads a password from stdin and stores its bcrypt hash.
+// An empty role keeps the user's current one.
+func setPassword(user, role string) error {
+	if _, ok := roleRank[role]; role != "" && !ok { return fmt.Errorf("unknown role %q (viewer, operator or admin)", role) }
+	fmt.Fprintf(os.Stderr, "New password for %s: ", user)
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" { return err }
+	pass := strings.TrimRight(line, "\r\n")
+	if len(pass) < 8 { return fmt.Errorf("password must be at least 8 characters") }
+	hash, err := bcrypt.GenerateFromPassword([]byte(pass), bcrypt.DefaultCost)
+	if err != nil { return err }
+	loadConfig()
+	cfgMutex.Lock()
+	found := false
+	for i, u := range config.Users {
+		if u.Username != user { continue }
+		config.Users[i].PasswordHash = string(hash); found = true
+		if role != "" { config.Users[i].Role = role }
+	}
+	if !found { config.Users = append(config.Users, UserConfig{user, string(hash), role}) }
+	cfgMutex.Unlock()
+	if err := saveConfig(); err != nil { return err }
+	auditLog("password_set", map[string]interface{}{"user": "pulse passwd", "for": user, "role": role, "new_user": !found})
+	fmt.Fprintln(os.Stderr, "Saved to", confFile)
+	return nil
+}
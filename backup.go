@@ -0,0 +1,171 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// --- BACKUP & RESTORE ---
+// GET /api/v1/backup (admin) streams a .tar.gz with the history (as in memory, so up to the latest
+// sample), pulse.conf and its revisions, the alert log, cron job results, OOM kills, preferences, push keys and subscriptions,
+// and pulse.secret, without which the passwords in pulse.conf can't be read (?secrets=false leaves
+// it out). "pulse restore <file>" puts them back in the data directory of the Pulse it runs as;
+// files it replaces are kept as .pre-restore.
+
+type backupManifest struct {
+	Format  int      `json:"format"`
+	Schema  int      `json:"history_schema"`
+	Host    string   `json:"host"`
+	Created string   `json:"created"`
+	Files   []string `json:"files"`
+}
+
+// backupFile maps a name in the archive to where it lives here. Paths are read when used, since
+// --data-dir and data_file move them.
+type backupFile struct {
+	name   string
+	path   func() string
+	secret bool
+}
+
+// The config comes first, so restore can read data_file before it writes the history.
+var backupFiles = []backupFile{
+	{"pulse.conf", func() string { return confFile }, false},
+	{"pulse.conf.history", revisionFile, false},
+	{"pulse.conf.prefs", prefsFile, false},
+	{"pulse.secret", func() string { return secretKeyFile }, true},
+	{"pulse.vapid", func() string { return vapidKeyFile }, true},
+	{"pulse.push.json", func() string { return pushFile }, false},
+	{"pulse.audit.log", func() string { return auditFile }, false},
+	{"alerts.json", func() string { return alertsFile }, false},
+	{"pulse.incidents.json", func() string { return incidentsFile }, false},
+	{"pulse.runs.json", func() string { return runsFile }, false},
+	{"pulse.oom.json", func() string { return oomFile }, false},
+	{"pulse.arp.json", func() string { return arpFile }, false},
+	{"pulse.ports.json", func() string { return portsFile }, false},
+	{"pulse.baseline.json", func() string { return baselineFile }, false},
+	{"history.data.gz", func() string { return dbFile }, false},
+}
+
+func tarAdd(tw *tar.Writer, name string, b []byte) error {
+	if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: name, Mode: 0600, Size: int64(len(b)), ModTime: time.Now()}); err != nil { return err }
+	_, err := tw.Write(b)
+	return err
+}
+
+func writeBackup(w io.Writer, secrets bool) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	man := backupManifest{Format: 1, Schema: historySchema, Host: latestSample().Hostname, Created: time.Now().UTC().Format(time.RFC3339)}
+	contents := map[string][]byte{}
+	for _, f := range backupFiles {
+		if f.secret && !secrets { continue }
+		var b []byte
+		var err error
+		switch f.name {
+		case "history.data.gz":
+			var buf bytes.Buffer
+			historyMutex.RLock(); snap := history.Copy(0, history.Len()); historyMutex.RUnlock()
+			err = writeHistoryFile(&buf, snap)
+			b = buf.Bytes()
+		case "alerts.json":
+			alertLogMutex.RLock(); b, err = json.Marshal(alertHistory); alertLogMutex.RUnlock()
+		default:
+			b, err = os.ReadFile(f.path())
+			if os.IsNotExist(err) { continue }
+		}
+		if err != nil { return fmt.Errorf("%s: %w", f.name, err) }
+		contents[f.name] = b
+		man.Files = append(man.Files, f.name)
+	}
+	mb, _ := json.MarshalIndent(man, "", "  ")
+	if err := tarAdd(tw, "manifest.json", mb); err != nil { return err }
+	for _, name := range man.Files {
+		if err := tarAdd(tw, name, contents[name]); err != nil { return err }
+	}
+	if err := tw.Close(); err != nil { return err }
+	return gz.Close()
+}
+
+func handleBackup(w http.ResponseWriter, r *http.Request) {
+	secrets := r.URL.Query().Get("secrets") != "false"
+	host := latestSample().Hostname
+	if host == "" { host = "pulse" }
+	name := fmt.Sprintf("pulse-backup-%s-%s.tar.gz", host, time.Now().Format("20060102-150405"))
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+	auditLog("backup", map[string]interface{}{"user": actor(r), "secrets": secrets})
+	if err := writeBackup(w, secrets); err != nil { storageLog.Error("backup failed", "err", err) }
+}
+
+// replaceFile writes b to path via a temp file, keeping what was there as path.pre-restore.
+func replaceFile(path string, b []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil { return err }
+	if _, err := os.Stat(path); err == nil {
+		if err := copyFile(path, path+".pre-restore"); err != nil { return err }
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0600); err != nil { return err }
+	return os.Rename(tmp, path)
+}
+
+// runRestore is "pulse restore <file>"; Pulse must be stopped, or its next save overwrites the history.
+func runRestore(args []string) int {
+	fs := flag.NewFlagSet("pulse restore", flag.ContinueOnError)
+	dry := fs.Bool("list", false, "only show what the backup contains")
+	if err := fs.Parse(args); err != nil { if err == flag.ErrHelp { return 0 }; return 2 }
+	if fs.NArg() != 1 { fmt.Fprintln(os.Stderr, "usage: pulse [--data-dir DIR] restore [-list] <backup.tar.gz>"); return 2 }
+	contents, man, err := readBackup(fs.Arg(0))
+	if err != nil { fmt.Fprintln(os.Stderr, "Error:", err); return 1 }
+	fmt.Printf("backup of %s from %s: %d files\n", man.Host, man.Created, len(man.Files))
+	if man.Schema > historySchema { fmt.Fprintf(os.Stderr, "Error: the history is from a newer Pulse (schema %d); upgrade this one first\n", man.Schema); return 1 }
+	for _, f := range backupFiles {
+		b, ok := contents[f.name]
+		if !ok { continue }
+		if *dry { fmt.Printf("  %-20s %8d bytes\n", f.name, len(b)); continue }
+		// The restored config may set data_file, which decides where the history goes.
+		if f.name == "history.data.gz" { observeOnly = true; loadConfig(); useDataFile(config) }
+		if err := replaceFile(f.path(), b); err != nil { fmt.Fprintln(os.Stderr, "Error:", err); return 1 }
+		fmt.Println("  restored", f.path())
+	}
+	if !*dry {
+		// A write-ahead log from before would be replayed on top of the restored history.
+		if _, ok := contents["history.data.gz"]; !ok { observeOnly = true; loadConfig(); useDataFile(config) }
+		for _, p := range []string{walPath(), walPath() + ".old"} { if _, err := os.Stat(p); err == nil { os.Rename(p, p+".pre-restore") } }
+		fmt.Println("done; start Pulse to use the restored data")
+	}
+	return 0
+}
+
+func readBackup(path string) (map[string][]byte, backupManifest, error) {
+	var man backupManifest
+	f, err := os.Open(path)
+	if err != nil { return nil, man, err }
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil { return nil, man, fmt.Errorf("%s: not a Pulse backup: %w", path, err) }
+	known := map[string]bool{"manifest.json": true}
+	for _, bf := range backupFiles { known[bf.name] = true }
+	contents := map[string][]byte{}
+	tr := tar.NewReader(gz)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF { break }
+		if err != nil { return nil, man, fmt.Errorf("%s: %w", path, err) }
+		if !known[h.Name] || h.Typeflag != tar.TypeReg { continue }
+		b, err := io.ReadAll(tr)
+		if err != nil { return nil, man, fmt.Errorf("%s: %w", path, err) }
+		contents[h.Name] = b
+	}
+	if err := json.Unmarshal(contents["manifest.json"], &man); err != nil { return nil, man, fmt.Errorf("%s: not a Pulse backup (no manifest)", path) }
+	return contents, man, nil
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// --- BASELINE & DRIFT ---
+// For pet servers, "what changed?" matters as much as "how busy is it?". `pulse baseline save` (or
+// POST /api/v1/baseline) records the expected state in pulse.baseline.json: the ports listening
+// beyond loopback, the running services (systemd units on Linux, services on Windows), the mounted
+// filesystems and the local users. Every five minutes the running Pulse compares the host with it,
+// shows what was added or removed in the Baseline Drift panel and raises "Baseline Drift" while
+// anything differs. Saving the baseline again accepts the current state.
+
+type Baseline struct {
+	Time     int64    `json:"time"`
+	Host     string   `json:"host"`
+	Ports    []string `json:"ports"` // tcp/22, udp/53
+	Services []string `json:"services"`
+	Mounts   []string `json:"mounts"`
+	Users    []string `json:"users"`
+}
+
+type BaselineDrift struct {
+	What    string   `json:"what"` // ports, services, mounts or users
+	Added   []string `json:"added,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+}
+
+type driftReport struct {
+	Baseline *Baseline       `json:"baseline"`
+	Checked  int64           `json:"checked"`
+	Drift    []BaselineDrift `json:"drift"`
+}
+
+const baselineEvery = 5 * time.Minute
+
+var baselineFile = "pulse.baseline.json"
+
+var (
+	baselineMutex sync.Mutex
+	lastDrift     driftReport
+	hasBaseline   atomic.Bool
+	baselineKick  = make(chan struct{}, 1) // compare now, after a save
+)
+
+// currentState reads what a baseline records from the host as it is now.
+func currentState() Baseline {
+	b := Baseline{Time: time.Now().Unix()}
+	b.Host, _ = os.Hostname()
+	ports, _, err := listeningPorts()
+	if err != nil { collectorLog.Warn("baseline: cannot read the listening ports", "err", err) }
+	for _, p := range ports { if exposed(p.Addr) { b.Ports = append(b.Ports, portKey(p.Proto, p.Port)) } }
+	services, err := runningServices()
+	if err != nil { collectorLog.Warn("baseline: cannot list the services", "err", err) }
+	b.Services = services
+	for _, m := range collectMounts() { b.Mounts = append(b.Mounts, m.Path) }
+	users, err := localUsers()
+	if err != nil { collectorLog.Warn("baseline: cannot list the users", "err", err) }
+	b.Users = users
+	for _, l := range []*[]string{&b.Ports, &b.Services, &b.Mounts, &b.Users} { slices.Sort(*l); *l = slices.Compact(*l) }
+	return b
+}
+
+// passwdUsers lists the accounts in /etc/passwd.
+func passwdUsers() ([]string, error) {
+	data, err := os.ReadFile("/etc/passwd")
+	if err != nil { return nil, err }
+	var res []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if name, _, ok := strings.Cut(line, ":"); ok && name != "" && !strings.HasPrefix(name, "#") { res = append(res, name) }
+	}
+	return res, nil
+}
+
+func loadBaseline() (*Baseline, error) {
+	data, err := os.ReadFile(baselineFile)
+	if err != nil { return nil, err }
+	var b Baseline
+	if err := json.Unmarshal(data, &b); err != nil { return nil, fmt.Errorf("%s: %w", baselineFile, err) }
+	return &b, nil
+}
+
+func saveBaseline(b Baseline) error {
+	data, _ := json.MarshalIndent(b, "", "  ")
+	tmp := baselineFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil { return err }
+	return os.Rename(tmp, baselineFile)
+}
+
+// diffBaseline lists, per kind, what now is has that b doesn't and the other way round.
+func diffBaseline(b, now Baseline) []BaselineDrift {
+	res := []BaselineDrift{}
+	for _, c := range []struct{ what string; was, is []string }{{"ports", b.Ports, now.Ports}, {"services", b.Services, now.Services}, {"mounts", b.Mounts, now.Mounts}, {"users", b.Users, now.Users}} {
+		d := BaselineDrift{What: c.what}
+		for _, x := range c.is { if !slices.Contains(c.was, x) { d.Added = append(d.Added, x) } }
+		for _, x := range c.was { if !slices.Contains(c.is, x) { d.Removed = append(d.Removed, x) } }
+		if len(d.Added)+len(d.Removed) > 0 { res = append(res, d) }
+	}
+	return res
+}
+
+func (d BaselineDrift) String() string {
+	var parts []string
+	if len(d.Added) > 0 { parts = append(parts, "+"+strings.Join(d.Added, " +")) }
+	if len(d.Removed) > 0 { parts = append(parts, "-"+strings.Join(d.Removed, " -")) }
+	return d.What + ": " + strings.Join(parts, " ")
+}
+
+// compareBaseline checks the host against the saved baseline and keeps the result for the API and checkBaseline.
+func compareBaseline() {
+	b, err := loadBaseline()
+	hasBaseline.Store(b != nil)
+	if err != nil && !errors.Is(err, os.ErrNotExist) { collectorLog.Error("cannot read the baseline", "err", err) }
+	r := driftReport{Baseline: b, Checked: time.Now().Unix(), Drift: []BaselineDrift{}}
+	if b != nil { r.Drift = diffBaseline(*b, currentState()) }
+	baselineMutex.Lock(); lastDrift = r; baselineMutex.Unlock()
+}
+
+func runBaseline() {
+	t := time.NewTicker(baselineEvery); defer t.Stop()
+	for {
+		compareBaseline()
+		select { case <-stopCtx.Done(): return; case <-t.C: case <-baselineKick: }
+	}
+}
+
+// checkBaseline raises "Baseline Drift" while the last comparison found differences.
+func checkBaseline(alert func(n, lvl string, v float64, msg string)) {
+	baselineMutex.Lock(); r := lastDrift; baselineMutex.Unlock()
+	if len(r.Drift) == 0 { return }
+	n, parts := 0, make([]string, len(r.Drift))
+	for i, d := range r.Drift { n += len(d.Added) + len(d.Removed); parts[i] = d.String() }
+	alert("Baseline Drift", "WARNING", float64(n), strings.Join(parts, "; "))
+}
+
+func registerBaselineAPI(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/v1/baseline", func(w http.ResponseWriter, r *http.Request) {
+		baselineMutex.Lock(); d := lastDrift; baselineMutex.Unlock()
+		if d.Baseline == nil { apiFail(w, http.StatusNotFound, apiError{"not_found", "no baseline saved; run pulse baseline save or POST /api/v1/baseline", nil}); return }
+		apiOK(w, 200, d, nil)
+	})
+	// Saving records the host as it is now, which also accepts any drift.
+	mux.HandleFunc("POST /api/v1/baseline", apiRole("admin", func(w http.ResponseWriter, r *http.Request) {
+		b := currentState()
+		if err := saveBaseline(b); err != nil { apiFail(w, http.StatusInternalServerError, apiError{"internal", err.Error(), nil}); return }
+		auditLog("baseline_saved", map[string]interface{}{"user": actor(r)})
+		compareBaseline()
+		apiOK(w, 200, b, nil)
+	}))
+}
+
+// runBaselineCommand is `pulse baseline save|diff`; diff exits 1 when the host has drifted.
+func runBaselineCommand(args []string) int {
+	usage := "usage: pulse [--data-dir DIR] baseline save|diff"
+	if len(args) != 1 { fmt.Fprintln(os.Stderr, usage); return 2 }
+	switch args[0] {
+	case "save":
+		b := currentState()
+		if err := saveBaseline(b); err != nil { fmt.Fprintln(os.Stderr, "Error:", err); return 1 }
+		fmt.Printf("saved %s: %d ports, %d services, %d mounts, %d users\n", baselineFile, len(b.Ports), len(b.Services), len(b.Mounts), len(b.Users))
+		fmt.Println("a running Pulse compares against it within five minutes")
+		return 0
+	case "diff":
+		b, err := loadBaseline()
+		if err != nil { fmt.Fprintln(os.Stderr, "Error:", err); return 2 }
+		drift := diffBaseline(*b, currentState())
+		if len(drift) == 0 { fmt.Println("no drift from the baseline of", time.Unix(b.Time, 0).Format(time.RFC3339)); return 0 }
+		for _, d := range drift { fmt.Println(d) }
+		return 1
+	}
+	fmt.Fprintln(os.Stderr, usage)
+	return 2
+}
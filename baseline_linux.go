@@ -0,0 +1,21 @@
+//go:build linux
+
+package main
+
+import (
+	"os/exec"
+	"strings"
+)
+
+// runningServices lists the systemd service units that are running.
+func runningServices() ([]string, error) {
+	out, err := exec.Command("systemctl", "list-units", "--type=service", "--state=running", "--no-legend", "--plain").Output()
+	if err != nil { return nil, err }
+	var res []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if f := strings.Fields(line); len(f) > 0 { res = append(res, f[0]) }
+	}
+	return res, nil
+}
+
+func localUsers() ([]string, error) { return passwdUsers() }
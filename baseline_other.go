@@ -0,0 +1,9 @@
+//go:build !linux && !windows
+
+package main
+
+import "errors"
+
+func runningServices() ([]string, error) { return nil, errors.New("services are only listed on Linux and Windows") }
+
+func localUsers() ([]string, error) { return passwdUsers() }
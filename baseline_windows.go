@@ -0,0 +1,30 @@
+//go:build windows
+
+package main
+
+import (
+	"errors"
+
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// runningServices lists the services that are running, by their service name.
+func runningServices() ([]string, error) {
+	m, err := mgr.Connect()
+	if err != nil { return nil, err }
+	defer m.Disconnect()
+	names, err := m.ListServices()
+	if err != nil { return nil, err }
+	var res []string
+	for _, name := range names {
+		s, err := m.OpenService(name)
+		if err != nil { continue }
+		st, err := s.Query()
+		s.Close()
+		if err == nil && st.State == svc.Running { res = append(res, name) }
+	}
+	return res, nil
+}
+
+func localUsers() ([]string, error) { return nil, errors.New("local users are only listed on Linux and Unix") }
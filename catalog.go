@@ -0,0 +1,149 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// --- METRIC CATALOG ---
+// The catalog says how to show each series: a display name, its unit, how to scale it (bytes:
+// 1024-based K/M/G, si: 1000-based k/M/G, or none) and a fixed chart ceiling. Built-in fields are
+// described here, mount:, disk: and group: columns by what they are, and plugin: and metric: series
+// by the unit they were reported with. metric_catalog in pulse.conf overrides any of it per field.
+// The dashboard labels and formats custom panels with it, XLSX exports head their columns with it,
+// and GET /api/v1/catalog returns it for every field there is data for.
+
+type MetricInfo struct {
+	Label string  `json:"label,omitempty"`
+	Unit  string  `json:"unit,omitempty"`  // %, B, B/s, ms, s, MHz, ...
+	Scale string  `json:"scale,omitempty"` // bytes, si or empty
+	Max   float64 `json:"max,omitempty"`   // chart ceiling, e.g. 100 for percentages
+}
+
+// MetricCatalog is metric_catalog: overrides by field name.
+type MetricCatalog map[string]MetricInfo
+
+var metricCatalog = MetricCatalog{
+	"cpu_tot":      {"CPU", "%", "", 100},
+	"mem_used":     {"Memory", "%", "", 100},
+	"swp_used":     {"Swap", "%", "", 100},
+	"dsk_used":     {"Disk (/)", "%", "", 100},
+	"load1":        {"Load 1m", "", "", 0},
+	"load5":        {"Load 5m", "", "", 0},
+	"load15":       {"Load 15m", "", "", 0},
+	"load_core":    {"Load per Core", "", "", 0},
+	"cores":        {"Cores", "", "", 0},
+	"procs":        {"Processes", "", "", 0},
+	"net_down":     {"Network In", "B/s", "bytes", 0},
+	"net_up":       {"Network Out", "B/s", "bytes", 0},
+	"dsk_read":     {"Disk Read", "B/s", "bytes", 0},
+	"dsk_writ":     {"Disk Write", "B/s", "bytes", 0},
+	"uptime":       {"Uptime", "s", "", 0},
+	"psi_cpu":      {"CPU Pressure", "%", "", 100},
+	"psi_io":       {"IO Pressure", "%", "", 100},
+	"psi_io_full":  {"IO Pressure (full)", "%", "", 100},
+	"psi_mem":      {"Memory Pressure", "%", "", 100},
+	"psi_mem_full": {"Memory Pressure (full)", "%", "", 100},
+	"cpu_mhz":      {"CPU Clock", "MHz", "", 0},
+	"throttles":    {"Throttling Events", "", "", 0},
+}
+
+// unitInfo fills in the scale and ceiling a unit implies.
+func unitInfo(label, unit string) MetricInfo {
+	i := MetricInfo{Label: label, Unit: unit}
+	switch {
+	case unit == "%": i.Max = 100
+	case unit == "B" || strings.HasPrefix(unit, "B/"): i.Scale = "bytes"
+	}
+	return i
+}
+
+// describeMetric looks a field up in the built-in catalog, then by prefix, with plugin and collector
+// units taken from m, and applies what pulse.conf's metric_catalog sets for it.
+func describeMetric(cfg AppConfig, field string, m RichMetrics) MetricInfo {
+	var info MetricInfo
+	if b, ok := metricCatalog[field]; ok {
+		info = b
+	} else if rest, ok := strings.CutPrefix(field, "mount:"); ok {
+		info = MetricInfo{rest + " used", "%", "", 100}
+	} else if rest, ok := strings.CutPrefix(field, "disk:"); ok {
+		dev, what, _ := strings.Cut(rest, "/")
+		info = map[string]MetricInfo{"read": {dev + " read", "B/s", "bytes", 0}, "write": {dev + " write", "B/s", "bytes", 0}, "busy": {dev + " busy", "%", "", 100}}[what]
+	} else if rest, ok := strings.CutPrefix(field, "group:"); ok {
+		name, what, _ := splitGroupField(rest)
+		info = map[string]MetricInfo{"cpu": {name + " CPU", "%", "", 0}, "mem": {name + " memory", "B", "bytes", 0}, "read": {name + " read", "B/s", "bytes", 0},
+			"write": {name + " write", "B/s", "bytes", 0}, "procs": {name + " processes", "", "", 0}}[what]
+	} else if key, ok := strings.CutPrefix(field, "metric:"); ok {
+		info = unitInfo(key, "")
+		for _, mt := range m.Metrics { if mt.key() == key { info = unitInfo(key, mt.Unit) } }
+	} else if id, ok := strings.CutPrefix(field, "plugin:"); ok {
+		info = unitInfo(id, "")
+		for _, p := range m.Plugins {
+			pid := pluginID(p)
+			if pid == id { info = unitInfo(id, p.PerfUnit) }
+			for _, pm := range p.Perf { if pid+"/"+pm.Label == id { info = unitInfo(pid+" ["+pm.Label+"]", pm.Unit) } }
+		}
+	}
+	if o, ok := cfg.MetricCatalog[field]; ok {
+		if o.Label != "" { info.Label = o.Label }
+		if o.Unit != "" { s := unitInfo("", o.Unit); info.Unit, info.Scale, info.Max = o.Unit, s.Scale, s.Max }
+		if o.Scale != "" { info.Scale = o.Scale }
+		if o.Max != 0 { info.Max = o.Max }
+	}
+	if info.Scale == "none" { info.Scale = "" }
+	if info.Label == "" { info.Label = field }
+	return info
+}
+
+// header is a column title for people: "Network In (B/s)".
+func (i MetricInfo) header() string {
+	if i.Unit == "" { return i.Label }
+	return i.Label + " (" + i.Unit + ")"
+}
+
+// format writes a value the way the dashboard shows it: "1.2M/s", "3.4k req/s", "87.5%".
+func (i MetricInfo) format(v float64) string {
+	var t string
+	switch i.Scale {
+	case "bytes":
+		t = humanBytes(math.Abs(v))
+		if v < 0 { t = "-" + t }
+		if strings.HasPrefix(i.Unit, "B/") { return t + i.Unit[1:] }
+		if i.Unit == "B" || i.Unit == "" { return t }
+	case "si":
+		u, n := []string{"", "k", "M", "G", "T"}, 0
+		for ; math.Abs(v) >= 1000 && n < len(u)-1; n++ { v /= 1000 }
+		t = strconv.FormatFloat(v, 'f', 1, 64) + u[n]
+	default:
+		t = strconv.FormatFloat(v, 'f', 2, 64)
+		if math.Abs(v) >= 100 { t = strconv.FormatFloat(v, 'f', 1, 64) }
+	}
+	if i.Unit == "" { return t }
+	if i.Unit == "%" { return t + "%" }
+	return t + " " + i.Unit
+}
+
+func validateMetricCatalog(c AppConfig, bad func(field, format string, a ...interface{})) {
+	for f, i := range c.MetricCatalog {
+		if f == "" { bad("metric_catalog", "an entry has no field") }
+		if i.Scale != "" && i.Scale != "bytes" && i.Scale != "si" && i.Scale != "none" { bad("metric_catalog", "%s: scale must be bytes, si or none", f) }
+		if i.Max < 0 { bad("metric_catalog", "%s: max must not be negative", f) }
+	}
+}
+
+func registerCatalogAPI(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/v1/catalog", func(w http.ResponseWriter, r *http.Request) {
+		cfgMutex.RLock(); cfg := config; cfgMutex.RUnlock()
+		m := latestSample()
+		res := map[string]MetricInfo{}
+		if f := r.URL.Query().Get("field"); f != "" {
+			res[f] = describeMetric(cfg, f, m)
+		} else {
+			for _, f := range grafanaMetrics() { if f != "plugins" && f != "metrics" { res[f] = describeMetric(cfg, f, m) } }
+			for f := range cfg.MetricCatalog { res[f] = describeMetric(cfg, f, m) }
+		}
+		apiOK(w, 200, res, &apiMeta{len(res), len(res), 0})
+	})
+}
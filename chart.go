@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// --- CHART RENDERING ---
+// Line charts of history drawn on the server as PNG, for places the dashboard can't go: alert
+// emails, digest emails, SLA reports (HTML and PDF) and /chart.png?metric=cpu&range=24h, which any
+// wiki, chat bot or status page can embed. Only the standard library is used; labels are a built-in
+// 5x7 pixel font (upper case, digits and a few signs). Each pixel column shows the average of the
+// samples that fall in it, and gaps in the data are left as gaps.
+
+const (
+	chartPadL, chartPadB, chartPadT = 52, 18, 16
+	maxChartSize                    = 2000
+)
+
+// chartAliases are the short names rate rules use, charted as the export field they stand for.
+var chartAliases = map[string]string{"cpu": "cpu_tot", "mem": "mem_used", "memory": "mem_used", "swap": "swp_used", "disk": "dsk_used", "load": "load1"}
+
+var chartColors = []color.RGBA{{0x21, 0x96, 0xf3, 0xff}, {0xff, 0x98, 0x00, 0xff}, {0x4c, 0xaf, 0x50, 0xff}, {0xe9, 0x1e, 0x63, 0xff}}
+
+// chartFont is 5x7: seven rows per glyph, bit 4 the leftmost pixel.
+var chartFont = map[rune][7]uint8{
+	'0': {0x0E, 0x11, 0x13, 0x15, 0x19, 0x11, 0x0E}, '1': {0x04, 0x0C, 0x04, 0x04, 0x04, 0x04, 0x0E},
+	'2': {0x0E, 0x11, 0x01, 0x02, 0x04, 0x08, 0x1F}, '3': {0x1F, 0x02, 0x04, 0x02, 0x01, 0x11, 0x0E},
+	'4': {0x02, 0x06, 0x0A, 0x12, 0x1F, 0x02, 0x02}, '5': {0x1F, 0x10, 0x1E, 0x01, 0x01, 0x11, 0x0E},
+	'6': {0x06, 0x08, 0x10, 0x1E, 0x11, 0x11, 0x0E}, '7': {0x1F, 0x01, 0x02, 0x04, 0x08, 0x08, 0x08},
+	'8': {0x0E, 0x11, 0x11, 0x0E, 0x11, 0x11, 0x0E}, '9': {0x0E, 0x11, 0x11, 0x0F, 0x01, 0x02, 0x0C},
+	'.': {0, 0, 0, 0, 0, 0x0C, 0x0C}, ',': {0, 0, 0, 0, 0x0C, 0x04, 0x08}, ':': {0, 0x0C, 0x0C, 0, 0x0C, 0x0C, 0},
+	'-': {0, 0, 0, 0x1F, 0, 0, 0}, '+': {0, 0x04, 0x04, 0x1F, 0x04, 0x04, 0}, '=': {0, 0, 0x1F, 0, 0x1F, 0, 0},
+	'_': {0, 0, 0, 0, 0, 0, 0x1F}, '/': {0x01, 0x02, 0x02, 0x04, 0x08, 0x08, 0x10}, '%': {0x18, 0x19, 0x02, 0x04, 0x08, 0x13, 0x03},
+	'(': {0x02, 0x04, 0x08, 0x08, 0x08, 0x04, 0x02}, ')': {0x08, 0x04, 0x02, 0x02, 0x02, 0x04, 0x08},
+	'[': {0x0E, 0x08, 0x08, 0x08, 0x08, 0x08, 0x0E}, ']': {0x0E, 0x02, 0x02, 0x02, 0x02, 0x02, 0x0E},
+	'A': {0x0E, 0x11, 0x11, 0x1F, 0x11, 0x11, 0x11}, 'B': {0x1E, 0x11, 0x11, 0x1E, 0x11, 0x11, 0x1E},
+	'C': {0x0E, 0x11, 0x10, 0x10, 0x10, 0x11, 0x0E}, 'D': {0x1C, 0x12, 0x11, 0x11, 0x11, 0x12, 0x1C},
+	'E': {0x1F, 0x10, 0x10, 0x1E, 0x10, 0x10, 0x1F}, 'F': {0x1F, 0x10, 0x10, 0x1E, 0x10, 0x10, 0x10},
+	'G': {0x0E, 0x11, 0x10, 0x17, 0x11, 0x11, 0x0F}, 'H': {0x11, 0x11, 0x11, 0x1F, 0x11, 0x11, 0x11},
+	'I': {0x0E, 0x04, 0x04, 0x04, 0x04, 0x04, 0x0E}, 'J': {0x07, 0x02, 0x02, 0x02, 0x02, 0x12, 0x0C},
+	'K': {0x11, 0x12, 0x14, 0x18, 0x14, 0x12, 0x11}, 'L': {0x10, 0x10, 0x10, 0x10, 0x10, 0x10, 0x1F},
+	'M': {0x11, 0x1B, 0x15, 0x15, 0x11, 0x11, 0x11}, 'N': {0x11, 0x11, 0x19, 0x15, 0x13, 0x11, 0x11},
+	'O': {0x0E, 0x11, 0x11, 0x11, 0x11, 0x11, 0x0E}, 'P': {0x1E, 0x11, 0x11, 0x1E, 0x10, 0x10, 0x10},
+	'Q': {0x0E, 0x11, 0x11, 0x11, 0x15, 0x12, 0x0D}, 'R': {0x1E, 0x11, 0x11, 0x1E, 0x14, 0x12, 0x11},
+	'S': {0x0F, 0x10, 0x10, 0x0E, 0x01, 0x01, 0x1E}, 'T': {0x1F, 0x04, 0x04, 0x04, 0x04, 0x04, 0x04},
+	'U': {0x11, 0x11, 0x11, 0x11, 0x11, 0x11, 0x0E}, 'V': {0x11, 0x11, 0x11, 0x11, 0x11, 0x0A, 0x04},
+	'W': {0x11, 0x11, 0x11, 0x15, 0x15, 0x15, 0x0A}, 'X': {0x11, 0x11, 0x0A, 0x04, 0x0A, 0x11, 0x11},
+	'Y': {0x11, 0x11, 0x0A, 0x04, 0x04, 0x04, 0x04}, 'Z': {0x1F, 0x01, 0x02, 0x04, 0x08, 0x10, 0x1F},
+}
+
+type chartSeries struct {
+	field string
+	info  MetricInfo
+	get   func(m RichMetrics) (float64, bool)
+}
+
+// chartField resolves a field or rate-rule name (cpu, "backup [age]") to something to draw.
+func chartField(cfg AppConfig, name string) (chartSeries, error) {
+	if f, ok := chartAliases[strings.ToLower(name)]; ok { name = f }
+	s := chartSeries{field: name, info: describeMetric(cfg, name, latestSample())}
+	if name == "plugins" || name == "metrics" { return s, fmt.Errorf("%s is every series; name one", name) }
+	if cols, err := exportColumns([]string{name}); err == nil && len(cols) == 1 { s.get = cols[0].get; return s, nil }
+	s.get = func(m RichMetrics) (float64, bool) { return namedMetric(m, name) }
+	return s, nil
+}
+
+func chartText(img *image.RGBA, x, y int, c color.RGBA, s string) {
+	for _, r := range strings.ToUpper(s) {
+		g := chartFont[r]
+		for row := 0; row < 7; row++ {
+			for col := 0; col < 5; col++ { if g[row]&(0x10>>col) != 0 { img.SetRGBA(x+col, y+row, c) } }
+		}
+		x += 6
+	}
+}
+
+// chartLine draws a 2 pixel wide line.
+func chartLine(img *image.RGBA, x0, y0, x1, y1 int, c color.RGBA) {
+	dx, dy := abs(x1-x0), -abs(y1-y0)
+	sx, sy := 1, 1
+	if x0 > x1 { sx = -1 }
+	if y0 > y1 { sy = -1 }
+	for e := dx + dy; ; {
+		img.SetRGBA(x0, y0, c); img.SetRGBA(x0, y0+1, c)
+		if x0 == x1 && y0 == y1 { return }
+		if e2 := 2 * e; e2 >= dy { e += dy; x0 += sx } else if e2 <= dx { e += dx; y0 += sy } else { e += dy + dx; x0 += sx; y0 += sy }
+	}
+}
+
+func abs(v int) int { if v < 0 { return -v }; return v }
+
+// renderChart draws the series from history between from and to; series share the first one's unit.
+func renderChart(series []chartSeries, title string, from, to int64, w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	grid, axis := color.RGBA{0xe4, 0xe4, 0xe4, 0xff}, color.RGBA{0x66, 0x66, 0x66, 0xff}
+	for i := range img.Pix { img.Pix[i] = 0xff } // white
+	pw, ph := w-chartPadL-8, h-chartPadT-chartPadB
+	if pw < 10 || ph < 10 || to <= from { return img }
+
+	// Average each series per pixel column.
+	cols := make([][]float64, len(series))
+	counts := make([][]int, len(series))
+	for i := range series { cols[i], counts[i] = make([]float64, pw), make([]int, pw) }
+	historyMutex.RLock()
+	for i := history.Search(from); i < history.Len(); i++ {
+		m := history.At(i)
+		if m.Timestamp > to { break }
+		x := int(float64(m.Timestamp-from) / float64(to-from) * float64(pw-1))
+		for s := range series {
+			if v, ok := series[s].get(*m); ok && !math.IsNaN(v) && !math.IsInf(v, 0) { cols[s][x] += v; counts[s][x]++ }
+		}
+	}
+	historyMutex.RUnlock()
+	top := 0.0
+	for s := range series {
+		for x := range cols[s] { if counts[s][x] > 0 { cols[s][x] /= float64(counts[s][x]); top = max(top, cols[s][x]) } }
+	}
+	info := MetricInfo{}
+	if len(series) > 0 { info = series[0].info }
+	if info.Max > 0 { top = info.Max } else if top <= 0 { top = 1 } else { top *= 1.1 }
+
+	// Grid, labels and title.
+	digits := 2
+	if top >= 10 { digits = 0 } else if top >= 1 { digits = 1 }
+	for i := 0; i <= 4; i++ {
+		y := chartPadT + ph - i*ph/4
+		for x := chartPadL; x < chartPadL+pw; x++ { img.SetRGBA(x, y, grid) }
+		v := top * float64(i) / 4
+		label := MetricInfo{Scale: info.Scale}.format(v)
+		if info.Scale == "" { label = strconv.FormatFloat(v, 'f', digits, 64) }
+		if info.Unit == "%" { label += "%" }
+		chartText(img, chartPadL-6-6*len(label)+1, y-3, axis, label)
+	}
+	layout := "15:04"
+	if to-from > 2*86400 { layout = "01-02" } else if to-from > 86400 { layout = "01-02 15:04" }
+	for i := 0; i <= 4; i++ {
+		x := chartPadL + i*(pw-1)/4
+		for y := chartPadT; y < chartPadT+ph; y++ { img.SetRGBA(x, y, grid) }
+		label := time.Unix(from+int64(i)*(to-from)/4, 0).Format(layout)
+		chartText(img, min(max(x-3*len(label), 0), w-6*len(label)), h-chartPadB+6, axis, label)
+	}
+	chartText(img, chartPadL, 4, axis, title)
+
+	gap := max(int(reportGap*float64(pw)/float64(to-from)), 2) // pixels; wider is a gap in the data
+	for s := range series {
+		c := chartColors[s%len(chartColors)]
+		px, py := -1, 0
+		for x := range cols[s] {
+			if counts[s][x] == 0 { continue }
+			y := chartPadT + ph - 1 - int(min(cols[s][x]/top, 1)*float64(ph-2))
+			if px >= 0 && x-px <= gap { chartLine(img, chartPadL+px, py, chartPadL+x, y, c) } else { img.SetRGBA(chartPadL+x, y, c); img.SetRGBA(chartPadL+x, y+1, c) }
+			px, py = x, y
+		}
+	}
+	return img
+}
+
+// chartPNG renders and encodes a chart.
+func chartPNG(series []chartSeries, title string, from, to int64, w, h int) []byte {
+	var b bytes.Buffer
+	png.Encode(&b, renderChart(series, title, from, to, w, h))
+	return b.Bytes()
+}
+
+// chartTitle joins the series' labels, with the unit: "CPU / Memory (%)".
+func chartTitle(series []chartSeries) string {
+	var names []string
+	for _, s := range series { names = append(names, s.info.Label) }
+	t := strings.Join(names, " / ")
+	if len(series) > 0 && series[0].info.Unit != "" { t += " (" + series[0].info.Unit + ")" }
+	return t
+}
+
+// parseRange reads "30m", "24h" or "7d".
+func parseRange(s string) (time.Duration, error) {
+	if d, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(d)
+		if err != nil || n <= 0 { return 0, fmt.Errorf("bad range %q", s) }
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 { return 0, fmt.Errorf("bad range %q (e.g. 30m, 24h, 7d)", s) }
+	return d, nil
+}
+
+// handleChartPNG serves /chart.png?metric=cpu[,mem]&range=24h (or start and end)&width=&height=.
+func handleChartPNG(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	cfgMutex.RLock(); cfg := config; cfgMutex.RUnlock()
+	var series []chartSeries
+	for _, f := range strings.Split(q.Get("metric"), ",") {
+		if f = strings.TrimSpace(f); f == "" { continue }
+		s, err := chartField(cfg, f)
+		if err != nil { http.Error(w, err.Error(), http.StatusBadRequest); return }
+		series = append(series, s)
+	}
+	if len(series) == 0 || len(series) > len(chartColors) { http.Error(w, fmt.Sprintf("metric must name 1 to %d fields", len(chartColors)), http.StatusBadRequest); return }
+	span := 24 * time.Hour
+	if v := q.Get("range"); v != "" {
+		d, err := parseRange(v)
+		if err != nil { http.Error(w, err.Error(), http.StatusBadRequest); return }
+		span = d
+	}
+	now := time.Now().Unix()
+	end, ok2 := parseTimeParam(q.Get("end"), now)
+	start, ok1 := parseTimeParam(q.Get("start"), end-int64(span.Seconds()))
+	if !ok1 || !ok2 || start >= end { http.Error(w, "start and end must be unix seconds or RFC 3339, start before end", http.StatusBadRequest); return }
+	size := func(k string, def int) int {
+		n, err := strconv.Atoi(q.Get(k))
+		if err != nil { return def }
+		return min(max(n, 100), maxChartSize)
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write(chartPNG(series, cmp.Or(q.Get("title"), chartTitle(series)), start, end, size("width", 600), size("height", 200)))
+}
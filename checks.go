@@ -0,0 +1,216 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/disk"
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+// --- BUILT-IN CHECKS ---
+// Built-in checks return the same PluginData as scripts, so they share scheduling, graphs and alerting.
+// A check returns code -1 to have its status decided by the Warn/Crit ranges of its config, which
+// for the file checks may be written in their unit ("26h", "2d", "10G"). "scrape" (scrape.go) returns
+// many series, so it builds its PluginData itself.
+
+type builtinCheck func(sc ScriptConfig, timeout time.Duration) (val float64, unit, msg string, code int)
+
+var builtinChecks = map[string]builtinCheck{
+	"disk":      checkDisk,
+	"http":      checkHTTP,
+	"tcp":       checkTCP,
+	"file_age":  checkFileAge,
+	"file_size": checkFileSize,
+	"dir_size":  checkDirSize,
+	"dir_count": checkDirCount,
+	"process":   checkProcess,
+	"regex":     checkRegex,
+}
+
+// checkUnits are the units whose suffixes warn and crit may use, per check type.
+var checkUnits = map[string]string{"file_age": "s", "file_size": "B", "dir_size": "B"}
+
+var statusNames = []string{"OK", "WARNING", "CRITICAL", "UNKNOWN"}
+
+func runBuiltinCheck(sc ScriptConfig, timeout time.Duration) PluginData {
+	if sc.Type == "scrape" { return runScrapeCheck(sc, timeout) }
+	p := PluginData{Path: sc.label(), Name: sc.Name}
+	chk, ok := builtinChecks[sc.Type]
+	if !ok { p.ExitCode = 3; p.Output = "UNKNOWN: unknown check type " + sc.Type; return p }
+	start := time.Now()
+	val, unit, msg, code := chk(sc, timeout)
+	p.Duration = time.Since(start).Seconds()
+	sc.Warn, _ = rangeInUnit(sc.Warn, checkUnits[sc.Type])
+	sc.Crit, _ = rangeInUnit(sc.Crit, checkUnits[sc.Type])
+	if code < 0 {
+		code = 0
+		if perfRangeAlert(sc.Crit, val) { code = 2 } else if perfRangeAlert(sc.Warn, val) { code = 1 }
+	}
+	p.ExitCode = code
+	p.Output = statusNames[code] + ": " + msg
+	p.PerfVal, p.PerfUnit = val, unit
+	p.Perf = []PerfMetric{{Label: sc.Type, Value: val, Unit: unit, Warn: sc.Warn, Crit: sc.Crit}}
+	return p
+}
+
+func checkDisk(sc ScriptConfig, timeout time.Duration) (float64, string, string, int) {
+	path := sc.Target
+	if path == "" { path = "/" }
+	u, err := disk.Usage(path)
+	if err != nil { return 0, "%", err.Error(), 3 }
+	return u.UsedPercent, "%", fmt.Sprintf("%s %.1f%% used (%s free)", path, u.UsedPercent, fmtBytes(u.Free)), -1
+}
+
+func checkHTTP(sc ScriptConfig, timeout time.Duration) (float64, string, string, int) {
+	client := &http.Client{Timeout: timeout}
+	start := time.Now()
+	resp, err := client.Get(sc.Target)
+	if err != nil { return 0, "ms", err.Error(), 2 }
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	ms := float64(time.Since(start).Milliseconds())
+	if resp.StatusCode >= 400 { return ms, "ms", fmt.Sprintf("%s returned %s", sc.Target, resp.Status), 2 }
+	if sc.Pattern != "" {
+		re, err := regexp.Compile(sc.Pattern)
+		if err != nil { return ms, "ms", "bad pattern: " + err.Error(), 3 }
+		if !re.Match(body) { return ms, "ms", fmt.Sprintf("%s body does not match %q", sc.Target, sc.Pattern), 2 }
+	}
+	return ms, "ms", fmt.Sprintf("%s %s in %.0fms", sc.Target, resp.Status, ms), -1
+}
+
+func checkTCP(sc ScriptConfig, timeout time.Duration) (float64, string, string, int) {
+	start := time.Now()
+	c, err := net.DialTimeout("tcp", sc.Target, timeout)
+	if err != nil { return 0, "ms", err.Error(), 2 }
+	c.Close()
+	ms := float64(time.Since(start).Milliseconds())
+	return ms, "ms", fmt.Sprintf("%s connected in %.0fms", sc.Target, ms), -1
+}
+
+// rangeInUnit rewrites a Nagios range whose bounds carry a unit suffix ("1d:", "@10G:20G") in plain
+// numbers of that unit; bounds without a suffix are taken as they are.
+func rangeInUnit(spec, unit string) (string, error) {
+	mult := map[string]map[string]float64{
+		"s": {"s": 1, "m": 60, "h": 3600, "d": 86400, "w": 604800},
+		"B": {"k": 1 << 10, "m": 1 << 20, "g": 1 << 30, "t": 1 << 40},
+	}[unit]
+	if mult == nil || spec == "" { return spec, nil }
+	body, inside := strings.CutPrefix(strings.TrimSpace(spec), "@")
+	parts := strings.Split(body, ":")
+	for i, b := range parts {
+		if b == "" || b == "~" { continue }
+		num, m := strings.ToLower(b), 1.0
+		if unit == "B" { num = strings.TrimSuffix(strings.TrimSuffix(num, "ib"), "b") } // 10G, 10GB and 10GiB alike
+		if f, ok := mult[num[max(len(num)-1, 0):]]; ok { num, m = num[:len(num)-1], f }
+		v, err := strconv.ParseFloat(num, 64)
+		if err != nil { return spec, fmt.Errorf("%q is not a number of %s", b, map[string]string{"s": "seconds (or 90m, 26h, 2d)", "B": "bytes (or 512M, 10G)"}[unit]) }
+		parts[i] = strconv.FormatFloat(v*m, 'f', -1, 64)
+	}
+	if inside { return "@" + strings.Join(parts, ":"), nil }
+	return strings.Join(parts, ":"), nil
+}
+
+// checkFileAge reports the age of the newest file matching target, which may be a glob such as
+// /backups/db-*.sql.gz for backups named by date.
+func checkFileAge(sc ScriptConfig, timeout time.Duration) (float64, string, string, int) {
+	matches, err := filepath.Glob(sc.Target)
+	if err != nil { return 0, "s", err.Error(), 3 }
+	if len(matches) == 0 {
+		if _, err := os.Stat(sc.Target); err != nil { return 0, "s", "no file matches " + sc.Target, 2 }
+		matches = []string{sc.Target} // a literal name with glob characters in it
+	}
+	var newest string
+	var mod time.Time
+	for _, m := range matches {
+		if fi, err := os.Stat(m); err == nil && fi.ModTime().After(mod) { newest, mod = m, fi.ModTime() }
+	}
+	if newest == "" { return 0, "s", "cannot read " + sc.Target, 2 }
+	age := time.Since(mod).Seconds()
+	return age, "s", fmt.Sprintf("%s modified %s ago", newest, time.Duration(age)*time.Second), -1
+}
+
+func checkFileSize(sc ScriptConfig, timeout time.Duration) (float64, string, string, int) {
+	fi, err := os.Stat(sc.Target)
+	if err != nil { return 0, "B", err.Error(), 2 }
+	return float64(fi.Size()), "B", fmt.Sprintf("%s is %s", sc.Target, fmtBytes(uint64(fi.Size()))), -1
+}
+
+// walkFiles calls fn for every regular file under dir whose name matches pattern (if set), and
+// gives up once the check's timeout has passed.
+func walkFiles(dir, pattern string, timeout time.Duration, fn func(fs.FileInfo)) error {
+	var re *regexp.Regexp
+	if pattern != "" {
+		var err error
+		if re, err = regexp.Compile(pattern); err != nil { return fmt.Errorf("bad pattern: %w", err) }
+	}
+	deadline := time.Now().Add(timeout)
+	return filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == dir { return err }
+			return nil // unreadable subdirectories are left out
+		}
+		if time.Now().After(deadline) { return fmt.Errorf("%s: not done after %s", dir, timeout) }
+		if !d.Type().IsRegular() || (re != nil && !re.MatchString(d.Name())) { return nil }
+		if fi, err := d.Info(); err == nil { fn(fi) }
+		return nil
+	})
+}
+
+func checkDirSize(sc ScriptConfig, timeout time.Duration) (float64, string, string, int) {
+	var total, files uint64
+	if err := walkFiles(sc.Target, sc.Pattern, timeout, func(fi fs.FileInfo) { total += uint64(fi.Size()); files++ }); err != nil { return 0, "B", err.Error(), 3 }
+	return float64(total), "B", fmt.Sprintf("%s holds %s in %d files", sc.Target, fmtBytes(total), files), -1
+}
+
+// checkDirCount counts the entries of a directory, or with "recursive" the files in it and below
+// (a mail queue spread over hashed subdirectories); pattern keeps only names it matches.
+func checkDirCount(sc ScriptConfig, timeout time.Duration) (float64, string, string, int) {
+	n := 0
+	if sc.Recursive {
+		if err := walkFiles(sc.Target, sc.Pattern, timeout, func(fs.FileInfo) { n++ }); err != nil { return 0, "", err.Error(), 3 }
+		return float64(n), "", fmt.Sprintf("%s and below contain %d files", sc.Target, n), -1
+	}
+	entries, err := os.ReadDir(sc.Target)
+	if err != nil { return 0, "", err.Error(), 2 }
+	re, err := regexp.Compile(sc.Pattern)
+	if err != nil { return 0, "", "bad pattern: " + err.Error(), 3 }
+	for _, e := range entries { if re.MatchString(e.Name()) { n++ } }
+	return float64(n), "", fmt.Sprintf("%s contains %d entries", sc.Target, n), -1
+}
+
+func checkProcess(sc ScriptConfig, timeout time.Duration) (float64, string, string, int) {
+	procs, err := process.Processes()
+	if err != nil { return 0, "", err.Error(), 3 }
+	n := 0
+	for _, p := range procs { if name, _ := p.Name(); strings.EqualFold(name, sc.Target) { n++ } }
+	// Without explicit ranges a process check simply means "at least one must be running"
+	if n == 0 && sc.Warn == "" && sc.Crit == "" { return 0, "", "no process named " + sc.Target, 2 }
+	return float64(n), "", fmt.Sprintf("%d process(es) named %s", n, sc.Target), -1
+}
+
+func checkRegex(sc ScriptConfig, timeout time.Duration) (float64, string, string, int) {
+	re, err := regexp.Compile(sc.Pattern)
+	if err != nil { return 0, "", "bad pattern: " + err.Error(), 3 }
+	r := runScript(ScriptConfig{Name: sc.Name, Command: sc.Command, Env: sc.Env, Dir: sc.Dir}, timeout)
+	if r.TimedOut { return 0, "", r.Output, 3 }
+	n := len(re.FindAllStringIndex(r.Output+"\n"+r.LongOutput, -1))
+	if n == 0 && sc.Warn == "" && sc.Crit == "" { return 0, "", fmt.Sprintf("output does not match %q", sc.Pattern), 2 }
+	return float64(n), "", fmt.Sprintf("%d match(es) for %q", n, sc.Pattern), -1
+}
+
+func fmtBytes(b uint64) string {
+	v, u := float64(b), []string{"B", "K", "M", "G", "T"}
+	i := 0
+	for v >= 1024 && i < len(u)-1 { v /= 1024; i++ }
+	return fmt.Sprintf("%.1f%s", v, u[i])
+}
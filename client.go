@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// --- CLI CLIENT ---
+// "pulse top", "pulse history", "pulse alerts" and "pulse status" read a running Pulse through
+// /api/v1 and print to the terminal, for a quick look over SSH; "pulse run" (runs.go) reports a
+// cron job's result to it. They ask the instance configured
+// in this machine's pulse.conf unless --url (env PULSE_URL) points elsewhere; --user (env
+// PULSE_USER) logs in with Basic auth, with the password from PULSE_PASSWORD or a prompt.
+
+// Each command registers its own flags and returns the function that runs it.
+var clientCommands = map[string]func(fs *flag.FlagSet) func(c *apiClient) error{
+	"top": cliTop, "history": cliHistory, "alerts": cliAlerts, "status": cliStatus, "run": cliRun,
+}
+
+type apiClient struct {
+	base, user, pass string
+	local            bool // base came from pulse.conf
+	http             *http.Client
+}
+
+// localURL is where the Pulse configured in pulse.conf answers on this machine.
+func localURL() (string, error) {
+	if def := filepath.Join(defaultDataDir(), "pulse.conf"); dataDir == "" { if _, err := os.Stat(def); err == nil { confFile = def } }
+	c, _, _, err := readConfig()
+	if err != nil { return "", err }
+	scheme, addr := "http", c.AdminListen
+	if addr == "" {
+		addr = listenAddr(c)
+		if c.TLSCert != "" || c.TLSSelfSigned || c.ACMEDomain != "" { scheme = "https" }
+	}
+	if addr == "" { return "", fmt.Errorf("no TCP listener configured") }
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil { return "", err }
+	if host == "" || host == "0.0.0.0" || host == "::" { host = "127.0.0.1" }
+	return scheme + "://" + net.JoinHostPort(host, port) + normBase(c.BasePath), nil
+}
+
+// runClient runs the client command name; ok is false if there is no such command.
+func runClient(name string, args []string) (ok bool, err error) {
+	reg := clientCommands[name]
+	if reg == nil { return false, nil }
+	fs := flag.NewFlagSet("pulse "+name, flag.ContinueOnError)
+	u := fs.String("url", os.Getenv("PULSE_URL"), "Pulse to ask, e.g. https://web1:8080 (default: this machine's, env PULSE_URL)")
+	user := fs.String("user", os.Getenv("PULSE_USER"), "log in as this user (env PULSE_USER, password from PULSE_PASSWORD)")
+	insecure := fs.Bool("insecure", false, "don't verify the server's TLS certificate")
+	run := reg(fs)
+	if err := fs.Parse(args); err != nil { if err == flag.ErrHelp { err = nil }; return true, err }
+	c := &apiClient{base: strings.TrimSuffix(*u, "/"), user: *user}
+	if c.base == "" {
+		if c.base, err = localURL(); err != nil { return true, err }
+		c.local, *insecure = true, true // likely our own self-signed certificate
+	}
+	c.http = &http.Client{Timeout: 10 * time.Second, Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: *insecure}}}
+	if c.user != "" {
+		if c.pass = os.Getenv("PULSE_PASSWORD"); c.pass == "" {
+			fmt.Fprintf(os.Stderr, "Password for %s: ", c.user)
+			line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+			c.pass = strings.TrimRight(line, "\r\n")
+		}
+	}
+	return true, run(c)
+}
+
+// get fetches /api/v1<path> and decodes its data into out.
+func (c *apiClient) get(path string, q url.Values, out interface{}) (*apiMeta, error) {
+	u := c.base + "/api/v1" + path
+	if len(q) > 0 { u += "?" + q.Encode() }
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil { return nil, err }
+	return c.do(req, out)
+}
+
+// post sends body as JSON to /api/v1<path> and decodes the reply's data into out, if given.
+func (c *apiClient) post(path string, body, out interface{}) error {
+	b, _ := json.Marshal(body)
+	req, err := http.NewRequest("POST", c.base+"/api/v1"+path, bytes.NewReader(b))
+	if err != nil { return err }
+	req.Header.Set("Content-Type", "application/json")
+	_, err = c.do(req, out)
+	return err
+}
+
+func (c *apiClient) do(req *http.Request, out interface{}) (*apiMeta, error) {
+	u := req.URL.String()
+	if c.user != "" { req.SetBasicAuth(c.user, c.pass) }
+	resp, err := c.http.Do(req)
+	if err != nil { return nil, err }
+	defer resp.Body.Close()
+	var env struct {
+		Data  json.RawMessage `json:"data"`
+		Meta  *apiMeta        `json:"meta"`
+		Error *apiError       `json:"error"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 64<<20)).Decode(&env); err != nil { return nil, fmt.Errorf("%s: %s (is this a Pulse?)", u, resp.Status) }
+	if env.Error != nil {
+		if resp.StatusCode == http.StatusUnauthorized && c.user == "" { return nil, fmt.Errorf("%s: login required, use --user or PULSE_USER", c.base) }
+		return nil, fmt.Errorf("%s: %s", c.base, env.Error.Message)
+	}
+	if out == nil { return env.Meta, nil }
+	return env.Meta, json.Unmarshal(env.Data, out)
+}
+
+func humanBytes(v float64) string {
+	u := []string{"B", "K", "M", "G", "T"}
+	i := 0
+	for ; v >= 1024 && i < len(u)-1; i++ { v /= 1024 }
+	if i == 0 { return fmt.Sprintf("%.0fB", v) }
+	return fmt.Sprintf("%.1f%s", v, u[i])
+}
+
+func humanUptime(secs uint64) string {
+	d, h, m := secs/86400, secs%86400/3600, secs%3600/60
+	if d > 0 { return fmt.Sprintf("%dd %02d:%02d", d, h, m) }
+	return fmt.Sprintf("%02d:%02d", h, m)
+}
+
+func alertSummary(list []activeAlert) string {
+	if len(list) == 0 { return "none" }
+	sort.SliceStable(list, func(i, j int) bool { return list[i].Level == "CRITICAL" && list[j].Level != "CRITICAL" })
+	var parts []string
+	for _, a := range list {
+		s := a.Level + " " + a.Monitor
+		if a.AckedBy != "" { s += " (acked by " + a.AckedBy + ")" }
+		parts = append(parts, s)
+	}
+	return strings.Join(parts, ", ")
+}
+
+func printSummary(w io.Writer, m RichMetrics, alerts []activeAlert) {
+	fmt.Fprintf(w, "%s  up %s  load %.2f  procs %d  %s\n", m.Hostname, humanUptime(m.Uptime), m.Load1, m.Procs, time.Unix(m.Timestamp, 0).Format("15:04:05"))
+	fmt.Fprintf(w, "cpu %5.1f%%  mem %5.1f%%  swap %5.1f%%  disk %5.1f%%  net rx %s tx %s  io r %s w %s\n", m.CPUTotal, m.MemUsed, m.SwapUsed, m.DiskUsed,
+		humanBytes(float64(m.NetDown)), humanBytes(float64(m.NetUp)), humanBytes(float64(m.DiskRead)), humanBytes(float64(m.DiskWrite)))
+	fmt.Fprintf(w, "alerts: %s\n", alertSummary(alerts))
+}
+
+func cliTop(fs *flag.FlagSet) func(c *apiClient) error {
+	n := fs.Int("n", 20, "number of processes to show")
+	by := fs.String("sort", "cpu", "sort by cpu, mem, io, pid or name")
+	watch := fs.Duration("watch", 0, "refresh at this interval until interrupted, e.g. 2s")
+	return func(c *apiClient) error {
+		less := map[string]func(a, b ProcessInfo) bool{
+			"cpu": func(a, b ProcessInfo) bool { return a.CPU > b.CPU }, "mem": func(a, b ProcessInfo) bool { return a.Mem > b.Mem },
+			"io":  func(a, b ProcessInfo) bool { return a.DiskRead+a.DiskWrite > b.DiskRead+b.DiskWrite },
+			"pid": func(a, b ProcessInfo) bool { return a.PID < b.PID }, "name": func(a, b ProcessInfo) bool { return strings.ToLower(a.Name) < strings.ToLower(b.Name) },
+		}[*by]
+		if less == nil { return fmt.Errorf("--sort must be cpu, mem, io, pid or name") }
+		for {
+			var m RichMetrics
+			if _, err := c.get("/snapshot", nil, &m); err != nil { return err }
+			var alerts []activeAlert
+			if _, err := c.get("/alerts/active", nil, &alerts); err != nil { return err }
+			var b strings.Builder
+			printSummary(&b, m, alerts)
+			procs := m.ProcessList
+			sort.SliceStable(procs, func(i, j int) bool { return less(procs[i], procs[j]) })
+			fmt.Fprintf(&b, "\n%7s  %-24s %6s %9s %9s %9s\n", "PID", "NAME", "CPU%", "MEM", "READ/s", "WRITE/s")
+			for i, p := range procs {
+				if i == *n { break }
+				name := p.Name
+				if len(name) > 24 { name = name[:23] + "~" }
+				fmt.Fprintf(&b, "%7d  %-24s %6.1f %9s %9s %9s\n", p.PID, name, p.CPU, humanBytes(p.Mem), humanBytes(float64(p.DiskRead)), humanBytes(float64(p.DiskWrite)))
+			}
+			if *watch <= 0 { fmt.Print(b.String()); return nil }
+			fmt.Print("\033[H\033[2J" + b.String())
+			time.Sleep(*watch)
+		}
+	}
+}
+
+// historyAliases are short names for sample fields.
+var historyAliases = map[string]string{"cpu": "cpu_tot", "mem": "mem_used", "swap": "swp_used", "disk": "dsk_used", "load": "load1", "rx": "net_down", "tx": "net_up", "read": "dsk_read", "write": "dsk_writ"}
+
+func textSparkline(vals []float64, lo, hi float64) string {
+	bars := []rune("▁▂▃▄▅▆▇█")
+	var b strings.Builder
+	for _, v := range vals {
+		i := 0
+		if hi > lo { i = int((v - lo) / (hi - lo) * float64(len(bars)-1)) }
+		b.WriteRune(bars[max(0, min(i, len(bars)-1))])
+	}
+	return b.String()
+}
+
+func cliHistory(fs *flag.FlagSet) func(c *apiClient) error {
+	since := fs.String("since", "1h", "how far back, e.g. 30m, 6h or 2d")
+	metric := fs.String("metric", "cpu", "cpu, mem, swap, disk, load, rx, tx, read, write or any sample field")
+	width := fs.Int("width", 60, "width of the chart in characters")
+	raw := fs.Bool("raw", false, "print every sample as time and value instead of a chart")
+	return func(c *apiClient) error {
+		secs, err := parseRetention(*since)
+		if err != nil { return fmt.Errorf("--since: %v", err) }
+		field := *metric
+		if f, ok := historyAliases[field]; ok { field = f }
+		start := time.Now().Add(-time.Duration(secs) * time.Second)
+		var ts []int64
+		var vals []float64
+		for offset := 0; ; {
+			var page []map[string]float64
+			meta, err := c.get("/history", url.Values{"start": {strconv.FormatInt(start.Unix(), 10)}, "fields": {field}, "limit": {"1000"}, "offset": {strconv.Itoa(offset)}}, &page)
+			if err != nil { return err }
+			for _, s := range page {
+				v, ok := s[field]
+				if !ok { return fmt.Errorf("unknown metric %q", *metric) }
+				ts, vals = append(ts, int64(s["ts"])), append(vals, v)
+			}
+			offset += len(page)
+			if len(page) == 0 || meta == nil || offset >= meta.Total { break }
+		}
+		if len(vals) == 0 { fmt.Println("no samples in that range"); return nil }
+		if *raw {
+			for i := range vals { fmt.Printf("%s %g\n", time.Unix(ts[i], 0).Format("2006-01-02 15:04:05"), vals[i]) }
+			return nil
+		}
+		lo, hi, sum := vals[0], vals[0], 0.0
+		for _, v := range vals { lo, hi, sum = min(lo, v), max(hi, v), sum+v }
+		// Average the samples into one bucket per column.
+		cols := min(*width, len(vals))
+		buckets := make([]float64, cols)
+		for i := range buckets {
+			a, b := i*len(vals)/cols, (i+1)*len(vals)/cols
+			for _, v := range vals[a:b] { buckets[i] += v }
+			buckets[i] /= float64(b - a)
+		}
+		fmt.Printf("%s, last %s (%d samples)\n", field, *since, len(vals))
+		fmt.Printf("min %.2f  avg %.2f  max %.2f  now %.2f\n\n", lo, sum/float64(len(vals)), hi, vals[len(vals)-1])
+		fmt.Printf("%8.2f %s\n", hi, textSparkline(buckets, lo, hi))
+		fmt.Printf("%8.2f %-*s%s\n", lo, cols-5, time.Unix(ts[0], 0).Format("15:04"), time.Unix(ts[len(ts)-1], 0).Format("15:04"))
+		return nil
+	}
+}
+
+func cliAlerts(fs *flag.FlagSet) func(c *apiClient) error {
+	n := fs.Int("n", 20, "number of recent events to show")
+	level := fs.String("level", "", "only events of this level (OK, WARNING, CRITICAL, REMEDIATION, ACK)")
+	return func(c *apiClient) error {
+		var active []activeAlert
+		if _, err := c.get("/alerts/active", nil, &active); err != nil { return err }
+		fmt.Println("Active:", alertSummary(active))
+		var events []AlertEvent
+		q := url.Values{"limit": {strconv.Itoa(max(1, min(*n, 1000)))}}
+		if *level != "" { q.Set("level", strings.ToUpper(*level)) }
+		if _, err := c.get("/alerts", q, &events); err != nil { return err }
+		if len(events) == 0 { return nil }
+		fmt.Println()
+		for _, e := range events {
+			fmt.Printf("%s  %-11s %-20s %8.2f  %s\n", time.Unix(e.Time, 0).Format("2006-01-02 15:04:05"), e.Level, e.Monitor, e.Value, e.Message)
+		}
+		return nil
+	}
+}
+
+// cliStatus shows the local service state (unless --url is given) and the instance's health and latest sample.
+func cliStatus(fs *flag.FlagSet) func(c *apiClient) error {
+	return func(c *apiClient) error {
+		if c.local {
+			state, err := serviceState()
+			if err != nil { state = err.Error() }
+			fmt.Println("Service:  ", state)
+		}
+		resp, err := c.http.Get(c.base + "/healthz")
+		if err != nil { fmt.Println("Dashboard: not responding at " + c.base + ": " + err.Error()); return nil }
+		io.Copy(io.Discard, resp.Body); resp.Body.Close()
+		fmt.Printf("Dashboard: responding at %s/ (HTTP %d)\n", c.base, resp.StatusCode)
+		var h HealthStatus
+		if _, err := c.get("/status", nil, &h); err != nil { fmt.Println("Details:  ", err); return nil }
+		fmt.Printf("Pulse:     %s, up %s, %d samples stored, %d dashboard clients\n\n", h.Status, humanUptime(uint64(time.Now().Unix()-h.Started)), h.HistorySamples, h.SSEClients+h.WSClients)
+		var m RichMetrics
+		var alerts []activeAlert
+		if _, err := c.get("/snapshot", nil, &m); err != nil { return err }
+		if _, err := c.get("/alerts/active", nil, &alerts); err != nil { return err }
+		printSummary(os.Stdout, m, alerts)
+		return nil
+	}
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- COLLECTOR PLUGINS ---
+// A Collector is a metric source of its own: Pulse calls Collect every Interval and every sample
+// carries what each collector returned last in its "metrics" list. A series is "metric:<name>", or
+// "metric:<name>{key=value,...}" with tags, in exports, custom panels, Grafana and rate rules, and is
+// forwarded like the built-in numbers. Go collectors are a file of package main that calls
+// registerCollector from init(); external ones are listed in "collectors" and are any program that
+// prints its metrics as JSON and exits:
+//
+//	[{"name": "gpu_temp", "value": 63, "unit": "C", "tags": {"gpu": "0"}}]
+//
+// or {"metrics": [...]}. A collector's metrics stay in samples for three of its intervals after it
+// last succeeded, then drop out. GET /api/v1/collectors shows how each one is doing.
+
+type Metric struct {
+	Name   string            `json:"name"`
+	Value  float64           `json:"value"`
+	Unit   string            `json:"unit,omitempty"`
+	Tags   map[string]string `json:"tags,omitempty"`
+	Source string            `json:"source,omitempty"` // the collector it came from
+}
+
+type Collector interface {
+	Name() string
+	Interval() time.Duration // 0: every global_int
+	Collect(ctx context.Context) ([]Metric, error)
+}
+
+// CollectorConfig is an external collector.
+type CollectorConfig struct {
+	Name     string            `json:"name"`
+	Command  string            `json:"command"`
+	Interval int               `json:"interval,omitempty"` // seconds; Default: script_int
+	Timeout  int               `json:"timeout,omitempty"`  // seconds; Default: script_timeout
+	Env      map[string]string `json:"env,omitempty"`
+}
+
+type collectorState struct {
+	Name     string   `json:"name"`
+	Kind     string   `json:"kind"` // go or command
+	Interval int      `json:"interval"`
+	LastRun  int64    `json:"last_run,omitempty"`
+	LastOK   int64    `json:"last_ok,omitempty"`
+	Duration float64  `json:"duration,omitempty"`
+	Error    string   `json:"error,omitempty"`
+	Metrics  int      `json:"metrics"`
+	running  bool
+	every    time.Duration
+	latest   []Metric
+}
+
+var (
+	collectorRegistry = map[string]Collector{}
+	collectorStates   = map[string]*collectorState{}
+	collectorsMutex   sync.Mutex
+	metricName        = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// registerCollector adds a Go collector; call it from init().
+func registerCollector(c Collector) {
+	collectorsMutex.Lock(); defer collectorsMutex.Unlock()
+	if _, dup := collectorRegistry[c.Name()]; dup { panic("collector registered twice: " + c.Name()) }
+	collectorRegistry[c.Name()] = c
+}
+
+// key names a series: the metric name, with its tags in key order.
+func (m Metric) key() string {
+	if len(m.Tags) == 0 { return m.Name }
+	keys := make([]string, 0, len(m.Tags))
+	for k := range m.Tags { keys = append(keys, k) }
+	sort.Strings(keys)
+	for i, k := range keys { keys[i] = k + "=" + m.Tags[k] }
+	return m.Name + "{" + strings.Join(keys, ",") + "}"
+}
+
+// checkMetric is what every source's metrics have to pass: names and tag keys that every export format can carry.
+func checkMetric(m Metric) error {
+	if !metricName.MatchString(m.Name) { return fmt.Errorf("%q: metric names are letters, digits and _", m.Name) }
+	for k := range m.Tags {
+		if !metricName.MatchString(k) { return fmt.Errorf("%s: tag %q: tag keys are letters, digits and _", m.Name, k) }
+		if k == "host" || k == "label" { return fmt.Errorf("%s: tag %q is taken by Pulse", m.Name, k) }
+	}
+	return nil
+}
+
+// metricValue finds a series in a sample by its key.
+func metricValue(m RichMetrics, key string) (float64, bool) {
+	for _, mt := range m.Metrics { if mt.key() == key { return mt.Value, true } }
+	return 0, false
+}
+
+type commandCollector struct {
+	cfg            CollectorConfig
+	every, timeout time.Duration
+}
+
+func (c commandCollector) Name() string { return c.cfg.Name }
+func (c commandCollector) Interval() time.Duration { return c.every }
+
+func (c commandCollector) Collect(ctx context.Context) ([]Metric, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" { cmd = exec.CommandContext(ctx, "cmd", "/C", c.cfg.Command) } else { cmd = exec.CommandContext(ctx, "sh", "-c", c.cfg.Command) }
+	if len(c.cfg.Env) > 0 {
+		cmd.Env = os.Environ()
+		for k, v := range c.cfg.Env { cmd.Env = append(cmd.Env, k+"="+v) }
+	}
+	setProcessGroup(cmd)
+	cmd.Cancel = func() error { return killProcessGroup(cmd) }
+	cmd.WaitDelay = time.Second
+	var out, errOut bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &out, &errOut
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded { return nil, fmt.Errorf("timed out after %s", c.timeout) }
+		return nil, fmt.Errorf("%w: %s", err, truncateOutput(strings.TrimSpace(errOut.String())))
+	}
+	b := bytes.TrimSpace(out.Bytes())
+	var ms []Metric
+	if len(b) > 0 && b[0] == '{' {
+		var wrapped struct{ Metrics []Metric `json:"metrics"` }
+		if err := json.Unmarshal(b, &wrapped); err != nil { return nil, fmt.Errorf("output is not collector JSON: %w", err) }
+		ms = wrapped.Metrics
+	} else if err := json.Unmarshal(b, &ms); err != nil {
+		return nil, fmt.Errorf("output is not collector JSON: %w", err)
+	}
+	return ms, nil
+}
+
+// activeCollectors is the registered Go collectors, then the configured commands.
+func activeCollectors(cfg AppConfig) []Collector {
+	collectorsMutex.Lock()
+	var res []Collector
+	for _, c := range collectorRegistry { res = append(res, c) }
+	collectorsMutex.Unlock()
+	sort.Slice(res, func(i, j int) bool { return res[i].Name() < res[j].Name() })
+	for _, cc := range cfg.Collectors {
+		every, timeout := time.Duration(cmp.Or(cc.Interval, cfg.ScriptInt))*time.Second, time.Duration(cmp.Or(cc.Timeout, cfg.ScriptTimeout))*time.Second
+		res = append(res, commandCollector{cc, every, min(timeout, every)})
+	}
+	return res
+}
+
+// runCollector makes one Collect call and keeps its metrics, tagged with their source.
+func runCollector(c Collector, st *collectorState, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(stopCtx, timeout)
+	defer cancel()
+	start := time.Now()
+	ms, err := c.Collect(ctx)
+	var good []Metric
+	for _, m := range ms {
+		if e := checkMetric(m); e != nil { err = errors.Join(err, e); continue }
+		m.Source = c.Name()
+		good = append(good, m)
+	}
+	collectorsMutex.Lock(); defer collectorsMutex.Unlock()
+	st.running, st.LastRun, st.Duration = false, start.Unix(), time.Since(start).Seconds()
+	if err != nil {
+		if st.Error == "" { collectorLog.Warn("collector failed", "collector", c.Name(), "err", err) }
+		st.Error = err.Error()
+	} else {
+		if st.Error != "" { collectorLog.Info("collector recovered", "collector", c.Name()) }
+		st.Error = ""
+	}
+	// A run that errors but still returns metrics keeps the good ones.
+	if err == nil || len(good) > 0 { st.latest, st.LastOK, st.Metrics = good, start.Unix(), len(good) }
+}
+
+func runCollectors() {
+	t := time.NewTicker(time.Second)
+	defer t.Stop()
+	for {
+		cfgMutex.RLock(); cfg := config; cfgMutex.RUnlock()
+		now := time.Now()
+		keep := map[string]bool{}
+		for _, c := range activeCollectors(cfg) {
+			name := c.Name()
+			keep[name] = true
+			every, timeout := c.Interval(), time.Duration(0)
+			if every <= 0 { every = time.Duration(cfg.GlobalInt) * time.Second }
+			if cc, ok := c.(commandCollector); ok { timeout = cc.timeout }
+			if timeout <= 0 { timeout = every }
+			collectorsMutex.Lock()
+			st := collectorStates[name]
+			if st == nil {
+				st = &collectorState{Name: name, Kind: "go"}
+				if _, ok := c.(commandCollector); ok { st.Kind = "command" }
+				collectorStates[name] = st
+			}
+			st.every, st.Interval = every, int(every.Seconds())
+			due := !st.running && now.Sub(time.Unix(st.LastRun, 0)) >= every
+			if due { st.running = true }
+			collectorsMutex.Unlock()
+			if due { go runCollector(c, st, timeout) }
+		}
+		collectorsMutex.Lock()
+		for n := range collectorStates { if !keep[n] { delete(collectorStates, n) } }
+		collectorsMutex.Unlock()
+		select { case <-stopCtx.Done(): return; case <-t.C: }
+	}
+}
+
+// currentMetrics is every collector's latest metrics that are still fresh, for the next sample.
+func currentMetrics() []Metric {
+	collectorsMutex.Lock(); defer collectorsMutex.Unlock()
+	var res []Metric
+	now := time.Now()
+	for _, st := range collectorStates {
+		if st.LastOK == 0 || now.Sub(time.Unix(st.LastOK, 0)) > 3*st.every { continue }
+		res = append(res, st.latest...)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].key() < res[j].key() })
+	return res
+}
+
+func collectorStatus() []collectorState {
+	collectorsMutex.Lock(); defer collectorsMutex.Unlock()
+	res := []collectorState{}
+	for _, st := range collectorStates { res = append(res, *st) }
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res
+}
+
+func validateCollectors(c AppConfig, bad func(field, format string, a ...interface{})) {
+	seen := map[string]bool{}
+	collectorsMutex.Lock(); for n := range collectorRegistry { seen[n] = true }; collectorsMutex.Unlock()
+	for i, cc := range c.Collectors {
+		f := fmt.Sprintf("collectors[%d]", i)
+		if cc.Name == "" { bad(f, "name is required") } else if seen[cc.Name] { bad(f, "there is already a collector named %q", cc.Name) }
+		seen[cc.Name] = true
+		if strings.TrimSpace(cc.Command) == "" { bad(f, "command is required") }
+		if cc.Interval < 0 || cc.Timeout < 0 { bad(f, "interval and timeout must not be negative") }
+	}
+}
+
+func registerCollectorAPI(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/v1/collectors", func(w http.ResponseWriter, r *http.Request) {
+		res := collectorStatus()
+		apiOK(w, 200, res, &apiMeta{len(res), len(res), 0})
+	})
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/gob"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// --- HISTORY FILE FORMAT ---
+// dbFile is gzip around a header ("PULSEDB\n" and a big-endian uint32 schema version) and a
+// gob-encoded []RichMetrics in that schema; files from before the header are schema 0. Every schema
+// Pulse has written keeps a decoder, so an upgrade converts the stored history instead of losing it
+// to a failed decode, and a file from a newer Pulse is moved aside rather than overwritten.
+// "pulse migrate-data" converts (or with -check only reads) a history file without starting Pulse.
+
+const historySchema = 1
+
+var historyMagic = []byte("PULSEDB\n")
+
+// historyDecoders read each schema into the current RichMetrics. When a field is renamed or changes
+// type, bump historySchema, keep a frozen copy of the old struct here and add a decoder converting it.
+var historyDecoders = map[uint32]func(*gob.Decoder) ([]RichMetrics, error){
+	0: decodeRichMetrics, // gob matches fields by name, so headerless files read as they are
+	1: decodeRichMetrics,
+}
+
+func decodeRichMetrics(d *gob.Decoder) ([]RichMetrics, error) {
+	var h []RichMetrics
+	err := d.Decode(&h)
+	return h, err
+}
+
+type futureSchemaError uint32
+
+func (e futureSchemaError) Error() string {
+	return fmt.Sprintf("written by a newer Pulse (schema %d; this one reads up to %d)", uint32(e), historySchema)
+}
+
+func writeHistoryFile(w io.Writer, h []RichMetrics) error {
+	gz := gzip.NewWriter(w)
+	gz.Write(historyMagic)
+	binary.Write(gz, binary.BigEndian, uint32(historySchema))
+	if err := gob.NewEncoder(gz).Encode(h); err != nil { return err }
+	return gz.Close()
+}
+
+// readHistoryFile decodes a history file of any known schema and reports which one it was.
+func readHistoryFile(path string) ([]RichMetrics, uint32, error) {
+	f, err := os.Open(path)
+	if err != nil { return nil, 0, err }
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil { return nil, 0, err }
+	defer gz.Close()
+	br := bufio.NewReader(gz)
+	var version uint32
+	if head, _ := br.Peek(len(historyMagic) + 4); len(head) == len(historyMagic)+4 && bytes.HasPrefix(head, historyMagic) {
+		version = binary.BigEndian.Uint32(head[len(historyMagic):])
+		br.Discard(len(head))
+	}
+	dec, ok := historyDecoders[version]
+	if !ok {
+		if version > historySchema { return nil, version, futureSchemaError(version) }
+		return nil, version, fmt.Errorf("unknown schema %d", version)
+	}
+	h, err := dec(gob.NewDecoder(br))
+	if err != nil { return nil, version, fmt.Errorf("schema %d: %w", version, err) }
+	return h, version, nil
+}
+
+// runMigrateData is "pulse migrate-data": stop Pulse first, since a running one rewrites the file every minute.
+func runMigrateData(args []string) int {
+	observeOnly = true
+	loadConfig()
+	useDataFile(config)
+	fs := flag.NewFlagSet("pulse migrate-data", flag.ContinueOnError)
+	in := fs.String("in", dbFile, "history file to read")
+	out := fs.String("out", "", "where to write the converted file (default: replace -in, keeping a .bak copy)")
+	check := fs.Bool("check", false, "only read the file and report its schema and samples")
+	if err := fs.Parse(args); err != nil { if err == flag.ErrHelp { return 0 }; return 2 }
+	h, version, err := readHistoryFile(*in)
+	if err != nil { fmt.Fprintf(os.Stderr, "Error: %s: %v\n", *in, err); return 1 }
+	span := ""
+	if len(h) > 0 { span = fmt.Sprintf(", %s to %s", time.Unix(h[0].Timestamp, 0).Format(time.RFC3339), time.Unix(h[len(h)-1].Timestamp, 0).Format(time.RFC3339)) }
+	fmt.Printf("%s: schema %d, %d samples%s\n", *in, version, len(h), span)
+	if *check { return 0 }
+	dst := *out
+	if dst == "" {
+		dst = *in
+		if err := copyFile(*in, *in+".bak"); err != nil { fmt.Fprintln(os.Stderr, "Error: backing up:", err); return 1 }
+	}
+	tmp := dst + ".tmp"
+	f, err := os.Create(tmp)
+	if err == nil {
+		err = writeHistoryFile(f, h)
+		if cerr := f.Close(); err == nil { err = cerr }
+	}
+	if err == nil { err = os.Rename(tmp, dst) }
+	if err != nil { os.Remove(tmp); fmt.Fprintln(os.Stderr, "Error:", err); return 1 }
+	fmt.Printf("wrote %s: schema %d\n", dst, historySchema)
+	return 0
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"expvar"
+	"net/http"
+	_ "net/http/pprof"
+	"strings"
+)
+
+// --- DEBUG ENDPOINTS ---
+// net/http/pprof (/debug/pprof/) and expvar (/debug/vars, with Go memstats and a "pulse" entry
+// holding /status) register themselves on the default mux. debugGate hides them unless
+// debug_endpoints is on, and then only admins get through. Useful for chasing memory growth:
+//   go tool pprof http://localhost:8081/debug/pprof/heap
+
+func init() { expvar.Publish("pulse", expvar.Func(func() interface{} { return healthStatus() })) }
+
+func debugGate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/debug/") {
+			cfgMutex.RLock(); on := config.DebugEndpoints; cfgMutex.RUnlock()
+			if !on { http.NotFound(w, r); return }
+			if !hasRole(r, "admin") { http.Error(w, "forbidden: requires admin", http.StatusForbidden); return }
+		}
+		next.ServeHTTP(w, r)
+	})
+}
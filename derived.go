@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// --- DERIVED METRICS ---
+// derived_metrics are computed from each sample as it is collected, e.g.
+// {"name": "net_total", "expr": "net_down + net_up"}, and join its "metrics" (source "derived"), so
+// they are stored, charted, exported and alerted on like a collector's, as metric:<name>. Expressions
+// have numbers, + - * / %, parentheses, min(), max() and abs(), and the names a rate rule takes
+// (cpu_tot, mem, load1, group:<group>/<field>, metric:<series>, ...); a name with other characters
+// is quoted: "mount:/var" / 1e9, "backup [age]". Each may use the ones listed before it. A sample
+// missing one of the values, or dividing by 0, goes without that metric.
+
+type DerivedMetric struct {
+	Name string `json:"name"`
+	Expr string `json:"expr"`
+	Unit string `json:"unit,omitempty"`
+}
+
+type exprFn func(m RichMetrics) (float64, bool)
+
+var (
+	derivedCache = map[string]exprFn{}
+	derivedMutex sync.Mutex
+)
+
+type exprParser struct {
+	toks []string
+	pos  int
+}
+
+// lexExpr splits an expression into numbers, names, quoted names (kept with their quotes) and operators.
+func lexExpr(s string) ([]string, error) {
+	var toks []string
+	for i := 0; i < len(s); {
+		c := rune(s[i])
+		switch {
+		case unicode.IsSpace(c): i++
+		case strings.ContainsRune("+-*/%(),", c): toks = append(toks, s[i:i+1]); i++
+		case c == '"':
+			j := strings.IndexByte(s[i+1:], '"')
+			if j < 0 { return nil, fmt.Errorf("unterminated quoted name") }
+			toks = append(toks, s[i:i+j+2]); i += j + 2
+		case c == '.' || unicode.IsDigit(c) || c == '_' || unicode.IsLetter(c):
+			j := i
+			for j < len(s) && (s[j] == '.' || s[j] == '_' || unicode.IsLetter(rune(s[j])) || unicode.IsDigit(rune(s[j])) || ((s[j] == '+' || s[j] == '-') && j > i && (s[j-1] == 'e' || s[j-1] == 'E') && unicode.IsDigit(rune(s[i])))) { j++ }
+			toks = append(toks, s[i:j]); i = j
+		default:
+			return nil, fmt.Errorf("unexpected %q", c)
+		}
+	}
+	return toks, nil
+}
+
+func (p *exprParser) peek() string { if p.pos < len(p.toks) { return p.toks[p.pos] }; return "" }
+func (p *exprParser) next() string { t := p.peek(); p.pos++; return t }
+
+func (p *exprParser) expr() (exprFn, error) {
+	l, err := p.term()
+	for err == nil && (p.peek() == "+" || p.peek() == "-") {
+		op := p.next()
+		var r exprFn
+		if r, err = p.term(); err == nil { l = binaryFn(op, l, r) }
+	}
+	return l, err
+}
+
+func (p *exprParser) term() (exprFn, error) {
+	l, err := p.unary()
+	for err == nil && (p.peek() == "*" || p.peek() == "/" || p.peek() == "%") {
+		op := p.next()
+		var r exprFn
+		if r, err = p.unary(); err == nil { l = binaryFn(op, l, r) }
+	}
+	return l, err
+}
+
+func (p *exprParser) unary() (exprFn, error) {
+	if p.peek() == "-" {
+		p.next()
+		x, err := p.unary()
+		if err != nil { return nil, err }
+		return func(m RichMetrics) (float64, bool) { v, ok := x(m); return -v, ok }, nil
+	}
+	return p.primary()
+}
+
+func (p *exprParser) primary() (exprFn, error) {
+	t := p.next()
+	switch {
+	case t == "": return nil, fmt.Errorf("unexpected end")
+	case t == "(":
+		x, err := p.expr()
+		if err != nil { return nil, err }
+		if p.next() != ")" { return nil, fmt.Errorf("missing )") }
+		return x, nil
+	case t[0] == '"': return exprVar(t[1 : len(t)-1]), nil
+	case t[0] == '.' || unicode.IsDigit(rune(t[0])):
+		v, err := strconv.ParseFloat(t, 64)
+		if err != nil { return nil, fmt.Errorf("bad number %q", t) }
+		return func(RichMetrics) (float64, bool) { return v, true }, nil
+	case strings.ContainsAny(t, "+-*/%(),"): return nil, fmt.Errorf("unexpected %q", t)
+	case p.peek() == "(" && (t == "min" || t == "max" || t == "abs"):
+		p.next()
+		var args []exprFn
+		for {
+			a, err := p.expr()
+			if err != nil { return nil, err }
+			args = append(args, a)
+			if sep := p.next(); sep == ")" { break } else if sep != "," { return nil, fmt.Errorf("%s(: expected , or )", t) }
+		}
+		if (t == "abs") != (len(args) == 1) { return nil, fmt.Errorf("abs takes one value, min and max two or more") }
+		return funcFn(t, args), nil
+	}
+	return exprVar(t), nil
+}
+
+func binaryFn(op string, l, r exprFn) exprFn {
+	return func(m RichMetrics) (float64, bool) {
+		a, ok := l(m)
+		if !ok { return 0, false }
+		b, ok := r(m)
+		if !ok { return 0, false }
+		switch op {
+		case "+": return a + b, true
+		case "-": return a - b, true
+		case "*": return a * b, true
+		case "/": if b == 0 { return 0, false }; return a / b, true
+		}
+		if b == 0 { return 0, false }
+		return math.Mod(a, b), true
+	}
+}
+
+func funcFn(name string, args []exprFn) exprFn {
+	return func(m RichMetrics) (float64, bool) {
+		var res float64
+		for i, a := range args {
+			v, ok := a(m)
+			if !ok { return 0, false }
+			switch {
+			case name == "abs": res = math.Abs(v)
+			case i == 0: res = v
+			case name == "min": res = min(res, v)
+			default: res = max(res, v)
+			}
+		}
+		return res, true
+	}
+}
+
+// exprVar reads a value from the sample: an export field, a mount: or disk: column, or a rate rule's metric name.
+func exprVar(name string) exprFn {
+	if f, ok := exportFields[name]; ok { return func(m RichMetrics) (float64, bool) { return f(m), true } }
+	if strings.HasPrefix(name, "mount:") || strings.HasPrefix(name, "disk:") {
+		if cols, err := exportColumns([]string{name}); err == nil && len(cols) == 1 { return cols[0].get }
+	}
+	return func(m RichMetrics) (float64, bool) { return namedMetric(m, name) }
+}
+
+func compileExpr(s string) (exprFn, error) {
+	toks, err := lexExpr(s)
+	if err != nil { return nil, err }
+	p := &exprParser{toks: toks}
+	f, err := p.expr()
+	if err == nil && p.pos < len(toks) { err = fmt.Errorf("unexpected %q", toks[p.pos]) }
+	return f, err
+}
+
+// deriveMetrics adds the derived_metrics to a new sample, in config order.
+func deriveMetrics(cfg AppConfig, m *RichMetrics) {
+	for _, d := range cfg.DerivedMetrics {
+		derivedMutex.Lock()
+		f, ok := derivedCache[d.Expr]
+		if !ok {
+			f, _ = compileExpr(d.Expr)
+			derivedCache[d.Expr] = f
+		}
+		derivedMutex.Unlock()
+		if f == nil { continue }
+		if v, ok := f(*m); ok && !math.IsNaN(v) && !math.IsInf(v, 0) {
+			m.Metrics = append(m.Metrics, Metric{Name: d.Name, Value: v, Unit: d.Unit, Source: "derived"})
+		}
+	}
+}
+
+func validateDerived(c AppConfig, bad func(field, format string, a ...interface{})) {
+	seen := map[string]bool{}
+	for i, d := range c.DerivedMetrics {
+		f := fmt.Sprintf("derived_metrics[%d]", i)
+		if !metricName.MatchString(d.Name) { bad(f, "name %q: letters, digits and _", d.Name) }
+		if seen[d.Name] { bad(f, "%s is defined twice", d.Name) }
+		seen[d.Name] = true
+		if _, err := compileExpr(d.Expr); err != nil { bad(f, "expr: %v", err) }
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	htmltpl "html/template"
+	"sort"
+	"strings"
+	"time"
+)
+
+// --- DIGEST REPORTS ---
+// A daily or weekly summary built from history: resource min/avg/max, disk growth, top processes,
+// alert counts and plugin health. Sent by email (with a chart of the period) and/or posted as JSON
+// to digest_webhook.
+
+type Stat struct {
+	Min float64 `json:"min"`
+	Avg float64 `json:"avg"`
+	Max float64 `json:"max"`
+}
+
+type ProcSummary struct {
+	Name   string  `json:"name"`
+	AvgCPU float64 `json:"avg_cpu"`
+	MaxMem float64 `json:"max_mem"`
+}
+
+type PluginSummary struct {
+	Name   string  `json:"name"`
+	Status string  `json:"status"`
+	Output string  `json:"output"`
+	OkPct  float64 `json:"ok_pct"`
+}
+
+type Digest struct {
+	Host       string          `json:"host"`
+	Period     string          `json:"period"`
+	From       int64           `json:"from"`
+	To         int64           `json:"to"`
+	Samples    int             `json:"samples"`
+	CPU        Stat            `json:"cpu"`
+	Mem        Stat            `json:"mem"`
+	Swap       Stat            `json:"swap"`
+	Load       Stat            `json:"load1"`
+	DiskStart  float64         `json:"disk_start"`
+	DiskEnd    float64         `json:"disk_end"`
+	DiskGrowth float64         `json:"disk_growth"`
+	NetDown    uint64          `json:"net_down"`
+	NetUp      uint64          `json:"net_up"`
+	TopProcs   []ProcSummary   `json:"top_procs"`
+	Alerts     map[string]int  `json:"alerts"`
+	TopAlerts  map[string]int  `json:"top_alerts"`
+	Plugins    []PluginSummary `json:"plugins"`
+}
+
+func newStat() Stat { return Stat{Min: 1e18, Max: -1e18} }
+
+func (s *Stat) add(v float64) {
+	if v < s.Min { s.Min = v }
+	if v > s.Max { s.Max = v }
+	s.Avg += v
+}
+
+func (s *Stat) done(n int) {
+	if n == 0 { *s = Stat{}; return }
+	s.Avg /= float64(n)
+}
+
+func digestPeriod(period string) time.Duration {
+	if period == "weekly" { return 7 * 24 * time.Hour }
+	return 24 * time.Hour
+}
+
+// buildDigest summarizes the history samples of the last period (as far back as history reaches).
+func buildDigest(period string) Digest {
+	to := time.Now()
+	from := to.Add(-digestPeriod(period))
+	d := Digest{Period: period, From: from.Unix(), To: to.Unix(), CPU: newStat(), Mem: newStat(), Swap: newStat(), Load: newStat(),
+		Alerts: map[string]int{}, TopAlerts: map[string]int{}}
+	type procAcc struct { cpu, mem float64 }
+	procs := map[string]*procAcc{}
+	plugOK, plugN := map[string]int{}, map[string]int{}
+	var last RichMetrics
+
+	historyMutex.RLock()
+	for i := history.Search(d.From); i < history.Len(); i++ {
+		m := history.At(i)
+		if d.Samples == 0 { d.DiskStart = m.DiskUsed }
+		d.Samples++
+		d.CPU.add(m.CPUTotal); d.Mem.add(m.MemUsed); d.Swap.add(m.SwapUsed); d.Load.add(m.Load1)
+		d.NetDown += m.NetDown; d.NetUp += m.NetUp
+		for _, p := range m.ProcessList {
+			a := procs[p.Name]
+			if a == nil { a = &procAcc{}; procs[p.Name] = a }
+			a.cpu += p.CPU
+			if p.Mem > a.mem { a.mem = p.Mem }
+		}
+		for _, p := range m.Plugins {
+			plugN[p.Name+"\x00"+p.Path]++
+			if p.ExitCode == 0 { plugOK[p.Name+"\x00"+p.Path]++ }
+		}
+		last = *m
+	}
+	historyMutex.RUnlock()
+	d.Host, d.DiskEnd = last.Hostname, last.DiskUsed
+	d.DiskGrowth = d.DiskEnd - d.DiskStart
+	for _, s := range []*Stat{&d.CPU, &d.Mem, &d.Swap, &d.Load} { s.done(d.Samples) }
+
+	// Averages over the whole period, so a process that only ran briefly doesn't top the list.
+	for name, a := range procs { d.TopProcs = append(d.TopProcs, ProcSummary{name, a.cpu / float64(d.Samples), a.mem}) }
+	sort.Slice(d.TopProcs, func(i, j int) bool { return d.TopProcs[i].AvgCPU > d.TopProcs[j].AvgCPU })
+	if len(d.TopProcs) > 5 { d.TopProcs = d.TopProcs[:5] }
+
+	for _, p := range last.Plugins {
+		k := p.Name + "\x00" + p.Path
+		name := p.Name
+		if name == "" { name = p.Path }
+		st := "UNKNOWN"
+		if p.ExitCode >= 0 && p.ExitCode < len(statusNames) { st = statusNames[p.ExitCode] }
+		d.Plugins = append(d.Plugins, PluginSummary{name, st, p.Output, 100 * float64(plugOK[k]) / float64(plugN[k])})
+	}
+
+	alertLogMutex.RLock()
+	for _, a := range alertHistory {
+		if a.Time < d.From { continue }
+		d.Alerts[a.Level]++
+		if a.Level == "WARNING" || a.Level == "CRITICAL" { d.TopAlerts[a.Monitor]++ }
+	}
+	alertLogMutex.RUnlock()
+	return d
+}
+
+var digestTemplate = htmltpl.Must(htmltpl.New("digest").Funcs(htmltpl.FuncMap{
+	"bytes": func(v uint64) string { return fmtBytes(v) },
+	"mem":   func(v float64) string { return fmtBytes(uint64(v)) },
+	"date":  func(ts int64) string { return time.Unix(ts, 0).Format("Mon 2006-01-02 15:04") },
+}).Parse(`<div style="font-family:Segoe UI,Arial,sans-serif;font-size:13px;color:#222;">
+<h2 style="margin:0;">Pulse {{.Period}} report: {{.Host}}</h2>
+<p style="color:#666;margin:4px 0 12px;">{{date .From}} to {{date .To}}, {{.Samples}} samples</p>
+<table cellpadding="4" style="border-collapse:collapse;" border="1" bordercolor="#ddd">
+<tr style="background:#f4f4f4;"><th align="left">Metric</th><th>Min</th><th>Avg</th><th>Max</th></tr>
+<tr><td>CPU %</td><td>{{printf "%.1f" .CPU.Min}}</td><td>{{printf "%.1f" .CPU.Avg}}</td><td>{{printf "%.1f" .CPU.Max}}</td></tr>
+<tr><td>Memory %</td><td>{{printf "%.1f" .Mem.Min}}</td><td>{{printf "%.1f" .Mem.Avg}}</td><td>{{printf "%.1f" .Mem.Max}}</td></tr>
+<tr><td>Swap %</td><td>{{printf "%.1f" .Swap.Min}}</td><td>{{printf "%.1f" .Swap.Avg}}</td><td>{{printf "%.1f" .Swap.Max}}</td></tr>
+<tr><td>Load 1m</td><td>{{printf "%.2f" .Load.Min}}</td><td>{{printf "%.2f" .Load.Avg}}</td><td>{{printf "%.2f" .Load.Max}}</td></tr>
+</table>
+<p><b>Disk:</b> {{printf "%.1f" .DiskStart}}% &rarr; {{printf "%.1f" .DiskEnd}}% ({{printf "%+.2f" .DiskGrowth}} pts) &nbsp; <b>Network:</b> {{bytes .NetDown}} down / {{bytes .NetUp}} up</p>
+<p style="margin-bottom:2px;"><b>Alerts:</b> {{range $l, $n := .Alerts}}{{$l}} {{$n}} &nbsp; {{else}}none{{end}}</p>
+{{if .TopAlerts}}<p style="margin-top:0;color:#666;">{{range $m, $n := .TopAlerts}}{{$m}} ({{$n}}) &nbsp; {{end}}</p>{{end}}
+{{if .TopProcs}}<p style="margin-bottom:2px;"><b>Top processes</b></p>
+<table cellpadding="3" style="border-collapse:collapse;">{{range .TopProcs}}<tr><td>{{.Name}}</td><td>{{printf "%.1f" .AvgCPU}}% CPU avg</td><td>{{mem .MaxMem}} mem peak</td></tr>{{end}}</table>{{end}}
+{{if .Plugins}}<p style="margin-bottom:2px;"><b>Checks</b></p>
+<table cellpadding="3" style="border-collapse:collapse;">{{range .Plugins}}<tr><td>{{.Name}}</td><td>{{.Status}}</td><td>{{printf "%.1f" .OkPct}}% OK</td><td style="color:#666;">{{.Output}}</td></tr>{{end}}</table>{{end}}
+</div>`))
+
+func digestText(d Digest) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Pulse %s report: %s (%d samples)\n", d.Period, d.Host, d.Samples)
+	fmt.Fprintf(&b, "CPU %.1f/%.1f/%.1f  Mem %.1f/%.1f/%.1f  Load %.2f/%.2f/%.2f (min/avg/max)\n", d.CPU.Min, d.CPU.Avg, d.CPU.Max, d.Mem.Min, d.Mem.Avg, d.Mem.Max, d.Load.Min, d.Load.Avg, d.Load.Max)
+	fmt.Fprintf(&b, "Disk %.1f%% -> %.1f%%  Net %s down / %s up\n", d.DiskStart, d.DiskEnd, fmtBytes(d.NetDown), fmtBytes(d.NetUp))
+	fmt.Fprintf(&b, "Alerts: %v\n", d.Alerts)
+	for _, p := range d.TopProcs { fmt.Fprintf(&b, "  %s %.1f%% CPU\n", p.Name, p.AvgCPU) }
+	for _, p := range d.Plugins { fmt.Fprintf(&b, "  [%s] %s %.1f%% OK\n", p.Status, p.Name, p.OkPct) }
+	return b.String()
+}
+
+func sendDigest(cfg AppConfig, period string) error {
+	to := cfg.DigestEmailTo
+	if to == "" { to = cfg.EmailTo }
+	if cfg.DigestWebhook == "" && (cfg.SmtpHost == "" || to == "") { return errNotConfigured }
+	d := buildDigest(period)
+	var errs []string
+	if cfg.DigestWebhook != "" {
+		if err := postJSON(cfg.DigestWebhook, d); err != nil { errs = append(errs, "webhook: "+err.Error()) }
+	}
+	if cfg.SmtpHost != "" && to != "" {
+		var body bytes.Buffer
+		digestTemplate.Execute(&body, d)
+		// A chart of CPU and memory over the period, sent inline.
+		var series []chartSeries
+		for _, f := range []string{"cpu_tot", "mem_used"} { if s, err := chartField(cfg, f); err == nil { series = append(series, s) } }
+		img := mailImage{"digest@pulse", chartPNG(series, chartTitle(series), d.From, d.To, 600, 180)}
+		body.WriteString(`<p style="font-family:Segoe UI,Arial,sans-serif;font-size:13px;color:#666;margin:12px 0 2px;">CPU and memory</p><img src="cid:digest@pulse" width="600" height="180" alt="CPU and memory">`)
+		subject := fmt.Sprintf("Pulse %s report: %s", period, d.Host)
+		if err := sendMail(cfg, emailRecipients(to), subject, body.String(), digestText(d), img); err != nil { errs = append(errs, "email: "+err.Error()) }
+	}
+	if len(errs) > 0 { return fmt.Errorf("%s", strings.Join(errs, "; ")) }
+	return nil
+}
+
+// startDigest checks once a minute whether the configured send time has come.
+func startDigest() {
+	last := ""
+	for now := range time.Tick(time.Minute) {
+		cfgMutex.RLock(); cfg := config; cfgMutex.RUnlock()
+		if cfg.DigestSchedule == "" { continue }
+		at := cfg.DigestTime
+		if at == "" { at = "08:00" }
+		if now.Format("15:04") != at { continue }
+		if cfg.DigestSchedule == "weekly" {
+			day := cfg.DigestDay
+			if day == "" { day = "mon" }
+			if !strings.HasPrefix(strings.ToLower(now.Weekday().String()), strings.ToLower(day)) { continue }
+		}
+		if stamp := now.Format("2006-01-02 15:04"); stamp != last {
+			last = stamp
+			if err := sendDigest(cfg, cfg.DigestSchedule); err != nil { alertLog.Error("digest failed", "err", redactError(cfg, err)) }
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+// --- MOUNTS & DISKS ---
+// Every sample keeps usage per mount (Mounts) and throughput per block device (Disks), so history,
+// exports and the dashboard can show any filesystem or device, not just "/" and the machine total.
+// /api/v1/mounts and /api/v1/disks list them with live figures.
+
+type DiskIO struct {
+	Name  string  `json:"name"`
+	Read  uint64  `json:"read"`  // bytes/s
+	Write uint64  `json:"write"` // bytes/s
+	Busy  float64 `json:"busy"`  // % of the interval with I/O in flight (Linux)
+}
+
+type MountInfo struct {
+	MountUsage
+	Device    string  `json:"device"`
+	Fstype    string  `json:"fstype"`
+	Free      uint64  `json:"free"`
+	InodesPct float64 `json:"inodes_pct"`
+	ReadOnly  bool    `json:"read_only"`
+}
+
+var (
+	mountParts []disk.PartitionStat // the filesystems in mountList
+	mountMutex sync.Mutex
+	prevDisk   map[string]disk.IOCountersStat
+	prevDiskAt time.Time
+)
+
+// diskRates turns the cumulative per-device counters into rates since the previous sample.
+// Loop and RAM devices are left out; the first call only records the counters.
+func diskRates(io map[string]disk.IOCountersStat) []DiskIO {
+	now := time.Now()
+	secs := now.Sub(prevDiskAt).Seconds()
+	var out []DiskIO
+	for name, c := range io {
+		if strings.HasPrefix(name, "loop") || strings.HasPrefix(name, "ram") { continue }
+		p, ok := prevDisk[name]
+		if !ok || secs <= 0 || c.ReadBytes < p.ReadBytes || c.WriteBytes < p.WriteBytes { continue }
+		busy := float64(c.IoTime-p.IoTime) / (secs * 10)
+		if c.IoTime < p.IoTime { busy = 0 }
+		out = append(out, DiskIO{name, uint64(float64(c.ReadBytes-p.ReadBytes) / secs), uint64(float64(c.WriteBytes-p.WriteBytes) / secs), min(busy, 100)})
+	}
+	prevDisk, prevDiskAt = io, now
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// mountDetails reads every real filesystem now, with device, type and inode usage.
+func mountDetails() []MountInfo {
+	mountMutex.Lock(); parts := mountParts; mountMutex.Unlock()
+	out := []MountInfo{}
+	for _, p := range parts {
+		u, err := disk.Usage(p.Mountpoint)
+		if err != nil || u.Total == 0 { continue }
+		ro := false
+		for _, o := range p.Opts { ro = ro || o == "ro" }
+		out = append(out, MountInfo{MountUsage{p.Mountpoint, u.Used + u.Free, u.Used, u.UsedPercent}, p.Device, p.Fstype, u.Free, u.InodesUsedPercent, ro})
+	}
+	return out
+}
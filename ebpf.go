@@ -0,0 +1,130 @@
+package main
+
+import (
+	"maps"
+	"net/http"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// --- EBPF COLLECTORS ---
+// "ebpf": ["exec", "retransmits", "disk_latency"] in pulse.conf loads small eBPF programs on kernel
+// tracepoints (Linux) for what sampling /proc can't see: every process started, however briefly
+// it ran; TCP retransmits per connection and owning process; and a latency histogram per disk.
+// The programs are assembled at start from the tracepoint layouts in tracefs, so no compiler or
+// kernel headers are needed. They need root (or --run-as, which then keeps CAP_BPF and
+// CAP_PERFMON) and tracefs mounted. Each shows as a dashboard panel and in GET /api/v1/ebpf.
+
+var ebpfCollectors = []string{"exec", "retransmits", "disk_latency"}
+
+// ebpfPanelIDs are the dashboard panels of each collector; they join the default layout when it's on.
+var ebpfPanelIDs = map[string]string{"exec": "exec-snoop", "retransmits": "tcp-retrans", "disk_latency": "disk-latency"}
+
+type execEvent struct {
+	Time int64  `json:"time"`
+	PID  uint32 `json:"pid"`
+	PPID int32  `json:"ppid,omitempty"` // 0 when the process was gone before Pulse looked
+	UID  uint32 `json:"uid"`
+	Comm string `json:"comm"`
+}
+
+type retransStat struct {
+	PID    int32  `json:"pid,omitempty"`
+	Name   string `json:"name,omitempty"`
+	Local  string `json:"local"`
+	Remote string `json:"remote"`
+	Total  uint64 `json:"total"`  // since the collector started
+	Recent uint64 `json:"recent"` // in the last minute
+}
+
+type diskLatency struct {
+	Device  string   `json:"device"`
+	Count   uint64   `json:"count"`   // requests in the last minute
+	P50     float64  `json:"p50_us"`  // upper bound of the bucket holding the median
+	P99     float64  `json:"p99_us"`
+	Buckets []uint64 `json:"buckets"` // last minute; bucket i counts requests that took 2^i to 2^(i+1) µs
+}
+
+type ebpfReport struct {
+	Enabled     []string          `json:"enabled"`
+	Errors      map[string]string `json:"errors,omitempty"`
+	Execs       []execEvent       `json:"execs"`
+	Retransmits []retransStat     `json:"retransmits"`
+	DiskLatency []diskLatency     `json:"disk_latency"`
+}
+
+const (
+	maxExecEvents = 200
+	ebpfPoll      = 5 * time.Second
+	ebpfWindow    = 12 // polls in "the last minute"
+)
+
+var (
+	ebpfMutex sync.Mutex
+	ebpfState = ebpfReport{Errors: map[string]string{}}
+)
+
+func handleEBPF(w http.ResponseWriter, r *http.Request) {
+	ebpfMutex.Lock()
+	rep := ebpfState
+	rep.Errors = maps.Clone(ebpfState.Errors)
+	rep.Execs = slices.Clone(ebpfState.Execs)
+	slices.Reverse(rep.Execs) // newest first
+	ebpfMutex.Unlock()
+	apiOK(w, 200, rep, nil)
+}
+
+func noteExec(e execEvent) {
+	ebpfMutex.Lock()
+	ebpfState.Execs = append(ebpfState.Execs, e)
+	if n := len(ebpfState.Execs); n > maxExecEvents { ebpfState.Execs = slices.Delete(ebpfState.Execs, 0, n-maxExecEvents) }
+	ebpfMutex.Unlock()
+}
+
+// runEBPF loads what the config asks for, again whenever that changes, and collects every few seconds.
+func runEBPF() {
+	var loaded []string
+	defer ebpfClose()
+	for {
+		cfgMutex.RLock(); want := slices.Clone(config.EBPF); cfgMutex.RUnlock()
+		sort.Strings(want); want = slices.Compact(want)
+		if !slices.Equal(want, loaded) {
+			errs := ebpfLoad(want)
+			ebpfMutex.Lock()
+			ebpfState = ebpfReport{Enabled: want, Errors: map[string]string{}}
+			for k, err := range errs { ebpfState.Errors[k] = err.Error(); collectorLog.Warn("eBPF collector not loaded", "collector", k, "err", err) }
+			ebpfMutex.Unlock()
+			if len(want) > 0 && len(errs) > 0 { noteCap("ebpf", collectorCap{OK: len(errs) < len(want), Partial: true, Note: "some eBPF collectors couldn't load; see /api/v1/ebpf"}) } else if len(want) > 0 { noteCap("ebpf", collectorCap{OK: true}) }
+			loaded = want
+		}
+		if len(loaded) > 0 { ebpfCollect() }
+		select {
+		case <-stopCtx.Done(): return
+		case <-time.After(ebpfPoll):
+		}
+	}
+}
+
+// counterWindow turns cumulative counters into how much each grew over the last ebpfWindow polls.
+type counterWindow struct{ snaps []map[string]uint64 }
+
+func (w *counterWindow) push(cur map[string]uint64) map[string]uint64 {
+	w.snaps = append(w.snaps, cur)
+	if len(w.snaps) > ebpfWindow+1 { w.snaps = w.snaps[1:] }
+	old, delta := w.snaps[0], map[string]uint64{}
+	for k, v := range cur { if v >= old[k] { delta[k] = v - old[k] } }
+	return delta
+}
+
+// histPercentile returns the upper bound in µs of the bucket where the p-th fraction is reached.
+func histPercentile(b []uint64, total uint64, p float64) float64 {
+	if total == 0 { return 0 }
+	var seen uint64
+	for i, n := range b {
+		seen += n
+		if float64(seen) >= p*float64(total) { return float64(uint64(1) << (i + 1)) }
+	}
+	return float64(uint64(1) << len(b))
+}
@@ -0,0 +1,376 @@
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/asm"
+	"github.com/cilium/ebpf/link"
+	"github.com/cilium/ebpf/ringbuf"
+	"github.com/cilium/ebpf/rlimit"
+	"github.com/shirou/gopsutil/v3/net"
+)
+
+// The programs are written with the asm package against field offsets read from each tracepoint's
+// format file, which is what keeps them independent of kernel headers and BTF.
+
+var ebpfObjs struct {
+	sync.Mutex
+	closers  []io.Closer
+	retrans  *ebpf.Map // {sport, dport u16; saddr, daddr [16]byte} -> retransmits
+	diskHist *ebpf.Map // {dev, log2 µs u32} -> requests
+}
+
+var (
+	retransWin counterWindow
+	diskWin    counterWindow
+	blockNames = map[uint32]string{}
+)
+
+const ebpfLicense = "Dual MIT/GPL"
+
+var tracefsDirs = []string{"/sys/kernel/tracing/events", "/sys/kernel/debug/tracing/events"}
+
+// tpFields returns the offset of each field of a tracepoint's record.
+func tpFields(group, name string) (map[string]int16, error) {
+	var b []byte
+	var err error
+	for _, d := range tracefsDirs {
+		if b, err = os.ReadFile(d + "/" + group + "/" + name + "/format"); err == nil { break }
+	}
+	if err != nil { return nil, fmt.Errorf("tracepoint %s/%s: %w (is tracefs mounted?)", group, name, err) }
+	fields := map[string]int16{}
+	for _, line := range strings.Split(string(b), "\n") {
+		decl, rest, ok := strings.Cut(strings.TrimSpace(line), ";")
+		if !ok || !strings.HasPrefix(decl, "field:") { continue }
+		f := strings.Fields(decl)
+		id := f[len(f)-1]
+		if i := strings.IndexByte(id, '['); i >= 0 { id = id[:i] }
+		if off, ok := strings.CutPrefix(strings.TrimSpace(strings.Split(rest, ";")[0]), "offset:"); ok {
+			n, _ := strconv.Atoi(off)
+			fields[id] = int16(n)
+		}
+	}
+	return fields, nil
+}
+
+func needFields(group, name string, want ...string) (map[string]int16, error) {
+	f, err := tpFields(group, name)
+	if err != nil { return nil, err }
+	for _, w := range want {
+		if _, ok := f[w]; !ok { return nil, fmt.Errorf("tracepoint %s/%s has no field %s on this kernel", group, name, w) }
+	}
+	return f, nil
+}
+
+func ebpfLoad(names []string) map[string]error {
+	ebpfClose()
+	errs := map[string]error{}
+	if len(names) == 0 { return errs }
+	if err := rlimit.RemoveMemlock(); err != nil {
+		for _, n := range names { errs[n] = err }
+		return errs
+	}
+	loaders := map[string]func() error{"exec": loadExecSnoop, "retransmits": loadRetransmits, "disk_latency": loadDiskLatency}
+	for _, n := range names {
+		if err := loaders[n](); err != nil {
+			if errors.Is(err, os.ErrPermission) { err = fmt.Errorf("%w: needs root, or CAP_BPF and CAP_PERFMON", err) }
+			errs[n] = err
+		}
+	}
+	return errs
+}
+
+func ebpfClose() {
+	ebpfObjs.Lock(); defer ebpfObjs.Unlock()
+	for i := len(ebpfObjs.closers) - 1; i >= 0; i-- { ebpfObjs.closers[i].Close() }
+	ebpfObjs.closers, ebpfObjs.retrans, ebpfObjs.diskHist = nil, nil, nil
+	retransWin, diskWin = counterWindow{}, counterWindow{}
+}
+
+// attach loads insns and hooks them to a tracepoint; everything created is closed by ebpfClose.
+func attach(group, name string, insns asm.Instructions, maps ...*ebpf.Map) error {
+	keep := func(c io.Closer) { ebpfObjs.Lock(); ebpfObjs.closers = append(ebpfObjs.closers, c); ebpfObjs.Unlock() }
+	for _, m := range maps { keep(m) }
+	prog, err := ebpf.NewProgram(&ebpf.ProgramSpec{Type: ebpf.TracePoint, License: ebpfLicense, Instructions: insns})
+	if err != nil { return fmt.Errorf("%s/%s: %w", group, name, err) }
+	keep(prog)
+	l, err := link.Tracepoint(group, name, prog, nil)
+	if err != nil { return fmt.Errorf("%s/%s: %w", group, name, err) }
+	keep(l)
+	return nil
+}
+
+// mapAdd emits *map[key at fp+keyOff] += 1, creating the entry when missing.
+func mapAdd(m *ebpf.Map, keyOff, valOff int16, label string) asm.Instructions {
+	return asm.Instructions{
+		asm.LoadMapPtr(asm.R1, m.FD()),
+		asm.Mov.Reg(asm.R2, asm.RFP), asm.Add.Imm(asm.R2, int32(keyOff)),
+		asm.FnMapLookupElem.Call(),
+		asm.JEq.Imm(asm.R0, 0, label+"_new"),
+		asm.Mov.Imm(asm.R1, 1),
+		asm.StoreXAdd(asm.R0, asm.R1, asm.DWord),
+		asm.Ja.Label(label + "_done"),
+		asm.StoreImm(asm.RFP, valOff, 1, asm.DWord).WithSymbol(label + "_new"),
+		asm.LoadMapPtr(asm.R1, m.FD()),
+		asm.Mov.Reg(asm.R2, asm.RFP), asm.Add.Imm(asm.R2, int32(keyOff)),
+		asm.Mov.Reg(asm.R3, asm.RFP), asm.Add.Imm(asm.R3, int32(valOff)),
+		asm.Mov.Imm(asm.R4, 0), // BPF_ANY
+		asm.FnMapUpdateElem.Call(),
+		asm.Mov.Imm(asm.R0, 0).WithSymbol(label + "_done"),
+	}
+}
+
+// --- exec: sched/sched_process_exec -> {pid, uid u32; comm [16]byte} on a ring buffer ---
+
+func loadExecSnoop() error {
+	f, err := needFields("sched", "sched_process_exec", "pid")
+	if err != nil { return err }
+	events, err := ebpf.NewMap(&ebpf.MapSpec{Name: "pulse_execs", Type: ebpf.RingBuf, MaxEntries: 64 << 10})
+	if err != nil { return err }
+	insns := asm.Instructions{
+		asm.LoadMem(asm.R0, asm.R1, f["pid"], asm.Word),
+		asm.StoreMem(asm.RFP, -24, asm.R0, asm.Word),
+		asm.FnGetCurrentUidGid.Call(),
+		asm.StoreMem(asm.RFP, -20, asm.R0, asm.Word),
+		asm.Mov.Reg(asm.R1, asm.RFP), asm.Add.Imm(asm.R1, -16),
+		asm.Mov.Imm(asm.R2, 16),
+		asm.FnGetCurrentComm.Call(),
+		asm.LoadMapPtr(asm.R1, events.FD()),
+		asm.Mov.Reg(asm.R2, asm.RFP), asm.Add.Imm(asm.R2, -24),
+		asm.Mov.Imm(asm.R3, 24),
+		asm.Mov.Imm(asm.R4, 0),
+		asm.FnRingbufOutput.Call(),
+		asm.Mov.Imm(asm.R0, 0),
+		asm.Return(),
+	}
+	if err := attach("sched", "sched_process_exec", insns, events); err != nil { return err }
+	rd, err := ringbuf.NewReader(events)
+	if err != nil { return err }
+	ebpfObjs.Lock(); ebpfObjs.closers = append(ebpfObjs.closers, rd); ebpfObjs.Unlock()
+	go func() {
+		for {
+			rec, err := rd.Read()
+			if err != nil { return } // closed
+			b := rec.RawSample
+			if len(b) < 24 { continue }
+			pid := binary.NativeEndian.Uint32(b)
+			comm, _, _ := bytes.Cut(b[8:24], []byte{0})
+			noteExec(execEvent{Time: time.Now().Unix(), PID: pid, PPID: parentPID(pid), UID: binary.NativeEndian.Uint32(b[4:]), Comm: string(comm)})
+		}
+	}()
+	return nil
+}
+
+func parentPID(pid uint32) int32 {
+	b, err := os.ReadFile("/proc/" + strconv.Itoa(int(pid)) + "/stat")
+	if err != nil { return 0 }
+	rp := bytes.LastIndexByte(b, ')')
+	if rp < 0 { return 0 }
+	f := strings.Fields(string(b[rp+1:]))
+	if len(f) < 2 { return 0 }
+	n, _ := strconv.Atoi(f[1])
+	return int32(n)
+}
+
+// --- retransmits: tcp/tcp_retransmit_skb, counted per connection ---
+
+const retransKeySize = 36
+
+func loadRetransmits() error {
+	f, err := needFields("tcp", "tcp_retransmit_skb", "sport", "dport", "saddr_v6", "daddr_v6")
+	if err != nil { return err }
+	m, err := ebpf.NewMap(&ebpf.MapSpec{Name: "pulse_retrans", Type: ebpf.LRUHash, KeySize: retransKeySize, ValueSize: 8, MaxEntries: 4096})
+	if err != nil { return err }
+	// The addresses are IPv4-mapped for IPv4 sockets. Tracepoint records may only be read at
+	// aligned offsets and saddr_v6 isn't 4-aligned, so the key is copied 2 bytes at a time.
+	const key = -40
+	var insns asm.Instructions
+	copy16 := func(src, dst int16) {
+		insns = append(insns, asm.LoadMem(asm.R0, asm.R1, src, asm.Half), asm.StoreMem(asm.RFP, dst, asm.R0, asm.Half))
+	}
+	copy16(f["sport"], key)
+	copy16(f["dport"], key+2)
+	for i := int16(0); i < 16; i += 2 { copy16(f["saddr_v6"]+i, key+4+i); copy16(f["daddr_v6"]+i, key+20+i) }
+	insns = append(insns, mapAdd(m, key, -48, "count")...)
+	insns = append(insns, asm.Return())
+	if err := attach("tcp", "tcp_retransmit_skb", insns, m); err != nil { return err }
+	ebpfObjs.Lock(); ebpfObjs.retrans = m; ebpfObjs.Unlock()
+	return nil
+}
+
+// --- disk_latency: block/block_rq_issue to block/block_rq_complete, as a log2 histogram ---
+
+func loadDiskLatency() error {
+	issue, err := needFields("block", "block_rq_issue", "dev", "sector")
+	if err != nil { return err }
+	done, err := needFields("block", "block_rq_complete", "dev", "sector")
+	if err != nil { return err }
+	start, err := ebpf.NewMap(&ebpf.MapSpec{Name: "pulse_rq_start", Type: ebpf.LRUHash, KeySize: 16, ValueSize: 8, MaxEntries: 16384})
+	if err != nil { return err }
+	hist, err := ebpf.NewMap(&ebpf.MapSpec{Name: "pulse_rq_hist", Type: ebpf.Hash, KeySize: 8, ValueSize: 8, MaxEntries: 2048})
+	if err != nil { start.Close(); return err }
+	// Both programs key a request by {dev u32, pad u32, sector u64} at fp-16.
+	rqKey := func(f map[string]int16) asm.Instructions {
+		return asm.Instructions{
+			asm.Mov.Reg(asm.R6, asm.R1),
+			asm.LoadMem(asm.R0, asm.R6, f["dev"], asm.Word),
+			asm.StoreMem(asm.RFP, -16, asm.R0, asm.Word),
+			asm.StoreImm(asm.RFP, -12, 0, asm.Word),
+			asm.LoadMem(asm.R0, asm.R6, f["sector"], asm.DWord),
+			asm.StoreMem(asm.RFP, -8, asm.R0, asm.DWord),
+		}
+	}
+	onIssue := append(rqKey(issue),
+		asm.FnKtimeGetNs.Call(),
+		asm.StoreMem(asm.RFP, -24, asm.R0, asm.DWord),
+		asm.LoadMapPtr(asm.R1, start.FD()),
+		asm.Mov.Reg(asm.R2, asm.RFP), asm.Add.Imm(asm.R2, -16),
+		asm.Mov.Reg(asm.R3, asm.RFP), asm.Add.Imm(asm.R3, -24),
+		asm.Mov.Imm(asm.R4, 0),
+		asm.FnMapUpdateElem.Call(),
+		asm.Mov.Imm(asm.R0, 0),
+		asm.Return(),
+	)
+	onDone := append(rqKey(done),
+		asm.LoadMapPtr(asm.R1, start.FD()),
+		asm.Mov.Reg(asm.R2, asm.RFP), asm.Add.Imm(asm.R2, -16),
+		asm.FnMapLookupElem.Call(),
+		asm.JEq.Imm(asm.R0, 0, "exit"),
+		asm.LoadMem(asm.R7, asm.R0, 0, asm.DWord),
+		asm.LoadMapPtr(asm.R1, start.FD()),
+		asm.Mov.Reg(asm.R2, asm.RFP), asm.Add.Imm(asm.R2, -16),
+		asm.FnMapDeleteElem.Call(),
+		asm.FnKtimeGetNs.Call(),
+		asm.Sub.Reg(asm.R0, asm.R7),
+		asm.Div.Imm(asm.R0, 1000),
+		// log2 by halving: r1 ends as the index of the highest set bit, capped at 31.
+		asm.Mov.Imm(asm.R1, 0),
+		asm.Mov.Reg(asm.R2, asm.R0), asm.RSh.Imm(asm.R2, 32),
+		asm.JEq.Imm(asm.R2, 0, "log16"),
+		asm.Mov.Imm32(asm.R0, -1),
+	)
+	for _, s := range []int32{16, 8, 4, 2, 1} {
+		onDone = append(onDone,
+			asm.JLT.Imm(asm.R0, 1<<s, fmt.Sprintf("log%d", s/2)).WithSymbol(fmt.Sprintf("log%d", s)),
+			asm.RSh.Imm(asm.R0, s),
+			asm.Add.Imm(asm.R1, s),
+		)
+	}
+	onDone = append(onDone,
+		asm.LoadMem(asm.R0, asm.RFP, -16, asm.Word).WithSymbol("log0"),
+		asm.StoreMem(asm.RFP, -32, asm.R0, asm.Word),
+		asm.StoreMem(asm.RFP, -28, asm.R1, asm.Word),
+	)
+	onDone = append(onDone, mapAdd(hist, -32, -40, "hist")...)
+	onDone = append(onDone, asm.Mov.Imm(asm.R0, 0).WithSymbol("exit"), asm.Return())
+	if err := attach("block", "block_rq_issue", onIssue, start, hist); err != nil { return err }
+	if err := attach("block", "block_rq_complete", onDone); err != nil { return err }
+	ebpfObjs.Lock(); ebpfObjs.diskHist = hist; ebpfObjs.Unlock()
+	return nil
+}
+
+// blockName turns a kernel dev_t (major<<20 | minor) into the disk's name.
+func blockName(dev uint32) string {
+	if n, ok := blockNames[dev]; ok { return n }
+	id := fmt.Sprintf("%d:%d", dev>>20, dev&(1<<20-1))
+	name := id
+	if b, err := os.ReadFile("/sys/dev/block/" + id + "/uevent"); err == nil {
+		for _, line := range strings.Split(string(b), "\n") { if v, ok := strings.CutPrefix(line, "DEVNAME="); ok { name = v } }
+	}
+	blockNames[dev] = name
+	return name
+}
+
+func ebpfCollect() {
+	ebpfObjs.Lock(); retrans, hist := ebpfObjs.retrans, ebpfObjs.diskHist; ebpfObjs.Unlock()
+	var rs []retransStat
+	var dl []diskLatency
+	if retrans != nil { rs = collectRetransmits(retrans) }
+	if hist != nil { dl = collectDiskLatency(hist) }
+	ebpfMutex.Lock()
+	ebpfState.Retransmits, ebpfState.DiskLatency = rs, dl
+	ebpfMutex.Unlock()
+}
+
+func collectRetransmits(m *ebpf.Map) []retransStat {
+	var key [retransKeySize]byte
+	var n uint64
+	totals := map[string]uint64{}
+	conns := map[string][2]string{}
+	it := m.Iterate()
+	for it.Next(&key, &n) {
+		local := netip.AddrPortFrom(netip.AddrFrom16([16]byte(key[4:20])).Unmap(), binary.NativeEndian.Uint16(key[0:]))
+		remote := netip.AddrPortFrom(netip.AddrFrom16([16]byte(key[20:36])).Unmap(), binary.NativeEndian.Uint16(key[2:]))
+		k := local.String() + ">" + remote.String()
+		totals[k], conns[k] = n, [2]string{local.String(), remote.String()}
+	}
+	recent := retransWin.push(totals)
+	if len(totals) == 0 { return []retransStat{} }
+	// Retransmits happen in softirq context, so the owning process comes from the socket table.
+	owners := map[string]int32{}
+	if cs, err := net.Connections("tcp"); err == nil {
+		for _, c := range cs {
+			l := netip.AddrPortFrom(netip.MustParseAddr(orUnspecified(c.Laddr.IP)).Unmap(), uint16(c.Laddr.Port))
+			r := netip.AddrPortFrom(netip.MustParseAddr(orUnspecified(c.Raddr.IP)).Unmap(), uint16(c.Raddr.Port))
+			owners[l.String()+">"+r.String()] = c.Pid
+		}
+	}
+	out := make([]retransStat, 0, len(totals))
+	for k, t := range totals {
+		s := retransStat{Local: conns[k][0], Remote: conns[k][1], Total: t, Recent: recent[k], PID: owners[k]}
+		if s.PID > 0 {
+			if b, err := os.ReadFile("/proc/" + strconv.Itoa(int(s.PID)) + "/comm"); err == nil { s.Name = strings.TrimSpace(string(b)) }
+		}
+		out = append(out, s)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Recent != out[j].Recent { return out[i].Recent > out[j].Recent }
+		return out[i].Total > out[j].Total
+	})
+	return out[:min(len(out), 50)]
+}
+
+func orUnspecified(ip string) string {
+	if _, err := netip.ParseAddr(ip); err != nil { return "::" }
+	return ip
+}
+
+func collectDiskLatency(m *ebpf.Map) []diskLatency {
+	var key [2]uint32
+	var n uint64
+	totals := map[string]uint64{}
+	it := m.Iterate()
+	for it.Next(&key, &n) { totals[fmt.Sprintf("%d/%d", key[0], key[1])] = n }
+	recent := diskWin.push(totals)
+	byDev := map[uint32]*diskLatency{}
+	for k, v := range recent {
+		var dev, bucket uint32
+		fmt.Sscanf(k, "%d/%d", &dev, &bucket)
+		d := byDev[dev]
+		if d == nil { d = &diskLatency{Device: blockName(dev)}; byDev[dev] = d }
+		for len(d.Buckets) <= int(bucket) { d.Buckets = append(d.Buckets, 0) }
+		d.Buckets[bucket] += v
+		d.Count += v
+	}
+	out := make([]diskLatency, 0, len(byDev))
+	for _, d := range byDev {
+		d.P50, d.P99 = histPercentile(d.Buckets, d.Count, 0.5), histPercentile(d.Buckets, d.Count, 0.99)
+		out = append(out, *d)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Device < out[j].Device })
+	return out
+}
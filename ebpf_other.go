@@ -0,0 +1,15 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+func ebpfLoad(names []string) map[string]error {
+	errs := map[string]error{}
+	for _, n := range names { errs[n] = errors.New("eBPF collectors need Linux") }
+	return errs
+}
+
+func ebpfCollect() {}
+
+func ebpfClose() {}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	htmltpl "html/template"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// --- EMAIL ---
+// email_to takes a comma separated list. smtp_tls is "tls" (implicit, port 465), "starttls", "none",
+// or empty to pick by port and upgrade when the server offers STARTTLS.
+// Subject and body can be replaced with Go templates; the body is HTML with a plain-text fallback.
+
+const defaultEmailSubject = `{{if eq .Level "OK"}}Pulse Recovery: {{.Monitor}}{{else}}Pulse Alert: {{.Level}} {{.Monitor}}{{end}}`
+
+const defaultEmailBody = `<div style="font-family:Segoe UI,Arial,sans-serif;font-size:13px;color:#222;">
+<h2 style="margin:0 0 8px;color:{{.Color}};">{{.Title}}</h2>
+<table cellpadding="4" style="border-collapse:collapse;">
+<tr><td><b>Monitor</b></td><td>{{.Monitor}}</td></tr>
+<tr><td><b>Status</b></td><td style="color:{{.Color}};">{{.Level}}</td></tr>
+<tr><td><b>Value</b></td><td>{{printf "%.2f" .Value}}</td></tr>
+<tr><td><b>Host</b></td><td>{{.Host}}{{with .Meta.Environment}} ({{.}}){{end}}</td></tr>
+{{with .Meta.Owner}}<tr><td><b>Owner</b></td><td>{{.}}</td></tr>{{end}}
+<tr><td><b>Time</b></td><td>{{.When}}</td></tr>
+{{if .Message}}<tr><td valign="top"><b>Message</b></td><td><pre style="margin:0;white-space:pre-wrap;">{{.Message}}</pre></td></tr>{{end}}
+</table>
+{{if .ChartImage}}<p style="margin:12px 0 2px;color:#666;">{{.ChartLabel}}, last 6 hours</p><img src="{{.ChartImage}}" width="600" height="180" alt="{{.ChartLabel}}">
+{{else if .Chart}}<p style="margin:12px 0 2px;color:#666;">{{.ChartLabel}}, last 30 minutes</p>{{.Chart}}{{end}}
+{{with .Metrics}}<p style="margin:12px 0 2px;color:#666;">Host summary</p>
+<table cellpadding="4" style="border-collapse:collapse;background:#f4f4f4;">
+<tr><td>CPU {{printf "%.1f" .CPUTotal}}%</td><td>Memory {{printf "%.1f" .MemUsed}}%</td><td>Disk {{printf "%.1f" .DiskUsed}}%</td><td>Load {{printf "%.2f" .Load1}}</td></tr>
+</table>{{end}}
+</div>`
+
+type emailData struct {
+	AlertEvent
+	Title      string
+	When       string
+	Color      string
+	Metrics    *RichMetrics
+	Meta       HostMeta
+	Chart      htmltpl.HTML
+	ChartImage htmltpl.URL // cid: of a PNG of the last 6 hours, sent along with the message
+	ChartLabel string
+}
+
+// mailImage is a picture sent inline with an HTML message, shown by <img src="cid:...">.
+type mailImage struct {
+	cid string
+	png []byte
+}
+
+const chartCID = "chart@pulse"
+
+func emailRecipients(list string) []string {
+	var out []string
+	for _, a := range strings.FieldsFunc(list, func(r rune) bool { return r == ',' || r == ';' }) {
+		if a = strings.TrimSpace(a); a != "" { out = append(out, a) }
+	}
+	return out
+}
+
+// seriesFor picks the history value charted for a monitor: the built-in metric or the plugin's perf value.
+func seriesFor(monitor string) (func(RichMetrics) (float64, bool), string) {
+	switch monitor {
+	case "CPU": return func(m RichMetrics) (float64, bool) { return m.CPUTotal, true }, "CPU %"
+	case "Memory": return func(m RichMetrics) (float64, bool) { return m.MemUsed, true }, "Memory %"
+	case "Disk": return func(m RichMetrics) (float64, bool) { return m.DiskUsed, true }, "Disk %"
+	}
+	return func(m RichMetrics) (float64, bool) {
+		for _, p := range m.Plugins { if p.Name == monitor || p.Path == monitor { return p.PerfVal, true } }
+		return 0, false
+	}, monitor
+}
+
+// sparkline renders history as a row of table-cell bars, which survives mail clients that strip SVG and images.
+func sparkline(f func(RichMetrics) (float64, bool), color string) htmltpl.HTML {
+	const bars, height = 60, 40
+	cut := time.Now().Add(-30 * time.Minute).Unix()
+	var vals []float64
+	historyMutex.RLock()
+	for i := history.Search(cut); i < history.Len(); i++ { if v, ok := f(*history.At(i)); ok { vals = append(vals, v) } }
+	historyMutex.RUnlock()
+	if len(vals) < 2 { return "" }
+	buckets := make([]float64, 0, bars)
+	for i := 0; i < bars && i < len(vals); i++ {
+		lo, hi := i*len(vals)/bars, (i+1)*len(vals)/bars
+		if len(vals) < bars { lo, hi = i, i+1 }
+		peak := vals[lo]
+		for _, v := range vals[lo:hi] { if v > peak { peak = v } }
+		buckets = append(buckets, peak)
+	}
+	max := 0.0
+	for _, v := range buckets { if v > max { max = v } }
+	if max <= 0 { max = 1 }
+	var b strings.Builder
+	b.WriteString(`<table cellpadding="0" cellspacing="1" style="border-collapse:separate;"><tr valign="bottom">`)
+	for _, v := range buckets {
+		fmt.Fprintf(&b, `<td title="%.2f" style="width:5px;height:%dpx;"><div style="height:%dpx;background:%s;font-size:0;line-height:0;">&nbsp;</div></td>`, v, height, 1+int(v/max*(height-1)), color)
+	}
+	fmt.Fprintf(&b, `</tr></table><span style="color:#999;font-size:11px;">peak %.2f</span>`, max)
+	return htmltpl.HTML(b.String())
+}
+
+func renderEmail(cfg AppConfig, ev AlertEvent) (subject, body string, imgs []mailImage, err error) {
+	st, bt := cfg.EmailSubject, cfg.EmailBody
+	if st == "" { st = defaultEmailSubject }
+	if bt == "" { bt = defaultEmailBody }
+	t := time.Unix(ev.Time, 0)
+	if ev.Time == 0 { t = time.Now() }
+	d := emailData{AlertEvent: ev, Title: alertTitle(ev), When: t.Format("2006-01-02 15:04:05 MST"), Meta: cfg.HostMeta,
+		Color: map[string]string{"CRITICAL": "#d32f2f", "WARNING": "#f57c00", "OK": "#388e3c"}[ev.Level]}
+	if d.Color == "" { d.Color = "#1976d2" }
+	latestMutex.RLock()
+	if latestMetric.Timestamp != 0 { m := latestMetric; d.Metrics = &m }
+	latestMutex.RUnlock()
+	var f func(RichMetrics) (float64, bool)
+	f, d.ChartLabel = seriesFor(ev.Monitor)
+	d.Chart = sparkline(f, d.Color)
+	var chart []byte
+	if d.Chart != "" {
+		now := time.Now().Unix()
+		chart = chartPNG([]chartSeries{{field: ev.Monitor, info: MetricInfo{Label: d.ChartLabel}, get: f}}, d.ChartLabel, now-6*3600, now, 600, 180)
+		d.ChartImage = "cid:" + chartCID
+	}
+
+	var sb, bb bytes.Buffer
+	tmpl, err := template.New("subject").Parse(st)
+	if err != nil { return "", "", nil, fmt.Errorf("email_subject: %w", err) }
+	if err = tmpl.Execute(&sb, d); err != nil { return "", "", nil, fmt.Errorf("email_subject: %w", err) }
+	htmlT, err := htmltpl.New("body").Parse(bt)
+	if err != nil { return "", "", nil, fmt.Errorf("email_body: %w", err) }
+	if err = htmlT.Execute(&bb, d); err != nil { return "", "", nil, fmt.Errorf("email_body: %w", err) }
+	// The chart goes along only when the body shows it.
+	if chart != nil && strings.Contains(bb.String(), "cid:"+chartCID) { imgs = []mailImage{{chartCID, chart}} }
+	return strings.TrimSpace(strings.ReplaceAll(sb.String(), "\n", " ")), bb.String(), imgs, nil
+}
+
+func notifyEmail(config AppConfig, ev AlertEvent) error {
+	if config.SmtpHost == "" { return errNotConfigured }
+	subject, body, imgs, err := renderEmail(config, ev)
+	if err != nil { return err }
+	text := fmt.Sprintf("Monitor: %s\nStatus: %s\nValue: %.2f\nMessage: %s\nHost: %s", ev.Monitor, ev.Level, ev.Value, ev.Message, ev.Host)
+	return sendMail(config, emailRecipients(config.EmailTo), subject, body, text, imgs...)
+}
+
+func smtpTLSConfig(cfg AppConfig) (*tls.Config, error) {
+	tc := &tls.Config{ServerName: cfg.SmtpHost, InsecureSkipVerify: cfg.SmtpSkipVerify}
+	if cfg.SmtpCA != "" {
+		pem, err := os.ReadFile(cfg.SmtpCA)
+		if err != nil { return nil, err }
+		tc.RootCAs = x509.NewCertPool()
+		if !tc.RootCAs.AppendCertsFromPEM(pem) { return nil, fmt.Errorf("smtp_ca: no certificates in %s", cfg.SmtpCA) }
+	}
+	return tc, nil
+}
+
+// sendMail delivers a multipart/alternative message; html may be empty for text-only mail.
+func sendMail(cfg AppConfig, to []string, subject, html, text string, imgs ...mailImage) error {
+	if len(to) == 0 { return errors.New("no recipients (email_to)") }
+	from := cfg.EmailFrom
+	if from == "" { from = cfg.SmtpUser }
+	port := cfg.SmtpPort
+	if port == 0 { port = 25 }
+	mode := cfg.SmtpTLS
+	if mode == "" && port == 465 { mode = "tls" }
+	tc, err := smtpTLSConfig(cfg)
+	if err != nil { return err }
+
+	addr := net.JoinHostPort(cfg.SmtpHost, fmt.Sprint(port))
+	dialer := &net.Dialer{Timeout: 15 * time.Second}
+	var conn net.Conn
+	if mode == "tls" { conn, err = tls.DialWithDialer(dialer, "tcp", addr, tc) } else { conn, err = dialer.Dial("tcp", addr) }
+	if err != nil { return err }
+	conn.SetDeadline(time.Now().Add(60 * time.Second))
+	c, err := smtp.NewClient(conn, cfg.SmtpHost)
+	if err != nil { conn.Close(); return err }
+	defer c.Close()
+	if mode != "tls" && mode != "none" {
+		if ok, _ := c.Extension("STARTTLS"); ok {
+			if err = c.StartTLS(tc); err != nil { return err }
+		} else if mode == "starttls" {
+			return errors.New("server does not offer STARTTLS")
+		}
+	}
+	if ok, _ := c.Extension("AUTH"); ok && cfg.SmtpUser != "" {
+		if err = c.Auth(smtp.PlainAuth("", cfg.SmtpUser, cfg.SmtpPass, cfg.SmtpHost)); err != nil { return err }
+	}
+	if err = c.Mail(addrOnly(from)); err != nil { return err }
+	for _, r := range to { if err = c.Rcpt(addrOnly(r)); err != nil { return fmt.Errorf("%s: %w", r, err) } }
+	w, err := c.Data()
+	if err != nil { return err }
+	if _, err = w.Write(buildMessage(from, to, subject, html, text, imgs...)); err != nil { return err }
+	if err = w.Close(); err != nil { return err }
+	return c.Quit()
+}
+
+// addrOnly strips a display name, "Pulse <pulse@example.com>" -> "pulse@example.com".
+func addrOnly(a string) string {
+	if i, j := strings.LastIndex(a, "<"), strings.LastIndex(a, ">"); i >= 0 && j > i { return a[i+1 : j] }
+	return strings.TrimSpace(a)
+}
+
+func buildMessage(from string, to []string, subject, html, text string, imgs ...mailImage) []byte {
+	var b bytes.Buffer
+	host, _ := os.Hostname()
+	fmt.Fprintf(&b, "From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\nMessage-ID: <%d.pulse@%s>\r\nMIME-Version: 1.0\r\n",
+		from, strings.Join(to, ", "), mime.QEncoding.Encode("utf-8", subject), time.Now().Format(time.RFC1123Z), time.Now().UnixNano(), host)
+	if html == "" {
+		fmt.Fprintf(&b, "Content-Type: text/plain; charset=utf-8\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\n")
+		qp := quotedprintable.NewWriter(&b); qp.Write([]byte(text)); qp.Close()
+		return b.Bytes()
+	}
+	mw := multipart.NewWriter(&b)
+	fmt.Fprintf(&b, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", mw.Boundary())
+	for _, p := range []struct{ typ, body string }{{"text/plain", text}, {"text/html", html}} {
+		// Quoted-printable keeps long HTML lines under the SMTP 998 character limit.
+		head := textproto.MIMEHeader{"Content-Type": {p.typ + "; charset=utf-8"}, "Content-Transfer-Encoding": {"quoted-printable"}}
+		if p.typ == "text/html" && len(imgs) > 0 {
+			// With pictures the HTML is multipart/related: the HTML first, then each picture by Content-ID.
+			boundary := multipart.NewWriter(io.Discard).Boundary()
+			rel, _ := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {"multipart/related; boundary=" + boundary}})
+			rw := multipart.NewWriter(rel)
+			rw.SetBoundary(boundary)
+			pw, _ := rw.CreatePart(head)
+			qp := quotedprintable.NewWriter(pw); qp.Write([]byte(p.body)); qp.Close()
+			for _, img := range imgs {
+				iw, _ := rw.CreatePart(textproto.MIMEHeader{"Content-Type": {"image/png"}, "Content-Transfer-Encoding": {"base64"},
+					"Content-ID": {"<" + img.cid + ">"}, "Content-Disposition": {`inline; filename="` + strings.Split(img.cid, "@")[0] + `.png"`}})
+				enc := base64.StdEncoding.EncodeToString(img.png)
+				for len(enc) > 76 { io.WriteString(iw, enc[:76]+"\r\n"); enc = enc[76:] }
+				io.WriteString(iw, enc)
+			}
+			rw.Close()
+			continue
+		}
+		pw, _ := mw.CreatePart(head)
+		qp := quotedprintable.NewWriter(pw); qp.Write([]byte(p.body)); qp.Close()
+	}
+	mw.Close()
+	return b.Bytes()
+}
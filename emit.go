@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"net"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- GRAPHITE & STATSD ---
+// Every metrics_interval seconds (Default: 10) the latest sample goes to graphite_addr as plaintext
+// ("<prefix>.cpu_tot 12.5 <ts>" over TCP) and/or to statsd_addr as gauges over UDP. Names are
+// <prefix>.<metric> with the prefix defaulting to pulse.<host>; custom monitors appear as
+// plugin.<name>.<label> and plugin.<name>.exit_code, mounts as mount.<path>.pct and block devices
+// as disk.<dev>.read|write|busy. metrics_whitelist limits what is sent to names matching one of
+// its glob patterns (e.g. "cpu_tot", "plugin.*").
+
+var (
+	graphiteConn net.Conn
+	graphiteAddr string
+	emitLast     time.Time
+	emitErrs     = make(map[string]string)
+	emitMutex    sync.Mutex
+	metricUnsafe = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+)
+
+// metricPart makes s usable as one dot-separated component of a Graphite/StatsD name.
+func metricPart(s string) string {
+	s = strings.Trim(metricUnsafe.ReplaceAllString(s, "_"), "_")
+	if s == "" { return "root" }
+	return s
+}
+
+func metricPrefix(c AppConfig, host string) string {
+	if c.MetricsPrefix != "" { return strings.TrimSuffix(c.MetricsPrefix, ".") }
+	return "pulse." + metricPart(host)
+}
+
+func metricAllowed(c AppConfig, name string) bool {
+	if len(c.MetricsWhitelist) == 0 { return true }
+	for _, p := range c.MetricsWhitelist { if ok, _ := path.Match(p, name); ok { return true } }
+	return false
+}
+
+type emitPoint struct {
+	name string
+	v    float64
+}
+
+func emitPoints(c AppConfig, m RichMetrics) []emitPoint {
+	var pts []emitPoint
+	sampleSeries(m, func(name string, labels [][2]string, v float64) {
+		l := map[string]string{}
+		for _, kv := range labels { l[kv[0]] = kv[1] }
+		switch name {
+		case "plugin_exit_code": name = "plugin." + metricPart(l["plugin"]) + ".exit_code"
+		case "plugin_value": name = "plugin." + metricPart(l["plugin"]) + "." + metricPart(cmp.Or(l["label"], "value"))
+		case "mount_pct": name = "mount." + metricPart(l["path"]) + ".pct"
+		case "disk_read", "disk_write", "disk_busy": name = "disk." + metricPart(l["device"]) + "." + strings.TrimPrefix(name, "disk_")
+		}
+		if metricAllowed(c, name) { pts = append(pts, emitPoint{name, v}) }
+	})
+	return pts
+}
+
+// emitResult logs a new error for target as a warning and its repeats at debug level.
+func emitResult(target string, err error) {
+	emitMutex.Lock(); defer emitMutex.Unlock()
+	if err == nil {
+		if emitErrs[target] != "" { exportLog.Info("sending resumed", "target", target); delete(emitErrs, target) }
+		return
+	}
+	if emitErrs[target] != err.Error() { exportLog.Warn("sending failed", "target", target, "err", err) } else { exportLog.Debug("sending failed", "target", target, "err", err) }
+	emitErrs[target] = err.Error()
+}
+
+func sendGraphite(c AppConfig, prefix string, ts int64, pts []emitPoint) error {
+	var b bytes.Buffer
+	for _, p := range pts { fmt.Fprintf(&b, "%s.%s %s %d\n", prefix, p.name, strconv.FormatFloat(p.v, 'f', -1, 64), ts) }
+	emitMutex.Lock(); defer emitMutex.Unlock()
+	if graphiteConn != nil && graphiteAddr != c.GraphiteAddr { graphiteConn.Close(); graphiteConn = nil }
+	if graphiteConn == nil {
+		conn, err := net.DialTimeout("tcp", c.GraphiteAddr, 5*time.Second)
+		if err != nil { return err }
+		graphiteConn, graphiteAddr = conn, c.GraphiteAddr
+	}
+	graphiteConn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	if _, err := graphiteConn.Write(b.Bytes()); err != nil { graphiteConn.Close(); graphiteConn = nil; return err }
+	return nil
+}
+
+// sendStatsD sends gauges, packed into datagrams that fit a typical MTU.
+func sendStatsD(c AppConfig, prefix string, pts []emitPoint) error {
+	conn, err := net.Dial("udp", c.StatsdAddr)
+	if err != nil { return err }
+	defer conn.Close()
+	var b bytes.Buffer
+	for i, p := range pts {
+		fmt.Fprintf(&b, "%s.%s:%s|g\n", prefix, p.name, strconv.FormatFloat(p.v, 'f', -1, 64))
+		if b.Len() > 1200 || i == len(pts)-1 {
+			if _, err := conn.Write(bytes.TrimSuffix(b.Bytes(), []byte("\n"))); err != nil { return err }
+			b.Reset()
+		}
+	}
+	return nil
+}
+
+func emitMetrics(m RichMetrics) {
+	cfgMutex.RLock(); cfg := config; cfgMutex.RUnlock()
+	if cfg.GraphiteAddr == "" && cfg.StatsdAddr == "" { return }
+	iv := time.Duration(cfg.MetricsInterval) * time.Second
+	if iv <= 0 { iv = 10 * time.Second }
+	emitMutex.Lock()
+	due := time.Since(emitLast) >= iv
+	if due { emitLast = time.Now() }
+	emitMutex.Unlock()
+	if !due { return }
+	prefix, pts := metricPrefix(cfg, m.Hostname), emitPoints(cfg, m)
+	if cfg.GraphiteAddr != "" { emitResult("graphite", sendGraphite(cfg, prefix, m.Timestamp, pts)) }
+	if cfg.StatsdAddr != "" { emitResult("statsd", sendStatsD(cfg, prefix, pts)) }
+}
+
+func runEmitters() {
+	ch := samples.subscribe("emit"); defer samples.unsubscribe(ch)
+	for {
+		select {
+		case <-stopCtx.Done(): return
+		case m := <-ch: emitMetrics(m)
+		}
+	}
+}
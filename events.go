@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// --- EXTERNAL EVENTS ---
+// POST /api/v1/events lets other systems raise alerts on this host: a CI job, backup software or a UPS
+// daemon posts {"monitor": "UPS on battery", "level": "CRITICAL", "message": "..."} (or a list, or
+// {"events": [...]}) and checkAlerts fires it on its next pass like one of Pulse's own, so it is
+// routed, notified, acknowledged and grouped into incidents the same way. It fires as
+// "ext:<source>/<monitor>" ("ext:<monitor>" without a source), so it can never mix with one of Pulse's
+// own monitors. It stays until the same source posts the monitor with level OK, or clears by itself
+// after ttl seconds when one is given. External alerts are kept only while Pulse runs.
+
+const maxExternalEvents = 500
+
+type ExternalEvent struct {
+	Monitor string  `json:"monitor"`
+	Level   string  `json:"level"` // OK, WARNING or CRITICAL (Default)
+	Message string  `json:"message,omitempty"`
+	Value   float64 `json:"value,omitempty"`
+	Source  string  `json:"source,omitempty"` // who sent it, e.g. ci, backup or ups
+	Alert   string  `json:"alert"`            // the monitor name it fires as
+	TTL     int     `json:"ttl,omitempty"`    // seconds until it clears by itself; 0 waits for OK
+	Time    int64   `json:"time"`             // when it was received
+	Expires int64   `json:"expires,omitempty"`
+}
+
+var (
+	externalEvents = map[string]ExternalEvent{} // by Alert
+	externalMutex  sync.Mutex
+)
+
+func externalName(ev ExternalEvent) string {
+	if ev.Source == "" { return "ext:" + ev.Monitor }
+	return "ext:" + ev.Source + "/" + ev.Monitor
+}
+
+// checkExternal fires the external alerts that are still on, after letting go of externalMutex.
+func checkExternal(alert func(n, lvl string, v float64, msg string)) {
+	now := time.Now().Unix()
+	var on []ExternalEvent
+	externalMutex.Lock()
+	for name, ev := range externalEvents {
+		if ev.Expires > 0 && now >= ev.Expires { delete(externalEvents, name); continue }
+		on = append(on, ev)
+	}
+	externalMutex.Unlock()
+	for _, ev := range on { alert(ev.Alert, ev.Level, ev.Value, ev.Message) }
+}
+
+// receiveEvents turns each valid event on or off; invalid ones come back as field errors by index.
+func receiveEvents(events []ExternalEvent) (accepted int, errs []fieldError) {
+	externalMutex.Lock(); defer externalMutex.Unlock()
+	now := time.Now().Unix()
+	for i, ev := range events {
+		f := fmt.Sprintf("events[%d]", i)
+		ev.Monitor, ev.Source = strings.TrimSpace(ev.Monitor), strings.TrimSpace(ev.Source)
+		if ev.Level == "" { ev.Level = "CRITICAL" }
+		switch {
+		case ev.Monitor == "" || len(ev.Monitor) > 100 || strings.IndexFunc(ev.Monitor, unicode.IsControl) >= 0: errs = append(errs, fieldError{f, "monitor must be 1-100 printable characters"}); continue
+		case len(ev.Source) > 50 || strings.ContainsRune(ev.Source, '/') || strings.IndexFunc(ev.Source, unicode.IsControl) >= 0: errs = append(errs, fieldError{f, "source must be up to 50 printable characters without /"}); continue
+		case ev.Level != "OK" && ev.Level != "WARNING" && ev.Level != "CRITICAL": errs = append(errs, fieldError{f, "level must be OK, WARNING or CRITICAL"}); continue
+		case math.IsNaN(ev.Value) || math.IsInf(ev.Value, 0): errs = append(errs, fieldError{f, "value must be a finite number"}); continue
+		case ev.TTL < 0: errs = append(errs, fieldError{f, "ttl must not be negative"}); continue
+		}
+		ev.Alert = externalName(ev)
+		if ev.Level == "OK" { delete(externalEvents, ev.Alert); accepted++; continue }
+		if _, ok := externalEvents[ev.Alert]; !ok && len(externalEvents) >= maxExternalEvents { errs = append(errs, fieldError{f, fmt.Sprintf("already %d external alerts", maxExternalEvents)}); continue }
+		ev.Message = truncateOutput(ev.Message)
+		ev.Time, ev.Expires = now, 0
+		if ev.TTL > 0 { ev.Expires = now + int64(ev.TTL) }
+		externalEvents[ev.Alert] = ev
+		accepted++
+	}
+	return accepted, errs
+}
+
+func registerEventsAPI(mux *http.ServeMux) {
+	mux.HandleFunc("POST /api/v1/events", apiRole("operator", func(w http.ResponseWriter, r *http.Request) {
+		events, ok := decodeBatch[ExternalEvent](w, r, "events")
+		if !ok { return }
+		n, errs := receiveEvents(events)
+		alertLog.Debug("external events", "accepted", n, "rejected", len(errs), "user", actor(r))
+		answerBatch(w, "event", n, errs)
+	}))
+	mux.HandleFunc("GET /api/v1/events", func(w http.ResponseWriter, r *http.Request) {
+		now := time.Now().Unix()
+		externalMutex.Lock()
+		res := []ExternalEvent{}
+		for _, ev := range externalEvents { if ev.Expires == 0 || now < ev.Expires { res = append(res, ev) } }
+		externalMutex.Unlock()
+		sort.Slice(res, func(i, j int) bool { return res[i].Alert < res[j].Alert })
+		apiOK(w, 200, res, &apiMeta{len(res), len(res), 0})
+	})
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// --- HISTORY EXPORT ---
+// /history/export?format=csv|xlsx&start=&end=&fields= writes a table with one row per sample:
+// local time, unix time and the chosen fields. Fields are sample metrics (cpu_tot, mem_used, ...),
+// "plugin:<name>" (the monitor's main value), "plugin:<name>/<label>" (one perfdata series),
+// "plugins" (every perfdata series in the range), "mount:<path>" (percent used) and
+// "disk:<device>/read|write|busy" (bytes/s and % busy), "group:<name>/cpu|mem|read|write|procs"
+// (a process group), "metric:<series>" (a collector's series) and "metrics" (all of them). CSV columns
+// are headed by field name, XLSX ones by the metric catalog's label and unit. The XLSX file is written
+// directly (one sheet, dates as real Excel dates), so no extra library is needed.
+
+var exportDefault = []string{"cpu_tot", "mem_used", "swp_used", "dsk_used", "load1", "procs", "net_down", "net_up", "dsk_read", "dsk_writ", "plugins", "metrics"}
+
+var exportFields = map[string]func(m RichMetrics) float64{
+	"cpu_tot":      func(m RichMetrics) float64 { return m.CPUTotal },
+	"mem_used":     func(m RichMetrics) float64 { return m.MemUsed },
+	"swp_used":     func(m RichMetrics) float64 { return m.SwapUsed },
+	"dsk_used":     func(m RichMetrics) float64 { return m.DiskUsed },
+	"load1":        func(m RichMetrics) float64 { return m.Load1 },
+	"load5":        func(m RichMetrics) float64 { return m.Load5 },
+	"load15":       func(m RichMetrics) float64 { return m.Load15 },
+	"load_core":    func(m RichMetrics) float64 { return m.LoadCore },
+	"cores":        func(m RichMetrics) float64 { return float64(m.Cores) },
+	"procs":        func(m RichMetrics) float64 { return float64(m.Procs) },
+	"net_down":     func(m RichMetrics) float64 { return float64(m.NetDown) },
+	"net_up":       func(m RichMetrics) float64 { return float64(m.NetUp) },
+	"dsk_read":     func(m RichMetrics) float64 { return float64(m.DiskRead) },
+	"dsk_writ":     func(m RichMetrics) float64 { return float64(m.DiskWrite) },
+	"uptime":       func(m RichMetrics) float64 { return float64(m.Uptime) },
+	"psi_cpu":      func(m RichMetrics) float64 { return m.PSICPU },
+	"psi_io":       func(m RichMetrics) float64 { return m.PSIIO },
+	"psi_io_full":  func(m RichMetrics) float64 { return m.PSIIOFull },
+	"psi_mem":      func(m RichMetrics) float64 { return m.PSIMem },
+	"psi_mem_full": func(m RichMetrics) float64 { return m.PSIMemFull },
+	"cpu_mhz":      func(m RichMetrics) float64 { return m.CPUMHz },
+	"throttles":    func(m RichMetrics) float64 { return float64(m.Throttles) },
+}
+
+type exportCol struct {
+	name string
+	get  func(m RichMetrics) (float64, bool)
+}
+
+func pluginID(p PluginData) string { if p.Name != "" { return p.Name }; return p.Path }
+
+func pluginCol(id, label string) exportCol {
+	name := "plugin:" + id
+	if label != "" { name += "/" + label }
+	return exportCol{name, func(m RichMetrics) (float64, bool) {
+		for _, p := range m.Plugins {
+			if pluginID(p) != id { continue }
+			if label == "" { return p.PerfVal, true }
+			for _, pm := range p.Perf { if pm.Label == label { return pm.Value, true } }
+		}
+		return 0, false
+	}}
+}
+
+func metricCol(key string) exportCol {
+	return exportCol{"metric:" + key, func(m RichMetrics) (float64, bool) { return metricValue(m, key) }}
+}
+
+// exportColumns resolves fields against rows, which may come in several slices (the ring's two halves).
+func exportColumns(fields []string, rows ...[]RichMetrics) ([]exportCol, error) {
+	var cols []exportCol
+	for _, f := range fields {
+		f = strings.TrimSpace(f)
+		switch {
+		case f == "":
+		case f == "plugins":
+			seen := make(map[string]bool)
+			var keys [][2]string
+			for _, seg := range rows {
+				for i := range seg {
+					for _, p := range seg[i].Plugins {
+						for _, pm := range p.Perf {
+							k := [2]string{pluginID(p), pm.Label}
+							if !seen[k[0]+"\x00"+k[1]] { seen[k[0]+"\x00"+k[1]] = true; keys = append(keys, k) }
+						}
+					}
+				}
+			}
+			sort.Slice(keys, func(i, j int) bool { return keys[i][0]+"\x00"+keys[i][1] < keys[j][0]+"\x00"+keys[j][1] })
+			for _, k := range keys { cols = append(cols, pluginCol(k[0], k[1])) }
+		case f == "metrics":
+			seen := make(map[string]bool)
+			var keys []string
+			for _, seg := range rows {
+				for i := range seg {
+					for _, mt := range seg[i].Metrics { if k := mt.key(); !seen[k] { seen[k] = true; keys = append(keys, k) } }
+				}
+			}
+			sort.Strings(keys)
+			for _, k := range keys { cols = append(cols, metricCol(k)) }
+		case strings.HasPrefix(f, "metric:"):
+			cols = append(cols, metricCol(strings.TrimPrefix(f, "metric:")))
+		case strings.HasPrefix(f, "plugin:"):
+			id, label := strings.TrimPrefix(f, "plugin:"), ""
+			// Commands may contain slashes, so the label is whatever follows the last one, if that names a series.
+			if i := strings.LastIndex(id, "/"); i > 0 {
+			scan:
+				for _, seg := range rows {
+					for j := range seg {
+						for _, p := range seg[j].Plugins { if pluginID(p) == id[:i] { label = id[i+1:] } }
+						if label != "" { break scan }
+					}
+				}
+				if label != "" { id = id[:i] }
+			}
+			cols = append(cols, pluginCol(id, label))
+		case strings.HasPrefix(f, "disk:"):
+			dev, what, _ := strings.Cut(strings.TrimPrefix(f, "disk:"), "/")
+			if what != "read" && what != "write" && what != "busy" { return nil, fmt.Errorf("%q: use disk:<device>/read, /write or /busy", f) }
+			cols = append(cols, exportCol{f, func(m RichMetrics) (float64, bool) {
+				for _, d := range m.Disks {
+					if d.Name != dev { continue }
+					return map[string]float64{"read": float64(d.Read), "write": float64(d.Write), "busy": d.Busy}[what], true
+				}
+				return 0, false
+			}})
+		case strings.HasPrefix(f, "group:"):
+			name, what, ok := splitGroupField(strings.TrimPrefix(f, "group:"))
+			if !ok { return nil, fmt.Errorf("%q: use group:<name>/cpu, /mem, /read, /write or /procs", f) }
+			cols = append(cols, exportCol{f, func(m RichMetrics) (float64, bool) { return groupField(m, name, what) }})
+		case strings.HasPrefix(f, "mount:"):
+			path := strings.TrimPrefix(f, "mount:")
+			cols = append(cols, exportCol{f, func(m RichMetrics) (float64, bool) {
+				for _, mu := range m.Mounts { if mu.Path == path { return mu.Pct, true } }
+				return 0, false
+			}})
+		default:
+			get, ok := exportFields[f]
+			if !ok { return nil, fmt.Errorf("unknown field %q", f) }
+			cols = append(cols, exportCol{f, func(m RichMetrics) (float64, bool) { return get(m), true }})
+		}
+	}
+	return cols, nil
+}
+
+func handleExport(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	format := q.Get("format")
+	if format == "" { format = "csv" }
+	if format != "csv" && format != "xlsx" { http.Error(w, "format must be csv or xlsx", http.StatusBadRequest); return }
+	start, ok1 := parseTimeParam(q.Get("start"), 0)
+	end, ok2 := parseTimeParam(q.Get("end"), 1<<62)
+	if !ok1 || !ok2 { http.Error(w, "start and end must be unix seconds or RFC 3339", http.StatusBadRequest); return }
+	historyMutex.RLock()
+	lo, hi := history.Search(start), history.Search(end+1)
+	rows := history.Copy(lo, max(hi, lo))
+	historyMutex.RUnlock()
+	fields := exportDefault
+	if f := q.Get("fields"); f != "" { fields = strings.Split(f, ",") }
+	cols, err := exportColumns(fields, rows)
+	if err != nil { http.Error(w, err.Error(), http.StatusBadRequest); return }
+	host := latestSample().Hostname
+	if host == "" { host = "pulse" }
+	name := fmt.Sprintf("pulse-%s-%s.%s", host, time.Now().Format("20060102-1504"), format)
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		writeCSV(w, cols, rows)
+		return
+	}
+	w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	if err := writeXLSX(w, cols, rows); err != nil { httpLog.Error("xlsx export failed", "err", err) }
+}
+
+func writeCSV(w io.Writer, cols []exportCol, rows []RichMetrics) {
+	cw := csv.NewWriter(w)
+	head := []string{"time", "ts"}
+	for _, c := range cols { head = append(head, c.name) }
+	cw.Write(head)
+	for _, m := range rows {
+		rec := []string{time.Unix(m.Timestamp, 0).Format("2006-01-02 15:04:05"), strconv.FormatInt(m.Timestamp, 10)}
+		for _, c := range cols {
+			v, ok := c.get(m)
+			if ok { rec = append(rec, strconv.FormatFloat(v, 'f', -1, 64)) } else { rec = append(rec, "") }
+		}
+		cw.Write(rec)
+	}
+	cw.Flush()
+}
+
+const xlsxStyles = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<numFmts count="1"><numFmt numFmtId="164" formatCode="yyyy-mm-dd hh:mm:ss"/></numFmts>
+<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>
+<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>
+<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>
+<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>
+<cellXfs count="3"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/><xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/><xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/></cellXfs>
+</styleSheet>`
+
+var xlsxParts = [][2]string{
+	{"[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/><Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/></Types>`},
+	{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`},
+	{"xl/workbook.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="History" sheetId="1" r:id="rId1"/></sheets></workbook>`},
+	{"xl/_rels/workbook.xml.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/><Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/></Relationships>`},
+	{"xl/styles.xml", xlsxStyles},
+}
+
+func xlsxCol(i int) string {
+	s := ""
+	for i++; i > 0; i = (i - 1) / 26 { s = string(rune('A'+(i-1)%26)) + s }
+	return s
+}
+
+func writeXLSX(w io.Writer, cols []exportCol, rows []RichMetrics) error {
+	z := zip.NewWriter(w)
+	for _, p := range xlsxParts {
+		f, err := z.Create(p[0])
+		if err != nil { return err }
+		io.WriteString(f, p[1])
+	}
+	f, err := z.Create("xl/worksheets/sheet1.xml")
+	if err != nil { return err }
+	io.WriteString(f, `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>`+"\n"+`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews><cols><col min="1" max="1" width="20" customWidth="1"/></cols><sheetData>`)
+	// Columns are headed for people, from the metric catalog: "Network In (B/s)".
+	cfgMutex.RLock(); cfg := config; cfgMutex.RUnlock()
+	last := latestSample()
+	if len(rows) > 0 { last = rows[len(rows)-1] }
+	head := []string{"time", "ts"}
+	for _, c := range cols { head = append(head, describeMetric(cfg, c.name, last).header()) }
+	io.WriteString(f, `<row r="1">`)
+	for i, h := range head {
+		fmt.Fprintf(f, `<c r="%s1" t="inlineStr" s="2"><is><t>`, xlsxCol(i))
+		xml.EscapeText(f, []byte(h))
+		io.WriteString(f, `</t></is></c>`)
+	}
+	io.WriteString(f, `</row>`)
+	for ri, m := range rows {
+		row := ri + 2
+		t := time.Unix(m.Timestamp, 0)
+		_, off := t.Zone()
+		// Excel counts days from 1899-12-30 and knows nothing of time zones, so local time is stored.
+		serial := float64(m.Timestamp+int64(off))/86400 + 25569
+		fmt.Fprintf(f, `<row r="%d"><c r="A%d" s="1"><v>%s</v></c><c r="B%d"><v>%d</v></c>`, row, row, strconv.FormatFloat(serial, 'f', 8, 64), row, m.Timestamp)
+		for i, c := range cols {
+			if v, ok := c.get(m); ok { fmt.Fprintf(f, `<c r="%s%d"><v>%s</v></c>`, xlsxCol(i+2), row, strconv.FormatFloat(v, 'f', -1, 64)) }
+		}
+		io.WriteString(f, `</row>`)
+	}
+	io.WriteString(f, `</sheetData></worksheet>`)
+	return z.Close()
+}
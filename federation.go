@@ -0,0 +1,257 @@
+package main
+
+import (
+	"cmp"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- FEDERATION ---
+// GET /federate is a small summary of this Pulse for a Pulse further up: status, CPU, memory and load
+// (average and peak over the last five minutes), the fullest mount, network, the active alerts and host_meta.
+// A regional Pulse lists its sites in federate_sources and pulls each one's /federate every
+// federate_interval seconds; the Sites panel and GET /api/v1/federation show them, the Fleet panel
+// (fleet.go) one tile per host, and a site that can't be reached for three pulls raises
+// "Site <name> Unreachable". Its own /federate carries what it pulled, so a global Pulse that pulls
+// the regional ones sees every site below them, down to federateDepth levels. A site that is already
+// on the path to it, by URL or host, is left out, so two Pulses pulling each other don't nest their
+// answers without end.
+
+type FederateSource struct {
+	Name       string `json:"name,omitempty"` // Default: the host name the site reports
+	URL        string `json:"url"`            // the site's dashboard address, e.g. https://site1:8080
+	User       string `json:"user,omitempty"`
+	Password   string `json:"password,omitempty"`
+	SkipVerify bool   `json:"skip_verify,omitempty"`
+	Group      string `json:"group,omitempty"` // host group, see fleet.go
+
+	Overrides map[string]json.RawMessage `json:"overrides,omitempty"` // settings replacing the templates' for this site, see templates.go
+}
+
+type fedStat struct {
+	Avg float64 `json:"avg"`
+	Max float64 `json:"max"`
+}
+
+type siteSummary struct {
+	Host    string          `json:"host"`
+	Time    int64           `json:"time"`
+	Status  string          `json:"status"` // OK, WARNING or CRITICAL: the worst active alert
+	Window  int             `json:"window"` // seconds the averages cover
+	CPU     fedStat         `json:"cpu"`
+	Mem     fedStat         `json:"mem"`
+	Load1   fedStat         `json:"load1"`
+	Disk    float64         `json:"disk"` // fullest mount, %
+	NetDown float64         `json:"net_down"`
+	NetUp   float64         `json:"net_up"`
+	Alerts  []activeAlert   `json:"alerts"`
+	Meta    HostMeta        `json:"meta"`
+	Sites   []federatedSite `json:"sites,omitempty"`
+}
+
+type federatedSite struct {
+	Name     string       `json:"name"`
+	URL      string       `json:"url"`
+	Group    string       `json:"group,omitempty"`
+	Up       bool         `json:"up"`
+	LastSeen int64        `json:"last_seen,omitempty"`
+	Failures int          `json:"failures,omitempty"` // pulls failed in a row
+	Error    string       `json:"error,omitempty"`
+	Summary  *siteSummary `json:"summary,omitempty"` // as last pulled, kept while the site is down
+	Trend    []trendPoint `json:"trend,omitempty"`   // CPU, memory and disk of the last fleetTrend pulls
+
+	Pushed    int64  `json:"pushed,omitempty"`     // when it last accepted its config templates
+	PushError string `json:"push_error,omitempty"` // why the last push failed
+	pushed    string // hash of what it last accepted
+}
+
+const (
+	federateWindow = 300
+	federateDown   = 3 // failed pulls before "Unreachable"
+	federateDepth  = 8 // levels of sites below this Pulse, its own sources included
+)
+
+var (
+	fedSites  = map[string]*federatedSite{} // by URL
+	fedMutex  sync.Mutex
+	fedClient = &http.Client{Timeout: 10 * time.Second}
+	fedSkip   = &http.Client{Timeout: 10 * time.Second, Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+)
+
+func federateEvery(c AppConfig) time.Duration {
+	if c.FederateInterval > 0 { return time.Duration(c.FederateInterval) * time.Second }
+	return 30 * time.Second
+}
+
+// federateSummary sums up the last federateWindow seconds of history, with the sites below this Pulse
+// as pullSite kept them.
+func federateSummary(cfg AppConfig) siteSummary {
+	ms := mobileStatus(cfg)
+	s := siteSummary{Host: ms.Host, Time: ms.Time, Status: ms.Status, Window: federateWindow, Disk: ms.Disk, Alerts: ms.Alerts, Meta: cfg.HostMeta}
+	historyMutex.RLock()
+	n := 0
+	for i := history.Search(ms.Time - federateWindow); i < history.Len(); i++ {
+		m := history.At(i)
+		s.CPU.Avg += m.CPUTotal; s.Mem.Avg += m.MemUsed; s.Load1.Avg += m.Load1
+		s.NetDown += float64(m.NetDown); s.NetUp += float64(m.NetUp)
+		s.CPU.Max, s.Mem.Max, s.Load1.Max = max(s.CPU.Max, m.CPUTotal), max(s.Mem.Max, m.MemUsed), max(s.Load1.Max, m.Load1)
+		n++
+	}
+	historyMutex.RUnlock()
+	if n > 0 {
+		f := float64(n)
+		s.CPU.Avg /= f; s.Mem.Avg /= f; s.Load1.Avg /= f; s.NetDown /= f; s.NetUp /= f
+	}
+	s.Sites = federatedSites(cfg)
+	return s
+}
+
+// federatedSites lists the configured sources in config order, as last pulled.
+func federatedSites(cfg AppConfig) []federatedSite {
+	fedMutex.Lock(); defer fedMutex.Unlock()
+	var res []federatedSite
+	for _, src := range cfg.FederateSources {
+		s := federatedSite{Name: src.Name, URL: src.URL}
+		if st := fedSites[src.URL]; st != nil { s = *st }
+		s.Group = src.Group
+		res = append(res, s)
+	}
+	return res
+}
+
+func pullSite(src FederateSource) (*siteSummary, error) {
+	req, err := http.NewRequest("GET", strings.TrimSuffix(src.URL, "/")+"/federate", nil)
+	if err != nil { return nil, err }
+	if src.User != "" { req.SetBasicAuth(src.User, src.Password) }
+	c := fedClient
+	if src.SkipVerify { c = fedSkip }
+	resp, err := c.Do(req)
+	if err != nil { return nil, err }
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 256))
+		return nil, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	var s siteSummary
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 4<<20)).Decode(&s); err != nil { return nil, fmt.Errorf("not a Pulse /federate answer: %w", err) }
+	self, _ := os.Hostname()
+	s.Sites = pruneSites(s.Sites, []string{self, src.URL, s.Host}, federateDepth-1)
+	return &s, nil
+}
+
+// pruneSites drops the sites whose URL or host is already on path and cuts the tree depth levels down.
+func pruneSites(sites []federatedSite, path []string, depth int) []federatedSite {
+	if depth <= 0 { return nil }
+	var res []federatedSite
+	for _, s := range sites {
+		host := ""
+		if s.Summary != nil { host = s.Summary.Host }
+		if slices.Contains(path, s.URL) || host != "" && slices.Contains(path, host) { continue }
+		if s.Summary != nil {
+			sum := *s.Summary
+			sum.Sites, s.Summary = pruneSites(sum.Sites, append(slices.Clip(path), s.URL, host), depth-1), &sum
+		}
+		res = append(res, s)
+	}
+	return res
+}
+
+// pullSites asks every source at once and records the answers; sources no longer configured are forgotten.
+func pullSites(cfg AppConfig) {
+	var wg sync.WaitGroup
+	for _, src := range cfg.FederateSources {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s, err := pullSite(src)
+			fedMutex.Lock(); defer fedMutex.Unlock()
+			st := fedSites[src.URL]
+			if st == nil { st = &federatedSite{URL: src.URL}; fedSites[src.URL] = st }
+			if err != nil {
+				if st.Failures == 0 { collectorLog.Warn("cannot pull a federated site", "url", src.URL, "err", err) }
+				st.Up, st.Error = false, err.Error(); st.Failures++
+			} else {
+				if st.Failures >= federateDown { collectorLog.Info("federated site is back", "url", src.URL) }
+				st.Up, st.Error, st.Failures, st.LastSeen, st.Summary = true, "", 0, time.Now().Unix(), s
+				st.Trend = addTrend(st.Trend, s)
+			}
+			host := ""
+			if st.Summary != nil { host = st.Summary.Host }
+			st.Name = cmp.Or(src.Name, host, src.URL)
+		}()
+	}
+	wg.Wait()
+	fedMutex.Lock()
+	for u := range fedSites { if !slices.ContainsFunc(cfg.FederateSources, func(s FederateSource) bool { return s.URL == u }) { delete(fedSites, u) } }
+	fedMutex.Unlock()
+}
+
+func runFederation() {
+	for {
+		cfgMutex.RLock(); cfg := config; cfgMutex.RUnlock()
+		if len(cfg.FederateSources) > 0 { pullSites(cfg); pushTemplates(cfg) }
+		select { case <-stopCtx.Done(): return; case <-time.After(federateEvery(cfg)): case <-fedKick: }
+	}
+}
+
+// searchSites keeps the sites whose name or host_meta match q (see HostMeta.matches), and the path
+// down to any site below them that does, looking depth levels down.
+func searchSites(sites []federatedSite, q string, depth int) []federatedSite {
+	res := []federatedSite{}
+	if depth <= 0 { return res }
+	for _, s := range sites {
+		if s.Summary == nil { if (HostMeta{}).matches(s.Name, q) { res = append(res, s) }; continue }
+		if s.Summary.Meta.matches(s.Name+" "+s.Summary.Host, q) { res = append(res, s); continue }
+		if below := searchSites(s.Summary.Sites, q, depth-1); len(below) > 0 {
+			sum := *s.Summary
+			sum.Sites, s.Summary = below, &sum
+			res = append(res, s)
+		}
+	}
+	return res
+}
+
+// checkFederation raises "Site <name> Unreachable" once a site has failed federateDown pulls in a row.
+func checkFederation(cfg AppConfig, alert func(n, lvl string, v float64, msg string)) {
+	for _, s := range federatedSites(cfg) {
+		if s.Failures < federateDown { continue }
+		msg := s.URL + ": " + s.Error
+		if s.LastSeen > 0 { msg += ", last seen " + time.Unix(s.LastSeen, 0).Format(time.RFC3339) }
+		alert("Site "+s.Name+" Unreachable", "CRITICAL", float64(s.Failures), msg)
+	}
+}
+
+func validateFederation(c AppConfig, bad func(field, format string, a ...interface{})) {
+	seen := map[string]bool{}
+	for i, s := range c.FederateSources {
+		f := fmt.Sprintf("federate_sources[%d]", i)
+		if u, err := url.Parse(s.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" { bad(f, "url must be an http:// or https:// address") }
+		if seen[s.URL] { bad(f, "%s is listed twice", s.URL) }
+		seen[s.URL] = true
+	}
+	if c.FederateInterval < 0 { bad("federate_interval", "must not be negative") }
+}
+
+func registerFederation(mux *http.ServeMux) {
+	mux.HandleFunc("GET /federate", func(w http.ResponseWriter, r *http.Request) {
+		cfgMutex.RLock(); cfg := config; cfgMutex.RUnlock()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(federateSummary(cfg))
+	})
+	mux.HandleFunc("GET /api/v1/federation", func(w http.ResponseWriter, r *http.Request) {
+		cfgMutex.RLock(); cfg := config; cfgMutex.RUnlock()
+		sites := federatedSites(cfg)
+		if q := r.URL.Query().Get("q"); q != "" { sites = searchSites(sites, q, federateDepth) }
+		if sites == nil { sites = []federatedSite{} }
+		apiOK(w, 200, sites, &apiMeta{len(sites), len(sites), 0})
+	})
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// --- FLAGS & ENVIRONMENT ---
+// Precedence is flags, then PULSE_* environment variables, then pulse.conf. Any top-level config
+// key can be set as PULSE_<KEY> (PULSE_SMTP_HOST, PULSE_CPU_WARN, PULSE_TELEGRAM_CHAT_IDS=1,2).
+// Overridden keys are applied on every load and save but never written to pulse.conf, which keeps
+// whatever value it had.
+
+var (
+	overrides  = map[string]json.RawMessage{} // json key -> value from flags/env
+	fileValues map[string]json.RawMessage     // keys as last read from pulse.conf
+	dataDir    string
+	runAs      string // --run-as: the user to drop to when started as root (Linux)
+	passFlags  []string // flags given on the command line, other than --data-dir, for install-service
+)
+
+func getenv(k, def string) string { if v := os.Getenv(k); v != "" { return v }; return def }
+
+// configKinds maps each AppConfig json key to its kind.
+func configKinds() map[string]reflect.Kind {
+	out := map[string]reflect.Kind{}
+	t := reflect.TypeOf(AppConfig{})
+	for i := 0; i < t.NumField(); i++ {
+		tag := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if tag != "" && tag != "-" { out[tag] = t.Field(i).Type.Kind() }
+	}
+	return out
+}
+
+func setOverride(key, val string, kinds map[string]reflect.Kind) error {
+	var raw []byte
+	switch {
+	case kinds[key] == reflect.String: raw, _ = json.Marshal(val)
+	case json.Valid([]byte(val)): raw = []byte(val)
+	case kinds[key] == reflect.Slice:
+		list := []string{}
+		for _, s := range strings.Split(val, ",") { if s = strings.TrimSpace(s); s != "" { list = append(list, s) } }
+		raw, _ = json.Marshal(list)
+	default: return fmt.Errorf("%q is not valid JSON", val)
+	}
+	var probe AppConfig
+	if err := json.Unmarshal([]byte(`{"`+key+`":`+string(raw)+`}`), &probe); err != nil { return err }
+	overrides[key] = raw
+	return nil
+}
+
+func parseRetention(s string) (int, error) {
+	if d, err := strconv.Atoi(strings.TrimSuffix(s, "d")); err == nil && d > 0 && strings.HasSuffix(s, "d") { return d * 86400, nil }
+	d, err := time.ParseDuration(s)
+	if err != nil || d < time.Minute { return 0, fmt.Errorf("retention %q: use a duration of at least 1m, e.g. 72h or 7d", s) }
+	return int(d.Seconds()), nil
+}
+
+// parseFlags applies flags and PULSE_* variables and returns the remaining arguments (subcommands).
+func parseFlags(args []string) ([]string, error) {
+	fs := flag.NewFlagSet("pulse", flag.ContinueOnError)
+	cfgPath := fs.String("config", getenv("PULSE_CONFIG", ""), "config file (default <data-dir>/pulse.conf, env PULSE_CONFIG)")
+	dir := fs.String("data-dir", getenv("PULSE_DATA_DIR", ""), "directory for history, config, keys and certificates (env PULSE_DATA_DIR)")
+	listen := fs.String("listen", "", "listen address, e.g. :8080 or 127.0.0.1:9000 (env PULSE_LISTEN)")
+	retention := fs.String("retention", "", "history to keep, e.g. 72h or 7d (env PULSE_RETENTION)")
+	dataFile := fs.String("data-file", "", "history file, relative to the data directory (env PULSE_DATA_FILE)")
+	saveEvery := fs.Int("save-interval", 0, "seconds between history snapshots (env PULSE_SAVE_INTERVAL)")
+	fs.StringVar(&runAs, "run-as", getenv("PULSE_RUN_AS", ""), "when started as root, run as this user with only the capabilities collection needs (Linux, env PULSE_RUN_AS)")
+	fs.StringVar(&webDir, "web-dir", getenv("PULSE_WEB_DIR", ""), "directory whose files replace or add to the built-in dashboard files (env PULSE_WEB_DIR)")
+	if err := fs.Parse(args); err != nil { return nil, err }
+	fs.Visit(func(f *flag.Flag) { if f.Name != "data-dir" { passFlags = append(passFlags, "--"+f.Name, f.Value.String()) } })
+	dataDir = *dir
+
+	if dataDir != "" {
+		if err := os.MkdirAll(dataDir, 0750); err != nil { return nil, err }
+		for _, p := range []*string{&dbFile, &confFile, &auditFile, &secretKeyFile, &vapidKeyFile, &pushFile, &alertsFile, &incidentsFile, &runsFile, &oomFile, &arpFile, &portsFile, &baselineFile, &spoolFile, &selfCertFile, &selfKeyFile, &defaultACMEDir} { *p = filepath.Join(dataDir, *p) }
+	}
+	if *cfgPath != "" { confFile = *cfgPath }
+	if st, err := os.Stat(webDir); webDir != "" && (err != nil || !st.IsDir()) { return nil, fmt.Errorf("--web-dir %q is not a directory", webDir) }
+	kinds := configKinds()
+	for _, kv := range os.Environ() {
+		k, v, _ := strings.Cut(kv, "=")
+		if !strings.HasPrefix(k, "PULSE_") { continue }
+		if key := strings.ToLower(strings.TrimPrefix(k, "PULSE_")); kinds[key] != reflect.Invalid && key != "users" {
+			if err := setOverride(key, v, kinds); err != nil { return nil, fmt.Errorf("%s: %w", k, err) }
+		}
+	}
+	if *listen != "" { setOverride("listen", *listen, kinds) }
+	if *retention != "" {
+		if _, err := parseRetention(*retention); err != nil { return nil, err }
+		setOverride("retention", *retention, kinds)
+	}
+	if *dataFile != "" { setOverride("data_file", *dataFile, kinds) }
+	if *saveEvery != 0 { setOverride("save_interval", strconv.Itoa(*saveEvery), kinds) }
+	return fs.Args(), nil
+}
+
+func applyOverrides(c *AppConfig) {
+	if len(overrides) == 0 { return }
+	b, _ := json.Marshal(overrides)
+	json.Unmarshal(b, c)
+}
+
+// fileJSON is what saveConfig writes: c itself, or with overridden keys put back to their file values.
+func fileJSON(c AppConfig) interface{} {
+	if len(overrides) == 0 { return c }
+	b, _ := json.Marshal(c)
+	var m map[string]json.RawMessage
+	json.Unmarshal(b, &m)
+	for k := range overrides {
+		if v, ok := fileValues[k]; ok { m[k] = v } else { delete(m, k) }
+	}
+	return m
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// --- FLEET VIEW ---
+// A Pulse with federate_sources is the server for its sites. GET /api/v1/fleet and the Fleet panel
+// show one tile per host: every source, and every site a regional source reports below it. A tile
+// has the host's worst alert state (DOWN once it failed federateDown pulls, UNKNOWN while the site
+// reporting it is down), CPU, memory and fullest disk with a sparkline of the last fleetTrend pulls,
+// and when it was last seen. A host that stops reporting raises "Site <name> Unreachable" on the
+// Pulse that pulls it, which a global Pulse sees in that Pulse's alerts.
+//
+// A source's "group" (prod, staging, a datacenter) puts it and the sites below it into a host
+// group, unless they have a group of their own from the Pulse reporting them. ?group= narrows the
+// fleet to one group and GET /api/v1/fleet/groups sums each group up. fleet_groups sets CPU, memory
+// and disk thresholds per group, raising "Site <name> CPU", "... Memory" and "... Disk" here, and
+// routing rules with "groups" send the alerts about a group's sites to its team.
+
+const fleetTrend = 60 // pulls kept per site, 30 minutes at the default federate_interval
+
+// FleetGroup puts thresholds (%; 0 = none) on the hosts of a group.
+type FleetGroup struct {
+	Name     string  `json:"name"`
+	CPUWarn  float64 `json:"cpu_warn,omitempty"`
+	CPUCrit  float64 `json:"cpu_crit,omitempty"`
+	MemWarn  float64 `json:"mem_warn,omitempty"`
+	MemCrit  float64 `json:"mem_crit,omitempty"`
+	DiskWarn float64 `json:"disk_warn,omitempty"`
+	DiskCrit float64 `json:"disk_crit,omitempty"`
+	For      int     `json:"for,omitempty"`
+}
+
+type trendPoint struct {
+	Time int64   `json:"t"`
+	CPU  float64 `json:"cpu"`
+	Mem  float64 `json:"mem"`
+	Disk float64 `json:"disk"`
+}
+
+type fleetTile struct {
+	Name     string       `json:"name"`
+	Via      []string     `json:"via,omitempty"` // the sites reporting it, top first
+	URL      string       `json:"url"`
+	Group    string       `json:"group,omitempty"`
+	Host     string       `json:"host,omitempty"`
+	Status   string       `json:"status"` // OK, WARNING, CRITICAL, DOWN, UNKNOWN, or PENDING before the first pull
+	Up       bool         `json:"up"`
+	LastSeen int64        `json:"last_seen,omitempty"`
+	Alerts   int          `json:"alerts"`
+	CPU      float64      `json:"cpu"`
+	Mem      float64      `json:"mem"`
+	Disk     float64      `json:"disk"`
+	Meta     HostMeta     `json:"meta"`
+	Trend    []trendPoint `json:"trend"`
+}
+
+type fleetGroupSummary struct {
+	Name   string  `json:"name"` // "" for hosts without a group
+	Hosts  int     `json:"hosts"`
+	Down   int     `json:"down"`
+	Status string  `json:"status"` // worst of its hosts: OK, WARNING, CRITICAL or DOWN
+	Alerts int     `json:"alerts"`
+	CPU    float64 `json:"cpu"`  // average of the hosts that are up
+	Mem    float64 `json:"mem"`  // average of the hosts that are up
+	Disk   float64 `json:"disk"` // fullest disk of any host
+}
+
+var siteGroups = map[string]string{} // site name -> group, for routing; guarded by fedMutex
+
+// addTrend adds a pulled summary to a site's trend and drops points past fleetTrend.
+func addTrend(t []trendPoint, s *siteSummary) []trendPoint {
+	t = append(t, trendPoint{s.Time, s.CPU.Avg, s.Mem.Avg, s.Disk})
+	if len(t) > fleetTrend { t = t[len(t)-fleetTrend:] }
+	return t
+}
+
+// fleetTiles flattens sites and the sites below them, in config order and down to federateDepth
+// levels, into the tiles matching q. Sites below a site that is down keep their last values but are
+// UNKNOWN; without a group of their own they are in the group of the site reporting them.
+func fleetTiles(sites []federatedSite, via []string, group string, stale bool, q string, tiles []fleetTile) []fleetTile {
+	if len(via) >= federateDepth { return tiles }
+	for _, s := range sites {
+		t := fleetTile{Name: s.Name, Via: via, URL: s.URL, Group: cmp.Or(s.Group, group), Up: s.Up && !stale, LastSeen: s.LastSeen, Status: "PENDING", Trend: s.Trend}
+		var below []federatedSite
+		if m := s.Summary; m != nil {
+			t.Host, t.Status, t.Alerts, t.CPU, t.Mem, t.Disk, t.Meta, below = m.Host, m.Status, len(m.Alerts), m.CPU.Avg, m.Mem.Avg, m.Disk, m.Meta, m.Sites
+		}
+		switch {
+		case stale: t.Status = "UNKNOWN"
+		case s.Failures >= federateDown: t.Status = "DOWN"
+		}
+		if t.Trend == nil { t.Trend = []trendPoint{} }
+		if q == "" || t.Meta.matches(t.Name+" "+t.Host, q) { tiles = append(tiles, t) }
+		tiles = fleetTiles(below, append(slices.Clip(via), s.Name), t.Group, stale || s.Failures >= federateDown, q, tiles)
+	}
+	return tiles
+}
+
+// summarizeGroups sums tiles up per group, in the order the groups first appear.
+func summarizeGroups(tiles []fleetTile) []fleetGroupSummary {
+	rank := map[string]int{"OK": 0, "WARNING": 1, "CRITICAL": 2, "DOWN": 3}
+	res, up := []fleetGroupSummary{}, []int{}
+	for _, t := range tiles {
+		i := slices.IndexFunc(res, func(g fleetGroupSummary) bool { return g.Name == t.Group })
+		if i < 0 { res, up, i = append(res, fleetGroupSummary{Name: t.Group, Status: "OK"}), append(up, 0), len(res) }
+		g := &res[i]
+		g.Hosts++; g.Alerts += t.Alerts; g.Disk = max(g.Disk, t.Disk)
+		if t.Status == "DOWN" { g.Down++ }
+		if r, ok := rank[t.Status]; ok && r > rank[g.Status] { g.Status = t.Status }
+		if t.Up { g.CPU += t.CPU; g.Mem += t.Mem; up[i]++ }
+	}
+	for i := range res { if up[i] > 0 { res[i].CPU /= float64(up[i]); res[i].Mem /= float64(up[i]) } }
+	return res
+}
+
+// checkFleetGroups raises "Site <name> CPU", "Site <name> Memory" and "Site <name> Disk" through
+// checkAlerts' check with the thresholds of the host's group, and notes every site's group for routing.
+func checkFleetGroups(cfg AppConfig, check func(n string, v, w, c float64, secs int)) {
+	names := map[string]string{}
+	for _, t := range fleetTiles(federatedSites(cfg), nil, "", false, "", nil) {
+		names[t.Name] = t.Group
+		i := slices.IndexFunc(cfg.FleetGroups, func(g FleetGroup) bool { return g.Name == t.Group })
+		if i < 0 || !t.Up || t.Group == "" { continue }
+		g := cfg.FleetGroups[i]
+		check("Site "+t.Name+" CPU", t.CPU, limitOff(g.CPUWarn), limitOff(g.CPUCrit), g.For)
+		check("Site "+t.Name+" Memory", t.Mem, limitOff(g.MemWarn), limitOff(g.MemCrit), g.For)
+		check("Site "+t.Name+" Disk", t.Disk, limitOff(g.DiskWarn), limitOff(g.DiskCrit), g.For)
+	}
+	fedMutex.Lock(); siteGroups = names; fedMutex.Unlock()
+}
+
+// siteGroup is the group of the site a "Site <name> ..." alert is about, or "".
+func siteGroup(monitor string) string {
+	if !strings.HasPrefix(monitor, "Site ") { return "" }
+	fedMutex.Lock(); defer fedMutex.Unlock()
+	best, group := -1, ""
+	for n, g := range siteGroups {
+		if len(n) > best && strings.HasPrefix(monitor, "Site "+n+" ") { best, group = len(n), g }
+	}
+	return group
+}
+
+func validateFleetGroups(c AppConfig, bad func(field, format string, a ...interface{})) {
+	seen := map[string]bool{}
+	for i, g := range c.FleetGroups {
+		f := fmt.Sprintf("fleet_groups[%d]", i)
+		if g.Name == "" { bad(f, "name is required") } else if seen[g.Name] { bad(f, "%q is listed twice", g.Name) }
+		seen[g.Name] = true
+		if g.CPUWarn < 0 || g.CPUCrit < 0 || g.MemWarn < 0 || g.MemCrit < 0 || g.DiskWarn < 0 || g.DiskCrit < 0 || g.For < 0 { bad(f, "thresholds and for must not be negative") }
+	}
+}
+
+func registerFleetAPI(mux *http.ServeMux) {
+	// One tile per host below this Pulse; q searches like /federation but keeps only the matching hosts,
+	// group keeps one host group (group= with no value: the hosts without one).
+	mux.HandleFunc("GET /api/v1/fleet", func(w http.ResponseWriter, r *http.Request) {
+		cfgMutex.RLock(); cfg := config; cfgMutex.RUnlock()
+		tiles := fleetTiles(federatedSites(cfg), nil, "", false, r.URL.Query().Get("q"), []fleetTile{})
+		if v := r.URL.Query(); v.Has("group") { tiles = slices.DeleteFunc(tiles, func(t fleetTile) bool { return t.Group != v.Get("group") }) }
+		apiOK(w, 200, tiles, &apiMeta{len(tiles), len(tiles), 0})
+	})
+	mux.HandleFunc("GET /api/v1/fleet/groups", func(w http.ResponseWriter, r *http.Request) {
+		cfgMutex.RLock(); cfg := config; cfgMutex.RUnlock()
+		groups := summarizeGroups(fleetTiles(federatedSites(cfg), nil, "", false, "", nil))
+		apiOK(w, 200, groups, &apiMeta{len(groups), len(groups), 0})
+	})
+}
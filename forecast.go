@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+// --- DISK FORECAST ---
+// Every sample records usage per mounted filesystem. Every 5 minutes the history is bucketed
+// into 5-minute averages and a trend is fitted per mount (least squares, or Holt's double
+// exponential smoothing with forecast_method "holt") to estimate when it fills up.
+
+type MountUsage struct {
+	Path  string  `json:"path"`
+	Total uint64  `json:"total"`
+	Used  uint64  `json:"used"`
+	Pct   float64 `json:"pct"`
+}
+
+type Forecast struct {
+	Path       string       `json:"path"`
+	Total      uint64       `json:"total"`
+	Used       uint64       `json:"used"`
+	Pct        float64      `json:"pct"`
+	Method     string       `json:"method"`
+	PerDay     float64      `json:"per_day"`   // bytes/day, negative when shrinking
+	DaysLeft   float64      `json:"days_left"` // -1 when not growing or not enough data
+	FullAt     int64        `json:"full_at,omitempty"`
+	Points     [][2]float64 `json:"points"`     // [ts, pct] 5-minute averages
+	Projection [][2]float64 `json:"projection"` // [ts, pct] from now until full or the horizon
+}
+
+const forecastBucket = 300
+
+var pseudoFS = map[string]bool{"tmpfs": true, "devtmpfs": true, "squashfs": true, "overlay": true, "proc": true, "sysfs": true, "cgroup": true, "cgroup2": true, "devfs": true, "autofs": true, "nsfs": true}
+
+var (
+	mountList     []string
+	mountListAt   time.Time
+	forecasts     []Forecast
+	forecastAt    time.Time
+	forecastBusy  bool
+	forecastMutex sync.Mutex
+)
+
+// collectMounts reads usage for real filesystems; the partition list itself is refreshed once a minute.
+func collectMounts() []MountUsage {
+	if time.Since(mountListAt) > time.Minute {
+		parts, _ := disk.Partitions(false)
+		seen := map[string]bool{}
+		mountList = mountList[:0]
+		var real []disk.PartitionStat
+		for _, p := range parts {
+			if pseudoFS[p.Fstype] || seen[p.Device] || strings.HasPrefix(p.Mountpoint, "/snap/") { continue }
+			seen[p.Device] = true
+			mountList = append(mountList, p.Mountpoint)
+			real = append(real, p)
+		}
+		mountMutex.Lock(); mountParts = real; mountMutex.Unlock()
+		mountListAt = time.Now()
+	}
+	var out []MountUsage
+	for _, mp := range mountList {
+		u, err := disk.Usage(mp)
+		if err != nil || u.Total == 0 { continue }
+		// Used+Free leaves out blocks reserved for root, matching UsedPercent and what df reports.
+		out = append(out, MountUsage{mp, u.Used + u.Free, u.Used, u.UsedPercent})
+	}
+	return out
+}
+
+func linearTrend(xs, ys []float64) (slope, at float64) {
+	n := float64(len(xs))
+	var sx, sy, sxx, sxy float64
+	for i := range xs { sx += xs[i]; sy += ys[i]; sxx += xs[i] * xs[i]; sxy += xs[i] * ys[i] }
+	d := n*sxx - sx*sx
+	if d == 0 { return 0, ys[len(ys)-1] }
+	slope = (n*sxy - sx*sy) / d
+	return slope, (sy-slope*sx)/n + slope*xs[len(xs)-1]
+}
+
+// holtTrend returns the smoothed per-second trend and level at the last point.
+func holtTrend(xs, ys []float64) (slope, at float64) {
+	const alpha, beta = 0.5, 0.1
+	level, trend := ys[0], (ys[1]-ys[0])/(xs[1]-xs[0])
+	for i := 1; i < len(ys); i++ {
+		dt := xs[i] - xs[i-1]
+		prev := level
+		level = alpha*ys[i] + (1-alpha)*(level+trend*dt)
+		trend = beta*(level-prev)/dt + (1-beta)*trend
+	}
+	return trend, level
+}
+
+func buildForecasts(method string, horizonDays int) []Forecast {
+	type bucket struct{ used, total float64; n int }
+	series := map[string]map[int64]*bucket{}
+	var latest []MountUsage
+	historyMutex.RLock()
+	for i := 0; i < history.Len(); i++ {
+		m := history.At(i)
+		b := m.Timestamp / forecastBucket * forecastBucket
+		for _, mu := range m.Mounts {
+			s := series[mu.Path]
+			if s == nil { s = map[int64]*bucket{}; series[mu.Path] = s }
+			if s[b] == nil { s[b] = &bucket{} }
+			s[b].used += float64(mu.Used); s[b].total += float64(mu.Total); s[b].n++
+		}
+		if len(m.Mounts) > 0 { latest = m.Mounts }
+	}
+	historyMutex.RUnlock()
+	if horizonDays <= 0 { horizonDays = 30 }
+
+	var out []Forecast
+	for _, mu := range latest {
+		f := Forecast{Path: mu.Path, Total: mu.Total, Used: mu.Used, Pct: mu.Pct, Method: "linear", DaysLeft: -1}
+		if method == "holt" { f.Method = "holt" }
+		var keys []int64
+		for k := range series[mu.Path] { keys = append(keys, k) }
+		sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+		var xs, ys []float64
+		for _, k := range keys {
+			b := series[mu.Path][k]
+			xs = append(xs, float64(k)); ys = append(ys, b.used/float64(b.n))
+			f.Points = append(f.Points, [2]float64{float64(k), 100 * b.used / b.total})
+		}
+		// An hour of buckets at least, otherwise the slope is mostly noise.
+		if len(xs) >= 12 {
+			var slope, at float64
+			if f.Method == "holt" { slope, at = holtTrend(xs, ys) } else { slope, at = linearTrend(xs, ys) }
+			f.PerDay = slope * 86400
+			now := float64(time.Now().Unix())
+			if slope > 0 {
+				secs := (float64(mu.Total) - at) / slope
+				if secs < 0 { secs = 0 }
+				f.DaysLeft = secs / 86400
+				f.FullAt = int64(now + secs)
+			}
+			end := now + float64(horizonDays)*86400
+			if f.FullAt > 0 && float64(f.FullAt) < end { end = float64(f.FullAt) }
+			for t := now; ; t += (end - now) / 20 {
+				if t > end { t = end }
+				v := 100 * (at + slope*(t-xs[len(xs)-1])) / float64(mu.Total)
+				if v < 0 { v = 0 }
+				f.Projection = append(f.Projection, [2]float64{t, v})
+				if t >= end || end == now { break }
+			}
+		}
+		out = append(out, f)
+	}
+	return out
+}
+
+// currentForecasts returns the cached forecasts, refreshing them in the background every 5 minutes.
+func currentForecasts(cfg AppConfig) []Forecast {
+	forecastMutex.Lock(); defer forecastMutex.Unlock()
+	if !forecastBusy && time.Since(forecastAt) > 5*time.Minute {
+		forecastBusy = true
+		go func() {
+			f := buildForecasts(cfg.ForecastMethod, cfg.ForecastDays)
+			forecastMutex.Lock(); forecasts, forecastAt, forecastBusy = f, time.Now(), false; forecastMutex.Unlock()
+		}()
+	}
+	return forecasts
+}
+
+func checkForecasts(cfg AppConfig, alert func(n, lvl string, v float64, msg string)) {
+	if cfg.ForecastDays <= 0 { return }
+	for _, f := range currentForecasts(cfg) {
+		if f.DaysLeft < 0 || f.DaysLeft >= float64(cfg.ForecastDays) { continue }
+		lvl := "WARNING"
+		if f.DaysLeft < float64(cfg.ForecastDays)/4 { lvl = "CRITICAL" }
+		alert("Disk Forecast "+f.Path, lvl, f.DaysLeft, fmt.Sprintf("%s is %.1f%% full and growing %s/day; full in %.1f days (%s, %s trend)",
+			f.Path, f.Pct, fmtBytes(uint64(f.PerDay)), f.DaysLeft, time.Unix(f.FullAt, 0).Format("2006-01-02 15:04"), f.Method))
+	}
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+)
+
+// --- METRICS FORWARDING ---
+// Copies every sample to a long-term TSDB: influx_url takes InfluxDB line protocol (v1 /write?db=
+// or v2 /api/v2/write?org=&bucket= with influx_token), remote_write_url takes Prometheus
+// remote_write (with remote_write_token as bearer token). Samples queue per target and go out
+// forward_batch at a time; a failed send is retried with backoff while new samples keep queueing.
+// A 4xx answer other than 429 won't change on a retry, so that batch is dropped.
+// Once forward_buffer samples are waiting the oldest move to the spool on disk (spool.go), so an
+// unreachable TSDB never holds up collection or grows memory without bound.
+
+type forwarder struct {
+	name    string
+	url     func(c AppConfig) string
+	send    func(c AppConfig, batch []RichMetrics) error
+	mu      sync.Mutex
+	queue   []RichMetrics
+	spool   *sampleSpool
+	sent    int64
+	dropped int64
+	lastErr string
+	wake    chan struct{}
+}
+
+type forwardStat struct {
+	Queued     int    `json:"queued"`
+	Spooled    int    `json:"spooled"`
+	SpoolBytes int64  `json:"spool_bytes"`
+	Sent       int64  `json:"sent"`
+	Dropped    int64  `json:"dropped"`
+	LastError  string `json:"last_error,omitempty"`
+}
+
+var (
+	forwarders = []*forwarder{
+		{name: "influx", url: func(c AppConfig) string { return c.InfluxURL }, send: sendInflux},
+		{name: "remote_write", url: func(c AppConfig) string { return c.RemoteWriteURL }, send: sendRemoteWrite},
+	}
+	forwardClient = &http.Client{Timeout: 15 * time.Second}
+)
+
+func forwardLimits(c AppConfig) (batch, buffer int) {
+	batch, buffer = c.ForwardBatch, c.ForwardBuffer
+	if batch <= 0 { batch = 10 }
+	if buffer <= 0 { buffer = 10000 }
+	if buffer < batch { buffer = batch }
+	return
+}
+
+func (f *forwarder) push(m RichMetrics, buffer int, spoolMax int64) {
+	f.mu.Lock()
+	f.queue = append(f.queue, m)
+	f.trim(buffer, spoolMax)
+	f.mu.Unlock()
+	select { case f.wake <- struct{}{}: default: }
+}
+
+// take removes up to n samples from the front of the queue; putBack returns them after a failed send.
+func (f *forwarder) take(n int) []RichMetrics {
+	f.mu.Lock(); defer f.mu.Unlock()
+	n = min(n, len(f.queue))
+	b := append([]RichMetrics(nil), f.queue[:n]...)
+	f.queue = f.queue[n:]
+	return b
+}
+
+func (f *forwarder) putBack(b []RichMetrics, buffer int, spoolMax int64) {
+	f.mu.Lock(); defer f.mu.Unlock()
+	f.queue = append(b, f.queue...)
+	f.trim(buffer, spoolMax)
+}
+
+// trim moves the oldest samples beyond buffer to the spool; what doesn't fit there is dropped. f.mu is held.
+func (f *forwarder) trim(buffer int, spoolMax int64) {
+	if n := len(f.queue) - buffer; n > 0 {
+		f.dropped += int64(f.spool.add(f.queue[:n], spoolMax))
+		clear(f.queue[:n])
+		f.queue = f.queue[n:]
+	}
+}
+
+// sendOne sends the oldest batch: from the spool while it has any, then from the queue.
+func (f *forwarder) sendOne(cfg AppConfig, batch, buffer int) error {
+	if n, _ := f.spool.pending(); n > 0 {
+		b, off, err := f.spool.peek(batch)
+		if err == nil && len(b) > 0 { err = f.send(cfg, b) }
+		f.result(len(b), err)
+		if err == nil || rejected(err) { f.spool.done(off, len(b)); return nil }
+		return err
+	}
+	b := f.take(batch)
+	err := f.send(cfg, b)
+	f.result(len(b), err)
+	if rejected(err) { return nil }
+	if err != nil { f.putBack(b, buffer, spoolLimit(cfg)) }
+	return err
+}
+
+// rejected is a 4xx answer other than 429: the TSDB refuses the batch itself, so retrying it can't help.
+func rejected(err error) bool {
+	var se *statusError
+	return errors.As(err, &se) && se.code/100 == 4 && se.code != http.StatusTooManyRequests
+}
+
+// result records a send; a new error is logged as a warning, repeats of it only at debug level. A
+// rejected batch is dropped and always logged.
+func (f *forwarder) result(n int, err error) {
+	f.mu.Lock(); defer f.mu.Unlock()
+	if err == nil {
+		if f.lastErr != "" { exportLog.Info("forwarding resumed", "target", f.name) }
+		f.sent += int64(n); f.lastErr = ""; return
+	}
+	if rejected(err) {
+		f.dropped += int64(n); f.lastErr = err.Error()
+		exportLog.Error("TSDB rejected a batch, dropping it", "target", f.name, "samples", n, "err", err); return
+	}
+	if err.Error() != f.lastErr { exportLog.Warn("forwarding failed, will retry", "target", f.name, "queued", len(f.queue)+n, "err", err) } else { exportLog.Debug("forwarding failed", "target", f.name, "err", err) }
+	f.lastErr = err.Error()
+}
+
+// loop sends a batch once enough samples are queued, or whatever is there 10 seconds after the last send;
+// spooled samples go out without waiting.
+func (f *forwarder) loop() {
+	backoff := time.Duration(0)
+	lastTry := time.Now()
+	for {
+		t := time.NewTimer(time.Second + backoff)
+		select {
+		case <-stopCtx.Done(): t.Stop(); return
+		case <-f.wake: t.Stop()
+		case <-t.C:
+		}
+		cfgMutex.RLock(); cfg := config; cfgMutex.RUnlock()
+		if f.url(cfg) == "" { f.take(math.MaxInt); f.spool.reset(); continue }
+		batch, buffer := forwardLimits(cfg)
+		f.mu.Lock(); n := len(f.queue); f.mu.Unlock()
+		spooled, _ := f.spool.pending()
+		if n+spooled == 0 { lastTry = time.Now(); continue }
+		if backoff > 0 && time.Since(lastTry) < backoff { continue }
+		if spooled == 0 && n < batch && time.Since(lastTry) < 10*time.Second { continue }
+		for stopCtx.Err() == nil {
+			if err := f.sendOne(cfg, batch, buffer); err != nil {
+				backoff = min(max(2*backoff, 2*time.Second), 5*time.Minute)
+				break
+			}
+			backoff = 0
+			f.mu.Lock(); n = len(f.queue); f.mu.Unlock()
+			if spooled, _ = f.spool.pending(); spooled == 0 && n < batch { break }
+		}
+		lastTry = time.Now()
+	}
+}
+
+func runForwarders() {
+	for _, f := range forwarders { f.wake = make(chan struct{}, 1); f.spool = openSpool(f.name); go f.loop() }
+	ch := samples.subscribe("forward"); defer samples.unsubscribe(ch)
+	for {
+		select {
+		case <-stopCtx.Done(): return
+		case m := <-ch:
+			cfgMutex.RLock(); cfg := config; cfgMutex.RUnlock()
+			_, buffer := forwardLimits(cfg)
+			for _, f := range forwarders { if f.url(cfg) != "" { f.push(m, buffer, spoolLimit(cfg)) } }
+		}
+	}
+}
+
+// flushForwarders makes one last attempt to send what is queued, during shutdown, and spools what
+// is left behind the unsent part of the spool. Behind a spool nothing is tried, so the order is kept
+// for the next start.
+func flushForwarders(ctx context.Context) {
+	cfgMutex.RLock(); cfg := config; cfgMutex.RUnlock()
+	for _, f := range forwarders {
+		if f.url(cfg) == "" || f.spool == nil { continue }
+		batch, _ := forwardLimits(cfg)
+		for ctx.Err() == nil {
+			if n, _ := f.spool.pending(); n > 0 { break }
+			b := f.take(batch)
+			if len(b) == 0 { break }
+			err := f.send(cfg, b)
+			if rejected(err) { f.result(len(b), err); continue }
+			if err != nil { f.putBack(b, math.MaxInt, 0); exportLog.Debug("final send failed", "target", f.name, "err", err); break }
+		}
+		f.spool.compact()
+		rest := f.take(math.MaxInt)
+		if len(rest) == 0 { continue }
+		if d := f.spool.add(rest, spoolLimit(cfg)); d > 0 { exportLog.Warn("dropping unsent samples", "target", f.name, "samples", d) } else { exportLog.Info("spooled unsent samples", "target", f.name, "samples", len(rest)) }
+	}
+}
+
+func forwardStats() map[string]forwardStat {
+	cfgMutex.RLock(); cfg := config; cfgMutex.RUnlock()
+	res := make(map[string]forwardStat)
+	for _, f := range forwarders {
+		if f.url(cfg) == "" { continue }
+		st := forwardStat{}
+		if f.spool != nil { st.Spooled, st.SpoolBytes = f.spool.pending() }
+		f.mu.Lock(); st.Queued, st.Sent, st.Dropped, st.LastError = len(f.queue), f.sent, f.dropped, f.lastErr; f.mu.Unlock()
+		res[f.name] = st
+	}
+	if len(res) == 0 { return nil }
+	return res
+}
+
+func postMetrics(u string, body []byte, header map[string]string) error {
+	req, err := http.NewRequest("POST", u, bytes.NewReader(body))
+	if err != nil { return err }
+	for k, v := range header { if v != "" { req.Header.Set(k, v) } }
+	resp, err := forwardClient.Do(req)
+	if err != nil { return err }
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return &statusError{resp.StatusCode, fmt.Sprintf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))}
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// sampleSeries lists the numbers in a sample as metric name, labels and value; both formats are built from it.
+func sampleSeries(m RichMetrics, each func(name string, labels [][2]string, v float64)) {
+	for _, k := range []string{"cpu_tot", "mem_used", "swp_used", "dsk_used", "load1", "load5", "load15", "load_core", "procs", "net_down", "net_up", "dsk_read", "dsk_writ", "uptime"} {
+		each(k, nil, exportFields[k](m))
+	}
+	for _, p := range m.Plugins {
+		id := pluginID(p)
+		each("plugin_exit_code", [][2]string{{"plugin", id}}, float64(p.ExitCode))
+		for _, pm := range p.Perf { each("plugin_value", [][2]string{{"label", pm.Label}, {"plugin", id}}, pm.Value) }
+	}
+	for _, mu := range m.Mounts { each("mount_pct", [][2]string{{"path", mu.Path}}, mu.Pct) }
+	for _, d := range m.Disks {
+		l := [][2]string{{"device", d.Name}}
+		each("disk_read", l, float64(d.Read)); each("disk_write", l, float64(d.Write)); each("disk_busy", l, d.Busy)
+	}
+	for _, mt := range m.Metrics {
+		var l [][2]string
+		for k, v := range mt.Tags { l = append(l, [2]string{k, v}) }
+		sort.Slice(l, func(i, j int) bool { return l[i][0] < l[j][0] })
+		each(mt.Name, l, mt.Value)
+	}
+}
+
+var influxEscape = strings.NewReplacer(",", `\,`, " ", `\ `, "=", `\=`)
+
+func sendInflux(c AppConfig, batch []RichMetrics) error {
+	var b strings.Builder
+	for _, m := range batch {
+		// One line per label set: the host's own numbers, then one per plugin series and mount.
+		lines := map[string][]string{}
+		var order []string
+		sampleSeries(m, func(name string, labels [][2]string, v float64) {
+			key := "pulse,host=" + influxEscape.Replace(m.Hostname)
+			field := name
+			for _, l := range labels {
+				if l[0] == "label" { field = cmp.Or(l[1], "value"); continue }
+				key += "," + l[0] + "=" + influxEscape.Replace(l[1])
+			}
+			if _, ok := lines[key]; !ok { order = append(order, key) }
+			lines[key] = append(lines[key], influxEscape.Replace(field)+"="+strconv.FormatFloat(v, 'f', -1, 64))
+		})
+		for _, k := range order { fmt.Fprintf(&b, "%s %s %d\n", k, strings.Join(lines[k], ","), m.Timestamp) }
+	}
+	u, err := url.Parse(c.InfluxURL)
+	if err != nil { return err }
+	q := u.Query(); q.Set("precision", "s"); u.RawQuery = q.Encode()
+	h := map[string]string{"Content-Type": "text/plain; charset=utf-8"}
+	if c.InfluxToken != "" { h["Authorization"] = "Token " + c.InfluxToken }
+	return postMetrics(u.String(), []byte(b.String()), h)
+}
+
+// Prometheus remote_write is a snappy-compressed protobuf WriteRequest. The message is small enough
+// to encode by hand: WriteRequest{1: TimeSeries}, TimeSeries{1: Label, 2: Sample},
+// Label{1: name, 2: value}, Sample{1: double value, 2: int64 ms}.
+func pbBytes(b []byte, field int, v []byte) []byte {
+	b = binary.AppendUvarint(b, uint64(field<<3|2))
+	b = binary.AppendUvarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+func sendRemoteWrite(c AppConfig, batch []RichMetrics) error {
+	type series struct {
+		labels [][2]string
+		points []byte
+	}
+	all := map[string]*series{}
+	for _, m := range batch {
+		sampleSeries(m, func(name string, labels [][2]string, v float64) {
+			ls := [][2]string{{"__name__", "pulse_" + name}, {"host", m.Hostname}}
+			for _, l := range labels { if l[1] != "" { ls = append(ls, l) } }
+			sort.Slice(ls, func(i, j int) bool { return ls[i][0] < ls[j][0] })
+			key := fmt.Sprint(ls)
+			s := all[key]
+			if s == nil { s = &series{labels: ls}; all[key] = s }
+			var pt []byte
+			pt = append(pt, 1<<3|1); pt = binary.LittleEndian.AppendUint64(pt, math.Float64bits(v))
+			pt = append(pt, 2<<3); pt = binary.AppendUvarint(pt, uint64(m.Timestamp*1000))
+			s.points = pbBytes(s.points, 2, pt)
+		})
+	}
+	keys := make([]string, 0, len(all))
+	for k := range all { keys = append(keys, k) }
+	sort.Strings(keys)
+	var req []byte
+	for _, k := range keys {
+		var ts []byte
+		for _, l := range all[k].labels { ts = pbBytes(ts, 1, pbBytes(pbBytes(nil, 1, []byte(l[0])), 2, []byte(l[1]))) }
+		req = pbBytes(req, 1, append(ts, all[k].points...))
+	}
+	h := map[string]string{"Content-Type": "application/x-protobuf", "Content-Encoding": "snappy", "X-Prometheus-Remote-Write-Version": "0.1.0"}
+	if c.RemoteWriteToken != "" { h["Authorization"] = "Bearer " + c.RemoteWriteToken }
+	return postMetrics(c.RemoteWriteURL, snappy.Encode(nil, req), h)
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"net/http"
+	"net/netip"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// --- GEOIP ---
+// With "geoip_db" listing MaxMind databases (GeoLite2/GeoIP2 Country or City, and optionally ASN),
+// the remote ends of established TCP connections are looked up and counted per country and per
+// autonomous system, so an exposed host's unexpected foreign peers stand out. Private and loopback
+// addresses are only counted. GET /api/v1/connections/geo and the "geoip" panel show the result.
+
+type geoRecord struct {
+	Country struct {
+		ISOCode string            `maxminddb:"iso_code"`
+		Names   map[string]string `maxminddb:"names"`
+	} `maxminddb:"country"`
+	ASN uint   `maxminddb:"autonomous_system_number"`
+	Org string `maxminddb:"autonomous_system_organization"`
+}
+
+type geoCount struct {
+	Key   string `json:"key"`  // ISO country code or "AS13335"
+	Name  string `json:"name"` // country or AS organization
+	Conns int    `json:"conns"`
+	IPs   int    `json:"ips"`
+}
+
+type geoReport struct {
+	Countries []geoCount `json:"countries"`
+	ASNs      []geoCount `json:"asns"`
+	Private   int        `json:"private"` // connections to private, loopback and link-local addresses
+	Unknown   int        `json:"unknown"` // public addresses none of the databases know
+	Total     int        `json:"total"`
+}
+
+const maxGeoCache = 10000
+
+var (
+	geoMutex sync.Mutex
+	geoPaths []string
+	geoStamp []time.Time // modification times, so a database replaced by geoipupdate is reopened
+	geoDBs   []*maxminddb.Reader
+	geoCache = map[netip.Addr]geoRecord{}
+	geoConns []tcpConn
+)
+
+// openGeoDBs (re)opens the databases when geoip_db or one of the files changed; geoMutex is held.
+func openGeoDBs() {
+	cfgMutex.RLock(); paths := config.GeoIPDB; cfgMutex.RUnlock()
+	stamps := make([]time.Time, len(paths))
+	for i, p := range paths { if st, err := os.Stat(p); err == nil { stamps[i] = st.ModTime() } }
+	if slices.Equal(paths, geoPaths) && slices.EqualFunc(stamps, geoStamp, time.Time.Equal) { return }
+	for _, db := range geoDBs { db.Close() }
+	geoDBs, geoPaths, geoStamp, geoCache = nil, slices.Clone(paths), stamps, map[netip.Addr]geoRecord{}
+	var failed []string
+	for _, p := range paths {
+		db, err := maxminddb.Open(p)
+		if err != nil { collectorLog.Warn("cannot open GeoIP database", "file", p, "err", err); failed = append(failed, p+": "+err.Error()); continue }
+		geoDBs = append(geoDBs, db)
+	}
+	switch {
+	case len(paths) == 0:
+	case len(failed) > 0: noteCap("geoip", collectorCap{OK: len(geoDBs) > 0, Partial: true, Note: "GeoIP database not usable: " + failed[0]})
+	default: noteCap("geoip", collectorCap{OK: true})
+	}
+}
+
+// geoLookup merges what every database knows about ip; geoMutex is held.
+func geoLookup(ip netip.Addr) geoRecord {
+	if r, ok := geoCache[ip]; ok { return r }
+	var rec geoRecord
+	for _, db := range geoDBs {
+		var r geoRecord
+		if err := db.Lookup(ip.AsSlice(), &r); err != nil { continue }
+		if r.Country.ISOCode != "" { rec.Country = r.Country }
+		if r.ASN != 0 { rec.ASN, rec.Org = r.ASN, r.Org }
+	}
+	if len(geoCache) >= maxGeoCache { clear(geoCache) }
+	geoCache[ip] = rec
+	return rec
+}
+
+func noteGeoConns(conns []tcpConn) {
+	geoMutex.Lock(); geoConns = conns; openGeoDBs(); geoMutex.Unlock()
+}
+
+func geoSummary() geoReport {
+	rep := geoReport{Countries: []geoCount{}, ASNs: []geoCount{}}
+	countries, asns := map[string]*geoCount{}, map[string]*geoCount{}
+	seen := map[netip.Addr]bool{}
+	add := func(m map[string]*geoCount, key, name string, first bool) {
+		c := m[key]
+		if c == nil { c = &geoCount{Key: key, Name: name}; m[key] = c }
+		c.Conns++
+		if first { c.IPs++ }
+	}
+	geoMutex.Lock()
+	openGeoDBs()
+	for _, c := range geoConns {
+		ip := c.Remote.Addr().Unmap()
+		rep.Total++
+		if ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsUnspecified() { rep.Private++; continue }
+		first := !seen[ip]
+		seen[ip] = true
+		r := geoLookup(ip)
+		if r.Country.ISOCode == "" && r.ASN == 0 { rep.Unknown++; continue }
+		if r.Country.ISOCode != "" { add(countries, r.Country.ISOCode, r.Country.Names["en"], first) }
+		if r.ASN != 0 { add(asns, "AS"+strconv.FormatUint(uint64(r.ASN), 10), r.Org, first) }
+	}
+	geoMutex.Unlock()
+	for _, c := range countries { rep.Countries = append(rep.Countries, *c) }
+	for _, c := range asns { rep.ASNs = append(rep.ASNs, *c) }
+	for _, l := range [][]geoCount{rep.Countries, rep.ASNs} {
+		sort.Slice(l, func(i, j int) bool {
+			if l[i].Conns != l[j].Conns { return l[i].Conns > l[j].Conns }
+			return l[i].Key < l[j].Key
+		})
+	}
+	return rep
+}
+
+func handleGeo(w http.ResponseWriter, r *http.Request) {
+	cfgMutex.RLock(); on := len(config.GeoIPDB) > 0; cfgMutex.RUnlock()
+	if !on { apiFail(w, http.StatusNotFound, apiError{"not_found", "GeoIP is off; set geoip_db in pulse.conf", nil}); return }
+	apiOK(w, 200, geoSummary(), nil)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// --- GRAFANA ---
+// /grafana speaks the JSON datasource contract (the "JSON" plugin by simpod and the older
+// SimpleJson), so Grafana can chart Pulse's history directly: add a JSON datasource with the URL
+// http://<pulse>:8080/grafana and basic auth if login is on. Metric names are the export fields
+// (cpu_tot, plugin:<name>/<label>, mount:<path>, metric:<series>, "plugins" for every perfdata series); alert
+// events come back as annotations. Series are averaged down to Grafana's interval.
+
+type grafanaRange struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+type grafanaQuery struct {
+	Range         grafanaRange `json:"range"`
+	IntervalMs    int64        `json:"intervalMs"`
+	MaxDataPoints int64        `json:"maxDataPoints"`
+	Targets       []struct {
+		Target string `json:"target"`
+		RefID  string `json:"refId"`
+		Type   string `json:"type"`
+		Hide   bool   `json:"hide"`
+	} `json:"targets"`
+}
+
+// grafanaMetrics lists what can be queried: the sample fields plus the series and mounts seen in the latest sample.
+func grafanaMetrics() []string {
+	var names []string
+	for f := range exportFields { names = append(names, f) }
+	sort.Strings(names)
+	m := latestSample()
+	var more []string
+	for _, p := range m.Plugins {
+		more = append(more, "plugin:"+pluginID(p))
+		for _, pm := range p.Perf { more = append(more, "plugin:"+pluginID(p)+"/"+pm.Label) }
+	}
+	for _, mu := range m.Mounts { more = append(more, "mount:"+mu.Path) }
+	for _, d := range m.Disks { more = append(more, "disk:"+d.Name+"/read", "disk:"+d.Name+"/write", "disk:"+d.Name+"/busy") }
+	for _, mt := range m.Metrics { more = append(more, "metric:"+mt.key()) }
+	sort.Strings(more)
+	return append(append(names, "plugins", "metrics"), more...)
+}
+
+// grafanaSeries turns a series' bucket averages into [value, unix ms] points, as Grafana wants them.
+func grafanaSeries(s aggSeries) [][2]float64 {
+	pts := make([][2]float64, len(s.TS))
+	for i := range s.TS { pts[i] = [2]float64{s.Avg[i], float64(s.TS[i] * 1000)} }
+	return pts
+}
+
+func handleGrafanaQuery(w http.ResponseWriter, r *http.Request) {
+	var q grafanaQuery
+	if err := json.NewDecoder(r.Body).Decode(&q); err != nil { http.Error(w, "bad query: "+err.Error(), http.StatusBadRequest); return }
+	if q.Range.To.IsZero() { q.Range.To = time.Now() }
+	step := q.IntervalMs / 1000
+	if span := q.Range.To.Unix() - q.Range.From.Unix(); q.MaxDataPoints > 0 && span/q.MaxDataPoints > step { step = span / q.MaxDataPoints }
+	out := []interface{}{}
+	for _, t := range q.Targets {
+		if t.Hide || t.Target == "" { continue }
+		res, err := queryHistory(histQuery{Start: q.Range.From.Unix(), End: q.Range.To.Unix(), Step: step, Fields: []string{t.Target}, Aggs: map[string]bool{"avg": true}})
+		if err != nil { http.Error(w, err.Error(), http.StatusBadRequest); return }
+		for _, s := range res.Series {
+			pts := grafanaSeries(s)
+			if t.Type != "table" { out = append(out, map[string]interface{}{"target": s.Field, "refId": t.RefID, "datapoints": pts}); continue }
+			tr := make([][]interface{}, len(pts))
+			for i, p := range pts { tr[i] = []interface{}{p[1], p[0]} }
+			out = append(out, map[string]interface{}{"type": "table", "refId": t.RefID,
+				"columns": []map[string]string{{"text": "Time", "type": "time"}, {"text": s.Field, "type": "number"}}, "rows": tr})
+		}
+	}
+	w.Header().Set("Content-Type", "application/json"); json.NewEncoder(w).Encode(out)
+}
+
+// handleGrafanaAnnotations returns the alert events in range, optionally only those whose monitor contains the query text.
+func handleGrafanaAnnotations(w http.ResponseWriter, r *http.Request) {
+	var q struct {
+		Range      grafanaRange           `json:"range"`
+		Annotation map[string]interface{} `json:"annotation"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&q); err != nil { http.Error(w, "bad query: "+err.Error(), http.StatusBadRequest); return }
+	if q.Range.To.IsZero() { q.Range.To = time.Now() }
+	filter, _ := q.Annotation["query"].(string)
+	out := []map[string]interface{}{}
+	alertLogMutex.RLock()
+	for _, ev := range alertHistory {
+		if ev.Time < q.Range.From.Unix() || ev.Time > q.Range.To.Unix() || !strings.Contains(strings.ToLower(ev.Monitor), strings.ToLower(filter)) { continue }
+		text := fmt.Sprintf("Value: %.2f", ev.Value)
+		if ev.Message != "" { text = ev.Message + "\n" + text }
+		out = append(out, map[string]interface{}{"annotation": q.Annotation, "time": ev.Time * 1000, "title": alertTitle(ev), "text": text, "tags": []string{"pulse", strings.ToLower(ev.Level), ev.Monitor}})
+	}
+	alertLogMutex.RUnlock()
+	w.Header().Set("Content-Type", "application/json"); json.NewEncoder(w).Encode(out)
+}
+
+func registerGrafana(mux *http.ServeMux) {
+	// Grafana's "Save & test" only checks that the base URL answers 200.
+	mux.HandleFunc("GET /grafana/{$}", func(w http.ResponseWriter, r *http.Request) { fmt.Fprintln(w, "OK") })
+	mux.HandleFunc("POST /grafana/search", func(w http.ResponseWriter, r *http.Request) {
+		var q struct{ Target string `json:"target"` }
+		json.NewDecoder(r.Body).Decode(&q)
+		out := []string{}
+		for _, n := range grafanaMetrics() { if strings.Contains(n, q.Target) { out = append(out, n) } }
+		w.Header().Set("Content-Type", "application/json"); json.NewEncoder(w).Encode(out)
+	})
+	mux.HandleFunc("POST /grafana/metrics", func(w http.ResponseWriter, r *http.Request) {
+		out := []map[string]string{}
+		for _, n := range grafanaMetrics() { out = append(out, map[string]string{"label": n, "value": n}) }
+		w.Header().Set("Content-Type", "application/json"); json.NewEncoder(w).Encode(out)
+	})
+	mux.HandleFunc("POST /grafana/metric-payload-options", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json"); w.Write([]byte("[]"))
+	})
+	mux.HandleFunc("POST /grafana/query", handleGrafanaQuery)
+	mux.HandleFunc("POST /grafana/annotations", handleGrafanaAnnotations)
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// --- PROCESS GROUPS ---
+// Every process belongs to a group: on Linux its docker/podman container or systemd unit (from
+// /proc/<pid>/cgroup), or else its cgroup; elsewhere its name. Each process scan sums CPU, memory
+// and processes per group over all processes, not just the process_limit kept, and IO over those
+// kept. The busiest groups go into the sample, so they have history like the rest, and group_rules
+// put thresholds on them.
+
+type ProcessGroup struct {
+	Name      string  `json:"name"`
+	Kind      string  `json:"kind"` // docker, podman, container, systemd, cgroup or name
+	Procs     int     `json:"procs"`
+	CPU       float64 `json:"cpu"`
+	Mem       float64 `json:"mem"`
+	DiskRead  uint64  `json:"d_read"`
+	DiskWrite uint64  `json:"d_write"`
+}
+
+// GroupRule puts thresholds on the groups whose name matches Group; memory is in MB.
+type GroupRule struct {
+	Group   string  `json:"group"`
+	CPUWarn float64 `json:"cpu_warn"`
+	CPUCrit float64 `json:"cpu_crit"`
+	MemWarn float64 `json:"mem_warn"`
+	MemCrit float64 `json:"mem_crit"`
+	For     int     `json:"for"`
+}
+
+// maxGroups is how many groups a sample keeps, busiest first.
+const maxGroups = 50
+
+var latestGroups []ProcessGroup
+
+// groupProcesses sums list per group, busiest (CPU, then memory) first.
+func groupProcesses(list []ProcessInfo, kinds map[string]string) []ProcessGroup {
+	idx := map[string]int{}
+	var groups []ProcessGroup
+	for _, p := range list {
+		i, ok := idx[p.Group]
+		if !ok { i = len(groups); idx[p.Group] = i; groups = append(groups, ProcessGroup{Name: p.Group, Kind: kinds[p.Group]}) }
+		g := &groups[i]
+		g.Procs++; g.CPU += p.CPU; g.Mem += p.Mem; g.DiskRead += p.DiskRead; g.DiskWrite += p.DiskWrite
+	}
+	sort.Slice(groups, func(i, j int) bool { return (groups[i].CPU + groups[i].Mem/1024/1024) > (groups[j].CPU + groups[j].Mem/1024/1024) })
+	if len(groups) > maxGroups { groups = groups[:maxGroups] }
+	return groups
+}
+
+// groupField reads cpu, mem, read, write or procs of one group in a sample.
+func groupField(m RichMetrics, name, what string) (float64, bool) {
+	for _, g := range m.Groups {
+		if g.Name != name { continue }
+		switch what {
+		case "cpu": return g.CPU, true
+		case "mem": return g.Mem, true
+		case "read": return float64(g.DiskRead), true
+		case "write": return float64(g.DiskWrite), true
+		case "procs": return float64(g.Procs), true
+		}
+	}
+	return 0, false
+}
+
+// splitGroupField splits "<group>/<what>"; group names may contain slashes themselves.
+func splitGroupField(f string) (name, what string, ok bool) {
+	i := strings.LastIndex(f, "/")
+	if i <= 0 { return "", "", false }
+	name, what = f[:i], f[i+1:]
+	return name, what, what == "cpu" || what == "mem" || what == "read" || what == "write" || what == "procs"
+}
+
+// limitOff turns a limit left at 0 into one that is never reached, where check would take 0 as "always".
+func limitOff(x float64) float64 { if x <= 0 { return math.Inf(1) }; return x }
+
+// checkGroups raises "Group <name> CPU" and "Group <name> Memory" through checkAlerts' check.
+func checkGroups(cfg AppConfig, m RichMetrics, check func(n string, v, w, c float64, secs int)) {
+	for _, r := range cfg.GroupRules {
+		re, err := regexp.Compile("^(?:" + r.Group + ")$")
+		if err != nil { continue }
+		for _, g := range m.Groups {
+			if !re.MatchString(g.Name) { continue }
+			check("Group "+g.Name+" CPU", g.CPU, limitOff(r.CPUWarn), limitOff(r.CPUCrit), r.For)
+			check("Group "+g.Name+" Memory", g.Mem/1024/1024, limitOff(r.MemWarn), limitOff(r.MemCrit), r.For)
+		}
+	}
+}
+
+func validateGroupRules(c AppConfig, bad func(field, format string, a ...interface{})) {
+	for i, r := range c.GroupRules {
+		f := fmt.Sprintf("group_rules[%d]", i)
+		if r.Group == "" { bad(f, "group is required") } else if _, err := regexp.Compile(r.Group); err != nil { bad(f, "bad pattern: %v", err) }
+		if r.CPUWarn < 0 || r.CPUCrit < 0 || r.MemWarn < 0 || r.MemCrit < 0 || r.For < 0 { bad(f, "thresholds and for must not be negative") }
+	}
+}
+
+// groupPoint is one sample of a group's history.
+type groupPoint struct {
+	Timestamp int64 `json:"ts"`
+	ProcessGroup
+}
+
+func registerGroupsAPI(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/v1/groups", func(w http.ResponseWriter, r *http.Request) {
+		limit, offset, ok := pageParams(w, r)
+		if !ok { return }
+		q := r.URL.Query()
+		dataMutex.RLock(); all := latestGroups; dataMutex.RUnlock()
+		list := []ProcessGroup{}
+		kind := q.Get("kind")
+		for _, g := range all { if kind == "" || g.Kind == kind { list = append(list, g) } }
+		less := map[string]func(a, b ProcessGroup) bool{
+			"cpu":   func(a, b ProcessGroup) bool { return a.CPU > b.CPU },
+			"mem":   func(a, b ProcessGroup) bool { return a.Mem > b.Mem },
+			"io":    func(a, b ProcessGroup) bool { return a.DiskRead+a.DiskWrite > b.DiskRead+b.DiskWrite },
+			"procs": func(a, b ProcessGroup) bool { return a.Procs > b.Procs },
+			"name":  func(a, b ProcessGroup) bool { return strings.ToLower(a.Name) < strings.ToLower(b.Name) },
+		}
+		if s := q.Get("sort"); s != "" {
+			f, ok := less[s]
+			if !ok { apiFail(w, http.StatusBadRequest, apiError{"bad_request", "sort must be cpu, mem, io, procs or name", nil}); return }
+			sort.SliceStable(list, func(i, j int) bool { return f(list[i], list[j]) })
+		}
+		lo, hi, meta := pageBounds(len(list), limit, offset)
+		apiOK(w, 200, list[lo:hi], meta)
+	})
+	// One group's samples, oldest first; a sample where the group wasn't among the busiest is left out.
+	mux.HandleFunc("GET /api/v1/groups/{name...}", func(w http.ResponseWriter, r *http.Request) {
+		limit, offset, ok := pageParams(w, r)
+		if !ok { return }
+		name, q := r.PathValue("name"), r.URL.Query()
+		start, ok1 := parseTimeParam(q.Get("start"), 0)
+		end, ok2 := parseTimeParam(q.Get("end"), 1<<62)
+		if !ok1 || !ok2 { apiFail(w, http.StatusBadRequest, apiError{"bad_request", "start and end must be unix seconds or RFC 3339", nil}); return }
+		list := []groupPoint{}
+		historyMutex.RLock()
+		for i := history.Search(start); i < history.Len() && history.At(i).Timestamp <= end; i++ {
+			m := history.At(i)
+			for _, g := range m.Groups { if g.Name == name { list = append(list, groupPoint{m.Timestamp, g}) } }
+		}
+		historyMutex.RUnlock()
+		if len(list) == 0 { apiFail(w, http.StatusNotFound, apiError{"not_found", "no samples of group " + name, nil}); return }
+		lo, hi, meta := pageBounds(len(list), limit, offset)
+		apiOK(w, 200, list[lo:hi], meta)
+	})
+}
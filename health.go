@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+// --- SELF-MONITORING ---
+// /healthz answers 200 while samples keep coming and 503 once the collector has stalled (for load
+// balancers and service checks; no login needed). /status has the details. A watchdog raises a
+// "Pulse Collector" alert when no sample arrived for 3 intervals (at least 15s), since checkAlerts
+// can't run then; the next sample resolves it.
+
+type notifyFailure struct {
+	Channel string `json:"channel"`
+	Error   string `json:"error"`
+	Time    int64  `json:"time"`
+}
+
+type HealthStatus struct {
+	Status          string         `json:"status"`
+	Started         int64          `json:"started"`
+	CollectorLag    float64        `json:"collector_lag"`
+	ProcScan        float64        `json:"proc_scan_seconds"`
+	ProcScanned     int64          `json:"procs_scanned"`
+	Goroutines      int            `json:"goroutines"`
+	RSS             uint64         `json:"rss"`
+	HeapAlloc       uint64         `json:"heap_alloc"`
+	HistorySamples  int            `json:"history_samples"`
+	HistoryOldest   int64          `json:"history_oldest,omitempty"`
+	SSEClients      int            `json:"sse_clients"`
+	WSClients       int            `json:"ws_clients"`
+	StreamDrops     int64          `json:"stream_drops"`
+	RateLimited     int64          `json:"rate_limited"`
+	LastSave        int64          `json:"last_save,omitempty"`
+	LastSaveError   string         `json:"last_save_error,omitempty"`
+	LastNotifyError *notifyFailure `json:"last_notify_error,omitempty"`
+	Forwarders      map[string]forwardStat `json:"forwarders,omitempty"`
+	Capabilities    map[string]collectorCap `json:"capabilities,omitempty"`
+}
+
+// collectorCap lets the dashboard explain an empty panel: OK is false when a collector doesn't work
+// on this system or with Pulse's rights, Partial when it only sees some processes.
+type collectorCap struct {
+	OK      bool   `json:"ok"`
+	Partial bool   `json:"partial,omitempty"`
+	Note    string `json:"note,omitempty"`
+}
+
+var (
+	startedAt     = time.Now()
+	lastSampleAt  atomic.Int64 // unix nanoseconds
+	lastSave      time.Time
+	lastSaveErr   error
+	lastNotifyErr *notifyFailure
+	collectorCaps = map[string]collectorCap{}
+	healthMutex   sync.Mutex
+)
+
+func markSample() { lastSampleAt.Store(time.Now().UnixNano()) }
+
+func noteSave(err error) {
+	healthMutex.Lock(); defer healthMutex.Unlock()
+	lastSaveErr = err
+	if err == nil { lastSave = time.Now() }
+}
+
+func noteCap(name string, c collectorCap) { healthMutex.Lock(); collectorCaps[name] = c; healthMutex.Unlock() }
+
+// noteNotifyError records a failed delivery for /status with its secrets redacted, and returns the
+// redacted error for the caller to log.
+func noteNotifyError(channel string, err error) error {
+	cfgMutex.RLock(); cfg := config; cfgMutex.RUnlock()
+	err = redactError(cfg, err)
+	healthMutex.Lock(); lastNotifyErr = &notifyFailure{channel, err.Error(), time.Now().Unix()}; healthMutex.Unlock()
+	return err
+}
+
+// stallLimit is how long without a sample counts as a stalled collector.
+func stallLimit() time.Duration {
+	cfgMutex.RLock(); gi := config.GlobalInt; cfgMutex.RUnlock()
+	d := 3 * time.Duration(gi) * time.Second
+	if d < 15*time.Second { d = 15 * time.Second }
+	return d
+}
+
+func collectorLag() time.Duration {
+	last := lastSampleAt.Load()
+	if last == 0 { return time.Since(startedAt) }
+	return time.Since(time.Unix(0, last))
+}
+
+func healthStatus() HealthStatus {
+	h := HealthStatus{Status: "ok", Started: startedAt.Unix(), CollectorLag: collectorLag().Seconds(), Goroutines: runtime.NumGoroutine(), SSEClients: samples.count("sse"), WSClients: samples.count("ws"), StreamDrops: samples.dropped.Load(), RateLimited: rateLimited.Load()}
+	if collectorLag() > stallLimit() { h.Status = "stalled" }
+	h.ProcScan, h.ProcScanned = time.Duration(procScanNanos.Load()).Seconds(), procScanCount.Load()
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	h.HeapAlloc = ms.HeapAlloc
+	if p, err := process.NewProcess(int32(os.Getpid())); err == nil { if mi, err := p.MemoryInfo(); err == nil { h.RSS = mi.RSS } }
+	historyMutex.RLock()
+	h.HistorySamples = history.Len()
+	if history.Len() > 0 { h.HistoryOldest = history.At(0).Timestamp }
+	historyMutex.RUnlock()
+	healthMutex.Lock()
+	if !lastSave.IsZero() { h.LastSave = lastSave.Unix() }
+	if lastSaveErr != nil { h.LastSaveError = lastSaveErr.Error() }
+	h.LastNotifyError = lastNotifyErr
+	h.Capabilities = maps.Clone(collectorCaps)
+	healthMutex.Unlock()
+	h.Forwarders = forwardStats()
+	return h
+}
+
+// watchCollector alerts when the collector stops producing samples.
+func watchCollector() {
+	t := time.NewTicker(5 * time.Second); defer t.Stop()
+	for {
+		select {
+		case <-stopCtx.Done(): return
+		case <-t.C:
+		}
+		lag, limit := collectorLag(), stallLimit()
+		if lag <= limit { continue }
+		cfgMutex.RLock(); cfg := config; cfgMutex.RUnlock()
+		latestMutex.RLock(); host := latestMetric.Hostname; latestMutex.RUnlock()
+		fireAlert(cfg, AlertEvent{Monitor: "Pulse Collector", Level: "CRITICAL", Value: lag.Seconds(), Host: host,
+			Message: fmt.Sprintf("No sample collected for %.0fs (limit %.0fs)", lag.Seconds(), limit.Seconds())})
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"runtime"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// --- HOST METADATA ---
+// host_meta describes this host: tags, environment, owner, location and any other key/values.
+// Admins edit it in Settings or with PUT /api/v1/host; it travels in /federate, so a regional Pulse
+// can search its sites by it (GET /api/v1/federation?q=), routing rules can match it (tags, env)
+// and email templates (.Meta), notify_command (PULSE_ENV, PULSE_TAGS, PULSE_LABEL_<KEY>, ...) and
+// Alertmanager labels carry it.
+
+type HostMeta struct {
+	Tags        []string          `json:"tags,omitempty"`
+	Environment string            `json:"environment,omitempty"` // prod, staging, ...
+	Owner       string            `json:"owner,omitempty"`
+	Location    string            `json:"location,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+}
+
+var metaLabelKey = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// matches is the fleet search: every word of q has to be in the name or the metadata, or be key=value
+// for a field (tag=db, env=prod, owner=, location=, or any label).
+func (h HostMeta) matches(name, q string) bool {
+	for _, w := range strings.Fields(strings.ToLower(q)) {
+		if k, v, ok := strings.Cut(w, "="); ok {
+			var found bool
+			switch k {
+			case "tag": found = slices.ContainsFunc(h.Tags, func(t string) bool { return strings.EqualFold(t, v) })
+			case "env", "environment": found = strings.EqualFold(h.Environment, v)
+			case "owner": found = strings.EqualFold(h.Owner, v)
+			case "location": found = strings.EqualFold(h.Location, v)
+			default:
+				for lk, lv := range h.Labels { found = found || (strings.EqualFold(lk, k) && strings.EqualFold(lv, v)) }
+			}
+			if !found { return false }
+			continue
+		}
+		text := []string{name, h.Environment, h.Owner, h.Location}
+		text = append(text, h.Tags...)
+		for _, lv := range h.Labels { text = append(text, lv) }
+		if !strings.Contains(strings.ToLower(strings.Join(text, " ")), w) { return false }
+	}
+	return true
+}
+
+// env is host_meta as PULSE_* variables for notify_command.
+func (h HostMeta) env(into map[string]string) {
+	into["PULSE_TAGS"], into["PULSE_ENV"], into["PULSE_OWNER"], into["PULSE_LOCATION"] = strings.Join(h.Tags, ","), h.Environment, h.Owner, h.Location
+	for k, v := range h.Labels { into["PULSE_LABEL_"+strings.ToUpper(k)] = v }
+}
+
+func validateHostMeta(c AppConfig, bad func(field, format string, a ...interface{})) {
+	for _, t := range c.HostMeta.Tags {
+		if t == "" || strings.ContainsAny(t, ", =") { bad("host_meta.tags", "%q: tags can't be empty or contain commas, spaces or =", t) }
+	}
+	for k := range c.HostMeta.Labels {
+		if !metaLabelKey.MatchString(k) { bad("host_meta.labels", "%q: keys are letters, digits and _", k) }
+		if slices.Contains([]string{"tag", "env", "environment", "owner", "location"}, strings.ToLower(k)) { bad("host_meta.labels", "%q is a field of its own", k) }
+	}
+}
+
+type hostInfo struct {
+	Host string   `json:"host"`
+	OS   string   `json:"os"`
+	Arch string   `json:"arch"`
+	Meta HostMeta `json:"meta"`
+}
+
+func registerHostAPI(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/v1/host", func(w http.ResponseWriter, r *http.Request) {
+		cfgMutex.RLock(); meta := config.HostMeta; cfgMutex.RUnlock()
+		name, _ := os.Hostname()
+		apiOK(w, 200, hostInfo{name, runtime.GOOS, runtime.GOARCH, meta}, nil)
+	})
+	// PUT replaces host_meta as a whole, through the same validation and revisions as PATCH /config.
+	mux.HandleFunc("PUT /api/v1/host", apiRole("admin", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(io.LimitReader(r.Body, 64<<10))
+		var meta HostMeta
+		if err := json.Unmarshal(body, &meta); err != nil { apiFail(w, http.StatusBadRequest, apiError{"bad_request", "invalid JSON: " + err.Error(), nil}); return }
+		sort.Strings(meta.Tags)
+		b, _ := json.Marshal(map[string]HostMeta{"host_meta": meta})
+		errs, err := updateConfig(b, actor(r), "api")
+		if err != nil { apiFail(w, http.StatusInternalServerError, apiError{"internal", err.Error(), nil}); return }
+		if len(errs) > 0 { apiFail(w, http.StatusUnprocessableEntity, apiError{"invalid_config", "the host metadata was not changed", errs}); return }
+		apiOK(w, 200, meta, nil)
+	}))
+}
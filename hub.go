@@ -0,0 +1,41 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// --- STREAM HUB ---
+// Every live stream (/events, /ws) subscribes to the hub and gets its own buffered channel, so
+// each dashboard sees every sample no matter how many are open. A client whose buffer is full
+// (stalled tab, slow link) misses that sample rather than holding up the collector or the other
+// clients; misses are counted in /status.
+
+type hub struct {
+	mu      sync.Mutex
+	subs    map[chan RichMetrics]string // channel -> kind ("sse", "ws")
+	dropped atomic.Int64
+}
+
+var samples = &hub{subs: make(map[chan RichMetrics]string)}
+
+func (h *hub) subscribe(kind string) chan RichMetrics {
+	ch := make(chan RichMetrics, 8)
+	h.mu.Lock(); h.subs[ch] = kind; h.mu.Unlock()
+	return ch
+}
+
+func (h *hub) unsubscribe(ch chan RichMetrics) { h.mu.Lock(); delete(h.subs, ch); h.mu.Unlock() }
+
+func (h *hub) publish(m RichMetrics) {
+	h.mu.Lock(); defer h.mu.Unlock()
+	for ch := range h.subs {
+		select { case ch <- m: default: h.dropped.Add(1) }
+	}
+}
+
+func (h *hub) count(kind string) (n int) {
+	h.mu.Lock(); defer h.mu.Unlock()
+	for _, k := range h.subs { if k == kind { n++ } }
+	return
+}
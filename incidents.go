@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- INCIDENTS ---
+// An incident is one stretch of a monitor's alerts, from its first WARNING or CRITICAL to the OK that
+// ends it, grouped from the alert log so a night of repeats, escalations, acknowledgements and
+// remediation runs reads as one entry with its duration, worst level and peak value. An incident's
+// id is its first alert event's. Notes added to it are kept in incidentsFile for as long as the
+// alert log holds the incident. A monitor that is no longer active but never sent its OK (Pulse was
+// restarted in between) ends at its last event.
+
+const maxIncidentNote = 2000
+
+var incidentsFile = "pulse.incidents.json"
+
+type IncidentNote struct {
+	Time int64  `json:"time"`
+	User string `json:"user"`
+	Text string `json:"text"`
+}
+
+type IncidentAck struct {
+	Time int64  `json:"time"`
+	User string `json:"user"`
+}
+
+type Incident struct {
+	ID       int64          `json:"id"`
+	Monitor  string         `json:"monitor"`
+	Host     string         `json:"host"`
+	Level    string         `json:"level"` // the worst it got
+	Start    int64          `json:"start"`
+	End      int64          `json:"end,omitempty"` // 0 while open
+	Duration int64          `json:"duration"`      // so far while open
+	Open     bool           `json:"open"`
+	Peak     float64        `json:"peak"`   // the highest value it alerted with
+	Alerts   int            `json:"alerts"` // alert events, repeats included
+	Acks     []IncidentAck  `json:"acks"`
+	Notes    []IncidentNote `json:"notes"`
+	Events   []AlertEvent   `json:"events"` // the first alert, level changes, acknowledgements, remediations and the OK
+}
+
+var (
+	incidentMutex sync.Mutex
+	incidentNotes map[int64][]IncidentNote
+)
+
+func loadIncidentNotes() {
+	if incidentNotes != nil { return }
+	incidentNotes = map[int64][]IncidentNote{}
+	if b, err := os.ReadFile(incidentsFile); err == nil {
+		if err := json.Unmarshal(b, &incidentNotes); err != nil { storageLog.Error("cannot read incident notes", "file", incidentsFile, "err", err) }
+	}
+}
+
+// saveIncidentNotes drops the notes of incidents the alert log no longer holds; incidentMutex is held.
+func saveIncidentNotes(oldest int64) error {
+	if observeOnly { return nil }
+	for id := range incidentNotes { if id < oldest { delete(incidentNotes, id) } }
+	b, _ := json.MarshalIndent(incidentNotes, "", "  ")
+	tmp := incidentsFile + ".tmp"
+	if err := os.WriteFile(tmp, b, 0600); err != nil { return err }
+	return os.Rename(tmp, incidentsFile)
+}
+
+// groupIncidents turns alert events, oldest first, into incidents, oldest first.
+func groupIncidents(events []AlertEvent, active map[string]string, now int64) []Incident {
+	var list []Incident
+	open, last := map[string]int{}, map[string]string{}
+	for _, ev := range events {
+		i, ok := open[ev.Monitor]
+		switch ev.Level {
+		case "WARNING", "CRITICAL":
+			if !ok {
+				list = append(list, Incident{ID: ev.ID, Monitor: ev.Monitor, Host: ev.Host, Level: ev.Level, Start: ev.Time, Peak: ev.Value, Acks: []IncidentAck{}, Notes: []IncidentNote{}})
+				i = len(list) - 1
+				open[ev.Monitor] = i
+			}
+			in := &list[i]
+			if last[ev.Monitor] != ev.Level { in.Events = append(in.Events, ev); last[ev.Monitor] = ev.Level }
+			if ev.Level == "CRITICAL" { in.Level = ev.Level }
+			in.Peak = max(in.Peak, ev.Value)
+			in.Alerts++
+			in.End = ev.Time
+		case "ACK", "REMEDIATION":
+			if !ok { continue }
+			in := &list[i]
+			in.Events = append(in.Events, ev)
+			in.End = ev.Time
+			if _, user, found := strings.Cut(ev.Message, " acknowledged by "); found && ev.Level == "ACK" { in.Acks = append(in.Acks, IncidentAck{ev.Time, user}) }
+		case "OK":
+			if !ok { continue }
+			list[i].Events = append(list[i].Events, ev)
+			list[i].End = ev.Time
+			delete(open, ev.Monitor); delete(last, ev.Monitor)
+		}
+	}
+	for mon, i := range open {
+		if active[mon] != "" { list[i].Open = true; list[i].End = 0 }
+	}
+	for i := range list {
+		if list[i].Open { list[i].Duration = now - list[i].Start } else { list[i].Duration = list[i].End - list[i].Start }
+	}
+	return list
+}
+
+// currentIncidents groups the alert log as it is now, with the notes added to each incident.
+func currentIncidents(cfg AppConfig) []Incident {
+	active := map[string]string{}
+	for _, a := range currentAlerts(cfg) { active[a.Monitor] = a.Level }
+	alertLogMutex.RLock(); list := groupIncidents(alertHistory, active, time.Now().Unix()); alertLogMutex.RUnlock()
+	incidentMutex.Lock()
+	loadIncidentNotes()
+	for i := range list {
+		if n := incidentNotes[list[i].ID]; n != nil { list[i].Notes = append([]IncidentNote(nil), n...) }
+	}
+	incidentMutex.Unlock()
+	return list
+}
+
+func findIncident(w http.ResponseWriter, r *http.Request) (Incident, bool) {
+	cfgMutex.RLock(); cfg := config; cfgMutex.RUnlock()
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err == nil {
+		for _, in := range currentIncidents(cfg) { if in.ID == id { return in, true } }
+	}
+	apiFail(w, http.StatusNotFound, apiError{"not_found", "no incident " + r.PathValue("id"), nil})
+	return Incident{}, false
+}
+
+func registerIncidentsAPI(mux *http.ServeMux) {
+	// Incidents newest first, optionally of one monitor, worst level and state, overlapping start to end.
+	mux.HandleFunc("GET /api/v1/incidents", func(w http.ResponseWriter, r *http.Request) {
+		limit, offset, ok := pageParams(w, r)
+		if !ok { return }
+		q := r.URL.Query()
+		start, ok1 := parseTimeParam(q.Get("start"), 0)
+		end, ok2 := parseTimeParam(q.Get("end"), 1<<62)
+		if !ok1 || !ok2 { apiFail(w, http.StatusBadRequest, apiError{"bad_request", "start and end must be unix seconds or RFC 3339", nil}); return }
+		level, monitor, open := q.Get("level"), q.Get("monitor"), q.Get("open")
+		if level != "" && level != "WARNING" && level != "CRITICAL" { apiFail(w, http.StatusBadRequest, apiError{"bad_request", "level must be WARNING or CRITICAL", nil}); return }
+		if open != "" && open != "true" && open != "false" { apiFail(w, http.StatusBadRequest, apiError{"bad_request", "open must be true or false", nil}); return }
+		cfgMutex.RLock(); cfg := config; cfgMutex.RUnlock()
+		all := currentIncidents(cfg)
+		list := []Incident{}
+		for i := len(all) - 1; i >= 0; i-- {
+			in := all[i]
+			if (level == "" || in.Level == level) && (monitor == "" || in.Monitor == monitor) && (open == "" || in.Open == (open == "true")) &&
+				in.Start <= end && in.Start+in.Duration >= start { list = append(list, in) }
+		}
+		lo, hi, meta := pageBounds(len(list), limit, offset)
+		apiOK(w, 200, list[lo:hi], meta)
+	})
+	mux.HandleFunc("GET /api/v1/incidents/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if in, ok := findIncident(w, r); ok { apiOK(w, 200, in, nil) }
+	})
+	mux.HandleFunc("POST /api/v1/incidents/{id}/notes", apiRole("operator", func(w http.ResponseWriter, r *http.Request) {
+		var body struct{ Text string `json:"text"` }
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 16<<10)).Decode(&body); err != nil { apiFail(w, http.StatusBadRequest, apiError{"bad_request", "invalid note: " + err.Error(), nil}); return }
+		body.Text = strings.TrimSpace(body.Text)
+		if body.Text == "" || len(body.Text) > maxIncidentNote { apiFail(w, http.StatusBadRequest, apiError{"bad_request", "text must be 1-" + strconv.Itoa(maxIncidentNote) + " characters", nil}); return }
+		in, ok := findIncident(w, r)
+		if !ok { return }
+		note := IncidentNote{time.Now().Unix(), actor(r), body.Text}
+		oldest := in.ID
+		alertLogMutex.RLock()
+		if len(alertHistory) > 0 { oldest = alertHistory[0].ID }
+		alertLogMutex.RUnlock()
+		incidentMutex.Lock()
+		loadIncidentNotes()
+		incidentNotes[in.ID] = append(incidentNotes[in.ID], note)
+		err := saveIncidentNotes(oldest)
+		incidentMutex.Unlock()
+		if err != nil { storageLog.Error("cannot save incident notes", "file", incidentsFile, "err", err) }
+		auditLog("incident_note", map[string]interface{}{"user": note.User, "incident": in.ID, "monitor": in.Monitor})
+		apiOK(w, http.StatusCreated, note, nil)
+	}))
+}
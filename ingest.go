@@ -0,0 +1,143 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+// --- APP METRICS INGEST ---
+// POST /api/v1/ingest takes gauges and counters from local applications: one metric, a list, or
+// {"metrics": [...]}, each with a name, value and optional unit, tags and type. A gauge keeps the last
+// value pushed, a counter adds it to a running total (kept only while Pulse runs). They reach samples
+// through the "ingest" collector, so they are charted, exported and forwarded like any collector's
+// metrics, and a series not pushed for ingest_ttl seconds drops out. Without "panels" every series in
+// the latest sample gets a chart of its own, and metric_rules put thresholds on them.
+
+type ingestPoint struct {
+	Metric
+	Type string `json:"type,omitempty"` // gauge (default) or counter
+}
+
+// MetricRule alerts on collector series; Metric is a pattern for the series key, e.g. "queue_depth.*".
+type MetricRule struct {
+	Metric string  `json:"metric"`
+	Warn   float64 `json:"warn"`
+	Crit   float64 `json:"crit"`
+	For    int     `json:"for"`
+}
+
+const (
+	maxIngestSeries = 1000
+	maxMetricPanels = 24
+)
+
+var (
+	ingestSeries = map[string]*ingested{} // by series key
+	ingestMutex  sync.Mutex
+)
+
+type ingested struct {
+	m  Metric
+	at time.Time
+}
+
+type ingestCollector struct{}
+
+func init() { registerCollector(ingestCollector{}) }
+
+func (ingestCollector) Name() string { return "ingest" }
+func (ingestCollector) Interval() time.Duration { return 0 }
+
+// Collect returns the series pushed within ingest_ttl and forgets the rest.
+func (ingestCollector) Collect(ctx context.Context) ([]Metric, error) {
+	cfgMutex.RLock(); ttl := time.Duration(cmp.Or(config.IngestTTL, 600)) * time.Second; cfgMutex.RUnlock()
+	ingestMutex.Lock(); defer ingestMutex.Unlock()
+	var res []Metric
+	for k, s := range ingestSeries {
+		if time.Since(s.at) > ttl { delete(ingestSeries, k); continue }
+		res = append(res, s.m)
+	}
+	return res, nil
+}
+
+// ingest stores what passes and says why the rest didn't.
+func ingest(points []ingestPoint) (accepted int, errs []fieldError) {
+	ingestMutex.Lock(); defer ingestMutex.Unlock()
+	now := time.Now()
+	for i, p := range points {
+		f := fmt.Sprintf("metrics[%d]", i)
+		if err := checkMetric(p.Metric); err != nil { errs = append(errs, fieldError{f, err.Error()}); continue }
+		if math.IsNaN(p.Value) || math.IsInf(p.Value, 0) { errs = append(errs, fieldError{f, "value must be a finite number"}); continue }
+		key := p.key()
+		s := ingestSeries[key]
+		if s == nil && len(ingestSeries) >= maxIngestSeries { errs = append(errs, fieldError{f, fmt.Sprintf("%s: already %d series", key, maxIngestSeries)}); continue }
+		switch p.Type {
+		case "", "gauge":
+		case "counter":
+			if p.Value < 0 { errs = append(errs, fieldError{f, "a counter only goes up"}); continue }
+			if s != nil { p.Value += s.m.Value }
+		default:
+			errs = append(errs, fieldError{f, "type must be gauge or counter"}); continue
+		}
+		if s == nil { s = &ingested{}; ingestSeries[key] = s }
+		p.Metric.Source = ""
+		s.m, s.at = p.Metric, now
+		accepted++
+	}
+	return accepted, errs
+}
+
+// metricPanels charts every collector series in the latest sample, one panel each, for the default layout.
+func metricPanels() []PanelConfig {
+	var res []PanelConfig
+	for _, mt := range latestSample().Metrics {
+		if len(res) == maxMetricPanels { break }
+		k := mt.key()
+		res = append(res, PanelConfig{ID: "metric:" + k, Title: k, Metrics: []string{"metric:" + k}, Unit: mt.Unit})
+	}
+	return res
+}
+
+// checkMetricRules raises "Metric <series>" through checkAlerts' check.
+func checkMetricRules(cfg AppConfig, m RichMetrics, check func(n string, v, w, c float64, secs int)) {
+	for _, r := range cfg.MetricRules {
+		re := anchoredPattern(r.Metric)
+		if re == nil { continue }
+		for _, mt := range m.Metrics {
+			if k := mt.key(); re.MatchString(k) { check("Metric "+k, mt.Value, limitOff(r.Warn), limitOff(r.Crit), r.For) }
+		}
+	}
+}
+
+func validateMetricRules(c AppConfig, bad func(field, format string, a ...interface{})) {
+	for i, r := range c.MetricRules {
+		f := fmt.Sprintf("metric_rules[%d]", i)
+		if r.Metric == "" { bad(f, "metric is required") } else if _, err := regexp.Compile(r.Metric); err != nil { bad(f, "bad pattern: %v", err) }
+		if r.For < 0 { bad(f, "for must not be negative") }
+	}
+	if c.IngestTTL < 0 { bad("ingest_ttl", "must not be negative") }
+}
+
+func registerIngestAPI(mux *http.ServeMux) {
+	mux.HandleFunc("POST /api/v1/ingest", apiRole("operator", func(w http.ResponseWriter, r *http.Request) {
+		points, ok := decodeBatch[ingestPoint](w, r, "metrics")
+		if !ok { return }
+		n, errs := ingest(points)
+		answerBatch(w, "metric", n, errs)
+	}))
+	mux.HandleFunc("GET /api/v1/ingest", func(w http.ResponseWriter, r *http.Request) {
+		ingestMutex.Lock()
+		res := []Metric{}
+		for _, s := range ingestSeries { res = append(res, s.m) }
+		ingestMutex.Unlock()
+		sort.Slice(res, func(i, j int) bool { return res[i].key() < res[j].key() })
+		apiOK(w, 200, res, &apiMeta{len(res), len(res), 0})
+	})
+}
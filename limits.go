@@ -0,0 +1,104 @@
+package main
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// --- REQUEST LIMITS ---
+// Each client IP may make rate_limit requests a second (Default: 20; -1 turns limiting off) with
+// bursts of up to rate_burst (Default: 5 seconds' worth); past that it gets 429 with Retry-After.
+// Requests on the admin listener and the unix socket are not limited. Bodies are capped at 1 MB. A
+// request must be read within readTimeout and answered within writeTimeout, except on the streams
+// and downloads in longLived; /events instead gives every event streamWriteTimeout, so a stalled
+// browser is dropped rather than keeping its connection forever.
+
+const (
+	defaultRateLimit   = 20
+	maxRequestBody     = 1 << 20
+	readHeaderTimeout  = 10 * time.Second
+	readTimeout        = 30 * time.Second
+	writeTimeout       = 60 * time.Second
+	idleTimeout        = 2 * time.Minute
+	streamWriteTimeout = 10 * time.Second
+)
+
+// longLived are the paths (or path prefixes, ending in /) that may run longer than writeTimeout.
+var longLived = []string{"/events", "/ws", "/history/export", "/api/v1/backup", "/debug/pprof/"}
+
+type rateBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+var (
+	rateBuckets = map[string]*rateBucket{} // by client IP
+	ratePruned  time.Time
+	rateMutex   sync.Mutex
+	rateLimited atomic.Int64 // requests refused, for /status
+)
+
+// newServer is an http.Server with the timeouts every listener uses.
+func newServer(addr string, h http.Handler) *http.Server {
+	return &http.Server{Addr: addr, Handler: h, ReadHeaderTimeout: readHeaderTimeout, IdleTimeout: idleTimeout, MaxHeaderBytes: 64 << 10}
+}
+
+// allowRequest takes a token from ip's bucket, or says how long until there is one.
+func allowRequest(ip string, rate float64, burst int, now time.Time) (bool, time.Duration) {
+	rateMutex.Lock(); defer rateMutex.Unlock()
+	if now.Sub(ratePruned) > time.Minute {
+		// A bucket that has filled up again is the same as no bucket.
+		for k, b := range rateBuckets { if b.tokens+now.Sub(b.last).Seconds()*rate >= float64(burst) { delete(rateBuckets, k) } }
+		ratePruned = now
+	}
+	b := rateBuckets[ip]
+	if b == nil { b = &rateBucket{float64(burst), now}; rateBuckets[ip] = b }
+	b.tokens = math.Min(float64(burst), b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+	if b.tokens >= 1 { b.tokens--; return true, 0 }
+	return false, time.Duration((1 - b.tokens) / rate * float64(time.Second))
+}
+
+func isLongLived(path string) bool {
+	for _, p := range longLived {
+		if path == p || (strings.HasSuffix(p, "/") && strings.HasPrefix(path, p)) { return true }
+	}
+	return false
+}
+
+func limitRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfgMutex.RLock(); rate, burst := config.RateLimit, config.RateBurst; cfgMutex.RUnlock()
+		if rate == 0 { rate = defaultRateLimit }
+		if burst <= 0 { burst = int(math.Ceil(rate * 5)) }
+		api := strings.HasPrefix(r.URL.Path, "/api/")
+		if ip := net.ParseIP(clientIP(r)); rate > 0 && ip != nil && !fromAdminListener(r) {
+			if ok, wait := allowRequest(ip.String(), rate, burst, time.Now()); !ok {
+				rateLimited.Add(1)
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				if api { apiFail(w, http.StatusTooManyRequests, apiError{"rate_limited", "too many requests, slow down", nil}) } else { http.Error(w, "too many requests", http.StatusTooManyRequests) }
+				return
+			}
+		}
+		if r.ContentLength > maxRequestBody {
+			if api { apiFail(w, http.StatusRequestEntityTooLarge, apiError{"too_large", "the body is limited to 1 MB", nil}) } else { http.Error(w, "request body too large (limit 1 MB)", http.StatusRequestEntityTooLarge) }
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, maxRequestBody)
+		// Deadlines outlive the request on a kept-alive connection, so streams clear the previous one.
+		rc, now := http.NewResponseController(w), time.Now()
+		if isLongLived(r.URL.Path) { rc.SetWriteDeadline(time.Time{}) } else { rc.SetReadDeadline(now.Add(readTimeout)); rc.SetWriteDeadline(now.Add(writeTimeout)) }
+		next.ServeHTTP(w, r)
+	})
+}
+
+func validateLimits(c AppConfig, bad func(field, format string, a ...interface{})) {
+	if c.RateLimit < 0 && c.RateLimit != -1 { bad("rate_limit", "must be positive, 0 for the default or -1 for no limit") }
+	if c.RateBurst < 0 { bad("rate_burst", "must not be negative") }
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// --- LISTENERS ---
+// listen is "[host]:port" (or just a port; "none" turns TCP off), listen_socket an optional unix
+// socket for a local reverse proxy, and admin_listen an optional plain-HTTP listener that must be
+// bound to loopback: requests on it act as admin without logging in, and admin actions on the
+// other listeners are refused. base_path serves everything under a prefix such as /pulse; requests
+// from proxies that already strip the prefix keep working.
+
+type ctxKey int
+
+const adminCtx ctxKey = 0
+
+var basePath string // normalised base_path, fixed at startup
+
+func fromAdminListener(r *http.Request) bool { return r.Context().Value(adminCtx) != nil }
+
+func listenAddr(cfg AppConfig) string {
+	switch a := strings.TrimSpace(cfg.Listen); {
+	case a == "": return ":8080"
+	case a == "none": return ""
+	case strings.Trim(a, "0123456789") == "": return ":" + a
+	default: return a
+	}
+}
+
+func normBase(p string) string {
+	if p = strings.Trim(p, "/"); p == "" { return "" }
+	return "/" + p
+}
+
+func withBase(base string, h http.Handler) http.Handler {
+	if base == "" { return h }
+	strip := http.StripPrefix(base, h)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == base: http.Redirect(w, r, base+"/", http.StatusMovedPermanently)
+		case strings.HasPrefix(r.URL.Path, base+"/"): strip.ServeHTTP(w, r)
+		default: h.ServeHTTP(w, r)
+		}
+	})
+}
+
+func asAdmin(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), adminCtx, true)))
+	})
+}
+
+func loopbackOnly(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil { return fmt.Errorf("admin_listen: %w", err) }
+	if ip := net.ParseIP(host); host == "localhost" || (ip != nil && ip.IsLoopback()) { return nil }
+	return fmt.Errorf("admin_listen %q must bind to localhost, 127.0.0.1 or ::1", addr)
+}
+
+// displayURL turns a listen address into something a browser can open.
+func displayURL(scheme, addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil { return scheme + "://" + addr + basePath + "/" }
+	if host == "" || host == "0.0.0.0" || host == "::" { host = "localhost" }
+	return scheme + "://" + net.JoinHostPort(host, port) + basePath + "/"
+}
+
+// startServers starts the admin and unix socket listeners in the background and serves TCP until it fails.
+func startServers(cfg AppConfig, h http.Handler) error {
+	basePath = normBase(cfg.BasePath)
+	addr := listenAddr(cfg)
+	if cfg.AdminListen != "" {
+		if err := loopbackOnly(cfg.AdminListen); err != nil { return err }
+		httpLog.Info("admin listener", "url", displayURL("http", cfg.AdminListen))
+		srv := trackServer(newServer(cfg.AdminListen, withBase(basePath, asAdmin(h))))
+		go func() { if err := srv.ListenAndServe(); err != http.ErrServerClosed { httpLog.Error("admin listener failed", "err", err) } }()
+	}
+	if cfg.ListenSocket != "" {
+		// Only a stale socket from a previous run is removed, never a regular file.
+		if st, err := os.Lstat(cfg.ListenSocket); err == nil && st.Mode()&os.ModeSocket != 0 { os.Remove(cfg.ListenSocket) }
+		ln, err := net.Listen("unix", cfg.ListenSocket)
+		if err != nil { return err }
+		os.Chmod(cfg.ListenSocket, 0660)
+		httpLog.Info("listening", "url", "unix:"+cfg.ListenSocket)
+		srv := trackServer(newServer("", withBase(basePath, h)))
+		if addr == "" { return srv.Serve(ln) }
+		go func() { if err := srv.Serve(ln); err != http.ErrServerClosed { httpLog.Error("socket listener failed", "err", err) } }()
+	}
+	if addr == "" { return errors.New(`listen is "none" and no listen_socket is set`) }
+	return serve(addr, withBase(basePath, h))
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"runtime"
+
+	"github.com/shirou/gopsutil/v3/cpu"
+)
+
+// --- LOAD PER CORE ---
+// A load of 8 keeps a 4-core host queueing and leaves a 64-core one idle, so each sample also
+// carries the host's logical core count and load1 divided by it. load_warn and load_crit are
+// per core, which lets one config serve hosts of every size; the Load panel charts all three
+// averages against the core count.
+
+// normalizeLoad fills in Cores and LoadCore once the load averages are in m.
+func normalizeLoad(m *RichMetrics) {
+	n, err := cpu.Counts(true)
+	if err != nil || n < 1 { n = runtime.NumCPU() }
+	m.Cores = n
+	m.LoadCore = m.Load1 / float64(n)
+}
+
+// checkLoad raises "Load" through checkAlerts' check when load1 per core crosses the thresholds.
+func checkLoad(cfg AppConfig, m RichMetrics, check func(n string, v, w, c float64, secs int)) {
+	check("Load", m.LoadCore, limitOff(cfg.LoadWarn), limitOff(cfg.LoadCrit), cfg.LoadFor)
+}
+
+func validateLoad(c AppConfig, bad func(field, format string, a ...interface{})) {
+	if c.LoadWarn < 0 { bad("load_warn", "must not be negative") }
+	if c.LoadCrit < 0 { bad("load_crit", "must not be negative") }
+	if c.LoadWarn > 0 && c.LoadCrit > 0 && c.LoadWarn >= c.LoadCrit { bad("load_warn", "must be below load_crit (%g)", c.LoadCrit) }
+	if c.LoadFor < 0 { bad("load_for", "must not be negative") }
+}
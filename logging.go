@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- LOGGING ---
+// Runtime messages go through log/slog. Each subsystem has its own logger tagged subsystem=...,
+// and log_levels can raise or lower one of them without touching the rest. log_format "json"
+// writes one object per line; log_file writes to a file rotated at log_max_size MB, keeping
+// log_max_files old copies (file.1 is the newest). Settings apply on the next save or reload.
+// At debug level the http logger also records every request.
+
+var (
+	collectorLog = newLogger("collector")
+	alertLog     = newLogger("alerting")
+	httpLog      = newLogger("http")
+	pluginLog    = newLogger("plugins")
+	configLog    = newLogger("config")
+	storageLog   = newLogger("storage")
+	exportLog    = newLogger("export")
+
+	logSubsystems = []string{"collector", "alerting", "http", "plugins", "config", "storage", "export"}
+
+	logState struct {
+		sync.RWMutex
+		handler slog.Handler
+		level   slog.Level
+		levels  map[string]slog.Level
+		key     string // output settings the handler was built from
+		file    *rotatingFile
+	}
+
+	collectErrs     = make(map[string]bool)
+	collectErrMutex sync.Mutex
+)
+
+func init() {
+	logState.handler = slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug})
+	slog.SetDefault(newLogger(""))
+}
+
+func newLogger(subsystem string) *slog.Logger { return slog.New(logSwitch{subsystem: subsystem}) }
+
+// logSwitch filters by the subsystem's level and hands records to whichever handler the config
+// currently asks for. Groups are flattened.
+type logSwitch struct {
+	subsystem string
+	attrs     []slog.Attr
+}
+
+func (s logSwitch) Enabled(_ context.Context, l slog.Level) bool {
+	logState.RLock(); defer logState.RUnlock()
+	min, ok := logState.levels[s.subsystem]
+	if !ok { min = logState.level }
+	return l >= min
+}
+
+func (s logSwitch) Handle(ctx context.Context, r slog.Record) error {
+	logState.RLock(); h := logState.handler; logState.RUnlock()
+	attrs := s.attrs
+	if s.subsystem != "" { attrs = append([]slog.Attr{slog.String("subsystem", s.subsystem)}, attrs...) }
+	if len(attrs) > 0 { h = h.WithAttrs(attrs) }
+	return h.Handle(ctx, r)
+}
+
+func (s logSwitch) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return logSwitch{s.subsystem, append(slices.Clip(s.attrs), attrs...)}
+}
+
+func (s logSwitch) WithGroup(string) slog.Handler { return s }
+
+func parseLevel(s string) (slog.Level, error) {
+	var l slog.Level
+	if s == "" { return slog.LevelInfo, nil }
+	if strings.EqualFold(s, "warning") { s = "warn" }
+	err := l.UnmarshalText([]byte(s))
+	return l, err
+}
+
+// applyLogging switches levels, format and output to those in c.
+func applyLogging(c AppConfig) {
+	lv, _ := parseLevel(c.LogLevel)
+	levels := make(map[string]slog.Level)
+	for sub, s := range c.LogLevels { if l, err := parseLevel(s); err == nil { levels[sub] = l } }
+	size, keep := c.LogMaxSize, c.LogMaxFiles
+	if size <= 0 { size = 10 }
+	if keep <= 0 { keep = 5 }
+	key := fmt.Sprint(c.LogFormat, "|", c.LogFile, "|", size, "|", keep)
+	logState.Lock()
+	logState.level, logState.levels = lv, levels
+	if key == logState.key { logState.Unlock(); return }
+	var w io.Writer = os.Stdout
+	var rf *rotatingFile
+	var err error
+	if c.LogFile != "" {
+		if rf, err = openRotating(c.LogFile, int64(size)<<20, keep); err == nil { w = rf }
+	}
+	opts := &slog.HandlerOptions{Level: slog.LevelDebug}
+	if c.LogFormat == "json" { logState.handler = slog.NewJSONHandler(w, opts) } else { logState.handler = slog.NewTextHandler(w, opts) }
+	old := logState.file
+	logState.file, logState.key = rf, key
+	logState.Unlock()
+	if old != nil { old.Close() }
+	if err != nil { configLog.Error("cannot open log file, logging to stdout", "file", c.LogFile, "err", err) }
+}
+
+// rotatingFile is an io.Writer that renames path to path.1 (and so on) once it reaches max bytes.
+type rotatingFile struct {
+	mu   sync.Mutex
+	path string
+	max  int64
+	keep int
+	f    *os.File
+	size int64
+}
+
+func openRotating(path string, max int64, keep int) (*rotatingFile, error) {
+	r := &rotatingFile{path: path, max: max, keep: keep}
+	return r, r.open()
+}
+
+func (r *rotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0640)
+	if err != nil { return err }
+	r.f, r.size = f, 0
+	if st, err := f.Stat(); err == nil { r.size = st.Size() }
+	return nil
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock(); defer r.mu.Unlock()
+	if r.f == nil { return 0, os.ErrClosed }
+	if r.size > 0 && r.size+int64(len(p)) > r.max {
+		r.f.Close()
+		for i := r.keep - 1; i >= 1; i-- { os.Rename(fmt.Sprintf("%s.%d", r.path, i), fmt.Sprintf("%s.%d", r.path, i+1)) }
+		os.Rename(r.path, r.path+".1")
+		if err := r.open(); err != nil { r.f = nil; return 0, err }
+	}
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *rotatingFile) Close() error {
+	r.mu.Lock(); defer r.mu.Unlock()
+	if r.f == nil { return nil }
+	err := r.f.Close(); r.f = nil
+	return err
+}
+
+// collectErr logs a failed metrics call: a warning the first time an error shows up (typically a
+// permission problem), debug after that, so a lasting failure doesn't flood the log.
+func collectErr(what string, err error) {
+	if err == nil { return }
+	k := what + ": " + err.Error()
+	collectErrMutex.Lock()
+	if len(collectErrs) > 1000 { collectErrs = make(map[string]bool) }
+	first := !collectErrs[k]; collectErrs[k] = true
+	collectErrMutex.Unlock()
+	if first { collectorLog.Warn("collection failed", "metric", what, "err", err) } else { collectorLog.Debug("collection failed", "metric", what, "err", err) }
+}
+
+type statusWriter struct {
+	http.ResponseWriter
+	code int
+}
+
+func (w *statusWriter) WriteHeader(code int) { w.code = code; w.ResponseWriter.WriteHeader(code) }
+
+func (w *statusWriter) Flush() { if f, ok := w.ResponseWriter.(http.Flusher); ok { f.Flush() } }
+
+func (w *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.code = http.StatusSwitchingProtocols
+	return http.NewResponseController(w.ResponseWriter).Hijack()
+}
+
+func (w *statusWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+// logRequests records each request at debug level.
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !httpLog.Enabled(r.Context(), slog.LevelDebug) { next.ServeHTTP(w, r); return }
+		sw, start := &statusWriter{w, http.StatusOK}, time.Now()
+		r, _ = withUser(r) // so currentUser below sees who requireAuth let in
+		next.ServeHTTP(sw, r)
+		httpLog.Debug("request", "method", r.Method, "path", r.URL.Path, "status", sw.code, "remote", r.RemoteAddr, "user", currentUser(r), "duration", time.Since(start))
+	})
+}
@@ -2,13 +2,15 @@ package main
 
 import (
 	"bytes"
-	"compress/gzip"
-	"crypto/tls"
-	"encoding/gob"
+	"context"
+	"embed"
 	"encoding/json"
+	"flag"
 	"fmt"
+	"io"
+	"log/slog"
+	"math"
 	"net/http"
-	"net/smtp"
 	"os"
 	"os/exec"
 	"os/signal"
@@ -18,6 +20,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"text/template"
 	"syscall"
 	"time"
 
@@ -31,42 +34,248 @@ import (
 )
 
 // --- 1. CONFIGURATION ---
-const historySeconds = 259200 // 3 Days
-const dbFile = "pulse_v30.data.gz"
-const confFile = "pulse.conf"
+// File locations are variables so --data-dir, --config and data_file can change them.
+var dbFile = "pulse_v30.data.gz"
+var confFile = "pulse.conf"
+var auditFile = "pulse.audit.log"
+const maxAlertHistory = 1000
 
 // --- 2. DATA STRUCTURES ---
 type AppConfig struct {
-	GlobalInt  int      `json:"global_int"`
-	ProcessInt int      `json:"process_int"`
-	ScriptInt  int      `json:"script_int"`
-	CpuWarn    float64  `json:"cpu_warn"`
-	CpuCrit    float64  `json:"cpu_crit"`
-	MemWarn    float64  `json:"mem_warn"`
-	MemCrit    float64  `json:"mem_crit"`
-	DskWarn    float64  `json:"dsk_warn"`
-	DskCrit    float64  `json:"dsk_crit"`
-	SmtpHost   string   `json:"smtp_host"`
-	SmtpPort   int      `json:"smtp_port"`
-	SmtpUser   string   `json:"smtp_user"`
-	SmtpPass   string   `json:"smtp_pass"`
-	EmailTo    string   `json:"email_to"`
-	Scripts    []string `json:"scripts"`
+	GlobalInt           int                 `json:"global_int"`
+	ProcessInt          int                 `json:"process_int"`
+	ProcessLimit        int                 `json:"process_limit"`
+	ProcessKeyCmdline   []string            `json:"process_key_cmdline"`
+	EBPF                []string            `json:"ebpf"`
+	GeoIPDB             []string            `json:"geoip_db"`
+	ExpectedPorts       []string            `json:"expected_ports"` // "22", "tcp/443", "udp/53", "tcp/30000-32767"
+	ARPSubnets          []string            `json:"arp_subnets"`    // IPv4 CIDRs whose ARP entries are watched
+	ScriptInt           int                 `json:"script_int"`
+	ScriptTimeout       int                 `json:"script_timeout"`
+	ScriptWorkers       int                 `json:"script_workers"`
+	CpuWarn             float64             `json:"cpu_warn"`
+	CpuCrit             float64             `json:"cpu_crit"`
+	MemWarn             float64             `json:"mem_warn"`
+	MemCrit             float64             `json:"mem_crit"`
+	DskWarn             float64             `json:"dsk_warn"`
+	DskCrit             float64             `json:"dsk_crit"`
+	CpuFor              int                 `json:"cpu_for"`
+	MemFor              int                 `json:"mem_for"`
+	DskFor              int                 `json:"dsk_for"`
+	LoadWarn            float64             `json:"load_warn"`      // load1 per core
+	LoadCrit            float64             `json:"load_crit"`
+	LoadFor             int                 `json:"load_for"`
+	SmtpHost            string              `json:"smtp_host"`
+	SmtpPort            int                 `json:"smtp_port"`
+	SmtpUser            string              `json:"smtp_user"`
+	SmtpPass            string              `json:"smtp_pass"`
+	EmailTo             string              `json:"email_to"`
+	EmailFrom           string              `json:"email_from"`
+	SmtpTLS             string              `json:"smtp_tls"`
+	SmtpSkipVerify      bool                `json:"smtp_skip_verify"`
+	SmtpCA              string              `json:"smtp_ca"`
+	EmailSubject        string              `json:"email_subject"`
+	EmailBody           string              `json:"email_body"`
+	DigestSchedule      string              `json:"digest_schedule"`
+	DigestTime          string              `json:"digest_time"`
+	DigestDay           string              `json:"digest_day"`
+	DigestEmailTo       string              `json:"digest_email_to"`
+	DigestWebhook       string              `json:"digest_webhook"`
+	AnomalySigma        float64             `json:"anomaly_sigma"`
+	AnomalyMinSamples   int                 `json:"anomaly_min_samples"`
+	AnomalyLevel        string              `json:"anomaly_level"`
+	ForecastDays        int                 `json:"forecast_days"`
+	ForecastMethod      string              `json:"forecast_method"`
+	RateRules           []RateRule          `json:"rate_rules"`
+	GroupRules          []GroupRule         `json:"group_rules"`
+	Users               []UserConfig        `json:"users,omitempty"`
+	TLSCert             string              `json:"tls_cert"`
+	TLSKey              string              `json:"tls_key"`
+	TLSSelfSigned       bool                `json:"tls_self_signed"`
+	ACMEDomain          string              `json:"acme_domain"`
+	ACMEEmail           string              `json:"acme_email"`
+	ACMECacheDir        string              `json:"acme_cache_dir"`
+	Listen              string              `json:"listen"`
+	ListenSocket        string              `json:"listen_socket"`
+	AdminListen         string              `json:"admin_listen"`
+	BasePath            string              `json:"base_path"`
+	TrustedProxies      []string            `json:"trusted_proxies"`
+	AllowFrom           AllowFrom           `json:"allow_from"` // client IPs or CIDRs per endpoint class; empty allows all
+	CORSOrigins         []string            `json:"cors_origins"`
+	RateLimit           float64             `json:"rate_limit"` // requests a second per client IP; 0: 20, -1: no limit
+	RateBurst           int                 `json:"rate_burst"` // 0: 5 seconds' worth
+	DebugEndpoints      bool                `json:"debug_endpoints"`
+	LogLevel            string              `json:"log_level"`
+	LogLevels           map[string]string   `json:"log_levels"`
+	LogFormat           string              `json:"log_format"`
+	LogFile             string              `json:"log_file"`
+	LogMaxSize          int                 `json:"log_max_size"`
+	LogMaxFiles         int                 `json:"log_max_files"`
+	Retention           string              `json:"retention"`
+	DataFile            string              `json:"data_file"`
+	SaveInterval        int                 `json:"save_interval"`
+	HistoryQuotaMB      int                 `json:"history_quota_mb"`
+	TelegramToken       string              `json:"telegram_token"`
+	TelegramChatIDs     []string            `json:"telegram_chat_ids"`
+	TeamsWebhook        string              `json:"teams_webhook"`
+	GChatWebhook        string              `json:"gchat_webhook"`
+	TwilioSID           string              `json:"twilio_sid"`
+	TwilioToken         string              `json:"twilio_token"`
+	TwilioFrom          string              `json:"twilio_from"`
+	TwilioTo            []string            `json:"twilio_to"`
+	TwilioVoice         bool                `json:"twilio_voice"`
+	SeverityChannels    map[string][]string `json:"severity_channels"`
+	NtfyURL             string              `json:"ntfy_url"`
+	NtfyTopic           string              `json:"ntfy_topic"`
+	NtfyToken           string              `json:"ntfy_token"`
+	GotifyURL           string              `json:"gotify_url"`
+	GotifyToken         string              `json:"gotify_token"`
+	OpsgenieKey         string              `json:"opsgenie_key"`
+	OpsgenieURL         string              `json:"opsgenie_url"`
+	VictorOpsURL        string              `json:"victorops_url"`
+	VictorOpsRoutingKey string              `json:"victorops_routing_key"`
+	AlertmanagerURL     string              `json:"alertmanager_url"`
+	AlertmanagerUser    string              `json:"alertmanager_user"`
+	AlertmanagerPass    string              `json:"alertmanager_pass"`
+	AlertmanagerLabels  map[string]string   `json:"alertmanager_labels"`
+	PushContact         string              `json:"push_contact"`
+	MqttBroker          string              `json:"mqtt_broker"`
+	MqttUser            string              `json:"mqtt_user"`
+	MqttPass            string              `json:"mqtt_pass"`
+	MqttTopic           string              `json:"mqtt_topic"`
+	MqttInterval        int                 `json:"mqtt_interval"`
+	InfluxURL           string              `json:"influx_url"`
+	InfluxToken         string              `json:"influx_token"`
+	RemoteWriteURL      string              `json:"remote_write_url"`
+	RemoteWriteToken    string              `json:"remote_write_token"`
+	ForwardBatch        int                 `json:"forward_batch"`
+	ForwardBuffer       int                 `json:"forward_buffer"`
+	ForwardSpoolMB      int                 `json:"forward_spool_mb"` // disk for samples beyond forward_buffer
+	GraphiteAddr        string              `json:"graphite_addr"`
+	StatsdAddr          string              `json:"statsd_addr"`
+	StatsdListen        string              `json:"statsd_listen"` // UDP address to take StatsD from apps on
+	StatsdFlush         int                 `json:"statsd_flush"`
+	MetricsPrefix       string              `json:"metrics_prefix"`
+	MetricsInterval     int                 `json:"metrics_interval"`
+	MetricsWhitelist    []string            `json:"metrics_whitelist"`
+	PassiveType         string              `json:"passive_type"`
+	PassiveTarget       string              `json:"passive_target"`
+	PassiveUser         string              `json:"passive_user"`
+	PassivePass         string              `json:"passive_pass"`
+	PassiveHost         string              `json:"passive_host"`
+	PassiveInterval     int                 `json:"passive_interval"`
+	PassiveSkipVerify   bool                `json:"passive_skip_verify"`
+	NotifyCommand       string              `json:"notify_command"`
+	HostMeta            HostMeta            `json:"host_meta"`
+	FederateSources     []FederateSource    `json:"federate_sources"`
+	FederateInterval    int                 `json:"federate_interval"`
+	FleetGroups         []FleetGroup        `json:"fleet_groups"`
+	ConfigTemplates     []ConfigTemplate    `json:"config_templates"`
+	Routes              []RouteRule         `json:"routes"`
+	Scripts             []ScriptConfig      `json:"scripts"`
+	Collectors          []CollectorConfig   `json:"collectors"`
+	IngestTTL           int                 `json:"ingest_ttl"` // seconds an ingested series lasts without a push
+	MetricRules         []MetricRule        `json:"metric_rules"`
+	DerivedMetrics      []DerivedMetric     `json:"derived_metrics"`
+	MetricCatalog       MetricCatalog       `json:"metric_catalog"` // display name, unit and scale per field
+	SLATarget           float64             `json:"sla_target"` // % for reports; 0 = 99.9
+	Heartbeats          []HeartbeatConfig   `json:"heartbeats"`
+	Remediations        []RemediationConfig `json:"remediations"`
+	Panels              []PanelConfig       `json:"panels"`
+	DefaultPreferences  Preferences         `json:"default_preferences"`
+	StatusPage          StatusPage          `json:"status_page"`
+}
+
+type ScriptConfig struct {
+	Name      string            `json:"name,omitempty"`
+	Type      string            `json:"type,omitempty"`
+	Command   string            `json:"command"`
+	Target    string            `json:"target,omitempty"`
+	Pattern   string            `json:"pattern,omitempty"`
+	Warn      string            `json:"warn,omitempty"`
+	Crit      string            `json:"crit,omitempty"`
+	Interval  int               `json:"interval,omitempty"`
+	Timeout   int               `json:"timeout,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+	Dir       string            `json:"dir,omitempty"`
+	For       int               `json:"for,omitempty"`
+	Recursive bool              `json:"recursive,omitempty"` // dir_count: count files in subdirectories too
+	stdin     []byte
+}
+
+// UnmarshalJSON also accepts the older plain command-line string form of a script.
+func (s *ScriptConfig) UnmarshalJSON(b []byte) error {
+	var cmd string
+	if json.Unmarshal(b, &cmd) == nil { *s = ScriptConfig{Command: cmd}; return nil }
+	type plain ScriptConfig
+	return json.Unmarshal(b, (*plain)(s))
+}
+
+func (s ScriptConfig) builtin() bool { return s.Type != "" && s.Type != "script" }
+
+// label is the Path reported for a script: its command line, or "type target" for built-in checks.
+func (s ScriptConfig) label() string {
+	if !s.builtin() { return s.Command }
+	if s.Type == "regex" { return s.Type + " " + s.Command }
+	return s.Type + " " + s.Target
+}
+
+func (s ScriptConfig) key() string { if s.Name != "" { return s.Name }; return s.label() }
+
+type HeartbeatConfig struct {
+	Name     string `json:"name"`
+	Interval int    `json:"interval"`
+}
+
+type HeartbeatStatus struct {
+	Name     string `json:"name"`
+	Interval int    `json:"interval"`
+	LastSeen int64  `json:"last_seen"`
+	Late     bool   `json:"late"`
+}
+
+type AlertEvent struct {
+	ID          int64   `json:"id"`
+	Time        int64   `json:"time"`
+	Monitor     string  `json:"monitor"`
+	Level       string  `json:"level"`
+	Value       float64 `json:"value"`
+	Message     string  `json:"message"`
+	Host        string  `json:"host"`
+	Remediation string  `json:"remediation,omitempty"`
 }
 
 type PluginData struct {
-	Path     string  `json:"path"`
-	ExitCode int     `json:"exit_code"`
-	Output   string  `json:"output"`
-	PerfVal  float64 `json:"perf_val"`
-	PerfUnit string  `json:"perf_unit"`
+	Path       string       `json:"path"`
+	Name       string       `json:"name,omitempty"`
+	ExitCode   int          `json:"exit_code"`
+	Output     string       `json:"output"`
+	PerfVal    float64      `json:"perf_val"`
+	PerfUnit   string       `json:"perf_unit"`
+	Perf       []PerfMetric `json:"perf"`
+	LongOutput string       `json:"long_output,omitempty"`
+	Stderr     string       `json:"stderr,omitempty"`
+	Duration   float64      `json:"duration"`
+	TimedOut   bool         `json:"timed_out"`
+}
+
+type PerfMetric struct {
+	Label string   `json:"label"`
+	Value float64  `json:"value"`
+	Unit  string   `json:"unit"`
+	Warn  string   `json:"warn,omitempty"`
+	Crit  string   `json:"crit,omitempty"`
+	Min   *float64 `json:"min,omitempty"`
+	Max   *float64 `json:"max,omitempty"`
 }
 
 type PortInfo struct {
-	Port  int    `json:"port"`
-	Proto string `json:"proto"`
-	PID   int32  `json:"pid"`
-	Name  string `json:"name"`
+	Port       int    `json:"port"`
+	Proto      string `json:"proto"`
+	PID        int32  `json:"pid"`
+	Name       string `json:"name"`
+	Addr       string `json:"addr,omitempty"`       // the bound address: 0.0.0.0 or :: for all of them
+	Unexpected bool   `json:"unexpected,omitempty"` // listening beyond loopback but not in expected_ports
 }
 
 type ProcessInfo struct {
@@ -76,25 +285,44 @@ type ProcessInfo struct {
 	Mem       float64 `json:"mem"`
 	DiskRead  uint64  `json:"d_read"`
 	DiskWrite uint64  `json:"d_write"`
+	Group     string  `json:"group,omitempty"`
+	Key       string  `json:"key,omitempty"` // name#cmdline-hash for process_key_cmdline names; else the name is the key
 }
 
 type RichMetrics struct {
-	Timestamp   int64         `json:"ts"`
-	Hostname    string        `json:"host"`
-	Uptime      uint64        `json:"uptime"`
-	Load1       float64       `json:"load1"`
-	Procs       int           `json:"procs"`
-	CPUTotal    float64       `json:"cpu_tot"`
-	MemUsed     float64       `json:"mem_used"`
-	SwapUsed    float64       `json:"swp_used"`
-	DiskUsed    float64       `json:"dsk_used"`
-	DiskRead    uint64        `json:"dsk_read"`
-	DiskWrite   uint64        `json:"dsk_writ"`
-	NetDown     uint64        `json:"net_down"`
-	NetUp       uint64        `json:"net_up"`
-	ProcessList []ProcessInfo `json:"p_list"`
-	OpenPorts   []PortInfo    `json:"ports"`
-	Plugins     []PluginData  `json:"plugins"`
+	Timestamp   int64             `json:"ts"`
+	Hostname    string            `json:"host"`
+	Uptime      uint64            `json:"uptime"`
+	Load1       float64           `json:"load1"`
+	Load5       float64           `json:"load5"`
+	Load15      float64           `json:"load15"`
+	Cores       int               `json:"cores,omitempty"`       // logical
+	LoadCore    float64           `json:"load_core"`             // load1 / cores
+	Procs       int               `json:"procs"`
+	CPUTotal    float64           `json:"cpu_tot"`
+	MemUsed     float64           `json:"mem_used"`
+	SwapUsed    float64           `json:"swp_used"`
+	DiskUsed    float64           `json:"dsk_used"`
+	DiskRead    uint64            `json:"dsk_read"`
+	DiskWrite   uint64            `json:"dsk_writ"`
+	NetDown     uint64            `json:"net_down"`
+	NetUp       uint64            `json:"net_up"`
+	ProcessList []ProcessInfo     `json:"p_list"`
+	OpenPorts   []PortInfo        `json:"ports"`
+	Plugins     []PluginData      `json:"plugins"`
+	Heartbeats  []HeartbeatStatus `json:"heartbeats"`
+	Mounts      []MountUsage      `json:"mounts"`
+	Disks       []DiskIO          `json:"disks,omitempty"`
+	Groups      []ProcessGroup    `json:"groups,omitempty"`
+	PSICPU      float64           `json:"psi_cpu,omitempty"`     // % of the time some task was stalled waiting for CPU
+	PSIIO       float64           `json:"psi_io,omitempty"`
+	PSIIOFull   float64           `json:"psi_io_full,omitempty"` // "full": all non-idle tasks were stalled at once
+	PSIMem      float64           `json:"psi_mem,omitempty"`
+	PSIMemFull  float64           `json:"psi_mem_full,omitempty"`
+	CPUMHz      float64           `json:"cpu_mhz,omitempty"`     // average over the cores
+	CoreMHz     []float64         `json:"core_mhz,omitempty"`
+	Throttles   uint64            `json:"throttles,omitempty"`   // thermal and power-limit throttling events since the previous sample
+	Metrics     []Metric          `json:"metrics,omitempty"`     // from collectors (collectors.go)
 }
 
 // --- GLOBAL STATE ---
@@ -102,641 +330,734 @@ var (
 	config    AppConfig
 	cfgMutex  sync.RWMutex
 
-	history      []RichMetrics
+	history      sampleRing
 	historyMutex sync.RWMutex
 	
 	latestMetric RichMetrics
 	latestMutex  sync.RWMutex
 
-	broadcast = make(chan struct{})
 
 	prevNet      net.IOCountersStat
-	prevDisk     map[string]disk.IOCountersStat
-	prevProcIO   map[int32]process.IOCountersStat
-	procCache    map[int32]*process.Process
 	initRate     bool = true
 
 	latestProcs   []ProcessInfo
 	latestPorts   []PortInfo
-	latestPlugins []PluginData
+	pluginResults = make(map[string]PluginData)
+	pluginDetails = make(map[string]PluginData)
+	scriptRunning = make(map[string]bool)
 	dataMutex     sync.RWMutex
 	procIOMutex   sync.Mutex
+	scriptSlotsUsed int
+	scriptSlotMutex sync.Mutex
+	scriptSlotCond  = sync.NewCond(&scriptSlotMutex)
 
-	lastEmailTime map[string]time.Time
+	lastAlertTime map[string]time.Time
+	activeAlerts  = make(map[string]string)
 	alertMutex    sync.Mutex
+	alertPending  = make(map[string]int64) // first breach of monitors with a "for" duration; collector only
+
+	alertHistory  []AlertEvent
+	alertSeq      int64
+	alertLogMutex sync.RWMutex
+
+	heartbeatSeen  = make(map[string]time.Time)
+	heartbeatMutex sync.Mutex
+	startTime      = time.Now()
 )
 
 // --- 3. THE DASHBOARD ---
-const htmlDashboard = `
-<!DOCTYPE html>
-<html lang="en">
-<head>
-    <meta charset="UTF-8">
-    <title>Pulse | Enterprise Alerting</title>
-    <style>
-        :root { --bg: #121212; --card: #1e1e1e; --text: #e0e0e0; --cpu: #00d1b2; --mem: #209cee; --dsk: #ff3860; --net: #ffdd57; --accent: #bd93f9; }
-        body { background-color: var(--bg); color: var(--text); font-family: 'Segoe UI', monospace; margin: 0; padding: 15px; box-sizing: border-box; overflow: hidden; }
-        * { box-sizing: border-box; }
-
-        .header { display: flex; flex-direction: column; gap: 15px; margin-bottom: 20px; border-bottom: 1px solid #333; padding-bottom: 15px; }
-        .top-row { display: flex; justify-content: space-between; align-items: center; }
-        .controls-row { display: flex; align-items: center; gap: 10px; background: #1a1a1a; padding: 5px 10px; border-radius: 6px; border: 1px solid #333; flex-wrap: wrap; }
-
-        button { background: #333; border: none; color: #ccc; padding: 5px 10px; cursor: pointer; border-radius: 3px; font-size: 11px; transition: 0.2s; }
-        button:hover { background: #555; color: white; }
-        button.active { background: var(--cpu); color: #000; font-weight: bold; }
-        button.live-btn { background: #ff3860; color: white; font-weight: bold; display: none; }
-        input, select { background: #222; border: 1px solid #444; color: #fff; padding: 3px; border-radius: 3px; font-size: 11px; }
-
-        .badge { font-size: 10px; padding: 2px 6px; border-radius: 3px; text-transform: uppercase; font-weight: bold; margin-left: 10px; }
-        .badge.live { background: rgba(0, 209, 178, 0.2); color: var(--cpu); border: 1px solid var(--cpu); }
-        .badge.hist { background: rgba(255, 221, 87, 0.2); color: var(--net); border: 1px solid var(--net); }
-
-        .grid-main { display: grid; grid-template-columns: 3fr 1fr; gap: 15px; height: calc(100vh - 180px); }
-        .col-left { display: flex; flex-direction: column; gap: 15px; overflow-y: auto; padding-right: 5px; padding-bottom: 150px; }
-        .col-right { display: flex; flex-direction: column; gap: 15px; overflow-y: auto; height: 100%; padding-bottom: 100px; }
-
-        .card { background: var(--card); border: 1px solid #333; border-radius: 6px; padding: 10px; position: relative; display: flex; flex-direction: column; overflow: hidden; }
-        .card-header { display: flex; justify-content: space-between; align-items: center; margin-bottom: 5px; height: 20px; flex-shrink: 0; }
-        .card-title { font-size: 11px; color: #888; text-transform: uppercase; font-weight: bold; white-space: nowrap; overflow: hidden; text-overflow: ellipsis; max-width: 70%; }
-        .legend { display: flex; gap: 10px; font-size: 10px; }
-        .canvas-wrapper { flex: 1; position: relative; min-height: 0; width: 100%; }
-        canvas { width: 100%; height: 100%; display: block; }
-        
-        .zoom-overlay { position: absolute; top: 5px; right: 5px; display: flex; gap: 2px; opacity: 0.3; transition: opacity 0.2s; z-index: 10; }
-        .card:hover .zoom-overlay { opacity: 1; }
-        .zoom-btn { padding: 2px 6px; font-size: 10px; background: #000; border: 1px solid #444; color: #fff; }
-
-        .drill-controls { display: flex; gap: 10px; margin-bottom: 10px; align-items: center; background: #252525; padding: 10px; border-radius: 4px; flex-shrink: 0; }
-        select { background: #111; color: #fff; border: 1px solid #444; padding: 5px; border-radius: 4px; width: 300px; }
-        .drill-grid { display: grid; grid-template-columns: 1fr 1fr 1fr; gap: 10px; height: 260px; margin-top: 10px; display: none; }
-        .drill-grid.active { display: grid; }
-        .drill-item { border: 1px solid #333; padding: 5px; border-radius: 4px; display: flex; flex-direction: column; min-width: 0; }
-
-        .modal { display: none; position: fixed; top: 0; left: 0; width: 100%; height: 100%; background: rgba(0,0,0,0.8); z-index: 5000; justify-content: center; align-items: center; }
-        .modal-content { background: #1e1e1e; padding: 20px; border-radius: 8px; border: 1px solid #444; width: 600px; max-height: 90vh; overflow-y: auto; }
-        .form-group { margin-bottom: 10px; display: flex; justify-content: space-between; align-items: center; }
-        .form-group label { font-size: 12px; color: #ccc; }
-        .form-group input { width: 60%; }
-        .section-title { border-bottom: 1px solid #444; margin: 15px 0 10px 0; font-size: 14px; color: var(--cpu); padding-bottom: 5px; }
-
-        .status-0 { border-left: 3px solid #00d1b2; }
-        .status-1 { border-left: 3px solid #ffdd57; } /* Warn */
-        .status-2 { border-left: 3px solid #ff3860; } /* Crit */
-        .status-3 { border-left: 3px solid #888; }
-        .plugin-row { display: flex; justify-content: flex-end; font-size: 10px; margin-left: 10px; color: #fff; white-space: nowrap; overflow: hidden; text-overflow: ellipsis; max-width: 30%; }
-
-        .table-wrapper { overflow-y: auto; flex: 1; }
-        table { width: 100%; border-collapse: collapse; font-size: 10px; }
-        th { text-align: left; color: #666; padding: 4px; position: sticky; top: 0; background: var(--card); border-bottom: 1px solid #444; }
-        td { padding: 3px 4px; border-bottom: 1px solid #2a2a2a; white-space: nowrap; overflow: hidden; text-overflow: ellipsis; max-width: 120px; }
-        .val-cell { text-align: right; color: #fff; }
-
-        #tooltip { position: absolute; display: none; background: rgba(0,0,0,0.95); padding: 8px; border: 1px solid #555; font-size: 11px; pointer-events: none; z-index: 1000; box-shadow: 0 4px 10px rgba(0,0,0,0.5); white-space: nowrap; }
-    </style>
-</head>
-<body>
-    <div id="tooltip"></div>
-    
-    <div id="settings-modal" class="modal">
-        <div class="modal-content">
-            <h2 style="margin-top:0;">Configuration</h2>
-            <div class="section-title">Custom Monitors (Nagios Scripts)</div>
-            <textarea id="in-scripts" style="width:100%; height: 80px; background:#111; color:#ccc; border:1px solid #444; font-family:monospace;" placeholder="e.g. /root/check_disk.sh -w 90 -c 95"></textarea>
-            <div class="section-title">Update Rates (Seconds)</div>
-            <div class="form-group"><label>Global:</label><input type="number" id="in-int-g"></div>
-            <div class="form-group"><label>Process:</label><input type="number" id="in-int-p"></div>
-            <div class="form-group"><label>Scripts:</label><input type="number" id="in-int-s"></div>
-            <div class="section-title">Alert Thresholds</div>
-            <div class="form-group"><label>CPU Warn/Crit:</label><span><input type="number" id="in-cpu-w" style="width:60px"> / <input type="number" id="in-cpu-c" style="width:60px"></span></div>
-            <div class="form-group"><label>Mem Warn/Crit:</label><span><input type="number" id="in-mem-w" style="width:60px"> / <input type="number" id="in-mem-c" style="width:60px"></span></div>
-            <div class="form-group"><label>Disk Warn/Crit:</label><span><input type="number" id="in-dsk-w" style="width:60px"> / <input type="number" id="in-dsk-c" style="width:60px"></span></div>
-            <div class="section-title">Email</div>
-            <div class="form-group"><label>Host/Port:</label><span><input type="text" id="in-smtp-host" style="width:100px"> : <input type="number" id="in-smtp-port" style="width:50px"></span></div>
-            <div class="form-group"><label>User:</label><input type="text" id="in-smtp-user"></div>
-            <div class="form-group"><label>Pass:</label><input type="password" id="in-smtp-pass"></div>
-            <div class="form-group"><label>To:</label><input type="text" id="in-email-to"></div>
-            <div style="margin-top:20px; text-align:right;">
-                <button onclick="closeSettings()">Cancel</button>
-                <button onclick="saveSettings()" class="active">Save & Apply</button>
-            </div>
-        </div>
-    </div>
-
-    <div class="header">
-        <div class="top-row">
-            <h1 style="margin:0; font-size: 20px;">PULSE <span style="color:#666; font-size:0.6em;">// ENTERPRISE</span> <span id="mode-badge" class="badge live">LIVE</span></h1>
-            <button onclick="openSettings()" style="margin-left:20px;">⚙️ SETTINGS</button>
-        </div>
-        <div class="controls-row">
-            <span style="font-size:10px; color:#666;">ZOOM:</span>
-            <button onclick="zoom(0.3)">+</button> <button onclick="zoom(-0.3)">-</button>
-            <button onclick="setLiveDuration(1800)" class="active">30M</button>
-            <button onclick="setLiveDuration(86400)">24H</button>
-            <div style="width:1px; height:15px; background:#444; margin:0 5px;"></div>
-            <input type="datetime-local" id="dp-start">
-            <input type="datetime-local" id="dp-end">
-            <button onclick="applyRange()">GO</button>
-            <button id="btn-live" class="live-btn" onclick="goLive()">RETURN LIVE</button>
-        </div>
-    </div>
-
-    <div class="grid-main">
-        <div class="col-left">
-            <div class="card" style="height: 250px; min-height: 250px;">
-                <div class="card-header">
-                    <div class="card-title">System Resources</div>
-                    <div class="legend"><span style="color:#00d1b2">● CPU</span> <span style="color:#209cee">● RAM</span></div>
-                </div>
-                <div class="canvas-wrapper"><canvas id="c-global"></canvas><div class="zoom-overlay"><button class="zoom-btn" onclick="zoomIn()">+</button><button class="zoom-btn" onclick="zoomOut()">-</button></div></div>
-            </div>
-
-            <div style="display: grid; grid-template-columns: 1fr 1fr; gap: 15px; height: 180px; min-height: 180px;">
-                <div class="card">
-                    <div class="card-header"><div class="card-title">Network</div><div class="legend"><span style="color:#ffdd57">● Rx</span> <span style="color:#bd93f9">● Tx</span></div></div>
-                    <div class="canvas-wrapper"><canvas id="c-net"></canvas><div class="zoom-overlay"><button class="zoom-btn" onclick="zoomIn()">+</button><button class="zoom-btn" onclick="zoomOut()">-</button></div></div>
-                </div>
-                <div class="card">
-                    <div class="card-header"><div class="card-title">Disk I/O</div><div class="legend"><span style="color:#ff3860">● Rd</span> <span style="color:#00d1b2">● Wr</span></div></div>
-                    <div class="canvas-wrapper"><canvas id="c-disk"></canvas><div class="zoom-overlay"><button class="zoom-btn" onclick="zoomIn()">+</button><button class="zoom-btn" onclick="zoomOut()">-</button></div></div>
-                </div>
-            </div>
-
-            <div id="plugin-container"></div>
-
-            <div class="card" style="height: auto; min-height: 350px;">
-                <div class="card-header"><div class="card-title">Process Inspector</div></div>
-                <div style="display:flex; gap:10px; margin-bottom:10px;">
-                    <input type="text" id="proc-filter" placeholder="Search..." onkeyup="filterProc()" style="width:100px;">
-                    <select id="proc-select" onchange="selProc(this.value)"><option value="">-- Select Process --</option></select>
-                </div>
-                <div id="drill-view" style="display:grid; grid-template-columns:1fr 1fr 1fr; gap:10px; height:250px; display:none;">
-                    <div class="card"><div class="card-title">CPU %</div><div class="canvas-wrapper"><canvas id="c-p-cpu"></canvas></div></div>
-                    <div class="card"><div class="card-title">Memory</div><div class="canvas-wrapper"><canvas id="c-p-mem"></canvas></div></div>
-                    <div class="card"><div class="card-title">Disk I/O</div><div class="canvas-wrapper"><canvas id="c-p-dsk"></canvas></div></div>
-                </div>
-            </div>
-        </div>
-
-        <div class="col-right">
-            <div class="card" style="height: 25%;"><div class="card-title">Top CPU</div><div class="table-wrapper"><table id="tbl-cpu"></table></div></div>
-            <div class="card" style="height: 25%;"><div class="card-title">Top Mem</div><div class="table-wrapper"><table id="tbl-mem"></table></div></div>
-            <div class="card" style="height: 25%;"><div class="card-title">Top I/O</div><div class="table-wrapper"><table id="tbl-io"></table></div></div>
-            <div class="card" style="height: 25%;"><div class="card-title">Ports</div><div class="table-wrapper"><table id="tbl-ports"></table></div></div>
-        </div>
-    </div>
-
-    <script>
-        const STATE = { data: [], mode: 'live', dur: 1800, rStart: 0, rEnd: 0, pid: null, charts: [], plugins: {} };
-        const fmtBytes = (v) => { const u=['B','K','M','G']; let i=0; while(v>=1024&&i<3){v/=1024;i++} return v.toFixed(1)+u[i]; }
-
-        function openSettings() {
-            fetch('/config').then(r=>r.json()).then(c => {
-                const s = (id, val) => document.getElementById(id).value = val || "";
-                s("in-cpu-w",c.cpu_warn); s("in-cpu-c",c.cpu_crit); s("in-mem-w",c.mem_warn); s("in-mem-c",c.mem_crit);
-                s("in-dsk-w",c.dsk_warn); s("in-dsk-c",c.dsk_crit); s("in-smtp-host",c.smtp_host); s("in-smtp-port",c.smtp_port);
-                s("in-smtp-user",c.smtp_user); s("in-smtp-pass",c.smtp_pass); s("in-email-to",c.email_to);
-                s("in-int-g",c.global_int); s("in-int-p",c.process_int); s("in-int-s",c.script_int);
-                document.getElementById("in-scripts").value = c.scripts ? c.scripts.join("\n") : "";
-                document.getElementById("settings-modal").style.display = "flex";
-            });
-        }
-        function closeSettings() { document.getElementById("settings-modal").style.display = "none"; }
-        function saveSettings() {
-            const g = (id) => document.getElementById(id).value;
-            const cfg = {
-                cpu_warn: parseFloat(g("in-cpu-w")), cpu_crit: parseFloat(g("in-cpu-c")),
-                mem_warn: parseFloat(g("in-mem-w")), mem_crit: parseFloat(g("in-mem-c")),
-                dsk_warn: parseFloat(g("in-dsk-w")), dsk_crit: parseFloat(g("in-dsk-c")),
-                smtp_host: g("in-smtp-host"), smtp_port: parseInt(g("in-smtp-port")), smtp_user: g("in-smtp-user"), smtp_pass: g("in-smtp-pass"), email_to: g("in-email-to"),
-                scripts: g("in-scripts").split("\n").filter(s => s.trim() !== ""),
-                global_int: parseInt(g("in-int-g")), process_int: parseInt(g("in-int-p")), script_int: parseInt(g("in-int-s"))
-            };
-            fetch('/config', { method: 'POST', headers: {'Content-Type': 'application/json'}, body: JSON.stringify(cfg) })
-            .then(() => { closeSettings(); alert("Saved."); });
-        }
-
-        class Chart {
-            constructor(id, f1, f2, c1, c2, max, unit) {
-                this.cvs = document.getElementById(id); this.ctx = this.cvs.getContext("2d");
-                this.f1=f1; this.f2=f2; this.c1=c1; this.c2=c2; this.max=max; this.unit=unit;
-                STATE.charts.push(this);
-                this.cvs.addEventListener('mousemove', e=>this.tip(e));
-                this.cvs.addEventListener('mouseleave', ()=>document.getElementById("tooltip").style.display='none');
-                this.cvs.addEventListener('wheel', e=>{ if(e.ctrlKey){ e.preventDefault(); zoom(e.deltaY<0?0.2:-0.2); } });
-                new ResizeObserver(()=>this.resize()).observe(this.cvs.parentElement);
-            }
-            resize() { this.cvs.width = this.cvs.parentElement.clientWidth; this.cvs.height = this.cvs.parentElement.clientHeight; this.draw(); }
-            draw() {
-                const w=this.cvs.width, h=this.cvs.height, pL=40, pB=30;
-                this.ctx.clearRect(0,0,w,h);
-                if(STATE.data.length<2) return;
-                const tEnd = STATE.mode==='live' ? STATE.data[STATE.data.length-1].ts : STATE.rEnd;
-                const tStart = STATE.mode==='live' ? tEnd-STATE.dur : STATE.rStart;
-                
-                const view=[]; for(let d of STATE.data) if(d.ts>=tStart && d.ts<=tEnd) view.push(d);
-                if(view.length<2) return;
-
-                let max = this.max || 0;
-                if(!this.max) view.forEach(d => max = Math.max(max, this.f1(d), this.f2?this.f2(d):0));
-                if(max<=0) max=1; else max*=1.1;
-
-                this.ctx.strokeStyle="#333"; this.ctx.beginPath();
-                for(let i=0;i<=5;i++) {
-                    let x=pL+(i*(w-pL)/5); this.ctx.moveTo(x,0); this.ctx.lineTo(x,h-pB);
-                    let ts=tStart+(i*(tEnd-tStart)/5);
-                    this.ctx.fillStyle="#999"; this.ctx.fillText(new Date(ts*1000).toLocaleTimeString(), x-15, h-10);
-                }
-                for(let i=0;i<=4;i++) {
-                    let y=(h-pB)-(i*(h-pB)/4); this.ctx.moveTo(pL,y); this.ctx.lineTo(w,y);
-                    let v=i*(max/4); let t=v.toFixed(0);
-                    if(this.unit === 'B' || (this.unit === undefined && (this.c1.includes('57') || this.c1.includes('38') || this.c1.includes('20') || (this.c2 && this.c2.includes('00'))))) t=fmtBytes(v);
-                    if(this.unit === '%' || this.max === 100) t+='%';
-                    this.ctx.fillText(t, 2, y+3);
-                }
-                this.ctx.stroke();
-
-                const line = (fn, c) => {
-                    this.ctx.strokeStyle=c; this.ctx.lineWidth=2; this.ctx.beginPath();
-                    view.forEach((d,i) => {
-                        let x=pL+((d.ts-tStart)/(tEnd-tStart))*(w-pL);
-                        let y=(h-pB)-(fn(d)/max)*(h-pB);
-                        if(i===0) this.ctx.moveTo(x,y); else this.ctx.lineTo(x,y);
-                    });
-                    this.ctx.stroke();
-                }
-                line(this.f1, this.c1); if(this.f2) line(this.f2, this.c2);
-            }
-            tip(e) {
-                if(STATE.data.length<2) return;
-                const rect = this.cvs.getBoundingClientRect();
-                const pL=40, w=rect.width;
-                const tEnd = STATE.mode==='live' ? STATE.data[STATE.data.length-1].ts : STATE.rEnd;
-                const tStart = STATE.mode==='live' ? tEnd-STATE.dur : STATE.rStart;
-                const mx = e.clientX - rect.left;
-                const mTime = tStart + ((mx-pL)/(w-pL))*(tEnd-tStart);
-                const d = STATE.data.reduce((p,c)=> Math.abs(c.ts-mTime)<Math.abs(p.ts-mTime)?c:p);
-                const tip = document.getElementById("tooltip");
-                tip.style.display="block"; tip.style.left=(e.pageX+15)+"px"; tip.style.top=(e.pageY+15)+"px";
-                let h = '<div><b>' + new Date(d.ts*1000).toLocaleTimeString() + '</b></div>';
-                let v1 = this.f1(d);
-                if(this.unit==='B') v1=fmtBytes(v1); else v1=v1.toFixed(1);
-                h += '<div style="color:' + this.c1 + '">V1: ' + v1 + '</div>';
-                if(this.f2) {
-                    let v2 = this.f2(d);
-                    if(this.unit==='B') v2=fmtBytes(v2); else v2=v2.toFixed(1);
-                    h += '<div style="color:' + this.c2 + '">V2: ' + v2 + '</div>';
-                }
-                tip.innerHTML = h;
-            }
-        }
-
-        new Chart("c-global", d=>d.cpu_tot, d=>d.mem_used, "#00d1b2", "#209cee", 100, "%");
-        new Chart("c-net", d=>d.net_down, d=>d.net_up, "#ffdd57", "#bd93f9", null, "B");
-        new Chart("c-disk", d=>d.dsk_read, d=>d.dsk_writ, "#ff3860", "#00d1b2", null, "B");
-        
-        const getP = (d) => { if(!d.p_list) return null; return d.p_list.find(p=>p.pid==STATE.pid); };
-        new Chart("c-p-cpu", d=>{const p=getP(d); return p?p.cpu:0}, null, "#00d1b2", null, null, "%");
-        new Chart("c-p-mem", d=>{const p=getP(d); return p?p.mem:0}, null, "#209cee", null, null, "B");
-        new Chart("c-p-dsk", d=>{const p=getP(d); return p?p.d_read:0}, d=>{const p=getP(d); return p?p.d_write:0}, "#ff3860", "#00d1b2", null, "B");
-
-        function drawAll() { STATE.charts.forEach(c=>c.draw()); }
-        function zoom(adj) { STATE.dur = Math.max(60, STATE.dur + (STATE.dur * adj)); STATE.mode='live'; drawAll(); }
-        function zoomIn() { zoom(-0.3); } function zoomOut() { zoom(0.3); }
-        function setLiveDuration(s) { STATE.mode='live'; STATE.dur=s; drawAll(); }
-        function applyRange() { 
-            STATE.rStart = new Date(document.getElementById("dp-start").value).getTime()/1000;
-            STATE.rEnd = new Date(document.getElementById("dp-end").value).getTime()/1000;
-            STATE.mode='range'; drawAll();
-        }
-        function goLive() { setLiveDuration(1800); }
-        function selProc(pid) { 
-            STATE.pid = pid; 
-            const el = document.getElementById("drill-view");
-            if(pid) { el.style.display="grid"; setTimeout(drawAll,50); } else { el.style.display="none"; }
-            drawAll(); 
-        }
-        function filterProc() {
-            const f = document.getElementById("proc-filter").value.toUpperCase();
-            const opts = document.getElementById("proc-select").options;
-            for(let i=1; i<opts.length; i++) opts[i].style.display = opts[i].text.toUpperCase().includes(f) ? "" : "none";
-        }
-
-        function updatePlugins(list) {
-            const c = document.getElementById("plugin-container");
-            if(!list) return;
-            const activeIDs = new Set();
-            list.forEach(p => {
-                let id = "plg-" + btoa(p.path).replace(/[^a-zA-Z0-9]/g, "");
-                activeIDs.add(id);
-                let card = document.getElementById(id);
-                if(!card) {
-                    card = document.createElement("div");
-                    card.id = id;
-                    card.className = "card"; card.style.height="150px"; card.style.marginBottom="15px";
-                    card.innerHTML = '<div class="card-header"><div class="card-title">' + p.path + '</div><div id="' + id + '-stat" class="plugin-row"></div></div><div class="canvas-wrapper"><canvas id="' + id + '-cvs"></canvas></div>';
-                    c.appendChild(card);
-                    new Chart(id+"-cvs", d => {
-                        const plug = d.plugins ? d.plugins.find(x=>x.path===p.path) : null;
-                        return plug ? plug.perf_val : 0;
-                    }, null, "#bd93f9", null, null, p.perf_unit);
-                }
-                const st = document.getElementById(id+"-stat");
-                st.className = "plugin-row status-"+p.exit_code;
-                st.innerText = p.output;
-            });
-            Array.from(c.children).forEach(child => {
-                if (!activeIDs.has(child.id)) c.removeChild(child);
-            });
-        }
-
-        const evt = new EventSource("/events");
-        evt.onmessage = (e) => {
-            const m = JSON.parse(e.data);
-            STATE.data.push(m);
-            if(STATE.data.length > 86400) STATE.data.shift();
-
-            if(STATE.mode==='live') updatePlugins(m.plugins);
-
-            if(m.ts % 2 === 0 && m.p_list) {
-                const tbl = (id, l, f) => {
-                    document.getElementById(id).innerHTML = l.map(p=> '<tr><td>' + p.pid + '</td><td>' + p.name + '</td><td class="val-cell">' + f(p) + '</td></tr>').join("");
-                };
-                tbl("tbl-cpu", [...m.p_list].sort((a,b)=>b.cpu-a.cpu).slice(0,5), p=>p.cpu.toFixed(1)+"%");
-                tbl("tbl-mem", [...m.p_list].sort((a,b)=>b.mem-a.mem).slice(0,5), p=>fmtBytes(p.mem));
-                tbl("tbl-io", [...m.p_list].sort((a,b)=>(b.d_read+b.d_write)-(a.d_read+a.d_write)).slice(0,5), p=>fmtBytes(p.d_read+p.d_write)+"/s");
-                
-                const sel = document.getElementById("proc-select");
-                if(document.getElementById("proc-filter").value === "" && (sel.options.length < 2 || m.ts % 10 === 0)) {
-                    const val = sel.value;
-                    sel.innerHTML = "<option value=''>-- Select --</option>" + [...m.p_list].sort((a,b)=>b.cpu-a.cpu).map(p=> '<option value="' + p.pid + '">' + p.name + '</option>').join("");
-                    sel.value = val;
-                }
-            }
-            if(m.ports && m.ts % 5 === 0) {
-                document.getElementById("tbl-ports").innerHTML = m.ports.map(p=> '<tr><td>' + p.port + '</td><td>' + p.proto + '</td><td>' + p.name + '</td></tr>').join("");
-            }
-            if(STATE.mode==='live') drawAll();
-        };
-        
-        fetch("/history").then(r=>r.json()).then(d=>{ if(d) STATE.data=d; drawAll(); });
-    </script>
-</body>
-</html>
-`
+// The dashboard lives in web/ (index.html, pulse.css, pulse.js) and is compiled in; webui.go serves it.
+
+//go:embed web
+var webFiles embed.FS
 
 // --- 4. BACKEND ---
 
-func loadConfig() {
-	if _, err := os.Stat(confFile); err == nil {
-		f, _ := os.Open(confFile)
-		defer f.Close()
-		json.NewDecoder(f).Decode(&config)
+// readConfig parses pulse.conf, applies flags/env and fills in defaults. It also returns the raw file keys for fileJSON.
+func readConfig() (c AppConfig, raw map[string]json.RawMessage, plain int, err error) {
+	b, err := os.ReadFile(confFile)
+	if err != nil && !os.IsNotExist(err) { return c, nil, 0, err }
+	if err == nil {
+		if err = json.Unmarshal(b, &c); err != nil { return c, nil, 0, fmt.Errorf("%s: %w", confFile, err) }
+		json.Unmarshal(b, &raw)
 	}
-	if config.GlobalInt == 0 { config.GlobalInt = 2 }
-	if config.ProcessInt == 0 { config.ProcessInt = 5 }
-	if config.ScriptInt == 0 { config.ScriptInt = 60 }
-	lastEmailTime = make(map[string]time.Time)
+	plain = openSecrets(&c)
+	applyOverrides(&c)
+	if c.GlobalInt == 0 { c.GlobalInt = 2 }
+	if c.ProcessInt == 0 { c.ProcessInt = 5 }
+	if c.ProcessLimit == 0 { c.ProcessLimit = defaultProcessLimit }
+	if c.ScriptInt == 0 { c.ScriptInt = 60 }
+	if c.ScriptTimeout == 0 { c.ScriptTimeout = 30 }
+	if c.ScriptWorkers == 0 { c.ScriptWorkers = 4 }
+	return c, raw, plain, nil
+}
+
+func loadConfig() {
+	c, raw, plain, err := readConfig()
+	applyLogging(c)
+	if err != nil { configLog.Error("cannot read config", "err", err) }
+	for _, e := range validateConfig(c) { configLog.Warn("invalid setting", "field", e.Field, "err", e.Message) }
+	config, fileValues = c, raw
+	if st, err := os.Stat(confFile); err == nil { confModTime = st.ModTime() }
+	lastAlertTime = make(map[string]time.Time)
+	// Rewrite configs from older versions right away so their secrets don't stay in plaintext.
+	if plain > 0 { if err := saveConfig(); err != nil { configLog.Error("cannot save config", "err", err) } }
 }
 
-func saveConfig() {
+// saveConfig writes the running config through a temporary file, so a failed write leaves the old
+// pulse.conf in place.
+func saveConfig() error {
 	cfgMutex.Lock(); defer cfgMutex.Unlock()
-	cleanScripts := []string{}
+	cleanScripts := []ScriptConfig{}
 	seen := make(map[string]bool)
 	for _, s := range config.Scripts {
-		trim := strings.TrimSpace(s)
-		if trim != "" && !seen[trim] { cleanScripts = append(cleanScripts, trim); seen[trim] = true }
+		s.Command, s.Name = strings.TrimSpace(s.Command), strings.TrimSpace(s.Name)
+		if (s.Command != "" || s.builtin()) && !seen[s.key()] { cleanScripts = append(cleanScripts, s); seen[s.key()] = true }
 	}
 	config.Scripts = cleanScripts
-	f, _ := os.Create(confFile); defer f.Close()
-	json.NewEncoder(f).Encode(config)
+	cleanHB := []HeartbeatConfig{}
+	for _, hb := range config.Heartbeats {
+		hb.Name = strings.TrimSpace(hb.Name)
+		if hb.Name != "" && !seen["hb:"+hb.Name] { cleanHB = append(cleanHB, hb); seen["hb:"+hb.Name] = true }
+	}
+	config.Heartbeats = cleanHB
+	out := config; sealSecrets(&out)
+	mode := os.FileMode(0600)
+	if st, err := os.Stat(confFile); err == nil { mode = st.Mode().Perm() }
+	tmp := confFile + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+	if err != nil { return err }
+	err = json.NewEncoder(f).Encode(fileJSON(out))
+	if err == nil { err = f.Sync() }
+	if cerr := f.Close(); err == nil { err = cerr }
+	if err == nil { err = os.Rename(tmp, confFile) }
+	if err != nil { os.Remove(tmp); return err }
+	if st, err := os.Stat(confFile); err == nil { confModTime = st.ModTime() }
+	applyLogging(config)
+	return nil
 }
 
-func runPlugin(commandLine string) PluginData {
+func runPlugin(sc ScriptConfig, timeout time.Duration) PluginData {
+	if sc.builtin() { return runBuiltinCheck(sc, timeout) }
+	return runScript(sc, timeout)
+}
+
+func runScript(sc ScriptConfig, timeout time.Duration) PluginData {
+	commandLine, err := expandCommand(sc, timeout)
+	if err != nil { return PluginData{Path: sc.Command, Name: sc.Name, ExitCode: 3, Output: "UNKNOWN: bad command template: " + err.Error()} }
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
 	var cmd *exec.Cmd
 	if runtime.GOOS == "windows" {
-		cmd = exec.Command("cmd", "/C", commandLine)
+		cmd = exec.CommandContext(ctx, "cmd", "/C", commandLine)
 	} else {
-		cmd = exec.Command("sh", "-c", commandLine)
+		cmd = exec.CommandContext(ctx, "sh", "-c", commandLine)
+	}
+	cmd.Dir = sc.Dir
+	if sc.stdin != nil { cmd.Stdin = bytes.NewReader(sc.stdin) }
+	if len(sc.Env) > 0 {
+		cmd.Env = os.Environ()
+		for k, v := range sc.Env { cmd.Env = append(cmd.Env, k+"="+v) }
 	}
-	var out bytes.Buffer
+	setProcessGroup(cmd)
+	cmd.Cancel = func() error { return killProcessGroup(cmd) }
+	cmd.WaitDelay = time.Second
+	var out, errOut bytes.Buffer
 	cmd.Stdout = &out
-	err := cmd.Run()
-	
+	cmd.Stderr = &errOut
+	start := time.Now()
+	err = cmd.Run()
+	dur := time.Since(start).Seconds()
+	stderr := truncateOutput(strings.TrimSpace(errOut.String()))
+
+	if ctx.Err() == context.DeadlineExceeded {
+		pluginLog.Warn("script timed out", "name", sc.Name, "command", sc.Command, "timeout", timeout)
+		return PluginData{Path: sc.Command, Name: sc.Name, ExitCode: 3, Output: fmt.Sprintf("UNKNOWN: timed out after %s", timeout), LongOutput: truncateOutput(out.String()), Stderr: stderr, Duration: dur, TimedOut: true}
+	}
 	code := 0
-	if err != nil { if e, ok := err.(*exec.ExitError); ok { code = e.ExitCode() } else { code = 3 } }
+	if err != nil { if e, ok := err.(*exec.ExitError); ok { code = e.ExitCode() } else { code = 3; pluginLog.Warn("script failed to run", "name", sc.Name, "command", sc.Command, "err", err) } }
+	pluginLog.Debug("script ran", "name", sc.Name, "command", sc.Command, "exit", code, "duration", dur)
 
-	full := out.String()
-	parts := strings.Split(full, "|")
-	msg := strings.TrimSpace(parts[0])
+	// Nagios output: "SUMMARY | perf" on line one, then long output lines; the first "|" in the
+	// long output starts more perfdata that runs to the end of the output.
+	lines := strings.Split(strings.ReplaceAll(out.String(), "\r\n", "\n"), "\n")
+	msg, perfStr := lines[0], ""
+	if i := strings.Index(msg, "|"); i >= 0 { msg, perfStr = msg[:i], msg[i+1:] }
+	msg = strings.TrimSpace(msg)
+	var long []string
+	inPerf := false
+	for _, l := range lines[1:] {
+		if inPerf { perfStr += " " + l; continue }
+		if i := strings.Index(l, "|"); i >= 0 { long = append(long, l[:i]); perfStr += " " + l[i+1:]; inPerf = true; continue }
+		long = append(long, l)
+	}
+	longOut := truncateOutput(strings.TrimRight(strings.Join(long, "\n"), " \t\n"))
 	val := 0.0
 	unit := ""
 
-	if len(parts) > 1 {
-		perf := strings.TrimSpace(parts[1])
-		re := regexp.MustCompile(`=([-0-9.]+)([a-zA-Z%]*)`)
-		matches := re.FindStringSubmatch(perf)
-		if len(matches) >= 2 {
-			val, _ = strconv.ParseFloat(matches[1], 64)
-			if len(matches) > 2 { unit = matches[2] }
+	perf := parsePerfData(perfStr)
+	// PerfVal/PerfUnit mirror the first metric so older history and single-series graphs keep working
+	if len(perf) > 0 { val, unit = perf[0].Value, perf[0].Unit }
+	return PluginData{Path: sc.Command, Name: sc.Name, ExitCode: code, Output: msg, PerfVal: val, PerfUnit: unit, Perf: perf, LongOutput: longOut, Stderr: stderr, Duration: dur}
+}
+
+// expandCommand fills in {{.Name}}, {{.Hostname}}, {{.Interval}} and {{.Timeout}} in a script command line.
+func expandCommand(sc ScriptConfig, timeout time.Duration) (string, error) {
+	if !strings.Contains(sc.Command, "{{") { return sc.Command, nil }
+	t, err := template.New("cmd").Option("missingkey=error").Parse(sc.Command)
+	if err != nil { return "", err }
+	host, _ := os.Hostname()
+	var b bytes.Buffer
+	err = t.Execute(&b, map[string]interface{}{"Name": sc.Name, "Hostname": host, "Interval": sc.Interval, "Timeout": int(timeout / time.Second)})
+	return b.String(), err
+}
+
+const maxPluginOutput = 64 * 1024
+
+func truncateOutput(s string) string {
+	if len(s) <= maxPluginOutput { return s }
+	return s[:maxPluginOutput] + "\n... (truncated)"
+}
+
+var perfValueRe = regexp.MustCompile(`^([-+]?[0-9]*\.?[0-9]+(?:[eE][-+]?[0-9]+)?)(.*)$`)
+
+// parsePerfData parses Nagios perfdata: 'label'=value[UOM];[warn];[crit];[min];[max] ...
+func parsePerfData(perf string) []PerfMetric {
+	var res []PerfMetric
+	var toks []string
+	var cur strings.Builder
+	inQuote := false
+	for _, c := range strings.TrimSpace(perf) {
+		if c == '\'' { inQuote = !inQuote }
+		if !inQuote && (c == ' ' || c == '\t' || c == '\n' || c == '\r') {
+			if cur.Len() > 0 { toks = append(toks, cur.String()); cur.Reset() }
+			continue
 		}
+		cur.WriteRune(c)
 	}
-	return PluginData{Path: commandLine, ExitCode: code, Output: msg, PerfVal: val, PerfUnit: unit}
+	if cur.Len() > 0 { toks = append(toks, cur.String()) }
+
+	for _, t := range toks {
+		eq := strings.LastIndex(t, "=")
+		if eq <= 0 { continue }
+		label := t[:eq]
+		if len(label) >= 2 && label[0] == '\'' && label[len(label)-1] == '\'' { label = label[1 : len(label)-1] }
+		label = strings.ReplaceAll(label, "''", "'")
+		f := strings.Split(t[eq+1:], ";")
+		m := perfValueRe.FindStringSubmatch(f[0])
+		if m == nil { continue } // "U" (undetermined) and garbage values are skipped
+		pm := PerfMetric{Label: label, Unit: m[2]}
+		pm.Value, _ = strconv.ParseFloat(m[1], 64)
+		if len(f) > 1 { pm.Warn = f[1] }
+		if len(f) > 2 { pm.Crit = f[2] }
+		if len(f) > 3 { if v, err := strconv.ParseFloat(f[3], 64); err == nil { pm.Min = &v } }
+		if len(f) > 4 { if v, err := strconv.ParseFloat(f[4], 64); err == nil { pm.Max = &v } }
+		res = append(res, pm)
+	}
+	return res
+}
+
+// perfRangeAlert reports whether v is outside a Nagios threshold range ("10", "10:", "~:10", "10:20", "@10:20").
+func perfRangeAlert(spec string, v float64) bool {
+	spec = strings.TrimSpace(spec)
+	if spec == "" { return false }
+	inside := strings.HasPrefix(spec, "@")
+	spec = strings.TrimPrefix(spec, "@")
+	lo, hi := 0.0, math.Inf(1)
+	var err error
+	if i := strings.Index(spec, ":"); i >= 0 {
+		if l := spec[:i]; l == "~" { lo = math.Inf(-1) } else if l != "" { if lo, err = strconv.ParseFloat(l, 64); err != nil { return false } }
+		if h := spec[i+1:]; h != "" { if hi, err = strconv.ParseFloat(h, 64); err != nil { return false } }
+	} else if hi, err = strconv.ParseFloat(spec, 64); err != nil { return false }
+	out := v < lo || v > hi
+	if inside { return !out }
+	return out
 }
 
 func checkAlerts(m RichMetrics) {
-	cfgMutex.RLock(); defer cfgMutex.RUnlock()
+	cfgMutex.RLock(); cfg := config; cfgMutex.RUnlock()
+	crit, firing := make(map[string]bool), make(map[string]bool)
+	alert := func(n, lvl string, v float64, msg string) {
+		firing[n] = true
+		if lvl == "CRITICAL" { crit[n] = true }
+		fireAlert(cfg, AlertEvent{Monitor: n, Level: lvl, Value: v, Message: msg, Host: m.Hostname})
+	}
+	// Sustained Thresholds: a breach only fires once it has lasted "for" seconds
+	breached := make(map[string]bool)
+	held := func(n string, secs int) bool {
+		breached[n] = true
+		if secs <= 0 { return true }
+		since, ok := alertPending[n]
+		if !ok { since = m.Timestamp; alertPending[n] = since }
+		return m.Timestamp-since >= int64(secs)
+	}
 	// Standard Thresholds
-	check := func(n string, v, w, c float64) {
+	check := func(n string, v, w, c float64, secs int) {
 		if w==0 && c==0 { return }
 		lvl := ""
 		if v >= c { lvl = "CRITICAL" } else if v >= w { lvl = "WARNING" }
-		if lvl != "" { sendAlertEmail(n, lvl, v, "") }
+		if lvl == "" || !held(n, secs) { return }
+		msg := ""
+		if secs > 0 { msg = fmt.Sprintf("Above threshold for %ds", m.Timestamp-alertPending[n]) }
+		alert(n, lvl, v, msg)
 	}
-	check("CPU", m.CPUTotal, config.CpuWarn, config.CpuCrit)
-	check("Memory", m.MemUsed, config.MemWarn, config.MemCrit)
-	check("Disk", m.DiskUsed, config.DskWarn, config.DskCrit)
+	check("CPU", m.CPUTotal, cfg.CpuWarn, cfg.CpuCrit, cfg.CpuFor)
+	check("Memory", m.MemUsed, cfg.MemWarn, cfg.MemCrit, cfg.MemFor)
+	check("Disk", m.DiskUsed, cfg.DskWarn, cfg.DskCrit, cfg.DskFor)
+	checkLoad(cfg, m, check)
 
 	// Plugin Alerts
+	scriptFor := make(map[string]int)
+	for _, s := range cfg.Scripts { scriptFor[s.key()] = s.For }
 	for _, p := range m.Plugins {
-		if p.ExitCode == 1 { sendAlertEmail(p.Path, "WARNING", p.PerfVal, p.Output) }
-		if p.ExitCode == 2 { sendAlertEmail(p.Path, "CRITICAL", p.PerfVal, p.Output) }
+		pn := p.Path
+		if p.Name != "" { pn = p.Name }
+		if (p.ExitCode == 1 || p.ExitCode == 2) && held(pn, scriptFor[pn]) { alert(pn, statusNames[p.ExitCode], p.PerfVal, p.Output) }
+		for _, pm := range p.Perf {
+			name := pn + " [" + pm.Label + "]"
+			if perfRangeAlert(pm.Crit, pm.Value) {
+				if held(name, scriptFor[pn]) { alert(name, "CRITICAL", pm.Value, p.Output) }
+			} else if perfRangeAlert(pm.Warn, pm.Value) {
+				if held(name, scriptFor[pn]) { alert(name, "WARNING", pm.Value, p.Output) }
+			}
+		}
+	}
+	checkGroups(cfg, m, check)
+	checkMetricRules(cfg, m, check)
+	checkFleetGroups(cfg, check)
+	for n := range alertPending { if !breached[n] { delete(alertPending, n) } }
+
+	checkAnomalies(cfg, m, alert)
+	checkForecasts(cfg, alert)
+	checkRates(cfg, m, alert)
+	checkOOM(m, alert)
+	checkARP(cfg, m, alert)
+	checkPorts(cfg, m, alert)
+	checkBaseline(alert)
+	checkFederation(cfg, alert)
+	checkExternal(alert)
+
+	// Heartbeat Alerts (dead-man's switch)
+	for _, hb := range m.Heartbeats {
+		if !hb.Late { continue }
+		age := float64(m.Timestamp - hb.LastSeen)
+		msg := "No heartbeat received since startup"
+		if hb.LastSeen > 0 { msg = fmt.Sprintf("No heartbeat received for %.0fs (interval %ds)", age, hb.Interval) } else { age = 0 }
+		alert("Heartbeat "+hb.Name, "CRITICAL", age, msg)
 	}
+
+	resolveAlerts(cfg, firing, m.Hostname)
+	updateRemediations(cfg, crit, m.Hostname)
 }
 
-func sendAlertEmail(name, level string, val float64, extraMsg string) {
-	if config.SmtpHost == "" { return }
+// fireAlert records an alert and sends notifications, at most once per monitor and level every 15 minutes.
+func fireAlert(cfg AppConfig, ev AlertEvent) {
 	alertMutex.Lock(); defer alertMutex.Unlock()
-	
-	key := name + level
-	if t, ok := lastEmailTime[key]; ok { if time.Since(t) < 15*time.Minute { return } }
-	lastEmailTime[key] = time.Now()
-
-	go func() {
-		msg := fmt.Sprintf("To: %s\r\nSubject: Pulse Alert: %s %s\r\n\r\nMonitor: %s\nStatus: %s\nValue: %.2f\nMessage: %s\nHost: %s", 
-			config.EmailTo, level, name, name, level, val, extraMsg, latestMetric.Hostname)
-		
-		addr := fmt.Sprintf("%s:%d", config.SmtpHost, config.SmtpPort)
-		var err error
-		if config.SmtpPort == 465 {
-			// Implicit SSL
-			tlsConfig := &tls.Config{InsecureSkipVerify: true, ServerName: config.SmtpHost}
-			conn, e := tls.Dial("tcp", addr, tlsConfig); if e != nil { return }
-			c, e := smtp.NewClient(conn, config.SmtpHost); if e != nil { return }
-			auth := smtp.PlainAuth("", config.SmtpUser, config.SmtpPass, config.SmtpHost)
-			if err = c.Auth(auth); err == nil {
-				if err = c.Mail(config.SmtpUser); err == nil {
-					if err = c.Rcpt(config.EmailTo); err == nil {
-						w, _ := c.Data(); w.Write([]byte(msg)); w.Close()
-					}
-				}
-			}
-			c.Quit()
-		} else {
-			// STARTTLS
-			auth := smtp.PlainAuth("", config.SmtpUser, config.SmtpPass, config.SmtpHost)
-			err = smtp.SendMail(addr, auth, config.SmtpUser, []string{config.EmailTo}, []byte(msg))
-		}
-		if err != nil { fmt.Println("Email Error:", err) }
-	}()
+	// An acknowledgement holds until the alert recovers or escalates to another level.
+	if prev, ok := activeAlerts[ev.Monitor]; ok && prev != ev.Level { delete(acknowledged, ev.Monitor) }
+	activeAlerts[ev.Monitor] = ev.Level
+	if acknowledged[ev.Monitor] != "" { return }
+	key := ev.Monitor + ev.Level
+	if t, ok := lastAlertTime[key]; ok { if time.Since(t) < 15*time.Minute { return } }
+	lastAlertTime[key] = time.Now()
+	dispatchAlert(cfg, recordAlert(ev))
+}
+
+// resolveAlerts sends a single OK event for every monitor that alerted before but not in this pass.
+func resolveAlerts(cfg AppConfig, firing map[string]bool, host string) {
+	alertMutex.Lock(); defer alertMutex.Unlock()
+	for mon, lvl := range activeAlerts {
+		if firing[mon] { continue }
+		delete(activeAlerts, mon); delete(acknowledged, mon)
+		delete(lastAlertTime, mon+"WARNING"); delete(lastAlertTime, mon+"CRITICAL")
+		dispatchAlert(cfg, recordAlert(AlertEvent{Monitor: mon, Level: "OK", Host: host, Message: "Recovered from " + lvl}))
+	}
+}
+
+func recordAlert(ev AlertEvent) AlertEvent {
+	alertLogMutex.Lock(); defer alertLogMutex.Unlock()
+	alertSeq++
+	ev.ID = alertSeq
+	if ev.Time == 0 { ev.Time = time.Now().Unix() }
+	alertLog.Info("alert", "monitor", ev.Monitor, "level", ev.Level, "message", ev.Message)
+	alertHistory = append(alertHistory, ev)
+	if len(alertHistory) > maxAlertHistory { alertHistory = alertHistory[len(alertHistory)-maxAlertHistory:] }
+	return ev
 }
 
 func startCollector() {
-	loadConfig()
 	t := time.NewTicker(100 * time.Millisecond); defer t.Stop()
-	lG := time.Now(); lP := time.Now(); lS := time.Now()
-	for range t.C {
+	lG := time.Now(); lP := time.Now()
+	lS := make(map[string]time.Time)
+	defer close(collectorStopped)
+	for {
+		select { case <-stopCtx.Done(): return; case <-t.C: }
 		cfgMutex.RLock()
 		gI, pI, sI, sc := config.GlobalInt, config.ProcessInt, config.ScriptInt, config.Scripts
+		sT := config.ScriptTimeout
 		cfgMutex.RUnlock()
 		n := time.Now()
 		if n.Sub(lG) >= time.Duration(gI)*time.Second { collectGlobal(); lG = n }
 		if n.Sub(lP) >= time.Duration(pI)*time.Second { collectProcesses(); lP = n }
-		if n.Sub(lS) >= time.Duration(sI)*time.Second { go collectScripts(sc); lS = n }
+		for _, s := range sc {
+			iv, to := s.Interval, s.Timeout
+			if iv <= 0 { iv = sI }
+			if to <= 0 { to = sT }
+			if n.Sub(lS[s.key()]) >= time.Duration(iv)*time.Second { go collectScript(s, time.Duration(to)*time.Second); lS[s.key()] = n }
+		}
 	}
 }
 
-func collectScripts(s []string) {
-	var r []PluginData
-	for _, p := range s { r = append(r, runPlugin(p)) }
-	dataMutex.Lock(); latestPlugins = r; dataMutex.Unlock()
+// collectScript runs one script once a worker slot is free; a script never overlaps with itself.
+func collectScript(s ScriptConfig, timeout time.Duration) {
+	dataMutex.Lock()
+	if scriptRunning[s.key()] { dataMutex.Unlock(); return }
+	scriptRunning[s.key()] = true
+	dataMutex.Unlock()
+	if timeout <= 0 { timeout = 30 * time.Second }
+
+	scriptSlotMutex.Lock()
+	for {
+		cfgMutex.RLock(); max := config.ScriptWorkers; cfgMutex.RUnlock()
+		if max < 1 { max = 1 }
+		if scriptSlotsUsed < max { break }
+		scriptSlotCond.Wait()
+	}
+	scriptSlotsUsed++
+	scriptSlotMutex.Unlock()
+
+	r := runPlugin(s, timeout)
+
+	scriptSlotMutex.Lock(); scriptSlotsUsed--; scriptSlotCond.Broadcast(); scriptSlotMutex.Unlock()
+	// Long output and stderr only live in the detail map; history samples carry the summary line
+	dataMutex.Lock()
+	pluginDetails[s.key()] = r
+	r.LongOutput, r.Stderr = "", ""
+	pluginResults[s.key()] = r
+	delete(scriptRunning, s.key())
+	dataMutex.Unlock()
+}
+
+// currentPlugins returns the latest result of every configured script in config order.
+func currentPlugins() []PluginData {
+	cfgMutex.RLock(); sc := config.Scripts; cfgMutex.RUnlock()
+	dataMutex.Lock(); defer dataMutex.Unlock()
+	var res []PluginData
+	keep := make(map[string]bool)
+	for _, s := range sc {
+		keep[s.key()] = true
+		if r, ok := pluginResults[s.key()]; ok { res = append(res, r) }
+	}
+	for k := range pluginResults { if !keep[k] { delete(pluginResults, k); delete(pluginDetails, k) } }
+	return append(res, currentRuns()...)
 }
 
 func collectGlobal() {
-	hInfo, _ := host.Info(); lAvg, _ := load.Avg(); pids, _ := process.Pids()
-	cTot, _ := cpu.Percent(0, false); vMem, _ := mem.VirtualMemory(); sMem, _ := mem.SwapMemory()
-	dUsage, _ := disk.Usage("/"); dIO, _ := disk.IOCounters()
+	hInfo, err := host.Info(); collectErr("host", err)
+	lAvg, err := load.Avg(); collectErr("load", err)
+	pids, err := process.Pids(); collectErr("pids", err)
+	cTot, err := cpu.Percent(0, false); collectErr("cpu", err)
+	vMem, err := mem.VirtualMemory(); collectErr("memory", err)
+	sMem, err := mem.SwapMemory(); collectErr("swap", err)
+	dUsage, err := disk.Usage("/"); collectErr("disk usage", err)
+	dIO, err := disk.IOCounters(); collectErr("disk io", err)
 	var dR, dW uint64
 	for _, io := range dIO { dR += io.ReadBytes; dW += io.WriteBytes }
-	nIO, _ := net.IOCounters(false)
+	nIO, err := net.IOCounters(false); collectErr("network", err)
 	var rx, tx uint64
 	if len(nIO) > 0 {
 		if !initRate { rx = nIO[0].BytesRecv - prevNet.BytesRecv; tx = nIO[0].BytesSent - prevNet.BytesSent }
 		prevNet = nIO[0]; initRate = false
 	}
-	dataMutex.RLock(); pL := latestProcs; pts := latestPorts; plg := latestPlugins; dataMutex.RUnlock()
+	plg := currentPlugins()
+	dataMutex.RLock(); pL := latestProcs; pts := latestPorts; grp := latestGroups; dataMutex.RUnlock()
 	vT := 0.0; if len(cTot)>0 { vT = cTot[0] }
-	m := RichMetrics{Timestamp: time.Now().Unix(), Hostname: hInfo.Hostname, Uptime: hInfo.Uptime, Load1: lAvg.Load1, Procs: len(pids), CPUTotal: vT, MemUsed: vMem.UsedPercent, SwapUsed: sMem.UsedPercent, DiskUsed: dUsage.UsedPercent, DiskRead: dR, DiskWrite: dW, NetDown: rx, NetUp: tx, ProcessList: pL, OpenPorts: pts, Plugins: plg}
+	m := RichMetrics{Timestamp: time.Now().Unix(), Hostname: hInfo.Hostname, Uptime: hInfo.Uptime, Load1: lAvg.Load1, Load5: lAvg.Load5, Load15: lAvg.Load15, Procs: len(pids), CPUTotal: vT, MemUsed: vMem.UsedPercent, SwapUsed: sMem.UsedPercent, DiskUsed: dUsage.UsedPercent, DiskRead: dR, DiskWrite: dW, NetDown: rx, NetUp: tx, ProcessList: pL, OpenPorts: pts, Plugins: plg, Heartbeats: getHeartbeats(), Mounts: collectMounts(), Disks: diskRates(dIO), Groups: grp, Metrics: currentMetrics()}
+	normalizeLoad(&m); collectPressure(&m); collectCPUFreq(&m)
+	cfgMutex.RLock(); cfg := config; cfgMutex.RUnlock()
+	deriveMetrics(cfg, &m)
 	checkAlerts(m)
+	keep, slots := retentionSeconds(), historyCapacity()
 	historyMutex.Lock()
-	history = append(history, m)
-	if len(history) > historySeconds { history = history[1:] }
+	if history.Cap() != slots { history.Resize(slots) }
+	history.Push(m)
+	history.DropBefore(m.Timestamp - keep + 1)
 	historyMutex.Unlock()
+	appendWAL(m)
+	markSample()
 	latestMutex.Lock(); latestMetric = m; latestMutex.Unlock()
-	select { case broadcast <- struct{}{}: default: }
+	publishMetrics(m)
+	samples.publish(m)
 }
 
-func collectProcesses() {
-	p := getProcessStats(); pts := getPorts()
-	dataMutex.Lock(); latestProcs = p; latestPorts = pts; dataMutex.Unlock()
-}
-
-func saveHistory() {
-	historyMutex.RLock(); defer historyMutex.RUnlock()
-	f, _ := os.Create(dbFile); defer f.Close()
-	gz := gzip.NewWriter(f); defer gz.Close()
-	gob.NewEncoder(gz).Encode(history)
-}
-
-func loadHistory() {
-	f, err := os.Open(dbFile); if err!=nil { return }; defer f.Close()
-	gz, err := gzip.NewReader(f); if err!=nil { return }; defer gz.Close()
-	gob.NewDecoder(gz).Decode(&history)
-}
-
-func getProcessStats() []ProcessInfo {
-	procs, _ := process.Processes(); var list []ProcessInfo
-	procIOMutex.Lock(); defer procIOMutex.Unlock()
-	if procCache==nil { procCache=make(map[int32]*process.Process) }
-	if prevProcIO==nil { prevProcIO=make(map[int32]process.IOCountersStat) }
-	seen := make(map[int32]bool)
-	for _, p := range procs {
-		seen[p.Pid] = true
-		if _, ok := procCache[p.Pid]; !ok { procCache[p.Pid] = p }
-		proc := procCache[p.Pid]
-		c, _ := proc.CPUPercent(); m, _ := proc.MemoryInfo()
-		var dR, dW uint64
-		io, err := proc.IOCounters()
-		if err==nil {
-			if pv, ok := prevProcIO[p.Pid]; ok {
-				if io.ReadBytes >= pv.ReadBytes { dR = io.ReadBytes - pv.ReadBytes }
-				if io.WriteBytes >= pv.WriteBytes { dW = io.WriteBytes - pv.WriteBytes }
-			}
-			prevProcIO[p.Pid] = *io
-		}
-		mv := 0.0; if m!=nil { mv = float64(m.RSS) }
-		n, _ := proc.Name()
-		if c>=0 || mv>1024*1024 { list = append(list, ProcessInfo{PID: p.Pid, Name: n, CPU: c, Mem: mv, DiskRead: dR, DiskWrite: dW}) }
+func getHeartbeats() []HeartbeatStatus {
+	cfgMutex.RLock(); hbs := config.Heartbeats; cfgMutex.RUnlock()
+	heartbeatMutex.Lock(); defer heartbeatMutex.Unlock()
+	var res []HeartbeatStatus
+	for _, hb := range hbs {
+		// A heartbeat that has never pinged gets one full interval from startup before it counts as late
+		last, ok := heartbeatSeen[hb.Name]
+		if !ok { last = startTime }
+		late := hb.Interval > 0 && time.Since(last) > time.Duration(hb.Interval)*time.Second
+		st := HeartbeatStatus{Name: hb.Name, Interval: hb.Interval, Late: late}
+		if ok { st.LastSeen = last.Unix() }
+		res = append(res, st)
 	}
-	for pid := range procCache { if !seen[pid] { delete(procCache, pid); delete(prevProcIO, pid) } }
-	sort.Slice(list, func(i, j int) bool { return (list[i].CPU + list[i].Mem/1024/1024) > (list[j].CPU + list[j].Mem/1024/1024) })
-	if len(list)>500 { return list[:500] }
-	return list
-}
-
-func getPorts() []PortInfo {
-	c, _ := net.Connections("inet"); var res []PortInfo
-	for _, x := range c {
-		if x.Status == "LISTEN" {
-			n := ""; if x.Pid > 0 { if p, err := process.NewProcess(x.Pid); err == nil { n, _ = p.Name() } }
-			res = append(res, PortInfo{Port: int(x.Laddr.Port), Proto: getProto(x.Type), PID: x.Pid, Name: n})
-		}
+	return res
+}
+
+func collectProcesses() {
+	p, grp := getProcessStats(); pts := getPorts(p)
+	dataMutex.Lock(); latestProcs = p; latestPorts = pts; latestGroups = grp; dataMutex.Unlock()
+}
+
+// getPorts lists listening sockets (ports_windows.go, ports_other.go); owners are named from the
+// process scan that just ran, so only those outside it need a lookup. Their clients go to talkers.go.
+func getPorts(procs []ProcessInfo) []PortInfo {
+	res, conns, err := listeningPorts(); collectErr("ports", err)
+	noteTalkers(res, conns); noteGeoConns(conns)
+	if err != nil { noteCap("ports", collectorCap{Note: "listening ports can't be read here: " + err.Error()}) } else { noteCap("ports", collectorCap{OK: true}) }
+	names := make(map[int32]string, len(procs))
+	for _, p := range procs { names[p.PID] = p.Name }
+	unknown := 0
+	for i := range res {
+		x := &res[i]
+		if n, ok := names[x.PID]; ok { x.Name = n } else if x.PID > 0 { if p, err := process.NewProcess(x.PID); err == nil { x.Name, _ = p.Name() } }
+		if x.PID == 0 { unknown++ }
 	}
+	// Unprivileged, the owners of other users' sockets can't be found.
+	if err == nil && unknown > 0 && !privileged() { noteCap("ports", collectorCap{OK: true, Partial: true, Note: fmt.Sprintf("the owner of %d of %d ports can't be seen without root (see --run-as)", unknown, len(res))}) }
 	sort.Slice(res, func(i, j int) bool { return res[i].Port < res[j].Port })
+	if err == nil { watchPorts(res) }
 	return res
 }
 func getProto(t uint32) string { if t==1 { return "TCP" }; if t==2 { return "UDP" }; return strconv.Itoa(int(t)) }
 
 func main() {
-	history = make([]RichMetrics, 0, historySeconds)
+	args, err := parseFlags(os.Args[1:])
+	if err == flag.ErrHelp { return }
+	if err != nil { fmt.Fprintln(os.Stderr, "Error:", err); os.Exit(2) }
+	if (len(args) == 2 || len(args) == 3) && args[0] == "passwd" {
+		role := ""
+		if len(args) == 3 { role = args[2] }
+		if err := setPassword(args[1], role); err != nil { fmt.Fprintln(os.Stderr, "Error:", err); os.Exit(1) }
+		return
+	}
+	if len(args) == 1 && args[0] == "tui" {
+		if err := runTUI(); err != nil { fmt.Fprintln(os.Stderr, "Error:", err); os.Exit(1) }
+		return
+	}
+	if len(args) > 0 && args[0] == "check" { os.Exit(runCheck(args[1:])) }
+	if len(args) > 0 && args[0] == "migrate-data" { os.Exit(runMigrateData(args[1:])) }
+	if len(args) > 0 && args[0] == "restore" { os.Exit(runRestore(args[1:])) }
+	if len(args) > 0 && args[0] == "baseline" { os.Exit(runBaselineCommand(args[1:])) }
+	if len(args) > 0 {
+		if ok, err := runClient(args[0], args[1:]); ok {
+			if err != nil { fmt.Fprintln(os.Stderr, "Error:", err); os.Exit(1) }
+			return
+		}
+		if err := serviceCommand(args); err != nil { fmt.Fprintln(os.Stderr, "Error:", err); os.Exit(1) }
+		return
+	}
+	if runAs != "" {
+		if err := dropPrivileges(runAs); err != nil { fmt.Fprintln(os.Stderr, "Error:", err); os.Exit(1) }
+	}
+	if runningAsService() {
+		if err := runService(run); err != nil { slog.Error("service failed", "err", err); os.Exit(1) }
+		return
+	}
+	run()
+}
+
+// run starts collecting and serves the dashboard until the process is stopped.
+func run() {
+	notePrivileges()
+	loadConfig()
+	useDataFile(config)
 	loadHistory()
+	recordRevision(config, "", "startup")
 	go startCollector()
+	go startDigest()
+	go watchConfig()
 	c := make(chan os.Signal, 1); signal.Notify(c, os.Interrupt, syscall.SIGTERM)
-	go func() { <-c; saveHistory(); os.Exit(0) }()
-	go func() { for range time.Tick(1 * time.Minute) { saveHistory() } }()
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "text/html"); fmt.Fprint(w, htmlDashboard)
-	})
+	// A second signal skips the orderly shutdown.
+	go func() { <-c; go shutdown(); <-c; os.Exit(1) }()
+	go historySaver()
+	go watchCollector()
+	go runForwarders()
+	go runEmitters()
+	go runPassive()
+	go runAlertmanager()
+	go runEBPF()
+	go runOOMWatch()
+	go runARPWatch()
+	go runBaseline()
+	go runFederation()
+	go runCollectors()
+	go runStatsd()
+	http.HandleFunc("/", serveDashboard)
+	http.Handle("/assets/", http.StripPrefix("/assets/", http.HandlerFunc(serveAsset)))
 	http.HandleFunc("/config", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method == "POST" {
-			var c AppConfig; json.NewDecoder(r.Body).Decode(&c)
-			cfgMutex.Lock(); config = c; cfgMutex.Unlock(); saveConfig()
-		} else { cfgMutex.RLock(); json.NewEncoder(w).Encode(config); cfgMutex.RUnlock() }
+			if !hasRole(r, "admin") { http.Error(w, "forbidden: requires admin", http.StatusForbidden); return }
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBody))
+			if err != nil { http.Error(w, "config too large (limit 1 MB)", http.StatusRequestEntityTooLarge); return }
+			errs, err := updateConfig(body, actor(r), "settings")
+			code := http.StatusBadRequest
+			if err != nil { errs, code = []fieldError{{"", err.Error()}}, http.StatusInternalServerError }
+			if len(errs) > 0 {
+				w.Header().Set("Content-Type", "application/json"); w.WriteHeader(code)
+				json.NewEncoder(w).Encode(map[string]interface{}{"errors": errs}); return
+			}
+		} else { cfgMutex.RLock(); c := redactConfig(config); cfgMutex.RUnlock(); json.NewEncoder(w).Encode(c) }
 	})
-	http.HandleFunc("/history", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json"); historyMutex.RLock(); defer historyMutex.RUnlock()
-		json.NewEncoder(w).Encode(history)
+	http.HandleFunc("/config/revisions", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json"); json.NewEncoder(w).Encode(listRevisions())
 	})
-	http.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "text/event-stream"); w.Header().Set("Cache-Control", "no-cache"); w.Header().Set("Connection", "keep-alive")
-		for {
-			select {
-			case <-r.Context().Done(): return
-			case <-broadcast:
-				latestMutex.RLock(); d, _ := json.Marshal(latestMetric); latestMutex.RUnlock()
-				fmt.Fprintf(w, "data: %s\n\n", d); if f, ok := w.(http.Flusher); ok { f.Flush() }
-			}
+	http.HandleFunc("/config/rollback", needRole("admin", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" { http.Error(w, "POST required", http.StatusMethodNotAllowed); return }
+		id, _ := strconv.Atoi(r.URL.Query().Get("id"))
+		if err := rollbackConfig(id, actor(r)); err != nil { http.Error(w, err.Error(), http.StatusBadRequest); return }
+		fmt.Fprintln(w, "OK")
+	}))
+	http.HandleFunc("/login", handleLogin)
+	http.HandleFunc("/logout", handleLogout)
+	http.HandleFunc("/session", func(w http.ResponseWriter, r *http.Request) {
+		cfgMutex.RLock(); auth := len(config.Users) > 0; cfgMutex.RUnlock()
+		w.Header().Set("Content-Type", "application/json"); json.NewEncoder(w).Encode(map[string]interface{}{"auth": auth, "user": currentUser(r), "role": requestRole(r)})
+	})
+	http.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		h := healthStatus()
+		w.Header().Set("Content-Type", "application/json")
+		if h.Status != "ok" { w.WriteHeader(http.StatusServiceUnavailable) }
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": h.Status, "collector_lag": h.CollectorLag})
+	})
+	http.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json"); json.NewEncoder(w).Encode(healthStatus())
+	})
+	http.HandleFunc("/heartbeat/", func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/heartbeat/")
+		found := false
+		cfgMutex.RLock(); for _, hb := range config.Heartbeats { if hb.Name == name { found = true } }; cfgMutex.RUnlock()
+		if !found { http.Error(w, "unknown heartbeat", http.StatusNotFound); return }
+		heartbeatMutex.Lock(); heartbeatSeen[name] = time.Now(); heartbeatMutex.Unlock()
+		fmt.Fprintln(w, "OK")
+	})
+	http.HandleFunc("/plugin", func(w http.ResponseWriter, r *http.Request) {
+		id := r.URL.Query().Get("name")
+		if id == "" { id = r.URL.Query().Get("path") }
+		dataMutex.RLock(); p, ok := pluginDetails[id]; dataMutex.RUnlock()
+		if !ok { http.Error(w, "unknown plugin", http.StatusNotFound); return }
+		w.Header().Set("Content-Type", "application/json"); json.NewEncoder(w).Encode(p)
+	})
+	http.HandleFunc("/notify/test", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == "POST" && !hasRole(r, "admin") { http.Error(w, "forbidden: requires admin", http.StatusForbidden); return }
+		if r.Method != "POST" {
+			var names []string
+			for n := range notifiers { names = append(names, n) }
+			sort.Strings(names); json.NewEncoder(w).Encode(names); return
 		}
+		// The settings form sends its unsaved values so credentials can be checked before saving.
+		var req struct {
+			Channel string     `json:"channel"`
+			Level   string     `json:"level"`
+			Config  *AppConfig `json:"config"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil { http.Error(w, err.Error(), http.StatusBadRequest); return }
+		cfgMutex.RLock(); cfg := config; cfgMutex.RUnlock()
+		if req.Config != nil { c := *req.Config; keepSecrets(&c, cfg); cfg = c }
+		res := map[string]interface{}{"channel": req.Channel, "ok": true}
+		if _, ok := notifiers[req.Channel]; !ok {
+			w.WriteHeader(http.StatusBadRequest); res["ok"] = false; res["error"] = "unknown channel"
+		} else if err := sendTestAlert(cfg, req.Channel, req.Level); err != nil {
+			code := http.StatusBadGateway
+			if err == errNotConfigured { code = http.StatusBadRequest }
+			w.WriteHeader(code); res["ok"] = false; res["error"] = err.Error()
+		}
+		auditLog("notify_test", map[string]interface{}{"user": actor(r), "channel": req.Channel, "level": req.Level, "ok": res["ok"]})
+		json.NewEncoder(w).Encode(res)
+	})
+	http.HandleFunc("/report", func(w http.ResponseWriter, r *http.Request) {
+		period := r.URL.Query().Get("period")
+		if period != "weekly" { period = "daily" }
+		if r.Method == "POST" {
+			if !hasRole(r, "operator") { http.Error(w, "forbidden: requires operator", http.StatusForbidden); return }
+			cfgMutex.RLock(); cfg := config; cfgMutex.RUnlock()
+			if err := sendDigest(cfg, period); err != nil { http.Error(w, redactError(cfg, err).Error(), http.StatusBadGateway); return }
+			auditLog("digest_sent", map[string]interface{}{"user": actor(r), "period": period})
+			fmt.Fprintln(w, "OK"); return
+		}
+		w.Header().Set("Content-Type", "application/json"); json.NewEncoder(w).Encode(buildDigest(period))
+	})
+	http.HandleFunc("/forecast", func(w http.ResponseWriter, r *http.Request) {
+		cfgMutex.RLock(); cfg := config; cfgMutex.RUnlock()
+		w.Header().Set("Content-Type", "application/json"); json.NewEncoder(w).Encode(currentForecasts(cfg))
+	})
+	http.HandleFunc("/anomaly", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json"); json.NewEncoder(w).Encode(anomalyBaselines())
+	})
+	http.HandleFunc("/alerts", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json"); alertLogMutex.RLock(); defer alertLogMutex.RUnlock()
+		json.NewEncoder(w).Encode(alertHistory)
+	})
+	http.HandleFunc("/alerts/active", func(w http.ResponseWriter, r *http.Request) {
+		cfgMutex.RLock(); cfg := config; cfgMutex.RUnlock()
+		w.Header().Set("Content-Type", "application/json"); json.NewEncoder(w).Encode(currentAlerts(cfg))
+	})
+	http.HandleFunc("/alerts/ack", needRole("operator", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" { http.Error(w, "POST required", http.StatusMethodNotAllowed); return }
+		if err := ackAlert(r.URL.Query().Get("monitor"), actor(r)); err != nil { http.Error(w, err.Error(), http.StatusNotFound); return }
+		fmt.Fprintln(w, "OK")
+	}))
+	http.HandleFunc("/remediate", needRole("operator", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" { http.Error(w, "POST required", http.StatusMethodNotAllowed); return }
+		if err := runRemediationNow(r.URL.Query().Get("monitor"), actor(r)); err != nil { http.Error(w, err.Error(), http.StatusNotFound); return }
+		w.WriteHeader(http.StatusAccepted); fmt.Fprintln(w, "started")
+	}))
+	http.HandleFunc("/history", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if hq, agg, err := parseHistQuery(r.URL.Query()); agg {
+			var res queryResult
+			if err == nil { res, err = queryHistory(hq) }
+			if err != nil { http.Error(w, err.Error(), http.StatusBadRequest); return }
+			json.NewEncoder(w).Encode(res)
+			return
+		}
+		historyMutex.RLock(); defer historyMutex.RUnlock()
+		json.NewEncoder(w).Encode(history.Copy(0, history.Len()))
+	})
+	http.HandleFunc("/history/export", handleExport)
+	http.HandleFunc("GET /chart.png", handleChartPNG)
+	http.HandleFunc("GET /public", handleStatusPage)
+	http.HandleFunc("GET /public/status.json", handleStatusPage)
+	http.HandleFunc("/status.txt", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8"); fmt.Fprintln(w, statusLine())
 	})
-	fmt.Println("PULSE v30: FULL ALERTING SUITE"); fmt.Println("http://localhost:8080"); http.ListenAndServe(":8080", nil)
+	http.HandleFunc("/events", handleEvents)
+	http.HandleFunc("/ws", handleWS)
+	registerAPI(http.DefaultServeMux)
+	registerGrafana(http.DefaultServeMux)
+	registerLayoutAPI(http.DefaultServeMux)
+	registerPrefsAPI(http.DefaultServeMux)
+	registerRunsAPI(http.DefaultServeMux)
+	registerGroupsAPI(http.DefaultServeMux)
+	registerARPAPI(http.DefaultServeMux)
+	registerBaselineAPI(http.DefaultServeMux)
+	registerFederation(http.DefaultServeMux)
+	registerFleetAPI(http.DefaultServeMux)
+	registerStorageAPI(http.DefaultServeMux)
+	registerHostAPI(http.DefaultServeMux)
+	registerCollectorAPI(http.DefaultServeMux)
+	registerIngestAPI(http.DefaultServeMux)
+	registerCatalogAPI(http.DefaultServeMux)
+	registerReportAPI(http.DefaultServeMux)
+	registerIncidentsAPI(http.DefaultServeMux)
+	registerAuditAPI(http.DefaultServeMux)
+	registerEventsAPI(http.DefaultServeMux)
+	registerPush(http.DefaultServeMux)
+	fmt.Println("PULSE v30: FULL ALERTING SUITE")
+	cfgMutex.RLock(); cfg := config; cfgMutex.RUnlock()
+	if err := startServers(cfg, forwarded(logRequests(allowClients(limitRequests(cors(requireAuth(debugGate(http.DefaultServeMux)))))))); err != http.ErrServerClosed { httpLog.Error("server failed", "err", err); os.Exit(1) }
+	<-shutdownDone
 }
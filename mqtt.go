@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// --- MQTT ---
+// Publishes a retained metrics summary to <topic>/state on every mqtt_interval,
+// alert events to <topic>/alerts (as the "mqtt" notifier) and online/offline to <topic>/status.
+
+type mqttSummary struct {
+	Timestamp int64             `json:"ts"`
+	Hostname  string            `json:"host"`
+	Uptime    uint64            `json:"uptime"`
+	Load1     float64           `json:"load1"`
+	Procs     int               `json:"procs"`
+	CPUTotal  float64           `json:"cpu"`
+	MemUsed   float64           `json:"mem"`
+	SwapUsed  float64           `json:"swap"`
+	DiskUsed  float64           `json:"disk"`
+	DiskRead  uint64            `json:"disk_read"`
+	DiskWrite uint64            `json:"disk_write"`
+	NetDown   uint64            `json:"net_down"`
+	NetUp     uint64            `json:"net_up"`
+	Plugins   map[string]int    `json:"plugins,omitempty"`
+	Alerts    map[string]string `json:"alerts"`
+}
+
+var (
+	mqttClient mqtt.Client
+	mqttKey    string
+	mqttLast   time.Time
+	mqttMutex  sync.Mutex
+)
+
+func mqttPrefix(cfg AppConfig, host string) string {
+	if cfg.MqttTopic != "" { return cfg.MqttTopic }
+	return "pulse/" + host
+}
+
+// mqttConn returns a client for the configured broker, reconnecting when the settings change.
+func mqttConn(cfg AppConfig, host string) mqtt.Client {
+	mqttMutex.Lock(); defer mqttMutex.Unlock()
+	key := cfg.MqttBroker + "|" + cfg.MqttUser + "|" + cfg.MqttPass + "|" + mqttPrefix(cfg, host)
+	if key == mqttKey { return mqttClient }
+	if mqttClient != nil { mqttClient.Disconnect(250); mqttClient = nil }
+	mqttKey = key
+	if cfg.MqttBroker == "" { return nil }
+	status := mqttPrefix(cfg, host) + "/status"
+	opts := mqtt.NewClientOptions().AddBroker(cfg.MqttBroker).SetClientID("pulse-" + host).
+		SetUsername(cfg.MqttUser).SetPassword(cfg.MqttPass).SetWill(status, "offline", 1, true).
+		SetAutoReconnect(true).SetConnectRetry(true).SetConnectRetryInterval(10 * time.Second)
+	opts.SetOnConnectHandler(func(c mqtt.Client) { c.Publish(status, 1, true, "online") })
+	opts.SetConnectionLostHandler(func(_ mqtt.Client, err error) { alertLog.Warn("MQTT connection lost", "err", err) })
+	mqttClient = mqtt.NewClient(opts)
+	mqttClient.Connect()
+	return mqttClient
+}
+
+func publishMetrics(m RichMetrics) {
+	if observeOnly { return }
+	cfgMutex.RLock(); cfg := config; cfgMutex.RUnlock()
+	c := mqttConn(cfg, m.Hostname)
+	if c == nil || !c.IsConnectionOpen() { return }
+	iv := time.Duration(cfg.MqttInterval) * time.Second
+	if iv <= 0 { iv = 10 * time.Second }
+	if time.Since(mqttLast) < iv { return }
+	mqttLast = time.Now()
+	s := mqttSummary{Timestamp: m.Timestamp, Hostname: m.Hostname, Uptime: m.Uptime, Load1: m.Load1, Procs: m.Procs, CPUTotal: m.CPUTotal, MemUsed: m.MemUsed, SwapUsed: m.SwapUsed, DiskUsed: m.DiskUsed, DiskRead: m.DiskRead, DiskWrite: m.DiskWrite, NetDown: m.NetDown, NetUp: m.NetUp, Alerts: map[string]string{}}
+	if len(m.Plugins) > 0 { s.Plugins = map[string]int{} }
+	for _, p := range m.Plugins { s.Plugins[p.Name] = p.ExitCode }
+	alertMutex.Lock(); for k, v := range activeAlerts { s.Alerts[k] = v }; alertMutex.Unlock()
+	b, _ := json.Marshal(s)
+	c.Publish(mqttPrefix(cfg, m.Hostname)+"/state", 0, true, b)
+}
+
+func notifyMQTT(cfg AppConfig, ev AlertEvent) error {
+	c := mqttConn(cfg, ev.Host)
+	if c == nil { return errNotConfigured }
+	b, _ := json.Marshal(ev)
+	t := c.Publish(mqttPrefix(cfg, ev.Host)+"/alerts", 1, false, b)
+	if !t.WaitTimeout(15 * time.Second) { return fmt.Errorf("mqtt publish timed out") }
+	return t.Error()
+}
+
+// mqttClose marks the host offline on a clean shutdown; the will only fires on a dropped connection.
+func mqttClose() {
+	mqttMutex.Lock(); defer mqttMutex.Unlock()
+	if mqttClient == nil || !mqttClient.IsConnectionOpen() { return }
+	cfgMutex.RLock(); cfg := config; cfgMutex.RUnlock()
+	latestMutex.RLock(); host := latestMetric.Hostname; latestMutex.RUnlock()
+	mqttClient.Publish(mqttPrefix(cfg, host)+"/status", 1, true, "offline").WaitTimeout(2 * time.Second)
+	mqttClient.Disconnect(250)
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// --- NOTIFIERS ---
+// Every channel is a notifyFunc; dispatchAlert fans an event out to all of them.
+// A channel that isn't set up in the config returns errNotConfigured.
+
+type notifyFunc func(cfg AppConfig, ev AlertEvent) error
+
+var errNotConfigured = errors.New("channel not configured")
+
+var notifiers = map[string]notifyFunc{
+	"email":        notifyEmail,
+	"telegram":     notifyTelegram,
+	"teams":        notifyTeams,
+	"gchat":        notifyGoogleChat,
+	"twilio":       notifyTwilio,
+	"ntfy":         notifyNtfy,
+	"gotify":       notifyGotify,
+	"opsgenie":     notifyOpsgenie,
+	"victorops":    notifyVictorOps,
+	"alertmanager": notifyAlertmanager,
+	"mqtt":         notifyMQTT,
+	"push":         notifyPush,
+	"script":       notifyScript,
+}
+
+// Channels listed here only receive these levels unless severity_channels says otherwise.
+var defaultChannelLevels = map[string][]string{
+	"twilio": {"CRITICAL"},
+}
+
+var twilioAPI = "https://api.twilio.com/2010-04-01"
+
+var notifyClient = &http.Client{Timeout: 15 * time.Second}
+
+// channelWants reports whether a channel should receive an event of the given level.
+func channelWants(cfg AppConfig, channel, level string) bool {
+	levels, ok := defaultChannelLevels[channel]
+	if chans, routed := cfg.SeverityChannels[level]; routed {
+		for _, c := range chans { if c == channel { return true } }
+		return false
+	}
+	if !ok { return true }
+	for _, l := range levels { if l == level { return true } }
+	return false
+}
+
+func dispatchAlert(cfg AppConfig, ev AlertEvent) {
+	if observeOnly { return }
+	ds, matched := routeAlert(cfg, ev)
+	if !matched {
+		for name := range notifiers { if channelWants(cfg, name, ev.Level) { ds = append(ds, delivery{name, cfg}) } }
+	}
+	for _, d := range ds {
+		n, ok := notifiers[d.channel]
+		if !ok { alertLog.Error("unknown channel", "channel", d.channel); continue }
+		go func(d delivery, n notifyFunc) {
+			if err := n(d.cfg, ev); err != nil && err != errNotConfigured { alertLog.Error("notification failed", "channel", d.channel, "monitor", ev.Monitor, "err", noteNotifyError(d.channel, redactError(d.cfg, err))) }
+		}(d, n)
+	}
+}
+
+// sendTestAlert pushes a synthetic event through one channel and returns its delivery error, secrets redacted.
+func sendTestAlert(cfg AppConfig, channel, level string) error {
+	n, ok := notifiers[channel]
+	if !ok { return fmt.Errorf("unknown channel %q", channel) }
+	if level == "" { level = "WARNING" }
+	host, _ := os.Hostname()
+	return redactError(cfg, n(cfg, AlertEvent{Time: time.Now().Unix(), Monitor: "Test", Level: level, Host: host,
+		Message: "Test notification from Pulse. If you can read this, the " + channel + " channel works."}))
+}
+
+func alertTitle(ev AlertEvent) string {
+	if ev.Level == "OK" { return fmt.Sprintf("RECOVERED %s on %s", ev.Monitor, ev.Host) }
+	return fmt.Sprintf("%s %s on %s", ev.Level, ev.Monitor, ev.Host)
+}
+
+type statusError struct {
+	code int
+	msg  string
+}
+
+func (e *statusError) Error() string { return e.msg }
+
+func doNotify(req *http.Request) error {
+	resp, err := notifyClient.Do(req)
+	if err != nil { return err }
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		var buf bytes.Buffer
+		buf.ReadFrom(resp.Body)
+		return &statusError{resp.StatusCode, fmt.Sprintf("%s: %s", resp.Status, bytes.TrimSpace(buf.Bytes()))}
+	}
+	return nil
+}
+
+func postJSON(url string, body interface{}) error {
+	b, _ := json.Marshal(body)
+	req, err := http.NewRequest("POST", url, bytes.NewReader(b))
+	if err != nil { return err }
+	req.Header.Set("Content-Type", "application/json")
+	return doNotify(req)
+}
+
+// withRetry retries network errors, 429 and 5xx responses with exponential backoff.
+func withRetry(attempts int, fn func() error) error {
+	var err error
+	for i := 0; i < attempts; i++ {
+		if err = fn(); err == nil { return nil }
+		var se *statusError
+		if errors.As(err, &se) && se.code != http.StatusTooManyRequests && se.code < 500 { return err }
+		if i < attempts-1 { time.Sleep(time.Duration(1<<i) * time.Second) }
+	}
+	return err
+}
+
+// alertAlias identifies one monitor on one host, so incident tools dedupe repeats and close on recovery.
+func alertAlias(ev AlertEvent) string { return "pulse:" + ev.Host + ":" + ev.Monitor }
+
+func notifyOpsgenie(cfg AppConfig, ev AlertEvent) error {
+	if cfg.OpsgenieKey == "" { return errNotConfigured }
+	api := strings.TrimRight(cfg.OpsgenieURL, "/")
+	if api == "" { api = "https://api.opsgenie.com" }
+	var req *http.Request
+	var b []byte
+	if ev.Level == "OK" {
+		b, _ = json.Marshal(map[string]string{"source": "Pulse", "note": ev.Message})
+		req, _ = http.NewRequest("POST", api+"/v2/alerts/"+url.PathEscape(alertAlias(ev))+"/close?identifierType=alias", bytes.NewReader(b))
+	} else {
+		prio := map[string]string{"CRITICAL": "P1", "WARNING": "P3"}[ev.Level]
+		b, _ = json.Marshal(map[string]interface{}{
+			"message": truncate(alertTitle(ev), 130), "alias": alertAlias(ev), "priority": prio, "source": "Pulse",
+			"description": fmt.Sprintf("Value: %.2f\n%s", ev.Value, ev.Message), "tags": []string{"pulse", ev.Level},
+			"details": map[string]string{"host": ev.Host, "monitor": ev.Monitor},
+		})
+		req, _ = http.NewRequest("POST", api+"/v2/alerts", bytes.NewReader(b))
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "GenieKey "+cfg.OpsgenieKey)
+	return doNotify(req)
+}
+
+func notifyVictorOps(cfg AppConfig, ev AlertEvent) error {
+	if cfg.VictorOpsURL == "" { return errNotConfigured }
+	target := strings.TrimRight(cfg.VictorOpsURL, "/")
+	if cfg.VictorOpsRoutingKey != "" { target += "/" + url.PathEscape(cfg.VictorOpsRoutingKey) }
+	mt := ev.Level
+	if ev.Level == "OK" { mt = "RECOVERY" }
+	return postJSON(target, map[string]interface{}{
+		"message_type": mt, "entity_id": alertAlias(ev), "entity_display_name": alertTitle(ev),
+		"state_message": ev.Message, "host_name": ev.Host, "monitoring_tool": "Pulse", "metric_value": ev.Value,
+	})
+}
+
+func truncate(s string, n int) string { if len(s) <= n { return s }; return s[:n] }
+
+// notifyScript pipes the event JSON to a local command, with the main fields and host_meta also set as PULSE_* variables.
+func notifyScript(cfg AppConfig, ev AlertEvent) error {
+	if cfg.NotifyCommand == "" { return errNotConfigured }
+	b, _ := json.Marshal(ev)
+	env := map[string]string{"PULSE_ID": fmt.Sprint(ev.ID), "PULSE_TIME": fmt.Sprint(ev.Time), "PULSE_LEVEL": ev.Level, "PULSE_MONITOR": ev.Monitor,
+		"PULSE_HOST": ev.Host, "PULSE_VALUE": fmt.Sprintf("%.2f", ev.Value), "PULSE_MESSAGE": ev.Message, "PULSE_TITLE": alertTitle(ev)}
+	cfg.HostMeta.env(env)
+	timeout := time.Duration(cfg.ScriptTimeout) * time.Second
+	if timeout <= 0 { timeout = 30 * time.Second }
+	r := runScript(ScriptConfig{Name: "notify", Command: cfg.NotifyCommand, Env: env, stdin: b}, timeout)
+	if r.ExitCode != 0 {
+		msg := r.Output
+		if r.Stderr != "" { msg = r.Stderr }
+		return fmt.Errorf("exit %d: %s", r.ExitCode, msg)
+	}
+	return nil
+}
+
+func notifyNtfy(cfg AppConfig, ev AlertEvent) error {
+	if cfg.NtfyTopic == "" { return errNotConfigured }
+	server := strings.TrimRight(cfg.NtfyURL, "/")
+	if server == "" { server = "https://ntfy.sh" }
+	prio := map[string]string{"CRITICAL": "5", "WARNING": "4", "OK": "3"}[ev.Level]
+	tag := map[string]string{"CRITICAL": "rotating_light", "WARNING": "warning", "OK": "white_check_mark"}[ev.Level]
+	body := ev.Message
+	if body == "" { body = fmt.Sprintf("Value: %.2f", ev.Value) }
+	return withRetry(3, func() error {
+		req, err := http.NewRequest("POST", server+"/"+url.PathEscape(cfg.NtfyTopic), strings.NewReader(body))
+		if err != nil { return err }
+		req.Header.Set("Title", "Pulse: "+alertTitle(ev))
+		req.Header.Set("Priority", prio)
+		req.Header.Set("Tags", tag)
+		if cfg.NtfyToken != "" { req.Header.Set("Authorization", "Bearer "+cfg.NtfyToken) }
+		return doNotify(req)
+	})
+}
+
+func notifyGotify(cfg AppConfig, ev AlertEvent) error {
+	if cfg.GotifyURL == "" || cfg.GotifyToken == "" { return errNotConfigured }
+	prio := map[string]int{"CRITICAL": 8, "WARNING": 5, "OK": 2}[ev.Level]
+	msg := ev.Message
+	if msg == "" { msg = fmt.Sprintf("Value: %.2f", ev.Value) }
+	// The token goes in a header: in the URL it would show up in every error about the request.
+	b, _ := json.Marshal(map[string]interface{}{"title": "Pulse: " + alertTitle(ev), "message": msg, "priority": prio})
+	return withRetry(3, func() error {
+		req, err := http.NewRequest("POST", strings.TrimRight(cfg.GotifyURL, "/")+"/message", bytes.NewReader(b))
+		if err != nil { return err }
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Gotify-Key", cfg.GotifyToken)
+		return doNotify(req)
+	})
+}
+
+// alertFacts are the label/value rows shown on chat cards.
+func alertFacts(ev AlertEvent) [][2]string {
+	facts := [][2]string{{"Monitor", ev.Monitor}, {"Status", ev.Level}, {"Host", ev.Host}}
+	if ev.Level != "OK" { facts = append(facts, [2]string{"Value", fmt.Sprintf("%.2f", ev.Value)}) }
+	if ev.Message != "" { facts = append(facts, [2]string{"Message", ev.Message}) }
+	return append(facts, [2]string{"Time", time.Unix(ev.Time, 0).Format(time.RFC1123)})
+}
+
+func notifyTeams(cfg AppConfig, ev AlertEvent) error {
+	if cfg.TeamsWebhook == "" { return errNotConfigured }
+	color := map[string]string{"OK": "Good", "WARNING": "Warning", "CRITICAL": "Attention"}[ev.Level]
+	var facts []map[string]string
+	for _, f := range alertFacts(ev) { facts = append(facts, map[string]string{"title": f[0], "value": f[1]}) }
+	card := map[string]interface{}{
+		"$schema": "http://adaptivecards.io/schemas/adaptive-card.json", "type": "AdaptiveCard", "version": "1.4",
+		"body": []interface{}{
+			map[string]interface{}{"type": "TextBlock", "text": "Pulse: " + alertTitle(ev), "weight": "Bolder", "size": "Medium", "color": color, "wrap": true},
+			map[string]interface{}{"type": "FactSet", "facts": facts},
+		},
+	}
+	return postJSON(cfg.TeamsWebhook, map[string]interface{}{
+		"type":        "message",
+		"attachments": []interface{}{map[string]interface{}{"contentType": "application/vnd.microsoft.card.adaptive", "content": card}},
+	})
+}
+
+func notifyGoogleChat(cfg AppConfig, ev AlertEvent) error {
+	if cfg.GChatWebhook == "" { return errNotConfigured }
+	var widgets []interface{}
+	for _, f := range alertFacts(ev) {
+		widgets = append(widgets, map[string]interface{}{"decoratedText": map[string]interface{}{"topLabel": f[0], "text": html.EscapeString(f[1]), "wrapText": true}})
+	}
+	return postJSON(cfg.GChatWebhook, map[string]interface{}{
+		"text": "Pulse: " + alertTitle(ev),
+		"cardsV2": []interface{}{map[string]interface{}{"cardId": fmt.Sprintf("pulse-%d", ev.ID), "card": map[string]interface{}{
+			"header":   map[string]interface{}{"title": "Pulse: " + ev.Level, "subtitle": ev.Monitor + " on " + ev.Host},
+			"sections": []interface{}{map[string]interface{}{"widgets": widgets}},
+		}}},
+	})
+}
+
+func notifyTwilio(cfg AppConfig, ev AlertEvent) error {
+	if cfg.TwilioSID == "" || cfg.TwilioToken == "" || cfg.TwilioFrom == "" || len(cfg.TwilioTo) == 0 { return errNotConfigured }
+	text := "Pulse: " + alertTitle(ev)
+	if ev.Message != "" { text += " - " + ev.Message }
+	var errs []error
+	for _, to := range cfg.TwilioTo {
+		if err := twilioPost(cfg, "Messages.json", url.Values{"To": {to}, "From": {cfg.TwilioFrom}, "Body": {text}}); err != nil {
+			errs = append(errs, fmt.Errorf("sms %s: %w", to, err))
+		}
+		// Recoveries never place calls, nobody needs to be woken up for good news
+		if cfg.TwilioVoice && ev.Level != "OK" {
+			twiml := "<Response><Say loop=\"2\">" + html.EscapeString(text) + "</Say></Response>"
+			if err := twilioPost(cfg, "Calls.json", url.Values{"To": {to}, "From": {cfg.TwilioFrom}, "Twiml": {twiml}}); err != nil {
+				errs = append(errs, fmt.Errorf("call %s: %w", to, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func twilioPost(cfg AppConfig, resource string, form url.Values) error {
+	req, _ := http.NewRequest("POST", twilioAPI+"/Accounts/"+cfg.TwilioSID+"/"+resource, strings.NewReader(form.Encode()))
+	req.SetBasicAuth(cfg.TwilioSID, cfg.TwilioToken)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := notifyClient.Do(req)
+	if err != nil { return err }
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		var e struct{ Message string `json:"message"` }
+		json.NewDecoder(resp.Body).Decode(&e)
+		return fmt.Errorf("%s: %s", resp.Status, e.Message)
+	}
+	return nil
+}
+
+func notifyTelegram(cfg AppConfig, ev AlertEvent) error {
+	if cfg.TelegramToken == "" || len(cfg.TelegramChatIDs) == 0 { return errNotConfigured }
+	icon := map[string]string{"OK": "✅", "WARNING": "⚠️", "CRITICAL": "🔴"}[ev.Level]
+	text := fmt.Sprintf("%s <b>%s</b>", icon, html.EscapeString(alertTitle(ev)))
+	if ev.Level != "OK" { text += fmt.Sprintf("\nValue: <code>%.2f</code>", ev.Value) }
+	if ev.Message != "" { text += "\n" + html.EscapeString(ev.Message) }
+	url := "https://api.telegram.org/bot" + cfg.TelegramToken + "/sendMessage"
+	var errs []error
+	for _, id := range cfg.TelegramChatIDs {
+		if err := postJSON(url, map[string]interface{}{"chat_id": id, "text": text, "parse_mode": "HTML"}); err != nil { errs = append(errs, fmt.Errorf("chat %s: %w", id, err)) }
+	}
+	return errors.Join(errs...)
+}
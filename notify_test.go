@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// useConfig makes c the running config for one test.
+func useConfig(t *testing.T, c AppConfig) {
+	cfgMutex.Lock(); saved := config; config = c; cfgMutex.Unlock()
+	t.Cleanup(func() { cfgMutex.Lock(); config = saved; cfgMutex.Unlock() })
+}
+
+func TestTelegramTokenNotInStatus(t *testing.T) {
+	const token = "123456789:AAHsecretBotToken"
+	cfg := AppConfig{TelegramToken: token, TelegramChatIDs: []string{"42"}}
+	useConfig(t, cfg)
+	saved := notifyClient
+	notifyClient = &http.Client{Transport: &http.Transport{DialContext: func(context.Context, string, string) (net.Conn, error) { return nil, errors.New("connection refused") }}}
+	t.Cleanup(func() { notifyClient = saved })
+
+	err := notifyTelegram(cfg, AlertEvent{Monitor: "CPU", Level: "CRITICAL", Host: "test"})
+	if err == nil || !strings.Contains(err.Error(), token) { t.Fatalf("expected a dial error carrying the request URL, got %v", err) }
+	logged := noteNotifyError("telegram", err)
+	b, _ := json.Marshal(healthStatus())
+	for what, s := range map[string]string{"/status": string(b), "the log": logged.Error()} {
+		if strings.Contains(s, token) || strings.Contains(s, "AAHsecret") { t.Errorf("token in %s: %s", what, s) }
+	}
+	if !strings.Contains(string(b), "connection refused") { t.Errorf("/status lost the reason: %s", b) }
+	if err := sendTestAlert(cfg, "telegram", ""); err == nil || strings.Contains(err.Error(), token) { t.Errorf("test notification error: %v", err) }
+}
+
+func TestGotifyTokenInHeader(t *testing.T) {
+	const token = "AgotifySecretToken"
+	var key, query string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { key, query = r.Header.Get("X-Gotify-Key"), r.URL.RawQuery }))
+	defer srv.Close()
+	if err := notifyGotify(AppConfig{GotifyURL: srv.URL, GotifyToken: token}, AlertEvent{Monitor: "CPU", Level: "WARNING", Host: "test"}); err != nil { t.Fatal(err) }
+	if key != token || strings.Contains(query, token) { t.Errorf("X-Gotify-Key %q, query %q", key, query) }
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// --- OOM KILLS ---
+// When the kernel runs out of memory it kills a process, and all the memory chart shows is a dip.
+// On Linux Pulse follows the kernel log (/dev/kmsg) for the OOM killer's reports and records each
+// kill: the process, its memory, its cgroup and process group, and the task whose allocation set
+// it off. Without the right to read the log (root, or cap_syslog with --run-as) kills can only be
+// counted from /proc/vmstat, so they come without a process. Kills are kept in pulse.oom.json,
+// marked on the CPU & memory chart, and raise "OOM Kill" for ten minutes after the last one.
+
+type OOMKill struct {
+	Time       int64  `json:"time"`
+	PID        int32  `json:"pid,omitempty"`
+	Name       string `json:"name,omitempty"` // empty when the kill was only counted
+	RSS        uint64 `json:"rss,omitempty"`  // bytes (anon + file + shmem) when killed
+	Cgroup     string `json:"cgroup,omitempty"`
+	Group      string `json:"group,omitempty"`
+	Constraint string `json:"constraint,omitempty"` // CONSTRAINT_NONE: the host ran out; CONSTRAINT_MEMCG: a cgroup hit its limit
+	Trigger    string `json:"trigger,omitempty"`    // the process whose allocation invoked the killer
+}
+
+const (
+	maxOOMKills = 200
+	oomAlertFor = 10 * time.Minute
+)
+
+var oomFile = "pulse.oom.json"
+
+var (
+	oomMutex  sync.Mutex
+	oomKills  []OOMKill // oldest first
+	oomLoaded bool
+)
+
+func loadOOM() {
+	if oomLoaded { return }
+	oomLoaded = true
+	if b, err := os.ReadFile(oomFile); err == nil {
+		if err := json.Unmarshal(b, &oomKills); err != nil { storageLog.Error("cannot read OOM kills", "file", oomFile, "err", err) }
+	}
+}
+
+// addOOM records k unless it is already known, which happens when the kernel log is read again
+// from the start after a restart.
+func addOOM(k OOMKill) {
+	oomMutex.Lock(); defer oomMutex.Unlock()
+	loadOOM()
+	for _, o := range oomKills {
+		if k.PID != 0 && o.PID == k.PID && o.Name == k.Name && o.Time >= k.Time-2 && o.Time <= k.Time+2 { return }
+	}
+	oomKills = append(oomKills, k)
+	if len(oomKills) > maxOOMKills { oomKills = oomKills[len(oomKills)-maxOOMKills:] }
+	collectorLog.Warn("OOM kill", "pid", k.PID, "name", k.Name, "rss", k.RSS, "cgroup", k.Cgroup, "trigger", k.Trigger)
+	if observeOnly { return }
+	b, _ := json.MarshalIndent(oomKills, "", "  ")
+	tmp := oomFile + ".tmp"
+	err := os.WriteFile(tmp, b, 0600)
+	if err == nil { err = os.Rename(tmp, oomFile) }
+	if err != nil { storageLog.Error("cannot save OOM kills", "file", oomFile, "err", err) }
+}
+
+func (k OOMKill) String() string {
+	if k.Name == "" { return "a process was killed for lack of memory (the kernel log can't be read to tell which)" }
+	s := fmt.Sprintf("%s (pid %d, %s) was killed", k.Name, k.PID, fmtBytes(k.RSS))
+	if k.Constraint == "CONSTRAINT_MEMCG" { s += " at the memory limit of " + k.Cgroup } else { s += ": out of memory" }
+	if k.Trigger != "" && k.Trigger != k.Name { s += ", set off by " + k.Trigger }
+	return s
+}
+
+// checkOOM keeps "OOM Kill" firing while a kill is recent; the value is how many there were.
+func checkOOM(m RichMetrics, alert func(n, lvl string, v float64, msg string)) {
+	oomMutex.Lock(); defer oomMutex.Unlock()
+	loadOOM()
+	n, since := 0, m.Timestamp-int64(oomAlertFor/time.Second)
+	for _, k := range oomKills { if k.Time > since { n++ } }
+	if n == 0 { return }
+	msg := oomKills[len(oomKills)-1].String()
+	if n > 1 { msg += fmt.Sprintf(" (%d kills in the last 10 minutes)", n) }
+	alert("OOM Kill", "CRITICAL", float64(n), msg)
+}
+
+// handleOOM is GET /api/v1/oom: kills newest first, optionally between start and end.
+func handleOOM(w http.ResponseWriter, r *http.Request) {
+	limit, offset, ok := pageParams(w, r)
+	if !ok { return }
+	q := r.URL.Query()
+	start, ok1 := parseTimeParam(q.Get("start"), 0)
+	end, ok2 := parseTimeParam(q.Get("end"), 1<<62)
+	if !ok1 || !ok2 { apiFail(w, http.StatusBadRequest, apiError{"bad_request", "start and end must be unix seconds or RFC 3339", nil}); return }
+	list := []OOMKill{}
+	oomMutex.Lock()
+	loadOOM()
+	for i := len(oomKills) - 1; i >= 0; i-- { if k := oomKills[i]; k.Time >= start && k.Time <= end { list = append(list, k) } }
+	oomMutex.Unlock()
+	lo, hi, meta := pageBounds(len(list), limit, offset)
+	apiOK(w, 200, list[lo:hi], meta)
+}
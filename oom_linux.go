@@ -0,0 +1,112 @@
+//go:build linux
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// The OOM killer reports a kill in three lines, in this order:
+//   <comm> invoked oom-killer: gfp_mask=..., order=0, oom_score_adj=0
+//   oom-kill:constraint=CONSTRAINT_MEMCG,...,task_memcg=/system.slice/foo.service,task=foo,pid=1234,uid=0
+//   Memory cgroup out of memory: Killed process 1234 (foo) total-vm:..kB, anon-rss:..kB, file-rss:..kB, shmem-rss:..kB, ...
+// The middle one appeared in 4.19; before it only the first and last tell anything.
+var oomKilled = regexp.MustCompile(`Killed process (\d+) \((.*)\) total-vm:\d+kB, anon-rss:(\d+)kB, file-rss:(\d+)kB, shmem-rss:(\d+)kB`)
+
+type oomParser struct {
+	trigger string
+	detail  map[string]string // the last oom-kill: line
+}
+
+// line takes one kernel log message and returns a kill when it completes one.
+func (p *oomParser) line(msg string) (OOMKill, bool) {
+	if who, ok := strings.CutSuffix(strings.SplitN(msg, ": gfp_mask", 2)[0], " invoked oom-killer"); ok { p.trigger = who; return OOMKill{}, false }
+	if rest, ok := strings.CutPrefix(msg, "oom-kill:"); ok {
+		p.detail = map[string]string{}
+		for _, kv := range strings.Split(rest, ",") { if k, v, ok := strings.Cut(kv, "="); ok { p.detail[k] = v } }
+		return OOMKill{}, false
+	}
+	m := oomKilled.FindStringSubmatch(msg)
+	if m == nil { return OOMKill{}, false }
+	pid, _ := strconv.Atoi(m[1])
+	k := OOMKill{PID: int32(pid), Name: m[2], Trigger: p.trigger}
+	for _, s := range m[3:6] { kb, _ := strconv.ParseUint(s, 10, 64); k.RSS += kb * 1024 }
+	if p.detail["pid"] == m[1] {
+		k.Constraint, k.Cgroup = p.detail["constraint"], p.detail["task_memcg"]
+		if k.Constraint == "CONSTRAINT_MEMCG" && p.detail["oom_memcg"] != "" { k.Cgroup = p.detail["oom_memcg"] }
+		if c := p.detail["task_memcg"]; c != "" { procIOMutex.Lock(); k.Group, _ = cgroupGroup(c); procIOMutex.Unlock() }
+	}
+	p.trigger, p.detail = "", nil
+	return k, true
+}
+
+// bootTime is when the kernel started, in unix seconds, which kernel log timestamps count from.
+func bootTime() int64 {
+	f, err := os.Open("/proc/stat")
+	if err != nil { return time.Now().Unix() }
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if v, ok := strings.CutPrefix(sc.Text(), "btime "); ok { t, _ := strconv.ParseInt(v, 10, 64); return t }
+	}
+	return time.Now().Unix()
+}
+
+// runOOMWatch reads the kernel log from its start (so kills from before Pulse started are caught
+// too), then as it grows; it falls back to counting kills when the log can't be read.
+func runOOMWatch() {
+	f, err := os.Open("/dev/kmsg")
+	if err != nil {
+		noteCap("oom", collectorCap{OK: true, Partial: true, Note: "the kernel log can't be read (" + err.Error() + "), so OOM kills are counted without the process; run Pulse as root or with cap_syslog"})
+		countOOM()
+		return
+	}
+	noteCap("oom", collectorCap{OK: true})
+	go func() { <-stopCtx.Done(); f.Close() }()
+	boot := bootTime()
+	var p oomParser
+	buf := make([]byte, 8192) // each read returns one record, at most 1 KB of text plus its properties
+	for {
+		n, err := f.Read(buf)
+		if errors.Is(err, syscall.EPIPE) { continue } // records were overwritten before they were read
+		if err != nil {
+			if stopCtx.Err() == nil { collectorLog.Error("cannot read the kernel log", "err", err); noteCap("oom", collectorCap{Note: "reading the kernel log failed: " + err.Error()}) }
+			return
+		}
+		// "priority,sequence,microseconds since boot,flags;message", then continuation lines.
+		head, msg, ok := strings.Cut(string(buf[:n]), ";")
+		if !ok { continue }
+		msg, _, _ = strings.Cut(msg, "\n")
+		k, ok := p.line(msg)
+		if !ok { continue }
+		if f := strings.Split(head, ","); len(f) > 2 { us, _ := strconv.ParseInt(f[2], 10, 64); k.Time = boot + us/1e6 }
+		addOOM(k)
+	}
+}
+
+// countOOM watches the oom_kill counter in /proc/vmstat (Linux 4.13 and later).
+func countOOM() {
+	read := func() (uint64, bool) {
+		b, err := os.ReadFile("/proc/vmstat")
+		if err != nil { return 0, false }
+		for _, line := range strings.Split(string(b), "\n") {
+			if v, ok := strings.CutPrefix(line, "oom_kill "); ok { n, _ := strconv.ParseUint(v, 10, 64); return n, true }
+		}
+		return 0, false
+	}
+	last, ok := read()
+	if !ok { noteCap("oom", collectorCap{Note: "neither the kernel log nor the oom_kill counter can be read here"}); return }
+	t := time.NewTicker(5 * time.Second); defer t.Stop()
+	for {
+		select { case <-stopCtx.Done(): return; case <-t.C: }
+		n, _ := read()
+		for ; last < n; last++ { addOOM(OOMKill{Time: time.Now().Unix()}) }
+	}
+}
@@ -0,0 +1,5 @@
+//go:build !linux
+
+package main
+
+func runOOMWatch() { noteCap("oom", collectorCap{Note: "OOM kills are only detected on Linux"}) }
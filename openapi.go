@@ -0,0 +1,336 @@
+package main
+
+// openAPISpec describes /api/v1/; "{{base}}" is replaced with the configured base path.
+const openAPISpec = `{
+  "openapi": "3.0.3",
+  "info": {"title": "Pulse API", "version": "1", "description": "Metrics, history, processes, alerts and configuration of one Pulse agent. Responses are wrapped as {data, meta}; errors as {error: {code, message, fields}}. Each client IP may make rate_limit requests a second (429 with Retry-After beyond that); bodies are limited to 1 MB (413)."},
+  "servers": [{"url": "{{base}}/api/v1"}],
+  "security": [{"cookie": []}, {"basic": []}],
+  "paths": {
+    "/status": {"get": {"summary": "Pulse's own health", "tags": ["system"], "responses": {"200": {"$ref": "#/components/responses/Object"}}}},
+    "/ebpf": {"get": {"summary": "eBPF collectors (Linux): recent process starts, TCP retransmits per connection and disk latency histograms, with load errors", "tags": ["system"], "responses": {"200": {"$ref": "#/components/responses/Object"}}}},
+    "/snapshot": {"get": {"summary": "Latest sample in full, with processes, ports, plugins, heartbeats and mounts", "tags": ["metrics"], "responses": {"200": {"$ref": "#/components/responses/Sample"}, "503": {"$ref": "#/components/responses/Error"}}}},
+    "/metrics": {"get": {"summary": "Latest sample without processes, ports and plugins", "tags": ["metrics"], "responses": {"200": {"$ref": "#/components/responses/Sample"}, "503": {"$ref": "#/components/responses/Error"}}}},
+    "/mobile": {"get": {"summary": "Compact summary for phones: worst level, CPU, memory, fullest mount, load, network and active alerts", "tags": ["metrics"], "responses": {"200": {"$ref": "#/components/responses/Object"}}}},
+    "/history": {"get": {"summary": "Stored samples, oldest first", "tags": ["metrics"],
+      "parameters": [
+        {"name": "start", "in": "query", "schema": {"type": "string"}, "description": "Unix seconds or RFC 3339"},
+        {"name": "end", "in": "query", "schema": {"type": "string"}, "description": "Unix seconds or RFC 3339"},
+        {"name": "fields", "in": "query", "schema": {"type": "string"}, "description": "Comma-separated sample fields to return besides ts, e.g. cpu_tot,mem_used; with points or step, export fields such as plugin:<name>/<label> or mount:<path>"},
+        {"name": "points", "in": "query", "schema": {"type": "integer", "minimum": 1, "maximum": 10000}, "description": "Aggregate into about this many buckets per field instead of returning samples"},
+        {"name": "step", "in": "query", "schema": {"type": "integer", "minimum": 1}, "description": "Aggregate into buckets of this many seconds"},
+        {"name": "agg", "in": "query", "schema": {"type": "string"}, "description": "With points or step: which of min,max,avg,p95 to return (default all)"},
+        {"$ref": "#/components/parameters/limit"}, {"$ref": "#/components/parameters/offset"}],
+      "responses": {"200": {"description": "Samples, or with points or step one aggregate", "content": {"application/json": {"schema": {"type": "object", "properties": {"data": {"oneOf": [{"type": "array", "items": {"$ref": "#/components/schemas/Sample"}}, {"$ref": "#/components/schemas/Aggregate"}]}, "meta": {"$ref": "#/components/schemas/Meta"}}}}}}, "400": {"$ref": "#/components/responses/Error"}}}},
+    "/backup": {"get": {"summary": "Download a .tar.gz of history, config, revisions, alert log, preferences and keys (admin); restore with pulse restore", "tags": ["system"],
+      "parameters": [{"name": "secrets", "in": "query", "schema": {"type": "boolean", "default": true}, "description": "false leaves out pulse.secret and the push key"}],
+      "responses": {"200": {"description": "gzip-compressed tar", "content": {"application/gzip": {}}}, "403": {"$ref": "#/components/responses/Error"}}}},
+    "/catalog": {"get": {"summary": "How each field is shown: display name, unit, scale (bytes or si) and chart ceiling, from the built-in catalog and metric_catalog", "tags": ["metrics"],
+      "parameters": [{"name": "field", "in": "query", "schema": {"type": "string"}, "description": "Describe one field, e.g. plugin:backup/age"}],
+      "responses": {"200": {"description": "By field", "content": {"application/json": {"schema": {"type": "object", "properties": {"data": {"type": "object", "additionalProperties": {"$ref": "#/components/schemas/MetricInfo"}}, "meta": {"$ref": "#/components/schemas/Meta"}}}}}}}}},
+    "/reports": {"get": {"summary": "SLA report: availability of thresholds and checks, p50/p95/p99 of metrics and downtime incidents over a period", "tags": ["metrics"],
+      "parameters": [{"name": "month", "in": "query", "schema": {"type": "string", "example": "2026-09"}, "description": "A calendar month (local time); otherwise start and end"},
+        {"name": "start", "in": "query", "schema": {"type": "string"}, "description": "Unix seconds or RFC 3339 (default: 30 days before end)"},
+        {"name": "end", "in": "query", "schema": {"type": "string"}, "description": "Unix seconds or RFC 3339 (default: now)"},
+        {"name": "metrics", "in": "query", "schema": {"type": "string"}, "description": "Comma-separated export fields"},
+        {"name": "level", "in": "query", "schema": {"type": "string", "enum": ["critical", "warning"], "default": "critical"}, "description": "warning holds objectives to the warn thresholds and checks to OK"},
+        {"name": "target", "in": "query", "schema": {"type": "number"}, "description": "SLA target in % (default: sla_target)"},
+        {"name": "format", "in": "query", "schema": {"type": "string", "enum": ["json", "html", "pdf"], "default": "json"}}],
+      "responses": {"200": {"description": "The report", "content": {"application/json": {"schema": {"type": "object", "properties": {"data": {"$ref": "#/components/schemas/Report"}}}}, "text/html": {}, "application/pdf": {}}},
+        "400": {"$ref": "#/components/responses/Error"}}}},
+    "/collectors": {"get": {"summary": "Metric collectors (Go and external commands): interval, last run and success, duration, metrics returned and the last error", "tags": ["metrics"],
+      "responses": {"200": {"description": "Collectors", "content": {"application/json": {"schema": {"type": "object", "properties": {"data": {"type": "array", "items": {"type": "object"}}, "meta": {"$ref": "#/components/schemas/Meta"}}}}}}}}},
+    "/ingest": {"post": {"summary": "Push gauges and counters from local applications (operator)", "tags": ["metrics"],
+      "requestBody": {"required": true, "content": {"application/json": {"schema": {"oneOf": [{"$ref": "#/components/schemas/IngestMetric"}, {"type": "array", "items": {"$ref": "#/components/schemas/IngestMetric"}},
+        {"type": "object", "properties": {"metrics": {"type": "array", "items": {"$ref": "#/components/schemas/IngestMetric"}}}}]}}}},
+      "responses": {"202": {"description": "accepted, and rejected with reasons", "content": {"application/json": {"schema": {"type": "object", "properties": {"data": {"type": "object", "properties": {"accepted": {"type": "integer"}, "rejected": {"type": "array", "items": {"type": "object"}}}}}}}}},
+        "400": {"$ref": "#/components/responses/Error"}, "403": {"$ref": "#/components/responses/Error"}, "413": {"$ref": "#/components/responses/Error"}, "422": {"$ref": "#/components/responses/Error"}}},
+      "get": {"summary": "Current ingested series", "tags": ["metrics"],
+      "responses": {"200": {"description": "Series", "content": {"application/json": {"schema": {"type": "object", "properties": {"data": {"type": "array", "items": {"$ref": "#/components/schemas/Metric"}}, "meta": {"$ref": "#/components/schemas/Meta"}}}}}}}}},
+    "/storage": {"get": {"summary": "Disk used by Pulse's files, samples held, the history quota and what it thinned or evicted, and free space", "tags": ["system"], "responses": {"200": {"$ref": "#/components/responses/Object"}}}},
+    "/history/purge": {"post": {"summary": "Delete stored samples older than a time and save the history file (admin)", "tags": ["metrics"],
+      "parameters": [{"name": "before", "in": "query", "required": true, "schema": {"type": "string"}, "description": "Unix seconds or RFC 3339"}],
+      "responses": {"200": {"$ref": "#/components/responses/Object"}, "400": {"$ref": "#/components/responses/Error"}, "403": {"$ref": "#/components/responses/Error"}}}},
+    "/processes": {"get": {"summary": "Processes from the latest scan", "tags": ["processes"],
+      "parameters": [
+        {"name": "sort", "in": "query", "schema": {"type": "string", "enum": ["cpu", "mem", "io", "pid", "name"]}},
+        {"name": "name", "in": "query", "schema": {"type": "string"}, "description": "Case-insensitive substring"},
+        {"name": "group", "in": "query", "schema": {"type": "string"}, "description": "Only this group's processes"},
+        {"$ref": "#/components/parameters/limit"}, {"$ref": "#/components/parameters/offset"}],
+      "responses": {"200": {"description": "Processes", "content": {"application/json": {"schema": {"type": "object", "properties": {"data": {"type": "array", "items": {"$ref": "#/components/schemas/Process"}}, "meta": {"$ref": "#/components/schemas/Meta"}}}}}}, "400": {"$ref": "#/components/responses/Error"}}}},
+    "/processes/history": {"get": {"summary": "One process's samples by key, summed over the processes sharing it, with the pids it had and when each was first and last seen (samples paged)", "tags": ["processes"],
+      "parameters": [
+        {"name": "key", "in": "query", "required": true, "schema": {"type": "string"}, "description": "The process name, or its key field (name#hash) for process_key_cmdline names"},
+        {"name": "start", "in": "query", "schema": {"type": "string"}, "description": "Unix seconds or RFC 3339"},
+        {"name": "end", "in": "query", "schema": {"type": "string"}, "description": "Unix seconds or RFC 3339"},
+        {"$ref": "#/components/parameters/limit"}, {"$ref": "#/components/parameters/offset"}],
+      "responses": {"200": {"$ref": "#/components/responses/Object"}, "400": {"$ref": "#/components/responses/Error"}, "404": {"$ref": "#/components/responses/Error"}}}},
+    "/processes/{pid}": {"get": {"summary": "One process", "tags": ["processes"],
+      "parameters": [{"name": "pid", "in": "path", "required": true, "schema": {"type": "integer"}}],
+      "responses": {"200": {"description": "Process", "content": {"application/json": {"schema": {"type": "object", "properties": {"data": {"$ref": "#/components/schemas/Process"}}}}}}, "404": {"$ref": "#/components/responses/Error"}}}},
+    "/groups": {"get": {"summary": "Processes summed per container, systemd unit or cgroup (per name outside Linux), from the latest scan", "tags": ["processes"],
+      "parameters": [
+        {"name": "sort", "in": "query", "schema": {"type": "string", "enum": ["cpu", "mem", "io", "procs", "name"]}},
+        {"name": "kind", "in": "query", "schema": {"type": "string", "enum": ["docker", "podman", "container", "systemd", "cgroup", "name"]}},
+        {"$ref": "#/components/parameters/limit"}, {"$ref": "#/components/parameters/offset"}],
+      "responses": {"200": {"description": "Groups", "content": {"application/json": {"schema": {"type": "object", "properties": {"data": {"type": "array", "items": {"$ref": "#/components/schemas/ProcessGroup"}}, "meta": {"$ref": "#/components/schemas/Meta"}}}}}}, "400": {"$ref": "#/components/responses/Error"}}}},
+    "/groups/{name}": {"get": {"summary": "One group's history, oldest first (paged)", "tags": ["processes"],
+      "parameters": [
+        {"name": "name", "in": "path", "required": true, "schema": {"type": "string"}, "description": "May contain slashes"},
+        {"name": "start", "in": "query", "schema": {"type": "string"}, "description": "Unix seconds or RFC 3339"},
+        {"name": "end", "in": "query", "schema": {"type": "string"}, "description": "Unix seconds or RFC 3339"},
+        {"$ref": "#/components/parameters/limit"}, {"$ref": "#/components/parameters/offset"}],
+      "responses": {"200": {"description": "Samples", "content": {"application/json": {"schema": {"type": "object", "properties": {"data": {"type": "array", "items": {"allOf": [{"$ref": "#/components/schemas/ProcessGroup"}, {"type": "object", "properties": {"ts": {"type": "integer"}}}]}}, "meta": {"$ref": "#/components/schemas/Meta"}}}}}}, "400": {"$ref": "#/components/responses/Error"}, "404": {"$ref": "#/components/responses/Error"}}}},
+    "/ports": {"get": {"summary": "Listening ports", "tags": ["processes"], "responses": {"200": {"description": "Ports", "content": {"application/json": {"schema": {"type": "object", "properties": {"data": {"type": "array", "items": {"$ref": "#/components/schemas/Port"}}, "meta": {"$ref": "#/components/schemas/Meta"}}}}}}}}},
+    "/ports/{port}/clients": {"get": {"summary": "Clients of a listening TCP port: open connections, accepted connections and accept rate over the window, client IPs busiest first (paged)", "tags": ["processes"],
+      "parameters": [
+        {"name": "port", "in": "path", "required": true, "schema": {"type": "integer"}},
+        {"name": "window", "in": "query", "schema": {"type": "integer", "minimum": 1, "maximum": 300, "default": 60}, "description": "Seconds to count accepted connections over"},
+        {"$ref": "#/components/parameters/limit"}, {"$ref": "#/components/parameters/offset"}
+      ],
+      "responses": {"200": {"$ref": "#/components/responses/Object"}, "400": {"$ref": "#/components/responses/Error"}, "404": {"$ref": "#/components/responses/Error"}}}},
+    "/oom": {"get": {"summary": "OOM kills, newest first (Linux)", "tags": ["processes"],
+      "parameters": [
+        {"name": "start", "in": "query", "schema": {"type": "string"}, "description": "Unix seconds or RFC 3339"},
+        {"name": "end", "in": "query", "schema": {"type": "string"}, "description": "Unix seconds or RFC 3339"},
+        {"$ref": "#/components/parameters/limit"}, {"$ref": "#/components/parameters/offset"}],
+      "responses": {"200": {"description": "Kills", "content": {"application/json": {"schema": {"type": "object", "properties": {"data": {"type": "array", "items": {"$ref": "#/components/schemas/OOMKill"}}, "meta": {"$ref": "#/components/schemas/Meta"}}}}}}, "400": {"$ref": "#/components/responses/Error"}}}},
+    "/ports/events": {"get": {"summary": "Listening ports that opened or closed, newest first", "tags": ["processes"],
+      "parameters": [
+        {"name": "kind", "in": "query", "schema": {"type": "string", "enum": ["opened", "closed"]}},
+        {"name": "start", "in": "query", "schema": {"type": "string"}, "description": "Unix seconds or RFC 3339"},
+        {"name": "end", "in": "query", "schema": {"type": "string"}, "description": "Unix seconds or RFC 3339"},
+        {"$ref": "#/components/parameters/limit"}, {"$ref": "#/components/parameters/offset"}],
+      "responses": {"200": {"description": "Events", "content": {"application/json": {"schema": {"type": "object", "properties": {"data": {"type": "array", "items": {"$ref": "#/components/schemas/PortEvent"}}, "meta": {"$ref": "#/components/schemas/Meta"}}}}}}, "400": {"$ref": "#/components/responses/Error"}}}},
+    "/arp": {"get": {"summary": "IP to MAC table of the arp_subnets as last seen, by IP", "tags": ["processes"],
+      "parameters": [{"$ref": "#/components/parameters/limit"}, {"$ref": "#/components/parameters/offset"}],
+      "responses": {"200": {"description": "Entries", "content": {"application/json": {"schema": {"type": "object", "properties": {"data": {"type": "array", "items": {"$ref": "#/components/schemas/ARPEntry"}}, "meta": {"$ref": "#/components/schemas/Meta"}}}}}}}}},
+    "/arp/events": {"get": {"summary": "New MACs, changed MACs and duplicate IPs, newest first", "tags": ["processes"],
+      "parameters": [
+        {"name": "kind", "in": "query", "schema": {"type": "string", "enum": ["new", "changed", "conflict"]}},
+        {"name": "start", "in": "query", "schema": {"type": "string"}, "description": "Unix seconds or RFC 3339"},
+        {"name": "end", "in": "query", "schema": {"type": "string"}, "description": "Unix seconds or RFC 3339"},
+        {"$ref": "#/components/parameters/limit"}, {"$ref": "#/components/parameters/offset"}],
+      "responses": {"200": {"description": "Events", "content": {"application/json": {"schema": {"type": "object", "properties": {"data": {"type": "array", "items": {"$ref": "#/components/schemas/ARPEvent"}}, "meta": {"$ref": "#/components/schemas/Meta"}}}}}}, "400": {"$ref": "#/components/responses/Error"}}}},
+    "/baseline": {
+      "get": {"summary": "The saved baseline and what differs from it at the last comparison; 404 until one is saved", "tags": ["system"],
+        "responses": {"200": {"description": "Drift", "content": {"application/json": {"schema": {"type": "object", "properties": {"data": {"$ref": "#/components/schemas/DriftReport"}}}}}}, "404": {"$ref": "#/components/responses/Error"}}},
+      "post": {"summary": "Save the host as it is now as the baseline, accepting any drift (admin)", "tags": ["system"],
+        "responses": {"200": {"description": "Baseline", "content": {"application/json": {"schema": {"type": "object", "properties": {"data": {"$ref": "#/components/schemas/Baseline"}}}}}}, "403": {"$ref": "#/components/responses/Error"}}}},
+    "/federation": {"get": {"summary": "The federate_sources as last pulled, in config order", "tags": ["system"],
+      "parameters": [{"name": "q", "in": "query", "schema": {"type": "string"}, "description": "Words matching the name, host or host_meta; tag=, env=, owner=, location= or <label>= match one field"}],
+      "responses": {"200": {"description": "Sites", "content": {"application/json": {"schema": {"type": "object", "properties": {"data": {"type": "array", "items": {"$ref": "#/components/schemas/FederatedSite"}}, "meta": {"$ref": "#/components/schemas/Meta"}}}}}}}}},
+    "/fleet": {"get": {"summary": "One tile per federated host, the sites below regional sources included, in config order", "tags": ["system"],
+      "parameters": [{"name": "q", "in": "query", "schema": {"type": "string"}, "description": "As for /federation, but only matching hosts are kept"},
+        {"name": "group", "in": "query", "schema": {"type": "string"}, "description": "Only this host group; empty for the hosts without one"}],
+      "responses": {"200": {"description": "Tiles", "content": {"application/json": {"schema": {"type": "object", "properties": {"data": {"type": "array", "items": {"$ref": "#/components/schemas/FleetTile"}}, "meta": {"$ref": "#/components/schemas/Meta"}}}}}}}}},
+    "/fleet/groups": {"get": {"summary": "Each host group of the fleet summed up, in the order the groups first appear", "tags": ["system"],
+      "responses": {"200": {"description": "Groups", "content": {"application/json": {"schema": {"type": "object", "properties": {"data": {"type": "array", "items": {"$ref": "#/components/schemas/FleetGroup"}}, "meta": {"$ref": "#/components/schemas/Meta"}}}}}}}}},
+    "/host": {
+      "get": {"summary": "Host name, OS, architecture and host_meta", "tags": ["system"], "responses": {"200": {"$ref": "#/components/responses/Object"}}},
+      "put": {"summary": "Replace host_meta (admin)", "tags": ["config"],
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/HostMeta"}}}},
+        "responses": {"200": {"$ref": "#/components/responses/Object"}, "400": {"$ref": "#/components/responses/Error"}, "403": {"$ref": "#/components/responses/Error"}, "422": {"$ref": "#/components/responses/Error"}}}},
+    "/connections/geo": {"get": {"summary": "Remote ends of established TCP connections counted per country and autonomous system; 404 unless geoip_db is set", "tags": ["processes"], "responses": {"200": {"$ref": "#/components/responses/Object"}, "404": {"$ref": "#/components/responses/Error"}}}},
+    "/checks/{name}": {
+      "parameters": [{"name": "name", "in": "path", "required": true, "schema": {"type": "string", "pattern": "^[A-Za-z0-9][A-Za-z0-9._-]{0,99}$"}}],
+      "post": {"summary": "Report a cron job's result (operator); it appears among the monitors as \"run {name}\"", "tags": ["plugins"],
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"type": "object", "properties": {"exit_code": {"type": "integer"}, "duration": {"type": "number", "description": "Seconds"}, "output": {"type": "string"}, "perf": {"type": "string", "description": "Nagios perfdata"}, "every": {"type": "integer", "description": "Seconds between runs; CRITICAL once a result is older than that plus 10%"}, "timed_out": {"type": "boolean"}}}}}},
+        "responses": {"200": {"$ref": "#/components/responses/Object"}, "400": {"$ref": "#/components/responses/Error"}, "403": {"$ref": "#/components/responses/Error"}}},
+      "get": {"summary": "A cron job's last result as a monitor", "tags": ["plugins"], "responses": {"200": {"$ref": "#/components/responses/Object"}, "404": {"$ref": "#/components/responses/Error"}}},
+      "delete": {"summary": "Forget a cron job (admin)", "tags": ["plugins"], "responses": {"200": {"$ref": "#/components/responses/Object"}, "404": {"$ref": "#/components/responses/Error"}}}
+    },
+    "/mounts": {"get": {"summary": "Real filesystems, read now: space, inodes, device and type", "tags": ["metrics"], "responses": {"200": {"description": "Mounts", "content": {"application/json": {"schema": {"type": "object", "properties": {"data": {"type": "array", "items": {"$ref": "#/components/schemas/Mount"}}, "meta": {"$ref": "#/components/schemas/Meta"}}}}}}}}},
+    "/disks": {"get": {"summary": "Block devices with throughput over the last sample", "tags": ["metrics"], "responses": {"200": {"description": "Disks", "content": {"application/json": {"schema": {"type": "object", "properties": {"data": {"type": "array", "items": {"$ref": "#/components/schemas/Disk"}}, "meta": {"$ref": "#/components/schemas/Meta"}}}}}}}}},
+    "/plugins": {"get": {"summary": "Latest result of every custom monitor", "tags": ["plugins"], "responses": {"200": {"description": "Plugins", "content": {"application/json": {"schema": {"type": "object", "properties": {"data": {"type": "array", "items": {"$ref": "#/components/schemas/Plugin"}}, "meta": {"$ref": "#/components/schemas/Meta"}}}}}}}}},
+    "/plugins/{id}": {"get": {"summary": "Full output of one monitor, by name or command", "tags": ["plugins"],
+      "parameters": [{"name": "id", "in": "path", "required": true, "schema": {"type": "string"}}],
+      "responses": {"200": {"description": "Plugin", "content": {"application/json": {"schema": {"type": "object", "properties": {"data": {"$ref": "#/components/schemas/Plugin"}}}}}}, "404": {"$ref": "#/components/responses/Error"}}}},
+    "/alerts": {"get": {"summary": "Alert events, newest first", "tags": ["alerts"],
+      "parameters": [
+        {"name": "level", "in": "query", "schema": {"type": "string", "enum": ["OK", "WARNING", "CRITICAL", "REMEDIATION", "ACK"]}},
+        {"name": "monitor", "in": "query", "schema": {"type": "string"}},
+        {"$ref": "#/components/parameters/limit"}, {"$ref": "#/components/parameters/offset"}],
+      "responses": {"200": {"description": "Events", "content": {"application/json": {"schema": {"type": "object", "properties": {"data": {"type": "array", "items": {"$ref": "#/components/schemas/AlertEvent"}}, "meta": {"$ref": "#/components/schemas/Meta"}}}}}}}}},
+    "/alerts/active": {"get": {"summary": "Monitors currently in WARNING or CRITICAL", "tags": ["alerts"], "responses": {"200": {"description": "Active alerts", "content": {"application/json": {"schema": {"type": "object", "properties": {"data": {"type": "array", "items": {"$ref": "#/components/schemas/ActiveAlert"}}, "meta": {"$ref": "#/components/schemas/Meta"}}}}}}}}},
+    "/alerts/{monitor}/ack": {"post": {"summary": "Acknowledge an active alert (operator)", "tags": ["alerts"],
+      "parameters": [{"$ref": "#/components/parameters/monitor"}],
+      "responses": {"200": {"$ref": "#/components/responses/Object"}, "403": {"$ref": "#/components/responses/Error"}, "404": {"$ref": "#/components/responses/Error"}}}},
+    "/alerts/{monitor}/remediate": {"post": {"summary": "Run the monitor's remediation command now (operator)", "tags": ["alerts"],
+      "parameters": [{"$ref": "#/components/parameters/monitor"}],
+      "responses": {"202": {"$ref": "#/components/responses/Object"}, "403": {"$ref": "#/components/responses/Error"}, "404": {"$ref": "#/components/responses/Error"}}}},
+    "/incidents": {"get": {"summary": "Alerts grouped into incidents (a monitor's first alert to its OK), newest first", "tags": ["alerts"],
+      "parameters": [
+        {"name": "monitor", "in": "query", "schema": {"type": "string"}},
+        {"name": "level", "in": "query", "schema": {"type": "string", "enum": ["WARNING", "CRITICAL"]}, "description": "The worst level reached"},
+        {"name": "open", "in": "query", "schema": {"type": "boolean"}},
+        {"name": "start", "in": "query", "schema": {"type": "string"}, "description": "Unix seconds or RFC 3339; incidents overlapping start to end"},
+        {"name": "end", "in": "query", "schema": {"type": "string"}, "description": "Unix seconds or RFC 3339"},
+        {"$ref": "#/components/parameters/limit"}, {"$ref": "#/components/parameters/offset"}],
+      "responses": {"200": {"description": "Incidents", "content": {"application/json": {"schema": {"type": "object", "properties": {"data": {"type": "array", "items": {"$ref": "#/components/schemas/Incident"}}, "meta": {"$ref": "#/components/schemas/Meta"}}}}}}, "400": {"$ref": "#/components/responses/Error"}}}},
+    "/incidents/{id}": {"get": {"summary": "One incident with its events and notes", "tags": ["alerts"],
+      "parameters": [{"name": "id", "in": "path", "required": true, "schema": {"type": "integer"}}],
+      "responses": {"200": {"description": "The incident", "content": {"application/json": {"schema": {"type": "object", "properties": {"data": {"$ref": "#/components/schemas/Incident"}}}}}}, "404": {"$ref": "#/components/responses/Error"}}}},
+    "/incidents/{id}/notes": {"post": {"summary": "Add a note to an incident (operator)", "tags": ["alerts"],
+      "parameters": [{"name": "id", "in": "path", "required": true, "schema": {"type": "integer"}}],
+      "requestBody": {"required": true, "content": {"application/json": {"schema": {"type": "object", "required": ["text"], "properties": {"text": {"type": "string", "maxLength": 2000}}}}}},
+      "responses": {"201": {"description": "The note", "content": {"application/json": {"schema": {"type": "object", "properties": {"data": {"$ref": "#/components/schemas/IncidentNote"}}}}}}, "400": {"$ref": "#/components/responses/Error"}, "403": {"$ref": "#/components/responses/Error"}, "404": {"$ref": "#/components/responses/Error"}}}},
+    "/events": {"post": {"summary": "Raise or clear alerts from other systems: CI, backup software, UPS daemons (operator)", "tags": ["alerts"],
+      "requestBody": {"required": true, "content": {"application/json": {"schema": {"oneOf": [{"$ref": "#/components/schemas/ExternalEvent"}, {"type": "array", "items": {"$ref": "#/components/schemas/ExternalEvent"}},
+        {"type": "object", "properties": {"events": {"type": "array", "items": {"$ref": "#/components/schemas/ExternalEvent"}}}}]}}}},
+      "responses": {"202": {"description": "accepted, and rejected with reasons", "content": {"application/json": {"schema": {"type": "object", "properties": {"data": {"type": "object", "properties": {"accepted": {"type": "integer"}, "rejected": {"type": "array", "items": {"type": "object"}}}}}}}}},
+        "400": {"$ref": "#/components/responses/Error"}, "403": {"$ref": "#/components/responses/Error"}, "413": {"$ref": "#/components/responses/Error"}, "422": {"$ref": "#/components/responses/Error"}}},
+      "get": {"summary": "External alerts that are on", "tags": ["alerts"],
+      "responses": {"200": {"description": "Events", "content": {"application/json": {"schema": {"type": "object", "properties": {"data": {"type": "array", "items": {"$ref": "#/components/schemas/ExternalEvent"}}, "meta": {"$ref": "#/components/schemas/Meta"}}}}}}}}},
+    "/config": {
+      "get": {"summary": "Running config, secrets masked", "tags": ["config"], "responses": {"200": {"$ref": "#/components/responses/Object"}}},
+      "patch": {"summary": "Change the given top-level keys (admin)", "tags": ["config"],
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"type": "object", "example": {"cpu_warn": 85}}}}},
+        "responses": {"200": {"$ref": "#/components/responses/Object"}, "403": {"$ref": "#/components/responses/Error"}, "422": {"$ref": "#/components/responses/Error"}}}},
+    "/config/revisions": {"get": {"summary": "Config revisions, newest first", "tags": ["config"],
+      "parameters": [{"$ref": "#/components/parameters/limit"}, {"$ref": "#/components/parameters/offset"}],
+      "responses": {"200": {"$ref": "#/components/responses/Object"}}}},
+    "/config/revisions/{id}/rollback": {"post": {"summary": "Make an earlier revision current (admin)", "tags": ["config"],
+      "parameters": [{"name": "id", "in": "path", "required": true, "schema": {"type": "integer"}}],
+      "responses": {"200": {"$ref": "#/components/responses/Object"}, "403": {"$ref": "#/components/responses/Error"}, "404": {"$ref": "#/components/responses/Error"}}}},
+    "/audit": {"get": {"summary": "Audit log entries, newest first (admin)", "tags": ["config"],
+      "parameters": [
+        {"name": "action", "in": "query", "schema": {"type": "string"}, "description": "One or more actions, comma-separated, e.g. config_change,ack"},
+        {"name": "user", "in": "query", "schema": {"type": "string"}},
+        {"name": "start", "in": "query", "schema": {"type": "string"}, "description": "Unix seconds or RFC 3339"},
+        {"name": "end", "in": "query", "schema": {"type": "string"}, "description": "Unix seconds or RFC 3339"},
+        {"name": "q", "in": "query", "schema": {"type": "string"}, "description": "Only entries containing this text, case-insensitive"},
+        {"$ref": "#/components/parameters/limit"}, {"$ref": "#/components/parameters/offset"}],
+      "responses": {"200": {"description": "Entries", "content": {"application/json": {"schema": {"type": "object", "properties": {"data": {"type": "array", "items": {"$ref": "#/components/schemas/AuditEntry"}}, "meta": {"$ref": "#/components/schemas/Meta"}}}}}},
+        "400": {"$ref": "#/components/responses/Error"}, "403": {"$ref": "#/components/responses/Error"}}}},
+    "/layout": {
+      "get": {"summary": "Dashboard panels in display order (the default layout if none is configured)", "tags": ["config"], "responses": {"200": {"$ref": "#/components/responses/Object"}}},
+      "put": {"summary": "Replace the dashboard panels; an empty list restores the default (admin)", "tags": ["config"],
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/Panel"}}}}},
+        "responses": {"200": {"$ref": "#/components/responses/Object"}, "400": {"$ref": "#/components/responses/Error"}, "403": {"$ref": "#/components/responses/Error"}, "422": {"$ref": "#/components/responses/Error"}}}},
+    "/preferences": {
+      "get": {"summary": "Your dashboard preferences, on top of default_preferences", "tags": ["preferences"], "responses": {"200": {"$ref": "#/components/responses/Object"}}},
+      "put": {"summary": "Replace your dashboard preferences; {} goes back to the defaults", "tags": ["preferences"],
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Preferences"}}}},
+        "responses": {"200": {"$ref": "#/components/responses/Object"}, "400": {"$ref": "#/components/responses/Error"}, "422": {"$ref": "#/components/responses/Error"}}}},
+    "/preferences/{user}": {
+      "parameters": [{"name": "user", "in": "path", "required": true, "schema": {"type": "string"}}],
+      "get": {"summary": "A user's dashboard preferences (admin)", "tags": ["preferences"], "responses": {"200": {"$ref": "#/components/responses/Object"}, "403": {"$ref": "#/components/responses/Error"}}},
+      "put": {"summary": "Set a user's dashboard preferences (admin)", "tags": ["preferences"],
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Preferences"}}}},
+        "responses": {"200": {"$ref": "#/components/responses/Object"}, "400": {"$ref": "#/components/responses/Error"}, "403": {"$ref": "#/components/responses/Error"}, "422": {"$ref": "#/components/responses/Error"}}},
+      "delete": {"summary": "Reset a user to the default preferences (admin)", "tags": ["preferences"], "responses": {"200": {"$ref": "#/components/responses/Object"}, "403": {"$ref": "#/components/responses/Error"}}}}
+  },
+  "components": {
+    "securitySchemes": {
+      "cookie": {"type": "apiKey", "in": "cookie", "name": "pulse_session"},
+      "basic": {"type": "http", "scheme": "basic"}
+    },
+    "parameters": {
+      "limit": {"name": "limit", "in": "query", "schema": {"type": "integer", "minimum": 1, "maximum": 1000, "default": 100}},
+      "offset": {"name": "offset", "in": "query", "schema": {"type": "integer", "minimum": 0, "default": 0}},
+      "monitor": {"name": "monitor", "in": "path", "required": true, "schema": {"type": "string"}, "description": "Monitor name as in /alerts, URL-encoded (a / becomes %2F)"}
+    },
+    "responses": {
+      "Object": {"description": "OK", "content": {"application/json": {"schema": {"type": "object", "properties": {"data": {"type": "object"}, "meta": {"$ref": "#/components/schemas/Meta"}}}}}},
+      "Sample": {"description": "Sample", "content": {"application/json": {"schema": {"type": "object", "properties": {"data": {"$ref": "#/components/schemas/Sample"}}}}}},
+      "SampleList": {"description": "Samples", "content": {"application/json": {"schema": {"type": "object", "properties": {"data": {"type": "array", "items": {"$ref": "#/components/schemas/Sample"}}, "meta": {"$ref": "#/components/schemas/Meta"}}}}}},
+      "Error": {"description": "Error", "content": {"application/json": {"schema": {"type": "object", "properties": {"error": {"$ref": "#/components/schemas/Error"}}}}}}
+    },
+    "schemas": {
+      "Aggregate": {"type": "object", "properties": {"start": {"type": "integer"}, "end": {"type": "integer"}, "step": {"type": "integer"}, "series": {"type": "array", "items": {"type": "object", "properties": {
+        "field": {"type": "string"}, "ts": {"type": "array", "items": {"type": "integer"}, "description": "Bucket starts"}, "n": {"type": "array", "items": {"type": "integer"}},
+        "min": {"type": "array", "items": {"type": "number"}}, "max": {"type": "array", "items": {"type": "number"}}, "avg": {"type": "array", "items": {"type": "number"}}, "p95": {"type": "array", "items": {"type": "number"}}}}}}},
+      "Meta": {"type": "object", "properties": {"total": {"type": "integer"}, "limit": {"type": "integer"}, "offset": {"type": "integer"}}},
+      "Error": {"type": "object", "required": ["code", "message"], "properties": {
+        "code": {"type": "string", "enum": ["bad_request", "unauthorized", "forbidden", "not_found", "invalid_config", "no_data"]},
+        "message": {"type": "string"},
+        "fields": {"type": "array", "items": {"type": "object", "properties": {"field": {"type": "string"}, "message": {"type": "string"}}}}}},
+      "Sample": {"type": "object", "properties": {
+        "ts": {"type": "integer"}, "host": {"type": "string"}, "uptime": {"type": "integer"}, "load1": {"type": "number"}, "procs": {"type": "integer"},
+        "load5": {"type": "number"}, "load15": {"type": "number"}, "cores": {"type": "integer", "description": "Logical cores"}, "load_core": {"type": "number", "description": "load1 / cores"},
+        "cpu_tot": {"type": "number"}, "mem_used": {"type": "number"}, "swp_used": {"type": "number"}, "dsk_used": {"type": "number"},
+        "dsk_read": {"type": "integer"}, "dsk_writ": {"type": "integer"}, "net_down": {"type": "integer"}, "net_up": {"type": "integer"},
+        "psi_cpu": {"type": "number", "description": "% of the time since the previous sample some task was stalled on CPU (Linux)"}, "psi_io": {"type": "number"}, "psi_io_full": {"type": "number", "description": "% of the time all non-idle tasks were stalled on IO"},
+        "psi_mem": {"type": "number"}, "psi_mem_full": {"type": "number"}, "cpu_mhz": {"type": "number", "description": "Average core clock"}, "core_mhz": {"type": "array", "items": {"type": "number"}},
+        "throttles": {"type": "integer", "description": "Thermal and power-limit throttling events since the previous sample"},
+        "p_list": {"type": "array", "items": {"$ref": "#/components/schemas/Process"}},
+        "ports": {"type": "array", "items": {"$ref": "#/components/schemas/Port"}},
+        "plugins": {"type": "array", "items": {"$ref": "#/components/schemas/Plugin"}},
+        "metrics": {"type": "array", "description": "From collectors; a series is metric:<name>{tag=value,...} in fields", "items": {"$ref": "#/components/schemas/Metric"}},
+        "heartbeats": {"type": "array", "items": {"type": "object"}},
+        "mounts": {"type": "array", "items": {"type": "object", "properties": {"path": {"type": "string"}, "total": {"type": "integer"}, "used": {"type": "integer"}, "pct": {"type": "number"}}}},
+        "disks": {"type": "array", "items": {"$ref": "#/components/schemas/Disk"}},
+        "groups": {"type": "array", "items": {"$ref": "#/components/schemas/ProcessGroup"}}}},
+      "Mount": {"type": "object", "properties": {"path": {"type": "string"}, "device": {"type": "string"}, "fstype": {"type": "string"}, "total": {"type": "integer"}, "used": {"type": "integer"}, "free": {"type": "integer"}, "pct": {"type": "number"}, "inodes_pct": {"type": "number"}, "read_only": {"type": "boolean"}}},
+      "Disk": {"type": "object", "properties": {"name": {"type": "string"}, "read": {"type": "integer", "description": "bytes/s"}, "write": {"type": "integer", "description": "bytes/s"}, "busy": {"type": "number", "description": "% of the time with I/O in flight (Linux)"}}},
+      "Process": {"type": "object", "properties": {"pid": {"type": "integer"}, "name": {"type": "string"}, "cpu": {"type": "number"}, "mem": {"type": "number", "description": "RSS bytes"}, "d_read": {"type": "integer"}, "d_write": {"type": "integer"}, "group": {"type": "string"}, "key": {"type": "string", "description": "name#cmdline-hash for process_key_cmdline names"}}},
+      "ProcessGroup": {"type": "object", "properties": {"name": {"type": "string"}, "kind": {"type": "string"}, "procs": {"type": "integer"}, "cpu": {"type": "number"}, "mem": {"type": "number", "description": "RSS bytes"}, "d_read": {"type": "integer"}, "d_write": {"type": "integer"}}},
+      "OOMKill": {"type": "object", "properties": {"time": {"type": "integer"}, "pid": {"type": "integer"}, "name": {"type": "string", "description": "Empty when the kill could only be counted"}, "rss": {"type": "integer", "description": "Bytes"},
+        "cgroup": {"type": "string"}, "group": {"type": "string"}, "constraint": {"type": "string", "enum": ["CONSTRAINT_NONE", "CONSTRAINT_MEMCG", "CONSTRAINT_CPUSET", "CONSTRAINT_MEMORY_POLICY"]}, "trigger": {"type": "string"}}},
+      "ARPEntry": {"type": "object", "properties": {"ip": {"type": "string"}, "mac": {"type": "string"}, "device": {"type": "string"}, "first": {"type": "integer", "description": "First seen with this MAC"}, "last": {"type": "integer"},
+        "prev_mac": {"type": "string", "description": "The MAC before the last change"}, "changed": {"type": "integer"}}},
+      "Baseline": {"type": "object", "properties": {"time": {"type": "integer"}, "host": {"type": "string"}, "ports": {"type": "array", "items": {"type": "string"}, "description": "Listening beyond loopback, as tcp/22"},
+        "services": {"type": "array", "items": {"type": "string"}}, "mounts": {"type": "array", "items": {"type": "string"}}, "users": {"type": "array", "items": {"type": "string"}}}},
+      "DriftReport": {"type": "object", "properties": {"baseline": {"$ref": "#/components/schemas/Baseline"}, "checked": {"type": "integer", "description": "When the host was last compared"},
+        "drift": {"type": "array", "items": {"type": "object", "properties": {"what": {"type": "string", "enum": ["ports", "services", "mounts", "users"]}, "added": {"type": "array", "items": {"type": "string"}}, "removed": {"type": "array", "items": {"type": "string"}}}}}}},
+      "Metric": {"type": "object", "properties": {"name": {"type": "string"}, "value": {"type": "number"}, "unit": {"type": "string"}, "tags": {"type": "object", "additionalProperties": {"type": "string"}}, "source": {"type": "string", "description": "The collector"}}},
+      "Report": {"type": "object", "properties": {"host": {"type": "string"}, "from": {"type": "integer"}, "to": {"type": "integer"}, "samples": {"type": "integer"}, "covered": {"type": "integer", "description": "seconds with data"},
+        "target": {"type": "number"}, "level": {"type": "string"},
+        "availability": {"type": "array", "items": {"type": "object", "properties": {"name": {"type": "string"}, "up_pct": {"type": "number"}, "covered": {"type": "integer"}, "downtime": {"type": "integer"}, "incidents": {"type": "integer"}, "met": {"type": "boolean"}}}},
+        "metrics": {"type": "array", "items": {"type": "object", "properties": {"field": {"type": "string"}, "label": {"type": "string"}, "unit": {"type": "string"}, "n": {"type": "integer"},
+          "min": {"type": "number"}, "avg": {"type": "number"}, "p50": {"type": "number"}, "p95": {"type": "number"}, "p99": {"type": "number"}, "max": {"type": "number"}}}},
+        "incidents": {"type": "array", "items": {"type": "object", "properties": {"name": {"type": "string"}, "level": {"type": "string"}, "start": {"type": "integer"}, "end": {"type": "integer"}, "duration": {"type": "integer"}, "open": {"type": "boolean"}}}}}},
+      "MetricInfo": {"type": "object", "properties": {"label": {"type": "string"}, "unit": {"type": "string"}, "scale": {"type": "string", "enum": ["bytes", "si"]}, "max": {"type": "number"}}},
+      "IngestMetric": {"type": "object", "required": ["name", "value"], "properties": {"name": {"type": "string", "pattern": "^[A-Za-z_][A-Za-z0-9_]*$"}, "value": {"type": "number"}, "unit": {"type": "string"},
+        "tags": {"type": "object", "additionalProperties": {"type": "string"}}, "type": {"type": "string", "enum": ["gauge", "counter"], "default": "gauge", "description": "A counter adds the value to its running total"}}},
+      "HostMeta": {"type": "object", "properties": {"tags": {"type": "array", "items": {"type": "string"}}, "environment": {"type": "string"}, "owner": {"type": "string"}, "location": {"type": "string"},
+        "labels": {"type": "object", "additionalProperties": {"type": "string"}}}},
+      "FederatedSite": {"type": "object", "properties": {"name": {"type": "string"}, "url": {"type": "string"}, "group": {"type": "string"}, "up": {"type": "boolean"}, "last_seen": {"type": "integer"},
+        "failures": {"type": "integer", "description": "Pulls failed in a row"}, "error": {"type": "string"},
+        "summary": {"type": "object", "description": "The site's GET /federate (outside /api/v1): host, time, status, window, cpu, mem and load1 as {avg, max}, disk, net_down, net_up, alerts and its own sites"},
+        "trend": {"type": "array", "items": {"$ref": "#/components/schemas/TrendPoint"}, "description": "The last 60 pulls"},
+        "pushed": {"type": "integer", "description": "When the site last accepted its config_templates"}, "push_error": {"type": "string", "description": "Why the last push of config_templates failed"}}},
+      "TrendPoint": {"type": "object", "properties": {"t": {"type": "integer"}, "cpu": {"type": "number"}, "mem": {"type": "number"}, "disk": {"type": "number"}}},
+      "FleetGroup": {"type": "object", "properties": {"name": {"type": "string", "description": "Empty for the hosts without a group"}, "hosts": {"type": "integer"}, "down": {"type": "integer"},
+        "status": {"type": "string", "enum": ["OK", "WARNING", "CRITICAL", "DOWN"]}, "alerts": {"type": "integer"}, "cpu": {"type": "number", "description": "Average of the hosts that are up"}, "mem": {"type": "number"}, "disk": {"type": "number", "description": "Fullest disk of any host"}}},
+      "FleetTile": {"type": "object", "properties": {"name": {"type": "string"}, "via": {"type": "array", "items": {"type": "string"}, "description": "The sites reporting it, top first"},
+        "url": {"type": "string"}, "group": {"type": "string"}, "host": {"type": "string"}, "status": {"type": "string", "enum": ["OK", "WARNING", "CRITICAL", "DOWN", "UNKNOWN", "PENDING"]}, "up": {"type": "boolean"},
+        "last_seen": {"type": "integer"}, "alerts": {"type": "integer"}, "cpu": {"type": "number"}, "mem": {"type": "number"}, "disk": {"type": "number"},
+        "meta": {"$ref": "#/components/schemas/HostMeta"}, "trend": {"type": "array", "items": {"$ref": "#/components/schemas/TrendPoint"}}}},
+      "ARPEvent": {"type": "object", "properties": {"time": {"type": "integer"}, "kind": {"type": "string", "enum": ["new", "changed", "conflict"]}, "ip": {"type": "string"}, "mac": {"type": "string"}, "old_mac": {"type": "string"}, "device": {"type": "string"}}},
+      "Port": {"type": "object", "properties": {"port": {"type": "integer"}, "proto": {"type": "string"}, "pid": {"type": "integer"}, "name": {"type": "string"}, "addr": {"type": "string", "description": "Bound address"}, "unexpected": {"type": "boolean", "description": "Listening beyond loopback but not in expected_ports"}}},
+      "PortEvent": {"type": "object", "properties": {"time": {"type": "integer"}, "kind": {"type": "string", "enum": ["opened", "closed"]}, "proto": {"type": "string"}, "port": {"type": "integer"}, "addr": {"type": "string", "description": "Bound addresses, comma separated"}, "pid": {"type": "integer"}, "name": {"type": "string"}, "new": {"type": "boolean", "description": "Never seen listening before"}}},
+      "Plugin": {"type": "object", "properties": {
+        "path": {"type": "string"}, "name": {"type": "string"}, "exit_code": {"type": "integer"}, "output": {"type": "string"},
+        "perf_val": {"type": "number"}, "perf_unit": {"type": "string"},
+        "perf": {"type": "array", "items": {"type": "object", "properties": {"label": {"type": "string"}, "value": {"type": "number"}, "unit": {"type": "string"}, "warn": {"type": "string"}, "crit": {"type": "string"}, "min": {"type": "number"}, "max": {"type": "number"}}}},
+        "long_output": {"type": "string"}, "stderr": {"type": "string"}, "duration": {"type": "number"}, "timed_out": {"type": "boolean"}}},
+      "AlertEvent": {"type": "object", "properties": {"id": {"type": "integer"}, "time": {"type": "integer"}, "monitor": {"type": "string"}, "level": {"type": "string"}, "value": {"type": "number"}, "message": {"type": "string"}, "host": {"type": "string"}, "remediation": {"type": "string"}}},
+      "Panel": {"type": "object", "required": ["id"], "properties": {
+        "id": {"type": "string", "description": "system, io, plugins, processes, alerts, top-cpu, top-mem, top-io, groups, ports, heartbeats, pressure, cpu-freq, or a name for a custom chart"},
+        "column": {"type": "string", "enum": ["left", "right"]}, "title": {"type": "string"},
+        "metrics": {"type": "array", "maxItems": 2, "items": {"type": "string"}, "description": "export fields, e.g. cpu_tot, plugin:backup/age, mount:/var"},
+        "unit": {"type": "string"}, "height": {"type": "integer"}}},
+      "Preferences": {"type": "object", "properties": {
+        "theme": {"type": "string", "enum": ["dark", "light"]}, "range": {"type": "integer", "minimum": 60, "description": "seconds shown in live mode"},
+        "panels": {"type": "array", "items": {"type": "string"}, "description": "panel ids to show; empty shows the whole layout"},
+        "colors": {"type": "object", "additionalProperties": {"type": "string"}, "description": "cpu, mem, rx, tx, read, write, plugin, forecast -> #rrggbb"}}},
+      "IncidentNote": {"type": "object", "properties": {"time": {"type": "integer"}, "user": {"type": "string"}, "text": {"type": "string"}}},
+      "AuditEntry": {"type": "object", "additionalProperties": true, "properties": {"time": {"type": "string", "format": "date-time"}, "action": {"type": "string"}, "user": {"type": "string"},
+        "changes": {"type": "array", "description": "config_change, config_reload and config_rollback", "items": {"type": "object", "properties": {"key": {"type": "string"}, "from": {}, "to": {}}}}}},
+      "Incident": {"type": "object", "properties": {"id": {"type": "integer", "description": "the id of its first alert event"}, "monitor": {"type": "string"}, "host": {"type": "string"},
+        "level": {"type": "string", "description": "the worst it got"}, "start": {"type": "integer"}, "end": {"type": "integer", "description": "missing while open"}, "duration": {"type": "integer"},
+        "open": {"type": "boolean"}, "peak": {"type": "number"}, "alerts": {"type": "integer", "description": "alert events, repeats included"},
+        "acks": {"type": "array", "items": {"type": "object", "properties": {"time": {"type": "integer"}, "user": {"type": "string"}}}},
+        "notes": {"type": "array", "items": {"$ref": "#/components/schemas/IncidentNote"}},
+        "events": {"type": "array", "items": {"$ref": "#/components/schemas/AlertEvent"}, "description": "the first alert, level changes, acknowledgements, remediations and the OK"}}},
+      "ExternalEvent": {"type": "object", "required": ["monitor"], "properties": {"monitor": {"type": "string", "maxLength": 100}, "level": {"type": "string", "enum": ["OK", "WARNING", "CRITICAL"], "default": "CRITICAL", "description": "OK clears the monitor"},
+        "message": {"type": "string"}, "value": {"type": "number"}, "source": {"type": "string", "maxLength": 50, "description": "who sent it, e.g. ci; part of the alert name"}, "ttl": {"type": "integer", "description": "seconds until it clears by itself; 0 waits for OK"},
+        "alert": {"type": "string", "readOnly": true, "description": "the monitor name it fires as: ext:<source>/<monitor>, or ext:<monitor> without a source"},
+        "time": {"type": "integer", "readOnly": true}, "expires": {"type": "integer", "readOnly": true}}},
+      "ActiveAlert": {"type": "object", "properties": {"monitor": {"type": "string"}, "level": {"type": "string"}, "acked_by": {"type": "string"}, "remediation": {"type": "boolean"}}}
+    }
+  }
+}
+`
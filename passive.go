@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// --- NAGIOS / ICINGA PASSIVE CHECKS ---
+// Every passive_interval seconds (Default: 60) Pulse submits its threshold checks (CPU, Memory,
+// Disk) and each custom monitor as passive service results for passive_host (Default: this
+// hostname). passive_type picks the way in: "icinga2" (the REST API at passive_target, e.g.
+// https://icinga:5665, as passive_user/passive_pass), "nrdp" (the NRDP URL, passive_pass is the
+// token) or "command_file" (Nagios' external command file, e.g. /usr/local/nagios/var/rw/nagios.cmd).
+// The services have to exist on the Nagios side and accept passive checks.
+
+type passiveResult struct {
+	Service string
+	Code    int
+	Output  string
+	Perf    []string
+}
+
+var passiveLast time.Time
+
+func perfString(pm PerfMetric) string {
+	f := func(p *float64) string { if p == nil { return "" }; return strconv.FormatFloat(*p, 'f', -1, 64) }
+	label := pm.Label
+	if strings.ContainsAny(label, " '=") { label = "'" + strings.ReplaceAll(label, "'", "''") + "'" }
+	return strings.TrimRight(fmt.Sprintf("%s=%s%s;%s;%s;%s;%s", label, strconv.FormatFloat(pm.Value, 'f', -1, 64), pm.Unit, pm.Warn, pm.Crit, f(pm.Min), f(pm.Max)), ";")
+}
+
+// passiveResults maps the latest sample to check results. Threshold checks report the level of the
+// active alert, so "for" delays and acknowledgements behave as they do in Pulse.
+func passiveResults(cfg AppConfig, m RichMetrics) []passiveResult {
+	alertMutex.Lock(); active := make(map[string]string, len(activeAlerts)); for k, v := range activeAlerts { active[k] = v }; alertMutex.Unlock()
+	code := func(n string) int { for i, s := range statusNames { if s == active[n] { return i } }; return 0 }
+	th := func(x float64) string { if x == 0 { return "" }; return strconv.FormatFloat(x, 'f', -1, 64) }
+	var res []passiveResult
+	for _, t := range []struct {
+		name, perf string
+		v, w, c    float64
+	}{{"CPU", "cpu", m.CPUTotal, cfg.CpuWarn, cfg.CpuCrit}, {"Memory", "mem", m.MemUsed, cfg.MemWarn, cfg.MemCrit}, {"Disk", "disk", m.DiskUsed, cfg.DskWarn, cfg.DskCrit}} {
+		c := code(t.name)
+		res = append(res, passiveResult{t.name, c, fmt.Sprintf("%s %s - %.1f%% used", t.name, statusNames[c], t.v), []string{fmt.Sprintf("%s=%.2f%%;%s;%s;0;100", t.perf, t.v, th(t.w), th(t.c))}})
+	}
+	for _, p := range m.Plugins {
+		c := p.ExitCode
+		if c < 0 || c > 3 { c = 3 }
+		var perf []string
+		for _, pm := range p.Perf { perf = append(perf, perfString(pm)) }
+		res = append(res, passiveResult{pluginID(p), c, p.Output, perf})
+	}
+	return res
+}
+
+func passiveClient(cfg AppConfig) *http.Client {
+	return &http.Client{Timeout: 15 * time.Second, Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: cfg.PassiveSkipVerify}}}
+}
+
+func passiveCheck(resp *http.Response, err error) error {
+	if err != nil { return err }
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 2048))
+	if resp.StatusCode/100 != 2 { return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body))) }
+	return nil
+}
+
+// submitIcinga posts one process-check-result per service; a service Icinga doesn't know is reported but doesn't stop the rest.
+func submitIcinga(cfg AppConfig, host string, res []passiveResult) error {
+	cl := passiveClient(cfg)
+	var errs []string
+	for _, r := range res {
+		body, _ := json.Marshal(map[string]interface{}{
+			"type": "Service", "filter": "host.name==" + strconv.Quote(host) + " && service.name==" + strconv.Quote(r.Service),
+			"exit_status": r.Code, "plugin_output": r.Output, "performance_data": r.Perf, "check_source": "pulse",
+		})
+		req, err := http.NewRequest("POST", strings.TrimSuffix(cfg.PassiveTarget, "/")+"/v1/actions/process-check-result", bytes.NewReader(body))
+		if err != nil { return err }
+		req.SetBasicAuth(cfg.PassiveUser, cfg.PassivePass)
+		req.Header.Set("Accept", "application/json"); req.Header.Set("Content-Type", "application/json")
+		if err := passiveCheck(cl.Do(req)); err != nil { errs = append(errs, r.Service+": "+err.Error()) }
+	}
+	if len(errs) > 0 { return fmt.Errorf("%s", strings.Join(errs, "; ")) }
+	return nil
+}
+
+func submitNRDP(cfg AppConfig, host string, res []passiveResult) error {
+	type checkResult struct {
+		CheckResult struct{ Type string `json:"type"` } `json:"checkresult"`
+		Hostname    string `json:"hostname"`
+		Servicename string `json:"servicename"`
+		State       string `json:"state"`
+		Output      string `json:"output"`
+	}
+	var list []checkResult
+	for _, r := range res {
+		cr := checkResult{Hostname: host, Servicename: r.Service, State: strconv.Itoa(r.Code), Output: r.Output}
+		cr.CheckResult.Type = "service"
+		if len(r.Perf) > 0 { cr.Output += " | " + strings.Join(r.Perf, " ") }
+		list = append(list, cr)
+	}
+	data, _ := json.Marshal(map[string]interface{}{"checkresults": list})
+	form := url.Values{"token": {cfg.PassivePass}, "cmd": {"submitcheck"}, "json": {string(data)}}
+	return passiveCheck(passiveClient(cfg).PostForm(cfg.PassiveTarget, form))
+}
+
+// submitCommandFile writes to Nagios' command pipe; it fails right away instead of blocking when Nagios isn't reading it.
+func submitCommandFile(cfg AppConfig, host string, res []passiveResult) error {
+	var b strings.Builder
+	now := time.Now().Unix()
+	for _, r := range res {
+		out := r.Output
+		if len(r.Perf) > 0 { out += "|" + strings.Join(r.Perf, " ") }
+		out = strings.ReplaceAll(strings.ReplaceAll(out, "\r", ""), "\n", `\n`)
+		fmt.Fprintf(&b, "[%d] PROCESS_SERVICE_CHECK_RESULT;%s;%s;%d;%s\n", now, host, r.Service, r.Code, out)
+	}
+	f, err := os.OpenFile(cfg.PassiveTarget, os.O_WRONLY|os.O_APPEND|syscall.O_NONBLOCK, 0)
+	if err != nil { return err }
+	defer f.Close()
+	_, err = io.WriteString(f, b.String())
+	return err
+}
+
+func submitPassive(m RichMetrics) {
+	cfgMutex.RLock(); cfg := config; cfgMutex.RUnlock()
+	if cfg.PassiveType == "" || cfg.PassiveTarget == "" { return }
+	iv := time.Duration(cfg.PassiveInterval) * time.Second
+	if iv <= 0 { iv = time.Minute }
+	if time.Since(passiveLast) < iv { return }
+	passiveLast = time.Now()
+	host := cfg.PassiveHost
+	if host == "" { host = m.Hostname }
+	res := passiveResults(cfg, m)
+	var err error
+	switch cfg.PassiveType {
+	case "icinga2": err = submitIcinga(cfg, host, res)
+	case "nrdp": err = submitNRDP(cfg, host, res)
+	case "command_file": err = submitCommandFile(cfg, host, res)
+	}
+	emitResult(cfg.PassiveType, err)
+}
+
+func runPassive() {
+	ch := samples.subscribe("passive"); defer samples.unsubscribe(ch)
+	for {
+		select {
+		case <-stopCtx.Done(): return
+		case m := <-ch: submitPassive(m)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"io"
+	"strings"
+)
+
+// --- PDF WRITER ---
+// Just enough PDF for reports: A4 pages of Helvetica text, lines, filled boxes and images, written
+// directly like the XLSX export so no extra library is needed. Coordinates are points from the
+// top-left corner of the page; text outside Latin-1 comes out as "?".
+
+const (
+	pdfW, pdfH = 595.0, 842.0 // A4
+	pdfMargin  = 40.0
+)
+
+type pdfDoc struct {
+	pages  []*bytes.Buffer
+	page   *bytes.Buffer
+	images []*image.RGBA
+	y      float64 // where the next line goes, from the top
+}
+
+func newPDF() *pdfDoc { d := &pdfDoc{}; d.newPage(); return d }
+
+func (d *pdfDoc) newPage() {
+	d.page = &bytes.Buffer{}
+	d.pages = append(d.pages, d.page)
+	d.y = pdfMargin
+}
+
+// need starts a new page unless h more points fit on this one.
+func (d *pdfDoc) need(h float64) { if d.y+h > pdfH-pdfMargin { d.newPage() } }
+
+func pdfString(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\': b.WriteByte('\\'); b.WriteRune(r)
+		case r < 32 || r > 255: b.WriteByte('?')
+		case r > 126: fmt.Fprintf(&b, "\\%03o", r)
+		default: b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// text writes s with its baseline at y; bold picks Helvetica-Bold. gray is 0 (black) to 1 (white).
+func (d *pdfDoc) text(x, y, size float64, bold bool, gray float64, s string) {
+	font := "F1"
+	if bold { font = "F2" }
+	fmt.Fprintf(d.page, "BT %.3f g /%s %.1f Tf %.2f %.2f Td (%s) Tj ET\n", gray, font, size, x, pdfH-y, pdfString(s))
+}
+
+func (d *pdfDoc) line(x1, y1, x2, y2, gray float64) {
+	fmt.Fprintf(d.page, "%.3f G 0.5 w %.2f %.2f m %.2f %.2f l S\n", gray, x1, pdfH-y1, x2, pdfH-y2)
+}
+
+// image draws img scaled into w by h points with its top-left corner at x, y.
+func (d *pdfDoc) image(x, y, w, h float64, img *image.RGBA) {
+	fmt.Fprintf(d.page, "q %.2f 0 0 %.2f %.2f %.2f cm /Im%d Do Q\n", w, h, x, pdfH-y-h, len(d.images))
+	d.images = append(d.images, img)
+}
+
+func (d *pdfDoc) box(x, y, w, h, gray float64) {
+	fmt.Fprintf(d.page, "%.3f g %.2f %.2f %.2f %.2f re f\n", gray, x, pdfH-y-h, w, h)
+}
+
+// row writes one line of cells at the given x offsets and moves down.
+func (d *pdfDoc) row(xs []float64, cells []string, size float64, bold bool) {
+	d.need(size + 4)
+	d.y += size + 4
+	for i, c := range cells {
+		if i < len(xs) { d.text(xs[i], d.y, size, bold, 0, c) }
+	}
+}
+
+func (d *pdfDoc) WriteTo(w io.Writer) (int64, error) {
+	var out bytes.Buffer
+	var offsets []int
+	obj := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	// 1: catalog, 2: page tree, 3 and 4: fonts, then a page and its content per page, then the images.
+	kids := make([]string, len(d.pages))
+	for i := range d.pages { kids[i] = fmt.Sprintf("%d 0 R", 5+2*i) }
+	var xobj strings.Builder
+	for i := range d.images { fmt.Fprintf(&xobj, " /Im%d %d 0 R", i, 5+2*len(d.pages)+i) }
+	flate := func(b []byte) []byte {
+		var z bytes.Buffer
+		zw := zlib.NewWriter(&z)
+		zw.Write(b)
+		zw.Close()
+		return z.Bytes()
+	}
+	obj("<< /Type /Catalog /Pages 2 0 R >>")
+	obj(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+	obj("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	obj("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	for i, p := range d.pages {
+		obj(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> /XObject <<%s >> >> /Contents %d 0 R >>", pdfW, pdfH, xobj.String(), 6+2*i))
+		z := flate(p.Bytes())
+		obj(fmt.Sprintf("<< /Length %d /Filter /FlateDecode >>\nstream\n%s\nendstream", len(z), z))
+	}
+	for _, img := range d.images {
+		r := img.Bounds()
+		rgb := make([]byte, 0, r.Dx()*r.Dy()*3)
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ { c := img.RGBAAt(x, y); rgb = append(rgb, c.R, c.G, c.B) }
+		}
+		z := flate(rgb)
+		obj(fmt.Sprintf("<< /Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceRGB /BitsPerComponent 8 /Length %d /Filter /FlateDecode >>\nstream\n%s\nendstream", r.Dx(), r.Dy(), len(z), z))
+	}
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, o := range offsets { fmt.Fprintf(&out, "%010d 00000 n \n", o) }
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return out.WriteTo(w)
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// --- PERSISTENCE & SHUTDOWN ---
+// History is snapshotted every save_interval (a minute) to a temp file that is renamed over dbFile, so a crash
+// mid-write never leaves a truncated file. Between snapshots every sample is also appended to a
+// write-ahead log (dbFile.wal, JSON lines), which loadHistory replays. On SIGINT/SIGTERM the
+// collector stops, event streams close, listeners drain and a final snapshot is written. The recent
+// alert events are saved with each snapshot to alertsFile.
+
+var (
+	walF     *os.File
+	walMutex sync.Mutex
+
+	saveMutex sync.Mutex    // one snapshot at a time (the saver, shutdown, a purge)
+	saveBuf   []RichMetrics // reused for each snapshot
+
+	stopCtx, stopAll = context.WithCancel(context.Background())
+	collectorStopped = make(chan struct{})
+	shutdownOnce     sync.Once
+	shutdownDone     = make(chan struct{})
+
+	servers     []*http.Server
+	serverMutex sync.Mutex
+)
+
+var alertsFile = "pulse.alerts.json"
+
+func walPath() string { return dbFile + ".wal" }
+
+// appendWAL logs one sample; the process can die at any point after this without losing it.
+func appendWAL(m RichMetrics) {
+	if observeOnly { return }
+	walMutex.Lock(); defer walMutex.Unlock()
+	if walF == nil {
+		f, err := os.OpenFile(walPath(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil { storageLog.Error("cannot open write-ahead log", "err", err); return }
+		walF = f
+	}
+	b, _ := json.Marshal(m)
+	walF.Write(append(b, '\n'))
+}
+
+func closeWAL() { walMutex.Lock(); if walF != nil { walF.Close(); walF = nil }; walMutex.Unlock() }
+
+// saveHistory writes a snapshot atomically. The WAL is rotated to .wal.old first and only removed
+// once the snapshot that contains its samples has been renamed into place.
+func saveHistory() (err error) {
+	saveMutex.Lock(); defer saveMutex.Unlock()
+	defer func() { noteSave(err) }()
+	walMutex.Lock()
+	if walF != nil { walF.Close(); walF = nil }
+	// A .old left by a failed save is appended to rather than replaced.
+	if _, err := os.Stat(walPath() + ".old"); err == nil { appendFile(walPath(), walPath()+".old"); os.Remove(walPath()) } else { os.Rename(walPath(), walPath()+".old") }
+	historyMutex.RLock(); saveBuf = history.AppendRange(saveBuf[:0], 0, history.Len()); historyMutex.RUnlock()
+	walMutex.Unlock()
+	// Cleared after writing, so the copy doesn't keep dropped samples' process lists alive.
+	defer clear(saveBuf)
+
+	tmp := dbFile + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil { return err }
+	err = writeHistoryFile(f, saveBuf)
+	if err == nil { err = f.Sync() }
+	if cerr := f.Close(); err == nil { err = cerr }
+	if err == nil { err = os.Rename(tmp, dbFile) }
+	if err != nil { os.Remove(tmp); return fmt.Errorf("saving history: %w", err) }
+	os.Remove(walPath() + ".old")
+	return saveAlertLog()
+}
+
+// saveAlertLog keeps the recent alert events (at most maxAlertHistory) across restarts.
+func saveAlertLog() error {
+	alertLogMutex.RLock(); b, _ := json.Marshal(alertHistory); alertLogMutex.RUnlock()
+	tmp := alertsFile + ".tmp"
+	if err := os.WriteFile(tmp, b, 0600); err != nil { return fmt.Errorf("saving alert log: %w", err) }
+	return os.Rename(tmp, alertsFile)
+}
+
+func loadAlertLog() {
+	b, err := os.ReadFile(alertsFile)
+	if err != nil { return }
+	var list []AlertEvent
+	if err := json.Unmarshal(b, &list); err != nil { storageLog.Error("cannot read alert log", "file", alertsFile, "err", err); return }
+	alertLogMutex.Lock()
+	alertHistory = list
+	if len(list) > 0 { alertSeq = list[len(list)-1].ID }
+	alertLogMutex.Unlock()
+}
+
+// replayWAL appends samples newer than the snapshot and returns how many it read and how many lines were damaged.
+func replayWAL(path string) (n, bad int) {
+	f, err := os.Open(path)
+	if err != nil { return }
+	defer f.Close()
+	rd := bufio.NewReader(f)
+	for {
+		line, err := rd.ReadBytes('\n')
+		if len(line) > 0 {
+			var m RichMetrics
+			if json.Unmarshal(line, &m) != nil { bad++ } else if last, ok := history.Last(); !ok || m.Timestamp > last.Timestamp { history.Push(m); n++ }
+		}
+		if err != nil { break }
+	}
+	return
+}
+
+func loadHistory() {
+	if history.Cap() == 0 { history.Resize(historyCapacity()) }
+	h, version, err := readHistoryFile(dbFile)
+	var future futureSchemaError
+	switch {
+	case err == nil:
+		history.Load(h)
+		if version != historySchema { storageLog.Info("converting history to the current format", "file", dbFile, "from_schema", version, "to_schema", historySchema, "samples", len(h)) }
+	case os.IsNotExist(err):
+	case errors.As(err, &future):
+		// Moved rather than copied, so the next save cannot replace it; a newer Pulse can still read it.
+		aside := fmt.Sprintf("%s.v%d", dbFile, uint32(future))
+		storageLog.Error("history file is from a newer Pulse, moving it aside", "file", dbFile, "moved_to", aside, "err", err)
+		os.Rename(dbFile, aside)
+	default:
+		storageLog.Error("history file is damaged, keeping a copy", "file", dbFile, "copy", dbFile+".corrupt", "err", err)
+		copyFile(dbFile, dbFile+".corrupt")
+	}
+	n, bad := 0, 0
+	for _, p := range []string{walPath() + ".old", walPath()} { a, b := replayWAL(p); n += a; bad += b }
+	if n > 0 || bad > 0 { storageLog.Info("recovered samples from the write-ahead log", "samples", n, "damaged_lines", bad) }
+	loadAlertLog()
+	cut := time.Now().Unix() - retentionSeconds()
+	history.DropBefore(cut + 1)
+}
+
+const defaultRetention = 3 * 86400
+
+// retentionSeconds is how far back history goes: "retention" (or --retention), else 3 days.
+func retentionSeconds() int64 {
+	cfgMutex.RLock(); r := config.Retention; cfgMutex.RUnlock()
+	if secs, err := parseRetention(r); err == nil { return int64(secs) }
+	return defaultRetention
+}
+
+// useDataFile points dbFile (and its WAL) at data_file. A relative path is taken from the data
+// directory, or else from the config file's, never the working directory. It applies at start only.
+func useDataFile(c AppConfig) {
+	if c.DataFile == "" { return }
+	dbFile = c.DataFile
+	if !filepath.IsAbs(dbFile) {
+		base := dataDir
+		if base == "" { base = filepath.Dir(confFile) }
+		dbFile = filepath.Join(base, dbFile)
+	}
+}
+
+// purgeHistory drops every sample older than before and writes a snapshot without them.
+func purgeHistory(before int64) (removed, kept int, err error) {
+	historyMutex.Lock()
+	n := history.DropBefore(before)
+	kept = history.Len()
+	historyMutex.Unlock()
+	if n == 0 { return 0, kept, nil }
+	return n, kept, saveHistory()
+}
+
+func copyFile(src, dst string) error { return writeFrom(src, dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY) }
+
+func appendFile(src, dst string) error { return writeFrom(src, dst, os.O_CREATE|os.O_APPEND|os.O_WRONLY) }
+
+func writeFrom(src, dst string, flag int) error {
+	in, err := os.Open(src)
+	if err != nil { return err }
+	defer in.Close()
+	out, err := os.OpenFile(dst, flag, 0600)
+	if err != nil { return err }
+	defer out.Close()
+	_, err = io.Copy(out, in)
+	return err
+}
+
+func trackServer(s *http.Server) *http.Server {
+	serverMutex.Lock(); servers = append(servers, s); serverMutex.Unlock()
+	return s
+}
+
+// historySaver snapshots history every save_interval seconds (default 60) until shutdown.
+func historySaver() {
+	for {
+		cfgMutex.RLock(); secs := config.SaveInterval; cfgMutex.RUnlock()
+		if secs <= 0 { secs = 60 }
+		select {
+		case <-stopCtx.Done(): return
+		case <-time.After(time.Duration(secs) * time.Second):
+			if err := saveHistory(); err != nil { storageLog.Error("cannot save history", "err", err); continue }
+			if err := enforceQuota(); err != nil { storageLog.Error("cannot save history", "err", err) }
+		}
+	}
+}
+
+// shutdown stops collecting, drains the listeners and writes the final snapshot. Safe to call more than once.
+func shutdown() {
+	shutdownOnce.Do(func() {
+		slog.Info("shutting down")
+		stopAll()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second); defer cancel()
+		serverMutex.Lock()
+		for _, s := range servers { s.Shutdown(ctx) }
+		serverMutex.Unlock()
+		select { case <-collectorStopped: case <-ctx.Done(): }
+		flushForwarders(ctx)
+		if err := saveHistory(); err != nil { storageLog.Error("cannot save history", "err", err) } else { os.Remove(walPath()) }
+		closeWAL()
+		mqttClose()
+		close(shutdownDone)
+	})
+}
@@ -0,0 +1,28 @@
+//go:build !windows
+
+package main
+
+import (
+	"net/netip"
+
+	"github.com/shirou/gopsutil/v3/net"
+)
+
+// listeningPorts returns the listening sockets and, from the same table, established TCP connections.
+func listeningPorts() ([]PortInfo, []tcpConn, error) {
+	c, err := net.Connections("inet")
+	var res []PortInfo
+	var conns []tcpConn
+	for _, x := range c {
+		switch {
+		case x.Status == "LISTEN": res = append(res, PortInfo{Port: int(x.Laddr.Port), Proto: getProto(x.Type), PID: x.Pid, Addr: x.Laddr.IP})
+		// A bound UDP socket that isn't connected is listening.
+		case x.Type == 2 && x.Raddr.Port == 0: res = append(res, PortInfo{Port: int(x.Laddr.Port), Proto: "UDP", PID: x.Pid, Addr: x.Laddr.IP})
+		case x.Status == "ESTABLISHED" && x.Type == 1:
+			l, lerr := netip.ParseAddr(x.Laddr.IP)
+			r, rerr := netip.ParseAddr(x.Raddr.IP)
+			if lerr == nil && rerr == nil { conns = append(conns, tcpConn{netip.AddrPortFrom(l, uint16(x.Laddr.Port)), netip.AddrPortFrom(r, uint16(x.Raddr.Port))}) }
+		}
+	}
+	return res, conns, err
+}
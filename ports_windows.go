@@ -0,0 +1,111 @@
+//go:build windows
+
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// The IP Helper API returns listening TCP sockets and bound UDP ones with their owning pid in one
+// call per address family, without the rights gopsutil's per-connection lookups need; connected
+// TCP sockets come the same way.
+
+var (
+	modiphlpapi             = windows.NewLazySystemDLL("iphlpapi.dll")
+	procGetExtendedTcpTable = modiphlpapi.NewProc("GetExtendedTcpTable")
+	procGetExtendedUdpTable = modiphlpapi.NewProc("GetExtendedUdpTable")
+)
+
+const (
+	tcpTableOwnerPidListener = 3 // TCP_TABLE_OWNER_PID_LISTENER
+	tcpTableOwnerPidConns    = 4 // TCP_TABLE_OWNER_PID_CONNECTIONS
+	udpTableOwnerPid         = 1 // UDP_TABLE_OWNER_PID
+	mibTcpStateEstab         = 5
+)
+
+// ipTable describes one table: its rows' size and where the local port, pid and local address
+// (alen bytes) sit in them.
+type ipTable struct {
+	proc                        *windows.LazyProc
+	af, class                   uint32
+	proto                       string
+	row, port, pid, local, alen int
+}
+
+var ipTables = []ipTable{
+	{procGetExtendedTcpTable, windows.AF_INET, tcpTableOwnerPidListener, "TCP", 24, 8, 20, 4, 4},   // MIB_TCPROW_OWNER_PID
+	{procGetExtendedTcpTable, windows.AF_INET6, tcpTableOwnerPidListener, "TCP", 56, 20, 52, 0, 16}, // MIB_TCP6ROW_OWNER_PID
+	{procGetExtendedUdpTable, windows.AF_INET, udpTableOwnerPid, "UDP", 12, 4, 8, 0, 4},             // MIB_UDPROW_OWNER_PID
+	{procGetExtendedUdpTable, windows.AF_INET6, udpTableOwnerPid, "UDP", 28, 20, 24, 0, 16},         // MIB_UDP6ROW_OWNER_PID
+}
+
+// connTable adds where a connection row keeps its state and remote end.
+type connTable struct {
+	ipTable
+	state, remote, rport int
+}
+
+var connTables = []connTable{
+	{ipTable{procGetExtendedTcpTable, windows.AF_INET, tcpTableOwnerPidConns, "TCP", 24, 8, 20, 4, 4}, 0, 12, 16},
+	{ipTable{procGetExtendedTcpTable, windows.AF_INET6, tcpTableOwnerPidConns, "TCP", 56, 20, 52, 0, 16}, 48, 24, 44},
+}
+
+// listeningPorts returns the listening sockets and established TCP connections.
+func listeningPorts() ([]PortInfo, []tcpConn, error) {
+	ports, err := listeners()
+	if err != nil { return nil, nil, err }
+	var conns []tcpConn
+	for _, t := range connTables {
+		b, err := t.read()
+		if err != nil { continue }
+		n := int(binary.LittleEndian.Uint32(b))
+		for i := 0; i < n && 4+(i+1)*t.row <= len(b); i++ {
+			r := b[4+i*t.row:]
+			if binary.LittleEndian.Uint32(r[t.state:]) != mibTcpStateEstab { continue }
+			addr := func(off, port int) netip.AddrPort {
+				a, _ := netip.AddrFromSlice(r[off : off+t.alen])
+				return netip.AddrPortFrom(a, uint16(r[port])<<8|uint16(r[port+1]))
+			}
+			conns = append(conns, tcpConn{addr(t.local, t.port), addr(t.remote, t.rport)})
+		}
+	}
+	return ports, conns, nil
+}
+
+func listeners() ([]PortInfo, error) {
+	var res []PortInfo
+	var errs []error
+	for _, t := range ipTables {
+		b, err := t.read()
+		if err != nil { errs = append(errs, err); continue }
+		n := int(binary.LittleEndian.Uint32(b))
+		for i := 0; i < n && 4+(i+1)*t.row <= len(b); i++ {
+			r := b[4+i*t.row:]
+			// The port is in network byte order in the low word.
+			a, _ := netip.AddrFromSlice(r[t.local : t.local+t.alen])
+			res = append(res, PortInfo{Port: int(r[t.port])<<8 | int(r[t.port+1]), Proto: t.proto, PID: int32(binary.LittleEndian.Uint32(r[t.pid:])), Addr: a.String()})
+		}
+	}
+	if len(errs) == len(ipTables) { return nil, errs[0] }
+	return res, nil
+}
+
+// read fetches the table, growing the buffer while sockets come and go between the calls.
+func (t ipTable) read() ([]byte, error) {
+	size := uint32(16 << 10)
+	for range 5 {
+		b := make([]byte, size)
+		r, _, _ := t.proc.Call(uintptr(unsafe.Pointer(&b[0])), uintptr(unsafe.Pointer(&size)), 0, uintptr(t.af), uintptr(t.class), 0)
+		switch windows.Errno(r) {
+		case 0: return b, nil
+		case windows.ERROR_INSUFFICIENT_BUFFER:
+		default: return nil, fmt.Errorf("%s: %w", t.proc.Name, windows.Errno(r))
+		}
+	}
+	return nil, fmt.Errorf("%s: table keeps growing", t.proc.Name)
+}
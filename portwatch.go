@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// --- PORT WATCH ---
+// Every process scan compares the listening ports with the previous scan and records each port that
+// opened or closed, kept in pulse.ports.json with the ports seen so far. With expected_ports (an
+// allow-list such as ["22", "tcp/443", "udp/53", "tcp/30000-32767"]) a port listening beyond
+// loopback that isn't on it raises "Unexpected Port", and a listed single port nobody listens on
+// raises "Port <port> Missing". Without the list, a port never seen before that opens beyond
+// loopback raises "New Port" for ten minutes.
+
+type PortEvent struct {
+	Time  int64  `json:"time"`
+	Kind  string `json:"kind"` // opened or closed
+	Proto string `json:"proto"`
+	Port  int    `json:"port"`
+	Addr  string `json:"addr,omitempty"` // the bound addresses, comma separated
+	PID   int32  `json:"pid,omitempty"`
+	Name  string `json:"name,omitempty"`
+	New   bool   `json:"new,omitempty"` // never seen listening before
+}
+
+const (
+	maxPortEvents = 500
+	newPortFor    = 10 * time.Minute
+)
+
+var portsFile = "pulse.ports.json"
+
+var (
+	portMutex sync.Mutex
+	portData  struct {
+		Known     map[string]int64 `json:"known"`     // "tcp/22" -> first seen
+		Listening []string         `json:"listening"` // as of the last scan
+		Events    []PortEvent      `json:"events"`    // oldest first
+	}
+	portLoaded bool
+	portsSeen  atomic.Bool // a scan has run, so missing ports are really missing
+)
+
+func loadPortData() {
+	if portLoaded { return }
+	portLoaded = true
+	if b, err := os.ReadFile(portsFile); err == nil {
+		if err := json.Unmarshal(b, &portData); err != nil { storageLog.Error("cannot read port history", "file", portsFile, "err", err) }
+	}
+	if portData.Known == nil { portData.Known = map[string]int64{} }
+}
+
+func portKey(proto string, port int) string { return strings.ToLower(proto) + "/" + strconv.Itoa(port) }
+
+// exposed tells whether a socket bound to addr can be reached from other hosts.
+func exposed(addr string) bool {
+	a, err := netip.ParseAddr(addr)
+	return err != nil || !a.IsLoopback()
+}
+
+// portRange is one expected_ports entry: "22" (TCP or UDP), "tcp/443" or "udp/60000-61000".
+type portRange struct {
+	proto  string // empty for either
+	lo, hi int
+}
+
+func parsePortRange(s string) (portRange, error) {
+	var r portRange
+	s = strings.ToLower(strings.TrimSpace(s))
+	if p, rest, ok := strings.Cut(s, "/"); ok {
+		if p != "tcp" && p != "udp" { return r, fmt.Errorf("%q: the protocol must be tcp or udp", s) }
+		r.proto, s = p, rest
+	}
+	lo, hi, isRange := strings.Cut(s, "-")
+	var err1, err2 error
+	r.lo, err1 = strconv.Atoi(lo)
+	r.hi, err2 = r.lo, nil
+	if isRange { r.hi, err2 = strconv.Atoi(hi) }
+	if err1 != nil || err2 != nil || r.lo < 1 || r.hi > 65535 || r.lo > r.hi { return r, fmt.Errorf("%q is not a port, proto/port or proto/from-to", s) }
+	return r, nil
+}
+
+func (r portRange) has(proto string, port int) bool {
+	return (r.proto == "" || r.proto == strings.ToLower(proto)) && port >= r.lo && port <= r.hi
+}
+
+// watchPorts records what opened and closed since the previous scan and marks the ports that
+// expected_ports doesn't cover.
+func watchPorts(ports []PortInfo) {
+	cfgMutex.RLock(); expected := config.ExpectedPorts; cfgMutex.RUnlock()
+	var ranges []portRange
+	for _, s := range expected { if r, err := parsePortRange(s); err == nil { ranges = append(ranges, r) } }
+	now := time.Now().Unix()
+	cur := map[string]*PortEvent{}
+	var keys []string
+	for i := range ports {
+		p := &ports[i]
+		if len(ranges) > 0 && exposed(p.Addr) && !slices.ContainsFunc(ranges, func(r portRange) bool { return r.has(p.Proto, p.Port) }) { p.Unexpected = true }
+		k := portKey(p.Proto, p.Port)
+		if e, ok := cur[k]; ok { if !strings.Contains(","+e.Addr+",", ","+p.Addr+",") { e.Addr += "," + p.Addr }; continue }
+		cur[k] = &PortEvent{Time: now, Kind: "opened", Proto: p.Proto, Port: p.Port, Addr: p.Addr, PID: p.PID, Name: p.Name}
+		keys = append(keys, k)
+	}
+	portMutex.Lock(); defer portMutex.Unlock()
+	loadPortData()
+	learning, dirty := len(portData.Known) == 0, false
+	event := func(e PortEvent) {
+		dirty = true
+		if learning { return }
+		portData.Events = append(portData.Events, e)
+		if len(portData.Events) > maxPortEvents { portData.Events = portData.Events[len(portData.Events)-maxPortEvents:] }
+		collectorLog.Info("port "+e.Kind, "proto", e.Proto, "port", e.Port, "addr", e.Addr, "pid", e.PID, "name", e.Name)
+	}
+	for _, k := range keys {
+		if slices.Contains(portData.Listening, k) { continue }
+		e := cur[k]
+		if _, ok := portData.Known[k]; !ok { portData.Known[k] = now; e.New = true }
+		event(*e)
+	}
+	for _, k := range portData.Listening {
+		if cur[k] != nil { continue }
+		proto, port, _ := strings.Cut(k, "/")
+		n, _ := strconv.Atoi(port)
+		event(PortEvent{Time: now, Kind: "closed", Proto: strings.ToUpper(proto), Port: n})
+	}
+	portData.Listening = keys
+	portsSeen.Store(true)
+	if !dirty || observeOnly { return }
+	b, _ := json.MarshalIndent(portData, "", "  ")
+	tmp := portsFile + ".tmp"
+	err := os.WriteFile(tmp, b, 0600)
+	if err == nil { err = os.Rename(tmp, portsFile) }
+	if err != nil { storageLog.Error("cannot save port history", "file", portsFile, "err", err) }
+}
+
+// checkPorts raises "Unexpected Port" and "Port <port> Missing" against expected_ports, or "New Port"
+// without it.
+func checkPorts(cfg AppConfig, m RichMetrics, alert func(n, lvl string, v float64, msg string)) {
+	if len(cfg.ExpectedPorts) == 0 {
+		portMutex.Lock(); defer portMutex.Unlock()
+		loadPortData()
+		since := m.Timestamp - int64(newPortFor/time.Second)
+		var news []string
+		for _, e := range portData.Events {
+			if e.Time > since && e.Kind == "opened" && e.New && e.Addr != "" && slices.ContainsFunc(strings.Split(e.Addr, ","), exposed) { news = append(news, describePort(e.Proto, e.Port, e.Addr, e.Name)) }
+		}
+		if len(news) > 0 { alert("New Port", "WARNING", float64(len(news)), "now listening: "+strings.Join(news, ", ")) }
+		return
+	}
+	var unexpected []string
+	for _, p := range m.OpenPorts { if p.Unexpected { unexpected = append(unexpected, describePort(p.Proto, p.Port, p.Addr, p.Name)) } }
+	if len(unexpected) > 0 { alert("Unexpected Port", "WARNING", float64(len(unexpected)), "not in expected_ports: "+strings.Join(unexpected, ", ")) }
+	for _, s := range cfg.ExpectedPorts {
+		if !portsSeen.Load() { break }
+		r, err := parsePortRange(s)
+		if err != nil || r.lo != r.hi { continue }
+		if !slices.ContainsFunc(m.OpenPorts, func(p PortInfo) bool { return r.has(p.Proto, p.Port) }) { alert("Port "+s+" Missing", "CRITICAL", 0, "nothing is listening on "+s) }
+	}
+}
+
+func describePort(proto string, port int, addr, name string) string {
+	s := strings.ToLower(proto) + "/" + strconv.Itoa(port)
+	if addr != "" { s += " on " + addr }
+	if name != "" { s += " (" + name + ")" }
+	return s
+}
+
+func validateExpectedPorts(c AppConfig, bad func(field, format string, a ...interface{})) {
+	for _, s := range c.ExpectedPorts { if _, err := parsePortRange(s); err != nil { bad("expected_ports", "%v", err) } }
+}
+
+// handlePortEvents is GET /api/v1/ports/events: opened and closed ports, newest first.
+func handlePortEvents(w http.ResponseWriter, r *http.Request) {
+	limit, offset, ok := pageParams(w, r)
+	if !ok { return }
+	q := r.URL.Query()
+	start, ok1 := parseTimeParam(q.Get("start"), 0)
+	end, ok2 := parseTimeParam(q.Get("end"), 1<<62)
+	if !ok1 || !ok2 { apiFail(w, http.StatusBadRequest, apiError{"bad_request", "start and end must be unix seconds or RFC 3339", nil}); return }
+	kind := q.Get("kind")
+	if kind != "" && kind != "opened" && kind != "closed" { apiFail(w, http.StatusBadRequest, apiError{"bad_request", "kind must be opened or closed", nil}); return }
+	list := []PortEvent{}
+	portMutex.Lock()
+	loadPortData()
+	for i := len(portData.Events) - 1; i >= 0; i-- {
+		if e := portData.Events[i]; e.Time >= start && e.Time <= end && (kind == "" || e.Kind == kind) { list = append(list, e) }
+	}
+	portMutex.Unlock()
+	lo, hi, meta := pageBounds(len(list), limit, offset)
+	apiOK(w, 200, list[lo:hi], meta)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"sync"
+)
+
+// --- USER PREFERENCES ---
+// Each user's dashboard settings (theme, default time range, visible panels, chart colors) live
+// in pulse.conf.prefs, so they follow the user from browser to browser. default_preferences in
+// pulse.conf is what users start with; an admin can also set anyone's via /api/v1/preferences/{user}.
+// Without logins everybody shares the "anonymous" entry.
+
+type Preferences struct {
+	Theme  string            `json:"theme,omitempty"`  // dark (default) or light
+	Range  int               `json:"range,omitempty"`  // seconds shown in live mode
+	Panels []string          `json:"panels,omitempty"` // panel ids to show, out of the layout; empty = all
+	Colors map[string]string `json:"colors,omitempty"` // series key -> CSS color
+}
+
+var prefColorKeys = map[string]bool{"cpu": true, "mem": true, "rx": true, "tx": true, "read": true, "write": true, "plugin": true, "forecast": true}
+
+var cssColor = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+var (
+	userPrefs  map[string]Preferences
+	prefsMutex sync.Mutex
+)
+
+func prefsFile() string { return confFile + ".prefs" }
+
+func (p Preferences) validate(bad func(field, format string, a ...interface{})) {
+	if p.Theme != "" && p.Theme != "dark" && p.Theme != "light" { bad("theme", "must be dark or light") }
+	if p.Range != 0 && (p.Range < 60 || p.Range > 31*86400) { bad("range", "must be between 60 and 2678400 seconds") }
+	for k, v := range p.Colors {
+		if !prefColorKeys[k] { bad("colors", "unknown series %q (cpu, mem, rx, tx, read, write, plugin, forecast)", k) }
+		if !cssColor.MatchString(v) { bad("colors", "%s: %q is not a #rrggbb color", k, v) }
+	}
+}
+
+// merged fills in whatever p leaves empty from def.
+func (p Preferences) merged(def Preferences) Preferences {
+	if p.Theme == "" { p.Theme = def.Theme }
+	if p.Range == 0 { p.Range = def.Range }
+	if p.Panels == nil { p.Panels = def.Panels }
+	c := map[string]string{}
+	for k, v := range def.Colors { c[k] = v }
+	for k, v := range p.Colors { c[k] = v }
+	p.Colors = c
+	return p
+}
+
+func loadPrefs() {
+	if userPrefs != nil { return }
+	userPrefs = map[string]Preferences{}
+	if b, err := os.ReadFile(prefsFile()); err == nil {
+		if err := json.Unmarshal(b, &userPrefs); err != nil { storageLog.Error("cannot read preferences", "file", prefsFile(), "err", err) }
+	}
+}
+
+// setPrefs stores (or, with nil, removes) one user's preferences and rewrites the file.
+func setPrefs(user string, p *Preferences) error {
+	prefsMutex.Lock(); defer prefsMutex.Unlock()
+	loadPrefs()
+	if p == nil { delete(userPrefs, user) } else { userPrefs[user] = *p }
+	b, _ := json.MarshalIndent(userPrefs, "", "  ")
+	tmp := prefsFile() + ".tmp"
+	if err := os.WriteFile(tmp, b, 0600); err != nil { return err }
+	return os.Rename(tmp, prefsFile())
+}
+
+func userPreferences(user string) Preferences {
+	cfgMutex.RLock(); def := config.DefaultPreferences; cfgMutex.RUnlock()
+	prefsMutex.Lock(); loadPrefs(); p := userPrefs[user]; prefsMutex.Unlock()
+	return p.merged(def)
+}
+
+func readPrefs(w http.ResponseWriter, r *http.Request) (Preferences, bool) {
+	var p Preferences
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&p); err != nil { apiFail(w, http.StatusBadRequest, apiError{"bad_request", "invalid preferences: " + err.Error(), nil}); return p, false }
+	var errs []fieldError
+	p.validate(func(field, format string, a ...interface{}) { errs = append(errs, fieldError{field, fmt.Sprintf(format, a...)}) })
+	if len(errs) > 0 { apiFail(w, http.StatusUnprocessableEntity, apiError{"invalid_config", "the preferences were not changed", errs}); return p, false }
+	return p, true
+}
+
+func registerPrefsAPI(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/v1/preferences", func(w http.ResponseWriter, r *http.Request) { apiOK(w, 200, userPreferences(actor(r)), nil) })
+	mux.HandleFunc("PUT /api/v1/preferences", func(w http.ResponseWriter, r *http.Request) {
+		p, ok := readPrefs(w, r)
+		if !ok { return }
+		if err := setPrefs(actor(r), &p); err != nil { storageLog.Error("cannot save preferences", "err", err); apiFail(w, http.StatusInternalServerError, apiError{"internal", err.Error(), nil}); return }
+		apiOK(w, 200, userPreferences(actor(r)), nil)
+	})
+	mux.HandleFunc("GET /api/v1/preferences/{user}", apiRole("admin", func(w http.ResponseWriter, r *http.Request) {
+		apiOK(w, 200, userPreferences(r.PathValue("user")), nil)
+	}))
+	mux.HandleFunc("PUT /api/v1/preferences/{user}", apiRole("admin", func(w http.ResponseWriter, r *http.Request) {
+		p, ok := readPrefs(w, r)
+		if !ok { return }
+		if err := setPrefs(r.PathValue("user"), &p); err != nil { apiFail(w, http.StatusInternalServerError, apiError{"internal", err.Error(), nil}); return }
+		auditLog("preferences_set", map[string]interface{}{"user": actor(r), "for": r.PathValue("user")})
+		apiOK(w, 200, userPreferences(r.PathValue("user")), nil)
+	}))
+	mux.HandleFunc("DELETE /api/v1/preferences/{user}", apiRole("admin", func(w http.ResponseWriter, r *http.Request) {
+		if err := setPrefs(r.PathValue("user"), nil); err != nil { apiFail(w, http.StatusInternalServerError, apiError{"internal", err.Error(), nil}); return }
+		auditLog("preferences_reset", map[string]interface{}{"user": actor(r), "for": r.PathValue("user")})
+		apiOK(w, 200, userPreferences(r.PathValue("user")), nil)
+	}))
+}
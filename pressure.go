@@ -0,0 +1,16 @@
+package main
+
+import "sync/atomic"
+
+// --- CPU FREQUENCY, THROTTLING & PRESSURE ---
+// "The box feels slow but CPU% looks fine" is often a CPU clocked down or tasks stalled waiting.
+// Each sample carries, on Linux, pressure stall information from /proc/pressure: the share of
+// the time since the previous sample in which some task (or, for "full", every non-idle task)
+// was stalled on CPU, IO or memory; the current clock of every core; and how many thermal or
+// power-limit throttling events the cores and packages counted meanwhile. The Pressure and CPU
+// Frequency panels join the default layout where the kernel provides them.
+
+var (
+	hasPressure atomic.Bool
+	hasCPUFreq  atomic.Bool
+)
@@ -0,0 +1,95 @@
+//go:build linux
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	psiPrev   map[string]uint64
+	psiPrevAt time.Time
+
+	throttlePrev  uint64
+	throttleKnown bool
+)
+
+// collectPressure turns the stall totals (microseconds) into percent of the time since the
+// previous sample; the first sample uses the kernel's 10s average.
+func collectPressure(m *RichMetrics) {
+	now := time.Now()
+	cur, avg10 := map[string]uint64{}, map[string]float64{}
+	for _, res := range []string{"cpu", "io", "memory"} {
+		b, err := os.ReadFile("/proc/pressure/" + res)
+		if err != nil { noteCap("pressure", collectorCap{Note: "pressure stall information needs Linux 4.20 or later with PSI on (psi=1 on the kernel command line)"}); return }
+		// "some avg10=0.00 avg60=0.00 avg300=0.00 total=12345", then the same for "full"
+		for _, line := range strings.Split(string(b), "\n") {
+			f := strings.Fields(line)
+			if len(f) < 5 { continue }
+			k := res + " " + f[0]
+			for _, kv := range f[1:] {
+				if v, ok := strings.CutPrefix(kv, "avg10="); ok { avg10[k], _ = strconv.ParseFloat(v, 64) }
+				if v, ok := strings.CutPrefix(kv, "total="); ok { cur[k], _ = strconv.ParseUint(v, 10, 64) }
+			}
+		}
+	}
+	secs := now.Sub(psiPrevAt).Seconds()
+	pct := func(k string) float64 {
+		pv, ok := psiPrev[k]
+		if !ok || secs <= 0 || cur[k] < pv { return avg10[k] }
+		return min(float64(cur[k]-pv)/1e4/secs, 100)
+	}
+	m.PSICPU, m.PSIIO, m.PSIIOFull, m.PSIMem, m.PSIMemFull = pct("cpu some"), pct("io some"), pct("io full"), pct("memory some"), pct("memory full")
+	psiPrev, psiPrevAt = cur, now
+	hasPressure.Store(true)
+	noteCap("pressure", collectorCap{OK: true})
+}
+
+func readSysUint(path string) (uint64, bool) {
+	b, err := os.ReadFile(path)
+	if err != nil { return 0, false }
+	v, err := strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64)
+	return v, err == nil
+}
+
+// collectCPUFreq reads each core's clock from cpufreq, or from /proc/cpuinfo where there is no
+// cpufreq driver (most VMs), and the throttling counters Intel's thermal driver keeps per core
+// and per package (which every core of the package repeats).
+func collectCPUFreq(m *RichMetrics) {
+	dirs, _ := filepath.Glob("/sys/devices/system/cpu/cpu[0-9]*")
+	num := func(d string) int { n, _ := strconv.Atoi(strings.TrimPrefix(filepath.Base(d), "cpu")); return n }
+	sort.Slice(dirs, func(i, j int) bool { return num(dirs[i]) < num(dirs[j]) })
+	var mhz []float64
+	var throttles uint64
+	counters, packages := false, map[string]bool{}
+	for _, d := range dirs {
+		if khz, ok := readSysUint(d + "/cpufreq/scaling_cur_freq"); ok { mhz = append(mhz, float64(khz)/1000) }
+		t := d + "/thermal_throttle/"
+		for _, f := range []string{"core_throttle_count", "core_power_limit_count"} { if n, ok := readSysUint(t + f); ok { throttles += n; counters = true } }
+		pkg, _ := os.ReadFile(d + "/topology/physical_package_id")
+		if packages[string(pkg)] { continue }
+		packages[string(pkg)] = true
+		for _, f := range []string{"package_throttle_count", "package_power_limit_count"} { if n, ok := readSysUint(t + f); ok { throttles += n } }
+	}
+	if len(mhz) == 0 {
+		b, _ := os.ReadFile("/proc/cpuinfo")
+		for _, line := range strings.Split(string(b), "\n") {
+			k, v, _ := strings.Cut(line, ":")
+			if strings.TrimSpace(k) == "cpu MHz" { if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil { mhz = append(mhz, f) } }
+		}
+	}
+	if counters {
+		if throttleKnown && throttles >= throttlePrev { m.Throttles = throttles - throttlePrev }
+		throttlePrev, throttleKnown = throttles, true
+	}
+	if len(mhz) == 0 { noteCap("cpu_freq", collectorCap{Note: "the CPU clock can't be read here (no cpufreq driver and no cpu MHz in /proc/cpuinfo)"}); return }
+	m.CoreMHz = mhz
+	for _, f := range mhz { m.CPUMHz += f / float64(len(mhz)) }
+	hasCPUFreq.Store(true)
+	if counters { noteCap("cpu_freq", collectorCap{OK: true}) } else { noteCap("cpu_freq", collectorCap{OK: true, Partial: true, Note: "throttling isn't counted here (the counters come from Intel's thermal driver)"}) }
+}
@@ -0,0 +1,7 @@
+//go:build !linux
+
+package main
+
+func collectPressure(m *RichMetrics) { noteCap("pressure", collectorCap{Note: "pressure stall information is only available on Linux"}) }
+
+func collectCPUFreq(m *RichMetrics) { noteCap("cpu_freq", collectorCap{Note: "per-core clocks and throttling are only read on Linux"}) }
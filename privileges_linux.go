@@ -0,0 +1,115 @@
+//go:build linux
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"os/signal"
+	"os/user"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// --- PRIVILEGE DROP ---
+// Started as root with --run-as <user>, Pulse re-executes itself as that user with only the
+// capabilities collection needs: CAP_SYS_PTRACE and CAP_DAC_READ_SEARCH to read other users'
+// /proc/<pid>/io and the sockets behind their ports, CAP_NET_BIND_SERVICE for ports below 1024,
+// CAP_SYSLOG for the OOM killer's reports in the kernel log, and CAP_BPF and CAP_PERFMON when
+// "ebpf" collectors are configured.
+// The root parent only forwards signals and exits with the child. Run unprivileged, Pulse keeps
+// going and says in /status (capabilities) what it can't see.
+
+const privDroppedEnv = "PULSE_PRIVILEGES_DROPPED"
+
+var keptCaps = []uintptr{unix.CAP_SYS_PTRACE, unix.CAP_DAC_READ_SEARCH, unix.CAP_NET_BIND_SERVICE, unix.CAP_SYSLOG}
+
+var capNames = map[int]string{unix.CAP_BPF: "cap_bpf", unix.CAP_DAC_READ_SEARCH: "cap_dac_read_search", unix.CAP_NET_BIND_SERVICE: "cap_net_bind_service", unix.CAP_PERFMON: "cap_perfmon", unix.CAP_SYS_PTRACE: "cap_sys_ptrace", unix.CAP_SYSLOG: "cap_syslog"}
+
+// dropPrivileges runs Pulse again as name and, in the parent, doesn't return unless that fails.
+func dropPrivileges(name string) error {
+	if os.Getenv(privDroppedEnv) != "" { return nil }
+	u, err := user.Lookup(name)
+	if err != nil { return fmt.Errorf("--run-as: %w", err) }
+	uid, _ := strconv.Atoi(u.Uid)
+	gid, _ := strconv.Atoi(u.Gid)
+	if os.Geteuid() == uid { return nil }
+	if os.Geteuid() != 0 { return fmt.Errorf("--run-as %s needs Pulse to be started as root", name) }
+	var groups []uint32
+	if ids, err := u.GroupIds(); err == nil {
+		for _, g := range ids { if n, err := strconv.Atoi(g); err == nil { groups = append(groups, uint32(n)) } }
+	}
+	if err := chownDataDir(uid, gid); err != nil { return fmt.Errorf("--run-as: giving %s the data directory: %w", name, err) }
+	exe, err := os.Executable()
+	if err != nil { return err }
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.Env = append(os.Environ(), privDroppedEnv+"=1")
+	caps := keptCaps
+	if c, _, _, err := readConfig(); err == nil && len(c.EBPF) > 0 { caps = append(slices.Clone(keptCaps), unix.CAP_BPF, unix.CAP_PERFMON) }
+	cmd.SysProcAttr = &syscall.SysProcAttr{Credential: &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid), Groups: groups}, AmbientCaps: caps, Pdeathsig: syscall.SIGKILL}
+	if err := cmd.Start(); err != nil { return fmt.Errorf("--run-as: %w", err) }
+	sig := make(chan os.Signal, 4)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	go func() { for s := range sig { cmd.Process.Signal(s) } }()
+	err = cmd.Wait()
+	var exit *exec.ExitError
+	if errors.As(err, &exit) { os.Exit(max(exit.ExitCode(), 1)) }
+	if err != nil { fmt.Fprintln(os.Stderr, "Error:", err); os.Exit(1) }
+	os.Exit(0)
+	return nil
+}
+
+// chownDataDir hands the data directory and what's in it to the user Pulse will run as.
+func chownDataDir(uid, gid int) error {
+	if dataDir == "" { return nil }
+	dir, err := filepath.Abs(dataDir)
+	if err != nil { return err }
+	if dir == "/" { return fmt.Errorf("refusing to chown /") }
+	return filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil { return err }
+		return os.Lchown(p, uid, gid)
+	})
+}
+
+// effectiveCaps lists the capabilities in this process's effective set.
+func effectiveCaps() []string {
+	b, _ := os.ReadFile("/proc/self/status")
+	for _, line := range strings.Split(string(b), "\n") {
+		v, ok := strings.CutPrefix(line, "CapEff:")
+		if !ok { continue }
+		mask, _ := strconv.ParseUint(strings.TrimSpace(v), 16, 64)
+		var out []string
+		for bit, name := range capNames { if mask&(1<<bit) != 0 { out = append(out, name) } }
+		return out
+	}
+	return nil
+}
+
+// privileged reports whether Pulse can see other users' processes.
+func privileged() bool {
+	if os.Geteuid() == 0 { return true }
+	for _, c := range effectiveCaps() { if c == "cap_sys_ptrace" { return true } }
+	return false
+}
+
+func notePrivileges() {
+	who := strconv.Itoa(os.Geteuid())
+	if u, err := user.LookupId(who); err == nil { who = u.Username }
+	caps := effectiveCaps()
+	sort.Strings(caps)
+	switch {
+	case os.Geteuid() == 0: noteCap("privileges", collectorCap{OK: true, Note: "running as root; --run-as <user> keeps only what collection needs"})
+	case privileged(): noteCap("privileges", collectorCap{OK: true, Note: "running as " + who + " with " + strings.Join(caps, ", ")})
+	default: noteCap("privileges", collectorCap{Note: "running as " + who + " without root: other users' process IO and port owners can't be seen; start Pulse as root with --run-as " + who})
+	}
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package main
+
+import "fmt"
+
+func dropPrivileges(name string) error { return fmt.Errorf("--run-as is only supported on Linux") }
+
+// privileged is not checked here; the collectors' own capability notes say what they couldn't read.
+func privileged() bool { return true }
+
+func notePrivileges() {}
@@ -0,0 +1,65 @@
+package main
+
+import "net/http"
+
+// --- PROCESS HISTORY ---
+// A process's history is found by its key rather than its pid, so a restarted postgres continues
+// the same series. The key is the name; for the names in process_key_cmdline (interpreters such as
+// java or python, where the name says little) it is name#hash of the command line. Processes
+// sharing a key are summed, and the pids seen under it are listed with when each came and went.
+
+type procPoint struct {
+	Timestamp int64   `json:"ts"`
+	Procs     int     `json:"procs"`
+	CPU       float64 `json:"cpu"`
+	Mem       float64 `json:"mem"`
+	DiskRead  uint64  `json:"d_read"`
+	DiskWrite uint64  `json:"d_write"`
+}
+
+type procSpan struct {
+	PID   int32 `json:"pid"`
+	First int64 `json:"first"`
+	Last  int64 `json:"last"`
+}
+
+type procHistory struct {
+	Key     string      `json:"key"`
+	Samples []procPoint `json:"samples"`
+	PIDs    []procSpan  `json:"pids"` // in the order they appeared
+}
+
+func processKey(p ProcessInfo) string {
+	if p.Key != "" { return p.Key }
+	return p.Name
+}
+
+// handleProcessHistory is GET /api/v1/processes/history?key=; the samples are paged, the pids not.
+func handleProcessHistory(w http.ResponseWriter, r *http.Request) {
+	limit, offset, ok := pageParams(w, r)
+	if !ok { return }
+	q := r.URL.Query()
+	key := q.Get("key")
+	if key == "" { apiFail(w, http.StatusBadRequest, apiError{"bad_request", "key is required (a process name, or name#hash from the key field)", nil}); return }
+	start, ok1 := parseTimeParam(q.Get("start"), 0)
+	end, ok2 := parseTimeParam(q.Get("end"), 1<<62)
+	if !ok1 || !ok2 { apiFail(w, http.StatusBadRequest, apiError{"bad_request", "start and end must be unix seconds or RFC 3339", nil}); return }
+	h := procHistory{Key: key, Samples: []procPoint{}, PIDs: []procSpan{}}
+	spans := map[int32]int{}
+	historyMutex.RLock()
+	for i := history.Search(start); i < history.Len() && history.At(i).Timestamp <= end; i++ {
+		m := history.At(i)
+		pt := procPoint{Timestamp: m.Timestamp}
+		for _, p := range m.ProcessList {
+			if processKey(p) != key { continue }
+			pt.Procs++; pt.CPU += p.CPU; pt.Mem += p.Mem; pt.DiskRead += p.DiskRead; pt.DiskWrite += p.DiskWrite
+			if j, ok := spans[p.PID]; ok { h.PIDs[j].Last = m.Timestamp } else { spans[p.PID] = len(h.PIDs); h.PIDs = append(h.PIDs, procSpan{p.PID, m.Timestamp, m.Timestamp}) }
+		}
+		if pt.Procs > 0 { h.Samples = append(h.Samples, pt) }
+	}
+	historyMutex.RUnlock()
+	if len(h.Samples) == 0 { apiFail(w, http.StatusNotFound, apiError{"not_found", "no samples of " + key, nil}); return }
+	lo, hi, meta := pageBounds(len(h.Samples), limit, offset)
+	h.Samples = h.Samples[lo:hi]
+	apiOK(w, 200, h, meta)
+}
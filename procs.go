@@ -0,0 +1,130 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"runtime"
+	"slices"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// --- PROCESS COLLECTION ---
+// A pass lists every process with only what ranking needs (CPU time, RSS, name), cheaply: on Linux
+// one read of /proc/<pid>/stat each, elsewhere through gopsutil. CPU % is the CPU time used since
+// the previous pass over the time between them (100 = one core), kept per pid and start time so a
+// reused pid starts over. Only the process_limit busiest (CPU, then memory) then get the costlier
+// reads: IO counters and, where the short name was cut off, the command line. The last pass's
+// duration is reported in /api/v1/status. Each process's group (groups.go) is looked up once, when
+// it is first seen. Its history follows its key (prochistory.go) rather than its pid.
+
+// procRaw is what the cheap listing returns for one process.
+type procRaw struct {
+	pid   int32
+	start uint64  // start time in the platform's units, identifies the process along with pid
+	cpu   float64 // CPU seconds used so far
+	rss   uint64
+	name  string
+}
+
+type procState struct {
+	start         uint64
+	cpu           float64
+	read, written uint64
+	io            bool // read and written are set
+	group, kind   string
+	cmdHash       string // of the command line, once a process_key_cmdline name needed it
+}
+
+const defaultProcessLimit = 500
+
+var (
+	procPrev   map[int32]procState
+	procPrevAt time.Time
+
+	procScanNanos atomic.Int64
+	procScanCount atomic.Int64
+)
+
+func getProcessStats() ([]ProcessInfo, []ProcessGroup) {
+	began := time.Now()
+	raws, err := listProcesses(); collectErr("processes", err)
+	cfgMutex.RLock(); limit := config.ProcessLimit; byCmd := config.ProcessKeyCmdline; cfgMutex.RUnlock()
+	if limit <= 0 { limit = defaultProcessLimit }
+	procIOMutex.Lock(); defer procIOMutex.Unlock()
+	now := time.Now()
+	secs := now.Sub(procPrevAt).Seconds()
+	next := make(map[int32]procState, len(raws))
+	all := make([]ProcessInfo, 0, len(raws))
+	kinds := map[string]string{}
+	for _, r := range raws {
+		st := procState{start: r.start, cpu: r.cpu}
+		pct := 0.0
+		if pv, ok := procPrev[r.pid]; ok && pv.start == r.start {
+			if secs > 0 && r.cpu >= pv.cpu { pct = (r.cpu - pv.cpu) / secs * 100 }
+			st.read, st.written, st.io, st.group, st.kind, st.cmdHash = pv.read, pv.written, pv.io, pv.group, pv.kind, pv.cmdHash
+		} else {
+			st.group, st.kind = processGroup(r.pid, r.name)
+		}
+		next[r.pid] = st
+		kinds[st.group] = st.kind
+		all = append(all, ProcessInfo{PID: r.pid, Name: r.name, Group: st.group, CPU: pct, Mem: float64(r.rss)})
+	}
+	sort.Slice(all, func(i, j int) bool { return (all[i].CPU + all[i].Mem/1024/1024) > (all[j].CPU + all[j].Mem/1024/1024) })
+	// list shares all's array, so the IO read below shows up in both.
+	list := all[:min(len(all), limit)]
+	readable, denied := 0, 0
+	var ioErr error
+	for i := range list {
+		p := &list[i]
+		if full := fullProcessName(p.PID, p.Name); full != "" { p.Name = full }
+		if slices.Contains(byCmd, p.Name) {
+			st := next[p.PID]
+			if st.cmdHash == "" { st.cmdHash = cmdlineHash(p.PID); next[p.PID] = st }
+			p.Key = p.Name + "#" + st.cmdHash
+		}
+		read, written, err := processIO(p.PID)
+		if err != nil {
+			// Other errors are mostly processes that exited meanwhile; only if nothing at all could
+			// be read does the platform lack the counters.
+			if errors.Is(err, fs.ErrPermission) { denied++ } else { ioErr = err }
+			continue
+		}
+		readable++
+		st := next[p.PID]
+		if st.io && secs > 0 {
+			if read >= st.read { p.DiskRead = uint64(float64(read-st.read) / secs) }
+			if written >= st.written { p.DiskWrite = uint64(float64(written-st.written) / secs) }
+		}
+		st.read, st.written, st.io = read, written, true
+		next[p.PID] = st
+	}
+	procPrev, procPrevAt = next, now
+	noteIOCap(readable, denied, ioErr)
+	groups := groupProcesses(all, kinds)
+	procScanNanos.Store(int64(time.Since(began))); procScanCount.Store(int64(len(raws)))
+	return list, groups
+}
+
+// noteIOCap reports whether IO counters could be read, which needs root (Administrator on Windows)
+// for other users' processes.
+func noteIOCap(readable, denied int, err error) {
+	admin := "root"
+	if runtime.GOOS == "windows" { admin = "Administrator" }
+	switch {
+	case readable == 0 && denied > 0: noteCap("process_io", collectorCap{Note: "per-process IO counters can't be read; run Pulse as " + admin})
+	case readable == 0 && err != nil: noteCap("process_io", collectorCap{Note: "per-process IO counters aren't available here: " + err.Error()})
+	case denied > 0: noteCap("process_io", collectorCap{OK: true, Partial: true, Note: fmt.Sprintf("IO of %d of %d processes can't be read; run Pulse as %s to see all", denied, readable+denied, admin)})
+	default: noteCap("process_io", collectorCap{OK: true})
+	}
+}
+
+// cmdlineHash tells apart processes of the same name by their arguments, in 8 hex digits.
+func cmdlineHash(pid int32) string {
+	h := fnv.New32a()
+	h.Write(processCmdline(pid))
+	return fmt.Sprintf("%08x", h.Sum32())
+}
@@ -0,0 +1,135 @@
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// clockTicks is USER_HZ, the unit of the CPU times in /proc/<pid>/stat; Linux fixes it at 100.
+const clockTicks = 100
+
+var pageSize = uint64(os.Getpagesize())
+
+func listProcesses() ([]procRaw, error) {
+	d, err := os.Open("/proc")
+	if err != nil { return nil, err }
+	names, err := d.Readdirnames(-1)
+	d.Close()
+	if err != nil { return nil, err }
+	list := make([]procRaw, 0, len(names))
+	buf := make([]byte, 4096) // one stat line is well under 1 KB; reused for every process
+	for _, n := range names {
+		pid, err := strconv.ParseInt(n, 10, 32)
+		if err != nil { continue }
+		if r, ok := readStat(int32(pid), buf); ok { list = append(list, r) }
+	}
+	return list, nil
+}
+
+// readStat parses /proc/<pid>/stat; a process that exits in between is skipped.
+func readStat(pid int32, buf []byte) (procRaw, bool) {
+	f, err := os.Open("/proc/" + strconv.Itoa(int(pid)) + "/stat")
+	if err != nil { return procRaw{}, false }
+	n, _ := f.Read(buf)
+	f.Close()
+	b := buf[:n]
+	// The name is in parentheses and may itself contain spaces and parentheses.
+	lp, rp := bytes.IndexByte(b, '('), bytes.LastIndexByte(b, ')')
+	if lp < 0 || rp < lp { return procRaw{}, false }
+	fields := strings.Fields(string(b[rp+1:]))
+	if len(fields) < 22 { return procRaw{}, false }
+	num := func(i int) uint64 { v, _ := strconv.ParseUint(fields[i], 10, 64); return v }
+	// fields[0] is stat field 3 (state): utime is 14, stime 15, starttime 22, rss 24.
+	return procRaw{pid: pid, name: string(b[lp+1 : rp]), cpu: float64(num(11)+num(12)) / clockTicks, start: num(19), rss: num(21) * pageSize}, true
+}
+
+// fullProcessName returns the command's base name when the kernel cut the name off at 15 bytes.
+func fullProcessName(pid int32, name string) string {
+	if len(name) < 15 { return "" }
+	b, err := os.ReadFile("/proc/" + strconv.Itoa(int(pid)) + "/cmdline")
+	if err != nil { return "" }
+	arg0, _, _ := bytes.Cut(b, []byte{0})
+	if base := filepath.Base(string(arg0)); strings.HasPrefix(base, name) { return base }
+	return ""
+}
+
+// processIO reads the bytes a process has read from and written to storage; other users'
+// processes are unreadable without root.
+func processIO(pid int32) (read, written uint64, err error) {
+	b, err := os.ReadFile("/proc/" + strconv.Itoa(int(pid)) + "/io")
+	if err != nil { return 0, 0, err }
+	for _, line := range strings.Split(string(b), "\n") {
+		k, v, _ := strings.Cut(line, ": ")
+		switch k {
+		case "read_bytes": read, _ = strconv.ParseUint(v, 10, 64)
+		case "write_bytes": written, _ = strconv.ParseUint(v, 10, 64)
+		}
+	}
+	return read, written, nil
+}
+
+// containerID finds a container runtime and id in a cgroup path, in both the systemd layout
+// (docker-<id>.scope) and the cgroupfs one (/docker/<id>).
+var containerID = regexp.MustCompile(`(docker|libpod|crio|cri-containerd)[-/]([0-9a-f]{64})`)
+
+// containerNames caches docker's names per container id; callers hold procIOMutex.
+var containerNames = map[string]string{}
+
+// processGroup picks the group from /proc/<pid>/cgroup: a container, else the innermost systemd
+// unit, else the cgroup itself. The unified hierarchy (0::) is preferred, then systemd's own.
+func processGroup(pid int32, name string) (group, kind string) {
+	b, err := os.ReadFile("/proc/" + strconv.Itoa(int(pid)) + "/cgroup")
+	if err != nil { return name, "name" }
+	path := ""
+	for _, want := range []string{"0:", "name=systemd", ""} {
+		for _, line := range strings.Split(string(b), "\n") {
+			// hierarchy-id:controllers:path
+			f := strings.SplitN(line, ":", 3)
+			if len(f) < 3 || f[2] == "/" || (want == "0:" && f[0] != "0") || (want == "name=systemd" && f[1] != want) { continue }
+			path = f[2]
+			break
+		}
+		if path != "" { break }
+	}
+	return cgroupGroup(path)
+}
+
+// cgroupGroup names the group of a cgroup path (see processGroup).
+func cgroupGroup(path string) (group, kind string) {
+	if path == "" || path == "/" { return "root", "cgroup" }
+	if m := containerID.FindStringSubmatch(path); m != nil {
+		switch m[1] {
+		case "docker": return dockerName(m[2]), "docker"
+		case "libpod": return m[2][:12], "podman"
+		}
+		return m[2][:12], "container"
+	}
+	parts := strings.Split(path, "/")
+	for i := len(parts) - 1; i >= 0; i-- {
+		if strings.HasSuffix(parts[i], ".service") || strings.HasSuffix(parts[i], ".scope") { return parts[i], "systemd" }
+	}
+	return strings.Trim(path, "/"), "cgroup"
+}
+
+// dockerName reads a container's name from docker's state, which needs root; else it's the short id.
+func dockerName(id string) string {
+	if n, ok := containerNames[id]; ok { return n }
+	n := id[:12]
+	var c struct{ Name string }
+	if b, err := os.ReadFile("/var/lib/docker/containers/" + id + "/config.v2.json"); err == nil && json.Unmarshal(b, &c) == nil && c.Name != "" { n = strings.TrimPrefix(c.Name, "/") }
+	containerNames[id] = n
+	return n
+}
+
+// processCmdline is the arguments, NUL-separated.
+func processCmdline(pid int32) []byte {
+	b, _ := os.ReadFile("/proc/" + strconv.Itoa(int(pid)) + "/cmdline")
+	return b
+}
@@ -0,0 +1,43 @@
+//go:build !linux && !windows
+
+package main
+
+import (
+	"strings"
+
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+func listProcesses() ([]procRaw, error) {
+	procs, err := process.Processes()
+	list := make([]procRaw, 0, len(procs))
+	for _, p := range procs {
+		r := procRaw{pid: p.Pid}
+		if t, err := p.Times(); err == nil { r.cpu = t.User + t.System }
+		if m, err := p.MemoryInfo(); err == nil { r.rss = m.RSS }
+		if c, err := p.CreateTime(); err == nil { r.start = uint64(c) }
+		r.name, _ = p.Name()
+		list = append(list, r)
+	}
+	return list, err
+}
+
+func fullProcessName(pid int32, name string) string { return "" }
+
+func processIO(pid int32) (read, written uint64, err error) {
+	p, err := process.NewProcess(pid)
+	if err != nil { return 0, 0, err }
+	io, err := p.IOCounters()
+	if err != nil { return 0, 0, err }
+	return io.ReadBytes, io.WriteBytes, nil
+}
+
+// Without cgroups, processes are grouped by name.
+func processGroup(pid int32, name string) (group, kind string) { return name, "name" }
+
+func processCmdline(pid int32) []byte {
+	p, err := process.NewProcess(pid)
+	if err != nil { return nil }
+	args, _ := p.CmdlineSlice()
+	return []byte(strings.Join(args, "\x00"))
+}
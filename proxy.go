@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// --- REVERSE PROXIES & CORS ---
+// X-Forwarded-For, -Proto, -Host and -Prefix are only believed from trusted_proxies (IPs or
+// CIDRs; the unix socket always counts). Then logs show the real client, the session cookie is
+// Secure behind an HTTPS proxy, and redirects keep a prefix the proxy strips before passing the
+// request on. cors_origins lists the origins (or "*") whose browser apps may call Pulse; only
+// listed origins get credentials and may open /ws.
+
+type proxyInfo struct{ proto, host, prefix string }
+
+const proxyCtx ctxKey = 1
+
+func trustedProxy(cfg AppConfig, addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil { host = addr }
+	ip := net.ParseIP(host)
+	if ip == nil { return true } // unix socket: only local processes can connect
+	return ipListed(cfg.TrustedProxies, ip)
+}
+
+// forwarded applies X-Forwarded-* headers from trusted proxies: RemoteAddr becomes the client's
+// address (the right-most one in X-Forwarded-For that isn't a trusted proxy itself).
+func forwarded(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfgMutex.RLock(); cfg := config; cfgMutex.RUnlock()
+		if !trustedProxy(cfg, r.RemoteAddr) { next.ServeHTTP(w, r); return }
+		pi := proxyInfo{
+			proto:  strings.ToLower(strings.TrimSpace(strings.Split(r.Header.Get("X-Forwarded-Proto"), ",")[0])),
+			host:   strings.TrimSpace(strings.Split(r.Header.Get("X-Forwarded-Host"), ",")[0]),
+			prefix: normBase(r.Header.Get("X-Forwarded-Prefix")),
+		}
+		if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+			hops := strings.Split(xff, ",")
+			for i := len(hops) - 1; i >= 0; i-- {
+				ip := strings.TrimSpace(hops[i])
+				if net.ParseIP(ip) == nil { break }
+				r.RemoteAddr = net.JoinHostPort(ip, "0")
+				if !trustedProxy(cfg, ip) { break }
+			}
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), proxyCtx, pi)))
+	})
+}
+
+func proxyOf(r *http.Request) proxyInfo { pi, _ := r.Context().Value(proxyCtx).(proxyInfo); return pi }
+
+// clientIP is the request's source address without the port.
+func clientIP(r *http.Request) string {
+	if h, _, err := net.SplitHostPort(r.RemoteAddr); err == nil { return h }
+	return r.RemoteAddr
+}
+
+func requestScheme(r *http.Request) string {
+	if p := proxyOf(r).proto; p == "http" || p == "https" { return p }
+	if r.TLS != nil { return "https" }
+	return "http"
+}
+
+func requestHost(r *http.Request) string {
+	if h := proxyOf(r).host; h != "" { return h }
+	return r.Host
+}
+
+// urlPrefix is the path under which the browser sees Pulse: a prefix stripped by the proxy plus base_path.
+func urlPrefix(r *http.Request) string { return proxyOf(r).prefix + basePath }
+
+// corsOrigin reports whether origin may make cross-origin requests, and whether it was listed by name.
+func corsOrigin(cfg AppConfig, origin string) (allowed, named bool) {
+	for _, o := range cfg.CORSOrigins {
+		if o == "*" { allowed = true; continue }
+		if strings.EqualFold(strings.TrimSuffix(o, "/"), origin) { return true, true }
+	}
+	return allowed, false
+}
+
+func cors(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		cfgMutex.RLock(); ok, named := corsOrigin(config, origin); cfgMutex.RUnlock()
+		if origin == "" || !ok { next.ServeHTTP(w, r); return }
+		h := w.Header()
+		h.Add("Vary", "Origin")
+		if named { h.Set("Access-Control-Allow-Origin", origin); h.Set("Access-Control-Allow-Credentials", "true") } else { h.Set("Access-Control-Allow-Origin", "*") }
+		if r.Method == "OPTIONS" && r.Header.Get("Access-Control-Request-Method") != "" {
+			h.Set("Access-Control-Allow-Methods", "GET, POST, PATCH, OPTIONS")
+			h.Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+			h.Set("Access-Control-Max-Age", "600")
+			w.WriteHeader(http.StatusNoContent); return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// wsOrigin lets /ws be opened from the dashboard's own origin (as the browser sees it through a
+// proxy) and from origins named in cors_origins.
+func wsOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" { return true }
+	u, err := url.Parse(origin)
+	if err != nil { return false }
+	if strings.EqualFold(u.Host, requestHost(r)) { return true }
+	cfgMutex.RLock(); _, named := corsOrigin(config, origin); cfgMutex.RUnlock()
+	return named
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- WEB PUSH & MOBILE ---
+// The dashboard installs as a PWA (manifest.webmanifest, sw.js) and can subscribe the browser to
+// alert notifications with the standard Web Push protocol: Pulse signs requests with its own VAPID
+// key (pulse.vapid, made on first use) and encrypts payloads itself (RFC 8291), so the browser
+// vendor's push service is the only thing in between. The "push" channel sends to every
+// subscription in pulse.push.json; ones the push service reports gone are dropped.
+// /api/v1/mobile is a one-request summary sized for a phone.
+
+var (
+	vapidKeyFile = "pulse.vapid"
+	pushFile     = "pulse.push.json"
+)
+
+// pwaFiles are served at the root without login: browsers fetch the manifest and its icon
+// without cookies, and a service worker only controls pages under its own path.
+var pwaFiles = []string{"manifest.webmanifest", "sw.js", "icon.svg"}
+
+func init() { mime.AddExtensionType(".webmanifest", "application/manifest+json") }
+
+type PushSubscription struct {
+	Endpoint string `json:"endpoint"`
+	Keys     struct {
+		P256dh string `json:"p256dh"`
+		Auth   string `json:"auth"`
+	} `json:"keys"`
+	User  string `json:"user,omitempty"`
+	Added int64  `json:"added,omitempty"`
+}
+
+var (
+	pushSubs  []PushSubscription
+	pushMutex sync.Mutex
+	pushInit  bool
+	vapidKey  *ecdsa.PrivateKey
+	b64url    = base64.RawURLEncoding
+)
+
+func loadVAPID() (*ecdsa.PrivateKey, error) {
+	pushMutex.Lock(); defer pushMutex.Unlock()
+	if vapidKey != nil { return vapidKey, nil }
+	if b, err := os.ReadFile(vapidKeyFile); err == nil {
+		blk, _ := pem.Decode(b)
+		if blk == nil { return nil, fmt.Errorf("%s: not a PEM file", vapidKeyFile) }
+		k, err := x509.ParseECPrivateKey(blk.Bytes)
+		if err != nil { return nil, fmt.Errorf("%s: %v", vapidKeyFile, err) }
+		vapidKey = k
+		return k, nil
+	} else if !os.IsNotExist(err) { return nil, err }
+	k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil { return nil, err }
+	der, _ := x509.MarshalECPrivateKey(k)
+	if err := os.WriteFile(vapidKeyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600); err != nil { return nil, err }
+	vapidKey = k
+	return k, nil
+}
+
+// vapidPublic is the applicationServerKey the browser subscribes with: the uncompressed point, base64url.
+func vapidPublic(k *ecdsa.PrivateKey) string {
+	pub, _ := k.PublicKey.ECDH()
+	return b64url.EncodeToString(pub.Bytes())
+}
+
+// vapidAuth is the Authorization header for one push service: an ES256 JWT for its origin.
+func vapidAuth(k *ecdsa.PrivateKey, endpoint, contact string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil { return "", err }
+	hdr, _ := json.Marshal(map[string]string{"typ": "JWT", "alg": "ES256"})
+	claims, _ := json.Marshal(map[string]interface{}{"aud": u.Scheme + "://" + u.Host, "exp": time.Now().Add(12 * time.Hour).Unix(), "sub": contact})
+	unsigned := b64url.EncodeToString(hdr) + "." + b64url.EncodeToString(claims)
+	sum := sha256.Sum256([]byte(unsigned))
+	r, s, err := ecdsa.Sign(rand.Reader, k, sum[:])
+	if err != nil { return "", err }
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32]); s.FillBytes(sig[32:])
+	return "vapid t=" + unsigned + "." + b64url.EncodeToString(sig) + ", k=" + vapidPublic(k), nil
+}
+
+// encryptPush is RFC 8291 (aes128gcm): an ephemeral ECDH key with the browser's p256dh key, mixed
+// with its auth secret, gives the content key; the result is a single record with the header in front.
+func encryptPush(sub PushSubscription, payload []byte) ([]byte, error) {
+	uaRaw, err1 := b64url.DecodeString(strings.TrimRight(sub.Keys.P256dh, "="))
+	auth, err2 := b64url.DecodeString(strings.TrimRight(sub.Keys.Auth, "="))
+	if err := errors.Join(err1, err2); err != nil { return nil, fmt.Errorf("bad subscription keys: %v", err) }
+	uaPub, err := ecdh.P256().NewPublicKey(uaRaw)
+	if err != nil { return nil, err }
+	as, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil { return nil, err }
+	shared, err := as.ECDH(uaPub)
+	if err != nil { return nil, err }
+	asPub := as.PublicKey().Bytes()
+	ikm, err := hkdf.Key(sha256.New, shared, auth, "WebPush: info\x00"+string(uaRaw)+string(asPub), 32)
+	if err != nil { return nil, err }
+	salt := make([]byte, 16)
+	rand.Read(salt)
+	cek, _ := hkdf.Key(sha256.New, ikm, salt, "Content-Encoding: aes128gcm\x00", 16)
+	nonce, _ := hkdf.Key(sha256.New, ikm, salt, "Content-Encoding: nonce\x00", 12)
+	block, err := aes.NewCipher(cek)
+	if err != nil { return nil, err }
+	gcm, _ := cipher.NewGCM(block)
+	var out bytes.Buffer
+	out.Write(salt)
+	binary.Write(&out, binary.BigEndian, uint32(4096))
+	out.WriteByte(byte(len(asPub))); out.Write(asPub)
+	out.Write(gcm.Seal(nil, nonce, append(append([]byte(nil), payload...), 2), nil)) // 2 = last record, no padding
+	return out.Bytes(), nil
+}
+
+func sendPush(k *ecdsa.PrivateKey, contact string, sub PushSubscription, payload []byte, urgency string) error {
+	body, err := encryptPush(sub, payload)
+	if err != nil { return err }
+	authz, err := vapidAuth(k, sub.Endpoint, contact)
+	if err != nil { return err }
+	req, err := http.NewRequest("POST", sub.Endpoint, bytes.NewReader(body))
+	if err != nil { return err }
+	req.Header.Set("Authorization", authz)
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("TTL", "86400")
+	req.Header.Set("Urgency", urgency)
+	return doNotify(req)
+}
+
+func loadPushSubs() {
+	if pushInit { return }
+	pushInit = true
+	if b, err := os.ReadFile(pushFile); err == nil {
+		if err := json.Unmarshal(b, &pushSubs); err != nil { storageLog.Error("cannot read push subscriptions", "file", pushFile, "err", err) }
+	}
+}
+
+func savePushSubs() error {
+	b, _ := json.MarshalIndent(pushSubs, "", "  ")
+	tmp := pushFile + ".tmp"
+	if err := os.WriteFile(tmp, b, 0600); err != nil { return err }
+	return os.Rename(tmp, pushFile)
+}
+
+// editPushSubs drops any subscription for endpoint and, if add is set, stores add in its place.
+func editPushSubs(endpoint string, add *PushSubscription) error {
+	pushMutex.Lock(); defer pushMutex.Unlock()
+	loadPushSubs()
+	keep := pushSubs[:0:0]
+	for _, s := range pushSubs { if s.Endpoint != endpoint { keep = append(keep, s) } }
+	if add != nil { keep = append(keep, *add) }
+	pushSubs = keep
+	return savePushSubs()
+}
+
+func notifyPush(cfg AppConfig, ev AlertEvent) error {
+	pushMutex.Lock(); loadPushSubs(); subs := append([]PushSubscription(nil), pushSubs...); pushMutex.Unlock()
+	if len(subs) == 0 { return errNotConfigured }
+	k, err := loadVAPID()
+	if err != nil { return err }
+	contact := cfg.PushContact
+	if contact == "" { contact = "mailto:pulse@example.com" }
+	body := ev.Message
+	if body == "" { body = fmt.Sprintf("Value: %.2f", ev.Value) }
+	payload, _ := json.Marshal(map[string]interface{}{"title": "Pulse: " + alertTitle(ev), "body": body, "level": ev.Level, "monitor": ev.Monitor, "tag": ev.Host + ":" + ev.Monitor})
+	urgency := map[string]string{"CRITICAL": "high", "WARNING": "normal"}[ev.Level]
+	if urgency == "" { urgency = "low" }
+	var errs []string
+	for _, s := range subs {
+		err := withRetry(3, func() error { return sendPush(k, contact, s, payload, urgency) })
+		var se *statusError
+		if errors.As(err, &se) && (se.code == http.StatusNotFound || se.code == http.StatusGone) {
+			alertLog.Info("push subscription expired, removing", "user", s.User)
+			editPushSubs(s.Endpoint, nil)
+			continue
+		}
+		if err != nil { errs = append(errs, err.Error()) }
+	}
+	if len(errs) > 0 { return fmt.Errorf("%d of %d push deliveries failed: %s", len(errs), len(subs), errs[0]) }
+	return nil
+}
+
+// mobileSummary is the phone view: worst level, headline figures and what is alerting, in one small object.
+type mobileSummary struct {
+	Host    string        `json:"host"`
+	Time    int64         `json:"time"`
+	Status  string        `json:"status"`
+	CPU     float64       `json:"cpu"`
+	Mem     float64       `json:"mem"`
+	Disk    float64       `json:"disk"` // fullest mount, %
+	Load1   float64       `json:"load1"`
+	NetDown uint64        `json:"net_down"`
+	NetUp   uint64        `json:"net_up"`
+	Alerts  []activeAlert `json:"alerts"`
+}
+
+func mobileStatus(cfg AppConfig) mobileSummary {
+	m := latestSample()
+	s := mobileSummary{Host: m.Hostname, Time: m.Timestamp, Status: "OK", CPU: m.CPUTotal, Mem: m.MemUsed, Disk: m.DiskUsed, Load1: m.Load1, NetDown: m.NetDown, NetUp: m.NetUp, Alerts: currentAlerts(cfg)}
+	for _, mu := range m.Mounts { s.Disk = max(s.Disk, mu.Pct) }
+	for _, a := range s.Alerts {
+		if a.Level == "CRITICAL" || (a.Level == "WARNING" && s.Status == "OK") { s.Status = a.Level }
+	}
+	return s
+}
+
+func registerPush(mux *http.ServeMux) {
+	for _, f := range pwaFiles {
+		mux.HandleFunc("GET /"+f, func(w http.ResponseWriter, r *http.Request) {
+			if f == "sw.js" { w.Header().Set("Service-Worker-Allowed", "./") }
+			serveWebFile(w, f)
+		})
+	}
+	mux.HandleFunc("GET /push/key", func(w http.ResponseWriter, r *http.Request) {
+		k, err := loadVAPID()
+		if err != nil { alertLog.Error("cannot load VAPID key", "err", err); http.Error(w, err.Error(), http.StatusInternalServerError); return }
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"public_key": vapidPublic(k)})
+	})
+	mux.HandleFunc("POST /push/subscribe", func(w http.ResponseWriter, r *http.Request) {
+		var s PushSubscription
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 8<<10)).Decode(&s); err != nil { http.Error(w, "bad subscription: "+err.Error(), http.StatusBadRequest); return }
+		if u, err := url.Parse(s.Endpoint); err != nil || u.Scheme != "https" || u.Host == "" { http.Error(w, "endpoint must be an https:// URL", http.StatusBadRequest); return }
+		if _, err := encryptPush(s, nil); err != nil { http.Error(w, err.Error(), http.StatusBadRequest); return }
+		s.User, s.Added = actor(r), time.Now().Unix()
+		if err := editPushSubs(s.Endpoint, &s); err != nil { http.Error(w, err.Error(), http.StatusInternalServerError); return }
+		auditLog("push_subscribe", map[string]interface{}{"user": s.User})
+		w.WriteHeader(http.StatusCreated)
+	})
+	mux.HandleFunc("DELETE /push/subscribe", func(w http.ResponseWriter, r *http.Request) {
+		var s PushSubscription
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 8<<10)).Decode(&s); err != nil || s.Endpoint == "" { http.Error(w, "endpoint required", http.StatusBadRequest); return }
+		if err := editPushSubs(s.Endpoint, nil); err != nil { http.Error(w, err.Error(), http.StatusInternalServerError); return }
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("GET /api/v1/mobile", func(w http.ResponseWriter, r *http.Request) {
+		cfgMutex.RLock(); cfg := config; cfgMutex.RUnlock()
+		apiOK(w, 200, mobileStatus(cfg), nil)
+	})
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// --- QUERY ENGINE ---
+// queryHistory reduces a range of history to buckets of step seconds with min, max, avg and p95
+// per field, so a client asking for 500 points over 3 days gets 500 points rather than every
+// sample. Fields are the export columns (cpu_tot, plugin:<name>/<label>, mount:<path>, ...). Each
+// column is aggregated by one of a pool of workers reading the ring in place under the read lock,
+// so nothing is copied and a many-series query uses every core.
+
+type histQuery struct {
+	Start, End int64
+	Step       int64 // bucket width in seconds; 0 = derived from Points
+	Points     int   // about this many buckets (one more when the range straddles a step boundary)
+	Fields     []string
+	Aggs       map[string]bool // min, max, avg, p95; empty = all
+}
+
+// aggSeries is one field, column-wise: the i-th bucket starts at TS[i] and holds N[i] samples.
+type aggSeries struct {
+	Field string    `json:"field"`
+	TS    []int64   `json:"ts"`
+	N     []int     `json:"n"`
+	Min   []float64 `json:"min,omitempty"`
+	Max   []float64 `json:"max,omitempty"`
+	Avg   []float64 `json:"avg,omitempty"`
+	P95   []float64 `json:"p95,omitempty"`
+}
+
+type queryResult struct {
+	Start  int64       `json:"start"`
+	End    int64       `json:"end"`
+	Step   int64       `json:"step"`
+	Series []aggSeries `json:"series"`
+}
+
+const maxQueryPoints = 10000
+
+var aggNames = []string{"min", "max", "avg", "p95"}
+
+// parseHistQuery reads start, end, step, points, fields and agg; ok is false when the request
+// asks for raw samples (neither step nor points).
+func parseHistQuery(v url.Values) (q histQuery, ok bool, err error) {
+	if v.Get("step") == "" && v.Get("points") == "" { return q, false, nil }
+	var ok1, ok2 bool
+	q.Start, ok1 = parseTimeParam(v.Get("start"), 0)
+	q.End, ok2 = parseTimeParam(v.Get("end"), 1<<62)
+	if !ok1 || !ok2 { return q, true, fmt.Errorf("start and end must be unix seconds or RFC 3339") }
+	if s := v.Get("step"); s != "" {
+		if q.Step, err = strconv.ParseInt(s, 10, 64); err != nil || q.Step < 1 { return q, true, fmt.Errorf("step must be a positive number of seconds") }
+	}
+	if s := v.Get("points"); s != "" {
+		if q.Points, err = strconv.Atoi(s); err != nil || q.Points < 1 || q.Points > maxQueryPoints { return q, true, fmt.Errorf("points must be between 1 and %d", maxQueryPoints) }
+	}
+	q.Fields = exportDefault
+	if f := v.Get("fields"); f != "" { q.Fields = strings.Split(f, ",") }
+	if a := v.Get("agg"); a != "" {
+		q.Aggs = map[string]bool{}
+		for _, s := range strings.Split(a, ",") {
+			if !slices.Contains(aggNames, s) { return q, true, fmt.Errorf("unknown aggregate %q (min, max, avg, p95)", s) }
+			q.Aggs[s] = true
+		}
+	}
+	return q, true, nil
+}
+
+func queryWorkers() int { return max(runtime.GOMAXPROCS(0), 1) }
+
+func queryHistory(q histQuery) (queryResult, error) {
+	historyMutex.RLock(); defer historyMutex.RUnlock()
+	lo, hi := history.Search(q.Start), history.Search(q.End+1)
+	hi = max(hi, lo)
+	a, b := history.Segments(lo, hi)
+	cols, err := exportColumns(q.Fields, a, b)
+	if err != nil { return queryResult{}, err }
+	res := queryResult{Start: q.Start, End: q.End, Step: max(q.Step, 1), Series: make([]aggSeries, len(cols))}
+	if hi > lo {
+		res.Start, res.End = history.At(lo).Timestamp, history.At(hi-1).Timestamp
+		if q.Points > 0 { res.Step = max(res.Step, (res.End-res.Start+int64(q.Points))/int64(q.Points)) }
+	}
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(len(cols), queryWorkers()); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var vals []float64 // reused across buckets
+			for i := range jobs { res.Series[i], vals = aggregateColumn(cols[i], res.Step, q.Aggs, vals, a, b) }
+		}()
+	}
+	for i := range cols { jobs <- i }
+	close(jobs)
+	wg.Wait()
+	return res, nil
+}
+
+// aggregateColumn buckets one column; buckets are aligned to multiples of step and empty ones are left out.
+func aggregateColumn(c exportCol, step int64, aggs map[string]bool, vals []float64, segs ...[]RichMetrics) (aggSeries, []float64) {
+	s := aggSeries{Field: c.name, TS: []int64{}, N: []int{}}
+	want := func(a string) bool { return len(aggs) == 0 || aggs[a] }
+	bucket := int64(-1)
+	flush := func() {
+		if len(vals) == 0 { return }
+		slices.Sort(vals)
+		var sum float64
+		for _, v := range vals { sum += v }
+		s.TS, s.N = append(s.TS, bucket), append(s.N, len(vals))
+		if want("min") { s.Min = append(s.Min, vals[0]) }
+		if want("max") { s.Max = append(s.Max, vals[len(vals)-1]) }
+		if want("avg") { s.Avg = append(s.Avg, sum/float64(len(vals))) }
+		if want("p95") { s.P95 = append(s.P95, vals[(len(vals)*95+99)/100-1]) } // nearest rank
+		vals = vals[:0]
+	}
+	for _, seg := range segs {
+		for i := range seg {
+			v, ok := c.get(seg[i])
+			if !ok { continue }
+			b := seg[i].Timestamp - seg[i].Timestamp%step
+			if b != bucket { flush(); bucket = b }
+			vals = append(vals, v)
+		}
+	}
+	flush()
+	return s, vals
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// --- RATE-OF-CHANGE RULES ---
+// A rate rule compares a metric now with its value Window seconds ago in history.
+// Mode "abs" is a plain delta, "pct" a relative change in percent, "ratio" a factor
+// (2 = doubled) and "to" fires when the value crosses Change (e.g. dropped to 0).
+
+type RateRule struct {
+	Name      string  `json:"name,omitempty"`
+	Metric    string  `json:"metric"`
+	Window    int     `json:"window"`
+	Mode      string  `json:"mode,omitempty"`
+	Change    float64 `json:"change"`
+	Direction string  `json:"direction,omitempty"`
+	Level     string  `json:"level,omitempty"`
+}
+
+// namedMetric resolves a metric name: a core metric, "group:<group>/<field>", "metric:<series>" (a
+// collector's), a script name (its perf value) or "script [label]".
+func namedMetric(m RichMetrics, name string) (float64, bool) {
+	if key, ok := strings.CutPrefix(name, "metric:"); ok { return metricValue(m, key) }
+	if rest, ok := strings.CutPrefix(name, "group:"); ok {
+		g, what, ok := splitGroupField(rest)
+		if !ok { return 0, false }
+		return groupField(m, g, what)
+	}
+	switch strings.ToLower(name) {
+	case "cpu": return m.CPUTotal, true
+	case "mem", "memory": return m.MemUsed, true
+	case "swap": return m.SwapUsed, true
+	case "disk": return m.DiskUsed, true
+	case "load1", "load": return m.Load1, true
+	case "load5": return m.Load5, true
+	case "load15": return m.Load15, true
+	case "load_core": return m.LoadCore, true
+	case "procs": return float64(m.Procs), true
+	case "net_down": return float64(m.NetDown), true
+	case "net_up": return float64(m.NetUp), true
+	case "psi_cpu": return m.PSICPU, true
+	case "psi_io": return m.PSIIO, true
+	case "psi_mem": return m.PSIMem, true
+	}
+	for _, p := range m.Plugins {
+		pn := p.Path
+		if p.Name != "" { pn = p.Name }
+		if pn == name { return p.PerfVal, true }
+		for _, pm := range p.Perf { if pn+" ["+pm.Label+"]" == name { return pm.Value, true } }
+	}
+	return 0, false
+}
+
+// sampleAt returns the first history sample at or after ts.
+func sampleAt(ts int64) (RichMetrics, bool) {
+	historyMutex.RLock(); defer historyMutex.RUnlock()
+	i := history.Search(ts)
+	if i == history.Len() { return RichMetrics{}, false }
+	return *history.At(i), true
+}
+
+func (r RateRule) eval(m RichMetrics) (fire bool, now, then float64, desc string) {
+	if r.Window <= 0 { return }
+	now, ok := namedMetric(m, r.Metric)
+	if !ok { return }
+	start := m.Timestamp - int64(r.Window)
+	old, ok := sampleAt(start)
+	// History has to reach back the whole window, or a restart would look like a jump.
+	if !ok || old.Timestamp-start > int64(r.Window)/10+2 { return }
+	if then, ok = namedMetric(old, r.Metric); !ok { return }
+	dir := r.Direction
+	if dir == "" && r.Mode == "to" { dir = "down" }
+	if dir == "" { dir = "up" }
+	up, down := dir == "up" || dir == "any", dir == "down" || dir == "any"
+	d := now - then
+	switch r.Mode {
+	case "pct":
+		if then == 0 { return }
+		pct := 100 * d / math.Abs(then)
+		fire = (up && pct >= r.Change) || (down && -pct >= r.Change)
+		desc = fmt.Sprintf("%+.1f%%", pct)
+	case "ratio":
+		if then == 0 || now == 0 || r.Change <= 0 { return }
+		f := now / then
+		fire = (up && f >= r.Change) || (down && 1/f >= r.Change)
+		desc = fmt.Sprintf("x%.2f", f)
+	case "to":
+		fire = (down && then > r.Change && now <= r.Change) || (up && then < r.Change && now >= r.Change)
+		desc = fmt.Sprintf("crossed %g", r.Change)
+	default:
+		fire = (up && d >= r.Change) || (down && -d >= r.Change)
+		desc = fmt.Sprintf("%+.2f", d)
+	}
+	return
+}
+
+func checkRates(cfg AppConfig, m RichMetrics, alert func(n, lvl string, v float64, msg string)) {
+	for _, r := range cfg.RateRules {
+		fire, now, then, desc := r.eval(m)
+		if !fire { continue }
+		name := r.Name
+		if name == "" { name = r.Metric }
+		lvl := r.Level
+		if lvl == "" { lvl = "WARNING" }
+		alert("Rate "+name, lvl, now, fmt.Sprintf("%s went from %.2f to %.2f (%s) in %s", r.Metric, then, now, desc, time.Duration(r.Window)*time.Second))
+	}
+}
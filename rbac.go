@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+// --- ROLES ---
+// viewer: dashboard and metrics. operator: also acknowledges alerts, runs remediations and sends
+// reports. admin: also changes the configuration. Users without a role are
+// admins, and so is everyone while no users are configured. With admin_listen set, admin actions
+// are only allowed through that listener.
+
+var roleRank = map[string]int{"viewer": 1, "operator": 2, "admin": 3}
+
+var acknowledged = make(map[string]string) // monitor -> user, guarded by alertMutex
+
+func requestRole(r *http.Request) string {
+	if fromAdminListener(r) { return "admin" }
+	cfgMutex.RLock(); cfg := config; cfgMutex.RUnlock()
+	role := ""
+	if len(cfg.Users) == 0 { role = "admin" }
+	user := currentUser(r)
+	for _, u := range cfg.Users {
+		if u.Username != user { continue }
+		if role = u.Role; role == "" { role = "admin" }
+	}
+	if role == "admin" && cfg.AdminListen != "" { role = "operator" }
+	return role
+}
+
+// actor names who made a request, for audit entries and config revisions.
+func actor(r *http.Request) string {
+	if u := currentUser(r); u != "" { return u }
+	if fromAdminListener(r) { return "admin listener" }
+	return "anonymous"
+}
+
+func hasRole(r *http.Request, min string) bool { return roleRank[requestRole(r)] >= roleRank[min] }
+
+// needRole wraps a handler so it answers 403 below the given role.
+func needRole(min string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !hasRole(r, min) { http.Error(w, "forbidden: requires "+min, http.StatusForbidden); return }
+		h(w, r)
+	}
+}
+
+// ackAlert silences further notifications for an active alert until it recovers or escalates.
+func ackAlert(monitor, user string) error {
+	alertMutex.Lock()
+	lvl, ok := activeAlerts[monitor]
+	if ok { acknowledged[monitor] = user }
+	alertMutex.Unlock()
+	if !ok { return fmt.Errorf("no active alert for %q", monitor) }
+	latestMutex.RLock(); host := latestMetric.Hostname; latestMutex.RUnlock()
+	recordAlert(AlertEvent{Monitor: monitor, Level: "ACK", Host: host, Message: fmt.Sprintf("%s acknowledged by %s", lvl, user)})
+	auditLog("ack", map[string]interface{}{"monitor": monitor, "level": lvl, "user": user})
+	return nil
+}
+
+type activeAlert struct {
+	Monitor     string `json:"monitor"`
+	Level       string `json:"level"`
+	AckedBy     string `json:"acked_by,omitempty"`
+	Remediation bool   `json:"remediation,omitempty"`
+}
+
+func currentAlerts(cfg AppConfig) []activeAlert {
+	fix := map[string]bool{}
+	for _, rc := range cfg.Remediations { fix[rc.Monitor] = true }
+	alertMutex.Lock(); defer alertMutex.Unlock()
+	out := []activeAlert{}
+	for m, l := range activeAlerts { out = append(out, activeAlert{m, l, acknowledged[m], fix[m]}) }
+	sort.Slice(out, func(i, j int) bool { return out[i].Monitor < out[j].Monitor })
+	return out
+}
+
+// runRemediationNow starts a monitor's remediation by hand, outside the automatic retry budget.
+func runRemediationNow(monitor, user string) error {
+	cfgMutex.RLock(); cfg := config; cfgMutex.RUnlock()
+	latestMutex.RLock(); host := latestMetric.Hostname; latestMutex.RUnlock()
+	for _, rc := range cfg.Remediations {
+		if rc.Monitor != monitor { continue }
+		auditLog("remediation_manual", map[string]interface{}{"monitor": monitor, "command": rc.Command, "user": user})
+		go runRemediation(rc, 1, 1, host)
+		return nil
+	}
+	return fmt.Errorf("no remediation configured for %q", monitor)
+}
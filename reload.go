@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// --- CONFIG RELOAD ---
+// pulse.conf is re-read when its modification time changes (checked every 2s, Pulse's own saves
+// excepted) or on SIGHUP. A config that doesn't parse or validate is ignored and the running one
+// stays. The collector and notifiers read the config on every pass, so swapping it is enough;
+// listeners and TLS settings still need a restart.
+
+var confModTime time.Time // of pulse.conf as last read or written, guarded by cfgMutex
+
+func reloadConfig(reason string) {
+	c, raw, _, err := readConfig()
+	if err == nil { if errs := validateConfig(c); len(errs) > 0 { err = fmt.Errorf("%s: %s", errs[0].Field, errs[0].Message) } }
+	st, _ := os.Stat(confFile)
+	cfgMutex.Lock()
+	if st != nil { confModTime = st.ModTime() }
+	if err != nil { cfgMutex.Unlock(); configLog.Error("reload failed, keeping the running config", "reason", reason, "err", err); return }
+	old := config
+	config, fileValues = c, raw
+	cfgMutex.Unlock()
+	if old.Listen != c.Listen || old.ListenSocket != c.ListenSocket || old.AdminListen != c.AdminListen || old.BasePath != c.BasePath ||
+		old.TLSCert != c.TLSCert || old.TLSSelfSigned != c.TLSSelfSigned || old.ACMEDomain != c.ACMEDomain {
+		configLog.Warn("listener and TLS changes apply after a restart")
+	}
+	applyLogging(c)
+	configLog.Info("config reloaded", "reason", reason)
+	recordRevision(c, "", reason)
+	kickFederation()
+	auditLog("config_reload", map[string]interface{}{"reason": reason, "changes": configDiff(old, c)})
+}
+
+func watchConfig() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	t := time.NewTicker(2 * time.Second); defer t.Stop()
+	for {
+		select {
+		case <-hup: reloadConfig("SIGHUP")
+		case <-t.C:
+			st, err := os.Stat(confFile)
+			if err != nil { continue }
+			cfgMutex.RLock(); changed := !st.ModTime().Equal(confModTime); cfgMutex.RUnlock()
+			if changed { reloadConfig("file changed") }
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- AUTO-REMEDIATION ---
+// A remediation runs a command when its monitor is CRITICAL. It is retried at most MaxRetries times,
+// Cooldown seconds apart, and re-armed once the monitor leaves CRITICAL.
+
+type RemediationConfig struct {
+	Monitor    string `json:"monitor"`
+	Command    string `json:"command"`
+	Cooldown   int    `json:"cooldown"`
+	MaxRetries int    `json:"max_retries"`
+	Timeout    int    `json:"timeout"`
+}
+
+type remediationState struct {
+	last     time.Time
+	attempts int
+	running  bool
+}
+
+var (
+	remediations     = make(map[string]*remediationState)
+	remediationMutex sync.Mutex
+)
+
+func updateRemediations(cfg AppConfig, crit map[string]bool, host string) {
+	if observeOnly { return }
+	remediationMutex.Lock(); defer remediationMutex.Unlock()
+	for _, rc := range cfg.Remediations {
+		st := remediations[rc.Monitor]
+		if !crit[rc.Monitor] {
+			if st != nil && !st.running { delete(remediations, rc.Monitor) }
+			continue
+		}
+		if st == nil { st = &remediationState{}; remediations[rc.Monitor] = st }
+		cooldown, retries := time.Duration(rc.Cooldown)*time.Second, rc.MaxRetries
+		if cooldown <= 0 { cooldown = 5 * time.Minute }
+		if retries <= 0 { retries = 3 }
+		if st.running || st.attempts >= retries || time.Since(st.last) < cooldown { continue }
+		st.attempts++; st.last = time.Now(); st.running = true
+		go runRemediation(rc, st.attempts, retries, host)
+	}
+}
+
+func runRemediation(rc RemediationConfig, attempt, max int, host string) {
+	timeout := time.Duration(rc.Timeout) * time.Second
+	if timeout <= 0 { timeout = 60 * time.Second }
+	r := runScript(ScriptConfig{Command: rc.Command}, timeout)
+	var parts []string
+	for _, s := range []string{r.Output, r.LongOutput, r.Stderr} { if s != "" { parts = append(parts, s) } }
+	out := strings.Join(parts, "\n")
+	outcome := "succeeded"
+	if r.ExitCode != 0 { outcome = fmt.Sprintf("failed (exit %d)", r.ExitCode) }
+	recordAlert(AlertEvent{Monitor: rc.Monitor, Level: "REMEDIATION", Host: host, Remediation: out,
+		Message: fmt.Sprintf("Ran %q (attempt %d/%d): %s", rc.Command, attempt, max, outcome)})
+	auditLog("remediation", map[string]interface{}{"monitor": rc.Monitor, "command": rc.Command, "attempt": attempt,
+		"exit_code": r.ExitCode, "duration": r.Duration, "output": out})
+	remediationMutex.Lock()
+	if st := remediations[rc.Monitor]; st != nil { st.running = false }
+	remediationMutex.Unlock()
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/base64"
+	"fmt"
+	htmltpl "html/template"
+	"image"
+	"image/png"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// --- SLA REPORTS ---
+// GET /api/v1/reports sums up a stretch of history for SLA reporting: how much of the time each
+// objective held, p50/p95/p99 of the chosen metrics, and the incidents that broke an objective.
+// The objectives are CPU, memory and disk below cpu_crit, mem_crit and dsk_crit, load per core below
+// load_crit (those set), and every check not CRITICAL or UNKNOWN; level=warning holds them to the
+// warn thresholds and OK instead. Availability is of the time with data: a sample counts until the
+// next one, and a gap of more than reportGap seconds (Pulse not running) counts for neither side.
+// month=2026-09 reports a calendar month, start and end any range (Default: the last 30 days);
+// format=html is a printable page and format=pdf a PDF, both headed with sla_target (Default: 99.9)
+// and with charts of the period.
+
+const (
+	reportGap          = 300
+	maxReportIncidents = 200
+)
+
+var reportDefault = []string{"cpu_tot", "mem_used", "swp_used", "dsk_used", "load1", "net_down", "net_up", "dsk_read", "dsk_writ"}
+
+// reportCharts are drawn in HTML and PDF reports, one chart per list.
+var reportCharts = [][]string{{"cpu_tot", "mem_used"}, {"dsk_used"}, {"net_down", "net_up"}}
+
+type Availability struct {
+	Name      string  `json:"name"`
+	Up        float64 `json:"up_pct"`   // of the time with data
+	Covered   int64   `json:"covered"`  // seconds with data
+	Downtime  int64   `json:"downtime"` // seconds
+	Incidents int     `json:"incidents"`
+	Met       bool    `json:"met"` // up_pct reached the target
+}
+
+type MetricReport struct {
+	Field string  `json:"field"`
+	Label string  `json:"label"`
+	Unit  string  `json:"unit,omitempty"`
+	N     int     `json:"n"`
+	Min   float64 `json:"min"`
+	Avg   float64 `json:"avg"`
+	P50   float64 `json:"p50"`
+	P95   float64 `json:"p95"`
+	P99   float64 `json:"p99"`
+	Max   float64 `json:"max"`
+	info  MetricInfo
+}
+
+type ReportIncident struct {
+	Name     string `json:"name"`
+	Level    string `json:"level"` // the worst it got
+	Start    int64  `json:"start"`
+	End      int64  `json:"end"`
+	Duration int64  `json:"duration"`
+	Open     bool   `json:"open,omitempty"` // still going at the end of the period
+}
+
+type Report struct {
+	Host         string           `json:"host"`
+	From         int64            `json:"from"`
+	To           int64            `json:"to"`
+	Samples      int              `json:"samples"`
+	Covered      int64            `json:"covered"` // seconds with data
+	Target       float64          `json:"target"`
+	Level        string           `json:"level"`
+	Availability []Availability   `json:"availability"`
+	Metrics      []MetricReport   `json:"metrics"`
+	Incidents    []ReportIncident `json:"incidents"`
+	Charts       []ReportChart    `json:"-"`
+}
+
+type ReportChart struct {
+	Title string
+	img   *image.RGBA
+}
+
+// reportObjective follows one objective through the samples.
+type reportObjective struct {
+	Availability
+	cur  *ReportIncident
+	list []ReportIncident
+}
+
+func (o *reportObjective) add(ts, secs int64, level string) {
+	o.Covered += secs
+	if level == "" {
+		if o.cur != nil { o.cur.End = ts; o.list = append(o.list, *o.cur); o.cur = nil }
+		return
+	}
+	o.Downtime += secs
+	if o.cur == nil { o.cur = &ReportIncident{Name: o.Name, Level: level, Start: ts}; o.Incidents++ }
+	if level == "CRITICAL" { o.cur.Level = level }
+	o.cur.End = ts + secs
+}
+
+// thresholdLevel says how far over its thresholds v is: "", WARNING or CRITICAL.
+func thresholdLevel(v, warn, crit float64, strict bool) string {
+	if crit > 0 && v >= crit { return "CRITICAL" }
+	if strict && warn > 0 && v >= warn { return "WARNING" }
+	return ""
+}
+
+// checkLevel says whether a check result breaks its objective: "", or the level it failed with.
+func checkLevel(p PluginData, strict bool) string {
+	if p.ExitCode == 0 || (!strict && p.ExitCode == 1) { return "" }
+	if p.ExitCode > 0 && p.ExitCode < len(statusNames) { return statusNames[p.ExitCode] }
+	return "UNKNOWN"
+}
+
+func percentile(sorted []float64, p int) float64 { return sorted[(len(sorted)*p+99)/100-1] } // nearest rank
+
+func buildReport(cfg AppConfig, from, to int64, fields []string, strict bool, target float64) (Report, error) {
+	rep := Report{From: from, To: to, Target: target, Level: "critical", Availability: []Availability{}, Metrics: []MetricReport{}, Incidents: []ReportIncident{}}
+	if strict { rep.Level = "warning" }
+	type threshold struct {
+		name       string
+		field      string
+		warn, crit float64
+	}
+	var limits []threshold
+	for _, t := range []threshold{{"CPU", "cpu_tot", cfg.CpuWarn, cfg.CpuCrit}, {"Memory", "mem_used", cfg.MemWarn, cfg.MemCrit},
+		{"Disk", "dsk_used", cfg.DskWarn, cfg.DskCrit}, {"Load", "load_core", cfg.LoadWarn, cfg.LoadCrit}} {
+		if t.crit > 0 || (strict && t.warn > 0) { limits = append(limits, t) }
+	}
+	objs := map[string]*reportObjective{}
+	var order []string
+	obj := func(name string) *reportObjective {
+		o := objs[name]
+		if o == nil { o = &reportObjective{Availability: Availability{Name: name}}; objs[name] = o; order = append(order, name) }
+		return o
+	}
+
+	historyMutex.RLock()
+	lo, hi := history.Search(from), history.Search(to+1)
+	hi = max(hi, lo)
+	a, b := history.Segments(lo, hi)
+	cols, err := exportColumns(fields, a, b)
+	if err != nil { historyMutex.RUnlock(); return rep, err }
+	vals := make([][]float64, len(cols))
+	var last *RichMetrics
+	for i := lo; i < hi; i++ {
+		m := history.At(i)
+		next := to
+		if i+1 < hi { next = history.At(i + 1).Timestamp }
+		secs := min(next-m.Timestamp, reportGap)
+		rep.Samples++
+		rep.Covered += secs
+		for _, t := range limits { obj(t.name).add(m.Timestamp, secs, thresholdLevel(exportFields[t.field](*m), t.warn, t.crit, strict)) }
+		for _, p := range m.Plugins { obj("Check "+pluginID(p)).add(m.Timestamp, secs, checkLevel(p, strict)) }
+		for c, col := range cols {
+			if v, ok := col.get(*m); ok { vals[c] = append(vals[c], v) }
+		}
+		last = m
+	}
+	if last != nil { rep.Host = last.Hostname }
+	historyMutex.RUnlock()
+
+	for _, name := range order {
+		o := objs[name]
+		if o.cur != nil { o.cur.Open = true; o.list = append(o.list, *o.cur) }
+		if o.Covered > 0 { o.Up = 100 * float64(o.Covered-o.Downtime) / float64(o.Covered) }
+		o.Met = o.Up >= target
+		rep.Availability = append(rep.Availability, o.Availability)
+		rep.Incidents = append(rep.Incidents, o.list...)
+	}
+	sort.Slice(rep.Incidents, func(i, j int) bool { return rep.Incidents[i].Start < rep.Incidents[j].Start })
+	for i := range rep.Incidents { rep.Incidents[i].Duration = rep.Incidents[i].End - rep.Incidents[i].Start }
+	if len(rep.Incidents) > maxReportIncidents { rep.Incidents = rep.Incidents[len(rep.Incidents)-maxReportIncidents:] }
+
+	sample := latestSample()
+	if last != nil { sample = *last }
+	for c, col := range cols {
+		v := vals[c]
+		if len(v) == 0 { continue }
+		slices.Sort(v)
+		sum := 0.0
+		for _, x := range v { sum += x }
+		info := describeMetric(cfg, col.name, sample)
+		rep.Metrics = append(rep.Metrics, MetricReport{col.name, info.Label, info.Unit, len(v), v[0], sum / float64(len(v)),
+			percentile(v, 50), percentile(v, 95), percentile(v, 99), v[len(v)-1], info})
+	}
+	return rep, nil
+}
+
+// reportRange reads month=YYYY-MM or start and end; the default is the last 30 days.
+func reportRange(q map[string][]string) (from, to int64, err error) {
+	get := func(k string) string { if v := q[k]; len(v) > 0 { return v[0] }; return "" }
+	if mo := get("month"); mo != "" {
+		t, err := time.ParseInLocation("2006-01", mo, time.Local)
+		if err != nil { return 0, 0, fmt.Errorf("month must be YYYY-MM") }
+		return t.Unix(), min(t.AddDate(0, 1, 0).Unix()-1, time.Now().Unix()), nil
+	}
+	now := time.Now().Unix()
+	to, ok2 := parseTimeParam(get("end"), now)
+	from, ok1 := parseTimeParam(get("start"), to-30*86400)
+	if !ok1 || !ok2 { return 0, 0, fmt.Errorf("start and end must be unix seconds or RFC 3339") }
+	if from > to { return 0, 0, fmt.Errorf("start is after end") }
+	return from, min(to, now), nil
+}
+
+// fmtSeconds is a duration for people: "2d 3h", "4h 12m", "35s".
+func fmtSeconds(s int64) string {
+	switch {
+	case s >= 86400: return fmt.Sprintf("%dd %dh", s/86400, s%86400/3600)
+	case s >= 3600: return fmt.Sprintf("%dh %dm", s/3600, s%3600/60)
+	case s >= 60: return fmt.Sprintf("%dm %ds", s/60, s%60)
+	}
+	return fmt.Sprintf("%ds", s)
+}
+
+func fmtPct(v float64) string { return strconv.FormatFloat(v, 'f', 3, 64) + "%" }
+
+var reportTemplate = htmltpl.Must(htmltpl.New("report").Funcs(htmltpl.FuncMap{
+	"date": func(ts int64) string { return time.Unix(ts, 0).Format("2006-01-02 15:04") },
+	"dur":  fmtSeconds,
+	"pct":  fmtPct,
+	"val":  func(m MetricReport, v float64) string { return m.info.format(v) },
+	"png":  func(c ReportChart) htmltpl.URL {
+		var b bytes.Buffer
+		png.Encode(&b, c.img)
+		return htmltpl.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(b.Bytes()))
+	},
+}).Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>SLA report: {{.Host}}</title>
+<style>body{font-family:Segoe UI,Arial,sans-serif;font-size:13px;color:#222;margin:30px;}table{border-collapse:collapse;margin-bottom:18px;}
+th,td{border:1px solid #ddd;padding:4px 8px;}th{background:#f4f4f4;text-align:left;}td.n{text-align:right;}.bad{color:#c00;}.ok{color:#080;}h3{margin-bottom:6px;}</style></head>
+<body><h2 style="margin:0;">SLA report: {{.Host}}</h2>
+<p style="color:#666;margin:4px 0 12px;">{{date .From}} to {{date .To}}, {{.Samples}} samples covering {{dur .Covered}}; target {{pct .Target}}, objectives held to {{.Level}} level</p>
+{{range .Charts}}<p style="margin:10px 0 2px;color:#666;">{{.Title}}</p><img src="{{png .}}" width="700" height="180" alt="{{.Title}}">
+{{end}}<h3>Availability</h3>
+{{if .Availability}}<table><tr><th>Objective</th><th>Available</th><th>Downtime</th><th>Incidents</th><th>Target</th></tr>
+{{range .Availability}}<tr><td>{{.Name}}</td><td class="n">{{pct .Up}}</td><td class="n">{{dur .Downtime}}</td><td class="n">{{.Incidents}}</td><td class="{{if .Met}}ok{{else}}bad{{end}}">{{if .Met}}met{{else}}missed{{end}}</td></tr>
+{{end}}</table>{{else}}<p>No thresholds or checks to report on.</p>{{end}}
+<h3>Metrics</h3>
+{{if .Metrics}}<table><tr><th>Metric</th><th>Min</th><th>Avg</th><th>p50</th><th>p95</th><th>p99</th><th>Max</th></tr>
+{{range .Metrics}}<tr><td>{{.Label}}</td><td class="n">{{val . .Min}}</td><td class="n">{{val . .Avg}}</td><td class="n">{{val . .P50}}</td><td class="n">{{val . .P95}}</td><td class="n">{{val . .P99}}</td><td class="n">{{val . .Max}}</td></tr>
+{{end}}</table>{{else}}<p>No samples in this period.</p>{{end}}
+<h3>Incidents</h3>
+{{if .Incidents}}<table><tr><th>Start</th><th>End</th><th>Duration</th><th>Objective</th><th>Level</th></tr>
+{{range .Incidents}}<tr><td>{{date .Start}}</td><td>{{if .Open}}ongoing{{else}}{{date .End}}{{end}}</td><td class="n">{{dur .Duration}}</td><td>{{.Name}}</td><td>{{.Level}}</td></tr>
+{{end}}</table>{{else}}<p>None.</p>{{end}}
+</body></html>`))
+
+func reportPDF(rep Report) *pdfDoc {
+	d := newPDF()
+	date := func(ts int64) string { return time.Unix(ts, 0).Format("2006-01-02 15:04") }
+	d.y += 14
+	d.text(pdfMargin, d.y, 16, true, 0, "SLA report: "+rep.Host)
+	d.y += 16
+	d.text(pdfMargin, d.y, 9, false, 0.4, fmt.Sprintf("%s to %s, %d samples covering %s; target %s, objectives held to %s level",
+		date(rep.From), date(rep.To), rep.Samples, fmtSeconds(rep.Covered), fmtPct(rep.Target), rep.Level))
+	for _, c := range rep.Charts {
+		d.need(150)
+		d.y += 12
+		d.image(pdfMargin, d.y, pdfW-2*pdfMargin, (pdfW-2*pdfMargin)*180/700, c.img)
+		d.y += (pdfW - 2*pdfMargin) * 180 / 700
+	}
+	table := func(title string, xs []float64, head []string, rows [][]string) {
+		d.need(50)
+		d.y += 24
+		d.text(pdfMargin, d.y, 12, true, 0, title)
+		if len(rows) == 0 { d.row(xs, []string{"None."}, 9, false); return }
+		heading := func() { d.y += 4; d.box(pdfMargin-3, d.y, pdfW-2*pdfMargin+6, 15, 0.93); d.row(xs, head, 9, true) }
+		heading()
+		for _, r := range rows {
+			if d.y+13 > pdfH-pdfMargin { d.newPage(); heading() } // the head again on each page
+			d.row(xs, r, 9, false)
+			d.line(pdfMargin-3, d.y+3, pdfW-pdfMargin+3, d.y+3, 0.85)
+		}
+	}
+	cut := func(s string, n int) string { if len(s) > n { return s[:n-1] + "..." }; return s }
+	var rows [][]string
+	for _, a := range rep.Availability {
+		met := "missed"
+		if a.Met { met = "met" }
+		rows = append(rows, []string{cut(a.Name, 40), fmtPct(a.Up), fmtSeconds(a.Downtime), strconv.Itoa(a.Incidents), met})
+	}
+	table("Availability", []float64{40, 250, 330, 410, 470}, []string{"Objective", "Available", "Downtime", "Incidents", "Target"}, rows)
+	rows = nil
+	for _, m := range rep.Metrics {
+		rows = append(rows, []string{cut(m.Label, 30), m.info.format(m.Min), m.info.format(m.Avg), m.info.format(m.P50), m.info.format(m.P95), m.info.format(m.P99), m.info.format(m.Max)})
+	}
+	table("Metrics", []float64{40, 190, 250, 310, 370, 430, 490}, []string{"Metric", "Min", "Avg", "p50", "p95", "p99", "Max"}, rows)
+	rows = nil
+	for _, in := range rep.Incidents {
+		end := date(in.End)
+		if in.Open { end = "ongoing" }
+		rows = append(rows, []string{date(in.Start), end, fmtSeconds(in.Duration), cut(in.Name, 34), in.Level})
+	}
+	table("Incidents", []float64{40, 125, 210, 270, 480}, []string{"Start", "End", "Duration", "Objective", "Level"}, rows)
+	return d
+}
+
+func registerReportAPI(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/v1/reports", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		bad := func(msg string) { apiFail(w, http.StatusBadRequest, apiError{"bad_request", msg, nil}) }
+		from, to, err := reportRange(q)
+		if err != nil { bad(err.Error()); return }
+		format := cmp.Or(q.Get("format"), "json")
+		if format != "json" && format != "html" && format != "pdf" { bad("format must be json, html or pdf"); return }
+		level := cmp.Or(q.Get("level"), "critical")
+		if level != "critical" && level != "warning" { bad("level must be critical or warning"); return }
+		cfgMutex.RLock(); cfg := config; cfgMutex.RUnlock()
+		target := cmp.Or(cfg.SLATarget, 99.9)
+		if v := q.Get("target"); v != "" {
+			if target, err = strconv.ParseFloat(v, 64); err != nil || target <= 0 || target > 100 { bad("target must be a percentage above 0"); return }
+		}
+		fields := reportDefault
+		if f := q.Get("metrics"); f != "" { fields = strings.Split(f, ",") }
+		rep, err := buildReport(cfg, from, to, fields, level == "warning", target)
+		if err != nil { bad(err.Error()); return }
+		if format != "json" {
+			for _, fs := range reportCharts {
+				var series []chartSeries
+				for _, f := range fs { if s, err := chartField(cfg, f); err == nil { series = append(series, s) } }
+				rep.Charts = append(rep.Charts, ReportChart{chartTitle(series), renderChart(series, chartTitle(series), from, to, 700, 180)})
+			}
+		}
+		switch format {
+		case "html":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			reportTemplate.Execute(w, rep)
+		case "pdf":
+			host := cmp.Or(rep.Host, "pulse")
+			w.Header().Set("Content-Type", "application/pdf")
+			w.Header().Set("Content-Disposition", `attachment; filename="pulse-report-`+host+"-"+time.Unix(from, 0).Format("20060102")+`.pdf"`)
+			reportPDF(rep).WriteTo(w)
+		default:
+			apiOK(w, 200, rep, nil)
+		}
+	})
+}
+
+func validateReports(c AppConfig, bad func(field, format string, a ...interface{})) {
+	if c.SLATarget < 0 || c.SLATarget > 100 { bad("sla_target", "must be a percentage (0 for the default 99.9)") }
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// --- CONFIG REVISIONS ---
+// Every config change (Settings, API, edits to pulse.conf, rollbacks) is appended to
+// pulse.conf.history as a JSON line with who made it. Secrets stay encrypted in the file and
+// users are not part of a revision, so a rollback never changes who can log in.
+
+const maxRevisions = 100
+
+type ConfigRevision struct {
+	ID     int             `json:"id"`
+	Time   int64           `json:"time"`
+	User   string          `json:"user,omitempty"`
+	Source string          `json:"source"`
+	Config json.RawMessage `json:"config,omitempty"`
+}
+
+type configChange struct {
+	Key  string          `json:"key"`
+	From json.RawMessage `json:"from"`
+	To   json.RawMessage `json:"to"`
+}
+
+type revisionSummary struct {
+	ConfigRevision
+	Changes []configChange `json:"changes"`
+}
+
+var (
+	revisions     []ConfigRevision
+	revisionsRead bool
+	revisionMutex sync.Mutex
+)
+
+func revisionFile() string { return confFile + ".history" }
+
+func readRevisions() {
+	if revisionsRead { return }
+	revisionsRead = true
+	f, err := os.Open(revisionFile())
+	if err != nil { return }
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 1<<20), 16<<20)
+	for sc.Scan() {
+		var r ConfigRevision
+		if json.Unmarshal(sc.Bytes(), &r) == nil { revisions = append(revisions, r) }
+	}
+}
+
+func decodeRevision(r ConfigRevision) AppConfig {
+	var c AppConfig
+	json.Unmarshal(r.Config, &c)
+	openSecrets(&c)
+	return c
+}
+
+// recordRevision stores c as a new revision unless it equals the latest one.
+func recordRevision(c AppConfig, user, source string) {
+	revisionMutex.Lock(); defer revisionMutex.Unlock()
+	readRevisions()
+	c.Users = nil
+	if n := len(revisions); n > 0 && len(configDiff(decodeRevision(revisions[n-1]), c)) == 0 { return }
+	sealSecrets(&c)
+	raw, _ := json.Marshal(c)
+	r := ConfigRevision{ID: 1, Time: time.Now().Unix(), User: user, Source: source, Config: raw}
+	if n := len(revisions); n > 0 { r.ID = revisions[n-1].ID + 1 }
+	revisions = append(revisions, r)
+	if len(revisions) > maxRevisions {
+		revisions = revisions[len(revisions)-maxRevisions:]
+		var b bytes.Buffer
+		for _, rv := range revisions { line, _ := json.Marshal(rv); b.Write(append(line, '\n')) }
+		if err := os.WriteFile(revisionFile(), b.Bytes(), 0600); err != nil { configLog.Error("cannot write revisions", "err", err) }
+		return
+	}
+	f, err := os.OpenFile(revisionFile(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil { configLog.Error("cannot write revisions", "err", err); return }
+	defer f.Close()
+	json.NewEncoder(f).Encode(r)
+}
+
+func configMap(c AppConfig) map[string]json.RawMessage {
+	b, _ := json.Marshal(c)
+	var m map[string]json.RawMessage
+	json.Unmarshal(b, &m)
+	return m
+}
+
+// configDiff lists the top-level keys that differ, with secrets shown masked.
+func configDiff(a, b AppConfig) []configChange {
+	a.Users, b.Users = nil, nil
+	am, bm := configMap(a), configMap(b)
+	ar, br := configMap(redactConfig(a)), configMap(redactConfig(b))
+	var out []configChange
+	for k := range bm {
+		if !bytes.Equal(am[k], bm[k]) { out = append(out, configChange{k, ar[k], br[k]}) }
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return out
+}
+
+// listRevisions returns revisions newest first, each with its changes against the one before.
+func listRevisions() []revisionSummary {
+	revisionMutex.Lock(); defer revisionMutex.Unlock()
+	readRevisions()
+	out := []revisionSummary{}
+	var prev *AppConfig
+	for _, r := range revisions {
+		c := decodeRevision(r)
+		s := revisionSummary{ConfigRevision: r}
+		s.Config = nil
+		if prev != nil { s.Changes = configDiff(*prev, c) }
+		prev = &c
+		out = append([]revisionSummary{s}, out...)
+	}
+	return out
+}
+
+// rollbackConfig makes revision id the running config again and records that as a new revision.
+func rollbackConfig(id int, user string) error {
+	revisionMutex.Lock()
+	readRevisions()
+	var c *AppConfig
+	for _, r := range revisions { if r.ID == id { rc := decodeRevision(r); c = &rc } }
+	revisionMutex.Unlock()
+	if c == nil { return fmt.Errorf("no revision %d", id) }
+	applyOverrides(c)
+	if errs := validateConfig(*c); len(errs) > 0 { return fmt.Errorf("revision %d is not valid any more: %s: %s", id, errs[0].Field, errs[0].Message) }
+	cfgMutex.Lock(); c.Users = config.Users; old := config; config = *c; cfgMutex.Unlock()
+	if err := saveConfig(); err != nil {
+		cfgMutex.Lock(); config = old; cfgMutex.Unlock()
+		return fmt.Errorf("cannot save %s: %w", confFile, err)
+	}
+	recordRevision(*c, user, fmt.Sprintf("rollback to #%d", id))
+	kickFederation()
+	auditLog("config_rollback", map[string]interface{}{"revision": id, "user": user, "changes": configDiff(old, *c)})
+	return nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import "sort"
+
+// --- HISTORY RING ---
+// history is a circular buffer: its slots are allocated once, sized for the retention at the
+// current update rate, and each new sample overwrites the oldest slot instead of appending, so
+// memory stays flat and nothing is copied as samples come and go. Dropped slots are zeroed so
+// their process lists and plugin output can be freed. Index 0 is always the oldest sample; callers
+// hold historyMutex, and pointers from At are only valid until it is released.
+
+type sampleRing struct {
+	buf   []RichMetrics
+	start int // slot of the oldest sample
+	n     int
+}
+
+// ringSlack covers samples arriving a little faster than global_int, so age trims first.
+const ringSlack = 1.1
+
+// historyCapacity is how many samples the retention needs at the current update rate.
+func historyCapacity() int {
+	cfgMutex.RLock(); every := config.GlobalInt; cfgMutex.RUnlock()
+	if every <= 0 { every = 1 }
+	return max(int(float64(retentionSeconds()/int64(every))*ringSlack), 60)
+}
+
+func (r *sampleRing) Len() int { return r.n }
+
+func (r *sampleRing) Cap() int { return len(r.buf) }
+
+func (r *sampleRing) slot(i int) int { return (r.start + i) % len(r.buf) }
+
+// At returns the i-th oldest sample.
+func (r *sampleRing) At(i int) *RichMetrics { return &r.buf[r.slot(i)] }
+
+func (r *sampleRing) Last() (RichMetrics, bool) {
+	if r.n == 0 { return RichMetrics{}, false }
+	return *r.At(r.n - 1), true
+}
+
+// Push stores m as the newest sample, overwriting the oldest when full.
+func (r *sampleRing) Push(m RichMetrics) {
+	if len(r.buf) == 0 { return }
+	if r.n < len(r.buf) { r.buf[r.slot(r.n)] = m; r.n++; return }
+	r.buf[r.start] = m
+	r.start = (r.start + 1) % len(r.buf)
+}
+
+// DropBefore removes samples older than ts and returns how many went.
+func (r *sampleRing) DropBefore(ts int64) int {
+	k := r.Search(ts)
+	for i := 0; i < k; i++ { *r.At(i) = RichMetrics{} }
+	r.start, r.n = r.slot(k), r.n-k
+	return k
+}
+
+// Search returns the index of the first sample at or after ts (Len if none).
+func (r *sampleRing) Search(ts int64) int { return sort.Search(r.n, func(i int) bool { return r.At(i).Timestamp >= ts }) }
+
+// AppendRange appends samples lo..hi-1 to dst, which lets a caller reuse its buffer.
+func (r *sampleRing) AppendRange(dst []RichMetrics, lo, hi int) []RichMetrics {
+	for i := lo; i < hi; i++ { dst = append(dst, *r.At(i)) }
+	return dst
+}
+
+func (r *sampleRing) Copy(lo, hi int) []RichMetrics { return r.AppendRange(make([]RichMetrics, 0, max(hi-lo, 0)), lo, hi) }
+
+// Segments returns samples lo..hi-1 as at most two slices of the buffer itself, oldest first.
+func (r *sampleRing) Segments(lo, hi int) ([]RichMetrics, []RichMetrics) {
+	if hi <= lo { return nil, nil }
+	s, e := r.slot(lo), r.slot(hi-1)+1
+	if s < e { return r.buf[s:e], nil }
+	return r.buf[s:], r.buf[:e]
+}
+
+// Resize moves the newest samples that fit into a buffer of the given capacity.
+func (r *sampleRing) Resize(capacity int) {
+	keep := min(r.n, capacity)
+	buf := make([]RichMetrics, capacity)
+	for i := 0; i < keep; i++ { buf[i] = *r.At(r.n - keep + i) }
+	r.buf, r.start, r.n = buf, 0, keep
+}
+
+// Load replaces the contents with list (oldest first), keeping the newest that fit.
+func (r *sampleRing) Load(list []RichMetrics) {
+	clear(r.buf)
+	r.start, r.n = 0, 0
+	for _, m := range list[max(len(list)-len(r.buf), 0):] { r.Push(m) }
+}
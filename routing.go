@@ -0,0 +1,112 @@
+package main
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- ROUTING RULES ---
+// Rules are checked in order; the first match decides where an event goes unless it sets Continue.
+// A rule can override a channel's recipients so each team gets its own inbox, chat or topic.
+// Events no rule matches fall back to severity_channels and the global settings.
+
+type RouteRule struct {
+	Name     string   `json:"name,omitempty"`
+	Monitor  string   `json:"monitor,omitempty"`
+	Host     string   `json:"host,omitempty"`
+	Tags     []string `json:"tags,omitempty"`   // all of them in host_meta.tags
+	Env      string   `json:"env,omitempty"`    // pattern for host_meta.environment
+	Groups   []string `json:"groups,omitempty"` // host groups of the sites "Site <name> ..." alerts are about
+	Levels   []string `json:"levels,omitempty"`
+	Days     []string `json:"days,omitempty"`
+	From     string   `json:"from,omitempty"`
+	To       string   `json:"to,omitempty"`
+	Channels []string `json:"channels"`
+	Continue bool     `json:"continue,omitempty"`
+
+	EmailTo         string   `json:"email_to,omitempty"`
+	TelegramChatIDs []string `json:"telegram_chat_ids,omitempty"`
+	TeamsWebhook    string   `json:"teams_webhook,omitempty"`
+	GChatWebhook    string   `json:"gchat_webhook,omitempty"`
+	TwilioTo        []string `json:"twilio_to,omitempty"`
+	NtfyTopic       string   `json:"ntfy_topic,omitempty"`
+}
+
+var (
+	patternCache = map[string]*regexp.Regexp{} // anchored patterns by source; nil for one that doesn't compile
+	patternMutex sync.Mutex
+)
+
+// anchoredPattern compiles p as an anchored regex the first time it is used; nil if it doesn't compile.
+func anchoredPattern(p string) *regexp.Regexp {
+	patternMutex.Lock(); defer patternMutex.Unlock()
+	re, ok := patternCache[p]
+	if !ok { re, _ = regexp.Compile("^(?:" + p + ")$"); patternCache[p] = re }
+	return re
+}
+
+// matchPattern treats p as an anchored regex; an empty pattern matches everything.
+func matchPattern(p, s string) bool {
+	if p == "" { return true }
+	re := anchoredPattern(p)
+	return re != nil && re.MatchString(s)
+}
+
+// inWindow checks the rule's days and HH:MM range; From after To wraps past midnight.
+func (r RouteRule) inWindow(t time.Time) bool {
+	if len(r.Days) > 0 {
+		day, ok := strings.ToLower(t.Weekday().String()[:3]), false
+		for _, d := range r.Days { if strings.HasPrefix(strings.ToLower(d), day) { ok = true } }
+		if !ok { return false }
+	}
+	if r.From == "" && r.To == "" { return true }
+	now := t.Format("15:04")
+	from, to := r.From, r.To
+	if from == "" { from = "00:00" }
+	if to == "" { to = "24:00" }
+	if from <= to { return now >= from && now < to }
+	return now >= from || now < to
+}
+
+func (r RouteRule) matches(ev AlertEvent, meta HostMeta, t time.Time) bool {
+	if len(r.Levels) > 0 {
+		ok := false
+		for _, l := range r.Levels { if strings.EqualFold(l, ev.Level) { ok = true } }
+		if !ok { return false }
+	}
+	for _, tag := range r.Tags { if !slices.Contains(meta.Tags, tag) { return false } }
+	if len(r.Groups) > 0 && !slices.Contains(r.Groups, siteGroup(ev.Monitor)) { return false }
+	return matchPattern(r.Monitor, ev.Monitor) && matchPattern(r.Host, ev.Host) && matchPattern(r.Env, meta.Environment) && r.inWindow(t)
+}
+
+// apply returns cfg with this rule's recipient overrides.
+func (r RouteRule) apply(cfg AppConfig) AppConfig {
+	if r.EmailTo != "" { cfg.EmailTo = r.EmailTo }
+	if len(r.TelegramChatIDs) > 0 { cfg.TelegramChatIDs = r.TelegramChatIDs }
+	if r.TeamsWebhook != "" { cfg.TeamsWebhook = r.TeamsWebhook }
+	if r.GChatWebhook != "" { cfg.GChatWebhook = r.GChatWebhook }
+	if len(r.TwilioTo) > 0 { cfg.TwilioTo = r.TwilioTo }
+	if r.NtfyTopic != "" { cfg.NtfyTopic = r.NtfyTopic }
+	return cfg
+}
+
+type delivery struct {
+	channel string
+	cfg     AppConfig
+}
+
+// routeAlert resolves an event to channel deliveries; matched is false when no rule applied.
+func routeAlert(cfg AppConfig, ev AlertEvent) (out []delivery, matched bool) {
+	t := time.Unix(ev.Time, 0)
+	if ev.Time == 0 { t = time.Now() }
+	for _, r := range cfg.Routes {
+		if !r.matches(ev, cfg.HostMeta, t) { continue }
+		matched = true
+		for _, c := range r.Channels { out = append(out, delivery{c, r.apply(cfg)}) }
+		if !r.Continue { break }
+	}
+	return out, matched
+}
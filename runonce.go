@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- RUN ONCE ---
+// "pulse check" collects one sample (host metrics, processes and every custom monitor), evaluates
+// the thresholds from pulse.conf, prints the result and exits 0/1/2/3 like a Nagios plugin, so cron,
+// NRPE or another scheduler can run Pulse itself. "for" delays don't apply to a single pass, and
+// nothing is stored or sent. --json prints the checks and the full sample instead of one line.
+
+type checkReport struct {
+	Status   string         `json:"status"`
+	ExitCode int            `json:"exit_code"`
+	Checks   []checkOutcome `json:"checks"`
+	Sample   RichMetrics    `json:"sample"`
+}
+
+type checkOutcome struct {
+	Name   string   `json:"name"`
+	Status string   `json:"status"`
+	Output string   `json:"output,omitempty"`
+	Perf   []string `json:"perf,omitempty"`
+}
+
+func runCheck(args []string) int {
+	fs := flag.NewFlagSet("pulse check", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "print the checks and the sample as JSON")
+	if err := fs.Parse(args); err != nil { if err == flag.ErrHelp { return 0 }; return 3 }
+	observeOnly = true
+	loadConfig()
+	cfgMutex.Lock()
+	cfg := &config
+	cfg.CpuFor, cfg.MemFor, cfg.DskFor, cfg.LoadFor = 0, 0, 0, 0
+	cfg.Scripts = append([]ScriptConfig(nil), cfg.Scripts...)
+	for i := range cfg.Scripts { cfg.Scripts[i].For = 0 }
+	c := *cfg
+	cfgMutex.Unlock()
+	// Stdout is for the result; warnings go to stderr unless a log file is configured.
+	if c.LogFile == "" { logState.Lock(); logState.handler = slog.NewTextHandler(os.Stderr, nil); logState.level, logState.levels = slog.LevelWarn, nil; logState.Unlock() }
+
+	// CPU and I/O figures are rates, so take a first reading and measure over one second.
+	collectProcesses(); collectGlobal()
+	start := time.Now()
+	var wg sync.WaitGroup
+	for _, s := range c.Scripts {
+		to := s.Timeout
+		if to <= 0 { to = c.ScriptTimeout }
+		wg.Add(1)
+		go func() { defer wg.Done(); collectScript(s, time.Duration(to)*time.Second) }()
+	}
+	wg.Wait()
+	time.Sleep(time.Second - time.Since(start))
+	collectProcesses(); collectGlobal()
+	m := latestSample()
+
+	rep := checkReport{Sample: m}
+	seen := map[string]bool{}
+	for _, r := range passiveResults(c, m) {
+		seen[r.Service] = true
+		rep.Checks = append(rep.Checks, checkOutcome{r.Service, statusNames[r.Code], r.Output, r.Perf})
+		rep.ExitCode = worseCode(rep.ExitCode, r.Code)
+	}
+	// Perfdata thresholds, rate rules and the like alert under their own names.
+	for _, a := range currentAlerts(c) {
+		if seen[a.Monitor] { continue }
+		code := 1
+		if a.Level == "CRITICAL" { code = 2 }
+		rep.Checks = append(rep.Checks, checkOutcome{Name: a.Monitor, Status: a.Level})
+		rep.ExitCode = worseCode(rep.ExitCode, code)
+	}
+	rep.Status = statusNames[rep.ExitCode]
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout); enc.SetIndent("", "  "); enc.Encode(rep)
+		return rep.ExitCode
+	}
+	var bad, perf []string
+	for _, ch := range rep.Checks {
+		if ch.Status != "OK" { bad = append(bad, ch.Status+" "+ch.Name) }
+		perf = append(perf, ch.Perf...)
+	}
+	summary := fmt.Sprintf("cpu %.1f%%, mem %.1f%%, disk %.1f%%, load %.2f", m.CPUTotal, m.MemUsed, m.DiskUsed, m.Load1)
+	if len(bad) > 0 { summary = strings.Join(bad, ", ") + " - " + summary }
+	fmt.Printf("PULSE %s - %s | %s\n", rep.Status, summary, strings.Join(perf, " "))
+	return rep.ExitCode
+}
+
+// worseCode orders Nagios codes OK < UNKNOWN < WARNING < CRITICAL.
+func worseCode(a, b int) int {
+	rank := []int{0, 2, 3, 1}
+	if rank[b] > rank[a] { return b }
+	return a
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// --- CRON JOB RESULTS ---
+// "pulse run --name backup -- <command>" runs a command (from cron, a systemd timer, CI), passes
+// its output through and exits with its code, and reports how it went to POST /api/v1/checks/{name}.
+// Each job then shows up next to the custom monitors as "run <name>": OK when the command exited
+// 0, CRITICAL otherwise, with its duration and any perfdata on the last output line graphed, and
+// with --every also CRITICAL once a run is overdue. The results are kept in pulse.runs.json.
+
+type runReport struct {
+	ExitCode int     `json:"exit_code"`
+	Duration float64 `json:"duration"`          // seconds
+	Output   string  `json:"output,omitempty"`  // the end of the output
+	Perf     string  `json:"perf,omitempty"`    // Nagios perfdata, e.g. "rows=120 size=3MB"
+	Every    int     `json:"every,omitempty"`   // seconds between runs; late after that plus 10%
+	TimedOut bool    `json:"timed_out,omitempty"`
+}
+
+type runResult struct {
+	runReport
+	At int64 `json:"at"`
+}
+
+var runsFile = "pulse.runs.json"
+
+var runName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,99}$`)
+
+var (
+	runsMutex  sync.Mutex
+	runResults map[string]runResult
+)
+
+func loadRuns() {
+	if runResults != nil { return }
+	runResults = map[string]runResult{}
+	if b, err := os.ReadFile(runsFile); err == nil {
+		if err := json.Unmarshal(b, &runResults); err != nil { storageLog.Error("cannot read job results", "file", runsFile, "err", err) }
+	}
+}
+
+// saveRuns writes the results; runsMutex is held.
+func saveRuns() error {
+	if observeOnly { return nil }
+	b, _ := json.MarshalIndent(runResults, "", "  ")
+	tmp := runsFile + ".tmp"
+	if err := os.WriteFile(tmp, b, 0600); err != nil { return err }
+	return os.Rename(tmp, runsFile)
+}
+
+// pluginData turns a job's last run into a monitor result; now decides whether it is overdue.
+func (r runResult) pluginData(name string, now time.Time) PluginData {
+	dur := time.Duration(r.Duration * float64(time.Second)).Round(time.Millisecond)
+	p := PluginData{Path: "run " + name, Name: name, Duration: r.Duration, TimedOut: r.TimedOut, PerfVal: r.Duration, PerfUnit: "s", LongOutput: r.Output}
+	switch {
+	case r.TimedOut: p.ExitCode, p.Output = 2, fmt.Sprintf("CRITICAL: %s timed out after %s", name, dur)
+	case r.ExitCode != 0: p.ExitCode, p.Output = 2, fmt.Sprintf("CRITICAL: %s exited %d after %s", name, r.ExitCode, dur)
+	default: p.Output = fmt.Sprintf("OK: %s finished in %s", name, dur)
+	}
+	if age := now.Sub(time.Unix(r.At, 0)); r.Every > 0 && age > time.Duration(r.Every)*time.Second*11/10 {
+		p.ExitCode, p.Output = 2, fmt.Sprintf("CRITICAL: %s last ran %s ago (expected every %s)", name, age.Round(time.Second), time.Duration(r.Every)*time.Second)
+	}
+	p.Perf = append([]PerfMetric{{Label: "duration", Value: r.Duration, Unit: "s"}}, parsePerfData(r.Perf)...)
+	return p
+}
+
+// currentRuns returns every job's result by name, for currentPlugins.
+func currentRuns() []PluginData {
+	runsMutex.Lock(); defer runsMutex.Unlock()
+	loadRuns()
+	names := make([]string, 0, len(runResults))
+	for n := range runResults { names = append(names, n) }
+	sort.Strings(names)
+	res := make([]PluginData, 0, len(names))
+	now := time.Now()
+	for _, n := range names {
+		p := runResults[n].pluginData(n, now)
+		p.LongOutput = "" // like script results, samples carry only the summary line
+		res = append(res, p)
+	}
+	return res
+}
+
+func registerRunsAPI(mux *http.ServeMux) {
+	mux.HandleFunc("POST /api/v1/checks/{name}", apiRole("operator", func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		if !runName.MatchString(name) { apiFail(w, http.StatusBadRequest, apiError{"bad_request", "name must be letters, digits, '.', '_' or '-' (up to 100)", nil}); return }
+		var rep runReport
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&rep); err != nil { apiFail(w, http.StatusBadRequest, apiError{"bad_request", "invalid result: " + err.Error(), nil}); return }
+		if rep.Duration < 0 || rep.Every < 0 { apiFail(w, http.StatusBadRequest, apiError{"bad_request", "duration and every can't be negative", nil}); return }
+		rep.Output = truncateOutput(rep.Output)
+		res := runResult{rep, time.Now().Unix()}
+		runsMutex.Lock()
+		loadRuns()
+		runResults[name] = res
+		err := saveRuns()
+		runsMutex.Unlock()
+		if err != nil { storageLog.Error("cannot save job results", "file", runsFile, "err", err) }
+		pluginLog.Debug("job result", "name", name, "exit", rep.ExitCode, "duration", rep.Duration, "user", actor(r))
+		apiOK(w, 200, res.pluginData(name, time.Now()), nil)
+	}))
+	mux.HandleFunc("GET /api/v1/checks/{name}", func(w http.ResponseWriter, r *http.Request) {
+		runsMutex.Lock(); loadRuns(); res, ok := runResults[r.PathValue("name")]; runsMutex.Unlock()
+		if !ok { apiFail(w, http.StatusNotFound, apiError{"not_found", "no job results for " + r.PathValue("name"), nil}); return }
+		apiOK(w, 200, res.pluginData(r.PathValue("name"), time.Now()), nil)
+	})
+	mux.HandleFunc("DELETE /api/v1/checks/{name}", apiRole("admin", func(w http.ResponseWriter, r *http.Request) {
+		runsMutex.Lock()
+		loadRuns()
+		_, ok := runResults[r.PathValue("name")]
+		delete(runResults, r.PathValue("name"))
+		err := saveRuns()
+		runsMutex.Unlock()
+		if !ok { apiFail(w, http.StatusNotFound, apiError{"not_found", "no job results for " + r.PathValue("name"), nil}); return }
+		if err != nil { apiFail(w, http.StatusInternalServerError, apiError{"internal", err.Error(), nil}); return }
+		auditLog("job_removed", map[string]interface{}{"user": actor(r), "name": r.PathValue("name")})
+		apiOK(w, 200, map[string]string{"removed": r.PathValue("name")}, nil)
+	}))
+}
+
+// tailWriter keeps the last max bytes written to it.
+type tailWriter struct {
+	buf []byte
+	max int
+}
+
+func (t *tailWriter) Write(p []byte) (int, error) {
+	t.buf = append(t.buf, p...)
+	if len(t.buf) > t.max { t.buf = append(t.buf[:0], t.buf[len(t.buf)-t.max:]...) }
+	return len(p), nil
+}
+
+// cliRun is "pulse run": it exits with the command's code, whether or not the report got through.
+func cliRun(fs *flag.FlagSet) func(c *apiClient) error {
+	name := fs.String("name", "", "name of the job, as it appears among the monitors (required)")
+	every := fs.Duration("every", 0, "how often the job runs, e.g. 24h; a result older than that (plus 10%) turns CRITICAL")
+	timeout := fs.Duration("timeout", 0, "kill the command after this long, e.g. 2h")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: pulse run --name NAME [--every 24h] [--timeout 2h] -- command [args...]")
+		fs.PrintDefaults()
+	}
+	return func(c *apiClient) error {
+		args := fs.Args()
+		if !runName.MatchString(*name) || len(args) == 0 { fs.Usage(); os.Exit(2) }
+		ctx := context.Background()
+		if *timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, *timeout)
+			defer cancel()
+		}
+		cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+		setProcessGroup(cmd)
+		cmd.Cancel = func() error { return killProcessGroup(cmd) }
+		cmd.WaitDelay = 5 * time.Second
+		all, out := &tailWriter{max: 8 << 10}, &tailWriter{max: 4 << 10}
+		cmd.Stdin = os.Stdin
+		cmd.Stdout, cmd.Stderr = io.MultiWriter(os.Stdout, all, out), io.MultiWriter(os.Stderr, all)
+		start := time.Now()
+		err := cmd.Run()
+		rep := runReport{Duration: time.Since(start).Seconds(), Every: int(every.Seconds()), TimedOut: ctx.Err() == context.DeadlineExceeded}
+		var exit *exec.ExitError
+		switch {
+		case errors.As(err, &exit):
+			rep.ExitCode = exit.ExitCode()
+			if ws, ok := exit.Sys().(syscall.WaitStatus); ok && ws.Signaled() { rep.ExitCode = 128 + int(ws.Signal()) } // as shells report it
+		case err != nil: rep.ExitCode = 127; fmt.Fprintln(os.Stderr, "pulse run:", err); all.Write([]byte(err.Error()))
+		}
+		if rep.TimedOut { rep.ExitCode = 124 } // as timeout(1)
+		rep.Output = strings.TrimSpace(string(all.buf))
+		// Perfdata on the last line of standard output is graphed, as with custom monitors.
+		lines := strings.Split(strings.TrimSpace(string(out.buf)), "\n")
+		if last := lines[len(lines)-1]; strings.Contains(last, "|") { rep.Perf = last[strings.Index(last, "|")+1:] }
+		if err := c.post("/checks/"+*name, rep, nil); err != nil { fmt.Fprintln(os.Stderr, "pulse run: cannot report the result:", err) }
+		os.Exit(rep.ExitCode)
+		return nil
+	}
+}
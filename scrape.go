@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// --- PROMETHEUS SCRAPE CHECK ---
+// A "scrape" check reads a Prometheus text-format /metrics page (target) and keeps the series whose
+// name{label=value,...} matches pattern (all of them if empty) as its perfdata, so each is graphed as
+// plugin:<check>/<series> and alerts as "<check> [<series>]" against warn and crit. Counters are kept
+// as the running totals the exporter reports; rate rules turn them into changes. The check is
+// CRITICAL when the page can't be read and WARNING when nothing matches.
+
+const maxScrapeSeries = 200
+
+// parsePromLine reads one sample line, name{label="value",...} value [timestamp], into a Metric.
+func parsePromLine(line string) (Metric, bool) {
+	var m Metric
+	i := strings.IndexAny(line, "{ \t")
+	if i <= 0 { return m, false }
+	m.Name, line = line[:i], line[i:]
+	if line[0] == '{' {
+		line = line[1:]
+		for {
+			line = strings.TrimLeft(line, " ,")
+			if strings.HasPrefix(line, "}") { line = line[1:]; break }
+			k, rest, ok := strings.Cut(line, "=")
+			if !ok || !strings.HasPrefix(rest, `"`) { return m, false }
+			var v strings.Builder
+			j := 1
+			for ; j < len(rest) && rest[j] != '"'; j++ {
+				if rest[j] == '\\' && j+1 < len(rest) {
+					j++
+					if rest[j] == 'n' { v.WriteByte('\n'); continue }
+				}
+				v.WriteByte(rest[j])
+			}
+			if j >= len(rest) { return m, false }
+			if m.Tags == nil { m.Tags = map[string]string{} }
+			m.Tags[strings.TrimSpace(k)] = v.String()
+			line = rest[j+1:]
+		}
+	}
+	f := strings.Fields(line)
+	if len(f) == 0 { return m, false }
+	v, err := strconv.ParseFloat(f[0], 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) { return m, false }
+	m.Value = v
+	return m, true
+}
+
+func runScrapeCheck(sc ScriptConfig, timeout time.Duration) PluginData {
+	p := PluginData{Path: sc.label(), Name: sc.Name}
+	start := time.Now()
+	fail := func(code int, msg string) PluginData {
+		p.ExitCode, p.Output, p.Duration = code, statusNames[code]+": "+msg, time.Since(start).Seconds()
+		return p
+	}
+	re, err := regexp.Compile("^(?:" + sc.Pattern + ")$")
+	if err != nil { return fail(3, "bad pattern: "+err.Error()) }
+	req, err := http.NewRequest("GET", sc.Target, nil)
+	if err != nil { return fail(3, err.Error()) }
+	req.Header.Set("Accept", "text/plain;version=0.0.4")
+	resp, err := (&http.Client{Timeout: timeout}).Do(req)
+	if err != nil { return fail(2, err.Error()) }
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK { return fail(2, fmt.Sprintf("%s returned %s", sc.Target, resp.Status)) }
+	sc.Warn, _ = rangeInUnit(sc.Warn, "")
+	sc.Crit, _ = rangeInUnit(sc.Crit, "")
+	rd := bufio.NewScanner(io.LimitReader(resp.Body, 16<<20))
+	rd.Buffer(make([]byte, 64<<10), 1<<20)
+	seen, total := map[string]bool{}, 0
+	for rd.Scan() {
+		line := strings.TrimSpace(rd.Text())
+		if line == "" || line[0] == '#' { continue }
+		m, ok := parsePromLine(line)
+		if !ok { continue }
+		total++
+		k := m.key()
+		if seen[k] || !re.MatchString(k) || len(p.Perf) == maxScrapeSeries { continue }
+		seen[k] = true
+		p.Perf = append(p.Perf, PerfMetric{Label: k, Value: m.Value, Warn: sc.Warn, Crit: sc.Crit})
+	}
+	if err := rd.Err(); err != nil { return fail(2, "reading "+sc.Target+": "+err.Error()) }
+	sort.Slice(p.Perf, func(i, j int) bool { return p.Perf[i].Label < p.Perf[j].Label })
+	p.PerfVal, p.Duration = float64(len(p.Perf)), time.Since(start).Seconds()
+	if len(p.Perf) == 0 { return fail(1, fmt.Sprintf("none of the %d series on %s match %q", total, sc.Target, sc.Pattern)) }
+	p.Output = fmt.Sprintf("OK: %d of %d series from %s", len(p.Perf), total, sc.Target)
+	if len(p.Perf) == maxScrapeSeries { p.Output += fmt.Sprintf(" (kept the first %d; narrow the pattern)", maxScrapeSeries) }
+	return p
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// --- SECRETS ---
+// Passwords, tokens and webhook URLs are stored in pulse.conf as "enc:v1:<base64>" (AES-256-GCM).
+// The key comes from PULSE_SECRET_KEY, or else from pulse.secret, which is created (mode 0600) on
+// first use. Keep pulse.secret out of backups of pulse.conf. GET /config never returns secrets:
+// set values come back as secretMask, and posting the mask back keeps the stored value.
+
+const (
+	secretPrefix = "enc:v1:"
+	secretMask   = "********"
+)
+
+var secretKeyFile = "pulse.secret"
+
+func secretFields(c *AppConfig) []*string {
+	return []*string{&c.SmtpPass, &c.TelegramToken, &c.TwilioToken, &c.NtfyToken, &c.GotifyToken, &c.OpsgenieKey,
+		&c.MqttPass, &c.TeamsWebhook, &c.GChatWebhook, &c.VictorOpsURL, &c.DigestWebhook,
+		&c.InfluxToken, &c.RemoteWriteToken, &c.PassivePass, &c.AlertmanagerPass, &c.StatusPage.Password}
+}
+
+func routeSecrets(r *RouteRule) []*string { return []*string{&r.TeamsWebhook, &r.GChatWebhook} }
+
+// eachSecret calls f for every secret field; Routes, FederateSources, Scripts, Collectors and their env maps are copied first so shared config stays untouched.
+func eachSecret(c *AppConfig, f func(*string)) {
+	for _, s := range secretFields(c) { f(s) }
+	c.Routes = append([]RouteRule(nil), c.Routes...)
+	for i := range c.Routes { for _, s := range routeSecrets(&c.Routes[i]) { f(s) } }
+	c.FederateSources = append([]FederateSource(nil), c.FederateSources...)
+	for i := range c.FederateSources { f(&c.FederateSources[i].Password) }
+	c.Scripts = append([]ScriptConfig(nil), c.Scripts...)
+	for i := range c.Scripts { eachEnv(&c.Scripts[i].Env, f) }
+	c.Collectors = append([]CollectorConfig(nil), c.Collectors...)
+	for i := range c.Collectors { eachEnv(&c.Collectors[i].Env, f) }
+}
+
+// eachEnv calls f for every value of an env map, which often holds API keys, and swaps in a copy of the map.
+func eachEnv(env *map[string]string, f func(*string)) {
+	if len(*env) == 0 { return }
+	m := make(map[string]string, len(*env))
+	for k, v := range *env { f(&v); m[k] = v }
+	*env = m
+}
+
+func secretKey() ([]byte, error) {
+	if k := os.Getenv("PULSE_SECRET_KEY"); k != "" { sum := sha256.Sum256([]byte(k)); return sum[:], nil }
+	b, err := os.ReadFile(secretKeyFile)
+	if os.IsNotExist(err) {
+		k := make([]byte, 32)
+		if _, err := rand.Read(k); err != nil { return nil, err }
+		if err := os.WriteFile(secretKeyFile, []byte(hex.EncodeToString(k)+"\n"), 0600); err != nil { return nil, err }
+		return k, nil
+	}
+	if err != nil { return nil, err }
+	k, err := hex.DecodeString(strings.TrimSpace(string(b)))
+	if err != nil || len(k) != 32 { return nil, fmt.Errorf("%s: expected 64 hex characters", secretKeyFile) }
+	return k, nil
+}
+
+func secretCipher() (cipher.AEAD, error) {
+	k, err := secretKey()
+	if err != nil { return nil, err }
+	block, err := aes.NewCipher(k)
+	if err != nil { return nil, err }
+	return cipher.NewGCM(block)
+}
+
+// sealSecrets encrypts every plaintext secret in c. Without a usable key they are left as they are.
+func sealSecrets(c *AppConfig) {
+	aead, err := secretCipher()
+	if err != nil { configLog.Warn("secrets stored unencrypted", "err", err) }
+	eachSecret(c, func(s *string) {
+		if aead == nil || *s == "" || strings.HasPrefix(*s, secretPrefix) { return }
+		nonce := make([]byte, aead.NonceSize()); rand.Read(nonce)
+		*s = secretPrefix + base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, []byte(*s), nil))
+	})
+}
+
+// openSecrets decrypts the secrets in c and reports how many were still stored in plaintext.
+func openSecrets(c *AppConfig) (plain int) {
+	var aead cipher.AEAD
+	var kerr error
+	eachSecret(c, func(s *string) {
+		if *s == "" { return }
+		if !strings.HasPrefix(*s, secretPrefix) { plain++; return }
+		if aead == nil && kerr == nil { aead, kerr = secretCipher() }
+		v, err := openSecret(aead, kerr, strings.TrimPrefix(*s, secretPrefix))
+		if err != nil { configLog.Error("cannot decrypt a secret", "file", confFile, "err", err); *s = ""; return }
+		*s = v
+	})
+	return
+}
+
+func openSecret(aead cipher.AEAD, kerr error, enc string) (string, error) {
+	if kerr != nil { return "", kerr }
+	b, err := base64.StdEncoding.DecodeString(enc)
+	if err != nil || len(b) < aead.NonceSize() { return "", errors.New("malformed value") }
+	p, err := aead.Open(nil, b[:aead.NonceSize()], b[aead.NonceSize():], nil)
+	if err != nil { return "", errors.New("wrong PULSE_SECRET_KEY or " + secretKeyFile) }
+	return string(p), nil
+}
+
+// redactConfig masks secrets and drops the user list, for GET /config.
+func redactConfig(c AppConfig) AppConfig {
+	eachSecret(&c, func(s *string) { if *s != "" { *s = secretMask } })
+	c.Users = nil
+	return c
+}
+
+// redactError hides cfg's secrets in err, and cuts the URL of a failed request down to its scheme
+// and host, since channels such as Telegram carry their token in the URL. errNotConfigured is kept as is.
+func redactError(cfg AppConfig, err error) error {
+	if err == nil || err == errNotConfigured { return err }
+	msg := err.Error()
+	var cut func(error)
+	cut = func(e error) {
+		if ue, ok := e.(*url.Error); ok {
+			short := "(url)"
+			if u, perr := url.Parse(ue.URL); perr == nil && u.Host != "" { short = u.Scheme + "://" + u.Host }
+			msg = strings.ReplaceAll(msg, ue.URL, short)
+		}
+		switch w := e.(type) {
+		case interface{ Unwrap() error }: if e := w.Unwrap(); e != nil { cut(e) }
+		case interface{ Unwrap() []error }: for _, e := range w.Unwrap() { cut(e) }
+		}
+	}
+	cut(err)
+	eachSecret(&cfg, func(s *string) {
+		if len(*s) < 4 { return }
+		for _, v := range []string{*s, url.QueryEscape(*s), url.PathEscape(*s)} { msg = strings.ReplaceAll(msg, v, secretMask) }
+	})
+	return errors.New(msg)
+}
+
+// keepSecrets puts the stored value back wherever c still holds the mask, so secrets are write-only in the UI.
+func keepSecrets(c *AppConfig, old AppConfig) {
+	oldTop := secretFields(&old)
+	for i, s := range secretFields(c) { if *s == secretMask { *s = *oldTop[i] } }
+	for i := range c.Routes {
+		var prev *RouteRule
+		for j := range old.Routes { if old.Routes[j].Name == c.Routes[i].Name { prev = &old.Routes[j]; break } }
+		if prev == nil && i < len(old.Routes) { prev = &old.Routes[i] }
+		for k, s := range routeSecrets(&c.Routes[i]) {
+			if *s != secretMask { continue }
+			*s = ""
+			if prev != nil { *s = *routeSecrets(prev)[k] }
+		}
+	}
+	for i := range c.FederateSources {
+		s := &c.FederateSources[i]
+		if s.Password != secretMask { continue }
+		s.Password = ""
+		for _, o := range old.FederateSources { if o.URL == s.URL { s.Password = o.Password; break } }
+	}
+	for i := range c.Scripts {
+		var prev map[string]string
+		for _, o := range old.Scripts { if o.key() == c.Scripts[i].key() { prev = o.Env; break } }
+		keepEnv(c.Scripts[i].Env, prev)
+	}
+	for i := range c.Collectors {
+		var prev map[string]string
+		for _, o := range old.Collectors { if o.Name == c.Collectors[i].Name { prev = o.Env; break } }
+		keepEnv(c.Collectors[i].Env, prev)
+	}
+}
+
+// keepEnv restores masked env values from the stored map, or drops them if it doesn't have them.
+func keepEnv(env, old map[string]string) {
+	for k, v := range env {
+		if v != secretMask { continue }
+		if o, ok := old[k]; ok { env[k] = o } else { delete(env, k) }
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// --- SERVICE ---
+// "pulse install-service" registers Pulse with the init system (systemd, launchd or the Windows
+// service manager) so it starts at boot and restarts after a crash, running from a data
+// directory (--data-dir, default per OS). Flags given before the command are passed on to the
+// service. "pulse status" (client.go) shows the service state and whether the dashboard answers.
+
+const serviceName = "pulse"
+
+func serviceCommand(args []string) error {
+	switch args[0] {
+	case "install-service":
+		dir := dataDir
+		if dir == "" { dir = defaultDataDir() }
+		dir, _ = filepath.Abs(dir)
+		exe, err := os.Executable()
+		if err != nil { return err }
+		if exe, err = filepath.EvalSymlinks(exe); err != nil { return err }
+		if err := prepareDataDir(dir); err != nil { return err }
+		if err := installService(exe, append([]string{"--data-dir", dir}, passFlags...), dir); err != nil { return err }
+		fmt.Println("Installed and started service", serviceName, "with data in", dir)
+		return nil
+	case "uninstall-service":
+		if err := uninstallService(); err != nil { return err }
+		fmt.Println("Removed service", serviceName, "(the data directory was kept)")
+		return nil
+	}
+	return fmt.Errorf("unknown command %q (passwd, install-service, uninstall-service, status, top, history, alerts, tui, check, migrate-data, restore)", args[0])
+}
+
+// prepareDataDir creates dir (0750) and brings over pulse.conf and pulse.secret from the current
+// directory the first time, so a setup made with "go run ." carries over to the service.
+func prepareDataDir(dir string) error {
+	if err := os.MkdirAll(dir, 0750); err != nil { return err }
+	if err := os.Chmod(dir, 0750); err != nil { return err }
+	for _, name := range []string{"pulse.conf", "pulse.secret", "pulse.conf.history", "pulse.vapid", "pulse.push.json", "pulse.alerts.json"} {
+		dst := filepath.Join(dir, name)
+		if _, err := os.Stat(dst); os.IsNotExist(err) {
+			if b, err := os.ReadFile(name); err == nil {
+				if err := os.WriteFile(dst, b, 0600); err != nil { return err }
+				fmt.Println("Copied", name, "to", dir)
+			}
+		}
+		if _, err := os.Stat(dst); err == nil { os.Chmod(dst, 0600) }
+	}
+	return nil
+}
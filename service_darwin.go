@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+const (
+	launchdLabel = "com.supergoodmike.pulse"
+	plistFile    = "/Library/LaunchDaemons/" + launchdLabel + ".plist"
+)
+
+const plistTemplate = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Label</key><string>%s</string>
+	<key>ProgramArguments</key>
+	<array>%s</array>
+	<key>WorkingDirectory</key><string>%s</string>
+	<key>RunAtLoad</key><true/>
+	<key>KeepAlive</key><true/>
+	<key>StandardOutPath</key><string>%s/pulse.log</string>
+	<key>StandardErrorPath</key><string>%s/pulse.log</string>
+</dict>
+</plist>
+`
+
+func defaultDataDir() string { return "/usr/local/var/pulse" }
+
+func runningAsService() bool { return false }
+
+func runService(run func()) error { run(); return nil }
+
+func launchctl(args ...string) error {
+	out, err := exec.Command("launchctl", args...).CombinedOutput()
+	if err != nil { return fmt.Errorf("launchctl %s: %v %s", strings.Join(args, " "), err, strings.TrimSpace(string(out))) }
+	return nil
+}
+
+func installService(exe string, args []string, dir string) error {
+	if os.Geteuid() != 0 { return fmt.Errorf("install-service needs root") }
+	var items strings.Builder
+	for _, a := range append([]string{exe}, args...) { items.WriteString("\n\t\t<string>" + html.EscapeString(a) + "</string>") }
+	d := html.EscapeString(dir)
+	plist := fmt.Sprintf(plistTemplate, launchdLabel, items.String()+"\n\t", d, d, d)
+	if err := os.WriteFile(plistFile, []byte(plist), 0644); err != nil { return err }
+	return launchctl("bootstrap", "system", plistFile)
+}
+
+func uninstallService() error {
+	if os.Geteuid() != 0 { return fmt.Errorf("uninstall-service needs root") }
+	if _, err := os.Stat(plistFile); os.IsNotExist(err) { return fmt.Errorf("%s not found", plistFile) }
+	launchctl("bootout", "system/"+launchdLabel)
+	return os.Remove(plistFile)
+}
+
+func serviceState() (string, error) {
+	if _, err := os.Stat(plistFile); os.IsNotExist(err) { return "not installed", nil }
+	out, err := exec.Command("launchctl", "print", "system/"+launchdLabel).Output()
+	if err != nil { return "launchd job not loaded", nil }
+	for _, l := range strings.Split(string(out), "\n") {
+		if l = strings.TrimSpace(l); strings.HasPrefix(l, "state = ") { return "launchd job " + strings.TrimPrefix(l, "state = "), nil }
+	}
+	return "launchd job loaded", nil
+}
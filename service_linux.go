@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+const unitFile = "/etc/systemd/system/" + serviceName + ".service"
+
+const unitTemplate = `[Unit]
+Description=Pulse system monitor
+After=network-online.target
+Wants=network-online.target
+
+[Service]
+ExecStart=%s
+ExecReload=/bin/kill -HUP $MAINPID
+WorkingDirectory=%s
+Restart=on-failure
+RestartSec=5
+TimeoutStopSec=30
+
+[Install]
+WantedBy=multi-user.target
+`
+
+func defaultDataDir() string { return "/var/lib/pulse" }
+
+func runningAsService() bool { return false }
+
+func runService(run func()) error { run(); return nil }
+
+func systemctl(args ...string) error {
+	out, err := exec.Command("systemctl", args...).CombinedOutput()
+	if err != nil { return fmt.Errorf("systemctl %s: %v %s", strings.Join(args, " "), err, strings.TrimSpace(string(out))) }
+	return nil
+}
+
+// quoteArgs quotes arguments for an ExecStart line.
+func quoteArgs(args []string) string {
+	var q []string
+	for _, a := range args {
+		if strings.ContainsAny(a, " \t\"'\\") { a = `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(a) + `"` }
+		q = append(q, strings.ReplaceAll(a, "%", "%%"))
+	}
+	return strings.Join(q, " ")
+}
+
+func installService(exe string, args []string, dir string) error {
+	if os.Geteuid() != 0 { return fmt.Errorf("install-service needs root") }
+	unit := fmt.Sprintf(unitTemplate, quoteArgs(append([]string{exe}, args...)), dir)
+	if err := os.WriteFile(unitFile, []byte(unit), 0644); err != nil { return err }
+	if err := systemctl("daemon-reload"); err != nil { return err }
+	return systemctl("enable", "--now", serviceName)
+}
+
+func uninstallService() error {
+	if os.Geteuid() != 0 { return fmt.Errorf("uninstall-service needs root") }
+	if _, err := os.Stat(unitFile); os.IsNotExist(err) { return fmt.Errorf("%s not found", unitFile) }
+	systemctl("disable", "--now", serviceName)
+	if err := os.Remove(unitFile); err != nil { return err }
+	return systemctl("daemon-reload")
+}
+
+func serviceState() (string, error) {
+	if _, err := os.Stat(unitFile); os.IsNotExist(err) { return "not installed", nil }
+	out, _ := exec.Command("systemctl", "is-active", serviceName).Output()
+	return "systemd unit " + strings.TrimSpace(string(out)), nil
+}
@@ -0,0 +1,19 @@
+//go:build !linux && !darwin && !windows
+
+package main
+
+import "errors"
+
+var errNoServiceManager = errors.New("service install is supported on Linux (systemd), macOS and Windows")
+
+func defaultDataDir() string { return "/var/lib/pulse" }
+
+func runningAsService() bool { return false }
+
+func runService(run func()) error { run(); return nil }
+
+func installService(exe string, args []string, dir string) error { return errNoServiceManager }
+
+func uninstallService() error { return errNoServiceManager }
+
+func serviceState() (string, error) { return "", errNoServiceManager }
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+func defaultDataDir() string { return filepath.Join(os.Getenv("ProgramData"), "Pulse") }
+
+func runningAsService() bool { ok, _ := svc.IsWindowsService(); return ok }
+
+type pulseService struct{ run func() }
+
+func (p pulseService) Execute(args []string, req <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.StartPending}
+	go p.run()
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+	for c := range req {
+		switch c.Cmd {
+		case svc.Interrogate: status <- c.CurrentStatus
+		case svc.Stop, svc.Shutdown:
+			status <- svc.Status{State: svc.StopPending}
+			shutdown()
+			return false, 0
+		}
+	}
+	return false, 0
+}
+
+func runService(run func()) error { return svc.Run(serviceName, pulseService{run}) }
+
+func installService(exe string, args []string, dir string) error {
+	m, err := mgr.Connect()
+	if err != nil { return fmt.Errorf("service manager (run as Administrator): %w", err) }
+	defer m.Disconnect()
+	if s, err := m.OpenService(serviceName); err == nil { s.Close(); return fmt.Errorf("service %s already exists", serviceName) }
+	s, err := m.CreateService(serviceName, exe, mgr.Config{DisplayName: "Pulse", Description: "Pulse system monitor", StartType: mgr.StartAutomatic}, args...)
+	if err != nil { return err }
+	defer s.Close()
+	s.SetRecoveryActions([]mgr.RecoveryAction{{Type: mgr.ServiceRestart, Delay: 5 * time.Second}}, 86400)
+	return s.Start()
+}
+
+func uninstallService() error {
+	m, err := mgr.Connect()
+	if err != nil { return fmt.Errorf("service manager (run as Administrator): %w", err) }
+	defer m.Disconnect()
+	s, err := m.OpenService(serviceName)
+	if err != nil { return fmt.Errorf("service %s not found", serviceName) }
+	defer s.Close()
+	if st, err := s.Query(); err == nil && st.State != svc.Stopped {
+		s.Control(svc.Stop)
+		for i := 0; i < 30; i++ {
+			if st, err := s.Query(); err != nil || st.State == svc.Stopped { break }
+			time.Sleep(time.Second)
+		}
+	}
+	return s.Delete()
+}
+
+func serviceState() (string, error) {
+	m, err := mgr.Connect()
+	if err != nil { return "", err }
+	defer m.Disconnect()
+	s, err := m.OpenService(serviceName)
+	if err != nil { return "not installed", nil }
+	defer s.Close()
+	st, err := s.Query()
+	if err != nil { return "", err }
+	names := map[svc.State]string{svc.Stopped: "stopped", svc.StartPending: "starting", svc.StopPending: "stopping", svc.Running: "running",
+		svc.ContinuePending: "resuming", svc.PausePending: "pausing", svc.Paused: "paused"}
+	return "Windows service " + names[st.State], nil
+}
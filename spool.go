@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// --- FORWARDING SPOOL ---
+// When a TSDB is unreachable for long enough that forward_buffer fills up, the oldest queued samples
+// move to a spool file per target (pulse.spool.influx, pulse.spool.remote_write, JSON lines) instead of
+// being dropped. Once sends succeed again the spool is sent first, oldest first, so a WAN outage
+// leaves no gap in the TSDB. The file never grows beyond forward_spool_mb; past that, overflow is
+// dropped as before. Samples are spooled without their process, port and group lists, which
+// forwarding doesn't send. How far the spool has been sent is kept next to it (.off), and the sent
+// part is cut from the file once it is half of it and at shutdown, so a restart resumes where
+// sending stopped; only the batch being sent when Pulse stopped may be sent twice.
+
+var spoolFile = "pulse.spool"
+
+type sampleSpool struct {
+	path  string
+	mu    sync.Mutex
+	off   int64 // where the next unsent sample starts
+	size  int64
+	count int   // unsent samples
+	added int64 // spooled since start
+}
+
+// openSpool picks up what an earlier run left unsent.
+func openSpool(name string) *sampleSpool {
+	s := &sampleSpool{path: spoolFile + "." + name}
+	if b, err := os.ReadFile(s.path + ".off"); err == nil {
+		off, _ := strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+		if st, err := os.Stat(s.path); err == nil && off > 0 && off <= st.Size() {
+			s.off = off
+			if err := s.compactLocked(); err != nil { exportLog.Error("cannot compact the forwarding spool", "file", s.path, "err", err) }
+		}
+		os.Remove(s.path + ".off")
+		s.off, s.size = 0, 0 // counted below
+	}
+	f, err := os.Open(s.path)
+	if err != nil { return s }
+	defer f.Close()
+	rd := bufio.NewReader(f)
+	for {
+		line, err := rd.ReadBytes('\n')
+		if len(line) > 0 && line[len(line)-1] == '\n' { s.count++; s.size += int64(len(line)) }
+		if err != nil { break }
+	}
+	// A line cut short by a crash is cut off, so appending starts on a line of its own.
+	if st, err := f.Stat(); err == nil && st.Size() != s.size { os.Truncate(s.path, s.size) }
+	if s.count > 0 { exportLog.Info("resuming spooled samples", "file", s.path, "samples", s.count) }
+	return s
+}
+
+func spoolLimit(c AppConfig) int64 {
+	if c.ForwardSpoolMB > 0 { return int64(c.ForwardSpoolMB) << 20 }
+	return 100 << 20
+}
+
+// add appends samples and returns how many didn't fit under max bytes.
+func (s *sampleSpool) add(ms []RichMetrics, max int64) (dropped int) {
+	if observeOnly || len(ms) == 0 { return len(ms) }
+	s.mu.Lock(); defer s.mu.Unlock()
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil { exportLog.Error("cannot open the forwarding spool", "file", s.path, "err", err); return len(ms) }
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	for i, m := range ms {
+		m.ProcessList, m.OpenPorts, m.Groups, m.Heartbeats = nil, nil, nil, nil
+		b, _ := json.Marshal(m)
+		if s.size+int64(len(b))+1 > max { dropped = len(ms) - i; break }
+		w.Write(append(b, '\n'))
+		s.size += int64(len(b)) + 1; s.count++; s.added++
+	}
+	if err := w.Flush(); err != nil { exportLog.Error("cannot write the forwarding spool", "file", s.path, "err", err) }
+	return dropped
+}
+
+// peek reads up to n of the oldest unsent samples and where the spool continues after them.
+func (s *sampleSpool) peek(n int) ([]RichMetrics, int64, error) {
+	s.mu.Lock(); defer s.mu.Unlock()
+	if s.count == 0 { return nil, s.off, nil }
+	f, err := os.Open(s.path)
+	if errors.Is(err, os.ErrNotExist) { s.resetLocked(); return nil, 0, nil }
+	if err != nil { return nil, s.off, err }
+	defer f.Close()
+	if _, err := f.Seek(s.off, io.SeekStart); err != nil { return nil, s.off, err }
+	rd, off := bufio.NewReader(f), s.off
+	var res []RichMetrics
+	for len(res) < n {
+		line, err := rd.ReadBytes('\n')
+		off += int64(len(line))
+		if len(line) > 0 {
+			var m RichMetrics
+			if json.Unmarshal(line, &m) == nil { res = append(res, m) } else { exportLog.Warn("skipping a damaged spooled sample", "file", s.path) }
+		}
+		if errors.Is(err, io.EOF) { break }
+		if err != nil { return nil, s.off, err }
+	}
+	return res, off, nil
+}
+
+// done marks everything before off as sent and notes that on disk; an emptied spool is removed, one
+// that is at least half sent is compacted.
+func (s *sampleSpool) done(off int64, n int) {
+	s.mu.Lock(); defer s.mu.Unlock()
+	s.off, s.count = off, max(s.count-n, 0)
+	if s.off >= s.size { s.resetLocked(); return }
+	if s.off >= s.size/2 {
+		err := s.compactLocked()
+		if err == nil { return }
+		exportLog.Error("cannot compact the forwarding spool", "file", s.path, "err", err)
+	}
+	if err := os.WriteFile(s.path+".off", []byte(strconv.FormatInt(s.off, 10)), 0600); err != nil { exportLog.Error("cannot note the forwarding spool offset", "file", s.path, "err", err) }
+}
+
+// compact cuts the sent samples from the file, during shutdown.
+func (s *sampleSpool) compact() {
+	s.mu.Lock(); defer s.mu.Unlock()
+	if err := s.compactLocked(); err != nil { exportLog.Error("cannot compact the forwarding spool", "file", s.path, "err", err) }
+}
+
+// compactLocked rewrites the spool without what is before off, through a temporary file so a crash
+// leaves either the old file or the new one. The offset note goes first: an old file without it is
+// only sent again, a new file with it would lose samples.
+func (s *sampleSpool) compactLocked() error {
+	if s.off == 0 { return nil }
+	in, err := os.Open(s.path)
+	if err != nil { return err }
+	defer in.Close()
+	if _, err := in.Seek(s.off, io.SeekStart); err != nil { return err }
+	tmp := s.path + ".tmp"
+	out, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil { return err }
+	n, err := io.Copy(out, in)
+	if err == nil { err = out.Sync() }
+	if cerr := out.Close(); err == nil { err = cerr }
+	if err == nil { os.Remove(s.path + ".off"); err = os.Rename(tmp, s.path) }
+	if err != nil { os.Remove(tmp); return err }
+	s.off, s.size = 0, n
+	return nil
+}
+
+func (s *sampleSpool) reset() { s.mu.Lock(); s.resetLocked(); s.mu.Unlock() }
+
+func (s *sampleSpool) resetLocked() {
+	if s.size > 0 { os.Remove(s.path); os.Remove(s.path + ".off") }
+	s.off, s.size, s.count = 0, 0, 0
+}
+
+func (s *sampleSpool) pending() (count int, bytes int64) {
+	s.mu.Lock(); defer s.mu.Unlock()
+	return s.count, s.size - s.off
+}
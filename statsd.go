@@ -0,0 +1,208 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- STATSD LISTENER ---
+// With statsd_listen set (e.g. "127.0.0.1:8125") Pulse takes StatsD over UDP from the apps on this
+// host and every statsd_flush seconds (Default: 10) hands what came in to the ingest pipeline as
+// gauges: a counter (c) as its rate per second, a gauge (g, "+n"/"-n" change it) as its value, a
+// timer (ms) or histogram (h) as <name>_count, _mean, _p95 and _max, a set (s) as its count of
+// distinct values. Sample rates (|@0.1) scale counters, and DogStatsD tags (|#env:prod,db) become
+// tags. Dots and other characters metric names can't have turn into _. A counter that goes quiet
+// reports 0 until ingest_ttl passes. This is the receiving side; statsd_addr (emit.go) sends.
+
+const maxStatsdTimings = 10000 // per series and flush
+
+type statsdSeries struct {
+	m    Metric
+	sum  float64
+	vals []float64
+	set  map[string]bool
+}
+
+var (
+	statsdMutex    sync.Mutex
+	statsdCounters = map[string]*statsdSeries{}
+	statsdTimers   = map[string]*statsdSeries{}
+	statsdSets     = map[string]*statsdSeries{}
+	statsdGauges   = map[string]*statsdSeries{}
+	statsdQuiet    = map[string]time.Time{} // counters: last time one came in
+	statsdChanged  = map[string]bool{}      // gauges set since the last flush
+	statsdBad      int64
+	statsdUnsafe   = regexp.MustCompile(`[^A-Za-z0-9_]+`)
+)
+
+// statsdName makes a StatsD name or tag key into a metric name.
+func statsdName(s string) string {
+	s = strings.Trim(statsdUnsafe.ReplaceAllString(s, "_"), "_")
+	if s == "" || (s[0] >= '0' && s[0] <= '9') { s = "_" + s }
+	return s
+}
+
+// parseStatsd reads one line: name:value|type[|@rate][|#tag:value,...].
+func parseStatsd(line string) (m Metric, raw, typ string, rate float64, err error) {
+	name, rest, ok := strings.Cut(line, ":")
+	if !ok || name == "" { return m, "", "", 0, fmt.Errorf("no name:value") }
+	parts := strings.Split(rest, "|")
+	if len(parts) < 2 { return m, "", "", 0, fmt.Errorf("no |type") }
+	raw, typ, rate = parts[0], parts[1], 1
+	for _, p := range parts[2:] {
+		switch {
+		case strings.HasPrefix(p, "@"):
+			if rate, err = strconv.ParseFloat(p[1:], 64); err != nil || rate <= 0 || rate > 1 { return m, "", "", 0, fmt.Errorf("bad sample rate %q", p) }
+		case strings.HasPrefix(p, "#"):
+			for _, t := range strings.Split(p[1:], ",") {
+				if t == "" { continue }
+				k, v, _ := strings.Cut(t, ":")
+				if m.Tags == nil { m.Tags = map[string]string{} }
+				k = statsdName(k)
+				if k == "host" || k == "label" { k = "tag_" + k }
+				m.Tags[k] = v
+			}
+		}
+	}
+	m.Name = statsdName(name)
+	return m, raw, typ, rate, nil
+}
+
+// statsdLine adds one line to the current flush.
+func statsdLine(line string) error {
+	m, raw, typ, rate, err := parseStatsd(line)
+	if err != nil { return err }
+	key := m.key()
+	statsdMutex.Lock(); defer statsdMutex.Unlock()
+	get := func(into map[string]*statsdSeries) *statsdSeries {
+		s := into[key]
+		if s == nil { s = &statsdSeries{m: m}; into[key] = s }
+		return s
+	}
+	if typ == "s" {
+		s := get(statsdSets)
+		if s.set == nil { s.set = map[string]bool{} }
+		s.set[raw] = true
+		return nil
+	}
+	v, err := strconv.ParseFloat(raw, 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) { return fmt.Errorf("bad value %q", raw) }
+	switch typ {
+	case "c":
+		get(statsdCounters).sum += v / rate
+		statsdQuiet[key] = time.Now()
+	case "g":
+		// A signed value changes a gauge already known; otherwise it is the value.
+		if s := statsdGauges[key]; s != nil && (raw[0] == '+' || raw[0] == '-') { s.sum += v } else { get(statsdGauges).sum = v }
+		statsdChanged[key] = true
+	case "ms", "h":
+		if s := get(statsdTimers); len(s.vals) < maxStatsdTimings { s.vals = append(s.vals, v) }
+	default:
+		return fmt.Errorf("unknown type %q", typ)
+	}
+	return nil
+}
+
+// flushStatsd turns what came in since the last flush into ingest points.
+func flushStatsd(every time.Duration, ttl time.Duration) []ingestPoint {
+	statsdMutex.Lock(); defer statsdMutex.Unlock()
+	var pts []ingestPoint
+	add := func(m Metric, suffix, unit string, v float64) {
+		m.Name, m.Unit, m.Value = m.Name+suffix, unit, v
+		pts = append(pts, ingestPoint{Metric: m})
+	}
+	now := time.Now()
+	for key, seen := range statsdQuiet {
+		s := statsdCounters[key]
+		if now.Sub(seen) > ttl { delete(statsdQuiet, key); delete(statsdCounters, key); continue }
+		add(s.m, "", "/s", s.sum/every.Seconds())
+		s.sum = 0
+	}
+	for key := range statsdChanged { s := statsdGauges[key]; add(s.m, "", "", s.sum) }
+	clear(statsdChanged)
+	for key, s := range statsdTimers {
+		sort.Float64s(s.vals)
+		n, sum := len(s.vals), 0.0
+		for _, v := range s.vals { sum += v }
+		add(s.m, "_count", "", float64(n))
+		add(s.m, "_mean", "ms", sum/float64(n))
+		add(s.m, "_p95", "ms", s.vals[(n*95+99)/100-1])
+		add(s.m, "_max", "ms", s.vals[n-1])
+		delete(statsdTimers, key)
+	}
+	for key, s := range statsdSets { add(s.m, "", "", float64(len(s.set))); delete(statsdSets, key) }
+	return pts
+}
+
+func statsdFlushEvery(c AppConfig) time.Duration {
+	return time.Duration(cmp.Or(c.StatsdFlush, 10)) * time.Second
+}
+
+func serveStatsd(conn net.PacketConn) {
+	buf := make([]byte, 65535)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil { return }
+		for _, line := range strings.Split(string(buf[:n]), "\n") {
+			if line = strings.TrimSpace(line); line == "" { continue }
+			if err := statsdLine(line); err != nil {
+				statsdMutex.Lock(); statsdBad++; first := statsdBad == 1; statsdMutex.Unlock()
+				if first { collectorLog.Warn("ignoring a bad StatsD line", "line", truncateOutput(line), "err", err) }
+			}
+		}
+	}
+}
+
+// runStatsd follows statsd_listen, reopening the socket when it changes, and flushes into ingest.
+func runStatsd() {
+	var conn net.PacketConn
+	addr := ""
+	last := time.Now()
+	for {
+		cfgMutex.RLock(); cfg := config; cfgMutex.RUnlock()
+		if cfg.StatsdListen != addr {
+			if conn != nil { conn.Close(); conn = nil }
+			addr = cfg.StatsdListen
+			if addr != "" {
+				c, err := net.ListenPacket("udp", addr)
+				if err != nil {
+					collectorLog.Error("cannot listen for StatsD", "addr", addr, "err", err)
+					noteCap("statsd", collectorCap{Note: err.Error()})
+				} else {
+					conn = c
+					collectorLog.Info("listening for StatsD", "addr", addr)
+					noteCap("statsd", collectorCap{OK: true})
+					go serveStatsd(c)
+				}
+			}
+		}
+		if every := statsdFlushEvery(cfg); time.Since(last) >= every {
+			last = time.Now()
+			if pts := flushStatsd(every, time.Duration(cmp.Or(cfg.IngestTTL, 600))*time.Second); len(pts) > 0 {
+				if _, errs := ingest(pts); len(errs) > 0 { collectorLog.Debug("StatsD metrics not ingested", "count", len(errs), "first", errs[0].Message) }
+			}
+		}
+		select {
+		case <-stopCtx.Done():
+			if conn != nil { conn.Close() }
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+func validateStatsd(c AppConfig, bad func(field, format string, a ...interface{})) {
+	if c.StatsdListen != "" {
+		if _, _, err := net.SplitHostPort(c.StatsdListen); err != nil { bad("statsd_listen", "must be host:port, e.g. 127.0.0.1:8125") }
+		if c.StatsdListen == c.StatsdAddr { bad("statsd_listen", "is statsd_addr too, which would send Pulse's own metrics back to it") }
+	}
+	if c.StatsdFlush < 0 { bad("statsd_flush", "must not be negative") }
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"cmp"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	htmltpl "html/template"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// --- STATUS PAGE ---
+// status_page makes Pulse a small public status page at /public (JSON at /public/status.json): its
+// components, each up, degraded or down, with their uptime over 24 hours, 7 days and 30 days and the
+// incidents of the last 30 days. A component follows a check ({"name": "Website", "check": "http_home"}),
+// a federated site ("site": "cabin"), any alert monitor ("monitor": "Heartbeat backup"), or, with none
+// of these, this host. A check is down while CRITICAL or UNKNOWN and this host while Pulse is not
+// collecting, both from history; a site is down while unreachable and a monitor while its alert is
+// CRITICAL, as far back as the alert log goes. Right now, this host and a site also show their worst
+// active alert. The page shows nothing but the components, needs no dashboard login, and asks for
+// status_page.password (any user name) when one is set.
+
+const (
+	statusPageTTL      = 30 * time.Second // how long a worked-out page is served
+	maxStatusIncidents = 20
+)
+
+// statusWindows are the uptime periods, shortest first.
+var statusWindows = [3]int64{86400, 7 * 86400, 30 * 86400}
+
+type StatusPage struct {
+	Title      string            `json:"title,omitempty"`    // Default: "<host> status"
+	Password   string            `json:"password,omitempty"` // Basic auth for /public; empty leaves it open
+	Components []StatusComponent `json:"components"`
+}
+
+type StatusComponent struct {
+	Name    string `json:"name"`
+	Check   string `json:"check,omitempty"`
+	Site    string `json:"site,omitempty"`
+	Monitor string `json:"monitor,omitempty"`
+}
+
+type publicUptime struct {
+	Day   *float64 `json:"24h"` // null without data
+	Week  *float64 `json:"7d"`
+	Month *float64 `json:"30d"`
+}
+
+type publicComponent struct {
+	Name   string       `json:"name"`
+	State  string       `json:"state"` // up, degraded, down or unknown
+	Uptime publicUptime `json:"uptime"`
+}
+
+type publicStatus struct {
+	Title      string            `json:"title"`
+	Time       int64             `json:"time"`
+	State      string            `json:"state"` // the worst component
+	Components []publicComponent `json:"components"`
+	Incidents  []ReportIncident  `json:"incidents"` // newest first
+}
+
+var (
+	statusCache   *publicStatus
+	statusCacheAt time.Time
+	statusMutex   sync.Mutex
+)
+
+// statusTrack follows one component through the three windows.
+type statusTrack [3]reportObjective
+
+// add counts a span in every window it reaches, clipping it to the longest window first.
+func (t *statusTrack) add(now, ts, secs int64, level string) {
+	for i := len(t) - 1; i >= 0; i-- {
+		from := now - statusWindows[i]
+		if ts+secs <= from { return }
+		if ts < from { secs -= from - ts; ts = from }
+		t[i].add(ts, secs, level)
+	}
+}
+
+func (t *statusTrack) uptime() publicUptime {
+	var up [3]*float64
+	for i := range t {
+		if o := t[i]; o.Covered > 0 { v := 100 * float64(o.Covered-o.Downtime) / float64(o.Covered); up[i] = &v }
+	}
+	return publicUptime{up[0], up[1], up[2]}
+}
+
+// alertState is a component's state for an alert level.
+func alertState(level string) string {
+	switch level {
+	case "CRITICAL", "UNKNOWN": return "down"
+	case "WARNING": return "degraded"
+	}
+	return "up"
+}
+
+func buildStatusPage(cfg AppConfig, now int64) *publicStatus {
+	sp := cfg.StatusPage
+	tracks := make([]statusTrack, len(sp.Components))
+	for c, comp := range sp.Components {
+		for i := range tracks[c] { tracks[c][i].Name = comp.Name }
+	}
+	start := now
+
+	historyMutex.RLock()
+	lo, hi := history.Search(now-statusWindows[2]), history.Len()
+	if lo < hi { start = history.At(lo).Timestamp }
+	for i := lo; i < hi; i++ {
+		m := history.At(i)
+		next := now
+		if i+1 < hi { next = history.At(i + 1).Timestamp }
+		secs := min(next-m.Timestamp, reportGap)
+		for c, comp := range sp.Components {
+			switch {
+			case comp.Check != "":
+				for _, p := range m.Plugins { if pluginID(p) == comp.Check { tracks[c].add(now, m.Timestamp, secs, checkLevel(p, false)) } }
+			case comp.Site == "" && comp.Monitor == "":
+				tracks[c].add(now, m.Timestamp, secs, "")
+				if next-m.Timestamp > reportGap { tracks[c].add(now, m.Timestamp+reportGap, next-m.Timestamp-reportGap, "CRITICAL") }
+			}
+		}
+	}
+	historyMutex.RUnlock()
+
+	alertLogMutex.RLock()
+	for c, comp := range sp.Components {
+		mon := comp.Monitor
+		if comp.Site != "" { mon = "Site " + comp.Site + " Unreachable" }
+		if mon == "" { continue }
+		level, t := "", start
+		for _, ev := range alertHistory {
+			if ev.Monitor != mon { continue }
+			if ev.Time > t { tracks[c].add(now, t, ev.Time-t, level); t = ev.Time }
+			level = ""
+			if ev.Level == "CRITICAL" { level = ev.Level }
+		}
+		if now > t { tracks[c].add(now, t, now-t, level) }
+	}
+	alertLogMutex.RUnlock()
+
+	active := map[string]string{}
+	for _, a := range currentAlerts(cfg) { active[a.Monitor] = a.Level }
+	sites := map[string]federatedSite{}
+	for _, s := range federatedSites(cfg) { sites[s.Name] = s }
+	latest := latestSample()
+	ps := &publicStatus{Title: cmp.Or(sp.Title, latest.Hostname+" status"), Time: now, State: "up", Components: []publicComponent{}, Incidents: []ReportIncident{}}
+	rank := map[string]int{"up": 0, "unknown": 1, "degraded": 2, "down": 3}
+	for c, comp := range sp.Components {
+		state := "unknown"
+		switch {
+		case comp.Check != "":
+			for _, p := range latest.Plugins { if pluginID(p) == comp.Check { state = alertState(checkLevel(p, true)) } }
+		case comp.Site != "":
+			if s, ok := sites[comp.Site]; ok && s.Failures >= federateDown {
+				state = "down"
+			} else if ok && s.Summary != nil {
+				state = alertState(s.Summary.Status)
+			}
+		case comp.Monitor != "": state = alertState(active[comp.Monitor])
+		default: state = alertState(mobileStatus(cfg).Status)
+		}
+		if rank[state] > rank[ps.State] { ps.State = state }
+		ps.Components = append(ps.Components, publicComponent{comp.Name, state, tracks[c].uptime()})
+		o := &tracks[c][2]
+		if o.cur != nil { o.cur.Open = true; o.list = append(o.list, *o.cur) }
+		ps.Incidents = append(ps.Incidents, o.list...)
+	}
+	sort.Slice(ps.Incidents, func(i, j int) bool { return ps.Incidents[i].Start > ps.Incidents[j].Start })
+	if len(ps.Incidents) > maxStatusIncidents { ps.Incidents = ps.Incidents[:maxStatusIncidents] }
+	for i := range ps.Incidents { ps.Incidents[i].Duration = ps.Incidents[i].End - ps.Incidents[i].Start }
+	return ps
+}
+
+// currentStatusPage works the page out again once statusPageTTL has passed.
+func currentStatusPage(cfg AppConfig) *publicStatus {
+	statusMutex.Lock(); defer statusMutex.Unlock()
+	if statusCache == nil || time.Since(statusCacheAt) > statusPageTTL {
+		statusCache, statusCacheAt = buildStatusPage(cfg, time.Now().Unix()), time.Now()
+	}
+	return statusCache
+}
+
+var statusTemplate = htmltpl.Must(htmltpl.New("status").Funcs(htmltpl.FuncMap{
+	"date": func(ts int64) string { return time.Unix(ts, 0).Format("2006-01-02 15:04") },
+	"dur":  fmtSeconds,
+	"pct":  func(v *float64) string { if v == nil { return "–" }; return strconv.FormatFloat(*v, 'f', 2, 64) + "%" },
+	"headline": func(state string) string {
+		switch state {
+		case "down": return "Some systems are down"
+		case "degraded": return "Some systems are degraded"
+		case "unknown": return "Some systems are not reporting"
+		}
+		return "All systems operational"
+	},
+}).Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><meta name="viewport" content="width=device-width,initial-scale=1"><meta http-equiv="refresh" content="60">
+<title>{{.Title}}</title>
+<style>body{font-family:Segoe UI,Arial,sans-serif;font-size:14px;color:#222;background:#f6f7f9;margin:0;padding:30px 12px;}main{max-width:720px;margin:0 auto;}
+.banner{padding:14px 18px;border-radius:6px;color:#fff;font-size:16px;margin:14px 0 22px;}.card{background:#fff;border:1px solid #e2e4e8;border-radius:6px;margin-bottom:22px;}
+.row{display:flex;align-items:center;padding:12px 16px;border-top:1px solid #eee;}.row:first-child{border-top:0;}.name{flex:1;}.up{color:#999;font-size:12px;margin-left:14px;}
+.dot{width:10px;height:10px;border-radius:50%;display:inline-block;margin-right:10px;}.s-up{background:#2e9e5b;}.s-degraded{background:#e0a800;}.s-down{background:#d9363e;}.s-unknown{background:#9aa0a6;}
+.muted{color:#888;font-size:12px;}</style></head>
+<body><main><h2 style="margin:0;">{{.Title}}</h2>
+<div class="banner s-{{.State}}">{{headline .State}}</div>
+<div class="card">{{range .Components}}<div class="row"><span class="dot s-{{.State}}"></span><span class="name">{{.Name}}</span><span class="muted">{{.State}}</span>
+<span class="up" title="24 hours">{{pct .Uptime.Day}}</span><span class="up" title="7 days">{{pct .Uptime.Week}}</span><span class="up" title="30 days">{{pct .Uptime.Month}}</span></div>
+{{end}}</div>
+<p class="muted" style="text-align:right;margin:-14px 0 22px;">Uptime over 24 hours, 7 days and 30 days</p>
+<h3>Incidents</h3>
+<div class="card">{{range .Incidents}}<div class="row"><span class="dot s-{{if eq .Level "CRITICAL"}}down{{else}}degraded{{end}}"></span><span class="name">{{.Name}}</span>
+<span class="muted">{{date .Start}}, {{if .Open}}ongoing{{else}}{{dur .Duration}}{{end}}</span></div>
+{{else}}<div class="row muted">No incidents in the last 30 days.</div>{{end}}</div>
+<p class="muted">Updated {{date .Time}}</p></main></body></html>`))
+
+// statusAllowed asks for status_page.password when one is set.
+func statusAllowed(w http.ResponseWriter, r *http.Request, sp StatusPage) bool {
+	if sp.Password == "" { return true }
+	if _, pass, ok := r.BasicAuth(); ok && subtle.ConstantTimeCompare([]byte(pass), []byte(sp.Password)) == 1 { return true }
+	w.Header().Set("WWW-Authenticate", `Basic realm="status"`)
+	http.Error(w, "unauthorized", http.StatusUnauthorized)
+	return false
+}
+
+func handleStatusPage(w http.ResponseWriter, r *http.Request) {
+	cfgMutex.RLock(); cfg := config; cfgMutex.RUnlock()
+	if len(cfg.StatusPage.Components) == 0 { http.NotFound(w, r); return }
+	if !statusAllowed(w, r, cfg.StatusPage) { return }
+	ps := currentStatusPage(cfg)
+	w.Header().Set("Cache-Control", "no-cache")
+	if r.URL.Path == "/public/status.json" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ps)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	statusTemplate.Execute(w, ps)
+}
+
+func validateStatusPage(c AppConfig, bad func(field, format string, a ...interface{})) {
+	seen := map[string]bool{}
+	for i, comp := range c.StatusPage.Components {
+		f := fmt.Sprintf("status_page.components[%d]", i)
+		if comp.Name == "" { bad(f, "name is required") }
+		if seen[comp.Name] { bad(f, "%s is listed twice", comp.Name) }
+		seen[comp.Name] = true
+		n := 0
+		for _, s := range []string{comp.Check, comp.Site, comp.Monitor} { if s != "" { n++ } }
+		if n > 1 { bad(f, "set one of check, site and monitor (or none for this host)") }
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+// --- STORAGE QUOTA ---
+// history_quota_mb caps the history file. After a snapshot that comes out larger, samples older than
+// an hour first lose their process, port and group lists (the bulk of each sample), and if that is
+// not enough the oldest samples go, leaving the file at about 90% of the quota; then it is saved
+// again. GET /api/v1/storage reports the size of every file Pulse keeps and the room left on disk.
+
+const quotaDetailAge = 3600
+
+type storageFile struct {
+	Name  string `json:"name"`
+	Path  string `json:"path"`
+	Bytes int64  `json:"bytes"`
+}
+
+type storageReport struct {
+	Files        []storageFile `json:"files"`
+	Total        int64         `json:"total"`
+	Samples      int           `json:"samples"`
+	Oldest       int64         `json:"oldest,omitempty"`
+	SampleBytes  int64         `json:"sample_bytes"` // history file bytes per sample
+	QuotaBytes   int64         `json:"quota_bytes,omitempty"`
+	Retention    int64         `json:"retention"` // seconds
+	Thinned      int64         `json:"thinned"`   // samples that lost their process lists to the quota
+	Evicted      int64         `json:"evicted"`   // samples dropped for the quota
+	LastEnforced int64         `json:"last_enforced,omitempty"`
+	DiskFree     uint64        `json:"disk_free"`
+	DiskFreePct  float64       `json:"disk_free_pct"`
+}
+
+var (
+	quotaMutex   sync.Mutex
+	quotaThinned int64
+	quotaEvicted int64
+	quotaLast    int64
+)
+
+func historyQuota() int64 {
+	cfgMutex.RLock(); mb := config.HistoryQuotaMB; cfgMutex.RUnlock()
+	return int64(mb) << 20
+}
+
+// enforceQuota brings the history file back under history_quota_mb, after a snapshot.
+func enforceQuota() error {
+	quota := historyQuota()
+	if quota <= 0 { return nil }
+	st, err := os.Stat(dbFile)
+	if err != nil || st.Size() <= quota { return nil }
+	size := st.Size()
+	thinned := 0
+	historyMutex.Lock()
+	cut := time.Now().Unix() - quotaDetailAge
+	for i := 0; i < history.Len(); i++ {
+		m := history.At(i)
+		if m.Timestamp >= cut { break }
+		if m.ProcessList != nil || m.OpenPorts != nil || m.Groups != nil { m.ProcessList, m.OpenPorts, m.Groups = nil, nil, nil; thinned++ }
+	}
+	historyMutex.Unlock()
+	if thinned > 0 {
+		if err := saveHistory(); err != nil { return err }
+		if st, err := os.Stat(dbFile); err == nil { size = st.Size() }
+	}
+	evicted := 0
+	if size > quota {
+		historyMutex.Lock()
+		if n := history.Len(); n > 1 {
+			drop := min(int(float64(n)*(1-0.9*float64(quota)/float64(size)))+1, n-1)
+			evicted = history.DropBefore(history.At(drop).Timestamp)
+		}
+		historyMutex.Unlock()
+		if evicted > 0 { if err := saveHistory(); err != nil { return err } }
+	}
+	quotaMutex.Lock(); quotaThinned += int64(thinned); quotaEvicted += int64(evicted); quotaLast = time.Now().Unix(); quotaMutex.Unlock()
+	storageLog.Warn("history over its quota", "quota_mb", quota>>20, "size_mb", st.Size()>>20, "thinned", thinned, "evicted", evicted)
+	return nil
+}
+
+// storageFiles lists the files Pulse writes, with the history's write-ahead log and the forwarding spools.
+func storageFiles() []storageFile {
+	var paths []string
+	for _, f := range backupFiles { paths = append(paths, f.path()) }
+	paths = append(paths, walPath(), walPath()+".old")
+	for _, f := range forwarders { paths = append(paths, spoolFile+"."+f.name) }
+	var res []storageFile
+	for _, p := range paths {
+		st, err := os.Stat(p)
+		if err != nil || st.IsDir() { continue }
+		res = append(res, storageFile{filepath.Base(p), p, st.Size()})
+	}
+	return res
+}
+
+func storageUsage() storageReport {
+	r := storageReport{Files: storageFiles(), QuotaBytes: historyQuota(), Retention: retentionSeconds()}
+	var historyBytes int64
+	for _, f := range r.Files {
+		r.Total += f.Bytes
+		if f.Path == dbFile { historyBytes = f.Bytes }
+	}
+	historyMutex.RLock()
+	r.Samples = history.Len()
+	if r.Samples > 0 { r.Oldest = history.At(0).Timestamp; r.SampleBytes = historyBytes / int64(r.Samples) }
+	historyMutex.RUnlock()
+	quotaMutex.Lock(); r.Thinned, r.Evicted, r.LastEnforced = quotaThinned, quotaEvicted, quotaLast; quotaMutex.Unlock()
+	if u, err := disk.Usage(filepath.Dir(dbFile)); err == nil { r.DiskFree, r.DiskFreePct = u.Free, 100-u.UsedPercent }
+	return r
+}
+
+func registerStorageAPI(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/v1/storage", func(w http.ResponseWriter, r *http.Request) { apiOK(w, 200, storageUsage(), nil) })
+}
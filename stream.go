@@ -0,0 +1,101 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// --- COMPACT STREAMING ---
+// /events?compact=1 sends the first sample whole and then only the fields that changed. The
+// process list goes out as "p_diff": {"set": [new or changed processes], "del": [pids gone]}, and
+// the client keeps the rest (the dashboard sorts it the way the server does). In both modes the
+// stream is compressed with zstd or gzip when the client accepts it, flushed after every event. A
+// client that doesn't take an event within streamWriteTimeout is disconnected.
+
+type procDiff struct {
+	Set []ProcessInfo `json:"set,omitempty"`
+	Del []int32       `json:"del,omitempty"`
+}
+
+// processDiff compares list with prev (the client's copy), updates prev and returns nil if nothing changed.
+func processDiff(list []ProcessInfo, prev map[int32]ProcessInfo) *procDiff {
+	d := &procDiff{}
+	seen := make(map[int32]bool, len(list))
+	for _, p := range list {
+		seen[p.PID] = true
+		if old, ok := prev[p.PID]; !ok || old != p { d.Set = append(d.Set, p); prev[p.PID] = p }
+	}
+	for pid := range prev { if !seen[pid] { d.Del = append(d.Del, pid); delete(prev, pid) } }
+	if len(d.Set) == 0 && len(d.Del) == 0 { return nil }
+	return d
+}
+
+func acceptsEncoding(header, enc string) bool {
+	for _, part := range strings.Split(header, ",") {
+		f := strings.Split(part, ";")
+		if strings.TrimSpace(f[0]) != enc { continue }
+		if len(f) > 1 && strings.ReplaceAll(strings.TrimSpace(f[1]), " ", "") == "q=0" { return false }
+		return true
+	}
+	return false
+}
+
+// compressStream picks zstd or gzip for w if r accepts it. flush pushes everything written so far to the client.
+func compressStream(w http.ResponseWriter, r *http.Request) (out io.Writer, flush func() error, done func()) {
+	w.Header().Add("Vary", "Accept-Encoding")
+	rc := http.NewResponseController(w)
+	flushHTTP := func() error { return rc.Flush() }
+	ae := r.Header.Get("Accept-Encoding")
+	if acceptsEncoding(ae, "zstd") {
+		// A small window keeps memory per client low and stays within what browsers accept.
+		if zw, err := zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.SpeedFastest), zstd.WithWindowSize(1<<20), zstd.WithEncoderConcurrency(1)); err == nil {
+			w.Header().Set("Content-Encoding", "zstd")
+			return zw, func() error { if err := zw.Flush(); err != nil { return err }; return flushHTTP() }, func() { zw.Close() }
+		}
+	}
+	if acceptsEncoding(ae, "gzip") {
+		gw, _ := gzip.NewWriterLevel(w, gzip.BestSpeed)
+		w.Header().Set("Content-Encoding", "gzip")
+		return gw, func() error { if err := gw.Flush(); err != nil { return err }; return flushHTTP() }, func() { gw.Close() }
+	}
+	return w, flushHTTP, func() {}
+}
+
+func handleEvents(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/event-stream"); w.Header().Set("Cache-Control", "no-cache"); w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no") // nginx would otherwise hold events back
+	out, flush, done := compressStream(w, r)
+	rc := http.NewResponseController(w)
+	defer done()
+	compact := r.URL.Query().Get("compact") == "1"
+	keys, _ := topicKeys(nil)
+	delete(keys, "p_list")
+	prev, procs := make(map[string]string), make(map[int32]ProcessInfo)
+	ch := samples.subscribe("sse"); defer samples.unsubscribe(ch)
+	for {
+		select {
+		case <-r.Context().Done(): return
+		case <-stopCtx.Done(): return
+		case m := <-ch:
+			var d []byte
+			if compact {
+				delta := fieldDelta(m, keys, prev)
+				if pd := processDiff(m.ProcessList, procs); pd != nil { delta["p_diff"], _ = json.Marshal(pd) }
+				d, _ = json.Marshal(delta)
+			} else {
+				d, _ = json.Marshal(m)
+			}
+			rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+			_, err := fmt.Fprintf(out, "data: %s\n\n", d)
+			if err == nil { err = flush() }
+			if err != nil { httpLog.Debug("stream client too slow or gone", "remote", r.RemoteAddr, "err", err); return }
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"net/http"
+	"net/netip"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// --- PORT TALKERS ---
+// Each process scan also lists established TCP connections; those whose local port is a listening
+// one are clients of it. A connection not seen in the previous scan counts as accepted, so the
+// accept rate and the busiest clients of every port can be answered for the last few minutes by
+// GET /api/v1/ports/{port}/clients. Connections opened and closed between two scans are missed.
+
+type tcpConn struct{ Local, Remote netip.AddrPort }
+
+type portClient struct {
+	IP       string `json:"ip"`
+	Open     int    `json:"open"`     // connections open now
+	Accepted int    `json:"accepted"` // new connections in the window
+}
+
+type portTalkers struct {
+	Port       int          `json:"port"`
+	Window     int          `json:"window"`      // seconds
+	Open       int          `json:"open"`        // connections open now
+	Accepted   int          `json:"accepted"`    // new connections in the window
+	AcceptRate float64      `json:"accept_rate"` // per second over the window
+	Clients    []portClient `json:"clients"`     // busiest first
+}
+
+const maxTalkerWindow = 300
+
+// talkScan holds what one scan saw: new connections per port and client.
+type talkScan struct {
+	ts  int64
+	new map[int]map[netip.Addr]int
+}
+
+var (
+	talkMutex sync.Mutex
+	talkSeen  map[tcpConn]bool // nil until the first scan, whose connections don't count as new
+	talkOpen  map[int]map[netip.Addr]int
+	talkScans []talkScan
+)
+
+func noteTalkers(listen []PortInfo, conns []tcpConn) {
+	ports := map[int]bool{}
+	for _, p := range listen { if p.Proto == "TCP" { ports[p.Port] = true } }
+	now := time.Now().Unix()
+	seen, open, scan := make(map[tcpConn]bool, len(conns)), map[int]map[netip.Addr]int{}, talkScan{ts: now, new: map[int]map[netip.Addr]int{}}
+	talkMutex.Lock(); defer talkMutex.Unlock()
+	for _, c := range conns {
+		port := int(c.Local.Port())
+		if !ports[port] { continue }
+		seen[c] = true
+		ip := c.Remote.Addr().Unmap()
+		if open[port] == nil { open[port] = map[netip.Addr]int{} }
+		open[port][ip]++
+		if talkSeen != nil && !talkSeen[c] {
+			if scan.new[port] == nil { scan.new[port] = map[netip.Addr]int{} }
+			scan.new[port][ip]++
+		}
+	}
+	first := talkSeen == nil
+	talkSeen, talkOpen = seen, open
+	if first { return }
+	talkScans = append(talkScans, scan)
+	drop := 0
+	for drop < len(talkScans) && talkScans[drop].ts < now-maxTalkerWindow { drop++ }
+	talkScans = talkScans[drop:]
+}
+
+// portClients sums the scans of the last window seconds for one port.
+func portClients(port, window int) portTalkers {
+	since := time.Now().Unix() - int64(window)
+	clients := map[netip.Addr]*portClient{}
+	get := func(ip netip.Addr) *portClient {
+		if clients[ip] == nil { clients[ip] = &portClient{IP: ip.String()} }
+		return clients[ip]
+	}
+	res := portTalkers{Port: port, Window: window, Clients: []portClient{}}
+	talkMutex.Lock()
+	for ip, n := range talkOpen[port] { get(ip).Open += n; res.Open += n }
+	for _, s := range talkScans {
+		if s.ts < since { continue }
+		for ip, n := range s.new[port] { get(ip).Accepted += n; res.Accepted += n }
+	}
+	talkMutex.Unlock()
+	res.AcceptRate = float64(res.Accepted) / float64(window)
+	for _, c := range clients { res.Clients = append(res.Clients, *c) }
+	sort.Slice(res.Clients, func(i, j int) bool {
+		a, b := res.Clients[i], res.Clients[j]
+		if a.Accepted != b.Accepted { return a.Accepted > b.Accepted }
+		if a.Open != b.Open { return a.Open > b.Open }
+		return a.IP < b.IP
+	})
+	return res
+}
+
+func handlePortClients(w http.ResponseWriter, r *http.Request) {
+	port, err := strconv.Atoi(r.PathValue("port"))
+	if err != nil || port < 1 || port > 65535 { apiFail(w, http.StatusBadRequest, apiError{"bad_request", "port must be a number from 1 to 65535", nil}); return }
+	window := 60
+	if v := r.URL.Query().Get("window"); v != "" {
+		if window, err = strconv.Atoi(v); err != nil || window < 1 || window > maxTalkerWindow { apiFail(w, http.StatusBadRequest, apiError{"bad_request", "window must be 1 to 300 seconds", nil}); return }
+	}
+	limit, offset, ok := pageParams(w, r)
+	if !ok { return }
+	dataMutex.RLock(); pts := latestPorts; dataMutex.RUnlock()
+	listening := false
+	for _, p := range pts { listening = listening || (p.Port == port && p.Proto == "TCP") }
+	if !listening { apiFail(w, http.StatusNotFound, apiError{"not_found", "nothing listens on TCP port " + r.PathValue("port"), nil}); return }
+	res := portClients(port, window)
+	lo, hi, meta := pageBounds(len(res.Clients), limit, offset)
+	res.Clients = res.Clients[lo:hi]
+	apiOK(w, 200, res, meta)
+}
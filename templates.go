@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- CONFIG TEMPLATES ---
+// config_templates are settings a Pulse with federate_sources pushes to its sites, so one edit
+// changes the alerting of a whole host group. A template holds top-level pulse.conf keys
+// (thresholds, scripts, heartbeats, routes, ...) and the groups it is for. A source gets the
+// templates of its group in config order, a later template's key replacing an earlier one's, and
+// then its own "overrides". That goes to the site's PATCH /api/v1/config as the source's user, who
+// must be an admin there; the site keeps its other settings, validates the push and records a
+// revision. A site is pushed after every config change here and when it comes back, whenever what
+// it should have differs from what it last accepted. Sites below a regional Pulse get that Pulse's
+// templates. Templates can't hold secrets (script and collector env included), since they are
+// shown with the rest of the config; set those on the sites.
+
+type ConfigTemplate struct {
+	Name   string                     `json:"name"`
+	Groups []string                   `json:"groups"`
+	Config map[string]json.RawMessage `json:"config"` // top-level pulse.conf keys, as for PATCH /api/v1/config
+}
+
+var fedKick = make(chan struct{}, 1) // pull and push now, after a config change
+
+// kickFederation wakes runFederation without waiting for it.
+func kickFederation() { select { case fedKick <- struct{}{}: default: } }
+
+// templatePatch is what src should have: its group's templates, then its overrides; nil if none apply.
+func templatePatch(cfg AppConfig, src FederateSource) map[string]json.RawMessage {
+	var patch map[string]json.RawMessage
+	set := func(keys map[string]json.RawMessage) {
+		if len(keys) > 0 && patch == nil { patch = map[string]json.RawMessage{} }
+		for k, v := range keys { patch[k] = v }
+	}
+	for _, t := range cfg.ConfigTemplates { if src.Group != "" && slices.Contains(t.Groups, src.Group) { set(t.Config) } }
+	set(src.Overrides)
+	return patch
+}
+
+func pushSite(src FederateSource, body []byte) error {
+	req, err := http.NewRequest("PATCH", strings.TrimSuffix(src.URL, "/")+"/api/v1/config", bytes.NewReader(body))
+	if err != nil { return err }
+	req.Header.Set("Content-Type", "application/json")
+	if src.User != "" { req.SetBasicAuth(src.User, src.Password) }
+	c := fedClient
+	if src.SkipVerify { c = fedSkip }
+	resp, err := c.Do(req)
+	if err != nil { return err }
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK { return nil }
+	// A rejected push names the settings the site refused.
+	var r struct{ Error apiError `json:"error"` }
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if json.Unmarshal(msg, &r) == nil && r.Error.Message != "" {
+		var fields []string
+		for _, f := range r.Error.Fields { fields = append(fields, f.Field+": "+f.Message) }
+		return fmt.Errorf("%s: %s %s", resp.Status, r.Error.Message, strings.Join(fields, "; "))
+	}
+	return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+}
+
+// pushTemplates sends every reachable source its templates and overrides, if they changed since it last accepted them.
+func pushTemplates(cfg AppConfig) {
+	var wg sync.WaitGroup
+	for _, src := range cfg.FederateSources {
+		patch := templatePatch(cfg, src)
+		if patch == nil { continue }
+		body, _ := json.Marshal(patch)
+		sum := sha256.Sum256(body)
+		hash := hex.EncodeToString(sum[:])
+		fedMutex.Lock(); st := fedSites[src.URL]; due := st != nil && st.Up && st.pushed != hash; fedMutex.Unlock()
+		if !due { continue }
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := redactError(cfg, pushSite(src, body))
+			fedMutex.Lock(); defer fedMutex.Unlock()
+			st := fedSites[src.URL]
+			if st == nil { return }
+			if err != nil {
+				if st.PushError != err.Error() { collectorLog.Warn("cannot push config templates", "url", src.URL, "err", err) }
+				st.PushError = err.Error(); return
+			}
+			st.pushed, st.Pushed, st.PushError = hash, time.Now().Unix(), ""
+			collectorLog.Info("pushed config templates", "url", src.URL, "keys", len(patch))
+			auditLog("config_push", map[string]interface{}{"site": st.Name, "url": src.URL, "keys": sortedKeys(patch)})
+		}()
+	}
+	wg.Wait()
+}
+
+func sortedKeys(m map[string]json.RawMessage) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m { keys = append(keys, k) }
+	sort.Strings(keys)
+	return keys
+}
+
+// checkTemplateKeys reports keys that aren't settings, don't decode, or carry secrets.
+func checkTemplateKeys(f string, keys map[string]json.RawMessage, kinds map[string]reflect.Kind, bad func(field, format string, a ...interface{})) {
+	for _, k := range sortedKeys(keys) {
+		if kinds[k] == reflect.Invalid || k == "users" { bad(f+"."+k, "not a setting a template can push"); continue }
+		var probe AppConfig
+		if err := json.Unmarshal([]byte(`{"`+k+`":`+string(keys[k])+`}`), &probe); err != nil { bad(f+"."+k, "%v", err); continue }
+		secret := false
+		eachSecret(&probe, func(s *string) { secret = secret || *s != "" })
+		if secret { bad(f+"."+k, "templates can't hold secrets; set them on the sites") }
+	}
+}
+
+func validateTemplates(c AppConfig, bad func(field, format string, a ...interface{})) {
+	kinds, seen := configKinds(), map[string]bool{}
+	for i, t := range c.ConfigTemplates {
+		f := fmt.Sprintf("config_templates[%d]", i)
+		if t.Name == "" { bad(f, "name is required") } else if seen[t.Name] { bad(f, "%q is listed twice", t.Name) }
+		seen[t.Name] = true
+		if len(t.Groups) == 0 { bad(f, "groups is required") }
+		checkTemplateKeys(f+".config", t.Config, kinds, bad)
+	}
+	for i, s := range c.FederateSources { checkTemplateKeys(fmt.Sprintf("federate_sources[%d].overrides", i), s.Overrides, kinds, bad) }
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// --- HTTPS ---
+// acme_domain takes precedence (Let's Encrypt via TLS-ALPN on this listener and HTTP-01 on :80),
+// then tls_cert/tls_key, then tls_self_signed, which creates pulse.crt/pulse.key on first run.
+// Without any of them the dashboard is served over plain HTTP as before.
+
+var (
+	selfCertFile   = "pulse.crt"
+	selfKeyFile    = "pulse.key"
+	defaultACMEDir = "pulse-acme"
+)
+
+// certReloader serves a cert/key pair from disk and re-reads it when the files change, so renewals need no restart.
+type certReloader struct {
+	cert, key string
+	mu        sync.Mutex
+	loaded    *tls.Certificate
+	mod       time.Time
+}
+
+func (c *certReloader) get(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.Lock(); defer c.mu.Unlock()
+	st, err := os.Stat(c.cert)
+	if err == nil && (c.loaded == nil || st.ModTime().After(c.mod)) {
+		crt, e := tls.LoadX509KeyPair(c.cert, c.key)
+		if e == nil { c.loaded, c.mod = &crt, st.ModTime() } else if c.loaded == nil { return nil, e }
+	}
+	if c.loaded == nil { return nil, err }
+	return c.loaded, nil
+}
+
+// writeSelfSigned creates a 2-year ECDSA certificate for the hostname, localhost and every local IP.
+func writeSelfSigned(certFile, keyFile string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil { return err }
+	host, _ := os.Hostname()
+	serial, _ := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	tpl := &x509.Certificate{
+		SerialNumber: serial, Subject: pkix.Name{CommonName: host, Organization: []string{"Pulse self-signed"}},
+		NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().AddDate(2, 0, 0),
+		KeyUsage: x509.KeyUsageDigitalSignature, ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames: []string{host, "localhost"},
+	}
+	if addrs, err := net.InterfaceAddrs(); err == nil {
+		for _, a := range addrs { if ipn, ok := a.(*net.IPNet); ok { tpl.IPAddresses = append(tpl.IPAddresses, ipn.IP) } }
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &key.PublicKey, key)
+	if err != nil { return err }
+	kb, err := x509.MarshalECPrivateKey(key)
+	if err != nil { return err }
+	if err = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: kb}), 0600); err != nil { return err }
+	return os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)
+}
+
+// tlsSetup returns the TLS config for the configured mode, or nil for plain HTTP.
+func tlsSetup(cfg AppConfig) (*tls.Config, error) {
+	if cfg.ACMEDomain != "" {
+		dir := cfg.ACMECacheDir
+		if dir == "" { dir = defaultACMEDir }
+		m := &autocert.Manager{Prompt: autocert.AcceptTOS, HostPolicy: autocert.HostWhitelist(cfg.ACMEDomain), Email: cfg.ACMEEmail, Cache: autocert.DirCache(dir)}
+		go func() {
+			if err := http.ListenAndServe(":80", m.HTTPHandler(nil)); err != nil { httpLog.Error("ACME HTTP-01 listener failed", "err", err) }
+		}()
+		return &tls.Config{GetCertificate: m.GetCertificate, NextProtos: []string{"h2", "http/1.1", acme.ALPNProto}, MinVersion: tls.VersionTLS12}, nil
+	}
+	cert, key := cfg.TLSCert, cfg.TLSKey
+	if cert == "" && cfg.TLSSelfSigned {
+		cert, key = selfCertFile, selfKeyFile
+		if _, err := os.Stat(cert); os.IsNotExist(err) {
+			if err := writeSelfSigned(cert, key); err != nil { return nil, fmt.Errorf("self-signed certificate: %w", err) }
+			httpLog.Info("generated self-signed certificate", "file", cert)
+		}
+	}
+	if cert == "" { return nil, nil }
+	r := &certReloader{cert: cert, key: key}
+	if _, err := r.get(nil); err != nil { return nil, err }
+	return &tls.Config{GetCertificate: r.get, MinVersion: tls.VersionTLS12}, nil
+}
+
+func serve(addr string, h http.Handler) error {
+	cfgMutex.RLock(); cfg := config; cfgMutex.RUnlock()
+	tc, err := tlsSetup(cfg)
+	if err != nil { return err }
+	srv := trackServer(newServer(addr, h))
+	srv.TLSConfig = tc
+	if tc == nil {
+		httpLog.Info("listening", "url", displayURL("http", addr))
+		return srv.ListenAndServe()
+	}
+	httpLog.Info("listening", "url", displayURL("https", addr))
+	return srv.ListenAndServeTLS("", "")
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"sort"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// --- TERMINAL UI ---
+// "pulse tui" runs the collectors in-process and draws charts, the busiest processes and the alert
+// state in the terminal, for servers where the dashboard port can't be opened. It only looks: it
+// serves no HTTP, writes no history and sends no notifications or remediations, so it can run
+// next to the Pulse service without doubling its alerts. Logs go to log_file, if set, or nowhere.
+
+// observeOnly is set by "pulse tui" and "pulse check": collect and evaluate, but keep no history and send nothing.
+var observeOnly bool
+
+var tuiSorts = []string{"cpu", "mem", "io", "pid", "name"}
+
+type tuiView struct {
+	scr  tcell.Screen
+	sort int
+	top  int // first process row shown
+}
+
+func (v *tuiView) text(x, y int, s string, st tcell.Style) int {
+	for _, r := range s { v.scr.SetContent(x, y, r, nil, st); x++ }
+	return x
+}
+
+// chart draws the last w values as bars h rows high, scaled to 0..scale (or the largest value when scale is 0).
+func (v *tuiView) chart(x, y, w, h int, title string, vals []float64, scale float64, unit func(float64) string, col tcell.Color) {
+	if len(vals) > w { vals = vals[len(vals)-w:] }
+	hi := scale
+	for _, val := range vals { if scale == 0 && val > hi { hi = val } }
+	now := "-"
+	if len(vals) > 0 { now = unit(vals[len(vals)-1]) }
+	v.text(x, y, fmt.Sprintf("%s %s", title, now), tcell.StyleDefault.Bold(true))
+	if hi <= 0 { hi = 1 }
+	bars := []rune(" ▁▂▃▄▅▆▇█")
+	st := tcell.StyleDefault.Foreground(col)
+	for i, val := range vals {
+		eighths := int(val / hi * float64(h*8))
+		for row := 0; row < h; row++ {
+			n := min(max(eighths-row*8, 0), 8)
+			v.scr.SetContent(x+w-len(vals)+i, y+h-row, bars[n], nil, st)
+		}
+	}
+}
+
+func (v *tuiView) draw() {
+	v.scr.Clear()
+	w, h := v.scr.Size()
+	m := latestSample()
+	historyMutex.RLock(); list := history.Copy(max(history.Len()-w, 0), history.Len()); historyMutex.RUnlock()
+	dim := tcell.StyleDefault.Foreground(tcell.ColorGray)
+	x := v.text(0, 0, " PULSE ", tcell.StyleDefault.Reverse(true).Bold(true))
+	if m.Timestamp == 0 { v.text(x+1, 0, "collecting...", dim); v.scr.Show(); return }
+	x = v.text(x+1, 0, fmt.Sprintf("%s  up %s  load %.2f  procs %d", m.Hostname, humanUptime(m.Uptime), m.Load1, m.Procs), tcell.StyleDefault)
+	help := "q quit  s sort:" + tuiSorts[v.sort] + "  ↑↓ scroll"
+	v.text(max(x+2, w-len([]rune(help))-1), 0, help, dim)
+
+	// Two rows of two charts.
+	cw, ch := (w-3)/2, 4
+	pct := func(f float64) string { return fmt.Sprintf("%.1f%%", f) }
+	bytes := func(f float64) string { return humanBytes(f) }
+	var cpu, mem, net, dio []float64
+	for i, s := range list {
+		cpu, mem, net = append(cpu, s.CPUTotal), append(mem, s.MemUsed), append(net, float64(s.NetDown+s.NetUp))
+		// Disk counters are totals since boot; chart what moved since the previous sample.
+		if i > 0 && s.DiskRead+s.DiskWrite >= list[i-1].DiskRead+list[i-1].DiskWrite { dio = append(dio, float64(s.DiskRead+s.DiskWrite-list[i-1].DiskRead-list[i-1].DiskWrite)) }
+	}
+	v.chart(1, 2, cw, ch, "CPU", cpu, 100, pct, tcell.ColorGreen)
+	v.chart(cw+2, 2, cw, ch, "MEM", mem, 100, pct, tcell.ColorBlue)
+	v.chart(1, 3+ch, cw, ch, "NET rx+tx", net, 0, bytes, tcell.ColorYellow)
+	v.chart(cw+2, 3+ch, cw, ch, fmt.Sprintf("DISK %.0f%% used, io", m.DiskUsed), dio, 0, bytes, tcell.ColorPurple)
+
+	// Alerts
+	y := 4 + 2*ch
+	cfgMutex.RLock(); cfg := config; cfgMutex.RUnlock()
+	x = v.text(1, y, "ALERTS ", tcell.StyleDefault.Bold(true))
+	alerts := currentAlerts(cfg)
+	if len(alerts) == 0 { v.text(x, y, "all clear", tcell.StyleDefault.Foreground(tcell.ColorGreen)) }
+	sort.SliceStable(alerts, func(i, j int) bool { return alerts[i].Level == "CRITICAL" && alerts[j].Level != "CRITICAL" })
+	for _, a := range alerts {
+		col := tcell.ColorYellow
+		if a.Level == "CRITICAL" { col = tcell.ColorRed }
+		x = v.text(x, y, a.Monitor, tcell.StyleDefault.Foreground(col).Bold(true)) + 2
+	}
+
+	// Processes
+	y += 2
+	v.text(1, y, fmt.Sprintf("%7s  %-28s %6s %9s %9s %9s", "PID", "NAME", "CPU%", "MEM", "READ/s", "WRITE/s"), tcell.StyleDefault.Reverse(true))
+	procs := append([]ProcessInfo(nil), m.ProcessList...)
+	less := map[string]func(a, b ProcessInfo) bool{
+		"cpu": func(a, b ProcessInfo) bool { return a.CPU > b.CPU }, "mem": func(a, b ProcessInfo) bool { return a.Mem > b.Mem },
+		"io":  func(a, b ProcessInfo) bool { return a.DiskRead+a.DiskWrite > b.DiskRead+b.DiskWrite },
+		"pid": func(a, b ProcessInfo) bool { return a.PID < b.PID }, "name": func(a, b ProcessInfo) bool { return strings.ToLower(a.Name) < strings.ToLower(b.Name) },
+	}[tuiSorts[v.sort]]
+	sort.SliceStable(procs, func(i, j int) bool { return less(procs[i], procs[j]) })
+	v.top = min(v.top, max(len(procs)-(h-y-1), 0))
+	for i, p := range procs[v.top:] {
+		if y+1+i >= h { break }
+		name := p.Name
+		if len(name) > 28 { name = name[:27] + "~" }
+		v.text(1, y+1+i, fmt.Sprintf("%7d  %-28s %6.1f %9s %9s %9s", p.PID, name, p.CPU, humanBytes(p.Mem), humanBytes(float64(p.DiskRead)), humanBytes(float64(p.DiskWrite))), tcell.StyleDefault)
+	}
+	v.scr.Show()
+}
+
+func runTUI() error {
+	observeOnly = true
+	loadConfig()
+	useDataFile(config)
+	loadHistory()
+	cfgMutex.RLock(); logFile := config.LogFile; cfgMutex.RUnlock()
+	if logFile == "" { logState.Lock(); logState.handler = slog.NewTextHandler(io.Discard, nil); logState.Unlock() }
+	scr, err := tcell.NewScreen()
+	if err != nil { return err }
+	if err := scr.Init(); err != nil { return err }
+	defer scr.Fini()
+	go startCollector()
+	defer stopAll()
+	v := &tuiView{scr: scr}
+	keys := make(chan tcell.Event, 8)
+	go func() { for { ev := scr.PollEvent(); if ev == nil { return }; keys <- ev } }()
+	ch := samples.subscribe("tui"); defer samples.unsubscribe(ch)
+	v.draw()
+	for {
+		select {
+		case <-ch:
+		case ev := <-keys:
+			switch ev := ev.(type) {
+			case *tcell.EventResize: scr.Sync()
+			case *tcell.EventKey:
+				switch {
+				case ev.Key() == tcell.KeyEscape || ev.Key() == tcell.KeyCtrlC || ev.Rune() == 'q': return nil
+				case ev.Rune() == 's': v.sort = (v.sort + 1) % len(tuiSorts); v.top = 0
+				case ev.Key() == tcell.KeyDown: v.top++
+				case ev.Key() == tcell.KeyUp: v.top = max(v.top-1, 0)
+				case ev.Key() == tcell.KeyPgDn: v.top += 10
+				case ev.Key() == tcell.KeyPgUp: v.top = max(v.top-10, 0)
+				}
+			}
+		}
+		v.draw()
+	}
+}
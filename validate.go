@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"path"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// --- CONFIG VALIDATION ---
+// POST /config (and PATCH /api/v1/config) merges the posted keys into the current config, so a client that only sends
+// {"cpu_warn": 85} changes just that. The result is checked as a whole and rejected with a
+// list of field errors, leaving the running config untouched.
+
+type fieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// mergeConfig overlays the top-level keys present in body on top of cur.
+func mergeConfig(cur AppConfig, body []byte) (AppConfig, []fieldError) {
+	var patch map[string]json.RawMessage
+	if err := json.Unmarshal(body, &patch); err != nil { return cur, []fieldError{{"", "invalid JSON: " + err.Error()}} }
+	b, _ := json.Marshal(cur)
+	var m map[string]json.RawMessage
+	json.Unmarshal(b, &m)
+	kinds := configKinds()
+	var errs []fieldError
+	keys := make([]string, 0, len(patch))
+	for k := range patch { keys = append(keys, k) }
+	sort.Strings(keys)
+	for _, k := range keys {
+		v := patch[k]
+		if kinds[k] == reflect.Invalid { errs = append(errs, fieldError{k, "unknown setting"}); continue }
+		var probe AppConfig
+		if err := json.Unmarshal([]byte(`{"`+k+`":`+string(v)+`}`), &probe); err != nil { errs = append(errs, fieldError{k, err.Error()}); continue }
+		m[k] = v
+	}
+	if len(errs) > 0 { return cur, errs }
+	var c AppConfig
+	b, _ = json.Marshal(m)
+	json.Unmarshal(b, &c)
+	return c, nil
+}
+
+// updateConfig merges body into the running config and saves it, or changes nothing and returns the
+// errors: the invalid fields, or why pulse.conf could not be written.
+func updateConfig(body []byte, user, source string) ([]fieldError, error) {
+	cfgMutex.RLock(); cur := config; cfgMutex.RUnlock()
+	c, errs := mergeConfig(cur, body)
+	if errs == nil { keepSecrets(&c, cur); applyOverrides(&c); errs = validateConfig(c) }
+	if len(errs) > 0 { return errs, nil }
+	// Users are managed with "pulse passwd", so a settings form without them must not remove them.
+	cfgMutex.Lock(); if c.Users == nil { c.Users = config.Users }; config = c; cfgMutex.Unlock()
+	if err := saveConfig(); err != nil {
+		configLog.Error("cannot save config", "err", err)
+		cfgMutex.Lock(); config = cur; cfgMutex.Unlock()
+		return nil, fmt.Errorf("cannot save %s: %w", confFile, err)
+	}
+	recordRevision(c, user, source)
+	if ch := configDiff(cur, c); len(ch) > 0 { auditLog("config_change", map[string]interface{}{"user": user, "source": source, "changes": ch}) }
+	kickFederation()
+	return nil, nil
+}
+
+func validateConfig(c AppConfig) []fieldError {
+	var errs []fieldError
+	bad := func(field, format string, a ...interface{}) { errs = append(errs, fieldError{field, fmt.Sprintf(format, a...)}) }
+	for _, t := range []struct{ name string; w, c float64 }{{"cpu", c.CpuWarn, c.CpuCrit}, {"mem", c.MemWarn, c.MemCrit}, {"dsk", c.DskWarn, c.DskCrit}} {
+		if t.w < 0 || t.w > 100 { bad(t.name+"_warn", "must be between 0 and 100") }
+		if t.c < 0 || t.c > 100 { bad(t.name+"_crit", "must be between 0 and 100") }
+		if t.w > 0 && t.c > 0 && t.w >= t.c { bad(t.name+"_warn", "must be below %s_crit (%g)", t.name, t.c) }
+	}
+	for _, iv := range []struct{ name string; v int }{{"global_int", c.GlobalInt}, {"process_int", c.ProcessInt}, {"script_int", c.ScriptInt}, {"script_timeout", c.ScriptTimeout}, {"script_workers", c.ScriptWorkers}} {
+		if iv.v < 1 { bad(iv.name, "must be at least 1") }
+	}
+	if c.ProcessLimit < 0 { bad("process_limit", "must be at least 1") }
+	for _, name := range c.EBPF { if !slices.Contains(ebpfCollectors, name) { bad("ebpf", "unknown collector %q (exec, retransmits, disk_latency)", name) } }
+	if c.SmtpPort < 0 || c.SmtpPort > 65535 { bad("smtp_port", "must be between 1 and 65535") }
+	if c.SmtpTLS != "" && c.SmtpTLS != "auto" && c.SmtpTLS != "tls" && c.SmtpTLS != "starttls" && c.SmtpTLS != "none" { bad("smtp_tls", "must be auto, tls, starttls or none") }
+	if c.EmailSubject != "" || c.EmailBody != "" {
+		if _, _, _, err := renderEmail(c, AlertEvent{Monitor: "CPU", Level: "CRITICAL", Value: 99, Message: "test"}); err != nil { bad("email_body", "%v", err) }
+	}
+	for i, s := range c.Scripts {
+		f := fmt.Sprintf("scripts[%d]", i)
+		switch {
+		case s.builtin() && builtinChecks[s.Type] == nil && s.Type != "scrape": bad(f, "unknown check type %q", s.Type)
+		case !s.builtin() && strings.TrimSpace(s.Command) == "": bad(f, "command is empty")
+		case strings.Contains(s.Command, "{{"):
+			if _, err := template.New("cmd").Parse(s.Command); err != nil { bad(f, "bad command template: %v", err) }
+		}
+		if s.Interval < 0 || s.Timeout < 0 || s.For < 0 { bad(f, "interval, timeout and for can't be negative") }
+		if s.Type == "scrape" && !strings.HasPrefix(s.Target, "http://") && !strings.HasPrefix(s.Target, "https://") { bad(f, "target must be the http:// or https:// address of a /metrics page") }
+		if s.Type == "regex" || s.Type == "dir_count" || s.Type == "dir_size" || s.Type == "scrape" { if _, err := regexp.Compile(s.Pattern); err != nil { bad(f, "bad pattern: %v", err) } }
+		for _, r := range []string{s.Warn, s.Crit} { if _, err := rangeInUnit(r, checkUnits[s.Type]); err != nil { bad(f, "%v", err) } }
+	}
+	for i, hb := range c.Heartbeats { if hb.Interval < 1 { bad(fmt.Sprintf("heartbeats[%d]", i), "%s: interval must be at least 1 second", hb.Name) } }
+	for i, rc := range c.Remediations {
+		if rc.Monitor == "" || strings.TrimSpace(rc.Command) == "" { bad(fmt.Sprintf("remediations[%d]", i), "monitor and command are required") }
+	}
+	for i, r := range c.Routes {
+		f := fmt.Sprintf("routes[%d]", i)
+		for _, p := range []string{r.Monitor, r.Host} { if _, err := regexp.Compile(p); err != nil { bad(f, "bad pattern: %v", err) } }
+		for _, hm := range []string{r.From, r.To} { if _, err := time.Parse("15:04", hm); hm != "" && err != nil { bad(f, "from/to must be HH:MM") } }
+		for _, ch := range r.Channels { if notifiers[ch] == nil { bad(f, "unknown channel %q", ch) } }
+	}
+	for i, r := range c.RateRules {
+		f := fmt.Sprintf("rate_rules[%d]", i)
+		if r.Window < 1 { bad(f, "window must be at least 1 second") }
+		if r.Mode != "" && r.Mode != "abs" && r.Mode != "pct" && r.Mode != "ratio" && r.Mode != "to" { bad(f, "mode must be abs, pct, ratio or to") }
+		if r.Level != "" && r.Level != "WARNING" && r.Level != "CRITICAL" { bad(f, "level must be WARNING or CRITICAL") }
+	}
+	validateGroupRules(c, bad)
+	validateLoad(c, bad)
+	validateARP(c, bad)
+	validateExpectedPorts(c, bad)
+	validateFederation(c, bad)
+	validateFleetGroups(c, bad)
+	validateTemplates(c, bad)
+	validateHostMeta(c, bad)
+	validateCollectors(c, bad)
+	validateMetricRules(c, bad)
+	validateStatsd(c, bad)
+	validateDerived(c, bad)
+	validateMetricCatalog(c, bad)
+	validateReports(c, bad)
+	validateStatusPage(c, bad)
+	validateLimits(c, bad)
+	validateAllowFrom(c, bad)
+	if c.AnomalyLevel != "" && c.AnomalyLevel != "WARNING" && c.AnomalyLevel != "CRITICAL" { bad("anomaly_level", "must be WARNING or CRITICAL") }
+	if c.ForecastMethod != "" && c.ForecastMethod != "linear" && c.ForecastMethod != "holt" { bad("forecast_method", "must be linear or holt") }
+	if c.DigestTime != "" { if _, err := time.Parse("15:04", c.DigestTime); err != nil { bad("digest_time", "must be HH:MM") } }
+	if c.DigestSchedule != "" && c.DigestSchedule != "daily" && c.DigestSchedule != "weekly" { bad("digest_schedule", "must be daily or weekly") }
+	if a := listenAddr(c); a != "" { if _, _, err := net.SplitHostPort(a); err != nil { bad("listen", "%v", err) } }
+	if c.AdminListen != "" { if err := loopbackOnly(c.AdminListen); err != nil { bad("admin_listen", "%v", err) } }
+	for _, p := range c.TrustedProxies {
+		if _, _, err := net.ParseCIDR(p); err != nil && net.ParseIP(p) == nil { bad("trusted_proxies", "%q is not an IP address or CIDR", p) }
+	}
+	for _, o := range c.CORSOrigins {
+		if u, err := url.Parse(o); o != "*" && (err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || strings.Trim(u.Path, "/") != "") { bad("cors_origins", "%q must be * or scheme://host[:port]", o) }
+	}
+	if _, err := parseLevel(c.LogLevel); err != nil { bad("log_level", "must be debug, info, warn or error") }
+	for sub, l := range c.LogLevels {
+		if !slices.Contains(logSubsystems, sub) { bad("log_levels."+sub, "unknown subsystem (%s)", strings.Join(logSubsystems, ", ")) }
+		if _, err := parseLevel(l); err != nil { bad("log_levels."+sub, "must be debug, info, warn or error") }
+	}
+	if c.LogFormat != "" && c.LogFormat != "text" && c.LogFormat != "json" { bad("log_format", "must be text or json") }
+	if c.LogMaxSize < 0 { bad("log_max_size", "must not be negative") }
+	if c.LogMaxFiles < 0 { bad("log_max_files", "must not be negative") }
+	for _, v := range strings.Split(c.AlertmanagerURL, ",") {
+		if u, err := url.Parse(strings.TrimSpace(v)); c.AlertmanagerURL != "" && (err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "") { bad("alertmanager_url", "must be http:// or https:// URLs, separated by commas") }
+	}
+	for k := range c.AlertmanagerLabels { if !promLabel.MatchString(k) { bad("alertmanager_labels", "%q is not a valid label name", k) } }
+	if c.PushContact != "" && !strings.HasPrefix(c.PushContact, "mailto:") && !strings.HasPrefix(c.PushContact, "https://") { bad("push_contact", "must be a mailto: or https:// URL") }
+	validatePanels(c.Panels, bad)
+	if _, err := parseRetention(c.Retention); c.Retention != "" && err != nil { bad("retention", "%v", err) }
+	if c.SaveInterval != 0 && (c.SaveInterval < 5 || c.SaveInterval > 3600) { bad("save_interval", "must be 5-3600 seconds") }
+	if strings.HasSuffix(c.DataFile, "/") || strings.HasSuffix(c.DataFile, `\`) { bad("data_file", "must be a file, not a directory") }
+	c.DefaultPreferences.validate(func(field, format string, a ...interface{}) { bad("default_preferences."+field, format, a...) })
+	for f, v := range map[string]string{"influx_url": c.InfluxURL, "remote_write_url": c.RemoteWriteURL} {
+		if u, err := url.Parse(v); v != "" && (err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "") { bad(f, "must be an http:// or https:// URL") }
+	}
+	if c.ForwardBatch < 0 { bad("forward_batch", "must not be negative") }
+	if c.ForwardBuffer < 0 { bad("forward_buffer", "must not be negative") }
+	if c.HistoryQuotaMB < 0 { bad("history_quota_mb", "must not be negative") }
+	if c.ForwardSpoolMB < 0 { bad("forward_spool_mb", "must not be negative") }
+	for f, v := range map[string]string{"graphite_addr": c.GraphiteAddr, "statsd_addr": c.StatsdAddr} {
+		if _, _, err := net.SplitHostPort(v); v != "" && err != nil { bad(f, "must be host:port") }
+	}
+	if c.MetricsInterval < 0 { bad("metrics_interval", "must not be negative") }
+	if c.PassiveType != "" && c.PassiveType != "icinga2" && c.PassiveType != "nrdp" && c.PassiveType != "command_file" { bad("passive_type", "must be icinga2, nrdp or command_file") }
+	if c.PassiveType != "" && c.PassiveTarget == "" { bad("passive_target", "required when passive_type is set") }
+	if c.PassiveInterval < 0 { bad("passive_interval", "must not be negative") }
+	for _, p := range c.MetricsWhitelist { if _, err := path.Match(p, ""); err != nil { bad("metrics_whitelist", "bad pattern %q", p) } }
+	return errs
+}
@@ -0,0 +1 @@
+// Runs after pulse.js: put a custom.js in --web-dir to extend the dashboard without replacing the rest.
@@ -0,0 +1,842 @@
+const STATE = { data: [], mode: 'live', dur: 1800, rStart: 0, rEnd: 0, pkey: null, charts: [], plugins: {} };
+const fmtBytes = (v) => { const u=['B','K','M','G']; let i=0; while(v>=1024&&i<3){v/=1024;i++} return v.toFixed(1)+u[i]; }
+// Scales as the metric catalog (api/v1/catalog) names them: bytes in 1024s, si in 1000s, anything else as is.
+const unitScale = (unit) => unit === 'B' || (unit||'').startsWith('B/') ? 'bytes' : '';
+const fmtScaled = (v, scale, d) => {
+    if(scale === 'bytes') return fmtBytes(v);
+    const u=['','k','M','G','T']; let i=0;
+    if(scale === 'si') while(Math.abs(v)>=1000&&i<4){v/=1000;i++}
+    return v.toFixed(d === undefined ? 1 : d)+u[i];
+};
+const fmtUnit = (v, unit, scale) => {
+    const t = fmtScaled(v, scale);
+    if(!unit || unit === 'B') return t;
+    if(scale === 'bytes' && unit.startsWith('B/')) return t + unit.slice(1);
+    return unit === '%' ? t + '%' : t + ' ' + unit;
+};
+
+function loadRevisions() {
+    fetch('config/revisions').then(r=>r.json()).then(list => {
+        const fmt = v => v === undefined ? '' : JSON.stringify(v).replace(/</g, '&lt;');
+        document.getElementById("revisions").innerHTML = list.slice(0, 20).map((r, i) => '<div style="margin-bottom:6px;"><b>#' + r.id + '</b> ' + new Date(r.time*1000).toLocaleString() + ' ' + r.source + (r.user ? ' by ' + r.user : '') +
+            (i > 0 ? ' <button onclick="rollback(' + r.id + ')">Roll back</button>' : ' (current)') +
+            (r.changes||[]).map(c => '<div style="color:#999; margin-left:10px;">' + c.key + ': ' + fmt(c.from) + ' &rarr; ' + fmt(c.to) + '</div>').join("") + '</div>').join("");
+    });
+}
+function rollback(id) {
+    if (!confirm("Roll back to revision #" + id + "?")) return;
+    fetch('config/rollback?id=' + id, {method: 'POST'}).then(r => r.text().then(t => {
+        if (!r.ok) { alert(t); return; }
+        closeSettings(); alert("Rolled back to #" + id + ".");
+    }));
+}
+function openSettings() {
+    document.getElementById("test-result").innerText = "";
+    loadRevisions();
+    fetch('notify/test').then(r=>r.json()).then(list => {
+        document.getElementById("in-test-chan").innerHTML = list.map(n => '<option>' + n + '</option>').join("");
+    });
+    fetch('config').then(r=>r.json()).then(c => {
+        const s = (id, val) => document.getElementById(id).value = val || "";
+        s("in-cpu-f",c.cpu_for); s("in-mem-f",c.mem_for); s("in-dsk-f",c.dsk_for);
+        s("in-cpu-w",c.cpu_warn); s("in-cpu-c",c.cpu_crit); s("in-mem-w",c.mem_warn); s("in-mem-c",c.mem_crit);
+        s("in-dsk-w",c.dsk_warn); s("in-dsk-c",c.dsk_crit); s("in-load-w",c.load_warn); s("in-load-c",c.load_crit); s("in-load-f",c.load_for); s("in-smtp-host",c.smtp_host); s("in-smtp-port",c.smtp_port);
+        s("in-smtp-user",c.smtp_user); s("in-smtp-pass",c.smtp_pass); s("in-email-to",c.email_to);
+        s("in-email-from",c.email_from); s("in-smtp-tls",c.smtp_tls); s("in-smtp-ca",c.smtp_ca); s("in-email-subj",c.email_subject); s("in-email-body",c.email_body);
+        document.getElementById("in-smtp-skip").checked = !!c.smtp_skip_verify;
+        s("in-tls-cert",c.tls_cert); s("in-tls-key",c.tls_key); s("in-acme-domain",c.acme_domain); s("in-acme-email",c.acme_email); s("in-acme-dir",c.acme_cache_dir);
+        s("in-listen",c.listen); s("in-listen-sock",c.listen_socket); s("in-admin-listen",c.admin_listen); s("in-base-path",c.base_path);
+        s("in-proxies",(c.trusted_proxies||[]).join(",")); s("in-cors",(c.cors_origins||[]).join(",")); s("in-rate",c.rate_limit||""); s("in-burst",c.rate_burst||"");
+        const af = c.allow_from || {}; s("in-allow-dash",(af.dashboard||[]).join(", ")); s("in-allow-api",(af.api||[]).join(", ")); s("in-allow-ingest",(af.ingest||[]).join(", "));
+        document.getElementById("in-tls-self").checked = !!c.tls_self_signed;
+        document.getElementById("in-debug").checked = !!c.debug_endpoints;
+        s("in-log-lvl",c.log_level); s("in-log-fmt",c.log_format); s("in-log-file",c.log_file);
+        const meta = c.host_meta || {};
+        s("in-meta-tags",(meta.tags||[]).join(", ")); s("in-meta-env",meta.environment); s("in-meta-owner",meta.owner); s("in-meta-loc",meta.location);
+        s("in-meta-labels",Object.entries(meta.labels||{}).map(([k,v]) => k + "=" + v).join(", "));
+        s("in-fc-days",c.forecast_days); s("in-fc-method",c.forecast_method); s("in-arp-subnets",(c.arp_subnets||[]).join(", ")); s("in-exp-ports",(c.expected_ports||[]).join(", "));
+        s("in-an-sigma",c.anomaly_sigma); s("in-an-min",c.anomaly_min_samples); s("in-an-lvl",c.anomaly_level);
+        s("in-dg-sched",c.digest_schedule); s("in-dg-time",c.digest_time); s("in-dg-day",c.digest_day); s("in-dg-to",c.digest_email_to); s("in-dg-hook",c.digest_webhook); s("in-sla-target",c.sla_target);
+        s("in-tg-token",c.telegram_token); s("in-tg-chats",(c.telegram_chat_ids||[]).join(","));
+        s("in-teams-url",c.teams_webhook); s("in-gchat-url",c.gchat_webhook);
+        s("in-tw-sid",c.twilio_sid); s("in-tw-token",c.twilio_token); s("in-tw-from",c.twilio_from); s("in-tw-to",(c.twilio_to||[]).join(","));
+        document.getElementById("in-tw-voice").checked = !!c.twilio_voice;
+        s("in-ntfy-url",c.ntfy_url); s("in-ntfy-topic",c.ntfy_topic); s("in-ntfy-token",c.ntfy_token);
+        s("in-gotify-url",c.gotify_url); s("in-gotify-token",c.gotify_token);
+        s("in-og-key",c.opsgenie_key); s("in-og-url",c.opsgenie_url); s("in-vo-url",c.victorops_url); s("in-vo-rk",c.victorops_routing_key);
+        s("in-am-url",c.alertmanager_url); s("in-am-user",c.alertmanager_user); s("in-am-pass",c.alertmanager_pass); s("in-am-labels",Object.entries(c.alertmanager_labels||{}).map(e=>e[0]+"="+e[1]).join(", ")); s("in-push-contact",c.push_contact);
+        s("in-mqtt-broker",c.mqtt_broker); s("in-mqtt-user",c.mqtt_user); s("in-mqtt-pass",c.mqtt_pass); s("in-mqtt-topic",c.mqtt_topic); s("in-mqtt-int",c.mqtt_interval);
+        s("in-influx-url",c.influx_url); s("in-influx-token",c.influx_token); s("in-rw-url",c.remote_write_url); s("in-rw-token",c.remote_write_token); s("in-fwd-batch",c.forward_batch); s("in-fwd-buffer",c.forward_buffer); s("in-fwd-spool",c.forward_spool_mb);
+        s("in-graphite",c.graphite_addr); s("in-statsd",c.statsd_addr); s("in-metrics-prefix",c.metrics_prefix); s("in-metrics-int",c.metrics_interval); s("in-metrics-wl",(c.metrics_whitelist||[]).join(", "));
+        s("in-passive-type",c.passive_type); s("in-passive-target",c.passive_target); s("in-passive-user",c.passive_user); s("in-passive-pass",c.passive_pass); s("in-passive-host",c.passive_host); s("in-passive-int",c.passive_interval); document.getElementById("in-passive-skip").checked=!!c.passive_skip_verify;
+        s("in-notify-cmd",c.notify_command);
+        const rt = c.severity_channels || {};
+        s("in-route-crit",(rt.CRITICAL||[]).join(",")); s("in-route-warn",(rt.WARNING||[]).join(",")); s("in-route-ok",(rt.OK||[]).join(","));
+        s("in-int-g",c.global_int); s("in-int-p",c.process_int); s("in-proc-limit",c.process_limit||""); s("in-proc-keycmd",(c.process_key_cmdline||[]).join(", ")); s("in-int-s",c.script_int); s("in-retention",c.retention); s("in-hist-quota",c.history_quota_mb||""); s("in-save-int",c.save_interval||"");
+        s("in-scr-to",c.script_timeout); s("in-scr-wk",c.script_workers);
+        document.getElementById("in-scripts").value = c.scripts ? c.scripts.map(sc => Object.keys(sc).some(k => k !== "command") ? JSON.stringify(sc) : sc.command).join("\n") : "";
+        document.getElementById("in-remediations").value = c.remediations ? c.remediations.map(r => JSON.stringify(r)).join("\n") : "";
+        document.getElementById("in-panels").value = c.panels ? c.panels.map(p => JSON.stringify(p)).join("\n") : "";
+        document.getElementById("in-rates").value = c.rate_rules ? c.rate_rules.map(r => JSON.stringify(r)).join("\n") : "";
+        document.getElementById("in-group-rules").value = c.group_rules ? c.group_rules.map(r => JSON.stringify(r)).join("\n") : "";
+        document.getElementById("in-routes").value = c.routes ? c.routes.map(r => JSON.stringify(r)).join("\n") : "";
+        document.getElementById("in-fed-sources").value = c.federate_sources ? c.federate_sources.map(r => JSON.stringify(r)).join("\n") : ""; s("in-fed-int",c.federate_interval);
+        document.getElementById("in-fleet-groups").value = c.fleet_groups ? c.fleet_groups.map(r => JSON.stringify(r)).join("\n") : "";
+        document.getElementById("in-config-templates").value = c.config_templates ? c.config_templates.map(r => JSON.stringify(r)).join("\n") : "";
+        const sp = c.status_page || {}; s("in-sp-title",sp.title); s("in-sp-pass",sp.password);
+        document.getElementById("in-sp-components").value = sp.components ? sp.components.map(r => JSON.stringify(r)).join("\n") : "";
+        document.getElementById("in-derived").value = c.derived_metrics ? c.derived_metrics.map(r => JSON.stringify(r)).join("\n") : "";
+        document.getElementById("in-catalog").value = Object.entries(c.metric_catalog || {}).map(([f, i]) => JSON.stringify(Object.assign({field: f}, i))).join("\n");
+        document.getElementById("in-metric-rules").value = c.metric_rules ? c.metric_rules.map(r => JSON.stringify(r)).join("\n") : ""; s("in-ingest-ttl",c.ingest_ttl); s("in-statsd-listen",c.statsd_listen); s("in-statsd-flush",c.statsd_flush);
+        document.getElementById("in-collectors").value = c.collectors ? c.collectors.map(r => JSON.stringify(r)).join("\n") : "";
+        document.getElementById("in-heartbeats").value = c.heartbeats ? c.heartbeats.map(h=>h.name+" "+h.interval).join("\n") : "";
+        document.getElementById("settings-modal").style.display = "flex";
+    });
+}
+function closeSettings() { document.getElementById("settings-modal").style.display = "none"; }
+function readSettings() {
+    const g = (id) => document.getElementById(id).value;
+    let scripts, remediations, rules, rates, groupRules, panels, fedSources, fleetGroups, configTemplates, collectors, metricRules, derived, catalog, statusComponents;
+    try {
+        scripts = g("in-scripts").split("\n").map(l => l.trim()).filter(l => l !== "").map(l => l.startsWith("{") ? JSON.parse(l) : {command: l});
+    } catch(e) { alert("Invalid script definition: " + e.message); return null; }
+    try {
+        remediations = g("in-remediations").split("\n").map(l => l.trim()).filter(l => l !== "").map(l => JSON.parse(l));
+    } catch(e) { alert("Invalid remediation definition: " + e.message); return null; }
+    try {
+        rules = g("in-routes").split("\n").map(l => l.trim()).filter(l => l !== "").map(l => JSON.parse(l));
+    } catch(e) { alert("Invalid routing rule: " + e.message); return null; }
+    try {
+        rates = g("in-rates").split("\n").map(l => l.trim()).filter(l => l !== "").map(l => JSON.parse(l));
+    } catch(e) { alert("Invalid rate rule: " + e.message); return null; }
+    try {
+        groupRules = g("in-group-rules").split("\n").map(l => l.trim()).filter(l => l !== "").map(l => JSON.parse(l));
+    } catch(e) { alert("Invalid group threshold: " + e.message); return null; }
+    try {
+        panels = g("in-panels").split("\n").map(l => l.trim()).filter(l => l !== "").map(l => JSON.parse(l));
+    } catch(e) { alert("Invalid panel: " + e.message); return null; }
+    try {
+        fedSources = g("in-fed-sources").split("\n").map(l => l.trim()).filter(l => l !== "").map(l => JSON.parse(l));
+    } catch(e) { alert("Invalid federation source: " + e.message); return null; }
+    try {
+        fleetGroups = g("in-fleet-groups").split("\n").map(l => l.trim()).filter(l => l !== "").map(l => JSON.parse(l));
+    } catch(e) { alert("Invalid host group threshold: " + e.message); return null; }
+    try {
+        configTemplates = g("in-config-templates").split("\n").map(l => l.trim()).filter(l => l !== "").map(l => JSON.parse(l));
+    } catch(e) { alert("Invalid config template: " + e.message); return null; }
+    try {
+        statusComponents = g("in-sp-components").split("\n").map(l => l.trim()).filter(l => l !== "").map(l => JSON.parse(l));
+    } catch(e) { alert("Invalid status page component: " + e.message); return null; }
+    try {
+        derived = g("in-derived").split("\n").map(l => l.trim()).filter(l => l !== "").map(l => JSON.parse(l));
+    } catch(e) { alert("Invalid derived metric: " + e.message); return null; }
+    try {
+        catalog = Object.fromEntries(g("in-catalog").split("\n").map(l => l.trim()).filter(l => l !== "").map(l => { const i = JSON.parse(l), f = i.field; delete i.field; return [f, i]; }));
+    } catch(e) { alert("Invalid metric catalog entry: " + e.message); return null; }
+    try {
+        metricRules = g("in-metric-rules").split("\n").map(l => l.trim()).filter(l => l !== "").map(l => JSON.parse(l));
+    } catch(e) { alert("Invalid metric threshold: " + e.message); return null; }
+    try {
+        collectors = g("in-collectors").split("\n").map(l => l.trim()).filter(l => l !== "").map(l => JSON.parse(l));
+    } catch(e) { alert("Invalid collector: " + e.message); return null; }
+    const list = (id) => g(id).split(",").map(s => s.trim()).filter(s => s !== "");
+    const routes = {};
+    [["CRITICAL","in-route-crit"],["WARNING","in-route-warn"],["OK","in-route-ok"]].forEach(([lvl,id]) => { if(list(id).length) routes[lvl] = list(id); });
+    return {
+        cpu_warn: parseFloat(g("in-cpu-w")), cpu_crit: parseFloat(g("in-cpu-c")),
+        cpu_for: parseInt(g("in-cpu-f"))||0, mem_for: parseInt(g("in-mem-f"))||0, dsk_for: parseInt(g("in-dsk-f"))||0,
+        mem_warn: parseFloat(g("in-mem-w")), mem_crit: parseFloat(g("in-mem-c")),
+        dsk_warn: parseFloat(g("in-dsk-w")), dsk_crit: parseFloat(g("in-dsk-c")),
+        load_warn: parseFloat(g("in-load-w"))||0, load_crit: parseFloat(g("in-load-c"))||0, load_for: parseInt(g("in-load-f"))||0,
+        smtp_host: g("in-smtp-host"), smtp_port: parseInt(g("in-smtp-port")), smtp_user: g("in-smtp-user"), smtp_pass: g("in-smtp-pass"), email_to: g("in-email-to"),
+        email_from: g("in-email-from"), smtp_tls: g("in-smtp-tls"), smtp_skip_verify: document.getElementById("in-smtp-skip").checked, smtp_ca: g("in-smtp-ca"),
+        email_subject: g("in-email-subj"), email_body: g("in-email-body"),
+        tls_cert: g("in-tls-cert"), tls_key: g("in-tls-key"), tls_self_signed: document.getElementById("in-tls-self").checked,
+        acme_domain: g("in-acme-domain"), acme_email: g("in-acme-email"), acme_cache_dir: g("in-acme-dir"),
+        listen: g("in-listen"), listen_socket: g("in-listen-sock"), admin_listen: g("in-admin-listen"), base_path: g("in-base-path"),
+        trusted_proxies: g("in-proxies").split(",").map(s => s.trim()).filter(s => s !== ""), cors_origins: g("in-cors").split(",").map(s => s.trim()).filter(s => s !== ""), debug_endpoints: document.getElementById("in-debug").checked,
+        rate_limit: parseFloat(g("in-rate")) || 0, rate_burst: parseInt(g("in-burst")) || 0,
+        allow_from: {dashboard: list("in-allow-dash"), api: list("in-allow-api"), ingest: list("in-allow-ingest")},
+        log_level: g("in-log-lvl"), log_format: g("in-log-fmt"), log_file: g("in-log-file"),
+        host_meta: {tags: list("in-meta-tags"), environment: g("in-meta-env").trim(), owner: g("in-meta-owner").trim(), location: g("in-meta-loc").trim(),
+            labels: Object.fromEntries(list("in-meta-labels").map(l => l.split("=")).filter(p => p.length === 2).map(p => [p[0].trim(), p[1].trim()]))},
+        forecast_days: parseInt(g("in-fc-days"))||0, forecast_method: g("in-fc-method"), arp_subnets: list("in-arp-subnets"), expected_ports: list("in-exp-ports"),
+        anomaly_sigma: parseFloat(g("in-an-sigma"))||0, anomaly_min_samples: parseInt(g("in-an-min"))||0, anomaly_level: g("in-an-lvl"),
+        digest_schedule: g("in-dg-sched"), digest_time: g("in-dg-time"), digest_day: g("in-dg-day"), digest_email_to: g("in-dg-to"), digest_webhook: g("in-dg-hook"), sla_target: parseFloat(g("in-sla-target"))||0,
+        telegram_token: g("in-tg-token"), telegram_chat_ids: g("in-tg-chats").split(",").map(s => s.trim()).filter(s => s !== ""),
+        teams_webhook: g("in-teams-url"), gchat_webhook: g("in-gchat-url"),
+        twilio_sid: g("in-tw-sid"), twilio_token: g("in-tw-token"), twilio_from: g("in-tw-from"), twilio_to: list("in-tw-to"),
+        twilio_voice: document.getElementById("in-tw-voice").checked, severity_channels: routes,
+        ntfy_url: g("in-ntfy-url"), ntfy_topic: g("in-ntfy-topic"), ntfy_token: g("in-ntfy-token"),
+        gotify_url: g("in-gotify-url"), gotify_token: g("in-gotify-token"),
+        opsgenie_key: g("in-og-key"), opsgenie_url: g("in-og-url"), victorops_url: g("in-vo-url"), victorops_routing_key: g("in-vo-rk"),
+        alertmanager_url: g("in-am-url"), alertmanager_user: g("in-am-user"), alertmanager_pass: g("in-am-pass"), push_contact: g("in-push-contact"),
+        alertmanager_labels: Object.fromEntries(g("in-am-labels").split(",").map(x=>x.split("=").map(y=>y.trim())).filter(x=>x[0]&&x.length==2)),
+        mqtt_broker: g("in-mqtt-broker"), mqtt_user: g("in-mqtt-user"), mqtt_pass: g("in-mqtt-pass"), mqtt_topic: g("in-mqtt-topic"), mqtt_interval: parseInt(g("in-mqtt-int"))||0,
+        influx_url: g("in-influx-url"), influx_token: g("in-influx-token"), remote_write_url: g("in-rw-url"), remote_write_token: g("in-rw-token"), forward_batch: parseInt(g("in-fwd-batch"))||0, forward_buffer: parseInt(g("in-fwd-buffer"))||0, forward_spool_mb: parseInt(g("in-fwd-spool"))||0,
+        graphite_addr: g("in-graphite"), statsd_addr: g("in-statsd"), metrics_prefix: g("in-metrics-prefix"), metrics_interval: parseInt(g("in-metrics-int"))||0, metrics_whitelist: g("in-metrics-wl").split(",").map(x=>x.trim()).filter(x=>x),
+        passive_type: g("in-passive-type"), passive_target: g("in-passive-target"), passive_user: g("in-passive-user"), passive_pass: g("in-passive-pass"), passive_host: g("in-passive-host"), passive_interval: parseInt(g("in-passive-int"))||0, passive_skip_verify: document.getElementById("in-passive-skip").checked,
+        notify_command: g("in-notify-cmd"),
+        scripts: scripts, remediations: remediations, routes: rules, rate_rules: rates, group_rules: groupRules, panels: panels, federate_sources: fedSources, federate_interval: parseInt(g("in-fed-int"))||0, fleet_groups: fleetGroups, config_templates: configTemplates,
+        status_page: {title: g("in-sp-title").trim(), password: g("in-sp-pass"), components: statusComponents}, collectors: collectors, metric_rules: metricRules, derived_metrics: derived, metric_catalog: catalog, ingest_ttl: parseInt(g("in-ingest-ttl"))||0, statsd_listen: g("in-statsd-listen"), statsd_flush: parseInt(g("in-statsd-flush"))||0,
+        heartbeats: g("in-heartbeats").split("\n").map(l => l.trim().split(/\s+/)).filter(p => p[0] !== "").map(p => ({name: p[0], interval: parseInt(p[1]) || 0})),
+        retention: g("in-retention"), history_quota_mb: parseInt(g("in-hist-quota")) || 0, save_interval: parseInt(g("in-save-int")) || 0,
+        global_int: parseInt(g("in-int-g")), process_int: parseInt(g("in-int-p")), process_limit: parseInt(g("in-proc-limit")) || 0, process_key_cmdline: list("in-proc-keycmd"), script_int: parseInt(g("in-int-s")),
+        script_timeout: parseInt(g("in-scr-to")), script_workers: parseInt(g("in-scr-wk"))
+    };
+}
+function saveSettings() {
+    const cfg = readSettings(); if (!cfg) return;
+    fetch('config', { method: 'POST', headers: {'Content-Type': 'application/json'}, body: JSON.stringify(cfg) })
+    .then(r => {
+        if (r.ok) { closeSettings(); loadLayout(); alert("Saved."); return; }
+        r.json().then(e => alert("Not saved:\n" + (e.errors||[]).map(x => (x.field ? x.field + ": " : "") + x.message).join("\n")))
+            .catch(() => alert("Not saved: HTTP " + r.status));
+    });
+}
+function testNotify() {
+    const cfg = readSettings(); if (!cfg) return;
+    const out = document.getElementById("test-result");
+    const channel = document.getElementById("in-test-chan").value;
+    out.style.color = "#aaa"; out.innerText = "Sending via " + channel + "...";
+    fetch('notify/test', { method: 'POST', headers: {'Content-Type': 'application/json'},
+        body: JSON.stringify({channel: channel, level: document.getElementById("in-test-lvl").value, config: cfg}) })
+    .then(r => r.json()).then(res => {
+        out.style.color = res.ok ? "#4caf50" : "#f44336";
+        out.innerText = res.ok ? "Delivered via " + channel + "." : channel + " failed: " + res.error;
+    }).catch(e => { out.style.color = "#f44336"; out.innerText = "Request failed: " + e; });
+}
+
+// Series colors by key; user preferences can replace any of them. THEME is the grid and axis text.
+const DEFAULT_COLORS = { cpu: "#00d1b2", mem: "#209cee", rx: "#ffdd57", tx: "#bd93f9", read: "#ff3860", write: "#00d1b2", plugin: "#bd93f9", forecast: "#ff3860" };
+const COLORS = Object.assign({}, DEFAULT_COLORS), THEME = { grid: "#333", axis: "#999" };
+const colorOf = c => COLORS[c] || c;
+
+class Chart {
+    constructor(id, f1, f2, c1, c2, max, unit) {
+        this.cvs = document.getElementById(id); this.ctx = this.cvs.getContext("2d");
+        this.f1=f1; this.f2=f2; this.c1=c1; this.c2=c2; this.max=max; this.unit=unit; this.scale=unitScale(unit);
+        STATE.charts.push(this);
+        this.cvs.addEventListener('mousemove', e=>this.tip(e));
+        this.cvs.addEventListener('mouseleave', ()=>document.getElementById("tooltip").style.display='none');
+        this.cvs.addEventListener('wheel', e=>{ if(e.ctrlKey){ e.preventDefault(); zoom(e.deltaY<0?0.2:-0.2); } });
+        new ResizeObserver(()=>this.resize()).observe(this.cvs.parentElement);
+    }
+    // Charts of plain sample fields draw a range from the server's bucket averages when it has sent them.
+    source() { const agg = typeof this.agg === 'function' ? this.agg() : this.agg; return STATE.mode==='range' && agg && STATE.agg ? STATE.agg : STATE.data; }
+    resize() { this.cvs.width = this.cvs.parentElement.clientWidth; this.cvs.height = this.cvs.parentElement.clientHeight; this.draw(); }
+    draw() {
+        const w=this.cvs.width, h=this.cvs.height, pL=40, pB=30;
+        this.ctx.clearRect(0,0,w,h);
+        if(STATE.data.length<2) return;
+        const tEnd = STATE.mode==='live' ? STATE.data[STATE.data.length-1].ts : STATE.rEnd;
+        const tStart = STATE.mode==='live' ? tEnd-STATE.dur : STATE.rStart;
+        
+        const view=[]; for(let d of this.source()) if(d.ts>=tStart && d.ts<=tEnd) view.push(d);
+        if(view.length<2) return;
+
+        let max = this.max || 0;
+        if(!this.max) view.forEach(d => max = Math.max(max, this.f1(d), this.f2?this.f2(d):0, ...(this.extra||[]).map(x=>x.f(d))));
+        if(max<=0) max=1; else max*=1.1;
+
+        this.ctx.strokeStyle=THEME.grid; this.ctx.beginPath();
+        for(let i=0;i<=5;i++) {
+            let x=pL+(i*(w-pL)/5); this.ctx.moveTo(x,0); this.ctx.lineTo(x,h-pB);
+            let ts=tStart+(i*(tEnd-tStart)/5);
+            this.ctx.fillStyle=THEME.axis; this.ctx.fillText(new Date(ts*1000).toLocaleTimeString(), x-15, h-10);
+        }
+        for(let i=0;i<=4;i++) {
+            let y=(h-pB)-(i*(h-pB)/4); this.ctx.moveTo(pL,y); this.ctx.lineTo(w,y);
+            let t=fmtScaled(i*(max/4), this.scale, max < 8 ? 1 : 0);
+            if(this.unit === '%' || this.max === 100) t+='%';
+            this.ctx.fillText(t, 2, y+3);
+        }
+        this.ctx.stroke();
+
+        const line = (fn, c) => {
+            this.ctx.strokeStyle=c; this.ctx.lineWidth=2; this.ctx.beginPath();
+            view.forEach((d,i) => {
+                let x=pL+((d.ts-tStart)/(tEnd-tStart))*(w-pL);
+                let y=(h-pB)-(fn(d)/max)*(h-pB);
+                if(i===0) this.ctx.moveTo(x,y); else this.ctx.lineTo(x,y);
+            });
+            this.ctx.stroke();
+        }
+        line(this.f1, colorOf(this.c1)); if(this.f2) line(this.f2, colorOf(this.c2));
+        (this.extra||[]).forEach(x => line(x.f, colorOf(x.c)));
+        // Events (OOM kills) as dashed lines across the chart.
+        (this.marks ? this.marks() : []).forEach(k => {
+            if(k.time < tStart || k.time > tEnd) return;
+            const x = pL+((k.time-tStart)/(tEnd-tStart))*(w-pL);
+            this.ctx.strokeStyle = colorOf("forecast"); this.ctx.lineWidth = 1; this.ctx.setLineDash([4, 3]);
+            this.ctx.beginPath(); this.ctx.moveTo(x, 0); this.ctx.lineTo(x, h-pB); this.ctx.stroke(); this.ctx.setLineDash([]);
+            this.ctx.fillStyle = colorOf("forecast"); this.ctx.fillText(k.label, x+3, 10);
+        });
+    }
+    tip(e) {
+        if(STATE.data.length<2) return;
+        const rect = this.cvs.getBoundingClientRect();
+        const pL=40, w=rect.width;
+        const tEnd = STATE.mode==='live' ? STATE.data[STATE.data.length-1].ts : STATE.rEnd;
+        const tStart = STATE.mode==='live' ? tEnd-STATE.dur : STATE.rStart;
+        const mx = e.clientX - rect.left;
+        const mTime = tStart + ((mx-pL)/(w-pL))*(tEnd-tStart);
+        const d = this.source().reduce((p,c)=> Math.abs(c.ts-mTime)<Math.abs(p.ts-mTime)?c:p);
+        const tip = document.getElementById("tooltip");
+        tip.style.display="block"; tip.style.left=(e.pageX+15)+"px"; tip.style.top=(e.pageY+15)+"px";
+        let h = '<div><b>' + new Date(d.ts*1000).toLocaleTimeString() + '</b></div>';
+        (this.marks ? this.marks() : []).filter(k => Math.abs(k.time-mTime) < (tEnd-tStart)/100).forEach(k => h += '<div style="color:' + colorOf("forecast") + '">' + k.text.replace(/</g, '&lt;') + '</div>');
+        h += '<div style="color:' + colorOf(this.c1) + '">V1: ' + fmtUnit(this.f1(d), this.unit, this.scale) + '</div>';
+        if(this.f2) h += '<div style="color:' + colorOf(this.c2) + '">V2: ' + fmtUnit(this.f2(d), this.unit, this.scale) + '</div>';
+        (this.extra||[]).forEach((x, i) => h += '<div style="color:' + colorOf(x.c) + '">V' + (i+3) + ': ' + fmtUnit(x.f(d), this.unit, this.scale) + '</div>');
+        tip.innerHTML = h;
+    }
+}
+
+const cGlobal = new Chart("c-global", d=>d.cpu_tot, d=>d.mem_used, "cpu", "mem", 100, "%");
+cGlobal.agg = true;
+// OOM kills are marked on the memory chart; the server keeps the last 200.
+let OOMS = [];
+cGlobal.marks = () => OOMS;
+function loadOOM() {
+    fetch("api/v1/oom?limit=200").then(r=>r.ok ? r.json() : null).then(r=>{
+        if(!r) return;
+        OOMS = r.data.map(k => ({time: k.time, label: "OOM " + (k.name || ""), text: k.name ? "OOM kill: " + k.name + " (pid " + k.pid + ", " + fmtBytes(k.rss) + ")" + (k.group ? " in " + k.group : "") + (k.trigger && k.trigger !== k.name ? ", set off by " + k.trigger : "") : "OOM kill"}));
+        drawAll();
+    });
+}
+loadOOM(); setInterval(loadOOM, 30000);
+new Chart("c-net", d=>d.net_down, d=>d.net_up, "rx", "tx", null, "B").agg = true;
+// One device from the selector (bytes/s), or the totals of all of them.
+const ioDev = (d, f, all) => { const dev = document.getElementById("io-dev").value; if(!dev) return all; const x = (d.disks||[]).find(x=>x.name===dev); return x ? x[f] : 0; };
+new Chart("c-disk", d=>ioDev(d, "read", d.dsk_read), d=>ioDev(d, "write", d.dsk_writ), "read", "write", null, "B").agg = () => !document.getElementById("io-dev").value;
+
+// Load charts the three averages with the core count as the line they should stay under.
+const cLoad = new Chart("c-load", d=>d.load1, d=>d.load5||0, "cpu", "rx", null, "");
+cLoad.extra = [{f: d=>d.load15||0, c: "tx"}, {f: d=>d.cores||0, c: "forecast"}];
+
+// The drill-down follows a process key (its name, or name#hash), so restarts and worker pools stay one series.
+const pKey = (p) => p.key || p.name;
+// Pressure charts a third series (memory) through extra; CPU Frequency marks samples with throttling.
+const cPSI = new Chart("c-psi", d=>d.psi_cpu||0, d=>d.psi_io||0, "cpu", "read", null, "%");
+cPSI.extra = [{f: d=>d.psi_mem||0, c: "mem"}];
+const cFreq = new Chart("c-freq", d=>d.cpu_mhz||0, d=>d.core_mhz ? Math.min(...d.core_mhz) : 0, "cpu", "rx", null, "MHz");
+cFreq.marks = () => STATE.data.filter(d => d.throttles).map(d => ({time: d.ts, label: "", text: d.throttles + " throttling event(s)"}));
+const getP = (d) => {
+    if(!d.p_list) return null;
+    let s = null;
+    d.p_list.forEach(p => { if(pKey(p) !== STATE.pkey) return; s = s || {cpu: 0, mem: 0, d_read: 0, d_write: 0}; s.cpu += p.cpu; s.mem += p.mem; s.d_read += p.d_read; s.d_write += p.d_write; });
+    return s;
+};
+new Chart("c-p-cpu", d=>{const p=getP(d); return p?p.cpu:0}, null, "cpu", null, null, "%");
+new Chart("c-p-mem", d=>{const p=getP(d); return p?p.mem:0}, null, "mem", null, null, "B");
+new Chart("c-p-dsk", d=>{const p=getP(d); return p?p.d_read:0}, d=>{const p=getP(d); return p?p.d_write:0}, "read", "write", null, "B");
+
+// Custom panels chart export field names: sample fields, plugin:<name>[/<label>], mount:<path>, disk:<dev>/<read|write|busy>,
+// group:<name>/<cpu|mem|read|write|procs> and metric:<name>[{tag=value,...}].
+const seriesKey = (m) => { const t = Object.keys(m.tags||{}).sort().map(k => k + "=" + m.tags[k]); return t.length ? m.name + "{" + t.join(",") + "}" : m.name; };
+const metricFn = (name) => {
+    if(name.startsWith("metric:")) { const key = name.slice(7); return d => { const m = (d.metrics||[]).find(x=>seriesKey(x)===key); return m ? m.value : 0; }; }
+    if(name.startsWith("group:")) {
+        const i = name.lastIndexOf("/"), grp = name.slice(6, i), f = {read: "d_read", write: "d_write"}[name.slice(i+1)] || name.slice(i+1);
+        return d => { const x = (d.groups||[]).find(x=>x.name===grp); return x ? x[f] || 0 : 0; };
+    }
+    if(name.startsWith("mount:")) { const path = name.slice(6); return d => { const m = (d.mounts||[]).find(x=>x.path===path); return m ? m.pct : 0; }; }
+    if(name.startsWith("disk:")) { const [dev, f] = name.slice(5).split("/"); return d => { const x = (d.disks||[]).find(x=>x.name===dev); return x ? x[f] || 0 : 0; }; }
+    if(name.startsWith("plugin:")) {
+        const id = name.slice(7);
+        return d => {
+            for(const plug of (d.plugins||[])) {
+                const key = plug.name || plug.path;
+                if(key === id) return plug.perf_val || 0;
+                if(id.startsWith(key + "/")) { const pm = (plug.perf||[]).find(x=>x.label===id.slice(key.length+1)); if(pm) return pm.value; }
+            }
+            return 0;
+        };
+    }
+    return d => d[name] || 0;
+};
+// applyLayout puts the panels in the configured columns and order; the rest wait hidden, since the updaters still write to them.
+function applyLayout(panels) {
+    const cards = {}, hidden = document.getElementById("hidden-panels");
+    document.querySelectorAll("[data-panel]").forEach(el => { if(el.dataset.custom) el.remove(); else { cards[el.dataset.panel] = el; hidden.appendChild(el); } });
+    STATE.charts = STATE.charts.filter(c => document.body.contains(c.cvs));
+    const cat = STATE.catalog || {};
+    panels.forEach((p, i) => {
+        let el = cards[p.id];
+        const custom = !el;
+        // Custom panels take their title, unit, scale and ceiling from the metric catalog unless the panel sets them.
+        const info = cat[p.metrics && p.metrics[0]] || {}, unit = p.unit || info.unit || "";
+        if(custom) {
+            el = document.createElement("div"); el.className = "card"; el.dataset.panel = p.id; el.dataset.custom = "1"; el.style.height = el.style.minHeight = "180px";
+            el.innerHTML = '<div class="card-header"><div class="card-title"></div></div><div class="canvas-wrapper"><canvas id="custom-' + i + '"></canvas></div>';
+            el.querySelector(".card-title").innerText = p.title || p.metrics.map(m => (cat[m] || {}).label || m).join(" / ");
+        }
+        if(p.height) el.style.height = el.style.minHeight = p.height + "px";
+        document.getElementById(p.column === "right" ? "col-right" : "col-left").appendChild(el);
+        if(custom) {
+            const ch = new Chart("custom-" + i, metricFn(p.metrics[0]), p.metrics[1] ? metricFn(p.metrics[1]) : null, "plugin", "rx", unit === "%" ? 100 : (!p.unit && info.max) || null, unit);
+            if(!p.unit && info.label) ch.scale = info.scale || "";
+        }
+    });
+    drawAll();
+}
+
+function drawAll() { STATE.charts.forEach(c=>c.draw()); }
+function zoom(adj) { STATE.dur = Math.max(60, STATE.dur + (STATE.dur * adj)); STATE.mode='live'; drawAll(); }
+function zoomIn() { zoom(-0.3); } function zoomOut() { zoom(0.3); }
+function setLiveDuration(s) { STATE.mode='live'; STATE.dur=s; drawAll(); }
+const AGG_FIELDS = ["cpu_tot", "mem_used", "net_down", "net_up", "dsk_read", "dsk_writ"];
+function applyRange() { 
+    STATE.rStart = new Date(document.getElementById("dp-start").value).getTime()/1000;
+    STATE.rEnd = new Date(document.getElementById("dp-end").value).getTime()/1000;
+    STATE.mode='range'; STATE.agg=null; drawAll();
+    const q = "history?points=1000&agg=avg&fields=" + AGG_FIELDS.join(",") + "&start=" + Math.floor(STATE.rStart) + "&end=" + Math.ceil(STATE.rEnd);
+    fetch(q).then(r=>r.ok ? r.json() : null).then(res=>{
+        if(!res || STATE.mode!=='range') return;
+        const byTs = new Map();
+        res.series.forEach(s => s.ts.forEach((t,i) => { if(!byTs.has(t)) byTs.set(t, {ts:t}); byTs.get(t)[s.field] = s.avg[i]; }));
+        STATE.agg = [...byTs.values()].sort((a,b)=>a.ts-b.ts); drawAll();
+    });
+}
+function goLive() { setLiveDuration(1800); }
+function exportHistory(fmt) {
+    const tEnd = STATE.mode==='live' ? Math.floor(Date.now()/1000) : STATE.rEnd;
+    const tStart = STATE.mode==='live' ? tEnd-STATE.dur : STATE.rStart;
+    window.location = "history/export?format="+fmt+"&start="+Math.floor(tStart)+"&end="+Math.ceil(tEnd);
+}
+function openReport() {
+    const tEnd = STATE.mode==='live' ? Math.floor(Date.now()/1000) : STATE.rEnd;
+    const tStart = STATE.mode==='live' ? tEnd-STATE.dur : STATE.rStart;
+    window.open("api/v1/reports?format=html&start="+Math.floor(tStart)+"&end="+Math.ceil(tEnd));
+}
+function selProc(key) { 
+    STATE.pkey = key; 
+    const el = document.getElementById("drill-view");
+    if(key) { el.style.display="grid"; setTimeout(drawAll,50); } else { el.style.display="none"; }
+    drawAll(); loadProcPIDs();
+}
+// Which pids the selected key had over the last hour, newest first.
+function loadProcPIDs() {
+    const key = STATE.pkey, el = document.getElementById("proc-pids");
+    if(!key) { el.innerText = ""; return; }
+    fetch("api/v1/processes/history?limit=1&key=" + encodeURIComponent(key) + "&start=" + (Math.floor(Date.now()/1000) - 3600)).then(r=>r.ok ? r.json() : null).then(r=>{
+        if(STATE.pkey !== key) return;
+        const t = (s) => new Date(s*1000).toLocaleTimeString();
+        el.innerText = !r ? "" : "pid " + r.data.pids.slice(-5).reverse().map(p => p.pid + " " + t(p.first) + "-" + t(p.last)).join(", ") + (r.data.pids.length > 5 ? " ..." : "");
+    });
+}
+function filterProc() {
+    const f = document.getElementById("proc-filter").value.toUpperCase();
+    const opts = document.getElementById("proc-select").options;
+    for(let i=1; i<opts.length; i++) opts[i].style.display = opts[i].text.toUpperCase().includes(f) ? "" : "none";
+}
+
+function showPluginDetail(p) {
+    fetch('plugin?' + (p.name ? 'name=' + encodeURIComponent(p.name) : 'path=' + encodeURIComponent(p.path))).then(r=>r.ok ? r.json() : null).then(p => {
+        if(!p) return;
+        let txt = p.output + "\n";
+        if(p.long_output) txt += "\n" + p.long_output + "\n";
+        if(p.stderr) txt += "\n--- stderr ---\n" + p.stderr + "\n";
+        txt += "\nExit code: " + p.exit_code + "   Duration: " + (p.duration||0).toFixed(2) + "s";
+        document.getElementById("plugin-modal-title").innerText = p.name ? p.name + " (" + p.path + ")" : p.path;
+        document.getElementById("plugin-modal-body").innerText = txt;
+        document.getElementById("plugin-modal").style.display = "flex";
+    });
+}
+
+function updatePlugins(list) {
+    const c = document.getElementById("plugin-container");
+    if(!list) return;
+    const activeIDs = new Set();
+    list.forEach(p => {
+        const key = p.name || p.path;
+        const series = (p.perf && p.perf.length) ? p.perf : [{label: "", unit: p.perf_unit}];
+        series.forEach((s, idx) => {
+            let id = "plg-" + btoa(unescape(encodeURIComponent(key + "|" + s.label))).replace(/[^a-zA-Z0-9]/g, "");
+            activeIDs.add(id);
+            let card = document.getElementById(id);
+            if(!card) {
+                card = document.createElement("div");
+                card.id = id;
+                card.className = "card"; card.style.height="150px"; card.style.marginBottom="15px";
+                card.innerHTML = '<div class="card-header"><div class="card-title">' + key + (s.label ? ' [' + s.label + ']' : '') + '</div><div id="' + id + '-stat" class="plugin-row"></div></div><div class="canvas-wrapper"><canvas id="' + id + '-cvs"></canvas></div>';
+                c.appendChild(card);
+                new Chart(id+"-cvs", d => {
+                    const plug = d.plugins ? d.plugins.find(x=>(x.name||x.path)===key) : null;
+                    if(!plug) return 0;
+                    if(!plug.perf || !plug.perf.length) return idx===0 ? plug.perf_val : 0;
+                    const pm = plug.perf.find(x=>x.label===s.label);
+                    return pm ? pm.value : 0;
+                }, null, "plugin", null, null, s.unit);
+            }
+            const st = document.getElementById(id+"-stat");
+            st.className = "plugin-row status-"+p.exit_code;
+            st.innerText = p.output;
+            st.title = "Ran in " + (p.duration||0).toFixed(2) + "s - click for full output";
+            st.onclick = () => showPluginDetail(p);
+        });
+    });
+    Array.from(c.children).forEach(child => {
+        if (!activeIDs.has(child.id)) c.removeChild(child);
+    });
+}
+
+// Compact stream: after the first event only changed fields arrive, processes as a diff.
+let LIVE = null, PROCS = new Map();
+function applyDelta(d) {
+    if(d.p_diff) {
+        (d.p_diff.del||[]).forEach(pid => PROCS.delete(pid));
+        (d.p_diff.set||[]).forEach(p => PROCS.set(p.pid, p));
+        delete d.p_diff;
+        d.p_list = [...PROCS.values()].sort((a,b)=>(b.cpu+b.mem/1048576)-(a.cpu+a.mem/1048576));
+    }
+    LIVE = Object.assign({}, LIVE, d);
+    return LIVE;
+}
+// Collectors that don't work on this host (or without more rights) say so under their table instead of leaving it blank.
+let CAPS = {};
+function loadCaps() { fetch("api/v1/status").then(r=>r.ok ? r.json() : null).then(r=>{ if(r) CAPS = r.data.capabilities || {}; }); }
+function capNote(id, key) {
+    const c = CAPS[key];
+    if(c && c.note && (!c.ok || c.partial)) document.getElementById(id).insertAdjacentHTML("beforeend", '<tr><td colspan="3" class="cap-note">' + c.note.replace(/</g, '&lt;') + '</td></tr>');
+}
+loadCaps(); setInterval(loadCaps, 60000);
+// Clicking a TCP port in the Ports table lists who connected to it in the last minute.
+function togglePortClients(port) {
+    STATE.portClients = STATE.portClients === port ? null : port;
+    document.getElementById("port-clients")?.remove();
+    const row = [...document.querySelectorAll("#tbl-ports .port-row")].find(r => r.cells[0].innerText == port);
+    if(STATE.portClients && row) { row.insertAdjacentHTML("afterend", '<tr id="port-clients"></tr>'); loadPortClients(); }
+}
+function loadPortClients() {
+    const port = STATE.portClients;
+    if(!port || !document.getElementById("port-clients")) return;
+    fetch("api/v1/ports/" + port + "/clients?limit=10").then(r=>r.ok ? r.json() : null).then(r=>{
+        const el = document.getElementById("port-clients");
+        if(!el || STATE.portClients !== port) return;
+        const d = r && r.data;
+        el.innerHTML = '<td colspan="3" class="cap-note">' + (!d ? 'no data' : d.accept_rate.toFixed(2) + ' new/s, ' + d.open + ' open' + d.clients.map(c=> '<br>' + c.ip + ': ' + c.accepted + ' new, ' + c.open + ' open').join("")) + '</td>';
+    });
+}
+// The eBPF panels poll their own endpoint, and only while one of them is on the page.
+const fmtUs = (v) => v >= 1000000 ? (v/1000000).toFixed(1)+"s" : v >= 1000 ? (v/1000).toFixed(1)+"ms" : v+"µs";
+function loadEBPF() {
+    if(!["tbl-exec", "tbl-retrans", "tbl-dlat"].some(id => !document.getElementById("hidden-panels").contains(document.getElementById(id)))) return;
+    fetch("api/v1/ebpf").then(r=>r.ok ? r.json() : null).then(r=>{
+        if(!r) return;
+        const d = r.data, esc = s => String(s).replace(/</g, '&lt;');
+        const err = (id, key) => { if(d.errors && d.errors[key]) document.getElementById(id).innerHTML = '<tr><td class="cap-note">' + esc(d.errors[key]) + '</td></tr>'; else if(!(d.enabled||[]).includes(key)) document.getElementById(id).innerHTML = '<tr><td class="cap-note">add "' + key + '" to ebpf in pulse.conf</td></tr>'; };
+        document.getElementById("tbl-exec").innerHTML = d.execs.slice(0, 50).map(e=> '<tr><td>' + new Date(e.time*1000).toLocaleTimeString() + '</td><td>' + e.pid + '</td><td>' + esc(e.comm) + '</td><td class="val-cell">uid ' + e.uid + '</td></tr>').join("");
+        err("tbl-exec", "exec");
+        document.getElementById("tbl-retrans").innerHTML = (d.retransmits||[]).map(t=> '<tr><td>' + esc(t.name || t.local) + '</td><td>' + esc(t.remote) + '</td><td class="val-cell">' + t.recent + ' / ' + t.total + '</td></tr>').join("");
+        err("tbl-retrans", "retransmits");
+        document.getElementById("tbl-dlat").innerHTML = (d.disk_latency||[]).map(x=> {
+            const top = Math.max(...x.buckets, 1);
+            const bars = x.buckets.map((n, i)=> '<span title="' + fmtUs(1<<i) + '-' + fmtUs(2<<i) + ': ' + n + '" style="height:' + Math.max(1, Math.round(16*n/top)) + 'px"></span>').join("");
+            return '<tr><td>' + esc(x.device) + '</td><td class="hist">' + bars + '</td><td class="val-cell">p50 ' + fmtUs(x.p50_us) + ' p99 ' + fmtUs(x.p99_us) + '</td></tr>';
+        }).join("");
+        err("tbl-dlat", "disk_latency");
+    });
+}
+setInterval(loadEBPF, 5000);
+function loadGeo() {
+    if(document.getElementById("hidden-panels").contains(document.getElementById("tbl-geo"))) return;
+    fetch("api/v1/connections/geo").then(r=>r.ok ? r.json() : null).then(r=>{
+        if(!r) return;
+        const d = r.data, esc = s => String(s || "").replace(/</g, '&lt;');
+        const rows = (l, kind) => l.slice(0, 10).map(c=> '<tr><td>' + kind + '</td><td title="' + esc(c.name) + '">' + esc(c.key) + ' ' + esc(c.name) + '</td><td class="val-cell">' + c.conns + ' (' + c.ips + ' IPs)</td></tr>').join("");
+        document.getElementById("tbl-geo").innerHTML = rows(d.countries, "country") + rows(d.asns, "AS") +
+            '<tr><td colspan="3" class="cap-note">' + d.total + ' connections, ' + d.private + ' private, ' + d.unknown + ' unknown</td></tr>';
+        capNote("tbl-geo", "geoip");
+    });
+}
+setInterval(loadGeo, 30000); setTimeout(loadGeo, 3000);
+function loadARP() {
+    if(document.getElementById("hidden-panels").contains(document.getElementById("tbl-arp"))) return;
+    fetch("api/v1/arp/events?limit=20").then(r=>r.ok ? r.json() : null).then(r=>{
+        if(!r) return;
+        const esc = s => String(s || "").replace(/</g, '&lt;');
+        document.getElementById("tbl-arp").innerHTML = r.data.map(e=> '<tr title="' + new Date(e.time*1000).toLocaleString() + (e.device ? ' on ' + esc(e.device) : '') + '"><td class="status-' + (e.kind === "conflict" ? 2 : 1) + '">' + e.kind + '</td><td>' + esc(e.ip) + '</td><td class="val-cell">' + esc(e.mac) + (e.old_mac ? ' (was ' + esc(e.old_mac) + ')' : '') + '</td></tr>').join("") ||
+            '<tr><td colspan="3" class="cap-note">No new MACs or IP changes seen</td></tr>';
+        capNote("tbl-arp", "arp");
+    });
+}
+setInterval(loadARP, 30000); setTimeout(loadARP, 3000);
+function loadSites() {
+    if(document.getElementById("hidden-panels").contains(document.getElementById("tbl-sites"))) return;
+    fetch("api/v1/federation?q=" + encodeURIComponent(document.getElementById("sites-q").value)).then(r=>r.ok ? r.json() : null).then(r=>{
+        if(!r) return;
+        const esc = s => String(s || "").replace(/</g, '&lt;'), lvl = {OK: 0, WARNING: 1, CRITICAL: 2};
+        const row = (s, depth) => {
+            const m = s.summary, name = '&nbsp;'.repeat(depth*2) + esc(s.name);
+            if(!s.up) return '<tr title="' + esc(s.url + ": " + s.error) + '"><td class="status-2">' + name + '</td><td colspan="2" class="cap-note">' + (s.failures ? 'unreachable' : 'not pulled yet') + (s.last_seen ? ', seen ' + new Date(s.last_seen*1000).toLocaleTimeString() : '') + '</td></tr>';
+            const push = s.push_error ? '\nconfig push failed: ' + esc(s.push_error) : s.pushed ? '\nconfig pushed ' + new Date(s.pushed*1000).toLocaleString() : '';
+            return '<tr title="' + esc(s.url) + push + (m.meta && m.meta.tags ? '\n' + esc(m.meta.tags.join(", ")) : '') + (m.alerts.length ? '\n' + m.alerts.map(a=> a.level + ' ' + esc(a.monitor)).join("\n") : '') + '"><td class="status-' + (lvl[m.status]||0) + '">' + name + (s.push_error ? ' <span class="cap-note">push failed</span>' : '') + '</td><td>' + m.alerts.length + ' alerts</td><td class="val-cell">' + m.cpu.avg.toFixed(0) + '% / ' + m.mem.avg.toFixed(0) + '% / ' + m.disk.toFixed(0) + '%</td></tr>' +
+                (m.sites||[]).map(c=> row(c, depth+1)).join("");
+        };
+        document.getElementById("tbl-sites").innerHTML = r.data.map(s=> row(s, 0)).join("") || '<tr><td colspan="3" class="cap-note">No matching sites</td></tr>';
+    });
+}
+setInterval(loadSites, 30000); setTimeout(loadSites, 3000);
+function loadFleet() {
+    if(document.getElementById("hidden-panels").contains(document.getElementById("fleet-grid"))) return;
+    const sel = document.getElementById("fleet-group"), group = sel.value;
+    const esc = s => String(s || "").replace(/</g, '&lt;').replace(/"/g, '&quot;'), lvl = {OK: 0, WARNING: 1, CRITICAL: 2, DOWN: 2};
+    fetch("api/v1/fleet/groups").then(r=>r.ok ? r.json() : null).then(r=>{
+        if(!r) return;
+        sel.innerHTML = '<option value="*">All groups</option>' + r.data.map(g=> '<option value="' + esc(g.name) + '">' + (esc(g.name) || "no group") + '</option>').join("");
+        sel.value = r.data.some(g=> g.name === group) ? group : "*";
+        // The overview: one tile per group while no group is picked.
+        document.getElementById("fleet-groups").innerHTML = sel.value !== "*" || r.data.length < 2 ? "" : r.data.map(g=> '<div class="fleet-tile status-' + (lvl[g.status]||0) + '" style="cursor:pointer;" onclick="document.getElementById(\'fleet-group\').value=this.dataset.group; loadFleet()" data-group="' + esc(g.name) + '">' +
+            '<div class="fleet-row"><span class="fleet-name">' + (esc(g.name) || "no group") + '</span><span>' + g.status + '</span></div>' +
+            '<div class="fleet-row"><span>' + g.hosts + ' hosts' + (g.down ? ', ' + g.down + ' down' : '') + '</span><span>' + g.alerts + ' alerts</span></div>' +
+            '<div class="fleet-row"><span>CPU / Mem / Disk</span><span class="val-cell">' + g.cpu.toFixed(0) + '% / ' + g.mem.toFixed(0) + '% / ' + g.disk.toFixed(0) + '%</span></div></div>').join("");
+    });
+    fetch("api/v1/fleet?q=" + encodeURIComponent(document.getElementById("fleet-q").value) + (group !== "*" ? "&group=" + encodeURIComponent(group) : "")).then(r=>r.ok ? r.json() : null).then(r=>{
+        if(!r) return;
+        const spark = (t, k, color) => {
+            if(t.length < 2) return '';
+            const t0 = t[0].t, span = (t[t.length-1].t - t0) || 1;
+            return '<svg width="70" height="12"><polyline fill="none" stroke="' + color + '" stroke-width="1" points="' + t.map(p=> ((p.t - t0) / span * 70).toFixed(1) + ',' + (12 - Math.min(100, p[k]) / 100 * 11).toFixed(1)).join(" ") + '"/></svg>';
+        };
+        const metric = (t, label, k, v, color) => '<div class="fleet-row"><span>' + label + '</span>' + spark(t.trend, k, color) + '<span class="val-cell">' + v.toFixed(0) + '%</span></div>';
+        const down = r.data.filter(t=> t.status === "DOWN").length;
+        document.getElementById("fleet-info").innerText = r.data.length + " hosts" + (down ? ", " + down + " down" : "");
+        document.getElementById("fleet-grid").innerHTML = r.data.map(t=> '<div class="fleet-tile status-' + (t.status in lvl ? lvl[t.status] : 3) + '" title="' + esc((t.via ? t.via.join(" / ") + " / " : "") + t.name + "\n" + t.url + (t.host ? "\nhost " + t.host : "")) + '">' +
+            '<div class="fleet-row"><span class="fleet-name">' + esc(t.name) + (t.group && group === "*" ? ' <span class="cap-note">' + esc(t.group) + '</span>' : '') + '</span><span>' + t.status + (t.alerts ? ' (' + t.alerts + ')' : '') + '</span></div>' +
+            metric(t, "CPU", "cpu", t.cpu, "#00d1b2") + metric(t, "Mem", "mem", t.mem, "#209cee") + metric(t, "Disk", "disk", t.disk, "#ffdd57") +
+            '<div class="fleet-row cap-note">' + (t.last_seen ? 'seen ' + new Date(t.last_seen*1000).toLocaleTimeString() : 'not seen yet') + '</div></div>').join("") ||
+            '<span class="cap-note">No matching hosts</span>';
+    });
+}
+setInterval(loadFleet, 30000); setTimeout(loadFleet, 3000);
+function loadBaseline() {
+    if(document.getElementById("hidden-panels").contains(document.getElementById("tbl-baseline"))) return;
+    fetch("api/v1/baseline").then(r=>r.ok ? r.json() : null).then(r=>{
+        if(!r) return;
+        const d = r.data, esc = s => String(s || "").replace(/</g, '&lt;');
+        document.getElementById("baseline-info").textContent = "since " + new Date(d.baseline.time*1000).toLocaleDateString();
+        document.getElementById("tbl-baseline").innerHTML = d.drift.map(x=> (x.added||[]).map(a=> '<tr><td class="status-1">+</td><td>' + x.what + '</td><td class="val-cell">' + esc(a) + '</td></tr>').join("") +
+            (x.removed||[]).map(a=> '<tr><td class="status-2">-</td><td>' + x.what + '</td><td class="val-cell">' + esc(a) + '</td></tr>').join("")).join("") ||
+            '<tr><td colspan="3" class="cap-note">No drift, checked ' + new Date(d.checked*1000).toLocaleTimeString() + '</td></tr>';
+    });
+}
+setInterval(loadBaseline, 60000); setTimeout(loadBaseline, 3000);
+const evt = new EventSource("events?compact=1");
+evt.onopen = () => { LIVE = null; PROCS = new Map(); };
+evt.onmessage = (e) => {
+    const m = applyDelta(JSON.parse(e.data));
+    STATE.data.push(m);
+    if(STATE.data.length > 86400) STATE.data.shift();
+
+    if(STATE.mode==='live') updatePlugins(m.plugins);
+
+    if(m.ts % 2 === 0 && m.p_list) {
+        const tbl = (id, l, f) => {
+            document.getElementById(id).innerHTML = l.map(p=> '<tr><td>' + p.pid + '</td><td>' + p.name + '</td><td class="val-cell">' + f(p) + '</td></tr>').join("");
+        };
+        tbl("tbl-cpu", [...m.p_list].sort((a,b)=>b.cpu-a.cpu).slice(0,5), p=>p.cpu.toFixed(1)+"%");
+        tbl("tbl-mem", [...m.p_list].sort((a,b)=>b.mem-a.mem).slice(0,5), p=>fmtBytes(p.mem));
+        tbl("tbl-io", [...m.p_list].sort((a,b)=>(b.d_read+b.d_write)-(a.d_read+a.d_write)).slice(0,5), p=>fmtBytes(p.d_read+p.d_write)+"/s");
+        capNote("tbl-io", "process_io");
+        if(m.cores) document.getElementById("load-cores").innerText = m.cores + " cores, " + (m.load_core||0).toFixed(2) + " per core";
+        if(m.groups) document.getElementById("tbl-groups").innerHTML = m.groups.slice(0,8).map(g=> '<tr title="' + g.kind + ', ' + g.procs + ' processes"><td>' + g.name.replace(/</g, '&lt;') + '</td><td class="val-cell">' + g.cpu.toFixed(1) + '%</td><td class="val-cell">' + fmtBytes(g.mem) + '</td></tr>').join("");
+        
+        const sel = document.getElementById("proc-select");
+        if(document.getElementById("proc-filter").value === "" && (sel.options.length < 2 || m.ts % 10 === 0)) {
+            const val = sel.value;
+            const keys = [...new Set([...m.p_list].sort((a,b)=>b.cpu-a.cpu).map(pKey))];
+            sel.innerHTML = "<option value=''>-- Select --</option>" + keys.map(k=> '<option value="' + k.replace(/"/g, '&quot;') + '">' + k.replace(/</g, '&lt;') + '</option>').join("");
+            sel.value = val;
+            if(STATE.pkey) loadProcPIDs();
+        }
+    }
+    const devSel = document.getElementById("io-dev");
+    if(m.disks && devSel.options.length !== m.disks.length + 1) {
+        const val = devSel.value;
+        devSel.innerHTML = '<option value="">all</option>' + m.disks.map(x => '<option>' + x.name + '</option>').join("");
+        devSel.value = val;
+    }
+    if(m.ts % 5 === 0) {
+        document.getElementById("tbl-ports").innerHTML = (m.ports||[]).map(p=> '<tr' + (p.proto === "TCP" ? ' class="port-row" onclick="togglePortClients(' + p.port + ')"' : '') + (p.addr ? ' title="' + p.addr + (p.unexpected ? ', not in expected_ports' : '') + '"' : '') + '><td' + (p.unexpected ? ' class="status-1"' : '') + '>' + p.port + '</td><td>' + p.proto + '</td><td>' + p.name + '</td></tr>' + (p.proto === "TCP" && p.port === STATE.portClients ? '<tr id="port-clients"></tr>' : '')).join("");
+        capNote("tbl-ports", "ports");
+        loadPortClients();
+    }
+    if(m.heartbeats) {
+        document.getElementById("tbl-hb").innerHTML = m.heartbeats.map(h=> '<tr><td class="status-' + (h.late?2:0) + '">' + h.name + '</td><td class="val-cell">' + (h.last_seen ? new Date(h.last_seen*1000).toLocaleTimeString() : 'never') + '</td></tr>').join("");
+    }
+    if(STATE.mode==='live') drawAll();
+};
+
+fetch("history").then(r=>r.json()).then(d=>{ if(d) STATE.data=d; drawAll(); });
+// Preferences hide panels the user has unticked; the layout itself stays the admin's.
+function loadLayout() {
+    const catalog = fetch("api/v1/catalog").then(r=>r.ok ? r.json() : null).then(r=>{ if(r) STATE.catalog = r.data; }).catch(()=>{});
+    Promise.all([fetch("api/v1/layout").then(r=>r.ok ? r.json() : null), catalog]).then(([r])=>{
+        if(!r) return;
+        STATE.layout = r.data;
+        const show = PREFS.panels || [];
+        applyLayout(show.length ? r.data.filter(p => show.includes(p.id)) : r.data);
+    });
+}
+
+let PREFS = {};
+function applyPrefs(p) {
+    PREFS = p;
+    const light = p.theme === "light";
+    document.body.classList.toggle("light", light);
+    THEME.grid = light ? "#ddd" : "#333"; THEME.axis = light ? "#666" : "#999";
+    Object.assign(COLORS, DEFAULT_COLORS, p.colors || {});
+    document.querySelectorAll("[data-color]").forEach(el => el.style.color = colorOf(el.dataset.color));
+    if(p.range) { STATE.mode = 'live'; STATE.dur = p.range; }
+    loadLayout(); drawForecast();
+}
+function loadPrefs() { fetch("api/v1/preferences").then(r=>r.ok ? r.json() : null).then(r=>applyPrefs(r ? r.data : {})); }
+function openPrefs() {
+    document.getElementById("pf-theme").value = PREFS.theme || "dark";
+    document.getElementById("pf-range").value = PREFS.range ? Math.round(PREFS.range / 60) : "";
+    const show = PREFS.panels || [];
+    document.getElementById("pf-panels").innerHTML = (STATE.layout || []).map(p => '<label style="font-size:11px; margin-right:10px;"><input type="checkbox" value="' + p.id + '"' + (!show.length || show.includes(p.id) ? ' checked' : '') + '> ' + (p.title || p.id) + '</label>').join("");
+    document.getElementById("pf-colors").innerHTML = Object.keys(DEFAULT_COLORS).map(k => '<label style="font-size:11px; margin-right:10px;">' + k + ' <input type="color" data-key="' + k + '" value="' + COLORS[k] + '" style="width:30px; padding:0;"></label>').join("");
+    document.getElementById("prefs-modal").style.display = "flex";
+    showPush();
+}
+// savePrefs with null goes back to the defaults the admin set.
+function savePrefs(p) {
+    if(p === undefined) {
+        const boxes = [...document.querySelectorAll("#pf-panels input")], on = boxes.filter(b => b.checked).map(b => b.value);
+        const colors = {}; document.querySelectorAll("#pf-colors input").forEach(i => colors[i.dataset.key] = i.value);
+        p = { theme: document.getElementById("pf-theme").value, range: (parseInt(document.getElementById("pf-range").value) || 0) * 60, panels: on.length === boxes.length ? [] : on, colors: colors };
+    }
+    fetch("api/v1/preferences", { method: 'PUT', headers: {'Content-Type': 'application/json'}, body: JSON.stringify(p || {}) })
+    .then(r => r.json().then(res => {
+        if(!r.ok) { alert("Not saved:\n" + (((res.error||{}).fields||[]).map(x => x.field + ": " + x.message).join("\n") || (res.error||{}).message)); return; }
+        document.getElementById("prefs-modal").style.display = "none";
+        applyPrefs(res.data);
+    }));
+}
+loadPrefs();
+
+// Web Push: the service worker receives the "push" channel's alerts even with the dashboard closed.
+const SW = "serviceWorker" in navigator ? navigator.serviceWorker.register("sw.js").catch(() => null) : Promise.resolve(null);
+const b64key = s => Uint8Array.from(atob(s.replace(/-/g, "+").replace(/_/g, "/")), c => c.charCodeAt(0));
+function showPush() {
+    const state = document.getElementById("pf-push-state"), btn = document.getElementById("pf-push-btn");
+    SW.then(reg => {
+        if(!reg || !("PushManager" in window)) { state.innerText = "Not available (needs HTTPS and a browser with Web Push; on iPhone, add Pulse to the home screen first)."; btn.style.display = "none"; return; }
+        reg.pushManager.getSubscription().then(sub => {
+            state.innerText = sub ? "This device receives alerts." : "Off for this device.";
+            btn.innerText = sub ? "Turn Off" : "Turn On"; btn.style.display = "";
+        });
+    });
+}
+function togglePush() {
+    SW.then(reg => reg.pushManager.getSubscription().then(sub => {
+        if(sub) return fetch("push/subscribe", { method: 'DELETE', body: JSON.stringify({endpoint: sub.endpoint}) }).then(() => sub.unsubscribe());
+        return Notification.requestPermission().then(p => {
+            if(p !== "granted") throw new Error("notifications are blocked for this site");
+            return fetch("push/key").then(r => r.json()).then(k => reg.pushManager.subscribe({ userVisibleOnly: true, applicationServerKey: b64key(k.public_key) }));
+        }).then(s => fetch("push/subscribe", { method: 'POST', headers: {'Content-Type': 'application/json'}, body: JSON.stringify(s) }).then(r => { if(!r.ok) return r.text().then(t => { throw new Error(t); }); }));
+    })).catch(e => alert("Push: " + e.message)).then(showPush);
+}
+
+const lvlClass = { OK: 0, WARNING: 1, CRITICAL: 2, REMEDIATION: 3, ACK: 3 };
+const ROLES = { viewer: 1, operator: 2, admin: 3 };
+let ROLE = 'admin';
+function alertAction(path, mon) {
+    fetch(path + '?monitor=' + encodeURIComponent(mon), {method: 'POST'}).then(r => r.text().then(t => { if(!r.ok) alert(t); loadAlerts(); }));
+}
+function loadAlerts() {
+    fetch("alerts/active").then(r=>r.json()).then(list => {
+        const op = ROLES[ROLE] >= ROLES.operator;
+        document.getElementById("active-alerts").innerHTML = list.map(a => {
+            const m = a.monitor.replace(/'/g, "\\'").replace(/"/g, '&quot;');
+            let s = '<span class="status-' + (lvlClass[a.level]||0) + '" style="margin-left:10px;">' + a.monitor + '</span>';
+            if (a.acked_by) s += ' <span style="color:#666;">(ack ' + a.acked_by + ')</span>';
+            else if (op) s += ' <button onclick="alertAction(\'alerts/ack\', \'' + m + '\')">ACK</button>';
+            if (op && a.remediation) s += ' <button onclick="alertAction(\'remediate\', \'' + m + '\')">FIX</button>';
+            return s;
+        }).join("");
+    });
+    fetch("alerts").then(r=>r.json()).then(list => {
+        if(!list) return;
+        document.getElementById("tbl-alerts").innerHTML = list.slice(-50).reverse().map(a => '<tr><td>' + new Date(a.time*1000).toLocaleString() + '</td><td class="status-' + (lvlClass[a.level]||0) + '">' + a.level + '</td><td>' + a.monitor + '</td><td title="' + (a.remediation||'').replace(/"/g, '&quot;') + '" style="max-width:400px;">' + (a.message||'') + '</td></tr>').join("");
+    });
+}
+loadAlerts(); setInterval(loadAlerts, 10000);
+// The incident timeline: one row per incident, its bar placed between the oldest incident's start and now.
+let OPEN_INCIDENT = 0;
+function openIncidents() {
+    fetch("api/v1/incidents?limit=200").then(r=>r.json()).then(r => {
+        const list = r.data || [], now = Date.now()/1000, esc = s => String(s || "").replace(/&/g, '&amp;').replace(/</g, '&lt;');
+        const from = Math.min(now - 86400, ...list.map(i => i.start)), span = now - from;
+        const dur = s => s >= 86400 ? Math.floor(s/86400) + 'd ' + Math.floor(s%86400/3600) + 'h' : s >= 3600 ? Math.floor(s/3600) + 'h ' + Math.floor(s%3600/60) + 'm' : Math.floor(s/60) + 'm ' + s%60 + 's';
+        const when = t => new Date(t*1000).toLocaleString(), op = ROLES[ROLE] >= ROLES.operator;
+        document.getElementById("incidents-range").innerText = when(from) + ' to now';
+        document.getElementById("incidents-list").innerHTML = list.map(i => {
+            const left = 100*(i.start-from)/span, width = Math.max(0.4, 100*i.duration/span), color = i.level === 'CRITICAL' ? '#ff3860' : '#ffdd57';
+            let s = '<div class="status-' + (lvlClass[i.level]||0) + '" style="padding:4px 6px; margin-bottom:4px; cursor:pointer;" onclick="OPEN_INCIDENT = OPEN_INCIDENT === ' + i.id + ' ? 0 : ' + i.id + '; openIncidents()">' +
+                '<div><b>' + esc(i.monitor) + '</b> ' + i.level + (i.open ? ' <span style="color:' + color + ';">ongoing</span>' : '') + ' <span style="color:#888;">' + when(i.start) + ', ' + dur(i.duration) +
+                ', peak ' + +i.peak.toFixed(2) + ', ' + i.alerts + ' alerts' + (i.acks.length ? ', ack ' + esc(i.acks.map(a => a.user).join(", ")) : '') + (i.notes.length ? ', ' + i.notes.length + ' notes' : '') + '</span></div>' +
+                '<div style="position:relative; height:4px; background:#333; margin-top:3px;"><div style="position:absolute; left:' + left + '%; width:' + width + '%; height:4px; background:' + color + ';"></div></div></div>';
+            if (i.id !== OPEN_INCIDENT) return s;
+            s += '<div style="margin:0 0 8px 12px;">' + i.events.map(e => '<div><span style="color:#888;">' + when(e.time) + '</span> ' + e.level + ' ' + esc(e.message) + '</div>').join("") +
+                i.notes.map(n => '<div style="color:#209cee;">' + when(n.time) + ' ' + esc(n.user) + ': ' + esc(n.text) + '</div>').join("");
+            if (op) s += '<div style="margin-top:4px;"><input type="text" id="incident-note" placeholder="Add a note" style="width:70%; font-size:11px;"> <button onclick="addIncidentNote(' + i.id + ')">ADD</button></div>';
+            return s + '</div>';
+        }).join("") || '<div class="cap-note">No incidents in the alert log</div>';
+        document.getElementById("incidents-modal").style.display = "flex";
+    });
+}
+function addIncidentNote(id) {
+    const text = document.getElementById("incident-note").value.trim();
+    if (!text) return;
+    fetch("api/v1/incidents/" + id + "/notes", { method: 'POST', headers: {'Content-Type': 'application/json'}, body: JSON.stringify({text: text}) })
+        .then(r => r.json()).then(r => { if (r.error) alert(r.error.message); openIncidents(); });
+}
+fetch('session').then(r=>r.json()).then(s => {
+    ROLE = s.role; loadAlerts();
+    if (ROLES[ROLE] < ROLES.admin) document.getElementById("btn-settings").style.display = "none";
+    if (!s.auth) return;
+    document.getElementById("session-user").innerText = s.user + ' (' + s.role + ')';
+    document.getElementById("session-box").style.display = "inline";
+});
+
+let FORECAST = [];
+function loadForecast() {
+    fetch('forecast').then(r=>r.json()).then(list => {
+        FORECAST = list || [];
+        const sel = document.getElementById("fc-mount"), cur = sel.value;
+        sel.innerHTML = FORECAST.map(f => '<option>' + f.path + '</option>').join("");
+        if (FORECAST.some(f => f.path === cur)) sel.value = cur;
+        drawForecast();
+    });
+}
+function drawForecast() {
+    const cvs = document.getElementById("c-fc"), ctx = cvs.getContext("2d");
+    cvs.width = cvs.parentElement.clientWidth; cvs.height = cvs.parentElement.clientHeight;
+    const w=cvs.width, h=cvs.height, pL=40, pB=30;
+    ctx.clearRect(0,0,w,h);
+    const f = FORECAST.find(x => x.path === document.getElementById("fc-mount").value) || FORECAST[0];
+    const info = document.getElementById("fc-info");
+    if (!f) { info.innerText = ""; return; }
+    info.innerText = f.pct.toFixed(1) + "% | " + (f.days_left < 0 ? "not growing" : "full in " + f.days_left.toFixed(1) + "d");
+    info.style.color = f.days_left >= 0 && f.days_left < 14 ? "#ff3860" : "#999";
+    const pts = f.points || [], proj = f.projection || [];
+    if (pts.length < 2) return;
+    const t0 = pts[0][0], t1 = proj.length ? proj[proj.length-1][0] : pts[pts.length-1][0];
+    const X = t => pL + (t-t0)/((t1-t0)||1)*(w-pL), Y = v => (h-pB) - Math.min(v,100)/100*(h-pB);
+    ctx.strokeStyle=THEME.grid; ctx.fillStyle=THEME.axis; ctx.beginPath();
+    for(let i=0;i<=4;i++) { const y=Y(i*25); ctx.moveTo(pL,y); ctx.lineTo(w,y); ctx.fillText(i*25+"%", 2, y+3); }
+    for(let i=0;i<=4;i++) { const t=t0+i*(t1-t0)/4, x=X(t); ctx.moveTo(x,0); ctx.lineTo(x,h-pB); ctx.fillText(new Date(t*1000).toLocaleDateString(), x-20, h-10); }
+    ctx.stroke();
+    const line = (arr, c, dash) => {
+        ctx.strokeStyle=c; ctx.lineWidth=2; ctx.setLineDash(dash); ctx.beginPath();
+        arr.forEach((p,i) => i===0 ? ctx.moveTo(X(p[0]),Y(p[1])) : ctx.lineTo(X(p[0]),Y(p[1])));
+        ctx.stroke(); ctx.setLineDash([]);
+    };
+    line(pts, "#ffdd57", []); line(proj, colorOf("forecast"), [5,4]);
+}
+new ResizeObserver(drawForecast).observe(document.getElementById("c-fc").parentElement);
+loadForecast(); setInterval(loadForecast, 60000);
@@ -0,0 +1,20 @@
+// Pulse service worker: shows alert pushes and opens the dashboard when one is tapped.
+self.addEventListener("install", () => self.skipWaiting());
+self.addEventListener("activate", e => e.waitUntil(self.clients.claim()));
+
+self.addEventListener("push", e => {
+    let d = {};
+    try { d = e.data ? e.data.json() : {}; } catch (err) { d = { title: "Pulse", body: e.data.text() }; }
+    e.waitUntil(self.registration.showNotification(d.title || "Pulse", {
+        body: d.body || "", tag: d.tag, renotify: true, icon: "icon.svg", badge: "icon.svg",
+        requireInteraction: d.level === "CRITICAL", data: { monitor: d.monitor }
+    }));
+});
+
+self.addEventListener("notificationclick", e => {
+    e.notification.close();
+    e.waitUntil(self.clients.matchAll({ type: "window" }).then(list => {
+        for (const c of list) if ("focus" in c) return c.focus();
+        return self.clients.openWindow(self.registration.scope);
+    }));
+});
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// --- DASHBOARD FILES & LAYOUT ---
+// The dashboard is web/index.html plus the files under /assets/. With --web-dir (PULSE_WEB_DIR) a
+// file of the same name in that directory is served instead of the built-in one, and new files
+// (logos, extra scripts) are served too; custom.css and custom.js are empty hooks for small
+// changes. "panels" in pulse.conf sets which dashboard panels appear, in which column and order,
+// and adds charts of any export field; GET/PUT /api/v1/layout reads and replaces it.
+
+var webDir string
+
+type PanelConfig struct {
+	ID      string   `json:"id"`
+	Column  string   `json:"column,omitempty"`  // left (default) or right
+	Title   string   `json:"title,omitempty"`   // custom charts
+	Metrics []string `json:"metrics,omitempty"` // custom charts: one or two export fields, e.g. "plugin:backup/age"
+	Unit    string   `json:"unit,omitempty"`    // custom charts: "%", "B" or any label
+	Height  int      `json:"height,omitempty"`  // pixels
+}
+
+// builtinPanels is the default layout; the ids match data-panel in index.html.
+var builtinPanels = []PanelConfig{
+	{ID: "system"}, {ID: "load"}, {ID: "io"}, {ID: "plugins"}, {ID: "processes"}, {ID: "alerts"},
+	{ID: "top-cpu", Column: "right"}, {ID: "top-mem", Column: "right"}, {ID: "top-io", Column: "right"}, {ID: "groups", Column: "right"}, {ID: "ports", Column: "right"}, {ID: "heartbeats", Column: "right"},
+}
+
+// The eBPF, GeoIP, ARP, Fleet and Sites panels are built in too, but only join the default layout when switched on;
+// Pressure and CPU Frequency once this host turned out to have them, Baseline Drift once a baseline is saved.
+// Collector series each get a chart at the end.
+func dashboardLayout(c AppConfig) []PanelConfig {
+	if len(c.Panels) > 0 { return c.Panels }
+	layout := slices.Clone(builtinPanels)
+	for _, name := range c.EBPF { layout = append(layout, PanelConfig{ID: ebpfPanelIDs[name], Column: "right"}) }
+	if len(c.GeoIPDB) > 0 { layout = append(layout, PanelConfig{ID: "geoip", Column: "right"}) }
+	if len(c.ARPSubnets) > 0 { layout = append(layout, PanelConfig{ID: "arp", Column: "right"}) }
+	if hasBaseline.Load() { layout = append(layout, PanelConfig{ID: "baseline", Column: "right"}) }
+	if len(c.FederateSources) > 0 { layout = append(layout, PanelConfig{ID: "fleet"}, PanelConfig{ID: "sites", Column: "right"}) }
+	if hasPressure.Load() { layout = append(layout, PanelConfig{ID: "pressure"}) }
+	if hasCPUFreq.Load() { layout = append(layout, PanelConfig{ID: "cpu-freq"}) }
+	return append(layout, metricPanels()...)
+}
+
+func validatePanels(list []PanelConfig, bad func(field, format string, a ...interface{})) {
+	seen := map[string]bool{}
+	for i, p := range list {
+		f := fmt.Sprintf("panels[%d]", i)
+		builtin := false
+		for _, b := range builtinPanels { builtin = builtin || b.ID == p.ID }
+		for _, id := range ebpfPanelIDs { builtin = builtin || id == p.ID }
+		builtin = builtin || p.ID == "geoip" || p.ID == "arp" || p.ID == "baseline" || p.ID == "sites" || p.ID == "fleet" || p.ID == "pressure" || p.ID == "cpu-freq"
+		switch {
+		case p.ID == "": bad(f, "id is required")
+		case seen[p.ID]: bad(f, "duplicate id %q", p.ID)
+		case p.Column != "" && p.Column != "left" && p.Column != "right": bad(f, "column must be left or right")
+		case !builtin && (len(p.Metrics) == 0 || len(p.Metrics) > 2): bad(f, "%q is not a built-in panel, so it needs one or two metrics", p.ID)
+		case p.Height < 0: bad(f, "height must not be negative")
+		}
+		if _, err := exportColumns(p.Metrics, nil); err != nil { bad(f, "%v", err) }
+		seen[p.ID] = true
+	}
+}
+
+// openWebFile looks in --web-dir first, then in the compiled-in files.
+func openWebFile(name string) (fs.File, error) {
+	if webDir != "" {
+		if f, err := os.Open(filepath.Join(webDir, filepath.FromSlash(name))); err == nil { return f, nil }
+	}
+	return webFiles.Open("web/" + name)
+}
+
+func serveWebFile(w http.ResponseWriter, name string) {
+	f, err := openWebFile(name)
+	if err != nil { http.Error(w, "404 page not found", http.StatusNotFound); return }
+	defer f.Close()
+	if st, err := f.Stat(); err != nil || st.IsDir() { http.Error(w, "404 page not found", http.StatusNotFound); return }
+	ct := mime.TypeByExtension(path.Ext(name))
+	if ct == "" { ct = "application/octet-stream" }
+	w.Header().Set("Content-Type", ct)
+	// Revalidate every time, so a new binary or an edited override is picked up on reload.
+	w.Header().Set("Cache-Control", "no-cache")
+	io.Copy(w, f)
+}
+
+func serveDashboard(w http.ResponseWriter, r *http.Request) { serveWebFile(w, "index.html") }
+
+func serveAsset(w http.ResponseWriter, r *http.Request) {
+	name := path.Clean("/" + r.URL.Path)[1:]
+	if name == "" || name == "index.html" || strings.HasPrefix(name, ".") { http.Error(w, "404 page not found", http.StatusNotFound); return }
+	serveWebFile(w, name)
+}
+
+func registerLayoutAPI(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/v1/layout", func(w http.ResponseWriter, r *http.Request) {
+		cfgMutex.RLock(); c := config; cfgMutex.RUnlock()
+		apiOK(w, 200, dashboardLayout(c), nil)
+	})
+	mux.HandleFunc("PUT /api/v1/layout", apiRole("admin", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+		if !strings.HasPrefix(strings.TrimSpace(string(body)), "[") { apiFail(w, http.StatusBadRequest, apiError{"bad_request", "body must be a JSON array of panels", nil}); return }
+		errs, err := updateConfig([]byte(`{"panels":`+string(body)+`}`), actor(r), "api")
+		if err != nil { apiFail(w, http.StatusInternalServerError, apiError{"internal", err.Error(), nil}); return }
+		if len(errs) > 0 { apiFail(w, http.StatusUnprocessableEntity, apiError{"invalid_config", "the layout was not changed", errs}); return }
+		cfgMutex.RLock(); c := config; cfgMutex.RUnlock()
+		apiOK(w, 200, dashboardLayout(c), nil)
+	}))
+}
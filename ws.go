@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// --- WEBSOCKET ---
+// /ws streams the same samples as /events, but the client chooses what it wants and only gets
+// what changed. Client messages (both optional, either can be sent again at any time):
+//   {"topics": ["global", "plugins"]}   global, processes, ports, plugins, heartbeats, mounts (default: all)
+//   {"pid": 1234}                       also follow one process; 0 stops
+// Every sample is answered with {"type":"sample","data":{...}}: complete after connecting or
+// subscribing, then only the fields that changed ("ts" is always there). A followed PID adds
+// {"type":"process","data":{...}}, with null data once the process is gone.
+
+var wsTopics = map[string][]string{
+	"global":     {"host", "uptime", "load1", "load5", "load15", "cores", "load_core", "procs", "cpu_tot", "mem_used", "swp_used", "dsk_used", "dsk_read", "dsk_writ", "net_down", "net_up"},
+	"processes":  {"p_list"},
+	"ports":      {"ports"},
+	"plugins":    {"plugins"},
+	"heartbeats": {"heartbeats"},
+	"mounts":     {"mounts"},
+}
+
+type wsRequest struct {
+	Topics []string `json:"topics"`
+	PID    *int32   `json:"pid"`
+}
+
+type wsMessage struct {
+	Type  string      `json:"type"`
+	Data  interface{} `json:"data"`
+	Error string      `json:"error,omitempty"`
+}
+
+var wsUpgrader = websocket.Upgrader{ReadBufferSize: 1024, WriteBufferSize: 16384, EnableCompression: true, CheckOrigin: wsOrigin}
+
+func topicKeys(topics []string) (map[string]bool, error) {
+	if len(topics) == 0 { topics = []string{"global", "processes", "ports", "plugins", "heartbeats", "mounts"} }
+	keys := make(map[string]bool)
+	for _, t := range topics {
+		ks, ok := wsTopics[t]
+		if !ok {
+			var names []string
+			for n := range wsTopics { names = append(names, n) }
+			sort.Strings(names)
+			return nil, fmt.Errorf("unknown topic %q (%v)", t, names)
+		}
+		for _, k := range ks { keys[k] = true }
+	}
+	return keys, nil
+}
+
+// fieldDelta returns the fields of m listed in keys whose JSON differs from prev, and records them in prev.
+func fieldDelta(m RichMetrics, keys map[string]bool, prev map[string]string) map[string]json.RawMessage {
+	var all map[string]json.RawMessage
+	b, _ := json.Marshal(m); json.Unmarshal(b, &all)
+	out := map[string]json.RawMessage{"ts": all["ts"]}
+	for k := range keys {
+		if v := all[k]; string(v) != prev[k] { out[k] = v; prev[k] = string(v) }
+	}
+	return out
+}
+
+func handleWS(w http.ResponseWriter, r *http.Request) {
+	conn, err := wsUpgrader.Upgrade(w, r, nil)
+	if err != nil { return } // Upgrade has already answered
+	defer conn.Close()
+	// A skipped sample is covered by the next delta.
+	ch := samples.subscribe("ws"); defer samples.unsubscribe(ch)
+
+	reqs, gone := make(chan wsRequest), make(chan struct{})
+	go func() {
+		defer close(gone)
+		for {
+			var req wsRequest
+			if err := conn.ReadJSON(&req); err != nil {
+				if _, ok := err.(*json.SyntaxError); ok { continue }
+				return
+			}
+			select { case reqs <- req: case <-r.Context().Done(): return }
+		}
+	}()
+
+	keys, _ := topicKeys(nil)
+	var pid int32
+	prev := make(map[string]string)
+	send := func(v wsMessage) bool {
+		conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+		return conn.WriteJSON(v) == nil
+	}
+	sample := func(m RichMetrics) bool {
+		if m.Timestamp == 0 { return true }
+		if !send(wsMessage{Type: "sample", Data: fieldDelta(m, keys, prev)}) { return false }
+		if pid == 0 { return true }
+		var p *ProcessInfo
+		for i := range m.ProcessList { if m.ProcessList[i].PID == pid { p = &m.ProcessList[i]; break } }
+		return send(wsMessage{Type: "process", Data: p})
+	}
+	latest := func() RichMetrics { latestMutex.RLock(); defer latestMutex.RUnlock(); return latestMetric }
+	if !sample(latest()) { return }
+	ping := time.NewTicker(30 * time.Second); defer ping.Stop()
+	for {
+		select {
+		case <-stopCtx.Done():
+			conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "shutting down"), time.Now().Add(time.Second))
+			return
+		case <-gone: return
+		case <-ping.C:
+			if conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(10*time.Second)) != nil { return }
+		case req := <-reqs:
+			if req.Topics != nil {
+				k, err := topicKeys(req.Topics)
+				if err != nil { if !send(wsMessage{Type: "error", Error: err.Error()}) { return }; continue }
+				keys, prev = k, make(map[string]string)
+			}
+			if req.PID != nil { pid = *req.PID }
+			if !sample(latest()) { return }
+		case m := <-ch:
+			if !sample(m) { return }
+		}
+	}
+}